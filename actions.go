@@ -0,0 +1,189 @@
+package gate
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Standard actions shared across services so policies read the same everywhere
+const (
+	ActionCreate = "create"
+	ActionRead   = "read"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionList   = "list"
+)
+
+// ErrUnknownAction is thrown when an action is not part of the vocabulary
+var ErrUnknownAction = errors.New("unknown action")
+
+// StandardActions returns the standard actions
+func StandardActions() []string {
+	return []string{ActionCreate, ActionRead, ActionUpdate, ActionDelete, ActionList}
+}
+
+// ActionVocabulary is the set of actions known to the policies, the standard actions and the registered custom verbs
+type ActionVocabulary struct {
+	verbs map[string]bool
+	*sync.RWMutex
+}
+
+// Register adds custom verbs, e.g. "publish" or "approve". Verbs are case-insensitive
+func (vocabulary ActionVocabulary) Register(verbs ...string) {
+	vocabulary.Lock()
+	defer vocabulary.Unlock()
+
+	for _, verb := range verbs {
+		vocabulary.verbs[strings.ToLower(verb)] = true
+	}
+}
+
+// Has determines if the verb is part of the vocabulary
+func (vocabulary ActionVocabulary) Has(verb string) bool {
+	vocabulary.RLock()
+	defer vocabulary.RUnlock()
+
+	return vocabulary.verbs[strings.ToLower(verb)]
+}
+
+// Verbs returns the verbs of the vocabulary in order
+func (vocabulary ActionVocabulary) Verbs() (verbs []string) {
+	vocabulary.RLock()
+	defer vocabulary.RUnlock()
+
+	for verb := range vocabulary.verbs {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+	return
+}
+
+// Validate ensures the action of every ability is a verb of the vocabulary or a pattern matching at least one of them, e.g. "*".
+// It fails with ErrUnknownAction for the first offending ability
+func (vocabulary ActionVocabulary) Validate(abilities []UserAbility, matcher Matcher) error {
+	verbs := vocabulary.Verbs()
+	for _, ability := range abilities {
+		action := ability.GetAction()
+		if vocabulary.Has(action) {
+			continue
+		}
+
+		known := false
+		for _, verb := range verbs {
+			match, err := matcher.Match(verb, action)
+			if err != nil {
+				return errors.Wrapf(err, "invalid action %q", action)
+			}
+
+			if match {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return errors.WithMessage(ErrUnknownAction, action)
+		}
+	}
+
+	return nil
+}
+
+// NewActionVocabulary is the constructor for ActionVocabulary. The standard actions are always included
+func NewActionVocabulary(verbs ...string) ActionVocabulary {
+	vocabulary := ActionVocabulary{map[string]bool{}, &sync.RWMutex{}}
+	vocabulary.Register(StandardActions()...)
+	vocabulary.Register(verbs...)
+	return vocabulary
+}
+
+// CollectionFunc determines if a request path addresses a collection rather than a single resource, e.g. "/posts" against "/posts/1"
+type CollectionFunc func(path string) bool
+
+// TrailingSlashCollection treats paths ending with a slash as collections
+func TrailingSlashCollection(path string) bool {
+	return len(path) > 1 && strings.HasSuffix(path, "/")
+}
+
+// ActionMapping maps HTTP methods to actions. Collection requests may be mapped differently, e.g. GET to "list" instead of "read"
+type ActionMapping struct {
+	methods     map[string]string
+	collections map[string]string
+	collection  CollectionFunc
+}
+
+// Map maps the method to the action
+func (mapping *ActionMapping) Map(method, action string) {
+	mapping.methods = copyActions(mapping.methods)
+	mapping.methods[strings.ToUpper(method)] = action
+}
+
+// MapCollection maps the method of collection requests to the action
+func (mapping *ActionMapping) MapCollection(method, action string) {
+	mapping.collections = copyActions(mapping.collections)
+	mapping.collections[strings.ToUpper(method)] = action
+}
+
+// SetCollectionFunc is the setter for the collection detector. Without a detector, no request is a collection request
+func (mapping *ActionMapping) SetCollectionFunc(collection CollectionFunc) {
+	mapping.collection = collection
+}
+
+// Action returns the action of a request with the method on the path. Unmapped methods are reported with ok being false
+func (mapping ActionMapping) Action(method, path string) (action string, ok bool) {
+	method = strings.ToUpper(method)
+	if mapping.collection != nil && mapping.collection(path) {
+		action, ok = mapping.collections[method]
+		if ok {
+			return
+		}
+	}
+
+	action, ok = mapping.methods[method]
+	return
+}
+
+// Validate ensures every mapped action is a verb of the vocabulary. It fails with ErrUnknownAction otherwise
+func (mapping ActionMapping) Validate(vocabulary ActionVocabulary) error {
+	for _, actions := range []map[string]string{mapping.methods, mapping.collections} {
+		for method, action := range actions {
+			if !vocabulary.Has(action) {
+				return errors.WithMessage(ErrUnknownAction, method+" "+action)
+			}
+		}
+	}
+
+	return nil
+}
+
+// copyActions copies the actions so mappings copied by value do not share them
+func copyActions(actions map[string]string) map[string]string {
+	result := make(map[string]string, len(actions)+1)
+	for method, action := range actions {
+		result[method] = action
+	}
+	return result
+}
+
+// NewActionMapping is the constructor for ActionMapping with the standard table:
+// POST creates, GET and HEAD read, PUT and PATCH update, DELETE deletes, and GET and HEAD list collections
+func NewActionMapping() ActionMapping {
+	return ActionMapping{
+		methods: map[string]string{
+			http.MethodPost:   ActionCreate,
+			http.MethodGet:    ActionRead,
+			http.MethodHead:   ActionRead,
+			http.MethodPut:    ActionUpdate,
+			http.MethodPatch:  ActionUpdate,
+			http.MethodDelete: ActionDelete,
+		},
+		collections: map[string]string{
+			http.MethodGet:  ActionList,
+			http.MethodHead: ActionList,
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package gate
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestActionVocabulary(t *testing.T) {
+	vocabulary := NewActionVocabulary("Publish")
+	vocabulary.Register("approve")
+
+	for _, verb := range []string{ActionRead, "publish", "APPROVE"} {
+		if !vocabulary.Has(verb) {
+			t.Fatalf("vocabulary should have the verb %q", verb)
+		}
+	}
+
+	if len(vocabulary.Verbs()) != 7 || vocabulary.Verbs()[0] != "approve" {
+		t.Fatalf("verbs should be sorted: %v", vocabulary.Verbs())
+	}
+
+	t.Run("validate", func(t *testing.T) {
+		matcher := NewMatcher()
+		err := vocabulary.Validate([]UserAbility{testAbility{"read", "posts"}, testAbility{"*", "posts"}, testAbility{"pub*", "posts"}}, matcher)
+		if err != nil {
+			t.Fatalf("err should be nil because of the known actions: %s", err)
+		}
+
+		err = vocabulary.Validate([]UserAbility{testAbility{"GET", "posts"}}, matcher)
+		if errors.Cause(err) != ErrUnknownAction {
+			t.Fatalf("err should be ErrUnknownAction because of the HTTP method: %v", err)
+		}
+	})
+}
+
+func TestActionMapping(t *testing.T) {
+	mapping := NewActionMapping()
+	cases := []struct {
+		method, path, action string
+	}{
+		{"POST", "/posts", ActionCreate},
+		{"get", "/posts/1", ActionRead},
+		{"GET", "/posts/", ActionRead},
+		{"PATCH", "/posts/1", ActionUpdate},
+		{"DELETE", "/posts/1", ActionDelete},
+	}
+
+	for _, c := range cases {
+		if action, ok := mapping.Action(c.method, c.path); !ok || action != c.action {
+			t.Fatalf("%s %s should be mapped to %q: %q", c.method, c.path, c.action, action)
+		}
+	}
+
+	if _, ok := mapping.Action("OPTIONS", "/posts"); ok {
+		t.Fatal("OPTIONS should not be mapped")
+	}
+
+	t.Run("collections", func(t *testing.T) {
+		collections := mapping
+		collections.SetCollectionFunc(TrailingSlashCollection)
+		if action, _ := collections.Action("GET", "/posts/"); action != ActionList {
+			t.Fatalf("collection requests should be listed: %q", action)
+		}
+
+		if action, _ := collections.Action("POST", "/posts/"); action != ActionCreate {
+			t.Fatalf("unmapped collection methods should fall back to the methods: %q", action)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		custom := mapping
+		custom.Map("PURGE", "purge")
+		if action, _ := custom.Action("purge", "/cache"); action != "purge" {
+			t.Fatalf("PURGE should be mapped: %q", action)
+		}
+
+		if _, ok := mapping.Action("PURGE", "/cache"); ok {
+			t.Fatal("copies should not share the table")
+		}
+
+		if err := custom.Validate(NewActionVocabulary()); errors.Cause(err) != ErrUnknownAction {
+			t.Fatalf("err should be ErrUnknownAction because of the unregistered verb: %v", err)
+		}
+
+		if err := custom.Validate(NewActionVocabulary("purge")); err != nil {
+			t.Fatalf("err should be nil because of the registered verb: %s", err)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/middleware"
+	"github.com/pkg/errors"
+)
+
+// DefaultObjectPrefix is the default prefix of the objects authorized for admin requests
+const DefaultObjectPrefix = "/admin"
+
+// ErrNotFound is thrown when no route matches an admin request
+var ErrNotFound = errors.New("not found")
+
+// Driver is the part of a gate driver the admin API relies on, e.g. password.Driver
+type Driver interface {
+	middleware.Authenticator
+	UserService() (gate.UserService, error)
+	GetUserAbilities(gate.User) ([]gate.UserAbility, error)
+	ListJWTs(userID string) ([]gate.JWT, error)
+	RevokeJWT(id string) error
+	SimulateAuthorize(user gate.User, action, object string) error
+}
+
+// Token is the representation of a stored token. The token value is never exposed
+type Token struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	ExpiredAt int64  `json:"expired_at"`
+	IssuedAt  int64  `json:"issued_at"`
+	SingleUse bool   `json:"single_use,omitempty"`
+}
+
+// Simulation is the body of an authorization simulation
+type Simulation struct {
+	UserID string `json:"user_id"`
+	Action string `json:"action"`
+	Object string `json:"object"`
+}
+
+// Decision is the result of an authorization simulation. The code of denials is the stable code of the failure, see gate.ErrorCode
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Code    string `json:"code,omitempty"`
+}
+
+// Router is the admin API. Every request is authorized by the middleware with the request method as the action
+// and the request path after the object prefix as the object, e.g. DELETE /admin/tokens/1. The routes are
+//
+//	GET    /users/{id}/tokens      lists the tokens of a user
+//	DELETE /tokens/{id}            revokes a token
+//	GET    /users/{id}/abilities   lists the effective abilities of a user
+//	POST   /authorize              simulates an authorization without its side effects, e.g. consuming quotas
+type Router struct {
+	driver       Driver
+	middleware   middleware.Middleware
+	objectPrefix string
+}
+
+// SetObjectPrefix is the setter for the prefix of the objects authorized for admin requests, DefaultObjectPrefix by default
+func (router *Router) SetObjectPrefix(prefix string) {
+	router.objectPrefix = prefix
+}
+
+// Handler returns the admin API protected by the middleware. Mount it with http.StripPrefix when it is not served from the root
+func (router Router) Handler() http.Handler {
+	protected := router.middleware
+	protected.SetResourceFunc(func(r *http.Request) (action, object string) {
+		return r.Method, router.objectPrefix + r.URL.Path
+	})
+
+	return protected.Authorize(http.HandlerFunc(router.serve))
+}
+
+func (router Router) serve(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(segments) == 3 && segments[0] == "users" && segments[2] == "tokens":
+		router.listTokens(w, segments[1])
+	case r.Method == http.MethodDelete && len(segments) == 2 && segments[0] == "tokens":
+		router.revokeToken(w, segments[1])
+	case r.Method == http.MethodGet && len(segments) == 3 && segments[0] == "users" && segments[2] == "abilities":
+		router.listAbilities(w, segments[1])
+	case r.Method == http.MethodPost && len(segments) == 1 && segments[0] == "authorize":
+		router.simulate(w, r)
+	default:
+		respondError(w, http.StatusNotFound, ErrNotFound)
+	}
+}
+
+func (router Router) listTokens(w http.ResponseWriter, userID string) {
+	tokens, err := router.driver.ListJWTs(userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, Token{token.ID, token.UserID, token.ExpiredAt.Unix(), token.IssuedAt.Unix(), token.SingleUse})
+	}
+
+	respond(w, http.StatusOK, result)
+}
+
+func (router Router) revokeToken(w http.ResponseWriter, id string) {
+	err := router.driver.RevokeJWT(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (router Router) listAbilities(w http.ResponseWriter, userID string) {
+	user, ok := router.findUser(w, userID)
+	if !ok {
+		return
+	}
+
+	abilities, err := router.driver.GetUserAbilities(user)
+	if err != nil && !gate.IsAuthorizationError(err) {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result := gate.NewAbilityClaims(abilities)
+	if result == nil {
+		result = []gate.AbilityClaim{}
+	}
+
+	respond(w, http.StatusOK, result)
+}
+
+func (router Router) simulate(w http.ResponseWriter, r *http.Request) {
+	var simulation Simulation
+	err := json.NewDecoder(r.Body).Decode(&simulation)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.Wrap(err, "invalid simulation"))
+		return
+	}
+
+	user, ok := router.findUser(w, simulation.UserID)
+	if !ok {
+		return
+	}
+
+	err = router.driver.SimulateAuthorize(user, simulation.Action, simulation.Object)
+	decision := Decision{Allowed: err == nil}
+	if err != nil {
+		decision.Code = gate.ErrorCode(err)
+	}
+
+	respond(w, http.StatusOK, decision)
+}
+
+func (router Router) findUser(w http.ResponseWriter, id string) (user gate.User, ok bool) {
+	service, err := router.driver.UserService()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	user, err = service.FindOneByID(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, errors.Wrap(err, "could not find the user"))
+		return
+	}
+
+	ok = true
+	return
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func respondError(w http.ResponseWriter, status int, err error) {
+	respond(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+// New is the constructor for Router. The middleware authenticates and authorizes admin requests
+func New(driver Driver, protection middleware.Middleware) Router {
+	return Router{
+		driver:       driver,
+		middleware:   protection,
+		objectPrefix: DefaultObjectPrefix,
+	}
+}
@@ -0,0 +1,188 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/middleware"
+	"github.com/hiendv/gate/password"
+	"github.com/pkg/errors"
+)
+
+var _ Driver = password.Driver{}
+
+type user struct {
+	id    string
+	roles []string
+}
+
+func (u user) GetID() string {
+	return u.id
+}
+
+func (u user) GetUsername() string {
+	return u.id
+}
+
+func (u user) GetRoles() []string {
+	return u.roles
+}
+
+type userService map[string]gate.User
+
+func (service userService) FindOneByID(id string) (gate.User, error) {
+	found, ok := service[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+
+	return found, nil
+}
+
+func (service userService) FindOrCreateOneByUsername(username string) (gate.User, error) {
+	return service.FindOneByID(username)
+}
+
+type fakeDriver struct {
+	users     userService
+	tokens    map[string]gate.JWT
+	abilities map[string][]gate.UserAbility
+}
+
+func (driver fakeDriver) Authenticate(token string) (gate.User, error) {
+	jwt, ok := driver.tokens[token]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+
+	return driver.users.FindOneByID(jwt.UserID)
+}
+
+func (driver fakeDriver) Authorize(u gate.User, action, object string) error {
+	matcher := gate.NewMatcher()
+	for _, ability := range driver.abilities[u.GetID()] {
+		if matcher.MatchAbility(action, object, ability) {
+			return nil
+		}
+	}
+
+	return gate.ErrForbidden
+}
+
+func (driver fakeDriver) SimulateAuthorize(u gate.User, action, object string) error {
+	return driver.Authorize(u, action, object)
+}
+
+func (driver fakeDriver) UserService() (gate.UserService, error) {
+	return driver.users, nil
+}
+
+func (driver fakeDriver) GetUserAbilities(u gate.User) ([]gate.UserAbility, error) {
+	return driver.abilities[u.GetID()], nil
+}
+
+func (driver fakeDriver) ListJWTs(userID string) (tokens []gate.JWT, err error) {
+	for _, token := range driver.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	return
+}
+
+func (driver fakeDriver) RevokeJWT(id string) error {
+	for value, token := range driver.tokens {
+		if token.ID == id {
+			delete(driver.tokens, value)
+			return nil
+		}
+	}
+
+	return errors.New("token not found")
+}
+
+func TestRouter(t *testing.T) {
+	driver := fakeDriver{
+		users: userService{"admin": user{id: "admin"}, "alice": user{id: "alice"}},
+		tokens: map[string]gate.JWT{
+			"admin-token": {ID: "1", UserID: "admin", ExpiredAt: time.Unix(2000, 0), IssuedAt: time.Unix(1000, 0)},
+			"alice-token": {ID: "2", UserID: "alice", ExpiredAt: time.Unix(2000, 0), IssuedAt: time.Unix(1000, 0)},
+		},
+		abilities: map[string][]gate.UserAbility{
+			"admin": {gate.AbilityClaim{Action: "*", Object: "/admin/*"}},
+			"alice": {gate.AbilityClaim{Action: "GET", Object: "/posts/*"}},
+		},
+	}
+
+	handler := New(driver, middleware.New(driver)).Handler()
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("protection", func(t *testing.T) {
+		if code := serve("GET", "/users/alice/tokens", "", "").Code; code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401 because of the missing token: %d", code)
+		}
+
+		if code := serve("GET", "/users/alice/tokens", "alice-token", "").Code; code != http.StatusForbidden {
+			t.Fatalf("status should be 403 because of the missing abilities: %d", code)
+		}
+	})
+
+	t.Run("abilities", func(t *testing.T) {
+		recorder := serve("GET", "/users/alice/abilities", "admin-token", "")
+		var abilities []gate.AbilityClaim
+		json.NewDecoder(recorder.Body).Decode(&abilities)
+		if recorder.Code != http.StatusOK || len(abilities) != 1 || abilities[0].Object != "/posts/*" {
+			t.Fatalf("effective abilities should be listed: %d %v", recorder.Code, abilities)
+		}
+
+		if code := serve("GET", "/users/bob/abilities", "admin-token", "").Code; code != http.StatusNotFound {
+			t.Fatalf("status should be 404 because of the unknown user: %d", code)
+		}
+	})
+
+	t.Run("simulate", func(t *testing.T) {
+		recorder := serve("POST", "/authorize", "admin-token", `{"user_id":"alice","action":"DELETE","object":"/posts/1"}`)
+		var decision Decision
+		json.NewDecoder(recorder.Body).Decode(&decision)
+		if recorder.Code != http.StatusOK || decision.Allowed || decision.Code != gate.CodeForbidden {
+			t.Fatalf("denial should be simulated: %d %v", recorder.Code, decision)
+		}
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		recorder := serve("GET", "/users/alice/tokens", "admin-token", "")
+		var tokens []Token
+		json.NewDecoder(recorder.Body).Decode(&tokens)
+		if recorder.Code != http.StatusOK || len(tokens) != 1 || tokens[0].ID != "2" || tokens[0].ExpiredAt != 2000 {
+			t.Fatalf("tokens should be listed: %d %v", recorder.Code, tokens)
+		}
+
+		if code := serve("DELETE", "/tokens/2", "admin-token", "").Code; code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the revoked token: %d", code)
+		}
+
+		if _, ok := driver.tokens["alice-token"]; ok {
+			t.Fatal("token should be revoked")
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if code := serve("GET", "/unknown", "admin-token", "").Code; code != http.StatusNotFound {
+			t.Fatalf("status should be 404 because of the unknown route: %d", code)
+		}
+	})
+}
@@ -0,0 +1,2 @@
+// Package admin is a mountable HTTP API to manage tokens and inspect abilities of github.com/hiendv/gate, protected by gate itself
+package admin
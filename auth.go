@@ -2,6 +2,8 @@ package gate
 
 import (
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Auth is the common interface for authentication and authorization. E.g. PasswordBased, OAuth, etc.
@@ -27,29 +29,129 @@ type Auth interface {
 	GetUserAbilities(User) ([]UserAbility, error)
 }
 
-// UserService is the contract which offers queries on the user entity
+// UserService is the contract which offers queries on the user entity.
+// Missing users are reported with ErrUserNotFound, other errors are storage failures
 type UserService interface {
 	FindOneByID(string) (User, error)
 	FindOrCreateOneByUsername(string) (User, error)
 }
 
+// UserRoleManager is the optional contract for user services supporting changes on the user-role membership
+type UserRoleManager interface {
+	AssignRole(userID, roleID string) error
+	RevokeRole(userID, roleID string) error
+	ListRoles(userID string) ([]string, error)
+}
+
+// RoleChange describes a change on the user-role membership
+type RoleChange struct {
+	UserID   string
+	RoleID   string
+	Assigned bool
+}
+
+// RoleChangeHook is invoked after a successful change on the user-role membership, e.g. for auditing
+type RoleChangeHook func(RoleChange)
+
 // RoleService is the contract which offers queries on the role entity
 type RoleService interface {
 	FindByIDs([]string) ([]Role, error)
 }
 
+// AbilityIterator is the optional contract for role services able to stream the abilities of roles.
+// Each ability is passed along with its role, so the validity window and the schedule of the role apply.
+// The callback returns false to stop the iteration, e.g. at the first matching ability
+type AbilityIterator interface {
+	ForEachAbility([]string, func(Role, UserAbility) bool) error
+}
+
+// RoleManager is the optional contract for role services supporting changes on the role entity
+type RoleManager interface {
+	CreateRole(string, []UserAbility) error
+	UpdateRole(string, []UserAbility) error
+	DeleteRole(string) error
+	AttachAbility(string, UserAbility) error
+	DetachAbility(string, UserAbility) error
+}
+
 // TokenService is the contract which offers queries on the token entity
 type TokenService interface {
 	FindOneByID(string) (JWT, error)
 	Store(JWT) error
 }
 
+// TokenConsumer is the optional contract for token services supporting single-use tokens.
+// Consume must atomically mark the token with the given ID as used and return ErrTokenNotFound, possibly wrapped, if it is unknown or already used.
+// Other errors are storage failures which fail the authentication without consuming the token
+type TokenConsumer interface {
+	Consume(string) error
+}
+
+// TokenManager is the optional contract for token services supporting the management of stored tokens.
+// Tokens of a token manager are looked up on authentication, hence revoked tokens are refused. Revoked tokens are reported with ErrTokenNotFound,
+// other errors are storage failures which fail the authentication without revoking the token
+type TokenManager interface {
+	ListTokens(userID string) ([]JWT, error)
+	RevokeToken(id string) error
+}
+
+// TokenPurger is the optional contract for token services supporting the maintenance of stored tokens.
+// PurgeExpired deletes, or soft-deletes, the tokens expired before the given time and returns their number
+type TokenPurger interface {
+	PurgeExpired(before time.Time) (int, error)
+	CountByUser(userID string) (int, error)
+}
+
+// Authorizer is the contract for authorization backends making Authorize decisions in place of the local abilities,
+// e.g. a remote policy engine. It returns ErrForbidden when the action is denied
+type Authorizer interface {
+	Authorize(user User, action, object string) error
+}
+
+// DefaultRoleBatchSize is the default maximum number of role IDs fetched by a single role service call
+const DefaultRoleBatchSize = 500
+
 // Config is the configuration for Auth
 type Config struct {
 	jwtSigningKey           interface{}
 	jwtVerifyingKey         interface{}
 	jwtExpiration           time.Duration
 	jwtSkipClaimsValidation bool
+	abilityCacheTTL         time.Duration
+	decisionCacheTTL        time.Duration
+	scheduleLocation        *time.Location
+	objectPathMatching      bool
+	caseInsensitiveMatching bool
+	matchingNormalizer      Normalizer
+	jwtMaxLength            int
+	jwtMaxClaimsSize        int
+	jwtAllowedAlgorithms    []string
+	jwtEncryption           JWEConfig
+	tokenCodec              TokenCodec
+	jwtKeyProvider          KeyProvider
+	opaqueTokens            bool
+	roleFallbackPolicy      FallbackPolicy
+	roleFallbackActions     []string
+	roleBreakerThreshold    int
+	roleBreakerCooldown     time.Duration
+	roleBatchSize           int
+	claimsProjection        ClaimsProjection
+	statelessAuth           bool
+	credentialSpec          CredentialSpec
+	challengeField          string
+	claimsMigrations        ClaimsMigrations
+	legacyClaimsUntil       time.Time
+	negativeCacheTTL        time.Duration
+	errorRedactor           Redactor
+	tokenStoragePolicy      StoragePolicy
+	tokenStorageAttempts    int
+	tokenStorageBackoff     time.Duration
+	tokenWriteBehindSize    int
+	tokenPurgeInterval      time.Duration
+	tokenPurgeRetention     time.Duration
+	maxSessions             int
+	sessionLimitPolicy      SessionLimitPolicy
+	claimsValidators        []ClaimsValidator
 }
 
 // JWTSigningKey is the setter for JWT signing key configuration
@@ -72,18 +174,390 @@ func (config Config) JWTSkipClaimsValidation() bool {
 	return config.jwtSkipClaimsValidation
 }
 
+// JWTMaxLength is the getter for the JWT maximum length configuration
+func (config Config) JWTMaxLength() int {
+	return config.jwtMaxLength
+}
+
+// SetJWTMaxLength is the setter for the JWT maximum length configuration, DefaultMaxJWTLength by default. Zero disables the limit
+func (config *Config) SetJWTMaxLength(length int) {
+	config.jwtMaxLength = length
+}
+
+// JWTMaxClaimsSize is the getter for the JWT maximum claims size configuration
+func (config Config) JWTMaxClaimsSize() int {
+	return config.jwtMaxClaimsSize
+}
+
+// SetJWTMaxClaimsSize is the setter for the JWT maximum claims size configuration. Zero, the default, disables the limit
+func (config *Config) SetJWTMaxClaimsSize(size int) {
+	config.jwtMaxClaimsSize = size
+}
+
+// JWTAllowedAlgorithms is the getter for the JWT allowed algorithms configuration
+func (config Config) JWTAllowedAlgorithms() []string {
+	return config.jwtAllowedAlgorithms
+}
+
+// SetJWTAllowedAlgorithms is the setter for the JWT allowed algorithms configuration, see JWTConfig.SetAllowedAlgorithms
+func (config *Config) SetJWTAllowedAlgorithms(algorithms []string) {
+	config.jwtAllowedAlgorithms = algorithms
+}
+
+// JWTEncryption is the getter for the JWT encryption configuration
+func (config Config) JWTEncryption() JWEConfig {
+	return config.jwtEncryption
+}
+
+// SetJWTEncryption is the setter for the JWT encryption configuration, see JWTConfig.SetEncryption
+func (config *Config) SetJWTEncryption(encryption JWEConfig) {
+	config.jwtEncryption = encryption
+}
+
+// TokenCodec is the getter for the token codec
+func (config Config) TokenCodec() TokenCodec {
+	return config.tokenCodec
+}
+
+// SetTokenCodec is the setter for the token codec, e.g. a PASETO codec replacing JWT signing. See JWTConfig.SetCodec
+func (config *Config) SetTokenCodec(codec TokenCodec) {
+	config.tokenCodec = codec
+}
+
+// JWTKeyProvider is the getter for the JWT key provider
+func (config Config) JWTKeyProvider() KeyProvider {
+	return config.jwtKeyProvider
+}
+
+// SetJWTKeyProvider is the setter for the JWT key provider, e.g. a secret manager, replacing the signing and verifying keys.
+// The algorithm of the provider replaces the one of the driver
+func (config *Config) SetJWTKeyProvider(provider KeyProvider) {
+	config.jwtKeyProvider = provider
+}
+
+// OpaqueTokens is the getter for the opaque token mode configuration
+func (config Config) OpaqueTokens() bool {
+	return config.opaqueTokens
+}
+
+// SetOpaqueTokens is the setter for the opaque token mode configuration.
+// In opaque mode, issued tokens are random references to the claims stored in the token service,
+// they are resolved by lookup so deleting a stored token revokes it instantly
+func (config *Config) SetOpaqueTokens(opaque bool) {
+	config.opaqueTokens = opaque
+}
+
+// AbilityCacheTTL is the getter for the ability cache TTL configuration
+func (config Config) AbilityCacheTTL() time.Duration {
+	return config.abilityCacheTTL
+}
+
+// SetAbilityCacheTTL is the setter for the ability cache TTL configuration. The cache is disabled by default
+func (config *Config) SetAbilityCacheTTL(ttl time.Duration) {
+	config.abilityCacheTTL = ttl
+}
+
+// DecisionCacheTTL is the getter for the decision cache TTL configuration
+func (config Config) DecisionCacheTTL() time.Duration {
+	return config.decisionCacheTTL
+}
+
+// SetDecisionCacheTTL is the setter for the decision cache TTL configuration. The cache is disabled by default
+func (config *Config) SetDecisionCacheTTL(ttl time.Duration) {
+	config.decisionCacheTTL = ttl
+}
+
+// ErrorRedactor is the getter for the error redactor configuration
+func (config Config) ErrorRedactor() Redactor {
+	return config.errorRedactor
+}
+
+// SetErrorRedactor is the setter for the error redactor configuration, e.g. RedactErrors. When set, drivers return public errors
+// in place of internal ones leaking details, e.g. "could not find the user with the given id", and keep the internal errors for logs.
+// Errors are not redacted by default
+func (config *Config) SetErrorRedactor(redactor Redactor) {
+	config.errorRedactor = redactor
+}
+
+// NegativeCacheTTL is the getter for the negative cache TTL configuration
+func (config Config) NegativeCacheTTL() time.Duration {
+	return config.negativeCacheTTL
+}
+
+// SetNegativeCacheTTL is the setter for the negative cache TTL configuration. Users not found and tokens failing to parse are remembered
+// for the TTL, which should be short, e.g. a few seconds. The cache is disabled by default
+func (config *Config) SetNegativeCacheTTL(ttl time.Duration) {
+	config.negativeCacheTTL = ttl
+}
+
+// TokenStoragePolicy is the getter for the policy applied when tokens cannot be stored on issuance
+func (config Config) TokenStoragePolicy() StoragePolicy {
+	return config.tokenStoragePolicy
+}
+
+// SetTokenStoragePolicy is the setter for the policy applied when tokens cannot be stored on issuance, StorageFailClosed by default
+func (config *Config) SetTokenStoragePolicy(policy StoragePolicy) {
+	config.tokenStoragePolicy = policy
+}
+
+// TokenStorageRetry is the getter for the maximum number of attempts and the initial backoff of token storage retries
+func (config Config) TokenStorageRetry() (attempts int, backoff time.Duration) {
+	return config.tokenStorageAttempts, config.tokenStorageBackoff
+}
+
+// SetTokenStorageRetry is the setter for the maximum number of attempts and the initial backoff of token storage retries,
+// DefaultTokenStorageAttempts and DefaultTokenStorageBackoff by default. The backoff doubles after every failed attempt
+func (config *Config) SetTokenStorageRetry(attempts int, backoff time.Duration) {
+	config.tokenStorageAttempts = attempts
+	config.tokenStorageBackoff = backoff
+}
+
+// TokenWriteBehindSize is the getter for the buffer size of the token write-behind queue
+func (config Config) TokenWriteBehindSize() int {
+	return config.tokenWriteBehindSize
+}
+
+// SetTokenWriteBehindSize is the setter for the buffer size of the token write-behind queue, DefaultTokenWriteBehindSize by default.
+// Tokens are stored synchronously when the buffer is full
+func (config *Config) SetTokenWriteBehindSize(size int) {
+	config.tokenWriteBehindSize = size
+}
+
+// TokenPurge is the getter for the interval and the retention of the token janitor
+func (config Config) TokenPurge() (interval, retention time.Duration) {
+	return config.tokenPurgeInterval, config.tokenPurgeRetention
+}
+
+// SetTokenPurge is the setter for the interval and the retention of the token janitor. Every interval, the janitor purges the tokens
+// expired for longer than the retention when the token service is a TokenPurger. The janitor is disabled by default
+func (config *Config) SetTokenPurge(interval, retention time.Duration) {
+	config.tokenPurgeInterval = interval
+	config.tokenPurgeRetention = retention
+}
+
+// MaxSessions is the getter for the maximum number of active sessions per user and the policy enforcing it
+func (config Config) MaxSessions() (max int, policy SessionLimitPolicy) {
+	return config.maxSessions, config.sessionLimitPolicy
+}
+
+// SetMaxSessions is the setter for the maximum number of active sessions per user and the policy enforcing it on issuance,
+// e.g. 3 devices. Sessions are the tokens of the primary logins which are not expired, as opposed to single-use, scoped and exchanged tokens,
+// hence the token service must be a SessionStore checking the limit atomically.
+// There is no limit by default
+func (config *Config) SetMaxSessions(max int, policy SessionLimitPolicy) {
+	config.maxSessions = max
+	config.sessionLimitPolicy = policy
+}
+
+// ClaimsValidators is the getter for the claims validators configuration
+func (config Config) ClaimsValidators() []ClaimsValidator {
+	return config.claimsValidators
+}
+
+// SetClaimsValidators is the setter for the claims validators configuration, e.g. RequireClaims("tenant") or MaxClaimsAge(24 * time.Hour).
+// Parsed tokens are refused unless every validator accepts their claims
+func (config *Config) SetClaimsValidators(validators ...ClaimsValidator) {
+	config.claimsValidators = validators
+}
+
+// RoleFallbackPolicy is the getter for the policy applied when the role service is unavailable
+func (config Config) RoleFallbackPolicy() FallbackPolicy {
+	return config.roleFallbackPolicy
+}
+
+// SetRoleFallbackPolicy is the setter for the policy applied when the role service is unavailable, FallbackDenyAll by default
+func (config *Config) SetRoleFallbackPolicy(policy FallbackPolicy) {
+	config.roleFallbackPolicy = policy
+}
+
+// RoleFallbackActions is the getter for the actions allowed by FallbackAllowListed
+func (config Config) RoleFallbackActions() []string {
+	return config.roleFallbackActions
+}
+
+// SetRoleFallbackActions is the setter for the actions allowed by FallbackAllowListed, e.g. read-only actions
+func (config *Config) SetRoleFallbackActions(actions []string) {
+	config.roleFallbackActions = actions
+}
+
+// RoleCircuitBreaker is the getter for the circuit breaker configuration of the role service
+func (config Config) RoleCircuitBreaker() (threshold int, cooldown time.Duration) {
+	return config.roleBreakerThreshold, config.roleBreakerCooldown
+}
+
+// SetRoleCircuitBreaker is the setter for the circuit breaker configuration of the role service.
+// The circuit opens after the given number of consecutive failures and is probed again after the cooldown. The circuit breaker is disabled by default
+func (config *Config) SetRoleCircuitBreaker(threshold int, cooldown time.Duration) {
+	config.roleBreakerThreshold = threshold
+	config.roleBreakerCooldown = cooldown
+}
+
+// RoleBatchSize is the getter for the maximum number of role IDs fetched by a single role service call
+func (config Config) RoleBatchSize() int {
+	return config.roleBatchSize
+}
+
+// SetRoleBatchSize is the setter for the maximum number of role IDs fetched by a single role service call, DefaultRoleBatchSize by default.
+// Larger lists are fetched in batches. Zero disables batching
+func (config *Config) SetRoleBatchSize(size int) {
+	config.roleBatchSize = size
+}
+
+// ClaimsProjection is the getter for the claims projection configuration
+func (config Config) ClaimsProjection() ClaimsProjection {
+	return config.claimsProjection
+}
+
+// SetClaimsProjection is the setter for the claims projection configuration, e.g. ClaimsProjectionIDOnly to keep usernames and roles out of tokens.
+// Every user information is embedded by default
+func (config *Config) SetClaimsProjection(projection ClaimsProjection) {
+	config.claimsProjection = projection
+}
+
+// ClaimsMigrations is the getter for the claims migrations configuration
+func (config Config) ClaimsMigrations() ClaimsMigrations {
+	return config.claimsMigrations
+}
+
+// SetClaimsMigrations is the setter for the claims migrations configuration, so tokens issued with an older claims layout remain valid after upgrades.
+// There is no migration by default
+func (config *Config) SetClaimsMigrations(migrations ClaimsMigrations) {
+	config.claimsMigrations = migrations
+}
+
+// LegacyClaimsUntil is the getter for the end of the legacy claims migration window
+func (config Config) LegacyClaimsUntil() time.Time {
+	return config.legacyClaimsUntil
+}
+
+// SetLegacyClaimsUntil is the setter for the end of the legacy claims migration window, so upgrades do not log out every user at once.
+// Legacy tokens are accepted as they are by default, see JWTConfig.SetLegacyClaimsUntil
+func (config *Config) SetLegacyClaimsUntil(until time.Time) {
+	config.legacyClaimsUntil = until
+}
+
+// StatelessAuthentication is the getter for the stateless authentication configuration
+func (config Config) StatelessAuthentication() bool {
+	return config.statelessAuth
+}
+
+// SetStatelessAuthentication is the setter for the stateless authentication configuration.
+// When enabled, authenticated users are built from the claims as ClaimsUser without looking them up with the user service,
+// hence the claims projection should keep the roles
+func (config *Config) SetStatelessAuthentication(enabled bool) {
+	config.statelessAuth = enabled
+}
+
+// CredentialSpec is the getter for the schema of login credentials
+func (config Config) CredentialSpec() CredentialSpec {
+	return config.credentialSpec
+}
+
+// SetCredentialSpec is the setter for the schema of login credentials. Only the username and the password are required by default
+func (config *Config) SetCredentialSpec(spec CredentialSpec) {
+	config.credentialSpec = spec
+}
+
+// ChallengeField is the getter for the name of the credential holding the challenge response
+func (config Config) ChallengeField() string {
+	return config.challengeField
+}
+
+// SetChallengeField is the setter for the name of the credential holding the challenge response, DefaultChallengeField by default.
+// The challenge response is never part of the source metadata of login attempts
+func (config *Config) SetChallengeField(field string) {
+	config.challengeField = field
+}
+
+// ScheduleLocation is the getter for the timezone of ability schedules
+func (config Config) ScheduleLocation() *time.Location {
+	return config.scheduleLocation
+}
+
+// SetScheduleLocation is the setter for the timezone of ability schedules without their own location. UTC is used by default
+func (config *Config) SetScheduleLocation(location *time.Location) {
+	config.scheduleLocation = location
+}
+
+// ObjectPathMatching is the getter for the object-path matching configuration
+func (config Config) ObjectPathMatching() bool {
+	return config.objectPathMatching
+}
+
+// SetObjectPathMatching is the setter for the object-path matching configuration.
+// When enabled, ability objects are matched as slash-separated resource paths instead of expressions
+func (config *Config) SetObjectPathMatching(enabled bool) {
+	config.objectPathMatching = enabled
+}
+
+// CaseInsensitiveMatching is the getter for the case-insensitive matching configuration
+func (config Config) CaseInsensitiveMatching() bool {
+	return config.caseInsensitiveMatching
+}
+
+// SetCaseInsensitiveMatching is the setter for the case-insensitive matching configuration of actions and objects
+func (config *Config) SetCaseInsensitiveMatching(enabled bool) {
+	config.caseInsensitiveMatching = enabled
+}
+
+// MatchingNormalizer is the getter for the matching normalizer configuration
+func (config Config) MatchingNormalizer() Normalizer {
+	return config.matchingNormalizer
+}
+
+// SetMatchingNormalizer is the setter for the matching normalizer configuration, e.g. NFC for the unicode normalization
+func (config *Config) SetMatchingNormalizer(normalizer Normalizer) {
+	config.matchingNormalizer = normalizer
+}
+
 // NewConfig is the constructor for Config
 func NewConfig(jwtSigningKey, jwtVerifyingKey interface{}, jwtExpiration time.Duration, jwtSkipClaimsValidation bool) Config {
-	return Config{jwtSigningKey, jwtVerifyingKey, jwtExpiration, jwtSkipClaimsValidation}
+	return Config{
+		jwtSigningKey:           jwtSigningKey,
+		jwtVerifyingKey:         jwtVerifyingKey,
+		jwtExpiration:           jwtExpiration,
+		jwtSkipClaimsValidation: jwtSkipClaimsValidation,
+		jwtMaxLength:            DefaultMaxJWTLength,
+		roleBatchSize:           DefaultRoleBatchSize,
+		challengeField:          DefaultChallengeField,
+		tokenStorageAttempts:    DefaultTokenStorageAttempts,
+		tokenStorageBackoff:     DefaultTokenStorageBackoff,
+		tokenWriteBehindSize:    DefaultTokenWriteBehindSize,
+	}
 }
 
 // Dependencies is the servicer container for Auth
 type Dependencies struct {
-	userService  UserService
-	roleService  RoleService
-	tokenService TokenService
-	jwtService   JWTService
-	matcher      Matcher
+	userService    UserService
+	roleService    RoleService
+	tokenService   TokenService
+	jwtService     JWTService
+	matcher        Matcher
+	abilityCache   AbilityCache
+	decisionCache  DecisionCache
+	roleBreaker    CircuitBreaker
+	idGenerator    IDGenerator
+	roleHooks      []RoleChangeHook
+	authorizer     Authorizer
+	loginHooks     []LoginHook
+	detector       AnomalyDetector
+	challenger     ChallengeVerifier
+	triggers       []ChallengeTrigger
+	counterStore   CounterStore
+	ownership      OwnershipResolver
+	logger         Logger
+	clock          Clock
+	shadow         Authorizer
+	shadowSlots    chan struct{}
+	auditHooks     []AuditHook
+	permissionSets PermissionSetService
+	negativeCache  NegativeCache
+	tokenWriter    TokenWriteBehind
+	tokenJanitor   TokenJanitor
+	riskEvaluator  RiskEvaluator
+
+	invalidationBus      InvalidationBus
+	invalidationListener InvalidationListener
 }
 
 // UserService is the getter for user service
@@ -111,6 +585,75 @@ func (dependencies Dependencies) Matcher() Matcher {
 	return dependencies.matcher
 }
 
+// AbilityCache is the getter for ability cache
+func (dependencies Dependencies) AbilityCache() AbilityCache {
+	return dependencies.abilityCache
+}
+
+// RoleCircuitBreaker is the getter for the circuit breaker of the role service
+func (dependencies Dependencies) RoleCircuitBreaker() CircuitBreaker {
+	return dependencies.roleBreaker
+}
+
+// DecisionCache is the getter for decision cache
+func (dependencies Dependencies) DecisionCache() DecisionCache {
+	return dependencies.decisionCache
+}
+
+// IDGenerator is the getter for the claims ID generator
+func (dependencies Dependencies) IDGenerator() IDGenerator {
+	return dependencies.idGenerator
+}
+
+// RoleChangeHooks is the getter for role change hooks
+func (dependencies Dependencies) RoleChangeHooks() []RoleChangeHook {
+	return dependencies.roleHooks
+}
+
+// Authorizer is the getter for the authorization backend
+func (dependencies Dependencies) Authorizer() Authorizer {
+	return dependencies.authorizer
+}
+
+// LoginHooks is the getter for login hooks
+func (dependencies Dependencies) LoginHooks() []LoginHook {
+	return dependencies.loginHooks
+}
+
+// AnomalyDetector is the getter for the login anomaly detector
+func (dependencies Dependencies) AnomalyDetector() AnomalyDetector {
+	return dependencies.detector
+}
+
+// ChallengeVerifier is the getter for the login challenge verifier
+func (dependencies Dependencies) ChallengeVerifier() ChallengeVerifier {
+	return dependencies.challenger
+}
+
+// ChallengeTriggers is the getter for the risk signals demanding a login challenge
+func (dependencies Dependencies) ChallengeTriggers() []ChallengeTrigger {
+	return dependencies.triggers
+}
+
+// CounterStore is the getter for the quota counter store
+func (dependencies Dependencies) CounterStore() CounterStore {
+	return dependencies.counterStore
+}
+
+// OwnershipResolver is the getter for the ownership resolver
+func (dependencies Dependencies) OwnershipResolver() OwnershipResolver {
+	return dependencies.ownership
+}
+
+// Logger is the getter for logger. NopLogger is returned if there is no logger
+func (dependencies Dependencies) Logger() Logger {
+	if dependencies.logger == nil {
+		return NopLogger{}
+	}
+
+	return dependencies.logger
+}
+
 // SetJWTService is the setter for JWT service
 func (dependencies *Dependencies) SetJWTService(service JWTService) {
 	dependencies.jwtService = service
@@ -121,7 +664,179 @@ func (dependencies *Dependencies) SetMatcher(matcher Matcher) {
 	dependencies.matcher = matcher
 }
 
+// SetAbilityCache is the setter for ability cache
+func (dependencies *Dependencies) SetAbilityCache(cache AbilityCache) {
+	dependencies.abilityCache = cache
+}
+
+// SetRoleCircuitBreaker is the setter for the circuit breaker of the role service
+func (dependencies *Dependencies) SetRoleCircuitBreaker(breaker CircuitBreaker) {
+	dependencies.roleBreaker = breaker
+}
+
+// SetDecisionCache is the setter for decision cache
+func (dependencies *Dependencies) SetDecisionCache(cache DecisionCache) {
+	dependencies.decisionCache = cache
+}
+
+// SetIDGenerator is the setter for the claims ID generator
+func (dependencies *Dependencies) SetIDGenerator(generator IDGenerator) {
+	dependencies.idGenerator = generator
+}
+
+// SetAuthorizer is the setter for the authorization backend. When set, authorization decisions are delegated to it
+func (dependencies *Dependencies) SetAuthorizer(authorizer Authorizer) {
+	dependencies.authorizer = authorizer
+}
+
+// AddRoleChangeHook registers a hook invoked after every user-role membership change
+func (dependencies *Dependencies) AddRoleChangeHook(hook RoleChangeHook) {
+	dependencies.roleHooks = append(dependencies.roleHooks, hook)
+}
+
+// AddLoginHook registers a hook invoked after every login attempt
+func (dependencies *Dependencies) AddLoginHook(hook LoginHook) {
+	dependencies.loginHooks = append(dependencies.loginHooks, hook)
+}
+
+// SetAnomalyDetector is the setter for the login anomaly detector
+func (dependencies *Dependencies) SetAnomalyDetector(detector AnomalyDetector) {
+	dependencies.detector = detector
+}
+
+// SetChallengeVerifier is the setter for the login challenge verifier, e.g. a CAPTCHA verifier.
+// Logins are challenged when a challenge trigger reports a risk
+func (dependencies *Dependencies) SetChallengeVerifier(verifier ChallengeVerifier) {
+	dependencies.challenger = verifier
+}
+
+// AddChallengeTrigger registers a risk signal demanding a login challenge, e.g. a VelocityDetector or a SourceHistory
+func (dependencies *Dependencies) AddChallengeTrigger(trigger ChallengeTrigger) {
+	dependencies.triggers = append(dependencies.triggers, trigger)
+}
+
+// SetCounterStore is the setter for the quota counter store, required by limited abilities
+func (dependencies *Dependencies) SetCounterStore(store CounterStore) {
+	dependencies.counterStore = store
+}
+
+// SetOwnershipResolver is the setter for the ownership resolver, required by owned abilities
+func (dependencies *Dependencies) SetOwnershipResolver(resolver OwnershipResolver) {
+	dependencies.ownership = resolver
+}
+
+// SetLogger is the setter for logger
+func (dependencies *Dependencies) SetLogger(logger Logger) {
+	dependencies.logger = logger
+}
+
 // NewDependencies is the constructor for Dependencies
 func NewDependencies(users UserService, tokens TokenService, roles RoleService) *Dependencies {
 	return &Dependencies{userService: users, tokenService: tokens, roleService: roles}
 }
+
+// Requirement is a validation rule for Dependencies, e.g. a service a driver cannot work without
+type Requirement func(Dependencies) error
+
+// RequireUserService requires the user service
+func RequireUserService(dependencies Dependencies) error {
+	if dependencies.userService == nil {
+		return errors.New("missing user service")
+	}
+
+	return nil
+}
+
+// RequireRoleService requires the role service
+func RequireRoleService(dependencies Dependencies) error {
+	if dependencies.roleService == nil {
+		return errors.New("missing role service")
+	}
+
+	return nil
+}
+
+// RequireTokenService requires the token service
+func RequireTokenService(dependencies Dependencies) error {
+	if dependencies.tokenService == nil {
+		return errors.New("missing token service")
+	}
+
+	return nil
+}
+
+// RequireAuthorization requires the authorization backend or the role service, e.g. by the drivers authorizing users
+func RequireAuthorization(dependencies Dependencies) error {
+	if dependencies.authorizer == nil && dependencies.roleService == nil {
+		return errors.New("missing authorization backend or role service")
+	}
+
+	return nil
+}
+
+// Validate checks the dependencies against the given requirements
+func (dependencies Dependencies) Validate(requirements ...Requirement) error {
+	for _, requirement := range requirements {
+		if err := requirement(dependencies); err != nil {
+			return errors.Wrap(err, "invalid dependencies")
+		}
+	}
+
+	return nil
+}
+
+// DependenciesBuilder is the fluent builder for Dependencies
+type DependenciesBuilder struct {
+	dependencies Dependencies
+}
+
+// WithUserService sets the user service
+func (builder *DependenciesBuilder) WithUserService(service UserService) *DependenciesBuilder {
+	builder.dependencies.userService = service
+	return builder
+}
+
+// WithRoleService sets the role service
+func (builder *DependenciesBuilder) WithRoleService(service RoleService) *DependenciesBuilder {
+	builder.dependencies.roleService = service
+	return builder
+}
+
+// WithTokenService sets the token service
+func (builder *DependenciesBuilder) WithTokenService(service TokenService) *DependenciesBuilder {
+	builder.dependencies.tokenService = service
+	return builder
+}
+
+// WithIDGenerator sets the claims ID generator
+func (builder *DependenciesBuilder) WithIDGenerator(generator IDGenerator) *DependenciesBuilder {
+	builder.dependencies.idGenerator = generator
+	return builder
+}
+
+// WithAuthorizer sets the authorization backend
+func (builder *DependenciesBuilder) WithAuthorizer(authorizer Authorizer) *DependenciesBuilder {
+	builder.dependencies.authorizer = authorizer
+	return builder
+}
+
+// WithLogger sets the logger
+func (builder *DependenciesBuilder) WithLogger(logger Logger) *DependenciesBuilder {
+	builder.dependencies.logger = logger
+	return builder
+}
+
+// Dependencies validates the built dependencies against the given requirements, e.g. the ones declared by a driver, and returns them
+func (builder *DependenciesBuilder) Dependencies(requirements ...Requirement) (*Dependencies, error) {
+	dependencies := builder.dependencies
+	if err := dependencies.Validate(requirements...); err != nil {
+		return nil, err
+	}
+
+	return &dependencies, nil
+}
+
+// NewDependenciesBuilder is the constructor for DependenciesBuilder
+func NewDependenciesBuilder() *DependenciesBuilder {
+	return &DependenciesBuilder{}
+}
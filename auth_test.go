@@ -0,0 +1,44 @@
+package gate
+
+import (
+	"testing"
+)
+
+type nopUserService struct{}
+
+func (nopUserService) FindOneByID(string) (User, error)               { return nil, nil }
+func (nopUserService) FindOrCreateOneByUsername(string) (User, error) { return nil, nil }
+
+func TestDependenciesBuilder(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		dependencies, err := NewDependenciesBuilder().WithUserService(nopUserService{}).Dependencies(RequireUserService)
+		if err != nil {
+			t.Fatalf("err should be nil because of the satisfied requirements: %s", err)
+		}
+
+		if dependencies.UserService() == nil {
+			t.Fatal("user service should be set")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewDependenciesBuilder().WithUserService(nopUserService{}).Dependencies(RequireUserService, RequireRoleService)
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing role service")
+		}
+	})
+}
+
+type testUser UserInfo
+
+func (u testUser) GetID() string {
+	return u.ID
+}
+
+func (u testUser) GetUsername() string {
+	return u.Username
+}
+
+func (u testUser) GetRoles() []string {
+	return u.Roles
+}
@@ -0,0 +1,70 @@
+package gate
+
+import (
+	"sync"
+)
+
+// AuthzContext is the request-scoped authorization context carrying the authenticated user, the token, the tenant
+// and the abilities resolved by the first authorization, so they are not resolved again within the request.
+// Decisions are made with the roles of the user in the tenant, see TenantRoles.
+// It is created once per request, e.g. by the middleware, and must not outlive the request
+type AuthzContext struct {
+	User   User
+	Token  JWT
+	Tenant string
+	// IP is the client IP of the request, if known, e.g. for the risk evaluator
+	IP string
+	// Attributes resolve the placeholders of template abilities, e.g. the project ID of the request
+	Attributes Attributes
+
+	abilities *AbilityIndex
+	mutex     sync.Mutex
+}
+
+// Abilities returns the resolved abilities of the user, if any
+func (ctx *AuthzContext) Abilities() (index AbilityIndex, ok bool) {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+
+	if ctx.abilities == nil {
+		return
+	}
+
+	return *ctx.abilities, true
+}
+
+// SetAbilities stores the resolved abilities of the user
+func (ctx *AuthzContext) SetAbilities(index AbilityIndex) {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+
+	ctx.abilities = &index
+}
+
+// TenantMember is a user whose roles depend on the tenant, e.g. the member of several organizations
+type TenantMember interface {
+	GetTenantRoles(tenant string) []string
+}
+
+// TenantAuthorizer is an Authorizer making decisions in a tenant, e.g. opa.Authorizer
+type TenantAuthorizer interface {
+	AuthorizeInTenant(tenant string, user User, action, object string) error
+}
+
+// TenantRoles returns the roles of a user in a tenant. Without a tenant or for users which are not TenantMember, the roles are those of the user
+func TenantRoles(user User, tenant string) []string {
+	if delegated, ok := user.(DelegatedUser); ok {
+		user = delegated.User
+	}
+
+	if member, ok := user.(TenantMember); ok && tenant != "" {
+		return member.GetTenantRoles(tenant)
+	}
+
+	return user.GetRoles()
+}
+
+// NewAuthzContext is the constructor for AuthzContext. The token may be partial, e.g. only the token string, when it is not parsed
+func NewAuthzContext(user User, token JWT, tenant string) *AuthzContext {
+	return &AuthzContext{User: user, Token: token, Tenant: tenant}
+}
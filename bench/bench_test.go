@@ -0,0 +1,153 @@
+package bench
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+func newFixture(b testing.TB, alg string, abilities int) Fixture {
+	fixture, err := NewFixture(alg, abilities)
+	if err != nil {
+		b.Fatalf("err should be nil: %s", err)
+	}
+
+	return fixture
+}
+
+func TestFixture(t *testing.T) {
+	for _, alg := range Algorithms {
+		fixture := newFixture(t, alg, 10)
+
+		if _, err := fixture.Driver.Login(fixture.Credentials()); err != nil {
+			t.Fatalf("err should be nil because of the valid credentials: %s", err)
+		}
+
+		if _, err := fixture.Driver.AuthorizeToken(fixture.Token.Value, fixture.Action, fixture.Object); err != nil {
+			t.Fatalf("err should be nil because of the last ability (%s): %s", alg, err)
+		}
+
+		if _, err := fixture.Driver.AuthorizeToken(fixture.Token.Value, "write", fixture.Object); err == nil {
+			t.Fatalf("err should not be nil because of the missing ability (%s)", alg)
+		}
+	}
+
+	if _, err := NewFixture("none", 1); err == nil {
+		t.Fatal("err should not be nil because of the unsupported algorithm")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	calls := make(chan struct{}, 1)
+	report := Load(2, 20*time.Millisecond, func() error {
+		select {
+		case calls <- struct{}{}:
+			return fmt.Errorf("failure")
+		default:
+			return nil
+		}
+	})
+
+	if report.Operations == 0 || report.Failures != 1 || report.Throughput() <= 0 {
+		t.Fatalf("invalid report: %+v", report)
+	}
+
+	if report.Percentile(50) > report.Percentile(99) {
+		t.Fatal("percentiles should be ordered")
+	}
+}
+
+func BenchmarkLogin(b *testing.B) {
+	fixture := newFixture(b, "HS256", 1)
+	credentials := fixture.Credentials()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := fixture.Driver.Login(credentials); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIssue(b *testing.B) {
+	for _, alg := range Algorithms {
+		service, err := NewJWTService(alg)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, count := range AbilityCounts {
+			claims := service.NewClaims(user{"1", Username, []string{"bench"}})
+			claims.Abilities = gate.NewAbilityClaims(Abilities(count))
+
+			b.Run(fmt.Sprintf("%s/%d", alg, count), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := service.Issue(claims); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, alg := range Algorithms {
+		service, err := NewJWTService(alg)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, count := range AbilityCounts {
+			claims := service.NewClaims(user{"1", Username, []string{"bench"}})
+			claims.Abilities = gate.NewAbilityClaims(Abilities(count))
+			token, err := service.Issue(claims)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.Run(fmt.Sprintf("%s/%d", alg, count), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := service.Parse(token.Value); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkAuthorize(b *testing.B) {
+	for _, count := range AbilityCounts {
+		fixture := newFixture(b, "HS256", count)
+
+		b.Run(fmt.Sprintf("user/%d", count), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := fixture.Driver.Authorize(fixture.User, fixture.Action, fixture.Object); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+
+	for _, alg := range Algorithms {
+		for _, count := range AbilityCounts {
+			fixture := newFixture(b, alg, count)
+
+			b.Run(fmt.Sprintf("token/%s/%d", alg, count), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := fixture.Driver.AuthorizeToken(fixture.Token.Value, fixture.Action, fixture.Object); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Package bench provides reproducible fixtures and a load-test harness for github.com/hiendv/gate.
+// The benchmarks of the package cover Login, Issue, Parse and Authorize across HMAC, RSA and ECDSA signing and varying ability counts,
+// e.g. "go test -run NONE -bench . github.com/hiendv/gate/bench", so that performance regressions are caught and deployments can be sized
+package bench
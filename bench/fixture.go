@@ -0,0 +1,243 @@
+package bench
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/password"
+	"github.com/pkg/errors"
+)
+
+// Algorithms are the signing algorithms covered by the benchmarks
+var Algorithms = []string{"HS256", "RS256", "ES256"}
+
+// AbilityCounts are the numbers of abilities per user covered by the benchmarks
+var AbilityCounts = []int{1, 10, 100, 1000}
+
+// Username and Password are the credentials of the fixture user
+const (
+	Username = "bench"
+	Password = "secret"
+)
+
+var keys = struct {
+	sync.Mutex
+	rsa   *rsa.PrivateKey
+	ecdsa *ecdsa.PrivateKey
+}{}
+
+// SigningKey returns the signing key of an algorithm. Keys are generated once per process, hence the benchmarks do not measure key generation
+func SigningKey(alg string) (interface{}, error) {
+	keys.Lock()
+	defer keys.Unlock()
+
+	var err error
+	switch alg {
+	case "HS256":
+		return "bench-secret", nil
+	case "RS256":
+		if keys.rsa == nil {
+			keys.rsa, err = rsa.GenerateKey(rand.Reader, 2048)
+		}
+		return keys.rsa, errors.Wrap(err, "could not generate the RSA key")
+	case "ES256":
+		if keys.ecdsa == nil {
+			keys.ecdsa, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		}
+		return keys.ecdsa, errors.Wrap(err, "could not generate the ECDSA key")
+	default:
+		return nil, errors.Errorf("unsupported algorithm: %s", alg)
+	}
+}
+
+// NewJWTService returns a JWT service signing with an algorithm. The length of JWTs is not limited so that
+// tokens embedding many abilities can be measured
+func NewJWTService(alg string) (service gate.JWTService, err error) {
+	key, err := SigningKey(alg)
+	if err != nil {
+		return
+	}
+
+	config, err := gate.NewHMACJWTConfig(alg, key, time.Hour, false)
+	if err != nil {
+		return
+	}
+
+	config.SetMaxLength(0)
+	return gate.NewJWTService(config), nil
+}
+
+// Abilities returns the abilities of the fixture user. The last ability is "read" on "/posts/{count-1}",
+// hence authorizing it is the worst case of a linear scan
+func Abilities(count int) []gate.UserAbility {
+	abilities := make([]gate.UserAbility, count)
+	for i := range abilities {
+		abilities[i] = ability{"read", fmt.Sprintf("/posts/%d", i)}
+	}
+
+	return abilities
+}
+
+// Fixture is a password driver with in-memory services, a single user and a single role
+type Fixture struct {
+	Driver *password.Driver
+	User   gate.User
+	Token  gate.JWT
+	Action string
+	Object string
+}
+
+// NewFixture is the constructor for Fixture signing with an algorithm and granting a number of abilities to the user
+func NewFixture(alg string, abilities int) (fixture Fixture, err error) {
+	if abilities < 1 {
+		err = errors.New("invalid ability count")
+		return
+	}
+
+	service, err := NewJWTService(alg)
+	if err != nil {
+		return
+	}
+
+	key, err := SigningKey("HS256")
+	if err != nil {
+		return
+	}
+
+	fixture.User = user{"1", Username, []string{"bench"}}
+	users := userService{fixture.User}
+	roles := roleService{"bench": role{Abilities(abilities)}}
+	dependencies := gate.NewDependencies(users, newTokenService(), roles)
+
+	fixture.Driver, err = password.New(gate.NewConfig(key, key, time.Hour, false), dependencies, func(username, secret string) (gate.User, error) {
+		if username != Username || subtle.ConstantTimeCompare([]byte(secret), []byte(Password)) != 1 {
+			return nil, errors.New("invalid credentials")
+		}
+
+		return fixture.User, nil
+	})
+	if err != nil {
+		return
+	}
+
+	dependencies.SetJWTService(service)
+	fixture.Token, err = fixture.Driver.IssueJWT(fixture.User)
+	if err != nil {
+		return
+	}
+
+	fixture.Action, fixture.Object = "read", fmt.Sprintf("/posts/%d", abilities-1)
+	return
+}
+
+// Credentials returns the login values of the fixture user
+func (fixture Fixture) Credentials() map[string]string {
+	return map[string]string{"username": Username, "password": Password}
+}
+
+type user struct {
+	id       string
+	username string
+	roles    []string
+}
+
+func (u user) GetID() string {
+	return u.id
+}
+
+func (u user) GetUsername() string {
+	return u.username
+}
+
+func (u user) GetRoles() []string {
+	return u.roles
+}
+
+type ability struct {
+	action string
+	object string
+}
+
+func (a ability) GetAction() string {
+	return a.action
+}
+
+func (a ability) GetObject() string {
+	return a.object
+}
+
+type role struct {
+	abilities []gate.UserAbility
+}
+
+func (r role) GetAbilities() []gate.UserAbility {
+	return r.abilities
+}
+
+type userService struct {
+	user gate.User
+}
+
+func (service userService) FindOneByID(id string) (gate.User, error) {
+	if id != service.user.GetID() {
+		return nil, errors.New("user not found")
+	}
+
+	return service.user, nil
+}
+
+func (service userService) FindOrCreateOneByUsername(username string) (gate.User, error) {
+	if username != service.user.GetUsername() {
+		return nil, errors.New("user not found")
+	}
+
+	return service.user, nil
+}
+
+type roleService map[string]gate.Role
+
+func (service roleService) FindByIDs(ids []string) (roles []gate.Role, err error) {
+	for _, id := range ids {
+		if role, ok := service[id]; ok {
+			roles = append(roles, role)
+		}
+	}
+
+	return
+}
+
+type tokenService struct {
+	mutex  *sync.RWMutex
+	tokens map[string]gate.JWT
+}
+
+func newTokenService() tokenService {
+	return tokenService{&sync.RWMutex{}, map[string]gate.JWT{}}
+}
+
+func (service tokenService) FindOneByID(id string) (gate.JWT, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	token, ok := service.tokens[id]
+	if !ok {
+		return token, errors.New("token not found")
+	}
+
+	return token, nil
+}
+
+func (service tokenService) Store(token gate.JWT) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.tokens[token.ID] = token
+	return nil
+}
@@ -0,0 +1,101 @@
+package bench
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Report is the outcome of a load test
+type Report struct {
+	Operations int
+	Failures   int
+	Elapsed    time.Duration
+	latencies  durations
+}
+
+// Throughput returns the number of operations per second
+func (report Report) Throughput() float64 {
+	if report.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(report.Operations) / report.Elapsed.Seconds()
+}
+
+// Percentile returns the latency of a percentile between 0 and 100, e.g. 99 for the p99 latency
+func (report Report) Percentile(p float64) time.Duration {
+	if len(report.latencies) == 0 {
+		return 0
+	}
+
+	i := int(p / 100 * float64(len(report.latencies)-1))
+	switch {
+	case i < 0:
+		i = 0
+	case i >= len(report.latencies):
+		i = len(report.latencies) - 1
+	}
+
+	return report.latencies[i]
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int {
+	return len(d)
+}
+
+func (d durations) Less(i, j int) bool {
+	return d[i] < d[j]
+}
+
+func (d durations) Swap(i, j int) {
+	d[i], d[j] = d[j], d[i]
+}
+
+// Load runs an operation with a number of concurrent workers for a duration and reports the throughput and the latencies.
+// Failed operations are counted but their latencies are not recorded
+func Load(concurrency int, duration time.Duration, operation func() error) Report {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		mutex  sync.Mutex
+		wg     sync.WaitGroup
+		report Report
+	)
+
+	start := time.Now()
+	deadline := start.Add(duration)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var latencies durations
+			failures := 0
+			for time.Now().Before(deadline) {
+				began := time.Now()
+				if err := operation(); err != nil {
+					failures++
+					continue
+				}
+
+				latencies = append(latencies, time.Since(began))
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Operations += len(latencies) + failures
+			report.Failures += failures
+			report.latencies = append(report.latencies, latencies...)
+		}()
+	}
+
+	wg.Wait()
+	report.Elapsed = time.Since(start)
+	sort.Sort(report.latencies)
+	return report
+}
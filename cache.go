@@ -0,0 +1,186 @@
+package gate
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAbilityCacheSize is the default maximum number of role sets of an ability cache
+const DefaultAbilityCacheSize = 10000
+
+type abilityCacheEntry struct {
+	roleIDs   []string
+	index     AbilityIndex
+	expiredAt time.Time
+}
+
+// AbilityCache caches the indexed abilities resolved for a set of roles.
+// Entries are invalidated by TTL or explicitly whenever a role in the set changes. Expired entries are kept for GetStale
+// until the cache is full, then they are purged, and new role sets are not cached while the cache is full of unexpired entries
+type AbilityCache struct {
+	ttl     time.Duration
+	size    int
+	entries map[string]abilityCacheEntry
+	Now     func() time.Time
+	*sync.RWMutex
+}
+
+func roleSetKey(roleIDs []string) string {
+	ids := make([]string, len(roleIDs))
+	copy(ids, roleIDs)
+	sort.Strings(ids)
+	return strings.Join(ids, "\x00")
+}
+
+// Enabled reports whether the cache is enabled. A cache with a non-positive TTL is disabled
+func (cache AbilityCache) Enabled() bool {
+	return cache.ttl > 0 && cache.RWMutex != nil
+}
+
+// Get returns the cached ability index for the given role set
+func (cache AbilityCache) Get(roleIDs []string) (index AbilityIndex, ok bool) {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.RLock()
+	defer cache.RUnlock()
+
+	entry, ok := cache.entries[roleSetKey(roleIDs)]
+	if !ok {
+		return
+	}
+
+	if !cache.Now().Before(entry.expiredAt) {
+		ok = false
+		return
+	}
+
+	index = entry.index
+	return
+}
+
+// GetStale returns the cached ability index for the given role set even if it is expired, e.g. when the role service is unavailable.
+// Indexes past the next transition of a validity window or a schedule of their roles and abilities are not returned,
+// since their abilities may no longer be available. Stale entries are kept until they are replaced, invalidated or purged
+func (cache AbilityCache) GetStale(roleIDs []string) (index AbilityIndex, ok bool) {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.RLock()
+	defer cache.RUnlock()
+
+	entry, ok := cache.entries[roleSetKey(roleIDs)]
+	if !ok {
+		return
+	}
+
+	if until := entry.index.Until(); !until.IsZero() && !cache.Now().Before(until) {
+		ok = false
+		return
+	}
+
+	index = entry.index
+	return
+}
+
+// Set caches the ability index for the given role set
+func (cache AbilityCache) Set(roleIDs []string, index AbilityIndex) {
+	cache.SetUntil(roleIDs, index, time.Time{})
+}
+
+// SetUntil caches the ability index for the given role set no longer than the given time, e.g. the expiration of a role.
+// A zero time only applies the TTL
+func (cache AbilityCache) SetUntil(roleIDs []string, index AbilityIndex, until time.Time) {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	now := cache.Now()
+	expiredAt := now.Add(cache.ttl)
+	if !until.IsZero() && until.Before(expiredAt) {
+		expiredAt = until
+	}
+
+	key := roleSetKey(roleIDs)
+	if _, ok := cache.entries[key]; !ok && len(cache.entries) >= cache.size {
+		for key, entry := range cache.entries {
+			if !now.Before(entry.expiredAt) {
+				delete(cache.entries, key)
+			}
+		}
+
+		if len(cache.entries) >= cache.size {
+			return
+		}
+	}
+
+	ids := make([]string, len(roleIDs))
+	copy(ids, roleIDs)
+	cache.entries[key] = abilityCacheEntry{ids, index, expiredAt}
+}
+
+// Invalidate removes every cached role set containing one of the given roles
+func (cache AbilityCache) Invalidate(roleIDs ...string) {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	for key, entry := range cache.entries {
+		if containsAny(entry.roleIDs, roleIDs) {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// Flush removes every cached role set
+func (cache AbilityCache) Flush() {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	for key := range cache.entries {
+		delete(cache.entries, key)
+	}
+}
+
+func containsAny(haystack, needles []string) bool {
+	for _, str := range haystack {
+		for _, needle := range needles {
+			if str == needle {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// NewAbilityCache is the constructor for AbilityCache. A non-positive TTL disables the cache, a non-positive size means DefaultAbilityCacheSize
+func NewAbilityCache(ttl time.Duration, size int) AbilityCache {
+	if size <= 0 {
+		size = DefaultAbilityCacheSize
+	}
+
+	return AbilityCache{
+		ttl:     ttl,
+		size:    size,
+		entries: map[string]abilityCacheEntry{},
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+		RWMutex: &sync.RWMutex{},
+	}
+}
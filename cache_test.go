@@ -0,0 +1,160 @@
+package gate
+
+import (
+	"testing"
+	"time"
+)
+
+type testAbility struct {
+	action string
+	object string
+}
+
+func (a testAbility) GetAction() string {
+	return a.action
+}
+
+func (a testAbility) GetObject() string {
+	return a.object
+}
+
+func TestAbilityCache(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	cache := NewAbilityCache(time.Minute, 0)
+	cache.Now = func() time.Time {
+		return now
+	}
+
+	abilities := NewAbilityIndex([]UserAbility{testAbility{"GET", "*"}}, NewMatcher())
+
+	t.Run("order insensitive", func(t *testing.T) {
+		cache.Set([]string{"a", "b"}, abilities)
+		if _, ok := cache.Get([]string{"b", "a"}); !ok {
+			t.Fatal("role sets should be order insensitive")
+		}
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		cache.Set([]string{"a", "b"}, abilities)
+		cache.Set([]string{"c"}, abilities)
+		cache.Invalidate("b")
+
+		if _, ok := cache.Get([]string{"a", "b"}); ok {
+			t.Fatal("role sets containing the invalidated role should be removed")
+		}
+
+		if _, ok := cache.Get([]string{"c"}); !ok {
+			t.Fatal("other role sets should be kept")
+		}
+	})
+
+	t.Run("until", func(t *testing.T) {
+		cache.SetUntil([]string{"u"}, abilities, now.Add(time.Second))
+		now = now.Add(time.Second)
+		if _, ok := cache.Get([]string{"u"}); ok {
+			t.Fatal("entries should expire at the given time before the TTL")
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		cache.Set([]string{"a"}, abilities)
+		now = now.Add(time.Minute)
+		if _, ok := cache.Get([]string{"a"}); ok {
+			t.Fatal("expired entries should be ignored")
+		}
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		cache.Set([]string{"s"}, abilities)
+		now = now.Add(time.Minute)
+		if _, ok := cache.GetStale([]string{"s"}); !ok {
+			t.Fatal("expired entries should be returned as stale")
+		}
+
+		scheduled := NewAbilityIndex([]UserAbility{testAbility{"GET", "*"}}, NewMatcher())
+		scheduled.SetUntil(now.Add(time.Hour))
+		cache.SetUntil([]string{"w"}, scheduled, scheduled.Until())
+		now = now.Add(time.Hour)
+		if _, ok := cache.GetStale([]string{"w"}); ok {
+			t.Fatal("stale entries past their next availability change should not be returned")
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		bounded := NewAbilityCache(time.Minute, 1)
+		bounded.Now = cache.Now
+		bounded.Set([]string{"a"}, abilities)
+		bounded.Set([]string{"b"}, abilities)
+		if _, ok := bounded.Get([]string{"b"}); ok {
+			t.Fatal("role sets should not be cached while the cache is full")
+		}
+
+		now = now.Add(time.Minute)
+		bounded.Set([]string{"b"}, abilities)
+		if _, ok := bounded.GetStale([]string{"a"}); ok {
+			t.Fatal("expired entries should be purged once the cache is full")
+		}
+
+		if _, ok := bounded.Get([]string{"b"}); !ok {
+			t.Fatal("role sets should be cached once expired entries are purged")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := NewAbilityCache(0, 0)
+		disabled.Set([]string{"a"}, abilities)
+		if _, ok := disabled.Get([]string{"a"}); ok {
+			t.Fatal("a disabled cache should never hit")
+		}
+	})
+}
+
+func TestAbilityIndex(t *testing.T) {
+	abilities := []UserAbility{
+		testAbility{"GET", "/api/v1/posts"},
+		testAbility{"POST", "/api/v1/users*"},
+		testAbility{"", "/api/v1/comments"},
+	}
+
+	t.Run("expressions", func(t *testing.T) {
+		index := NewAbilityIndex(abilities, NewMatcher())
+		if len(index.exact) != 1 {
+			t.Fatalf("only literal abilities should be indexed: %v", index.exact)
+		}
+
+		if len(index.patterns) != 1 {
+			t.Fatalf("only pattern abilities should be matched one by one: %v", index.patterns)
+		}
+
+		if !index.Allows("GET", "/api/v1/posts") {
+			t.Fatal("exact abilities should be allowed")
+		}
+
+		if !index.Allows("POST", "/api/v1/users/1") {
+			t.Fatal("pattern abilities should be allowed")
+		}
+
+		if index.Allows("DELETE", "/api/v1/comments") {
+			t.Fatal("invalid abilities should be ignored")
+		}
+	})
+
+	t.Run("case insensitive paths", func(t *testing.T) {
+		matcher := NewMatcher()
+		matcher.SetObjectPaths(true)
+		matcher.SetCaseInsensitive(true)
+
+		index := NewAbilityIndex([]UserAbility{testAbility{"GET", "projects/1"}, testAbility{"GET", "projects/:id/issues"}}, matcher)
+		if len(index.exact) != 1 {
+			t.Fatalf("only literal abilities should be indexed: %v", index.exact)
+		}
+
+		if !index.Allows("get", "Projects/1") {
+			t.Fatal("exact abilities should be allowed case-insensitively")
+		}
+
+		if index.Allows("GET", "projects/2") {
+			t.Fatal("other objects should not be allowed")
+		}
+	})
+}
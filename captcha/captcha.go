@@ -0,0 +1,101 @@
+package captcha
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// Verification endpoints
+const (
+	ReCAPTCHAEndpoint = "https://www.google.com/recaptcha/api/siteverify"
+	HCaptchaEndpoint  = "https://hcaptcha.com/siteverify"
+)
+
+// DefaultTimeout is the default timeout of verification requests
+const DefaultTimeout = 5 * time.Second
+
+// ErrRejected is thrown when the verification endpoint rejects a response
+var ErrRejected = errors.New("captcha rejected")
+
+// Verifier is the gate.ChallengeVerifier of CAPTCHA responses using a siteverify endpoint, which reCAPTCHA and hCaptcha share
+type Verifier struct {
+	endpoint string
+	secret   string
+	ipKey    string
+	client   *http.Client
+}
+
+// SetClient is the setter for the HTTP client
+func (verifier *Verifier) SetClient(client *http.Client) {
+	verifier.client = client
+}
+
+// SetRemoteIPKey is the setter for the source metadata of login attempts sent as the remote IP, "ip" by default
+func (verifier *Verifier) SetRemoteIPKey(key string) {
+	verifier.ipKey = key
+}
+
+// Verify verifies a CAPTCHA response with the verification endpoint
+func (verifier Verifier) Verify(response string, attempt gate.LoginAttempt) (err error) {
+	form := url.Values{"secret": {verifier.secret}, "response": {response}}
+	if ip, ok := attempt.Source[verifier.ipKey]; ok {
+		form.Set("remoteip", ip)
+	}
+
+	result, err := verifier.client.PostForm(verifier.endpoint, form)
+	if err != nil {
+		err = errors.Wrap(err, "could not verify the captcha")
+		return
+	}
+	defer result.Body.Close()
+
+	if result.StatusCode != http.StatusOK {
+		err = errors.Errorf("unexpected status %d", result.StatusCode)
+		return
+	}
+
+	var verification struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+
+	err = json.NewDecoder(result.Body).Decode(&verification)
+	if err != nil {
+		err = errors.Wrap(err, "invalid verification")
+		return
+	}
+
+	if !verification.Success {
+		err = ErrRejected
+		if len(verification.ErrorCodes) > 0 {
+			err = errors.WithMessage(ErrRejected, strings.Join(verification.ErrorCodes, ", "))
+		}
+	}
+	return
+}
+
+// New is the constructor for Verifier using a siteverify endpoint
+func New(endpoint, secret string) Verifier {
+	return Verifier{
+		endpoint: endpoint,
+		secret:   secret,
+		ipKey:    "ip",
+		client:   &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// NewReCAPTCHA is the constructor for Verifier using reCAPTCHA
+func NewReCAPTCHA(secret string) Verifier {
+	return New(ReCAPTCHAEndpoint, secret)
+}
+
+// NewHCaptcha is the constructor for Verifier using hCaptcha
+func NewHCaptcha(secret string) Verifier {
+	return New(HCaptchaEndpoint, secret)
+}
@@ -0,0 +1,70 @@
+package captcha
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+func TestVerifier(t *testing.T) {
+	var remoteIP string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("secret") != "secret" {
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-secret"]}`))
+			return
+		}
+
+		remoteIP = r.PostFormValue("remoteip")
+		switch r.PostFormValue("response") {
+		case "solved":
+			w.Write([]byte(`{"success": true}`))
+		case "broken":
+			http.Error(w, "broken", http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+		}
+	}))
+	defer server.Close()
+
+	attempt := gate.LoginAttempt{Source: map[string]string{"ip": "127.0.0.1"}}
+	verifier := New(server.URL, "secret")
+
+	t.Run("solved", func(t *testing.T) {
+		err := verifier.Verify("solved", attempt)
+		if err != nil {
+			t.Fatalf("err should be nil because of the solved captcha: %s", err)
+		}
+
+		if remoteIP != "127.0.0.1" {
+			t.Fatalf("remote IP should be sent: %s", remoteIP)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		err := verifier.Verify("robot", attempt)
+		if errors.Cause(err) != ErrRejected {
+			t.Fatalf("err should be ErrRejected because of the unsolved captcha: %v", err)
+		}
+
+		err = New(server.URL, "invalid").Verify("solved", attempt)
+		if errors.Cause(err) != ErrRejected {
+			t.Fatalf("err should be ErrRejected because of the invalid secret: %v", err)
+		}
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		err := verifier.Verify("broken", attempt)
+		if err == nil || errors.Cause(err) == ErrRejected {
+			t.Fatalf("err should be a verification failure: %v", err)
+		}
+	})
+
+	t.Run("endpoints", func(t *testing.T) {
+		if NewReCAPTCHA("secret").endpoint != ReCAPTCHAEndpoint || NewHCaptcha("secret").endpoint != HCaptchaEndpoint {
+			t.Fatal("constructors should use the endpoints of the providers")
+		}
+	})
+}
@@ -0,0 +1,2 @@
+// Package captcha provides gate.ChallengeVerifier adapters for reCAPTCHA and hCaptcha
+package captcha
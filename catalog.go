@@ -0,0 +1,172 @@
+package gate
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Error codes are the stable machine-readable codes of the failures defined by gate
+const (
+	CodeForbidden                 = "forbidden"
+	CodeNoAbilities               = "no_abilities"
+	CodeTokenConsumed             = "token_consumed"
+	CodeTokenRevoked              = "token_revoked"
+	CodeInvalidToken              = "invalid_token"
+	CodeMFARequired               = "mfa_required"
+	CodeStepUpRequired            = "step_up_required"
+	CodeQuotaExceeded             = "quota_exceeded"
+	CodeSessionLimitExceeded      = "session_limit_exceeded"
+	CodeRoleServiceUnavailable    = "role_service_unavailable"
+	CodeChallengeRequired         = "challenge_required"
+	CodeChallengeFailed           = "challenge_failed"
+	CodeAuthenticationFailed      = "authentication_failed"
+	CodeAuthenticationUnavailable = "authentication_unavailable"
+	CodeLoginFailed               = "login_failed"
+	CodeAuthorizationFailed       = "authorization_failed"
+	// CodeUnknown is the code of the failures which are not defined by gate
+	CodeUnknown = "unknown_error"
+)
+
+// DefaultLocale is the locale of the default message templates
+const DefaultLocale = "en"
+
+var errorCodes = map[error]string{
+	ErrForbidden:                 CodeForbidden,
+	ErrNoAbilities:               CodeNoAbilities,
+	ErrTokenConsumed:             CodeTokenConsumed,
+	ErrTokenRevoked:              CodeTokenRevoked,
+	ErrMalformedJWT:              CodeInvalidToken,
+	ErrJWTTooLarge:               CodeInvalidToken,
+	ErrClaimsTooLarge:            CodeInvalidToken,
+	ErrAlgorithmNotAllowed:       CodeInvalidToken,
+	ErrAlgorithmNone:             CodeInvalidToken,
+	ErrInvalidClaims:             CodeInvalidToken,
+	ErrMFARequired:               CodeMFARequired,
+	ErrStepUpRequired:            CodeStepUpRequired,
+	ErrQuotaExceeded:             CodeQuotaExceeded,
+	ErrSessionLimitExceeded:      CodeSessionLimitExceeded,
+	ErrRoleServiceUnavailable:    CodeRoleServiceUnavailable,
+	ErrChallengeRequired:         CodeChallengeRequired,
+	ErrChallengeFailed:           CodeChallengeFailed,
+	ErrAuthenticationFailed:      CodeAuthenticationFailed,
+	ErrAuthenticationUnavailable: CodeAuthenticationUnavailable,
+	ErrLoginFailed:               CodeLoginFailed,
+	ErrAuthorizationFailed:       CodeAuthorizationFailed,
+}
+
+// defaultTemplates are the English message templates of the error codes
+var defaultTemplates = map[string]string{
+	CodeForbidden:                 "You are not allowed to perform this action",
+	CodeNoAbilities:               "You have no permissions",
+	CodeTokenConsumed:             "This link has already been used",
+	CodeTokenRevoked:              "Your session has been revoked, please sign in again",
+	CodeInvalidToken:              "Your session is invalid, please sign in again",
+	CodeMFARequired:               "Multi-factor authentication is required",
+	CodeStepUpRequired:            "Please confirm your identity to continue",
+	CodeQuotaExceeded:             "You have exceeded your quota, please try again later",
+	CodeSessionLimitExceeded:      "You are signed in on too many devices",
+	CodeRoleServiceUnavailable:    "The service is temporarily unavailable, please try again later",
+	CodeChallengeRequired:         "Please complete the challenge to sign in",
+	CodeChallengeFailed:           "The challenge response is invalid",
+	CodeAuthenticationFailed:      "Authentication failed",
+	CodeAuthenticationUnavailable: "The service is temporarily unavailable, please try again later",
+	CodeLoginFailed:               "The username or the password is incorrect",
+	CodeAuthorizationFailed:       "Authorization failed",
+	CodeUnknown:                   "Something went wrong",
+}
+
+// ErrorCode returns the stable code of an error by its cause, CodeUnknown for the failures which are not defined by gate
+func ErrorCode(err error) string {
+	if code, ok := errorCodes[errors.Cause(err)]; ok {
+		return code
+	}
+
+	return CodeUnknown
+}
+
+// Translator is the contract for translating the message templates of error codes into locales.
+// Templates refer to the parameters as "{name}"
+type Translator interface {
+	Translate(locale, code string, params map[string]string) (string, bool)
+}
+
+// Message is a localized error message along with its stable code
+type Message struct {
+	Code string `json:"code"`
+	Text string `json:"message"`
+}
+
+// Localize returns the localized message of an error with the translator, falling back to the English message template
+func Localize(translator Translator, locale string, err error, params map[string]string) Message {
+	code := ErrorCode(err)
+	if translator != nil {
+		if text, ok := translator.Translate(locale, code, params); ok {
+			return Message{code, text}
+		}
+	}
+
+	return Message{code, render(defaultTemplates[code], params)}
+}
+
+// Catalog is the Translator of message templates by locale. Locales are matched case-insensitively and fall back
+// to their base language, e.g. "pt-BR" to "pt", then to the fallback locale. The English templates are registered by default
+type Catalog struct {
+	fallback  string
+	templates map[string]map[string]string
+}
+
+// Register registers the message templates of a locale by error code, e.g. Register("fr", map[string]string{CodeForbidden: "Action interdite"}).
+// Templates of the locale which are already registered are replaced
+func (catalog Catalog) Register(locale string, templates map[string]string) {
+	locale = strings.ToLower(locale)
+	if catalog.templates[locale] == nil {
+		catalog.templates[locale] = map[string]string{}
+	}
+
+	for code, template := range templates {
+		catalog.templates[locale][code] = template
+	}
+}
+
+// Translate renders the message template of an error code in a locale
+func (catalog Catalog) Translate(locale, code string, params map[string]string) (string, bool) {
+	locale = strings.ToLower(locale)
+	candidates := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, catalog.fallback)
+
+	for _, candidate := range candidates {
+		if template, ok := catalog.templates[candidate][code]; ok {
+			return render(template, params), true
+		}
+	}
+
+	return "", false
+}
+
+func render(template string, params map[string]string) string {
+	if len(params) == 0 {
+		return template
+	}
+
+	replacements := make([]string, 0, len(params)*2)
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", value)
+	}
+
+	return strings.NewReplacer(replacements...).Replace(template)
+}
+
+// NewCatalog is the constructor for Catalog with the fallback locale, DefaultLocale if empty
+func NewCatalog(fallback string) Catalog {
+	if fallback == "" {
+		fallback = DefaultLocale
+	}
+
+	catalog := Catalog{strings.ToLower(fallback), map[string]map[string]string{}}
+	catalog.Register(DefaultLocale, defaultTemplates)
+	return catalog
+}
@@ -0,0 +1,75 @@
+package gate
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestErrorCode(t *testing.T) {
+	if code := ErrorCode(errors.WithMessage(ErrMFARequired, "totp")); code != CodeMFARequired {
+		t.Fatalf("code should be found by the cause: %s", code)
+	}
+
+	if code := ErrorCode(ErrMalformedJWT); code != CodeInvalidToken {
+		t.Fatalf("token errors should share a code: %s", code)
+	}
+
+	if code := ErrorCode(errors.New("database is down")); code != CodeUnknown {
+		t.Fatalf("undefined errors should be unknown: %s", code)
+	}
+
+	for _, err := range publicErrors {
+		if ErrorCode(err) == CodeUnknown {
+			t.Fatalf("public errors should have codes: %s", err)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	catalog := NewCatalog("")
+	catalog.Register("vi", map[string]string{
+		CodeForbidden:     "Bạn không có quyền thực hiện thao tác này",
+		CodeQuotaExceeded: "Vui lòng thử lại sau {retry} giây",
+	})
+	catalog.Register("VI-vn", map[string]string{
+		CodeForbidden: "Không được phép",
+	})
+
+	t.Run("locale", func(t *testing.T) {
+		message, ok := catalog.Translate("vi-VN", CodeForbidden, nil)
+		if !ok || message != "Không được phép" {
+			t.Fatalf("exact locale should be preferred: %s", message)
+		}
+	})
+
+	t.Run("base language", func(t *testing.T) {
+		message, ok := catalog.Translate("vi_VN", CodeQuotaExceeded, map[string]string{"retry": "30"})
+		if !ok || message != "Vui lòng thử lại sau 30 giây" {
+			t.Fatalf("base language should be used with the params: %s", message)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		message, ok := catalog.Translate("ja", CodeLoginFailed, nil)
+		if !ok || message != defaultTemplates[CodeLoginFailed] {
+			t.Fatalf("fallback locale should be used: %s", message)
+		}
+
+		if _, ok := catalog.Translate("ja", "custom", nil); ok {
+			t.Fatal("unknown codes should not be translated")
+		}
+	})
+
+	t.Run("localize", func(t *testing.T) {
+		message := Localize(catalog, "vi", errors.WithMessage(ErrForbidden, "posts"), nil)
+		if message.Code != CodeForbidden || message.Text != "Bạn không có quyền thực hiện thao tác này" {
+			t.Fatalf("invalid message: %+v", message)
+		}
+
+		message = Localize(nil, "vi", errors.New("database is down"), nil)
+		if message.Code != CodeUnknown || message.Text != defaultTemplates[CodeUnknown] {
+			t.Fatalf("message should fall back without a translator: %+v", message)
+		}
+	})
+}
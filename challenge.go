@@ -0,0 +1,88 @@
+package gate
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultChallengeField is the default name of the credential holding the challenge response, e.g. a CAPTCHA token
+const DefaultChallengeField = "challenge"
+
+// ErrChallengeRequired is thrown when a login is risky and no challenge response is given
+var ErrChallengeRequired = errors.New("challenge is required")
+
+// ErrChallengeFailed is thrown when the challenge response of a risky login is rejected
+var ErrChallengeFailed = errors.New("challenge failed")
+
+// ChallengeVerifier is the contract for verifiers of challenge responses, e.g. CAPTCHA or proof-of-work solutions.
+// The attempt carries the source metadata of the login, e.g. the IP address
+type ChallengeVerifier interface {
+	Verify(response string, attempt LoginAttempt) error
+}
+
+// ChallengeTrigger is the contract for risk signals demanding a challenge before the credentials are checked
+type ChallengeTrigger interface {
+	RequiresChallenge(LoginAttempt) bool
+}
+
+// RequiresChallenge reports whether a source has too many failed attempts within the window
+func (detector VelocityDetector) RequiresChallenge(attempt LoginAttempt) bool {
+	source, ok := attempt.Source[detector.key]
+	if !ok {
+		return false
+	}
+
+	detector.Lock()
+	defer detector.Unlock()
+
+	return len(detector.recent(source, detector.Now())) >= detector.threshold
+}
+
+// SourceHistory is the ChallengeTrigger of logins from new sources.
+// It records the sources of successful logins per username and demands a challenge from sources which are new to a known username
+type SourceHistory struct {
+	key     string
+	sources map[string]map[string]bool
+	*sync.RWMutex
+}
+
+// Observe records the source of successful attempts. It is meant to be added as a LoginHook
+func (history SourceHistory) Observe(attempt LoginAttempt) {
+	source, ok := attempt.Source[history.key]
+	if !ok || !attempt.Succeeded {
+		return
+	}
+
+	history.Lock()
+	defer history.Unlock()
+
+	if history.sources[attempt.UsernameHash] == nil {
+		history.sources[attempt.UsernameHash] = map[string]bool{}
+	}
+
+	history.sources[attempt.UsernameHash][source] = true
+}
+
+// RequiresChallenge reports whether the source of an attempt is new to a known username
+func (history SourceHistory) RequiresChallenge(attempt LoginAttempt) bool {
+	source, ok := attempt.Source[history.key]
+	if !ok {
+		return false
+	}
+
+	history.RLock()
+	defer history.RUnlock()
+
+	sources, known := history.sources[attempt.UsernameHash]
+	return known && !sources[source]
+}
+
+// NewSourceHistory is the constructor for SourceHistory. The key is the source metadata identifying the origin of attempts, e.g. "ip"
+func NewSourceHistory(key string) SourceHistory {
+	return SourceHistory{
+		key:     key,
+		sources: map[string]map[string]bool{},
+		RWMutex: &sync.RWMutex{},
+	}
+}
@@ -0,0 +1,51 @@
+package gate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChallengeTriggers(t *testing.T) {
+	t.Run("velocity", func(t *testing.T) {
+		now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+		detector := NewVelocityDetector("ip", 2, time.Minute)
+		detector.Now = func() time.Time {
+			return now
+		}
+
+		failed := LoginAttempt{Source: map[string]string{"ip": "10.0.0.1"}}
+		detector.Detect(failed)
+		if detector.RequiresChallenge(failed) {
+			t.Fatal("challenge should not be required below the threshold")
+		}
+
+		detector.Detect(failed)
+		if !detector.RequiresChallenge(failed) {
+			t.Fatal("challenge should be required because of the failed attempts")
+		}
+
+		now = now.Add(time.Minute)
+		if detector.RequiresChallenge(failed) {
+			t.Fatal("challenge should not be required after the window")
+		}
+	})
+
+	t.Run("source history", func(t *testing.T) {
+		history := NewSourceHistory("ip")
+		attempt := LoginAttempt{UsernameHash: HashUsername("foo"), Source: map[string]string{"ip": "10.0.0.1"}}
+		if history.RequiresChallenge(attempt) {
+			t.Fatal("challenge should not be required for unknown usernames")
+		}
+
+		attempt.Succeeded = true
+		history.Observe(attempt)
+		if history.RequiresChallenge(attempt) {
+			t.Fatal("challenge should not be required from a known source")
+		}
+
+		attempt.Source = map[string]string{"ip": "10.0.0.2"}
+		if !history.RequiresChallenge(attempt) {
+			t.Fatal("challenge should be required from a new source")
+		}
+	})
+}
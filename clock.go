@@ -0,0 +1,69 @@
+package gate
+
+import (
+	"time"
+)
+
+// Clock is the source of the current time, e.g. a fake clock controlled by tests or simulations
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is a function used as a Clock
+type ClockFunc func() time.Time
+
+// Now returns the current time of the function
+func (fn ClockFunc) Now() time.Time {
+	return fn()
+}
+
+// SystemClock is the Clock of the local system time
+var SystemClock Clock = ClockFunc(func() time.Time {
+	return time.Now().Local()
+})
+
+// Clock is the getter for the clock, SystemClock by default
+func (dependencies Dependencies) Clock() Clock {
+	if dependencies.clock == nil {
+		return SystemClock
+	}
+
+	return dependencies.clock
+}
+
+// SetClock is the setter for the clock used for claims, token expiration, validity windows, schedules, caches and rate limiting
+func (dependencies *Dependencies) SetClock(clock Clock) {
+	dependencies.clock = clock
+}
+
+// ApplyClock binds the clock to the built-in time-dependent services of the dependencies, i.e. the JWT service, the caches,
+// the circuit breaker, MemoryCounterStore and VelocityDetector. Drivers apply it once their services are set.
+// Nothing is bound unless a clock is set, so the clocks of the services are kept
+func (dependencies *Dependencies) ApplyClock() {
+	if dependencies.clock == nil {
+		return
+	}
+
+	now := dependencies.clock.Now
+	dependencies.jwtService.Now = now
+	dependencies.abilityCache.Now = now
+	dependencies.decisionCache.Now = now
+	dependencies.negativeCache.Now = now
+	dependencies.roleBreaker.Now = now
+
+	if store, ok := dependencies.counterStore.(MemoryCounterStore); ok {
+		store.Now = now
+		dependencies.counterStore = store
+	}
+
+	if detector, ok := dependencies.detector.(VelocityDetector); ok {
+		detector.Now = now
+		dependencies.detector = detector
+	}
+}
+
+// WithClock sets the clock
+func (builder *DependenciesBuilder) WithClock(clock Clock) *DependenciesBuilder {
+	builder.dependencies.clock = clock
+	return builder
+}
@@ -0,0 +1,59 @@
+package gate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := ClockFunc(func() time.Time {
+		return now
+	})
+
+	t.Run("default", func(t *testing.T) {
+		dependencies := NewDependencies(nil, nil, nil)
+		if dependencies.Clock().Now().IsZero() {
+			t.Fatal("clock should be the system clock by default")
+		}
+
+		dependencies.SetJWTService(NewJWTService(JWTConfig{}))
+		dependencies.ApplyClock()
+		if dependencies.JWTService().Now().Equal(now) {
+			t.Fatal("clock of the JWT service should be kept without a clock")
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		dependencies, err := NewDependenciesBuilder().
+			WithClock(clock).
+			Dependencies()
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		dependencies.SetJWTService(NewJWTService(JWTConfig{}))
+		dependencies.SetAbilityCache(NewAbilityCache(time.Minute, 0))
+		dependencies.SetCounterStore(NewMemoryCounterStore())
+		dependencies.SetAnomalyDetector(NewVelocityDetector("username", 1, time.Minute))
+		dependencies.ApplyClock()
+
+		if !dependencies.JWTService().Now().Equal(now) {
+			t.Fatal("JWT service should use the clock")
+		}
+
+		if !dependencies.AbilityCache().Now().Equal(now) {
+			t.Fatal("ability cache should use the clock")
+		}
+
+		store, ok := dependencies.CounterStore().(MemoryCounterStore)
+		if !ok || !store.Now().Equal(now) {
+			t.Fatal("counter store should use the clock")
+		}
+
+		detector, ok := dependencies.AnomalyDetector().(VelocityDetector)
+		if !ok || !detector.Now().Equal(now) {
+			t.Fatal("detector should use the clock")
+		}
+	})
+}
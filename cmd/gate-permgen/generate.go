@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/hiendv/gate/policy"
+	"github.com/pkg/errors"
+)
+
+// initialisms are the words spelled in upper case in the generated names, as golint does
+var initialisms = map[string]bool{
+	"API": true, "HTTP": true, "ID": true, "JSON": true, "UI": true, "URI": true, "URL": true, "UUID": true, "XML": true,
+}
+
+// permission is a generated permission constant
+type permission struct {
+	Name   string
+	Action string
+	Object string
+}
+
+// Value returns the value of the constant, i.e. the action and the object
+func (permission permission) Value() string {
+	return permission.Action + " " + permission.Object
+}
+
+// role is a generated role constant
+type role struct {
+	Name string
+	ID   string
+}
+
+type permissionsByName []permission
+
+func (permissions permissionsByName) Len() int {
+	return len(permissions)
+}
+
+func (permissions permissionsByName) Swap(i, j int) {
+	permissions[i], permissions[j] = permissions[j], permissions[i]
+}
+
+func (permissions permissionsByName) Less(i, j int) bool {
+	return permissions[i].Name < permissions[j].Name
+}
+
+// identifier returns the exported Go identifier of the words of the values, e.g. "PostsRead" of "posts*" and "read"
+func identifier(values ...string) string {
+	name := camelCase(values...)
+	// identifiers of words without upper case, e.g. starting with a digit, would not be exported
+	if !unicode.IsUpper([]rune(name)[0]) {
+		name = "P" + name
+	}
+	return name
+}
+
+// camelCase joins the capitalized words of the values. Values without words, e.g. wildcards, are "Any"
+func camelCase(values ...string) string {
+	var name bytes.Buffer
+	for _, value := range values {
+		words := strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+
+		if len(words) == 0 {
+			name.WriteString("Any")
+			continue
+		}
+
+		for _, word := range words {
+			if upper := strings.ToUpper(word); initialisms[upper] {
+				name.WriteString(upper)
+				continue
+			}
+
+			runes := []rune(strings.ToLower(word))
+			runes[0] = unicode.ToUpper(runes[0])
+			name.WriteString(string(runes))
+		}
+	}
+
+	return name.String()
+}
+
+// reservedNames are the identifiers of the generated file besides the constants
+var reservedNames = []string{"Permission", "Permissions", "Role"}
+
+// uniqueNames suffixes the names taken more than once or reserved with their rank, e.g. PostsRead and PostsRead2
+func uniqueNames(names []string, reserved []string) []string {
+	taken := map[string]bool{}
+	counts := map[string]int{}
+	for _, name := range reserved {
+		taken[name] = true
+		counts[name] = 1
+	}
+
+	for _, name := range names {
+		taken[name] = true
+	}
+
+	result := make([]string, len(names))
+	for i, name := range names {
+		counts[name]++
+		result[i] = name
+		if counts[name] == 1 {
+			continue
+		}
+
+		for suffix := counts[name]; ; suffix++ {
+			candidate := name + strconv.Itoa(suffix)
+			if !taken[candidate] {
+				taken[candidate] = true
+				result[i] = candidate
+				break
+			}
+		}
+	}
+	return result
+}
+
+// literal reports whether the value of an ability is a concrete action or object, i.e. neither an expression, e.g. "posts*",
+// nor a path pattern with parameters, e.g. "/users/:id". Checking a pattern as an object would only match the objects spelling the pattern
+func literal(value string) bool {
+	if value == "" || regexp.QuoteMeta(value) != value {
+		return false
+	}
+
+	for _, segment := range strings.Split(value, "/") {
+		if strings.HasPrefix(segment, ":") {
+			return false
+		}
+	}
+	return true
+}
+
+// permissions returns the distinct concrete abilities of the roles and the permission sets of the document and the distinct pattern abilities
+func permissions(document policy.Document, reserved []string) (result []permission, patterns []permission) {
+	var abilities []policy.Ability
+	for _, role := range document.Roles {
+		abilities = append(abilities, role.Abilities...)
+	}
+
+	for _, set := range document.PermissionSets {
+		abilities = append(abilities, set.Abilities...)
+	}
+
+	seen := map[[2]string]bool{}
+	var keys [][2]string
+	for _, ability := range abilities {
+		key := [2]string{ability.Object, ability.Action}
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		if !literal(ability.Object) || !literal(ability.Action) {
+			patterns = append(patterns, permission{Action: ability.Action, Object: ability.Object})
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	// names are made unique in the order of the objects and the actions so they do not depend on the order of the document
+	sort.Sort(keysByValue(keys))
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = identifier(key[0], key[1])
+	}
+
+	result = make([]permission, len(keys))
+	for i, name := range uniqueNames(names, reserved) {
+		result[i] = permission{Name: name, Action: keys[i][1], Object: keys[i][0]}
+	}
+
+	sort.Sort(permissionsByName(result))
+	return
+}
+
+type keysByValue [][2]string
+
+func (keys keysByValue) Len() int {
+	return len(keys)
+}
+
+func (keys keysByValue) Swap(i, j int) {
+	keys[i], keys[j] = keys[j], keys[i]
+}
+
+func (keys keysByValue) Less(i, j int) bool {
+	if keys[i][0] != keys[j][0] {
+		return keys[i][0] < keys[j][0]
+	}
+	return keys[i][1] < keys[j][1]
+}
+
+// roles returns the roles of the document sorted by ID
+func roles(document policy.Document) []role {
+	var ids []string
+	seen := map[string]bool{}
+	for _, role := range document.Roles {
+		if !seen[role.ID] {
+			seen[role.ID] = true
+			ids = append(ids, role.ID)
+		}
+	}
+	sort.Strings(ids)
+
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = "Role" + camelCase(id)
+	}
+
+	result := make([]role, len(ids))
+	for i, name := range uniqueNames(names, reservedNames) {
+		result[i] = role{Name: name, ID: ids[i]}
+	}
+	return result
+}
+
+var source = template.Must(template.New("source").Parse(`// Code generated by gate-permgen from {{.Source}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import "github.com/hiendv/gate"
+
+// Permission is a concrete ability of the policy, i.e. its action and its object
+type Permission string
+
+// Permissions of the policy
+const (
+{{- range .Permissions}}
+	// {{.Name}} is the ability to take {{printf "%q" .Action}} on {{printf "%q" .Object}}
+	{{.Name}} Permission = {{printf "%q" .Value}}
+{{- end}}
+)
+{{- if .Patterns}}
+
+// The pattern abilities of the policy have no permissions since they are not objects. Check them with the concrete actions and objects:
+{{- range .Patterns}}
+//   - {{printf "%q" .Action}} on {{printf "%q" .Object}}
+{{- end}}
+{{- end}}
+
+var permissions = map[Permission]struct{ action, object string }{
+{{- range .Permissions}}
+	{{.Name}}: { {{- printf "%q" .Action}}, {{printf "%q" .Object -}} },
+{{- end}}
+}
+
+// Permissions returns every permission of the policy
+func Permissions() []Permission {
+	return []Permission{ {{- range $i, $permission := .Permissions}}{{if $i}}, {{end}}{{$permission.Name}}{{end -}} }
+}
+
+// GetAction returns the action. Permission is a gate.UserAbility
+func (permission Permission) GetAction() string {
+	return permissions[permission].action
+}
+
+// GetObject returns the object
+func (permission Permission) GetObject() string {
+	return permissions[permission].object
+}
+
+// String returns the action and the object
+func (permission Permission) String() string {
+	return string(permission)
+}
+
+// Check authorizes the user to take the action on the object, e.g. with a password.Driver
+func (permission Permission) Check(authorizer gate.Authorizer, user gate.User) error {
+	return authorizer.Authorize(user, permission.GetAction(), permission.GetObject())
+}
+
+// Role is a role ID of the policy
+type Role string
+
+// Roles of the policy
+const (
+{{- range .Roles}}
+	{{.Name}} Role = {{printf "%q" .ID}}
+{{- end}}
+)
+`))
+
+// generate returns the formatted Go source of the permissions and the roles of the document
+func generate(document policy.Document, packageName, sourceName string) ([]byte, error) {
+	// permissions are named after the roles so they never take the name of a role
+	roles := roles(document)
+	reserved := append([]string{}, reservedNames...)
+	for _, role := range roles {
+		reserved = append(reserved, role.Name)
+	}
+
+	concrete, patterns := permissions(document, reserved)
+	values := map[string]bool{}
+	for _, permission := range concrete {
+		if values[permission.Value()] {
+			return nil, errors.Errorf("ambiguous permission %q", permission.Value())
+		}
+		values[permission.Value()] = true
+	}
+
+	data := struct {
+		Source      string
+		Package     string
+		Permissions []permission
+		Patterns    []permission
+		Roles       []role
+	}{sourceName, packageName, concrete, patterns, roles}
+
+	var buffer bytes.Buffer
+	if err := source.Execute(&buffer, data); err != nil {
+		return nil, errors.Wrap(err, "could not generate the source")
+	}
+
+	formatted, err := format.Source(buffer.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not format the generated source")
+	}
+	return formatted, nil
+}
@@ -0,0 +1,79 @@
+// Command gate-permgen generates typed permission constants from a policy file of github.com/hiendv/gate,
+// so permissions are checked by the compiler instead of being spelled out as strings.
+//
+// Usage:
+//
+//	//go:generate gate-permgen -policy ../policy.json -package perm -output permissions_gen.go
+//
+// Every concrete ability of the roles and the permission sets of the policy becomes a Permission string constant named after its object
+// and its action, e.g. {"action": "read", "object": "posts"} becomes PostsRead of the value "read posts", and every role becomes a Role constant,
+// e.g. RoleEditor. Pattern abilities, e.g. of the objects "posts*" or "/users/:id", are listed without constants since they are not objects.
+// Permissions are checked against an authorizer such as a password.Driver:
+//
+//	err := perm.PostsRead.Check(driver, user)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hiendv/gate/policy"
+	"github.com/pkg/errors"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns the exit code: 0 on success, 1 on failures and 2 on usage errors
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gate-permgen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	policyFile := flags.String("policy", "", "the policy file")
+	packageName := flags.String("package", "perm", "the package of the generated file")
+	output := flags.String("output", "permissions_gen.go", `the generated file, "-" for the standard output`)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *policyFile == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	err := generateFile(*policyFile, *packageName, *output, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func generateFile(policyFile, packageName, output string, stdout io.Writer) error {
+	file, err := os.Open(policyFile)
+	if err != nil {
+		return errors.Wrap(err, "could not read the policy")
+	}
+	defer file.Close()
+
+	document, err := policy.Load(file)
+	if err != nil {
+		return err
+	}
+
+	source, err := generate(document, packageName, filepath.Base(policyFile))
+	if err != nil {
+		return err
+	}
+
+	if output == "-" {
+		_, err = stdout.Write(source)
+		return err
+	}
+
+	return errors.Wrap(ioutil.WriteFile(output, source, 0644), "could not write the generated file")
+}
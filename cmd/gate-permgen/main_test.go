@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const fixture = `{
+	"roles": [
+		{"id": "editor", "abilities": [{"action": "read", "object": "posts"}, {"action": "GET", "object": "/api/users/:id"}, {"action": "GET", "object": "/api/users"}]},
+		{"id": "2fa-admin", "abilities": [{"action": "*", "object": "*"}, {"action": "read", "object": "/posts/*"}], "permission_sets": ["auditor"]}
+	],
+	"permission_sets": [{"name": "auditor", "abilities": [{"action": "editor", "object": "role"}, {"action": "read", "object": "Posts"}, {"action": "read", "object": "posts"}]}]
+}`
+
+func TestLiteral(t *testing.T) {
+	cases := map[string]bool{
+		"posts":          true,
+		"/api/users":     true,
+		"GET":            true,
+		"posts*":         false,
+		"*":              false,
+		"/api/users/:id": false,
+		"(read|write)":   false,
+		"":               false,
+	}
+
+	for value, expected := range cases {
+		if literal(value) != expected {
+			t.Fatalf("%q should be literal: %v", value, expected)
+		}
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	cases := map[string][]string{
+		"PostsRead":      {"posts*", "read"},
+		"APIUsersIDGet":  {"/api/users/:id", "GET"},
+		"AnyAny":         {"*", "*"},
+		"P2faAdminWrite": {"2fa-admin", "write"},
+	}
+
+	for expected, values := range cases {
+		if name := identifier(values...); name != expected {
+			t.Fatalf("the identifier of %v should be %s: %s", values, expected, name)
+		}
+	}
+}
+
+// constants returns the names and the values of the constants of a generated source by the type of the block
+func constants(t *testing.T, source []byte) map[string][]string {
+	file, err := parser.ParseFile(token.NewFileSet(), "permissions_gen.go", source, 0)
+	if err != nil {
+		t.Fatalf("the generated source should be valid: %s\n%s", err, source)
+	}
+
+	result := map[string][]string{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+
+		kind := gen.Specs[0].(*ast.ValueSpec).Type.(*ast.Ident).Name
+		for _, spec := range gen.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				result[kind] = append(result[kind], name.Name)
+			}
+		}
+	}
+	return result
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "permgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policyFile := filepath.Join(dir, "policy.json")
+	err = ioutil.WriteFile(policyFile, []byte(fixture), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("usage", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if code := run(nil, &stdout, &stderr); code != 2 {
+			t.Fatalf("code should be 2 because of the missing policy: %d", code)
+		}
+
+		if code := run([]string{"-policy", filepath.Join(dir, "missing.json")}, &stdout, &stderr); code != 1 {
+			t.Fatalf("code should be 1 because of the missing policy file: %d", code)
+		}
+	})
+
+	t.Run("generate", func(t *testing.T) {
+		output := filepath.Join(dir, "permissions_gen.go")
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-policy", policyFile, "-package", "perm", "-output", output}, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("code should be 0: %d - %s", code, stderr.String())
+		}
+
+		source, err := ioutil.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(string(source), "// Code generated by gate-permgen from policy.json. DO NOT EDIT.\n\npackage perm\n") {
+			t.Fatalf("the source should be marked as generated:\n%s", source)
+		}
+
+		if !regexp.MustCompile(`PostsRead2\s+Permission = "read posts"`).Match(source) || !regexp.MustCompile(`PostsRead2:\s+\{"read", "posts"\},`).Match(source) {
+			t.Fatalf("permissions should be string constants of their abilities:\n%s", source)
+		}
+
+		consts := constants(t, source)
+		permissions := strings.Join(consts["Permission"], ",")
+		if permissions != "APIUsersGet,PostsRead,PostsRead2,RoleEditor2" {
+			t.Fatalf("distinct concrete abilities should have unique permissions apart from the roles: %s", permissions)
+		}
+
+		for _, pattern := range []string{`"*" on "*"`, `"read" on "/posts/*"`, `"GET" on "/api/users/:id"`} {
+			if !strings.Contains(string(source), "//   - "+pattern+"\n") {
+				t.Fatalf("pattern abilities should be listed without permissions: %s\n%s", pattern, source)
+			}
+		}
+
+		if roles := strings.Join(consts["Role"], ","); roles != "Role2faAdmin,RoleEditor" {
+			t.Fatalf("roles should have constants: %s", roles)
+		}
+
+		stdout.Reset()
+		code = run([]string{"-policy", policyFile, "-package", "perm", "-output", "-"}, &stdout, &stderr)
+		if code != 0 || stdout.String() != string(source) {
+			t.Fatalf("the generation should be deterministic: %d\n%s", code, stdout.String())
+		}
+	})
+}
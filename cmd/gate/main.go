@@ -0,0 +1,245 @@
+// Command gate is a debugging tool for github.com/hiendv/gate.
+// It issues test tokens, decodes and verifies tokens against a key and checks abilities against a policy file.
+//
+// Usage:
+//
+//	gate issue -key secret -id 1 -username alice -roles editor,viewer
+//	gate decode <token>
+//	gate verify -key secret <token>
+//	gate can -policy policy.json -user 1 <action> <object>
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/password"
+	"github.com/hiendv/gate/policy"
+	"github.com/pkg/errors"
+)
+
+const usage = `Usage: gate <command> [flags] [args]
+
+Commands:
+  issue   issue a test token
+  decode  decode a token without verification
+  verify  verify a token against a key
+  can     check whether a user can take an action on an object
+
+Run "gate <command> -h" for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns the exit code: 0 on success, 1 on a failed check and 2 on usage errors
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	commands := map[string]func([]string, io.Writer, io.Writer) error{
+		"issue":  issue,
+		"decode": decode,
+		"verify": verify,
+		"can":    can,
+	}
+
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	err := command(args[1:], stdout, stderr)
+	switch errors.Cause(err) {
+	case nil:
+		return 0
+	case flag.ErrHelp, errUsage:
+		return 2
+	default:
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+}
+
+var errUsage = errors.New("invalid usage")
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	return flags
+}
+
+func jwtService(alg, key string, expiration time.Duration) (service gate.JWTService, err error) {
+	config, err := gate.NewHMACJWTConfig(alg, key, expiration, false)
+	if err != nil {
+		return
+	}
+
+	service = gate.NewJWTService(config)
+	return
+}
+
+func issue(args []string, stdout, stderr io.Writer) (err error) {
+	flags := newFlagSet("issue", stderr)
+	alg := flags.String("alg", "HS256", "the signing algorithm")
+	key := flags.String("key", "", "the signing key")
+	expiration := flags.Duration("exp", time.Hour, "the token expiration")
+	id := flags.String("id", "", "the user ID")
+	username := flags.String("username", "", "the username")
+	roles := flags.String("roles", "", "the comma-separated role IDs")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	service, err := jwtService(*alg, *key, *expiration)
+	if err != nil {
+		return
+	}
+
+	user := policy.User{ID: *id, Username: *username, Roles: splitList(*roles)}
+	token, err := service.Issue(service.NewClaims(user))
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintln(stdout, token.Value)
+	return
+}
+
+func decode(args []string, stdout, stderr io.Writer) (err error) {
+	flags := newFlagSet("decode", stderr)
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	return printClaims(flags.Arg(0), stdout)
+}
+
+func verify(args []string, stdout, stderr io.Writer) (err error) {
+	flags := newFlagSet("verify", stderr)
+	alg := flags.String("alg", "HS256", "the signing algorithm")
+	key := flags.String("key", "", "the verifying key")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	service, err := jwtService(*alg, *key, 0)
+	if err != nil {
+		return
+	}
+
+	_, err = service.Parse(flags.Arg(0))
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintln(stdout, "valid")
+	return printClaims(flags.Arg(0), stdout)
+}
+
+func printClaims(tokenString string, stdout io.Writer) (err error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		err = errors.New("malformed token")
+		return
+	}
+
+	var out bytes.Buffer
+	for _, part := range parts[:2] {
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+		if err != nil {
+			return errors.Wrap(err, "malformed token")
+		}
+
+		err = json.Indent(&out, data, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "malformed token")
+		}
+
+		out.WriteString("\n")
+	}
+
+	_, err = out.WriteTo(stdout)
+	return
+}
+
+func can(args []string, stdout, stderr io.Writer) (err error) {
+	flags := newFlagSet("can", stderr)
+	policyFile := flags.String("policy", "", "the policy file")
+	userID := flags.String("user", "", "the user ID")
+	paths := flags.Bool("paths", false, "match objects as slash-separated resource paths")
+	caseInsensitive := flags.Bool("case-insensitive", false, "match case-insensitively")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	if flags.NArg() != 2 || *policyFile == "" || *userID == "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	file, err := os.Open(*policyFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	document, err := policy.Load(file)
+	if err != nil {
+		return
+	}
+
+	config := gate.NewConfig("gate", "gate", time.Hour, false)
+	config.SetObjectPathMatching(*paths)
+	config.SetCaseInsensitiveMatching(*caseInsensitive)
+
+	driver, err := password.NewAuthorizer(config, gate.NewDependencies(document, nil, document))
+	if err != nil {
+		return
+	}
+
+	_, err = driver.AuthorizeUserID(*userID, flags.Arg(0), flags.Arg(1))
+	if err != nil {
+		fmt.Fprintln(stdout, "denied")
+		return
+	}
+
+	fmt.Fprintln(stdout, "allowed")
+	return
+}
+
+func splitList(list string) (items []string) {
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
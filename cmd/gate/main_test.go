@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func execute(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRun(t *testing.T) {
+	t.Run("usage", func(t *testing.T) {
+		if code, _, _ := execute(); code != 2 {
+			t.Fatalf("code should be 2 because of the missing command: %d", code)
+		}
+
+		if code, _, _ := execute("unknown"); code != 2 {
+			t.Fatalf("code should be 2 because of the unknown command: %d", code)
+		}
+	})
+
+	t.Run("issue, decode and verify", func(t *testing.T) {
+		code, stdout, stderr := execute("issue", "-key", "secret", "-id", "1", "-username", "alice", "-roles", "editor")
+		if code != 0 {
+			t.Fatalf("code should be 0: %d - %s", code, stderr)
+		}
+
+		token := strings.TrimSpace(stdout)
+
+		code, stdout, _ = execute("decode", token)
+		if code != 0 || !strings.Contains(stdout, `"username": "alice"`) {
+			t.Fatalf("claims should be decoded: %d - %s", code, stdout)
+		}
+
+		code, stdout, _ = execute("verify", "-key", "secret", token)
+		if code != 0 || !strings.HasPrefix(stdout, "valid") {
+			t.Fatalf("token should be valid: %d - %s", code, stdout)
+		}
+
+		code, _, _ = execute("verify", "-key", "wrong", token)
+		if code != 1 {
+			t.Fatalf("code should be 1 because of the wrong key: %d", code)
+		}
+	})
+
+	t.Run("can", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "policy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+
+		file.WriteString(`{"roles": [{"id": "editor", "abilities": [{"action": "GET", "object": "projects/:id/**"}]}], "users": [{"id": "1", "roles": ["editor"]}]}`)
+		file.Close()
+
+		code, stdout, _ := execute("can", "-policy", file.Name(), "-user", "1", "-paths", "GET", "projects/1/issues")
+		if code != 0 || strings.TrimSpace(stdout) != "allowed" {
+			t.Fatalf("the user should be allowed: %d - %s", code, stdout)
+		}
+
+		code, stdout, _ = execute("can", "-policy", file.Name(), "-user", "1", "-paths", "DELETE", "projects/1")
+		if code != 1 || strings.TrimSpace(stdout) != "denied" {
+			t.Fatalf("the user should be denied: %d - %s", code, stdout)
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/middleware"
+	"github.com/hiendv/gate/oidc"
+	"github.com/hiendv/gate/password"
+	"github.com/hiendv/gate/policy"
+	"github.com/pkg/errors"
+)
+
+// defaultListen is the address of the server without socket activation nor a listen address
+const defaultListen = "127.0.0.1:8080"
+
+// duration is a time.Duration decoded from a string, e.g. "1h"
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = duration(parsed)
+	return nil
+}
+
+// jwtSettings are the settings of the issued tokens. HMAC algorithms use the secret, RSA and ECDSA algorithms the PEM private key file
+type jwtSettings struct {
+	Algorithm  string   `json:"algorithm"`
+	Secret     string   `json:"secret"`
+	KeyFile    string   `json:"key_file"`
+	KeyID      string   `json:"key_id"`
+	Expiration duration `json:"expiration"`
+}
+
+// config is the configuration file of the server. Relative paths are resolved against the directory of the file
+type config struct {
+	Listen string      `json:"listen"`
+	Issuer string      `json:"issuer"`
+	JWT    jwtSettings `json:"jwt"`
+	// PolicyFile is the policy document of the roles and the users
+	PolicyFile string `json:"policy_file"`
+	// Credentials are the password hashes of the users by username, see "gated hash"
+	Credentials map[string]string `json:"credentials"`
+	// Proxy is the proxy of the external authorization: "envoy", "nginx" or "traefik", see middleware.Proxy
+	Proxy string `json:"proxy"`
+}
+
+// proxies are the proxies of the external authorization by name
+var proxies = map[string]middleware.Proxy{
+	"envoy":   middleware.Envoy,
+	"nginx":   middleware.NGINX,
+	"traefik": middleware.Traefik,
+}
+
+// loadConfig reads the configuration file
+func loadConfig(path string) (cfg config, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.Wrap(err, "could not read the configuration")
+		return
+	}
+
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		err = errors.Wrap(err, "invalid configuration")
+		return
+	}
+
+	dir := filepath.Dir(path)
+	cfg.PolicyFile = resolvePath(dir, cfg.PolicyFile)
+	cfg.JWT.KeyFile = resolvePath(dir, cfg.JWT.KeyFile)
+	if cfg.JWT.Algorithm == "" {
+		cfg.JWT.Algorithm = "HS256"
+	}
+
+	if cfg.JWT.Expiration == 0 {
+		cfg.JWT.Expiration = duration(time.Hour)
+	}
+
+	if cfg.JWT.KeyID == "" {
+		cfg.JWT.KeyID = "gated"
+	}
+
+	if cfg.Proxy == "" {
+		cfg.Proxy = "envoy"
+	}
+
+	if _, ok := proxies[cfg.Proxy]; !ok {
+		err = errors.Errorf("invalid configuration: unknown proxy %q", cfg.Proxy)
+	}
+	return
+}
+
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
+
+// loadPolicy reads the policy document. There are neither roles nor users without a policy file
+func loadPolicy(path string) (document policy.Document, err error) {
+	if path == "" {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		err = errors.Wrap(err, "could not read the policy")
+		return
+	}
+	defer file.Close()
+
+	document, err = policy.Load(file)
+	return
+}
+
+// signingKey reads the PEM private key of an RSA or ECDSA algorithm
+func signingKey(settings jwtSettings) (key interface{}, err error) {
+	data, err := ioutil.ReadFile(settings.KeyFile)
+	if err != nil {
+		err = errors.Wrap(err, "could not read the signing key")
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(settings.Algorithm, "RS"):
+		key, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+	case strings.HasPrefix(settings.Algorithm, "ES"):
+		key, err = jwt.ParseECPrivateKeyFromPEM(data)
+	default:
+		err = errors.Errorf("unsupported algorithm %q", settings.Algorithm)
+	}
+
+	if err != nil {
+		err = errors.Wrap(err, "invalid signing key")
+	}
+	return
+}
+
+// newServer builds the server of a configuration. Only HS256 is supported among the HMAC algorithms
+func newServer(cfg config, logs io.Writer) (srv server, err error) {
+	document, err := loadPolicy(cfg.PolicyFile)
+	if err != nil {
+		return
+	}
+
+	credentials, err := newCredentialStore(cfg.Credentials)
+	if err != nil {
+		return
+	}
+
+	expiration := time.Duration(cfg.JWT.Expiration)
+	gateConfig := gate.NewConfig(cfg.JWT.Secret, cfg.JWT.Secret, expiration, false)
+	switch {
+	case cfg.JWT.Algorithm == "HS256":
+		if cfg.JWT.Secret == "" {
+			err = errors.New("missing JWT secret")
+			return
+		}
+	case strings.HasPrefix(cfg.JWT.Algorithm, "HS"):
+		err = errors.Errorf("unsupported algorithm %q", cfg.JWT.Algorithm)
+		return
+	default:
+		var key interface{}
+		if key, err = signingKey(cfg.JWT); err != nil {
+			return
+		}
+
+		var provider oidc.Provider
+		provider, err = oidc.NewProvider(cfg.Issuer, cfg.JWT.KeyID, key, expiration)
+		if err != nil {
+			return
+		}
+
+		if algorithms := provider.Metadata().IDTokenSigningAlgValuesSupported; len(algorithms) != 1 || algorithms[0] != cfg.JWT.Algorithm {
+			err = errors.Errorf("the signing key does not match the algorithm %q", cfg.JWT.Algorithm)
+			return
+		}
+
+		gateConfig.SetJWTKeyProvider(gate.NewStaticKeyProvider(cfg.JWT.Algorithm, cfg.JWT.KeyID, key))
+		srv.discovery = provider.Handler()
+	}
+
+	dependencies := gate.NewDependencies(document, tokenService{}, document)
+	dependencies.SetLogger(logger{logs, gate.LogLevelInfo})
+	driver, err := password.New(gateConfig, dependencies, func(username, password string) (gate.User, error) {
+		if !credentials.Verify(username, password) {
+			return nil, errInvalidCredentials
+		}
+
+		return document.FindOrCreateOneByUsername(username)
+	})
+	if err != nil {
+		return
+	}
+
+	srv.driver = driver
+	srv.responder = middleware.NewResponder("gated")
+	external := middleware.NewExternalAuth(middleware.New(driver))
+	external.SetProxy(proxies[cfg.Proxy])
+	external.SetPathPrefix(externalAuthPrefix)
+	srv.external = external.Handler()
+	return
+}
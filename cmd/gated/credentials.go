@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// hashScheme is the scheme of the password hashes, i.e. PBKDF2 with HMAC-SHA256
+const hashScheme = "pbkdf2-sha256"
+
+// hashIterations is the number of PBKDF2 iterations of new password hashes
+const hashIterations = 100000
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// passwordHash is a parsed password hash, "pbkdf2-sha256$<iterations>$<salt>$<key>" with unpadded base64 salt and key
+type passwordHash struct {
+	iterations int
+	salt       []byte
+	key        []byte
+}
+
+func parsePasswordHash(encoded string) (parsed passwordHash, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		err = errors.New("invalid password hash")
+		return
+	}
+
+	parsed.iterations, err = strconv.Atoi(parts[1])
+	if err != nil || parsed.iterations < 1 {
+		err = errors.New("invalid password hash iterations")
+		return
+	}
+
+	parsed.salt, err = base64.RawStdEncoding.DecodeString(parts[2])
+	if err == nil {
+		parsed.key, err = base64.RawStdEncoding.DecodeString(parts[3])
+	}
+
+	if err != nil || len(parsed.key) == 0 {
+		err = errors.New("invalid password hash encoding")
+	}
+	return
+}
+
+func (parsed passwordHash) verify(password string) bool {
+	key := pbkdf2.Key([]byte(password), parsed.salt, parsed.iterations, len(parsed.key), sha256.New)
+	return subtle.ConstantTimeCompare(key, parsed.key) == 1
+}
+
+// hashPassword returns the password hash of a password with a random salt
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, hashIterations, sha256.Size, sha256.New)
+	return strings.Join([]string{
+		hashScheme,
+		strconv.Itoa(hashIterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// credentialStore verifies the passwords of the users by username
+type credentialStore struct {
+	hashes map[string]passwordHash
+	// dummy is verified for unknown usernames, so they take as long as known ones
+	dummy passwordHash
+}
+
+// Verify reports whether the password is the password of the user
+func (store credentialStore) Verify(username, password string) bool {
+	parsed, ok := store.hashes[username]
+	if !ok {
+		store.dummy.verify(password)
+		return false
+	}
+
+	return parsed.verify(password)
+}
+
+func newCredentialStore(credentials map[string]string) (store credentialStore, err error) {
+	store.hashes = make(map[string]passwordHash, len(credentials))
+	for username, encoded := range credentials {
+		store.hashes[username], err = parsePasswordHash(encoded)
+		if err != nil {
+			err = errors.Wrapf(err, "invalid credentials of %q", username)
+			return
+		}
+	}
+
+	store.dummy = passwordHash{hashIterations, make([]byte, 16), make([]byte, sha256.Size)}
+	return
+}
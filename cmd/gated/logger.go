@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+// logger writes the entries of gate as logfmt lines
+type logger struct {
+	out   io.Writer
+	level gate.LogLevel
+}
+
+func (l logger) Enabled(level gate.LogLevel) bool {
+	return level >= l.level
+}
+
+func (l logger) Log(level gate.LogLevel, msg string, keysAndValues ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var line bytes.Buffer
+	fmt.Fprintf(&line, "time=%s level=%s msg=%q", time.Now().UTC().Format(time.RFC3339), level, msg)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fmt.Fprintf(&line, " %v=%q", keysAndValues[i], fmt.Sprint(keysAndValues[i+1]))
+	}
+
+	line.WriteString("\n")
+	l.out.Write(line.Bytes())
+}
@@ -0,0 +1,162 @@
+// Command gated is a standalone authentication and authorization server for github.com/hiendv/gate,
+// so it runs as a sidecar or an auth service without embedding the library.
+// It exposes login, refresh, introspection, JWKS, authorize and proxy external authorization endpoints configured from a JSON file.
+//
+// Usage:
+//
+//	gated -config gated.json
+//	gated hash < password.txt
+//
+// The configuration file has the listen address, the JWT settings, the policy file of the roles and the users
+// and the password hashes of the users by username:
+//
+//	{
+//	  "listen": "127.0.0.1:8080",
+//	  "issuer": "https://auth.example.com",
+//	  "jwt": {"algorithm": "RS256", "key_file": "key.pem", "key_id": "1", "expiration": "1h"},
+//	  "policy_file": "policy.json",
+//	  "credentials": {"alice": "pbkdf2-sha256$100000$..."},
+//	  "proxy": "envoy"
+//	}
+//
+// The proxy is the one sending the external authorization subrequests to /ext_authz: "envoy" by default, "nginx" or "traefik".
+// Only the original request headers of that proxy are read, see middleware.ExternalAuth
+//
+// Tokens are stateless: they are valid until they expire, refreshed ones included, since revocation would require a token store
+// persisted across restarts and shared by the replicas. Callers of the introspection, e.g. resource servers, authenticate with a bearer token
+// of a user granted the "introspect" action on "tokens" by the policy.
+//
+// HS256 tokens are signed with "secret" in place of "key_file". The server is socket-activated when started by systemd
+// with a socket unit, otherwise it listens on the listen address of the flag or the file
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd, see sd_listen_fds(3)
+const listenFDsStart = 3
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns the exit code: 0 on success, 1 on failures and 2 on usage errors
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var err error
+	if len(args) > 0 && args[0] == "hash" {
+		err = hashCommand(stdin, stdout)
+	} else {
+		err = serve(args, stderr)
+	}
+
+	switch err {
+	case nil:
+		return 0
+	case flag.ErrHelp:
+		return 2
+	default:
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+}
+
+// hashCommand prints the password hash of the first line of the input
+func hashCommand(stdin io.Reader, stdout io.Writer) error {
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return errors.New("empty password")
+	}
+
+	encoded, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, encoded)
+	return nil
+}
+
+func serve(args []string, stderr io.Writer) error {
+	flags := flag.NewFlagSet("gated", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configFile := flags.String("config", "gated.json", "the configuration file")
+	listen := flags.String("listen", "", "the listen address, overriding the configuration file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	if *listen != "" {
+		cfg.Listen = *listen
+	}
+
+	srv, err := newServer(cfg, stderr)
+	if err != nil {
+		return err
+	}
+
+	listener, err := activationListener()
+	if err == nil && listener == nil {
+		address := cfg.Listen
+		if address == "" {
+			address = defaultListen
+		}
+
+		listener, err = net.Listen("tcp", address)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "could not listen")
+	}
+
+	httpServer := &http.Server{
+		Handler:      srv,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	fmt.Fprintf(stderr, "gated listening on %s\n", listener.Addr())
+	return httpServer.Serve(listener)
+}
+
+// activationListener returns the first socket passed by systemd, if any
+func activationListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(listenFDsStart, "LISTEN_FD_3")
+	defer file.Close()
+
+	return net.FileListener(file)
+}
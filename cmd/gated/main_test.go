@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `{
+	"roles": [
+		{"id": "editor", "abilities": [{"action": "GET", "object": "posts*"}]},
+		{"id": "resource-server", "abilities": [{"action": "introspect", "object": "tokens"}]}
+	],
+	"users": [{"id": "1", "username": "alice", "roles": ["editor"]}, {"id": "2", "username": "api", "roles": ["resource-server"]}]
+}`
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "gated")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testServer(t *testing.T, jwtSettings string, files map[string]string) (server, func()) {
+	encoded, err := hashPassword("secret")
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	files["policy.json"] = testPolicy
+	files["gated.json"] = `{"issuer": "https://auth.example.com", "jwt": ` + jwtSettings + `, "policy_file": "policy.json", "credentials": {"alice": "` + encoded + `", "api": "` + encoded + `"}}`
+	dir := writeFiles(t, files)
+
+	cfg, err := loadConfig(filepath.Join(dir, "gated.json"))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	srv, err := newServer(cfg, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	return srv, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func request(handler http.Handler, method, target, token, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	return recorder
+}
+
+func login(t *testing.T, handler http.Handler) string {
+	return loginAs(t, handler, "alice")
+}
+
+func loginAs(t *testing.T, handler http.Handler, username string) string {
+	recorder := request(handler, "POST", "/login", "", "application/x-www-form-urlencoded", url.Values{"username": {username}, "password": {"secret"}}.Encode())
+	var response tokenResponse
+	if recorder.Code != http.StatusOK || json.NewDecoder(recorder.Body).Decode(&response) != nil || response.AccessToken == "" {
+		t.Fatalf("login should succeed: %d", recorder.Code)
+	}
+
+	if response.TokenType != "Bearer" || response.ExpiresIn != 3600 {
+		t.Fatalf("token response should be a bearer token of an hour: %+v", response)
+	}
+	return response.AccessToken
+}
+
+func TestServer(t *testing.T) {
+	srv, cleanup := testServer(t, `{"secret": "jwt-secret"}`, map[string]string{})
+	defer cleanup()
+
+	t.Run("login", func(t *testing.T) {
+		login(t, srv)
+
+		if code := request(srv, "POST", "/login", "", "application/json", `{"username": "alice", "password": "wrong"}`).Code; code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401 because of the wrong password: %d", code)
+		}
+
+		if code := request(srv, "POST", "/login", "", "application/json", `{"username": "bob", "password": "secret"}`).Code; code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401 because of the unknown user: %d", code)
+		}
+
+		if code := request(srv, "GET", "/login", "", "", "").Code; code != http.StatusMethodNotAllowed {
+			t.Fatalf("status should be 405 because of the method: %d", code)
+		}
+	})
+
+	t.Run("introspect and refresh", func(t *testing.T) {
+		token := login(t, srv)
+		caller := loginAs(t, srv, "api")
+		var active introspection
+		recorder := request(srv, "POST", "/introspect", caller, "application/x-www-form-urlencoded", "token="+token)
+		json.NewDecoder(recorder.Body).Decode(&active)
+		if !active.Active || active.Subject != "1" || active.Username != "alice" {
+			t.Fatalf("token should be active: %+v", active)
+		}
+
+		if code := request(srv, "POST", "/introspect", "", "application/x-www-form-urlencoded", "token="+token).Code; code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401 because the caller is not authenticated: %d", code)
+		}
+
+		if code := request(srv, "POST", "/introspect", token, "application/x-www-form-urlencoded", "token="+token).Code; code != http.StatusForbidden {
+			t.Fatalf("status should be 403 because the caller may not introspect tokens: %d", code)
+		}
+
+		recorder = request(srv, "POST", "/refresh", token, "", "")
+		var refreshed tokenResponse
+		if recorder.Code != http.StatusOK || json.NewDecoder(recorder.Body).Decode(&refreshed) != nil || refreshed.AccessToken == token {
+			t.Fatalf("token should be refreshed: %d", recorder.Code)
+		}
+
+		if code := request(srv, "POST", "/refresh", "invalid", "", "").Code; code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401 because of the invalid token: %d", code)
+		}
+
+		var inactive introspection
+		recorder = request(srv, "POST", "/introspect", caller, "application/x-www-form-urlencoded", "token=invalid")
+		json.NewDecoder(recorder.Body).Decode(&inactive)
+		if inactive.Active || inactive.Subject != "" {
+			t.Fatalf("invalid token should be inactive: %+v", inactive)
+		}
+	})
+
+	t.Run("authorize", func(t *testing.T) {
+		token := login(t, srv)
+		if code := request(srv, "POST", "/authorize", token, "application/json", `{"action": "GET", "object": "posts/1"}`).Code; code != http.StatusOK {
+			t.Fatalf("status should be 200 because of the abilities: %d", code)
+		}
+
+		if code := request(srv, "POST", "/authorize", token, "application/json", `{"action": "DELETE", "object": "posts/1"}`).Code; code != http.StatusForbidden {
+			t.Fatalf("status should be 403 because of the missing ability: %d", code)
+		}
+
+		if code := request(srv, "POST", "/authorize", "", "application/json", `{"action": "GET", "object": "posts/1"}`).Code; code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401 because of the missing token: %d", code)
+		}
+	})
+
+	t.Run("ext_authz", func(t *testing.T) {
+		token := login(t, srv)
+		recorder := request(srv, "GET", "/ext_authz/posts/1", token, "", "")
+		if recorder.Code != http.StatusOK || recorder.Header().Get("X-Auth-Username") != "alice" {
+			t.Fatalf("proxied request should be authorized: %d", recorder.Code)
+		}
+
+		if code := request(srv, "DELETE", "/ext_authz/posts/1", token, "", "").Code; code != http.StatusForbidden {
+			t.Fatalf("status should be 403 because of the missing ability: %d", code)
+		}
+	})
+
+	t.Run("jwks", func(t *testing.T) {
+		if code := request(srv, "GET", "/.well-known/jwks.json", "", "", "").Code; code != http.StatusNotFound {
+			t.Fatalf("status should be 404 because HMAC keys are never published: %d", code)
+		}
+	})
+}
+
+func TestServerECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	srv, cleanup := testServer(t, `{"algorithm": "ES256", "key_file": "key.pem", "key_id": "k1"}`, map[string]string{"key.pem": keyFile})
+	defer cleanup()
+
+	token := login(t, srv)
+	if code := request(srv, "POST", "/authorize", token, "application/json", `{"action": "GET", "object": "posts/1"}`).Code; code != http.StatusOK {
+		t.Fatalf("status should be 200 because of the abilities: %d", code)
+	}
+
+	recorder := request(srv, "GET", "/.well-known/jwks.json", "", "", "")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"kid":"k1"`) {
+		t.Fatalf("verification key should be published: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	dir := writeFiles(t, map[string]string{"key.pem": keyFile, "gated.json": `{"jwt": {"algorithm": "ES384", "key_file": "key.pem"}}`})
+	defer os.RemoveAll(dir)
+
+	cfg, _ := loadConfig(filepath.Join(dir, "gated.json"))
+	if _, err = newServer(cfg, ioutil.Discard); err == nil {
+		t.Fatal("err should not be nil because the key does not match the algorithm")
+	}
+}
+
+func TestProxyConfig(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"gated.json": `{"jwt": {"secret": "secret"}, "proxy": "haproxy"}`})
+	defer os.RemoveAll(dir)
+
+	if _, err := loadConfig(filepath.Join(dir, "gated.json")); err == nil {
+		t.Fatal("err should not be nil because of the unknown proxy")
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	var out bytes.Buffer
+	if code := run([]string{"hash"}, strings.NewReader("secret\n"), &out, ioutil.Discard); code != 0 {
+		t.Fatalf("code should be 0: %d", code)
+	}
+
+	store, err := newCredentialStore(map[string]string{"alice": strings.TrimSpace(out.String())})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	if !store.Verify("alice", "secret") || store.Verify("alice", "wrong") || store.Verify("bob", "secret") {
+		t.Fatal("only the password of the user should be verified")
+	}
+
+	if _, err = newCredentialStore(map[string]string{"alice": "md5$secret"}); err == nil {
+		t.Fatal("err should not be nil because of the unsupported scheme")
+	}
+}
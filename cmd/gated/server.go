@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/middleware"
+	"github.com/hiendv/gate/password"
+)
+
+// externalAuthPrefix is the path prefix of the external authorization of proxies, e.g. the path_prefix of Envoy ext_authz
+const externalAuthPrefix = "/ext_authz"
+
+// maxBodySize limits the request bodies
+const maxBodySize = 1 << 16
+
+// introspectAction and introspectObject are the ability of the callers of the introspection, e.g. the resource servers
+const (
+	introspectAction = "introspect"
+	introspectObject = "tokens"
+)
+
+// tokenResponse is the response of the login and the refresh, see RFC 6749
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// introspection is the response of the introspection, see RFC 7662. Inactive tokens carry no other member
+type introspection struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+}
+
+// authorization is the body of an authorization
+type authorization struct {
+	Action string `json:"action"`
+	Object string `json:"object"`
+}
+
+// decision is the response of an authorization
+type decision struct {
+	Allowed bool `json:"allowed"`
+}
+
+// server is the HTTP API of gated
+//
+//	POST /login                              exchanges a username and a password for a token
+//	POST /refresh                            exchanges a bearer token for a new token. The previous token is valid until it expires
+//	POST /introspect                         reports whether the token of the form is active to the callers whose bearer token is
+//	                                         authorized to introspect tokens, see RFC 7662
+//	POST /authorize                          authorizes the bearer token to take the action on the object of the body
+//	*    /ext_authz/...                      authorizes proxied requests, see middleware.ExternalAuth
+//	GET  /.well-known/jwks.json              publishes the verification key of RSA and ECDSA algorithms
+//	GET  /.well-known/openid-configuration   publishes the discovery metadata of RSA and ECDSA algorithms
+type server struct {
+	driver    *password.Driver
+	discovery http.Handler
+	responder middleware.Responder
+	external  http.Handler
+}
+
+func (srv server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/.well-known/") {
+		if srv.discovery == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		srv.discovery.ServeHTTP(w, r)
+		return
+	}
+
+	if r.URL.Path == externalAuthPrefix || strings.HasPrefix(r.URL.Path, externalAuthPrefix+"/") {
+		srv.external.ServeHTTP(w, r)
+		return
+	}
+
+	routes := map[string]http.HandlerFunc{
+		"/login":      srv.login,
+		"/refresh":    srv.refresh,
+		"/introspect": srv.introspect,
+		"/authorize":  srv.authorize,
+	}
+
+	route, ok := routes[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	w.Header().Set("Cache-Control", "no-store")
+	route(w, r)
+}
+
+// values returns the values of a JSON object or a form body
+func values(r *http.Request) (map[string]string, error) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType == "application/json" {
+		result := map[string]string{}
+		err := json.NewDecoder(r.Body).Decode(&result)
+		return result, err
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+	for key := range r.PostForm {
+		result[key] = r.PostForm.Get(key)
+	}
+	return result, nil
+}
+
+func (srv server) login(w http.ResponseWriter, r *http.Request) {
+	credentials, err := values(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	user, err := srv.driver.Login(credentials)
+	if err != nil {
+		srv.responder.Respond(w, r, err)
+		return
+	}
+
+	srv.issue(w, user)
+}
+
+func (srv server) refresh(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := middleware.BearerExtractor().ExtractToken(r)
+	if err != nil {
+		srv.responder.Respond(w, r, err)
+		return
+	}
+
+	authz, err := srv.driver.NewAuthzContext(tokenString, "")
+	if err != nil {
+		srv.responder.Respond(w, r, err)
+		return
+	}
+
+	srv.issue(w, authz.User)
+}
+
+func (srv server) issue(w http.ResponseWriter, user gate.User) {
+	token, err := srv.driver.IssueJWT(user)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenResponse{token.Value, "Bearer", int64(token.ExpiredAt.Sub(token.IssuedAt) / time.Second)})
+}
+
+func (srv server) introspect(w http.ResponseWriter, r *http.Request) {
+	callerToken, err := middleware.BearerExtractor().ExtractToken(r)
+	if err == nil {
+		_, err = srv.driver.AuthorizeToken(callerToken, introspectAction, introspectObject)
+	}
+
+	if err != nil {
+		srv.responder.Respond(w, r, err)
+		return
+	}
+
+	form, err := values(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var result introspection
+	authz, err := srv.driver.NewAuthzContext(form["token"], "")
+	if err == nil {
+		token := authz.Token
+		result = introspection{
+			Active:    true,
+			TokenType: "Bearer",
+			ID:        token.ID,
+			Subject:   token.UserID,
+			Username:  token.User.Username,
+			Roles:     token.User.Roles,
+			ExpiresAt: token.ExpiredAt.Unix(),
+			IssuedAt:  token.IssuedAt.Unix(),
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (srv server) authorize(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := middleware.BearerExtractor().ExtractToken(r)
+	if err != nil {
+		srv.responder.Respond(w, r, err)
+		return
+	}
+
+	var body authorization
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil || body.Action == "" || body.Object == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	_, err = srv.driver.AuthorizeToken(tokenString, body.Action, body.Object)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, decision{true})
+	case gate.IsAuthorizationError(err):
+		writeJSON(w, http.StatusForbidden, decision{false})
+	default:
+		srv.responder.Respond(w, r, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,8 @@
+package gate
+
+// TokenCodec encodes claims into token strings and decodes token strings back into claims.
+// Decode must verify the integrity of the token, JWTService validates the decoded claims afterwards
+type TokenCodec interface {
+	Encode(JWTClaims) (string, error)
+	Decode(string) (JWTClaims, error)
+}
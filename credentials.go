@@ -0,0 +1,152 @@
+package gate
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// CredentialField is a login credential declared by a CredentialSpec
+type CredentialField struct {
+	Name     string
+	Required bool
+	// Secret keeps the field out of the source metadata of login attempts, e.g. a captcha token
+	Secret bool
+	// Normalize normalizes the value of the field when it is given, before the validation
+	Normalize Normalizer
+	// Validate validates the value of the field when it is given
+	Validate func(string) error
+}
+
+// CredentialSpec is the schema of login credentials, i.e. the username and password fields along with additional fields,
+// e.g. an email, a tenant, a captcha token or a remember-me flag. Credentials which are not declared are kept as they are
+type CredentialSpec struct {
+	// UsernameField is the name of the username field, "username" by default
+	UsernameField string
+	// PasswordField is the name of the password field, "password" by default
+	PasswordField string
+	// NormalizeUsername normalizes the username before the login handler runs, e.g. ChainNormalizers(TrimSpace, LowercaseEmail).
+	// Passwords are never normalized
+	NormalizeUsername Normalizer
+	Fields            []CredentialField
+}
+
+// Credentials are login credentials parsed with a CredentialSpec
+type Credentials struct {
+	Username string
+	Password string
+	// Values are the credentials other than the username and the password
+	Values map[string]string
+}
+
+// Get returns the value of a credential other than the username and the password
+func (credentials Credentials) Get(name string) string {
+	return credentials.Values[name]
+}
+
+// Bool returns the value of a credential as a boolean, e.g. a remember-me flag. Missing and invalid values are false
+func (credentials Credentials) Bool(name string) bool {
+	value, err := strconv.ParseBool(credentials.Values[name])
+	return err == nil && value
+}
+
+func (spec CredentialSpec) usernameField() string {
+	if spec.UsernameField == "" {
+		return "username"
+	}
+
+	return spec.UsernameField
+}
+
+func (spec CredentialSpec) passwordField() string {
+	if spec.PasswordField == "" {
+		return "password"
+	}
+
+	return spec.PasswordField
+}
+
+// Username returns the normalized username of raw credentials, even if they are invalid
+func (spec CredentialSpec) Username(values map[string]string) string {
+	username := values[spec.usernameField()]
+	if spec.NormalizeUsername != nil {
+		username = spec.NormalizeUsername(username)
+	}
+
+	return username
+}
+
+// Source returns the raw credentials other than the username, the password and secret fields, i.e. the source metadata of a login attempt
+func (spec CredentialSpec) Source(values map[string]string) map[string]string {
+	source := map[string]string{}
+	for name, value := range values {
+		if name != spec.usernameField() && name != spec.passwordField() {
+			source[name] = value
+		}
+	}
+
+	for _, field := range spec.Fields {
+		if field.Secret {
+			delete(source, field.Name)
+		}
+	}
+
+	return source
+}
+
+// Parse validates raw credentials against the spec and returns the typed credentials
+func (spec CredentialSpec) Parse(values map[string]string) (credentials Credentials, err error) {
+	usernameField, passwordField := spec.usernameField(), spec.passwordField()
+	username, ok := values[usernameField]
+	if !ok {
+		err = errors.New("missing " + usernameField)
+		return
+	}
+
+	password, ok := values[passwordField]
+	if !ok {
+		err = errors.New("missing " + passwordField)
+		return
+	}
+
+	if spec.NormalizeUsername != nil {
+		username = spec.NormalizeUsername(username)
+	}
+
+	normalized := map[string]string{}
+	for _, field := range spec.Fields {
+		value, ok := values[field.Name]
+		if !ok {
+			if field.Required {
+				err = errors.New("missing " + field.Name)
+				return
+			}
+
+			continue
+		}
+
+		if field.Normalize != nil {
+			value = field.Normalize(value)
+			normalized[field.Name] = value
+		}
+
+		if field.Validate != nil {
+			if validateErr := field.Validate(value); validateErr != nil {
+				err = errors.Wrap(validateErr, "invalid "+field.Name)
+				return
+			}
+		}
+	}
+
+	credentials = Credentials{Username: username, Password: password, Values: map[string]string{}}
+	for name, value := range values {
+		if name != usernameField && name != passwordField {
+			credentials.Values[name] = value
+		}
+	}
+
+	for name, value := range normalized {
+		credentials.Values[name] = value
+	}
+	return
+}
@@ -0,0 +1,121 @@
+package gate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCredentialSpec(t *testing.T) {
+	spec := CredentialSpec{
+		UsernameField: "email",
+		Fields: []CredentialField{
+			{Name: "tenant", Required: true},
+			{Name: "captcha", Secret: true, Validate: func(value string) error {
+				if value != "solved" {
+					return errors.New("unsolved captcha")
+				}
+
+				return nil
+			}},
+			{Name: "remember"},
+		},
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		values := map[string]string{"email": "foo@example.com", "password": "bar", "tenant": "acme", "captcha": "solved", "remember": "true", "ip": "127.0.0.1"}
+		credentials, err := spec.Parse(values)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid credentials: %s", err)
+		}
+
+		if credentials.Username != "foo@example.com" || credentials.Password != "bar" || credentials.Get("tenant") != "acme" || !credentials.Bool("remember") {
+			t.Fatalf("credentials should be parsed: %v", credentials)
+		}
+
+		source := spec.Source(values)
+		if len(source) != 3 || source["ip"] != "127.0.0.1" || source["captcha"] != "" {
+			t.Fatalf("source should exclude the username, the password and secret fields: %v", source)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		inputs := map[string]map[string]string{
+			"missing email":    {"password": "bar", "tenant": "acme"},
+			"missing password": {"email": "foo@example.com", "tenant": "acme"},
+			"missing tenant":   {"email": "foo@example.com", "password": "bar"},
+			"invalid captcha":  {"email": "foo@example.com", "password": "bar", "tenant": "acme", "captcha": "robot"},
+		}
+
+		for message, values := range inputs {
+			_, err := spec.Parse(values)
+			if err == nil || !strings.Contains(err.Error(), message) {
+				t.Fatalf("err should be %q: %v", message, err)
+			}
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		credentials, err := CredentialSpec{}.Parse(map[string]string{"username": "foo", "password": "bar"})
+		if err != nil || credentials.Username != "foo" || credentials.Bool("remember") {
+			t.Fatalf("username and password should be required only: %v %v", credentials, err)
+		}
+	})
+
+	t.Run("normalized", func(t *testing.T) {
+		normalized := CredentialSpec{
+			NormalizeUsername: ChainNormalizers(NFKC, LowercaseEmail),
+			Fields: []CredentialField{
+				{Name: "phone", Normalize: PhoneNumber("84"), Validate: func(value string) error {
+					if !strings.HasPrefix(value, "+") {
+						return errors.New("not E.164")
+					}
+
+					return nil
+				}},
+			},
+		}
+
+		values := map[string]string{"username": " Foo@Example.COM ", "password": " Bar ", "phone": "(028) 3822-1234"}
+		credentials, err := normalized.Parse(values)
+		if err != nil {
+			t.Fatalf("err should be nil because the phone is normalized before the validation: %s", err)
+		}
+
+		if credentials.Username != "foo@example.com" || credentials.Password != " Bar " || credentials.Get("phone") != "+842838221234" {
+			t.Fatalf("credentials should be normalized except the password: %v", credentials)
+		}
+
+		if username := normalized.Username(map[string]string{"username": "ＦＯＯ@example.com"}); username != "foo@example.com" {
+			t.Fatalf("raw username should be normalized: %s", username)
+		}
+	})
+}
+
+func TestNormalizers(t *testing.T) {
+	cases := []struct {
+		normalizer Normalizer
+		input      string
+		expected   string
+	}{
+		{TrimSpace, " foo\t", "foo"},
+		{LowercaseEmail, "Foo@Example.com", "foo@example.com"},
+		{NFKC, "ｆｏｏ\u3000ｂａｒ１", "foo bar1"},
+		{NFKC, "\ufb01le", "file"},
+		{NFKC, "cafe\u0301", "caf\u00e9"},
+		{NFC, "cafe\u0301", "caf\u00e9"},
+		{NFC, "ｆｏｏ", "ｆｏｏ"},
+		{PhoneNumber("84"), "0283 822 1234", "+842838221234"},
+		{PhoneNumber("84"), "+1 (555) 010-0000", "+15550100000"},
+		{PhoneNumber("84"), "0044 20 7946 0000", "+442079460000"},
+		{PhoneNumber(""), "020 7946 0000", "02079460000"},
+		{PhoneNumber("84"), "foo@example.com", "foo@example.com"},
+		{ChainNormalizers(TrimSpace, nil, strings.ToUpper), " foo ", "FOO"},
+	}
+
+	for _, c := range cases {
+		if output := c.normalizer(c.input); output != c.expected {
+			t.Fatalf("%q should be normalized to %q: %q", c.input, c.expected, output)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package gate
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDecisionCacheSize is the default maximum number of entries of a decision cache
+const DefaultDecisionCacheSize = 10000
+
+type decisionEntry struct {
+	userID    string
+	roleIDs   []string
+	err       error
+	expiredAt time.Time
+}
+
+// DecisionCache memoizes authorization decisions per user, action and object.
+// Entries are invalidated by TTL or explicitly whenever the user's roles or one of the roles change.
+// Expired entries are purged once the cache is full, new decisions are not cached while the cache is full of unexpired entries
+type DecisionCache struct {
+	ttl     time.Duration
+	size    int
+	entries map[string]decisionEntry
+	Now     func() time.Time
+	*sync.RWMutex
+}
+
+func decisionKey(tenant string, user User, action, object string) string {
+	parts := []string{user.GetID(), tenant, roleSetKey(TenantRoles(user, tenant)), action, object}
+	if scoped, ok := user.(Scoped); ok {
+		for _, scope := range scoped.GetScopes() {
+			parts = append(parts, scope.GetAction()+"\x00"+scope.GetObject())
+		}
+	}
+
+	return strings.Join(parts, "\x01")
+}
+
+// Enabled reports whether the cache is enabled. A cache with a non-positive TTL is disabled
+func (cache DecisionCache) Enabled() bool {
+	return cache.ttl > 0 && cache.RWMutex != nil
+}
+
+// Get returns the cached decision of a user taking an action on an object. A nil error is an allowing decision
+func (cache DecisionCache) Get(user User, action, object string) (decision error, ok bool) {
+	return cache.GetInTenant("", user, action, object)
+}
+
+// GetInTenant returns the cached decision of a user taking an action on an object in a tenant
+func (cache DecisionCache) GetInTenant(tenant string, user User, action, object string) (decision error, ok bool) {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.RLock()
+	defer cache.RUnlock()
+
+	entry, ok := cache.entries[decisionKey(tenant, user, action, object)]
+	if !ok {
+		return
+	}
+
+	if !cache.Now().Before(entry.expiredAt) {
+		ok = false
+		return
+	}
+
+	decision = entry.err
+	return
+}
+
+// Set caches the decision of a user taking an action on an object. Only allowing decisions and authorization errors are cached
+func (cache DecisionCache) Set(user User, action, object string, decision error) {
+	cache.SetUntil(user, action, object, decision, time.Time{})
+}
+
+// SetUntil caches the decision of a user taking an action on an object no longer than the given time,
+// e.g. the next transition of the validity window of a role. A zero time only applies the TTL
+func (cache DecisionCache) SetUntil(user User, action, object string, decision error, until time.Time) {
+	cache.SetInTenantUntil("", user, action, object, decision, until)
+}
+
+// SetInTenantUntil caches the decision of a user taking an action on an object in a tenant no longer than the given time.
+// The decision is invalidated with the roles of the user in the tenant
+func (cache DecisionCache) SetInTenantUntil(tenant string, user User, action, object string, decision error, until time.Time) {
+	if !cache.Enabled() || (decision != nil && !IsAuthorizationError(decision)) {
+		return
+	}
+
+	expiredAt := cache.Now().Add(cache.ttl)
+	if !until.IsZero() && until.Before(expiredAt) {
+		expiredAt = until
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	key := decisionKey(tenant, user, action, object)
+	if _, ok := cache.entries[key]; !ok && len(cache.entries) >= cache.size {
+		now := cache.Now()
+		for key, entry := range cache.entries {
+			if !now.Before(entry.expiredAt) {
+				delete(cache.entries, key)
+			}
+		}
+
+		if len(cache.entries) >= cache.size {
+			return
+		}
+	}
+
+	roles := TenantRoles(user, tenant)
+	roleIDs := make([]string, len(roles))
+	copy(roleIDs, roles)
+	cache.entries[key] = decisionEntry{user.GetID(), roleIDs, decision, expiredAt}
+}
+
+// InvalidateUser removes every cached decision of the given users
+func (cache DecisionCache) InvalidateUser(userIDs ...string) {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	for key, entry := range cache.entries {
+		if containsAny([]string{entry.userID}, userIDs) {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// InvalidateRoles removes every cached decision of users having one of the given roles
+func (cache DecisionCache) InvalidateRoles(roleIDs ...string) {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	for key, entry := range cache.entries {
+		if containsAny(entry.roleIDs, roleIDs) {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// Flush removes every cached decision, e.g. after a change on an external policy
+func (cache DecisionCache) Flush() {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	for key := range cache.entries {
+		delete(cache.entries, key)
+	}
+}
+
+// NewDecisionCache is the constructor for DecisionCache. A non-positive TTL disables the cache, a non-positive size means DefaultDecisionCacheSize
+func NewDecisionCache(ttl time.Duration, size int) DecisionCache {
+	if size <= 0 {
+		size = DefaultDecisionCacheSize
+	}
+
+	return DecisionCache{
+		ttl:     ttl,
+		size:    size,
+		entries: map[string]decisionEntry{},
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+		RWMutex: &sync.RWMutex{},
+	}
+}
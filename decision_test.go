@@ -0,0 +1,166 @@
+package gate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type tenantUser struct {
+	testUser
+	tenants map[string][]string
+}
+
+func (user tenantUser) GetTenantRoles(tenant string) []string {
+	return user.tenants[tenant]
+}
+
+func TestDecisionCache(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	cache := NewDecisionCache(time.Minute, 0)
+	cache.Now = func() time.Time {
+		return now
+	}
+
+	alice := testUser{ID: "1", Roles: []string{"editor", "viewer"}}
+	bob := testUser{ID: "2", Roles: []string{"viewer"}}
+
+	t.Run("decisions", func(t *testing.T) {
+		cache.Set(alice, "GET", "/posts", nil)
+		cache.Set(alice, "DELETE", "/posts", ErrForbidden)
+
+		decision, ok := cache.Get(alice, "GET", "/posts")
+		if !ok || decision != nil {
+			t.Fatalf("allowing decision should be cached: %v %v", ok, decision)
+		}
+
+		decision, ok = cache.Get(alice, "DELETE", "/posts")
+		if !ok || decision != ErrForbidden {
+			t.Fatalf("denying decision should be cached: %v %v", ok, decision)
+		}
+
+		if _, ok = cache.Get(testUser{ID: "1", Roles: []string{"viewer"}}, "GET", "/posts"); ok {
+			t.Fatal("decisions should depend on the roles of the user")
+		}
+	})
+
+	t.Run("tenants", func(t *testing.T) {
+		member := tenantUser{testUser{ID: "3", Roles: []string{"viewer"}}, map[string][]string{"acme": {"admin"}}}
+		cache.SetInTenantUntil("acme", member, "DELETE", "/posts", nil, time.Time{})
+		if _, ok := cache.GetInTenant("other", member, "DELETE", "/posts"); ok {
+			t.Fatal("decisions should depend on the tenant")
+		}
+
+		if _, ok := cache.Get(member, "DELETE", "/posts"); ok {
+			t.Fatal("decisions in a tenant should not be reused without a tenant")
+		}
+
+		cache.InvalidateRoles("admin")
+		if _, ok := cache.GetInTenant("acme", member, "DELETE", "/posts"); ok {
+			t.Fatal("decisions should be invalidated with the roles of the user in the tenant")
+		}
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		cache.Set(alice, "PUT", "/posts", errors.New("role service is down"))
+		if _, ok := cache.Get(alice, "PUT", "/posts"); ok {
+			t.Fatal("failures should not be cached")
+		}
+	})
+
+	t.Run("invalidate user", func(t *testing.T) {
+		cache.Set(alice, "GET", "/posts", nil)
+		cache.Set(bob, "GET", "/posts", nil)
+		cache.InvalidateUser("1")
+
+		if _, ok := cache.Get(alice, "GET", "/posts"); ok {
+			t.Fatal("decisions of the invalidated user should be removed")
+		}
+
+		if _, ok := cache.Get(bob, "GET", "/posts"); !ok {
+			t.Fatal("decisions of other users should be kept")
+		}
+	})
+
+	t.Run("invalidate roles", func(t *testing.T) {
+		cache.Set(alice, "GET", "/posts", nil)
+		cache.Set(bob, "GET", "/posts", nil)
+		cache.InvalidateRoles("editor")
+
+		if _, ok := cache.Get(alice, "GET", "/posts"); ok {
+			t.Fatal("decisions of users with the invalidated role should be removed")
+		}
+
+		if _, ok := cache.Get(bob, "GET", "/posts"); !ok {
+			t.Fatal("decisions of other users should be kept")
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		cache.Set(alice, "GET", "/posts", nil)
+		now = now.Add(time.Minute)
+		if _, ok := cache.Get(alice, "GET", "/posts"); ok {
+			t.Fatal("expired entries should be ignored")
+		}
+	})
+
+	t.Run("until", func(t *testing.T) {
+		cache.SetUntil(alice, "GET", "/posts", nil, now.Add(time.Second))
+		if _, ok := cache.Get(alice, "GET", "/posts"); !ok {
+			t.Fatal("decision should be cached until the given time")
+		}
+
+		now = now.Add(time.Second)
+		if _, ok := cache.Get(alice, "GET", "/posts"); ok {
+			t.Fatal("decision should expire at the given time before the TTL")
+		}
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		cache.Set(bob, "GET", "/posts", nil)
+		cache.Flush()
+		if _, ok := cache.Get(bob, "GET", "/posts"); ok {
+			t.Fatal("flushed entries should be removed")
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		bounded := NewDecisionCache(time.Minute, 2)
+		bounded.Now = cache.Now
+		bounded.Set(alice, "GET", "/posts/1", nil)
+		bounded.Set(alice, "GET", "/posts/2", nil)
+		bounded.Set(alice, "GET", "/posts/3", nil)
+		if _, ok := bounded.Get(alice, "GET", "/posts/3"); ok {
+			t.Fatal("decisions should not be cached while the cache is full")
+		}
+
+		bounded.Set(alice, "GET", "/posts/1", ErrForbidden)
+		if decision, ok := bounded.Get(alice, "GET", "/posts/1"); !ok || decision != ErrForbidden {
+			t.Fatalf("cached decisions should be updated while the cache is full: %v %v", ok, decision)
+		}
+
+		later := now.Add(time.Hour)
+		bounded.Now = func() time.Time {
+			return later
+		}
+
+		bounded.Set(alice, "GET", "/posts/3", nil)
+		if _, ok := bounded.Get(alice, "GET", "/posts/3"); !ok || len(bounded.entries) != 1 {
+			t.Fatalf("expired decisions should be purged once the cache is full: %d", len(bounded.entries))
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := NewDecisionCache(0, 0)
+		disabled.Set(alice, "GET", "/posts", nil)
+		if _, ok := disabled.Get(alice, "GET", "/posts"); ok {
+			t.Fatal("disabled cache should not cache anything")
+		}
+
+		var zero DecisionCache
+		zero.Set(alice, "GET", "/posts", nil)
+		if _, ok := zero.Get(alice, "GET", "/posts"); ok {
+			t.Fatal("zero cache should not cache anything")
+		}
+	})
+}
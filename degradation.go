@@ -0,0 +1,129 @@
+package gate
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FallbackPolicy is the policy applied to authorization when the role service is unavailable
+type FallbackPolicy int
+
+// Fallback policies
+const (
+	// FallbackDenyAll fails every authorization requiring the role service
+	FallbackDenyAll FallbackPolicy = iota
+	// FallbackAllowCached uses the last cached abilities of a role set, even if they are expired
+	FallbackAllowCached
+	// FallbackAllowListed allows the configured fallback actions only
+	FallbackAllowListed
+)
+
+// ErrRoleServiceUnavailable is thrown when the role service fails or its circuit breaker is open
+var ErrRoleServiceUnavailable = errors.New("role service is unavailable")
+
+// ErrCircuitOpen is thrown when a call is rejected by an open circuit breaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type circuitState struct {
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// CircuitBreaker stops calling a failing service after consecutive failures.
+// Once the cooldown has elapsed, a single call is let through to probe the service and closes the circuit on success
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	state     *circuitState
+	Now       func() time.Time
+	*sync.Mutex
+}
+
+// Enabled reports whether the circuit breaker is enabled. A circuit breaker with a non-positive threshold is disabled
+func (breaker CircuitBreaker) Enabled() bool {
+	return breaker.threshold > 0 && breaker.Mutex != nil
+}
+
+// Open reports whether the circuit is open, i.e. calls are rejected
+func (breaker CircuitBreaker) Open() bool {
+	if !breaker.Enabled() {
+		return false
+	}
+
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	return breaker.state.failures >= breaker.threshold
+}
+
+// Allow reports whether a call may be made. When the cooldown has elapsed, only the first caller is allowed to probe the service
+func (breaker CircuitBreaker) Allow() bool {
+	if !breaker.Enabled() {
+		return true
+	}
+
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	state := breaker.state
+	if state.failures < breaker.threshold {
+		return true
+	}
+
+	if state.probing || breaker.Now().Before(state.openedAt.Add(breaker.cooldown)) {
+		return false
+	}
+
+	state.probing = true
+	return true
+}
+
+// Record records the result of a call. Failures open the circuit once they reach the threshold, a success closes it
+func (breaker CircuitBreaker) Record(err error) {
+	if !breaker.Enabled() {
+		return
+	}
+
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	state := breaker.state
+	state.probing = false
+	if err == nil {
+		state.failures = 0
+		return
+	}
+
+	state.failures++
+	if state.failures >= breaker.threshold {
+		state.openedAt = breaker.Now()
+	}
+}
+
+// Call calls a function unless the circuit is open and records its result
+func (breaker CircuitBreaker) Call(fn func() error) (err error) {
+	if !breaker.Allow() {
+		err = ErrCircuitOpen
+		return
+	}
+
+	err = fn()
+	breaker.Record(err)
+	return
+}
+
+// NewCircuitBreaker is the constructor for CircuitBreaker. A non-positive threshold disables the circuit breaker
+func NewCircuitBreaker(threshold int, cooldown time.Duration) CircuitBreaker {
+	return CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     &circuitState{},
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+		Mutex: &sync.Mutex{},
+	}
+}
@@ -0,0 +1,59 @@
+package gate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.Now = func() time.Time {
+		return now
+	}
+
+	failure := errors.New("connection refused")
+	calls := 0
+	fail := func() error {
+		calls++
+		return failure
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := breaker.Call(fail); err != failure {
+			t.Fatalf("err should be the failure of the call: %v", err)
+		}
+	}
+
+	if !breaker.Open() {
+		t.Fatal("circuit should be open because of the consecutive failures")
+	}
+
+	if err := breaker.Call(fail); err != ErrCircuitOpen || calls != 2 {
+		t.Fatalf("call should be rejected because of the open circuit: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.Allow() {
+		t.Fatal("probe should be allowed after the cooldown")
+	}
+
+	if breaker.Allow() {
+		t.Fatal("only a single probe should be allowed")
+	}
+
+	breaker.Record(nil)
+	if breaker.Open() {
+		t.Fatal("circuit should be closed because of the successful probe")
+	}
+
+	disabled := NewCircuitBreaker(0, time.Minute)
+	for i := 0; i < 3; i++ {
+		disabled.Call(fail)
+	}
+
+	if disabled.Open() || !disabled.Allow() {
+		t.Fatal("disabled circuit breaker should never open")
+	}
+}
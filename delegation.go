@@ -0,0 +1,123 @@
+package gate
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidScope is thrown when a scope requested for a derived token is not an action on an object with "*" wildcards only,
+// e.g. a regular expression which would widen the token once matched as a pattern
+var ErrInvalidScope = errors.New("invalid scope")
+
+// Actor is the RFC 8693 actor claim identifying the party acting on behalf of the subject.
+// Nested actors record the whole delegation chain, the outermost actor being the current one
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// Chain returns the subjects of the delegation chain from the current actor to the first one
+func (actor *Actor) Chain() (subjects []string) {
+	for current := actor; current != nil; current = current.Actor {
+		subjects = append(subjects, current.Subject)
+	}
+
+	return
+}
+
+// AbilityClaim is an ability embedded in token claims, e.g. the reduced abilities of a delegated token
+type AbilityClaim struct {
+	Action string `json:"action"`
+	Object string `json:"object"`
+}
+
+// GetAction returns the action of the ability
+func (ability AbilityClaim) GetAction() string {
+	return ability.Action
+}
+
+// GetObject returns the object of the ability
+func (ability AbilityClaim) GetObject() string {
+	return ability.Object
+}
+
+// AbilityCheck is an action on an object, e.g. a scope requested for a down-scoped token
+type AbilityCheck struct {
+	Action string
+	Object string
+}
+
+// GetAction returns the action of the check
+func (check AbilityCheck) GetAction() string {
+	return check.Action
+}
+
+// GetObject returns the object of the check
+func (check AbilityCheck) GetObject() string {
+	return check.Object
+}
+
+// ValidateScope checks that a scope requested for a derived token is an action on an object with "*" as the only wildcard
+func ValidateScope(scope UserAbility) error {
+	for _, value := range []string{scope.GetAction(), scope.GetObject()} {
+		literal := strings.Replace(value, "*", "", -1)
+		if value == "" || regexp.QuoteMeta(literal) != literal {
+			return errors.WithMessage(ErrInvalidScope, value)
+		}
+	}
+
+	return nil
+}
+
+// NewAbilityClaims converts abilities to ability claims
+func NewAbilityClaims(abilities []UserAbility) (claims []AbilityClaim) {
+	for _, ability := range abilities {
+		claims = append(claims, AbilityClaim{ability.GetAction(), ability.GetObject()})
+	}
+
+	return
+}
+
+// Scoped is the optional contract for users restricted to a subset of their abilities, e.g. users of delegated tokens.
+// An action is only granted if both the scopes and the abilities of the user grant it
+type Scoped interface {
+	GetScopes() []UserAbility
+}
+
+// ScopeChained is the optional contract for scoped users whose token is derived from other scoped tokens.
+// An action is only granted if the scopes of every token of the chain grant it as well
+type ScopeChained interface {
+	GetScopeChain() [][]UserAbility
+}
+
+// DelegatedUser is the user authenticated with a delegated or down-scoped token
+type DelegatedUser struct {
+	User
+	Actor      *Actor
+	Abilities  []AbilityClaim
+	ScopeChain [][]AbilityClaim
+}
+
+// GetScopes returns the abilities the token is restricted to
+func (user DelegatedUser) GetScopes() (scopes []UserAbility) {
+	for _, ability := range user.Abilities {
+		scopes = append(scopes, ability)
+	}
+
+	return
+}
+
+// GetScopeChain returns the abilities of the tokens the token is derived from
+func (user DelegatedUser) GetScopeChain() (chain [][]UserAbility) {
+	for _, abilities := range user.ScopeChain {
+		scopes := make([]UserAbility, 0, len(abilities))
+		for _, ability := range abilities {
+			scopes = append(scopes, ability)
+		}
+		chain = append(chain, scopes)
+	}
+
+	return
+}
@@ -0,0 +1,53 @@
+package gate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDelegation(t *testing.T) {
+	t.Run("chain", func(t *testing.T) {
+		actor := &Actor{Subject: "billing", Actor: &Actor{Subject: "gateway"}}
+		if chain := actor.Chain(); !reflect.DeepEqual(chain, []string{"billing", "gateway"}) {
+			t.Fatalf("the chain should start with the current actor: %v", chain)
+		}
+
+		var none *Actor
+		if len(none.Chain()) != 0 {
+			t.Fatal("the chain of no actor should be empty")
+		}
+	})
+
+	t.Run("claims", func(t *testing.T) {
+		service, _ := newTestJWTService(t)
+		claims := service.NewClaims(testUser{ID: "1", Username: "alice"})
+		claims.Actor = &Actor{Subject: "billing", Actor: &Actor{Subject: "gateway"}}
+		claims.Abilities = NewAbilityClaims([]UserAbility{testAbility{"GET", "invoices"}})
+
+		token, err := service.Issue(claims)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		parsed, err := service.Parse(token.Value)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid token: %s", err)
+		}
+
+		if !reflect.DeepEqual(parsed.Actor, claims.Actor) || !reflect.DeepEqual(parsed.Abilities, claims.Abilities) {
+			t.Fatalf("the delegation should be parsed: %v %v", parsed.Actor, parsed.Abilities)
+		}
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		user := DelegatedUser{User: testUser{ID: "1"}, Abilities: []AbilityClaim{{"GET", "invoices"}}}
+		scopes := user.GetScopes()
+		if len(scopes) != 1 || scopes[0].GetAction() != "GET" || scopes[0].GetObject() != "invoices" {
+			t.Fatalf("the scopes should be the abilities of the token: %v", scopes)
+		}
+
+		if user.GetID() != "1" {
+			t.Fatal("the delegated user should expose the underlying user")
+		}
+	})
+}
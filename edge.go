@@ -0,0 +1,187 @@
+package gate
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// ErrSymmetricKey is thrown when a verification-only configuration is exported from a configuration with a symmetric key,
+// which would allow the edge to sign tokens as well
+var ErrSymmetricKey = errors.New("symmetric keys cannot be exported for verification only")
+
+// EdgeConfig is the verification-only JWT configuration exported to CDNs or API gateways verifying tokens at the edge.
+// It carries the public key only, hence tokens cannot be issued with it. The claims validators and migrations are functions,
+// hence they are not exported but given to NewEdgeJWTConfig. Revocations cannot be checked at the edge
+type EdgeConfig struct {
+	Algorithm            string   `json:"alg"`
+	PublicKey            string   `json:"public_key"`
+	AllowedAlgorithms    []string `json:"allowed_algorithms,omitempty"`
+	MaxLength            int      `json:"max_length,omitempty"`
+	MaxClaimsSize        int      `json:"max_claims_size,omitempty"`
+	CriticalHeaders      []string `json:"critical_headers,omitempty"`
+	LegacyUntil          int64    `json:"legacy_until,omitempty"`
+	SkipClaimsValidation bool     `json:"skip_claims_validation,omitempty"`
+}
+
+// EdgeConfig exports the verification-only configuration of RSA, RSA-PSS and ECDSA signing.
+// Configurations using HMAC, a token codec or encryption cannot be exported. With a key provider, the current signing key is exported,
+// hence the edge configuration must be exported again on rotation
+func (config JWTConfig) EdgeConfig() (edge EdgeConfig, err error) {
+	if config.codec != nil || config.method == nil {
+		err = errors.New("only signed JWTs can be verified at the edge")
+		return
+	}
+
+	if config.encryption.Enabled() {
+		err = errors.New("encrypted JWTs cannot be verified at the edge")
+		return
+	}
+
+	verifyKey := config.verifyKey
+	if config.keys != nil {
+		verifyKey, err = currentVerificationKey(config.keys)
+		if err != nil {
+			return
+		}
+	}
+
+	var der []byte
+	switch key := verifyKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		der, err = x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			err = errors.Wrap(err, "could not export the public key")
+			return
+		}
+	default:
+		err = ErrSymmetricKey
+		return
+	}
+
+	edge = EdgeConfig{
+		Algorithm:            config.method.Alg(),
+		PublicKey:            string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		AllowedAlgorithms:    config.allowedAlgorithms,
+		MaxLength:            config.maxLength,
+		MaxClaimsSize:        config.maxClaimsSize,
+		CriticalHeaders:      config.criticalHeaders,
+		SkipClaimsValidation: config.skipClaimsValidation,
+	}
+	if !config.legacyUntil.IsZero() {
+		edge.LegacyUntil = config.legacyUntil.Unix()
+	}
+	return
+}
+
+func currentVerificationKey(provider KeyProvider) (key interface{}, err error) {
+	kid, _, err := provider.GetSigningKey()
+	if err != nil {
+		err = errors.Wrap(err, "could not get the signing key")
+		return
+	}
+
+	key, err = provider.GetVerificationKey(kid)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the verification key")
+		return
+	}
+
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	return
+}
+
+// NewEdgeJWTConfig is the constructor for the verification-only JWTConfig of an exported EdgeConfig.
+// The claims migrations and the claims validators, e.g. of the issuer and the audience, are those of the checks,
+// e.g. a zero JWTConfig with the setters applied as for the configuration of the issuer, so tokens are parsed at the edge as they are by the issuer.
+// JWTService of the configuration parses tokens but fails to issue them
+func NewEdgeJWTConfig(edge EdgeConfig, checks JWTConfig) (config JWTConfig, err error) {
+	method := jwt.GetSigningMethod(edge.Algorithm)
+	if method == nil || method == jwt.SigningMethodNone {
+		err = errors.New("invalid JWT algorithm")
+		return
+	}
+
+	block, _ := pem.Decode([]byte(edge.PublicKey))
+	if block == nil {
+		err = errors.New("invalid public key")
+		return
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		err = errors.Wrap(err, "invalid public key")
+		return
+	}
+
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		if !ok {
+			err = errors.New("invalid public key for the algorithm")
+			return
+		}
+	case *jwt.SigningMethodECDSA:
+		_, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			err = errors.New("invalid public key for the algorithm")
+			return
+		}
+	default:
+		err = ErrSymmetricKey
+		return
+	}
+
+	config = JWTConfig{
+		method:               method,
+		verifyKey:            key,
+		skipClaimsValidation: edge.SkipClaimsValidation,
+		maxLength:            edge.MaxLength,
+		maxClaimsSize:        edge.MaxClaimsSize,
+		criticalHeaders:      edge.CriticalHeaders,
+		allowedAlgorithms:    edge.AllowedAlgorithms,
+		migrations:           checks.migrations,
+		validators:           checks.validators,
+	}
+	if edge.LegacyUntil != 0 {
+		config.legacyUntil = time.Unix(edge.LegacyUntil, 0)
+	}
+	return
+}
+
+// SubjectHash returns the cache hint of a user, i.e. the first 32 hexadecimal digits of SHA-256("sub" NUL ID).
+// Edges compute the same hint from the verified "user.id" claim
+func SubjectHash(user User) string {
+	return hintHash("sub", user.GetID())
+}
+
+// RolesHash returns the cache hint of a role set regardless of the order, i.e. the first 32 hexadecimal digits of
+// SHA-256("roles" NUL the sorted role IDs joined by NUL). Edges compute the same hint from the verified "user.roles" claim
+func RolesHash(roles []string) string {
+	sorted := append([]string(nil), roles...)
+	sort.Strings(sorted)
+	return hintHash("roles", sorted...)
+}
+
+// TokenHash returns the cache key of a token, i.e. the first 32 hexadecimal digits of SHA-256("jti" NUL ID).
+// Edges compute the same key from the verified "jti" claim
+func TokenHash(id string) string {
+	return hintHash("jti", id)
+}
+
+func hintHash(kind string, values ...string) string {
+	sum := sha256.Sum256([]byte(kind + "\x00" + strings.Join(values, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,127 @@
+package gate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestEdgeConfig(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	config, err := NewHMACJWTConfig("ES256", key, time.Hour, false)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	service := NewJWTService(config)
+	token, err := service.Issue(service.NewClaims(testUser{ID: "1"}))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	t.Run("export", func(t *testing.T) {
+		edge, err := config.EdgeConfig()
+		if err != nil {
+			t.Fatalf("err should be nil because of the asymmetric key: %s", err)
+		}
+
+		document, err := json.Marshal(edge)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		var imported EdgeConfig
+		if err = json.Unmarshal(document, &imported); err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		edgeConfig, err := NewEdgeJWTConfig(imported, JWTConfig{})
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid edge config: %s", err)
+		}
+
+		edgeService := NewJWTService(edgeConfig)
+		parsed, err := edgeService.Parse(token.Value)
+		if err != nil || parsed.UserID != "1" {
+			t.Fatalf("edge should verify the token: %v %+v", err, parsed)
+		}
+
+		if _, err = edgeService.Issue(edgeService.NewClaims(testUser{ID: "1"})); err == nil {
+			t.Fatal("err should not be nil because the edge config is verification-only")
+		}
+	})
+
+	t.Run("checks", func(t *testing.T) {
+		checked := config
+		checked.SetMaxClaimsSize(4096)
+		checked.SetCriticalHeaders([]string{"b64"})
+		edge, err := checked.EdgeConfig()
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if edge.MaxClaimsSize != 4096 || len(edge.CriticalHeaders) != 1 {
+			t.Fatalf("the limits should be exported: %+v", edge)
+		}
+
+		var checks JWTConfig
+		checks.SetClaimsValidators(RequireClaims("tenant"))
+		edgeConfig, err := NewEdgeJWTConfig(edge, checks)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid edge config: %s", err)
+		}
+
+		if _, err = NewJWTService(edgeConfig).Parse(token.Value); errors.Cause(err) != ErrInvalidClaims {
+			t.Fatalf("err should be ErrInvalidClaims because the edge runs the validators of the checks: %v", err)
+		}
+	})
+
+	t.Run("symmetric", func(t *testing.T) {
+		hmac, err := NewHMACJWTConfig("HS256", "secret", time.Hour, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = hmac.EdgeConfig(); err != ErrSymmetricKey {
+			t.Fatalf("err should be ErrSymmetricKey: %v", err)
+		}
+
+		edge, err := config.EdgeConfig()
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		edge.Algorithm = "RS256"
+		if _, err = NewEdgeJWTConfig(edge, JWTConfig{}); err == nil {
+			t.Fatal("err should not be nil because of the mismatching key")
+		}
+
+		edge.Algorithm = "HS256"
+		if _, err = NewEdgeJWTConfig(edge, JWTConfig{}); err != ErrSymmetricKey {
+			t.Fatalf("err should be ErrSymmetricKey: %v", err)
+		}
+	})
+
+	t.Run("hints", func(t *testing.T) {
+		if RolesHash([]string{"a", "b"}) != RolesHash([]string{"b", "a"}) {
+			t.Fatal("roles hash should not depend on the order")
+		}
+
+		if RolesHash([]string{"ab"}) == RolesHash([]string{"a", "b"}) || SubjectHash(testUser{ID: "a"}) == RolesHash([]string{"a"}) {
+			t.Fatal("hints should not collide")
+		}
+
+		if len(SubjectHash(testUser{ID: "1"})) != 32 {
+			t.Fatal("hints should have 32 digits")
+		}
+	})
+}
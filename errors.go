@@ -0,0 +1,100 @@
+package gate
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// ErrForbidden is thrown when an user is forbidden to take an action on an object
+var ErrForbidden = errors.New("forbidden")
+
+// ErrNoAbilities is thrown when an user has no abilities
+var ErrNoAbilities = errors.New("there is no abilities")
+
+// ErrTokenConsumed is thrown when a single-use token is presented again
+var ErrTokenConsumed = errors.New("token has already been used")
+
+// ErrTokenRevoked is thrown when a token has been revoked from the token manager
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// ErrTokenNotFound is returned, possibly wrapped, by token services when no stored token matches, as opposed to storage failures
+var ErrTokenNotFound = errors.New("token not found")
+
+// ErrUserNotFound is returned, possibly wrapped, by user services when no user matches, as opposed to storage failures
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrMFARequired is thrown when a login succeeds with the credentials but an anomaly demands a multi-factor step-up
+var ErrMFARequired = errors.New("multi-factor authentication is required")
+
+// ErrQuotaExceeded is thrown when an action is only granted by limited abilities whose quotas are exhausted
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrSessionLimitExceeded is thrown when a user has reached the maximum number of active sessions and new sessions are rejected
+var ErrSessionLimitExceeded = errors.New("session limit exceeded")
+
+// IsAuthorizationError reports whether the cause of an error is an authorization failure, i.e. the user is known but not allowed
+func IsAuthorizationError(err error) bool {
+	cause := errors.Cause(err)
+	return cause == ErrForbidden || cause == ErrNoAbilities
+}
+
+// AuthenticationError is an authentication failure, i.e. the token or the credentials are rejected, as opposed to failures of the services.
+// Its cause is the failure, so callers relying on errors.Cause keep working
+type AuthenticationError struct {
+	err error
+}
+
+// Error returns the message of the failure
+func (err AuthenticationError) Error() string {
+	return err.err.Error()
+}
+
+// Cause returns the failure, see github.com/pkg/errors
+func (err AuthenticationError) Cause() error {
+	return err.err
+}
+
+// NewAuthenticationError is the constructor for AuthenticationError
+func NewAuthenticationError(err error) AuthenticationError {
+	return AuthenticationError{err}
+}
+
+// authenticationErrors are the authentication failures defined by gate
+var authenticationErrors = []error{
+	ErrTokenConsumed,
+	ErrTokenRevoked,
+	ErrTokenNotFound,
+	ErrUserNotFound,
+	ErrMFARequired,
+	ErrSessionLimitExceeded,
+	ErrStepUpRequired,
+	ErrChallengeRequired,
+	ErrChallengeFailed,
+	ErrAuthenticationFailed,
+	ErrLoginFailed,
+}
+
+// IsAuthenticationError reports whether an error is an authentication failure, i.e. there is an AuthenticationError, a JWT validation error
+// or an authentication failure defined by gate, e.g. ErrTokenRevoked, along its chain
+func IsAuthenticationError(err error) bool {
+	for err != nil {
+		switch err.(type) {
+		case AuthenticationError, *jwt.ValidationError:
+			return true
+		}
+
+		for _, failure := range authenticationErrors {
+			if err == failure {
+				return true
+			}
+		}
+
+		causer, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = causer.Cause()
+	}
+
+	return false
+}
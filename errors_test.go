@@ -0,0 +1,38 @@
+package gate
+
+import (
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+func TestIsAuthenticationError(t *testing.T) {
+	failures := []error{
+		NewAuthenticationError(errors.New("signature is invalid")),
+		errors.Wrap(NewAuthenticationError(errors.New("invalid credentials")), "could not login"),
+		errors.Wrap(jwt.NewValidationError("token is expired", jwt.ValidationErrorExpired), "could not parse the token"),
+		errors.WithMessage(ErrTokenRevoked, "jti"),
+		NewRedactedError(ErrAuthenticationFailed, errors.WithMessage(ErrUserNotFound, "id")),
+	}
+
+	for _, err := range failures {
+		if !IsAuthenticationError(err) {
+			t.Fatalf("the error should be an authentication failure: %v", err)
+		}
+	}
+
+	others := []error{
+		nil,
+		errors.Wrap(errors.New("connection refused"), "could not get the abilities"),
+		ErrForbidden,
+		NewRedactedError(ErrAuthorizationFailed, errors.New("missing role service")),
+		Redact(RedactErrors, errors.New("sql: connection refused"), ErrAuthenticationFailed),
+	}
+
+	for _, err := range others {
+		if IsAuthenticationError(err) {
+			t.Fatalf("the error should not be an authentication failure: %v", err)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package gate
+
+import (
+	"encoding/json"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// ErrExternalIssuance is thrown when a token is issued with a codec of externally issued tokens
+var ErrExternalIssuance = errors.New("externally issued tokens cannot be issued")
+
+// ErrClaimMapping is thrown when the claims of an externally issued token cannot be mapped to the user information
+var ErrClaimMapping = errors.New("could not map claims")
+
+// ClaimMapping locates the user information in the claims of externally issued tokens with dot-separated paths, e.g. "realm_access.roles".
+// Claim names containing dots, e.g. namespaced claims like "https://example.com/roles", are matched as a whole first
+type ClaimMapping struct {
+	// ID is the path of the user ID, "sub" by default
+	ID string
+	// Username is the path of the username. The username is left empty without a path
+	Username string
+	// Email is the path of the email. The email is left empty without a path
+	Email string
+	// Roles is the path of the roles, either an array of strings or a string. The roles are left empty without a path
+	Roles string
+}
+
+// FirebaseClaimMapping maps the ID tokens of Firebase Authentication with the roles set as the "roles" custom claim
+var FirebaseClaimMapping = ClaimMapping{ID: "sub", Username: "email", Email: "email", Roles: "roles"}
+
+// KeycloakClaimMapping maps the access tokens of Keycloak with the realm roles
+var KeycloakClaimMapping = ClaimMapping{ID: "sub", Username: "preferred_username", Email: "email", Roles: "realm_access.roles"}
+
+// Auth0ClaimMapping maps the tokens of Auth0 with the roles set by a rule or an action as the namespaced claim "<namespace>roles",
+// e.g. "https://example.com/roles"
+func Auth0ClaimMapping(namespace string) ClaimMapping {
+	return ClaimMapping{ID: "sub", Username: namespace + "username", Email: namespace + "email", Roles: namespace + "roles"}
+}
+
+// Map resolves the user information of raw claims
+func (mapping ClaimMapping) Map(claims map[string]interface{}) (info UserInfo, err error) {
+	idPath := mapping.ID
+	if idPath == "" {
+		idPath = "sub"
+	}
+
+	info.ID, _ = lookupClaim(claims, idPath).(string)
+	if info.ID == "" {
+		err = errors.WithMessage(ErrClaimMapping, "missing user ID claim "+idPath)
+		return
+	}
+
+	if mapping.Username != "" {
+		info.Username, _ = lookupClaim(claims, mapping.Username).(string)
+	}
+
+	if mapping.Email != "" {
+		info.Email, _ = lookupClaim(claims, mapping.Email).(string)
+	}
+
+	if mapping.Roles == "" {
+		return
+	}
+
+	switch roles := lookupClaim(claims, mapping.Roles).(type) {
+	case nil:
+	case string:
+		info.Roles = []string{roles}
+	case []interface{}:
+		for _, role := range roles {
+			str, ok := role.(string)
+			if !ok {
+				err = errors.WithMessage(ErrClaimMapping, "invalid role in claim "+mapping.Roles)
+				return
+			}
+
+			info.Roles = append(info.Roles, str)
+		}
+	default:
+		err = errors.WithMessage(ErrClaimMapping, "invalid roles claim "+mapping.Roles)
+	}
+	return
+}
+
+// lookupClaim resolves a dot-separated path in raw claims. A key matching the whole remaining path takes precedence over nested claims
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	if value, ok := claims[path]; ok {
+		return value
+	}
+
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+
+		nested, ok := claims[path[:i]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if value := lookupClaim(nested, path[i+1:]); value != nil {
+			return value
+		}
+	}
+
+	return nil
+}
+
+// KeyLookup resolves the verifying key of an externally issued token by the "kid" and "alg" headers, e.g. from the JWKS of the issuer
+type KeyLookup func(kid, alg string) (interface{}, error)
+
+// ExternalTokenCodec is the TokenCodec of JWTs issued by an external identity provider, e.g. Firebase, Auth0 or Keycloak.
+// Tokens are verified and their claims are mapped to the user information, so gate acts as the authorization layer only.
+// Tokens must carry the expected "iss" and "aud" claims and an "exp" claim, so tokens of other issuers or clients of the identity provider
+// and tokens which never expire are refused. It is meant to be used with the stateless authentication unless the users are known by the user service
+type ExternalTokenCodec struct {
+	mapping    ClaimMapping
+	keys       KeyLookup
+	algorithms []string
+	issuer     string
+	audience   string
+}
+
+// Encode refuses to issue tokens since they are issued by the identity provider
+func (codec ExternalTokenCodec) Encode(claims JWTClaims) (string, error) {
+	return "", ErrExternalIssuance
+}
+
+// Decode verifies an externally issued JWT and maps its claims
+func (codec ExternalTokenCodec) Decode(tokenString string) (claims JWTClaims, err error) {
+	parser := &jwt.Parser{ValidMethods: codec.algorithms, UseJSONNumber: true, SkipClaimsValidation: true}
+	raw := jwt.MapClaims{}
+	_, err = parser.ParseWithClaims(tokenString, raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return codec.keys(kid, token.Method.Alg())
+	})
+	if err != nil {
+		err = errors.Wrap(err, "could not verify external token")
+		return
+	}
+
+	claims.StandardClaims = jwt.StandardClaims{
+		ExpiresAt: numericClaim(raw["exp"]),
+		IssuedAt:  numericClaim(raw["iat"]),
+		NotBefore: numericClaim(raw["nbf"]),
+	}
+	claims.Id, _ = raw["jti"].(string)
+	claims.Issuer, _ = raw["iss"].(string)
+	claims.Subject, _ = raw["sub"].(string)
+
+	if claims.ExpiresAt == 0 {
+		err = errors.New("missing expiration")
+		return
+	}
+
+	if claims.Issuer != codec.issuer {
+		err = errors.New("invalid issuer")
+		return
+	}
+
+	if !containsAudience(raw["aud"], codec.audience) {
+		err = errors.New("invalid audience")
+		return
+	}
+
+	claims.Audience = codec.audience
+
+	claims.User, err = codec.mapping.Map(raw)
+	return
+}
+
+func numericClaim(value interface{}) int64 {
+	switch value := value.(type) {
+	case json.Number:
+		number, _ := value.Int64()
+		if number == 0 {
+			float, _ := value.Float64()
+			number = int64(float)
+		}
+		return number
+	case float64:
+		return int64(value)
+	}
+
+	return 0
+}
+
+func containsAudience(value interface{}, audience string) bool {
+	switch value := value.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, aud := range value {
+			if str, ok := aud.(string); ok && str == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// NewExternalTokenCodec is the constructor for ExternalTokenCodec. Only the given algorithms are accepted, e.g. []string{"RS256"},
+// and only tokens of the issuer for the audience, e.g. the issuer URL of the realm and the client ID
+func NewExternalTokenCodec(mapping ClaimMapping, keys KeyLookup, algorithms []string, issuer, audience string) (codec ExternalTokenCodec, err error) {
+	if keys == nil {
+		err = errors.New("missing key lookup")
+		return
+	}
+
+	if len(algorithms) == 0 {
+		err = errors.New("missing algorithms")
+		return
+	}
+
+	for _, alg := range algorithms {
+		if strings.EqualFold(alg, "none") {
+			err = ErrAlgorithmNone
+			return
+		}
+	}
+
+	if issuer == "" {
+		err = errors.New("missing issuer")
+		return
+	}
+
+	if audience == "" {
+		err = errors.New("missing audience")
+		return
+	}
+
+	codec = ExternalTokenCodec{mapping: mapping, keys: keys, algorithms: algorithms, issuer: issuer, audience: audience}
+	return
+}
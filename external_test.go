@@ -0,0 +1,175 @@
+package gate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+func TestClaimMapping(t *testing.T) {
+	claims := map[string]interface{}{
+		"sub":                        "id",
+		"preferred_username":         "foo",
+		"email":                      "foo@example.com",
+		"realm_access":               map[string]interface{}{"roles": []interface{}{"admin", "user"}},
+		"https://example.com/roles":  []interface{}{"editor"},
+		"https://example.com/groups": "group",
+	}
+
+	t.Run("keycloak", func(t *testing.T) {
+		info, err := KeycloakClaimMapping.Map(claims)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if info.ID != "id" || info.Username != "foo" || info.Email != "foo@example.com" || len(info.Roles) != 2 || info.Roles[0] != "admin" {
+			t.Fatalf("claims should be mapped: %v", info)
+		}
+	})
+
+	t.Run("namespaced", func(t *testing.T) {
+		info, err := Auth0ClaimMapping("https://example.com/").Map(claims)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if len(info.Roles) != 1 || info.Roles[0] != "editor" {
+			t.Fatalf("namespaced roles should be mapped: %v", info.Roles)
+		}
+
+		info, err = ClaimMapping{Roles: "https://example.com/groups"}.Map(claims)
+		if err != nil || len(info.Roles) != 1 || info.Roles[0] != "group" {
+			t.Fatalf("a single role should be mapped: %v %s", info.Roles, err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ClaimMapping{ID: "missing"}.Map(claims)
+		if errors.Cause(err) != ErrClaimMapping {
+			t.Fatalf("err should be ErrClaimMapping because of the missing ID: %v", err)
+		}
+
+		_, err = ClaimMapping{Roles: "realm_access"}.Map(claims)
+		if errors.Cause(err) != ErrClaimMapping {
+			t.Fatalf("err should be ErrClaimMapping because of the invalid roles: %v", err)
+		}
+	})
+}
+
+func TestExternalTokenCodec(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = "key-1"
+		str, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+		return str
+	}
+
+	codec, err := NewExternalTokenCodec(KeycloakClaimMapping, func(kid, alg string) (interface{}, error) {
+		if kid != "key-1" {
+			return nil, errors.New("unknown key")
+		}
+		return &key.PublicKey, nil
+	}, []string{"ES256"}, "https://idp.example.com/realms/app", "app")
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	expiredAt := time.Now().Add(time.Hour).Unix()
+	valid := jwt.MapClaims{
+		"sub":                "id",
+		"iss":                "https://idp.example.com/realms/app",
+		"aud":                []string{"app", "account"},
+		"exp":                expiredAt,
+		"preferred_username": "foo",
+		"realm_access":       map[string]interface{}{"roles": []string{"admin"}},
+	}
+
+	t.Run("decode", func(t *testing.T) {
+		claims, err := codec.Decode(sign(valid))
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid token: %s", err)
+		}
+
+		if claims.User.ID != "id" || claims.User.Username != "foo" || len(claims.User.Roles) != 1 || claims.ExpiresAt != expiredAt {
+			t.Fatalf("claims should be mapped: %v", claims)
+		}
+	})
+
+	t.Run("issuer and audience", func(t *testing.T) {
+		invalid := jwt.MapClaims{}
+		for name, value := range valid {
+			invalid[name] = value
+		}
+
+		invalid["iss"] = "https://evil.example.com"
+		if _, err := codec.Decode(sign(invalid)); err == nil {
+			t.Fatal("err should not be nil because of the invalid issuer")
+		}
+
+		delete(invalid, "iss")
+		if _, err := codec.Decode(sign(invalid)); err == nil {
+			t.Fatal("err should not be nil because of the missing issuer")
+		}
+
+		invalid["iss"] = valid["iss"]
+		invalid["aud"] = "other"
+		if _, err := codec.Decode(sign(invalid)); err == nil {
+			t.Fatal("err should not be nil because of the invalid audience")
+		}
+
+		delete(invalid, "aud")
+		if _, err := codec.Decode(sign(invalid)); err == nil {
+			t.Fatal("err should not be nil because of the missing audience")
+		}
+
+		invalid["aud"] = valid["aud"]
+		delete(invalid, "exp")
+		if _, err := codec.Decode(sign(invalid)); err == nil {
+			t.Fatal("err should not be nil because of the missing expiration")
+		}
+	})
+
+	t.Run("configuration", func(t *testing.T) {
+		if _, err := NewExternalTokenCodec(KeycloakClaimMapping, codec.keys, []string{"ES256"}, "", "app"); err == nil {
+			t.Fatal("err should not be nil because of the missing issuer")
+		}
+
+		if _, err := NewExternalTokenCodec(KeycloakClaimMapping, codec.keys, []string{"ES256"}, codec.issuer, ""); err == nil {
+			t.Fatal("err should not be nil because of the missing audience")
+		}
+	})
+
+	t.Run("algorithms", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err := codec.Decode(token); err == nil {
+			t.Fatal("err should not be nil because of the algorithm not allowed")
+		}
+
+		if _, err := NewExternalTokenCodec(KeycloakClaimMapping, codec.keys, []string{"none"}, codec.issuer, codec.audience); errors.Cause(err) != ErrAlgorithmNone {
+			t.Fatalf("err should be ErrAlgorithmNone: %v", err)
+		}
+	})
+
+	t.Run("issuance", func(t *testing.T) {
+		if _, err := codec.Encode(JWTClaims{}); err != ErrExternalIssuance {
+			t.Fatalf("err should be ErrExternalIssuance: %v", err)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package gate
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FieldSeparator separates the resource type from the field in ability objects, e.g. "read" on "posts.title"
+const FieldSeparator = "."
+
+// FieldSet is the set of permitted fields of a resource type
+type FieldSet struct {
+	all    bool
+	fields map[string]struct{}
+}
+
+// All reports whether every field is permitted
+func (set FieldSet) All() bool {
+	return set.all
+}
+
+// Has reports whether a field is permitted
+func (set FieldSet) Has(field string) bool {
+	if set.all {
+		return true
+	}
+
+	_, ok := set.fields[field]
+	return ok
+}
+
+// Fields returns the sorted permitted fields. It is empty if every field is permitted
+func (set FieldSet) Fields() []string {
+	fields := make([]string, 0, len(set.fields))
+	for field := range set.fields {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+	return fields
+}
+
+// Filter returns a copy of a document without the fields which are not permitted
+func (set FieldSet) Filter(document map[string]interface{}) map[string]interface{} {
+	filtered := make(map[string]interface{}, len(document))
+	for field, value := range document {
+		if set.Has(field) {
+			filtered[field] = value
+		}
+	}
+
+	return filtered
+}
+
+// Intersect returns the fields permitted by both sets
+func (set FieldSet) Intersect(other FieldSet) FieldSet {
+	switch {
+	case set.all:
+		return other
+	case other.all:
+		return set
+	}
+
+	intersection := NewFieldSet()
+	for field := range set.fields {
+		if other.Has(field) {
+			intersection.fields[field] = struct{}{}
+		}
+	}
+
+	return intersection
+}
+
+// NewFieldSet is the constructor for FieldSet with the permitted fields
+func NewFieldSet(fields ...string) FieldSet {
+	set := FieldSet{fields: make(map[string]struct{}, len(fields))}
+	for _, field := range fields {
+		set.fields[field] = struct{}{}
+	}
+
+	return set
+}
+
+// AllFields is the FieldSet permitting every field
+var AllFields = FieldSet{all: true}
+
+// PermittedFields returns the fields of a resource type on which an action is granted, e.g. "title" by "read" on "posts.title".
+// Granting the action on the resource type itself or on "posts.*" permits every field. Candidate fields are checked with the matcher,
+// so any object pattern applies; without candidates the fields are collected from the literal ability objects.
+// Conditional abilities never permit fields
+func (index AbilityIndex) PermittedFields(action, resource string, fields ...string) FieldSet {
+	if index.Allows(action, resource) {
+		return AllFields
+	}
+
+	if len(fields) > 0 {
+		set := NewFieldSet()
+		for _, field := range fields {
+			if index.Allows(action, resource+FieldSeparator+field) {
+				set.fields[field] = struct{}{}
+			}
+		}
+
+		return set
+	}
+
+	if index.Allows(action, resource+FieldSeparator+"*") {
+		return AllFields
+	}
+
+	set := NewFieldSet()
+	prefix := index.matcher.normalize(resource + FieldSeparator)
+	for _, ability := range index.abilities {
+		if IsConditional(ability) {
+			continue
+		}
+
+		object := index.matcher.normalize(objectPattern(ability))
+		if index.matcher.caseInsensitive {
+			object, prefix = strings.ToLower(object), strings.ToLower(prefix)
+		}
+
+		if !strings.HasPrefix(object, prefix) {
+			continue
+		}
+
+		field := object[len(prefix):]
+		if field == "" || regexp.QuoteMeta(field) != field {
+			continue
+		}
+
+		if match, err := index.matcher.Match(action, ability.GetAction()); err == nil && match {
+			set.fields[field] = struct{}{}
+		}
+	}
+
+	return set
+}
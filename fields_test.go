@@ -0,0 +1,72 @@
+package gate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPermittedFields(t *testing.T) {
+	index := NewAbilityIndex([]UserAbility{
+		testAbility{"read", "posts.title"},
+		testAbility{"read", "posts.body"},
+		testAbility{"read", "posts.meta_*"},
+		testAbility{"write", "posts.title"},
+		testAbility{"read", "comments.*"},
+		testAbility{"*", "users"},
+	}, NewMatcher())
+
+	t.Run("collected", func(t *testing.T) {
+		set := index.PermittedFields("read", "posts")
+		if set.All() || !reflect.DeepEqual(set.Fields(), []string{"body", "title"}) {
+			t.Fatalf("fields should be collected from the literal objects: %v", set.Fields())
+		}
+
+		if fields := index.PermittedFields("write", "posts").Fields(); !reflect.DeepEqual(fields, []string{"title"}) {
+			t.Fatalf("fields should depend on the action: %v", fields)
+		}
+
+		if set := index.PermittedFields("delete", "posts"); set.All() || len(set.Fields()) != 0 {
+			t.Fatalf("no fields should be permitted: %v", set.Fields())
+		}
+	})
+
+	t.Run("candidates", func(t *testing.T) {
+		set := index.PermittedFields("read", "posts", "title", "meta_tags", "author")
+		if !reflect.DeepEqual(set.Fields(), []string{"meta_tags", "title"}) {
+			t.Fatalf("candidates should be matched with the patterns: %v", set.Fields())
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		if !index.PermittedFields("read", "comments").All() {
+			t.Fatal("wildcard fields should permit every field")
+		}
+
+		if !index.PermittedFields("read", "users", "password").Has("password") {
+			t.Fatal("the resource type itself should permit every field")
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		document := map[string]interface{}{"title": "hello", "body": "world", "secret": true}
+		filtered := index.PermittedFields("read", "posts").Filter(document)
+		if !reflect.DeepEqual(filtered, map[string]interface{}{"title": "hello", "body": "world"}) {
+			t.Fatalf("fields should be stripped: %v", filtered)
+		}
+
+		if len(document) != 3 {
+			t.Fatal("document should not be modified")
+		}
+	})
+
+	t.Run("intersect", func(t *testing.T) {
+		set := NewFieldSet("title", "body").Intersect(NewFieldSet("body", "secret"))
+		if !reflect.DeepEqual(set.Fields(), []string{"body"}) {
+			t.Fatalf("invalid intersection: %v", set.Fields())
+		}
+
+		if !AllFields.Intersect(AllFields).All() || AllFields.Intersect(set).Has("title") {
+			t.Fatal("all fields should be neutral")
+		}
+	})
+}
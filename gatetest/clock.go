@@ -0,0 +1,38 @@
+package gatetest
+
+import (
+	"sync"
+	"time"
+)
+
+// FrozenClock is a gate.Clock which stands still until it is moved. It is safe for concurrent use
+type FrozenClock struct {
+	mutex sync.RWMutex
+	now   time.Time
+}
+
+// Now returns the frozen time
+func (clock *FrozenClock) Now() time.Time {
+	clock.mutex.RLock()
+	defer clock.mutex.RUnlock()
+	return clock.now
+}
+
+// Set moves the clock to a specific time
+func (clock *FrozenClock) Set(now time.Time) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = now
+}
+
+// Advance moves the clock forward by a duration, backward if the duration is negative
+func (clock *FrozenClock) Advance(duration time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = clock.now.Add(duration)
+}
+
+// NewFrozenClock is the constructor for FrozenClock, frozen at a specific time
+func NewFrozenClock(now time.Time) *FrozenClock {
+	return &FrozenClock{now: now}
+}
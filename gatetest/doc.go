@@ -0,0 +1,3 @@
+// Package gatetest provides a frozen clock and deterministic token fixtures for the integration tests of github.com/hiendv/gate consumers,
+// e.g. expired, not-yet-valid, tampered or wrongly addressed tokens, so that middleware edge cases are covered without crafting JWTs by hand
+package gatetest
@@ -0,0 +1,129 @@
+package gatetest
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// DefaultSkew is the distance of the fixtures from the validity boundaries, i.e. how long ago the expired tokens expired
+// and how far ahead the not-yet-valid tokens become valid
+const DefaultSkew = time.Minute
+
+// Tokens builds token fixtures with a JWT service bound to a frozen clock. The fixtures of the same user at the same time
+// are identical across runs since the claims IDs are sequential, e.g. "fixture-1"
+type Tokens struct {
+	service  gate.JWTService
+	clock    *FrozenClock
+	audience string
+	skew     time.Duration
+}
+
+// Service is the getter for the JWT service, which should be used by the components under test to parse the fixtures
+func (tokens Tokens) Service() gate.JWTService {
+	return tokens.service
+}
+
+// Clock is the getter for the frozen clock
+func (tokens Tokens) Clock() *FrozenClock {
+	return tokens.clock
+}
+
+// SetAudience is the setter for the "aud" claim of the fixtures. No audience is set by default
+func (tokens *Tokens) SetAudience(audience string) {
+	tokens.audience = audience
+}
+
+// SetSkew is the setter for the distance of the fixtures from the validity boundaries, DefaultSkew by default
+func (tokens *Tokens) SetSkew(skew time.Duration) {
+	tokens.skew = skew
+}
+
+// Claims returns the claims of a valid token for a user at the time of the clock
+func (tokens Tokens) Claims(user gate.User) gate.JWTClaims {
+	claims := tokens.service.NewClaims(user)
+	claims.Audience = tokens.audience
+	return claims
+}
+
+// Issue signs a token fixture from custom claims
+func (tokens Tokens) Issue(claims gate.JWTClaims) (gate.JWT, error) {
+	token, err := tokens.service.Issue(claims)
+	if err != nil {
+		return token, errors.Wrap(err, "could not issue the token fixture")
+	}
+
+	return token, nil
+}
+
+// Valid returns a token of a user which is valid at the time of the clock
+func (tokens Tokens) Valid(user gate.User) (gate.JWT, error) {
+	return tokens.Issue(tokens.Claims(user))
+}
+
+// Expired returns a token of a user which expired before the time of the clock
+func (tokens Tokens) Expired(user gate.User) (gate.JWT, error) {
+	claims := tokens.Claims(user)
+	expiredAt := tokens.clock.Now().Add(-tokens.skew)
+	lifetime := time.Duration(claims.ExpiresAt-claims.IssuedAt) * time.Second
+	claims.ExpiresAt = expiredAt.Unix()
+	claims.IssuedAt = expiredAt.Add(-lifetime).Unix()
+	return tokens.Issue(claims)
+}
+
+// NotYetValid returns a token of a user whose "nbf" claim is after the time of the clock
+func (tokens Tokens) NotYetValid(user gate.User) (gate.JWT, error) {
+	claims := tokens.Claims(user)
+	claims.NotBefore = tokens.clock.Now().Add(tokens.skew).Unix()
+	return tokens.Issue(claims)
+}
+
+// WrongAudience returns a token of a user which is addressed to another audience
+func (tokens Tokens) WrongAudience(user gate.User, audience string) (gate.JWT, error) {
+	claims := tokens.Claims(user)
+	claims.Audience = audience
+	return tokens.Issue(claims)
+}
+
+// TamperedSignature returns a valid token of a user whose signature is altered, hence it fails the verification
+func (tokens Tokens) TamperedSignature(user gate.User) (gate.JWT, error) {
+	token, err := tokens.Valid(user)
+	if err != nil {
+		return token, err
+	}
+
+	token.Value, err = Tamper(token.Value)
+	return token, err
+}
+
+// Tamper alters the last segment of a compact token, i.e. the signature of a JWS or the authentication tag of a JWE.
+// The altered character is in the middle of the segment so that the decoded bytes are always changed
+func Tamper(value string) (string, error) {
+	i := strings.LastIndex(value, ".")
+	if i < 0 || len(value)-i-1 < 2 {
+		return "", errors.New("could not tamper a token without a signature")
+	}
+
+	j := i + 1 + (len(value)-i-1)/2
+	replacement := "A"
+	if value[j] == 'A' {
+		replacement = "B"
+	}
+
+	return value[:j] + replacement + value[j+1:], nil
+}
+
+// NewTokens is the constructor for Tokens. The JWT service is bound to the clock, and its claims IDs are made sequential
+func NewTokens(service gate.JWTService, clock *FrozenClock) Tokens {
+	ids := new(uint64)
+	service.Now = clock.Now
+	service.GenerateClaimsID = func() string {
+		return fmt.Sprintf("fixture-%d", atomic.AddUint64(ids, 1))
+	}
+
+	return Tokens{service, clock, "", DefaultSkew}
+}
@@ -0,0 +1,166 @@
+package gatetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/mocks"
+	"github.com/pkg/errors"
+)
+
+func newTokens(t *testing.T) Tokens {
+	config, err := gate.NewHMACJWTConfig("HS256", "secret", time.Hour, false)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	return NewTokens(gate.NewJWTService(config), NewFrozenClock(time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)))
+}
+
+func validationError(err error, flags uint32) bool {
+	validation, ok := errors.Cause(err).(*jwt.ValidationError)
+	return ok && validation.Errors&flags != 0
+}
+
+func TestFrozenClock(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := NewFrozenClock(now)
+
+	var _ gate.Clock = clock
+	if !clock.Now().Equal(now) {
+		t.Fatal("clock should be frozen")
+	}
+
+	clock.Advance(time.Hour)
+	if !clock.Now().Equal(now.Add(time.Hour)) {
+		t.Fatal("clock should be advanced")
+	}
+
+	clock.Set(now)
+	if !clock.Now().Equal(now) {
+		t.Fatal("clock should be set")
+	}
+}
+
+func TestTokens(t *testing.T) {
+	user := mocks.User{ID: "1", Username: "foo", Roles: []string{"admin"}}
+
+	t.Run("valid", func(t *testing.T) {
+		tokens := newTokens(t)
+		token, err := tokens.Valid(user)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		parsed, err := tokens.Service().Parse(token.Value)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid token: %s", err)
+		}
+
+		if parsed.ID != "fixture-1" || parsed.UserID != "1" || !parsed.IssuedAt.Equal(tokens.Clock().Now()) {
+			t.Fatalf("invalid token: %+v", parsed)
+		}
+
+		tokens.Clock().Advance(2 * time.Hour)
+		_, err = tokens.Service().Parse(token.Value)
+		if !validationError(err, jwt.ValidationErrorExpired) {
+			t.Fatalf("token should expire with the clock: %v", err)
+		}
+	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		first, err := newTokens(t).Valid(user)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		second, err := newTokens(t).Valid(user)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if first.Value != second.Value {
+			t.Fatal("fixtures should be identical across runs")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		tokens := newTokens(t)
+		token, err := tokens.Expired(user)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = tokens.Service().Parse(token.Value)
+		if !validationError(err, jwt.ValidationErrorExpired) {
+			t.Fatalf("err should be an expiration error: %v", err)
+		}
+	})
+
+	t.Run("not yet valid", func(t *testing.T) {
+		tokens := newTokens(t)
+		token, err := tokens.NotYetValid(user)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = tokens.Service().Parse(token.Value)
+		if !validationError(err, jwt.ValidationErrorNotValidYet) {
+			t.Fatalf("err should be a not-yet-valid error: %v", err)
+		}
+
+		tokens.Clock().Advance(DefaultSkew)
+		if _, err = tokens.Service().Parse(token.Value); err != nil {
+			t.Fatalf("token should become valid with the clock: %s", err)
+		}
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		tokens := newTokens(t)
+		token, err := tokens.TamperedSignature(user)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = tokens.Service().Parse(token.Value)
+		if !validationError(err, jwt.ValidationErrorSignatureInvalid) {
+			t.Fatalf("err should be a signature error: %v", err)
+		}
+
+		if _, err = Tamper("unsigned"); err == nil {
+			t.Fatal("err should not be nil because of the missing signature")
+		}
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		config, err := gate.NewHMACJWTConfig("HS256", "secret", time.Hour, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		config.SetClaimsValidators(gate.AllowClaimValues("aud", "api"))
+		tokens := NewTokens(gate.NewJWTService(config), NewFrozenClock(time.Now()))
+		tokens.SetAudience("api")
+
+		token, err := tokens.Valid(user)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = tokens.Service().Parse(token.Value); err != nil {
+			t.Fatalf("err should be nil because of the audience: %s", err)
+		}
+
+		token, err = tokens.WrongAudience(user, "other")
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = tokens.Service().Parse(token.Value)
+		if errors.Cause(err) != gate.ErrInvalidClaims {
+			t.Fatalf("err should be an invalid claims error: %v", err)
+		}
+	})
+}
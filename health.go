@@ -0,0 +1,58 @@
+package gate
+
+import (
+	"context"
+	"time"
+)
+
+// Pinger is the optional contract for services able to report their availability, e.g. by pinging the underlying store
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// DependencyStatus is the health of a dependency
+type DependencyStatus struct {
+	Name string
+	// Checked reports whether the dependency has been pinged. Services without a Pinger are assumed to be healthy
+	Checked bool
+	Healthy bool
+	Err     error
+	Latency time.Duration
+}
+
+// HealthReport is the health of every dependency of a driver
+type HealthReport struct {
+	Healthy      bool
+	Dependencies []DependencyStatus
+}
+
+// Status returns the status of a dependency by its name
+func (report HealthReport) Status(name string) (status DependencyStatus, ok bool) {
+	for _, status = range report.Dependencies {
+		if status.Name == name {
+			return status, true
+		}
+	}
+
+	return DependencyStatus{}, false
+}
+
+// Ping pings a service if it is a Pinger and returns the status of the dependency
+func Ping(ctx context.Context, name string, service interface{}) (status DependencyStatus) {
+	status = DependencyStatus{Name: name, Healthy: true}
+	pinger, ok := service.(Pinger)
+	if !ok {
+		return
+	}
+
+	start := time.Now()
+	status.Checked = true
+	status.Err = pinger.Ping(ctx)
+	if status.Err == nil {
+		status.Err = ctx.Err()
+	}
+
+	status.Latency = time.Since(start)
+	status.Healthy = status.Err == nil
+	return
+}
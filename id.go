@@ -0,0 +1,77 @@
+package gate
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// IDGenerator generates unique identifiers, e.g. JWT claims IDs
+type IDGenerator func() string
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ksuidEpoch is the KSUID custom epoch (2014-05-13T16:53:20Z)
+const ksuidEpoch = 1400000000
+
+// UUIDGenerator generates random UUIDv4 identifiers. It is the default claims ID generator
+func UUIDGenerator() string {
+	return uuid.NewV4().String()
+}
+
+// ULIDGenerator generates lexicographically sortable ULID identifiers (26 characters)
+func ULIDGenerator() string {
+	data := make([]byte, 16)
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], ms)
+	copy(data[:6], timestamp[2:])
+	randomBytes(data[6:])
+
+	return encode(data, crockfordAlphabet, 26)
+}
+
+// KSUIDGenerator generates K-sortable KSUID identifiers (27 characters)
+func KSUIDGenerator() string {
+	data := make([]byte, 20)
+	binary.BigEndian.PutUint32(data[:4], uint32(time.Now().Unix()-ksuidEpoch))
+	randomBytes(data[4:])
+
+	return encode(data, base62Alphabet, 27)
+}
+
+// HexGenerator returns a generator of crypto-random hexadecimal identifiers with the given byte length
+func HexGenerator(length int) IDGenerator {
+	return func() string {
+		data := make([]byte, length)
+		randomBytes(data)
+		return hex.EncodeToString(data)
+	}
+}
+
+func randomBytes(data []byte) {
+	_, err := rand.Read(data)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// encode encodes the big-endian data with the given alphabet and left-pads the result to the given length
+func encode(data []byte, alphabet string, length int) string {
+	result := make([]byte, length)
+	number := new(big.Int).SetBytes(data)
+	base := big.NewInt(int64(len(alphabet)))
+	mod := new(big.Int)
+
+	for i := length - 1; i >= 0; i-- {
+		number.DivMod(number, base, mod)
+		result[i] = alphabet[mod.Int64()]
+	}
+
+	return string(result)
+}
@@ -0,0 +1,48 @@
+package gate
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestIDGenerators(t *testing.T) {
+	generators := []struct {
+		name      string
+		generator IDGenerator
+		pattern   string
+	}{
+		{"uuid", UUIDGenerator, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`},
+		{"ulid", ULIDGenerator, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{"ksuid", KSUIDGenerator, `^[0-9A-Za-z]{27}$`},
+		{"hex", HexGenerator(16), `^[0-9a-f]{32}$`},
+	}
+
+	for _, g := range generators {
+		t.Run(g.name, func(t *testing.T) {
+			re := regexp.MustCompile(g.pattern)
+			first, second := g.generator(), g.generator()
+			if !re.MatchString(first) {
+				t.Fatalf("invalid format: %s", first)
+			}
+
+			if first == second {
+				t.Fatalf("ids should be unique: %s - %s", first, second)
+			}
+		})
+	}
+
+	t.Run("service", func(t *testing.T) {
+		config, err := NewHMACJWTConfig("HS256", "secret", 0, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		config.SetIDGenerator(func() string {
+			return "fixed"
+		})
+
+		if id := NewJWTService(config).GenerateClaimsID(); id != "fixed" {
+			t.Fatalf("the configured generator should be used: %s", id)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package gate
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+type abilityKey struct {
+	action string
+	object string
+}
+
+// AbilityIndex is an indexed set of abilities.
+// Literal abilities are indexed by a hash lookup so exact permissions are granted in constant time and they grant their exact action and object only,
+// other checks fall back to matching the pattern abilities only with the matcher.
+// Conditional abilities never grant by themselves, they are returned by Conditional so their conditions can be checked
+type AbilityIndex struct {
+	matcher     Matcher
+	abilities   []UserAbility
+	exact       map[abilityKey]struct{}
+	patterns    []UserAbility
+	conditional []UserAbility
+	until       time.Time
+}
+
+// Until returns the time the index stops being accurate, e.g. the next transition of a validity window or a schedule
+// of the indexed roles and abilities. A zero time means the index does not depend on time
+func (index AbilityIndex) Until() time.Time {
+	return index.until
+}
+
+// SetUntil is the setter for the time the index stops being accurate, zero by default
+func (index *AbilityIndex) SetUntil(until time.Time) {
+	index.until = until
+}
+
+// Abilities returns the indexed abilities
+func (index AbilityIndex) Abilities() []UserAbility {
+	return index.abilities
+}
+
+// Len returns the number of indexed abilities
+func (index AbilityIndex) Len() int {
+	return len(index.abilities)
+}
+
+// Allows reports whether an action on an object is granted by one of the indexed abilities
+func (index AbilityIndex) Allows(action, object string) bool {
+	if _, ok := index.exact[index.key(action, object)]; ok {
+		return true
+	}
+
+	for _, ability := range index.patterns {
+		if index.matcher.MatchAbility(action, object, ability) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Conditional returns the conditional abilities, i.e. owned, limited, sensitive or templates, matching an action on an object
+func (index AbilityIndex) Conditional(action, object string) (abilities []UserAbility) {
+	for _, ability := range index.conditional {
+		if index.matcher.MatchAbility(action, object, ability) {
+			abilities = append(abilities, ability)
+		}
+	}
+
+	return
+}
+
+func (index AbilityIndex) key(action, object string) abilityKey {
+	action, object = index.matcher.normalize(action), index.matcher.normalize(object)
+	if index.matcher.caseInsensitive {
+		action, object = strings.ToLower(action), strings.ToLower(object)
+	}
+
+	return abilityKey{action, object}
+}
+
+func (index AbilityIndex) isLiteral(ability UserAbility) bool {
+	if IsConditional(ability) {
+		return false
+	}
+
+	action, object := ability.GetAction(), ability.GetObject()
+	if action == "" || object == "" || regexp.QuoteMeta(action) != action {
+		return false
+	}
+
+	if !index.matcher.objectPaths {
+		return regexp.QuoteMeta(object) == object
+	}
+
+	for _, segment := range splitPath(object) {
+		if segment == "*" || segment == "**" || strings.HasPrefix(segment, ":") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewAbilityIndex is the constructor for AbilityIndex
+func NewAbilityIndex(abilities []UserAbility, matcher Matcher) AbilityIndex {
+	index := AbilityIndex{
+		matcher:   matcher,
+		abilities: abilities,
+		exact:     map[abilityKey]struct{}{},
+	}
+
+	for _, ability := range abilities {
+		switch {
+		case ability.GetAction() == "" || ability.GetObject() == "":
+			// abilities with an empty action or object never match
+		case IsConditional(ability):
+			index.conditional = append(index.conditional, ability)
+		case index.isLiteral(ability):
+			index.exact[index.key(ability.GetAction(), ability.GetObject())] = struct{}{}
+		default:
+			index.patterns = append(index.patterns, ability)
+		}
+	}
+
+	return index
+}
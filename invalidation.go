@@ -0,0 +1,293 @@
+package gate
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// InvalidationBus broadcasts role changes across the instances of a fleet, e.g. with Redis pub/sub,
+// so every instance invalidates its cached roles, abilities and decisions.
+// An empty set of roles invalidates every role, e.g. after a subscription was interrupted and messages may have been missed
+type InvalidationBus interface {
+	Publish(roleIDs []string) error
+	Subscribe(handler func(roleIDs []string)) (cancel func(), err error)
+}
+
+// RoleInvalidator is the optional contract for role services caching roles, e.g. CachedRoleService
+type RoleInvalidator interface {
+	Invalidate(roleIDs ...string)
+	Flush()
+}
+
+// MemoryInvalidationBus is the in-process InvalidationBus, e.g. for a single instance or tests. Handlers are invoked synchronously
+type MemoryInvalidationBus struct {
+	handlers map[int]func([]string)
+	next     *int
+	*sync.RWMutex
+}
+
+// Publish invokes every subscribed handler with the roles
+func (bus MemoryInvalidationBus) Publish(roleIDs []string) error {
+	bus.RLock()
+	handlers := make([]func([]string), 0, len(bus.handlers))
+	for _, handler := range bus.handlers {
+		handlers = append(handlers, handler)
+	}
+	bus.RUnlock()
+
+	for _, handler := range handlers {
+		handler(roleIDs)
+	}
+	return nil
+}
+
+// Subscribe registers a handler until the subscription is cancelled
+func (bus MemoryInvalidationBus) Subscribe(handler func(roleIDs []string)) (cancel func(), err error) {
+	bus.Lock()
+	defer bus.Unlock()
+
+	id := *bus.next
+	*bus.next++
+	bus.handlers[id] = handler
+	cancel = func() {
+		bus.Lock()
+		defer bus.Unlock()
+
+		delete(bus.handlers, id)
+	}
+	return
+}
+
+// NewMemoryInvalidationBus is the constructor for MemoryInvalidationBus
+func NewMemoryInvalidationBus() MemoryInvalidationBus {
+	return MemoryInvalidationBus{map[int]func([]string){}, new(int), &sync.RWMutex{}}
+}
+
+// InvalidationListener is the subscription of an instance to an InvalidationBus
+type InvalidationListener struct {
+	cancel func()
+	once   *sync.Once
+}
+
+// Enabled reports whether the listener is subscribed
+func (listener InvalidationListener) Enabled() bool {
+	return listener.cancel != nil
+}
+
+// Stop cancels the subscription, e.g. on shutdown. Stopping a stopped listener has no effect
+func (listener InvalidationListener) Stop() {
+	if !listener.Enabled() {
+		return
+	}
+
+	listener.once.Do(listener.cancel)
+}
+
+// NewInvalidationListener is the constructor for InvalidationListener. It subscribes the handler to the bus
+func NewInvalidationListener(bus InvalidationBus, handler func(roleIDs []string)) (listener InvalidationListener, err error) {
+	cancel, err := bus.Subscribe(handler)
+	if err != nil {
+		err = errors.Wrap(err, "could not subscribe to the invalidations")
+		return
+	}
+
+	listener.cancel, listener.once = cancel, &sync.Once{}
+	return
+}
+
+type cachedRole struct {
+	role      Role
+	expiredAt time.Time
+}
+
+// CachedRoleService is a read-through cache of a RoleService. Roles are cached by ID for the TTL,
+// missing roles included, and invalidated by role changes made through it or broadcast by an InvalidationBus.
+// Roles fetched at once are only cached when they are IdentifiedRole
+type CachedRoleService struct {
+	service    RoleService
+	ttl        time.Duration
+	entries    map[string]cachedRole
+	generation *int
+	Now        func() time.Time
+	*sync.RWMutex
+}
+
+// Service returns the cached role service
+func (service CachedRoleService) Service() RoleService {
+	return service.service
+}
+
+// FindByIDs returns the cached roles and fetches the missing or expired ones from the role service
+func (service CachedRoleService) FindByIDs(ids []string) (roles []Role, err error) {
+	now := service.Now()
+	var missing []string
+	service.RLock()
+	generation := *service.generation
+	for _, id := range ids {
+		entry, ok := service.entries[id]
+		if !ok || !now.Before(entry.expiredAt) {
+			missing = append(missing, id)
+			continue
+		}
+
+		if entry.role != nil {
+			roles = append(roles, entry.role)
+		}
+	}
+	service.RUnlock()
+
+	if len(missing) == 0 {
+		return
+	}
+
+	fetched, err := service.service.FindByIDs(missing)
+	if err != nil {
+		roles = nil
+		return
+	}
+
+	entries := make(map[string]cachedRole, len(missing))
+	expiredAt := now.Add(service.ttl)
+	for _, id := range missing {
+		entries[id] = cachedRole{nil, expiredAt}
+	}
+
+	cacheable := true
+	for _, role := range fetched {
+		roles = append(roles, role)
+		switch identified, ok := role.(IdentifiedRole); {
+		case ok:
+			entries[identified.GetID()] = cachedRole{role, expiredAt}
+		case len(missing) == 1:
+			entries[missing[0]] = cachedRole{role, expiredAt}
+		default:
+			cacheable = false
+		}
+	}
+
+	service.Lock()
+	defer service.Unlock()
+
+	// roles invalidated while being fetched are not cached, they may be stale
+	if !cacheable || *service.generation != generation {
+		return
+	}
+
+	for id, entry := range entries {
+		service.entries[id] = entry
+	}
+	return
+}
+
+// Invalidate removes the cached roles
+func (service CachedRoleService) Invalidate(roleIDs ...string) {
+	service.Lock()
+	defer service.Unlock()
+
+	*service.generation++
+	for _, id := range roleIDs {
+		delete(service.entries, id)
+	}
+}
+
+// Flush removes every cached role
+func (service CachedRoleService) Flush() {
+	service.Lock()
+	defer service.Unlock()
+
+	*service.generation++
+	for id := range service.entries {
+		delete(service.entries, id)
+	}
+}
+
+// manager returns the cached role service as a role manager
+func (service CachedRoleService) manager() (manager RoleManager, err error) {
+	manager, ok := service.service.(RoleManager)
+	if !ok {
+		err = errors.New("role service does not support changes")
+	}
+	return
+}
+
+// change applies a change on a role using the role manager and invalidates the role
+func (service CachedRoleService) change(id string, fn func(RoleManager) error) error {
+	manager, err := service.manager()
+	if err != nil {
+		return err
+	}
+
+	defer service.Invalidate(id)
+	return fn(manager)
+}
+
+// CreateRole creates a role with the role manager
+func (service CachedRoleService) CreateRole(id string, abilities []UserAbility) error {
+	return service.change(id, func(manager RoleManager) error {
+		return manager.CreateRole(id, abilities)
+	})
+}
+
+// UpdateRole replaces the abilities of a role with the role manager
+func (service CachedRoleService) UpdateRole(id string, abilities []UserAbility) error {
+	return service.change(id, func(manager RoleManager) error {
+		return manager.UpdateRole(id, abilities)
+	})
+}
+
+// DeleteRole deletes a role with the role manager
+func (service CachedRoleService) DeleteRole(id string) error {
+	return service.change(id, func(manager RoleManager) error {
+		return manager.DeleteRole(id)
+	})
+}
+
+// AttachAbility grants an ability to a role with the role manager
+func (service CachedRoleService) AttachAbility(id string, ability UserAbility) error {
+	return service.change(id, func(manager RoleManager) error {
+		return manager.AttachAbility(id, ability)
+	})
+}
+
+// DetachAbility revokes an ability from a role with the role manager
+func (service CachedRoleService) DetachAbility(id string, ability UserAbility) error {
+	return service.change(id, func(manager RoleManager) error {
+		return manager.DetachAbility(id, ability)
+	})
+}
+
+// NewCachedRoleService is the constructor for CachedRoleService
+func NewCachedRoleService(service RoleService, ttl time.Duration) CachedRoleService {
+	return CachedRoleService{
+		service:    service,
+		ttl:        ttl,
+		entries:    map[string]cachedRole{},
+		generation: new(int),
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+		RWMutex: &sync.RWMutex{},
+	}
+}
+
+// InvalidationBus is the getter for the invalidation bus
+func (dependencies Dependencies) InvalidationBus() InvalidationBus {
+	return dependencies.invalidationBus
+}
+
+// SetInvalidationBus is the setter for the invalidation bus broadcasting role changes across instances. There is no bus by default
+func (dependencies *Dependencies) SetInvalidationBus(bus InvalidationBus) {
+	dependencies.invalidationBus = bus
+}
+
+// InvalidationListener is the getter for the subscription to the invalidation bus
+func (dependencies Dependencies) InvalidationListener() InvalidationListener {
+	return dependencies.invalidationListener
+}
+
+// SetInvalidationListener is the setter for the subscription to the invalidation bus
+func (dependencies *Dependencies) SetInvalidationListener(listener InvalidationListener) {
+	dependencies.invalidationListener = listener
+}
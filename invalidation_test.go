@@ -0,0 +1,126 @@
+package gate
+
+import (
+	"testing"
+	"time"
+)
+
+type testIdentifiedRole struct {
+	testRole
+	id string
+}
+
+func (role testIdentifiedRole) GetID() string {
+	return role.id
+}
+
+type testCountingRoleService struct {
+	roles map[string][]UserAbility
+	calls *int
+}
+
+func (service testCountingRoleService) FindByIDs(ids []string) (roles []Role, err error) {
+	*service.calls++
+	for _, id := range ids {
+		if abilities, ok := service.roles[id]; ok {
+			roles = append(roles, testIdentifiedRole{testRole{abilities}, id})
+		}
+	}
+	return
+}
+
+func (service testCountingRoleService) UpdateRole(id string, abilities []UserAbility) error {
+	service.roles[id] = abilities
+	return nil
+}
+
+func (service testCountingRoleService) CreateRole(id string, abilities []UserAbility) error {
+	return service.UpdateRole(id, abilities)
+}
+
+func (service testCountingRoleService) DeleteRole(id string) error {
+	delete(service.roles, id)
+	return nil
+}
+
+func (service testCountingRoleService) AttachAbility(id string, ability UserAbility) error {
+	return service.UpdateRole(id, append(service.roles[id], ability))
+}
+
+func (service testCountingRoleService) DetachAbility(id string, ability UserAbility) error {
+	return nil
+}
+
+func TestCachedRoleService(t *testing.T) {
+	calls := 0
+	source := testCountingRoleService{map[string][]UserAbility{"editor": {testAbility{"GET", "posts"}}}, &calls}
+	service := NewCachedRoleService(source, time.Minute)
+	now := time.Now()
+	service.Now = func() time.Time {
+		return now
+	}
+
+	for i := 0; i < 3; i++ {
+		roles, err := service.FindByIDs([]string{"editor", "missing"})
+		if err != nil || len(roles) != 1 {
+			t.Fatalf("roles should be found: %v %v", roles, err)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("roles should be fetched once, missing roles included: %d", calls)
+	}
+
+	t.Run("changes", func(t *testing.T) {
+		if err := service.AttachAbility("editor", testAbility{"POST", "posts"}); err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		roles, _ := service.FindByIDs([]string{"editor"})
+		if len(roles) != 1 || len(roles[0].GetAbilities()) != 2 || calls != 2 {
+			t.Fatalf("changed roles should be fetched again: %v %d", roles, calls)
+		}
+
+		if err := NewCachedRoleService(testRoleService{}, time.Minute).DeleteRole("editor"); err == nil {
+			t.Fatal("err should not be nil because the role service does not support changes")
+		}
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		service.FindByIDs([]string{"editor"})
+		if calls != 3 {
+			t.Fatalf("expired roles should be fetched again: %d", calls)
+		}
+	})
+
+	t.Run("bus", func(t *testing.T) {
+		bus := NewMemoryInvalidationBus()
+		listener, err := NewInvalidationListener(bus, func(roleIDs []string) {
+			if len(roleIDs) == 0 {
+				service.Flush()
+				return
+			}
+
+			service.Invalidate(roleIDs...)
+		})
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		bus.Publish([]string{"editor"})
+		service.FindByIDs([]string{"editor"})
+		bus.Publish(nil)
+		service.FindByIDs([]string{"editor"})
+		if calls != 5 {
+			t.Fatalf("broadcast invalidations should invalidate the roles: %d", calls)
+		}
+
+		listener.Stop()
+		bus.Publish(nil)
+		service.FindByIDs([]string{"editor"})
+		if calls != 5 {
+			t.Fatalf("stopped listeners should not invalidate the roles: %d", calls)
+		}
+	})
+}
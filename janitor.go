@@ -0,0 +1,89 @@
+package gate
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenJanitor purges expired tokens of a TokenPurger periodically, so long-running deployments do not accumulate dead tokens
+type TokenJanitor struct {
+	purger    TokenPurger
+	clock     Clock
+	retention time.Duration
+	onPurge   func(int, error)
+	stop      chan struct{}
+	stopOnce  *sync.Once
+	done      chan struct{}
+}
+
+// Enabled reports whether the janitor is running
+func (janitor TokenJanitor) Enabled() bool {
+	return janitor.stop != nil
+}
+
+// Purge purges the tokens expired for longer than the retention
+func (janitor TokenJanitor) Purge() (int, error) {
+	return janitor.purger.PurgeExpired(janitor.clock.Now().Add(-janitor.retention))
+}
+
+// Stop stops the janitor and waits until a running purge finishes, e.g. on shutdown. Stopping a stopped janitor has no effect
+func (janitor TokenJanitor) Stop() {
+	if !janitor.Enabled() {
+		return
+	}
+
+	janitor.stopOnce.Do(func() {
+		close(janitor.stop)
+	})
+	<-janitor.done
+}
+
+func (janitor TokenJanitor) run(interval time.Duration) {
+	defer close(janitor.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-janitor.stop:
+			return
+		case <-ticker.C:
+			purged, err := janitor.Purge()
+			if janitor.onPurge != nil {
+				janitor.onPurge(purged, err)
+			}
+		}
+	}
+}
+
+// NewTokenJanitor is the constructor for TokenJanitor. It starts purging the tokens expired for longer than the retention every interval
+// and reports the results to the handler, if any. The system clock is used without a clock
+func NewTokenJanitor(purger TokenPurger, clock Clock, interval, retention time.Duration, onPurge func(int, error)) TokenJanitor {
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	janitor := TokenJanitor{
+		purger:    purger,
+		clock:     clock,
+		retention: retention,
+		onPurge:   onPurge,
+		stop:      make(chan struct{}),
+		stopOnce:  &sync.Once{},
+		done:      make(chan struct{}),
+	}
+
+	go janitor.run(interval)
+	return janitor
+}
+
+// TokenJanitor is the getter for the token janitor
+func (dependencies Dependencies) TokenJanitor() TokenJanitor {
+	return dependencies.tokenJanitor
+}
+
+// SetTokenJanitor is the setter for the token janitor
+func (dependencies *Dependencies) SetTokenJanitor(janitor TokenJanitor) {
+	dependencies.tokenJanitor = janitor
+}
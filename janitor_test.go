@@ -0,0 +1,70 @@
+package gate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type purgeFunc func(before time.Time) (int, error)
+
+func (f purgeFunc) PurgeExpired(before time.Time) (int, error) {
+	return f(before)
+}
+
+func (f purgeFunc) CountByUser(userID string) (int, error) {
+	return 0, nil
+}
+
+func TestTokenJanitor(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := ClockFunc(func() time.Time {
+		return now
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		var cutoff time.Time
+		janitor := NewTokenJanitor(purgeFunc(func(before time.Time) (int, error) {
+			cutoff = before
+			return 2, nil
+		}), clock, time.Hour, time.Minute, nil)
+		defer janitor.Stop()
+
+		purged, err := janitor.Purge()
+		if err != nil || purged != 2 {
+			t.Fatalf("tokens should be purged: %d %v", purged, err)
+		}
+
+		if !cutoff.Equal(now.Add(-time.Minute)) {
+			t.Fatalf("tokens should be kept for the retention: %s", cutoff)
+		}
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		results := make(chan error, 10)
+		errPurge := errors.New("purge failed")
+		janitor := NewTokenJanitor(purgeFunc(func(before time.Time) (int, error) {
+			return 0, errPurge
+		}), nil, time.Millisecond, 0, func(purged int, err error) {
+			results <- err
+		})
+
+		select {
+		case err := <-results:
+			if err != errPurge {
+				t.Fatalf("the failure should be reported: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("tokens should be purged every interval")
+		}
+
+		janitor.Stop()
+		if !janitor.Enabled() {
+			t.Fatal("a started janitor should be enabled")
+		}
+
+		if (TokenJanitor{}).Enabled() {
+			t.Fatal("the zero value should be disabled")
+		}
+	})
+}
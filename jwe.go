@@ -0,0 +1,295 @@
+package gate
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// JWE key management algorithms
+const (
+	JWEAlgorithmRSAOAEP    = "RSA-OAEP"
+	JWEAlgorithmRSAOAEP256 = "RSA-OAEP-256"
+	JWEAlgorithmECDHES     = "ECDH-ES"
+)
+
+// JWEEncryptionA256GCM is the only supported JWE content encryption algorithm
+const JWEEncryptionA256GCM = "A256GCM"
+
+// ErrMalformedJWE is thrown when an encrypted token is not a valid compact JWE
+var ErrMalformedJWE = errors.New("malformed JWE")
+
+// JWEConfig is the configuration for encrypted JWTs (compact JWE with A256GCM content encryption)
+type JWEConfig struct {
+	alg        string
+	encryptKey interface{}
+	decryptKey interface{}
+}
+
+type jweHeader struct {
+	Alg string  `json:"alg"`
+	Enc string  `json:"enc"`
+	Cty string  `json:"cty,omitempty"`
+	Epk *jwkKey `json:"epk,omitempty"`
+}
+
+type jwkKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewJWEConfig is the constructor for JWEConfig.
+// RSA-OAEP and RSA-OAEP-256 use an *rsa.PublicKey to encrypt and an *rsa.PrivateKey to decrypt,
+// ECDH-ES uses an *ecdsa.PublicKey to encrypt and an *ecdsa.PrivateKey to decrypt
+func NewJWEConfig(alg string, encryptKey, decryptKey interface{}) (config JWEConfig, err error) {
+	switch alg {
+	default:
+		err = errors.New("invalid JWE algorithm")
+		return
+	case JWEAlgorithmRSAOAEP, JWEAlgorithmRSAOAEP256:
+		_, encryptOK := encryptKey.(*rsa.PublicKey)
+		_, decryptOK := decryptKey.(*rsa.PrivateKey)
+		if !encryptOK || !decryptOK {
+			err = errors.New("invalid JWE key")
+			return
+		}
+	case JWEAlgorithmECDHES:
+		_, encryptOK := encryptKey.(*ecdsa.PublicKey)
+		_, decryptOK := decryptKey.(*ecdsa.PrivateKey)
+		if !encryptOK || !decryptOK {
+			err = errors.New("invalid JWE key")
+			return
+		}
+	}
+
+	config = JWEConfig{alg, encryptKey, decryptKey}
+	return
+}
+
+// Enabled reports whether the encryption is configured
+func (config JWEConfig) Enabled() bool {
+	return config.alg != ""
+}
+
+// Encrypt encrypts a payload, e.g. a signed JWT, into a compact JWE
+func (config JWEConfig) Encrypt(payload string) (result string, err error) {
+	header := jweHeader{Alg: config.alg, Enc: JWEEncryptionA256GCM, Cty: "JWT"}
+
+	var cek, encryptedKey []byte
+	switch config.alg {
+	default:
+		err = errors.New("invalid JWE algorithm")
+		return
+	case JWEAlgorithmRSAOAEP, JWEAlgorithmRSAOAEP256:
+		cek = make([]byte, 32)
+		if _, err = rand.Read(cek); err != nil {
+			return
+		}
+
+		encryptedKey, err = rsa.EncryptOAEP(config.oaepHash(), rand.Reader, config.encryptKey.(*rsa.PublicKey), cek, nil)
+		if err != nil {
+			return
+		}
+	case JWEAlgorithmECDHES:
+		public := config.encryptKey.(*ecdsa.PublicKey)
+		ephemeral, genErr := ecdsa.GenerateKey(public.Curve, rand.Reader)
+		if genErr != nil {
+			err = genErr
+			return
+		}
+
+		header.Epk = &jwkKey{
+			Kty: "EC",
+			Crv: public.Curve.Params().Name,
+			X:   encodeCoordinate(ephemeral.X, public.Curve),
+			Y:   encodeCoordinate(ephemeral.Y, public.Curve),
+		}
+		cek = deriveECDHESKey(public.Curve, public.X, public.Y, ephemeral.D.Bytes())
+	}
+
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return
+	}
+
+	encodedHeader := base64.RawURLEncoding.EncodeToString(headerData)
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return
+	}
+
+	iv := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(iv); err != nil {
+		return
+	}
+
+	sealed := gcm.Seal(nil, iv, []byte(payload), []byte(encodedHeader))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	result = strings.Join([]string{
+		encodedHeader,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, ".")
+	return
+}
+
+// Decrypt decrypts a compact JWE into its payload
+func (config JWEConfig) Decrypt(str string) (payload string, err error) {
+	segments := strings.Split(str, ".")
+	if len(segments) != 5 {
+		err = ErrMalformedJWE
+		return
+	}
+
+	parts := make([][]byte, 5)
+	for i, segment := range segments {
+		parts[i], err = base64.RawURLEncoding.DecodeString(segment)
+		if err != nil {
+			err = ErrMalformedJWE
+			return
+		}
+	}
+
+	var header jweHeader
+	err = json.Unmarshal(parts[0], &header)
+	if err != nil {
+		err = ErrMalformedJWE
+		return
+	}
+
+	if header.Alg != config.alg || header.Enc != JWEEncryptionA256GCM {
+		err = errors.New("unexpected JWE algorithm")
+		return
+	}
+
+	var cek []byte
+	switch config.alg {
+	case JWEAlgorithmRSAOAEP, JWEAlgorithmRSAOAEP256:
+		cek, err = rsa.DecryptOAEP(config.oaepHash(), rand.Reader, config.decryptKey.(*rsa.PrivateKey), parts[1], nil)
+		if err != nil {
+			err = errors.Wrap(err, "could not decrypt the content encryption key")
+			return
+		}
+	case JWEAlgorithmECDHES:
+		private := config.decryptKey.(*ecdsa.PrivateKey)
+		x, y, keyErr := decodeEphemeralKey(header.Epk, private.Curve)
+		if keyErr != nil {
+			err = keyErr
+			return
+		}
+
+		cek = deriveECDHESKey(private.Curve, x, y, private.D.Bytes())
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return
+	}
+
+	if len(parts[2]) != gcm.NonceSize() {
+		err = ErrMalformedJWE
+		return
+	}
+
+	data, err := gcm.Open(nil, parts[2], append(parts[3], parts[4]...), []byte(segments[0]))
+	if err != nil {
+		err = errors.Wrap(err, "could not decrypt JWE")
+		return
+	}
+
+	payload = string(data)
+	return
+}
+
+func (config JWEConfig) oaepHash() hash.Hash {
+	if config.alg == JWEAlgorithmRSAOAEP {
+		return sha1.New()
+	}
+
+	return sha256.New()
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func encodeCoordinate(value *big.Int, curve elliptic.Curve) string {
+	size := (curve.Params().BitSize + 7) / 8
+	data := value.Bytes()
+	padded := make([]byte, size)
+	copy(padded[size-len(data):], data)
+	return base64.RawURLEncoding.EncodeToString(padded)
+}
+
+func decodeEphemeralKey(key *jwkKey, curve elliptic.Curve) (x, y *big.Int, err error) {
+	if key == nil || key.Kty != "EC" || key.Crv != curve.Params().Name {
+		err = errors.New("invalid JWE ephemeral key")
+		return
+	}
+
+	xData, xErr := base64.RawURLEncoding.DecodeString(key.X)
+	yData, yErr := base64.RawURLEncoding.DecodeString(key.Y)
+	if xErr != nil || yErr != nil {
+		err = errors.New("invalid JWE ephemeral key")
+		return
+	}
+
+	x, y = new(big.Int).SetBytes(xData), new(big.Int).SetBytes(yData)
+	if !curve.IsOnCurve(x, y) {
+		err = errors.New("invalid JWE ephemeral key")
+	}
+	return
+}
+
+// deriveECDHESKey derives the A256GCM key from the ECDH shared secret with the Concat KDF of RFC 7518, section 4.6.2
+func deriveECDHESKey(curve elliptic.Curve, x, y *big.Int, scalar []byte) []byte {
+	sharedX, _ := curve.ScalarMult(x, y, scalar)
+	size := (curve.Params().BitSize + 7) / 8
+	z := make([]byte, size)
+	sharedData := sharedX.Bytes()
+	copy(z[size-len(sharedData):], sharedData)
+
+	lengthPrefixed := func(data []byte) []byte {
+		result := make([]byte, 4+len(data))
+		binary.BigEndian.PutUint32(result, uint32(len(data)))
+		copy(result[4:], data)
+		return result
+	}
+
+	var otherInfo []byte
+	otherInfo = append(otherInfo, lengthPrefixed([]byte(JWEEncryptionA256GCM))...)
+	otherInfo = append(otherInfo, lengthPrefixed(nil)...)
+	otherInfo = append(otherInfo, lengthPrefixed(nil)...)
+	keyLength := make([]byte, 4)
+	binary.BigEndian.PutUint32(keyLength, 256)
+	otherInfo = append(otherInfo, keyLength...)
+
+	digest := sha256.New()
+	digest.Write([]byte{0, 0, 0, 1})
+	digest.Write(z)
+	digest.Write(otherInfo)
+	return digest.Sum(nil)
+}
@@ -0,0 +1,99 @@
+package gate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+)
+
+func TestJWE(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs := map[string]func() (JWEConfig, error){
+		JWEAlgorithmRSAOAEP: func() (JWEConfig, error) {
+			return NewJWEConfig(JWEAlgorithmRSAOAEP, &rsaKey.PublicKey, rsaKey)
+		},
+		JWEAlgorithmRSAOAEP256: func() (JWEConfig, error) {
+			return NewJWEConfig(JWEAlgorithmRSAOAEP256, &rsaKey.PublicKey, rsaKey)
+		},
+		JWEAlgorithmECDHES: func() (JWEConfig, error) {
+			return NewJWEConfig(JWEAlgorithmECDHES, &ecKey.PublicKey, ecKey)
+		},
+	}
+
+	for alg, newConfig := range configs {
+		t.Run(alg, func(t *testing.T) {
+			encryption, err := newConfig()
+			if err != nil {
+				t.Fatalf("err should be nil because of the valid configuration: %s", err)
+			}
+
+			service, config := newTestJWTService(t)
+			config.SetEncryption(encryption)
+			encrypted := NewJWTService(config)
+
+			token, err := encrypted.Issue(encrypted.NewClaims(testUser(UserInfo{ID: "id", Username: "secret-username"})))
+			if err != nil {
+				t.Fatalf("err should be nil: %s", err)
+			}
+
+			if strings.Count(token.Value, ".") != 4 {
+				t.Fatalf("the token should be a compact JWE: %s", token.Value)
+			}
+
+			parsed, err := encrypted.Parse(token.Value)
+			if err != nil {
+				t.Fatalf("err should be nil because of the valid token: %s", err)
+			}
+
+			if parsed.UserID != "id" || parsed.Value != token.Value {
+				t.Fatalf("invalid token: %+v", parsed)
+			}
+
+			plain, err := service.Issue(service.NewClaims(testUser(UserInfo{ID: "id"})))
+			if err != nil {
+				t.Fatalf("err should be nil: %s", err)
+			}
+
+			_, err = encrypted.Parse(plain.Value)
+			if err == nil {
+				t.Fatal("err should not be nil because of the unencrypted token")
+			}
+
+			segments := strings.Split(token.Value, ".")
+			tampered := "A"
+			if segments[3][0] == 'A' {
+				tampered = "B"
+			}
+
+			segments[3] = tampered + segments[3][1:]
+			_, err = encrypted.Parse(strings.Join(segments, "."))
+			if err == nil {
+				t.Fatal("err should not be nil because of the tampered ciphertext")
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewJWEConfig("dir", nil, nil)
+		if err == nil {
+			t.Fatal("err should not be nil because of the unsupported algorithm")
+		}
+
+		_, err = NewJWEConfig(JWEAlgorithmECDHES, &rsaKey.PublicKey, rsaKey)
+		if err == nil {
+			t.Fatal("err should not be nil because of the invalid keys")
+		}
+	})
+}
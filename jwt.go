@@ -3,18 +3,47 @@ package gate
 import (
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"encoding/json"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
-	"github.com/satori/go.uuid"
 )
 
+// DefaultMaxJWTLength is the default maximum length of a JWT string
+const DefaultMaxJWTLength = 16 * 1024
+
+// ErrMalformedJWT is thrown when a JWT string is not made of three base64url-encoded segments
+var ErrMalformedJWT = errors.New("malformed JWT")
+
+// ErrJWTTooLarge is thrown when a JWT string exceeds the maximum length
+var ErrJWTTooLarge = errors.New("JWT is too large")
+
+// ErrClaimsTooLarge is thrown when the decoded JWT claims exceed the maximum size
+var ErrClaimsTooLarge = errors.New("JWT claims are too large")
+
+// ErrUnsupportedCriticalHeader is thrown when a JWT marks an unsupported header as critical
+var ErrUnsupportedCriticalHeader = errors.New("unsupported critical JWT header")
+
+// ErrUnexpectedJWTType is thrown when a JWT has the type of another kind of signatures, e.g. WebhookType
+var ErrUnexpectedJWTType = errors.New("unexpected JWT type")
+
+// ErrAlgorithmNotAllowed is thrown when the algorithm of a JWT is not in the allowed algorithms
+var ErrAlgorithmNotAllowed = errors.New("JWT algorithm is not allowed")
+
+// ErrAlgorithmNone is thrown when an unsecured JWT is presented or configured
+var ErrAlgorithmNone = errors.New(`the "none" JWT algorithm is refused`)
+
 // JWTService is the service which manages JWTs
 type JWTService struct {
 	config           JWTConfig
 	Now              func() time.Time
 	GenerateClaimsID func() string
+	pool             *VerificationPool
+	parser           *jwt.Parser
+	reload           *jwtReload
 }
 
 // JWTConfig is the configuration for JWT service
@@ -24,21 +53,44 @@ type JWTConfig struct {
 	verifyKey            interface{}
 	expiration           time.Duration
 	skipClaimsValidation bool
+	idGenerator          IDGenerator
+	maxLength            int
+	maxClaimsSize        int
+	criticalHeaders      []string
+	allowedAlgorithms    []string
+	encryption           JWEConfig
+	codec                TokenCodec
+	projection           ClaimsProjection
+	migrations           ClaimsMigrations
+	legacyUntil          time.Time
+	validators           []ClaimsValidator
+	keys                 KeyProvider
 }
 
 // JWTClaims are JWT claims with user's information
 type JWTClaims struct {
-	User UserInfo `json:"user"`
+	Version   int            `json:"ver,omitempty"`
+	User      UserInfo       `json:"user"`
+	SingleUse bool           `json:"single_use,omitempty"`
+	Actor     *Actor         `json:"act,omitempty"`
+	Abilities []AbilityClaim `json:"abilities,omitempty"`
+	// ScopeChain holds the abilities of the scoped tokens the token is derived from, every one of them restricting the token as well
+	ScopeChain [][]AbilityClaim `json:"scope_chain,omitempty"`
 	jwt.StandardClaims
 }
 
 // JWT is the JSON Web Token
 type JWT struct {
-	ID        string
-	Value     string
-	UserID    string
-	ExpiredAt time.Time
-	IssuedAt  time.Time
+	ID         string
+	Value      string
+	UserID     string
+	User       UserInfo
+	ExpiredAt  time.Time
+	IssuedAt   time.Time
+	SingleUse  bool
+	Actor      *Actor
+	Abilities  []AbilityClaim
+	ScopeChain [][]AbilityClaim
 }
 
 // NewHMACJWTConfig is the constructor for JWTConfig using HMAC signing method
@@ -49,52 +101,210 @@ func NewHMACJWTConfig(alg string, key interface{}, expiration time.Duration, ski
 		return
 	}
 
-	config = JWTConfig{method, key, key, expiration, skipClaimsValidation}
+	if method == jwt.SigningMethodNone {
+		err = ErrAlgorithmNone
+		return
+	}
+
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		if keyStr, ok := key.(string); !ok || keyStr == "" {
+			err = errors.New("invalid JWT key")
+			return
+		}
+	}
+
+	config = JWTConfig{
+		method:               method,
+		signKey:              key,
+		verifyKey:            verifyingKey(key),
+		expiration:           expiration,
+		skipClaimsValidation: skipClaimsValidation,
+		maxLength:            DefaultMaxJWTLength,
+	}
+	return
+}
+
+// NewCodecJWTConfig is the constructor for JWTConfig using a TokenCodec instead of JWT signing, e.g. PASETO
+func NewCodecJWTConfig(codec TokenCodec, expiration time.Duration, skipClaimsValidation bool) (config JWTConfig, err error) {
+	if codec == nil {
+		err = errors.New("invalid token codec")
+		return
+	}
+
+	config = JWTConfig{
+		expiration:           expiration,
+		skipClaimsValidation: skipClaimsValidation,
+		maxLength:            DefaultMaxJWTLength,
+		codec:                codec,
+	}
+	return
+}
+
+// NewJWTConfigWithConfig is the constructor for JWTConfig using the JWT options of the given configuration.
+// The signing algorithm is ignored when the configuration has a token codec or a key provider
+func NewJWTConfigWithConfig(alg string, config Config) (jwtConfig JWTConfig, err error) {
+	switch {
+	case config.TokenCodec() != nil:
+		jwtConfig, err = NewCodecJWTConfig(config.TokenCodec(), config.JWTExpiration(), config.JWTSkipClaimsValidation())
+	case config.JWTKeyProvider() != nil:
+		jwtConfig, err = NewKeyProviderJWTConfig(config.JWTKeyProvider(), config.JWTExpiration(), config.JWTSkipClaimsValidation())
+	default:
+		jwtConfig, err = NewHMACJWTConfig(alg, config.JWTSigningKey(), config.JWTExpiration(), config.JWTSkipClaimsValidation())
+	}
+	if err != nil {
+		return
+	}
+
+	jwtConfig.SetMaxLength(config.JWTMaxLength())
+	jwtConfig.SetMaxClaimsSize(config.JWTMaxClaimsSize())
+	jwtConfig.SetAllowedAlgorithms(config.JWTAllowedAlgorithms())
+	jwtConfig.SetEncryption(config.JWTEncryption())
+	jwtConfig.SetClaimsProjection(config.ClaimsProjection())
+	jwtConfig.SetClaimsMigrations(config.ClaimsMigrations())
+	jwtConfig.SetLegacyClaimsUntil(config.LegacyClaimsUntil())
+	jwtConfig.SetClaimsValidators(config.ClaimsValidators()...)
 	return
 }
 
+// SetMaxLength is the setter for the maximum length of JWT strings, DefaultMaxJWTLength by default. Zero disables the limit
+func (config *JWTConfig) SetMaxLength(length int) {
+	config.maxLength = length
+}
+
+// SetMaxClaimsSize is the setter for the maximum size in bytes of decoded JWT claims. Zero, the default, disables the limit
+func (config *JWTConfig) SetMaxClaimsSize(size int) {
+	config.maxClaimsSize = size
+}
+
+// SetAllowedAlgorithms is the setter for the algorithms accepted on verification, e.g. []string{"HS256"}.
+// When set, any JWT whose "alg" header is not explicitly listed is refused, preventing algorithm confusion.
+// Otherwise, any algorithm of the configured family is accepted
+func (config *JWTConfig) SetAllowedAlgorithms(algorithms []string) {
+	config.allowedAlgorithms = algorithms
+}
+
+// AllowedAlgorithms is the getter for the algorithms accepted on verification
+func (config JWTConfig) AllowedAlgorithms() []string {
+	return config.allowedAlgorithms
+}
+
+// SetEncryption is the setter for the JWT encryption. When enabled, issued JWTs are encrypted as compact JWEs
+// and only encrypted JWTs are accepted, decrypted and then verified
+func (config *JWTConfig) SetEncryption(encryption JWEConfig) {
+	config.encryption = encryption
+}
+
+// SetClaimsProjection is the setter for the user information embedded in the claims of issued tokens, all of it by default
+func (config *JWTConfig) SetClaimsProjection(projection ClaimsProjection) {
+	config.projection = projection
+}
+
+// SetCodec is the setter for the token codec. When set, tokens are encoded and decoded by the codec
+// and the JWT-specific options (signing, encryption, algorithms and headers) are ignored
+func (config *JWTConfig) SetCodec(codec TokenCodec) {
+	config.codec = codec
+}
+
+// SetCriticalHeaders is the setter for the header names accepted in the "crit" header. JWTs with critical headers are refused by default
+func (config *JWTConfig) SetCriticalHeaders(headers []string) {
+	config.criticalHeaders = headers
+}
+
+// SetVerifyingKey is the setter for the verifying key, the signing key by default.
+// The public key of an *rsa.PrivateKey or an *ecdsa.PrivateKey is derived once so it is not derived on every verification
+func (config *JWTConfig) SetVerifyingKey(key interface{}) {
+	config.verifyKey = verifyingKey(key)
+}
+
+// verifyingKey returns the public key of asymmetric private keys and other keys as they are
+func verifyingKey(key interface{}) interface{} {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	case *ecdsa.PrivateKey:
+		return &key.PublicKey
+	}
+
+	return key
+}
+
+// SetIDGenerator is the setter for the claims ID generator. UUIDGenerator is used by default
+func (config *JWTConfig) SetIDGenerator(generator IDGenerator) {
+	config.idGenerator = generator
+}
+
 // NewJWTService is the constructor for JWTService
 func NewJWTService(config JWTConfig) JWTService {
-	return JWTService{
+	generator := config.idGenerator
+	if generator == nil {
+		generator = UUIDGenerator
+	}
+
+	service := JWTService{
 		config,
 		func() time.Time {
 			return time.Now().Local()
 		},
-		func() string {
-			return uuid.NewV4().String()
-		},
+		generator,
+		nil,
+		nil,
+		&jwtReload{},
 	}
+	service.parser = service.newParser()
+	return service
 }
 
 // NewTokenFromClaims constructs a token from JWT claims
 func (service JWTService) NewTokenFromClaims(claims JWTClaims) (token JWT) {
 	token.ID = claims.Id
 	token.UserID = claims.User.ID
+	token.User = claims.User
 	token.ExpiredAt = time.Unix(claims.ExpiresAt, 0)
 	token.IssuedAt = time.Unix(claims.IssuedAt, 0)
+	token.SingleUse = claims.SingleUse
+	token.Actor = claims.Actor
+	token.Abilities = claims.Abilities
+	token.ScopeChain = claims.ScopeChain
 	return
 }
 
 // Issue generates a token from JWT claims with the service configuration
 func (service JWTService) Issue(claims JWTClaims) (token JWT, err error) {
-	obj := jwt.NewWithClaims(service.config.method, claims)
-	if obj == nil {
-		err = errors.New("could not create JWT")
-		return
+	service = service.current()
+	if service.config.codec != nil {
+		return service.issueWithCodec(claims)
 	}
 
-	key, err := service.getSigningKey()
+	method, key, kid, err := service.signingKey()
 	if err != nil {
 		err = errors.Wrap(err, "could not sign JWT")
 		return
 	}
 
+	obj := jwt.NewWithClaims(method, claims)
+	if obj == nil {
+		err = errors.New("could not create JWT")
+		return
+	}
+
+	if kid != "" {
+		obj.Header["kid"] = kid
+	}
+
 	str, err := obj.SignedString(key)
 	if err != nil {
 		err = errors.Wrap(err, "could not sign JWT")
 		return
 	}
 
+	if service.config.encryption.Enabled() {
+		str, err = service.config.encryption.Encrypt(str)
+		if err != nil {
+			err = errors.Wrap(err, "could not encrypt JWT")
+			return
+		}
+	}
+
 	token = service.NewTokenFromClaims(claims)
 	token.Value = str
 	return
@@ -102,11 +312,84 @@ func (service JWTService) Issue(claims JWTClaims) (token JWT, err error) {
 
 // Parse resolves a token string to a JWT with the service configuration
 func (service JWTService) Parse(tokenString string) (token JWT, err error) {
-	parser := new(jwt.Parser)
-	parser.SkipClaimsValidation = service.config.skipClaimsValidation
-	obj, err := parser.ParseWithClaims(tokenString, &JWTClaims{}, service.getVerifyingKey)
+	if service.pool != nil {
+		return service.pool.Parse(tokenString)
+	}
+
+	service = service.current()
+	parser := service.parser
+	if parser == nil {
+		parser = service.newParser()
+	}
+
+	return service.parseOverlapping(parser, tokenString)
+}
+
+// newParser returns a JWT parser with the service configuration. Parsers are not modified by parsing, hence they are reused.
+// Claims are validated by the service with its clock instead of the parser
+func (service JWTService) newParser() *jwt.Parser {
+	return &jwt.Parser{
+		ValidMethods:         service.config.allowedAlgorithms,
+		SkipClaimsValidation: true,
+	}
+}
+
+// validateClaims validates the time-based claims against the clock of the service unless the validation is skipped
+func (service JWTService) validateClaims(claims JWTClaims) error {
+	if service.config.skipClaimsValidation {
+		return nil
+	}
+
+	now := service.Now().Unix()
+	switch {
+	case !claims.VerifyExpiresAt(now, false):
+		return jwt.NewValidationError("token is expired", jwt.ValidationErrorExpired)
+	case !claims.VerifyIssuedAt(now, false):
+		return jwt.NewValidationError("token used before issued", jwt.ValidationErrorIssuedAt)
+	case !claims.VerifyNotBefore(now, false):
+		return jwt.NewValidationError("token is not valid yet", jwt.ValidationErrorNotValidYet)
+	}
+
+	return nil
+}
+
+func (service JWTService) parse(parser *jwt.Parser, tokenString string) (token JWT, err error) {
+	if service.config.maxLength > 0 && len(tokenString) > service.config.maxLength {
+		err = wrapLazily(ErrJWTTooLarge, "could not parse JWT")
+		return
+	}
+
+	if service.config.codec != nil {
+		return service.parseWithCodec(tokenString)
+	}
+
+	signed := tokenString
+	if service.config.encryption.Enabled() {
+		signed, err = service.config.encryption.Decrypt(tokenString)
+		if err != nil {
+			err = wrapLazily(err, "could not decrypt JWT")
+			return
+		}
+	}
+
+	err = service.inspect(signed)
+	if err != nil {
+		err = wrapLazily(err, "could not parse JWT")
+		return
+	}
+
+	claims := claimsPool.Get().(*JWTClaims)
+	defer func() {
+		*claims = JWTClaims{}
+		claimsPool.Put(claims)
+	}()
+
+	obj, err := parser.ParseWithClaims(signed, claims, service.getVerifyingKey)
+	if service.config.outdated(*claims, err) {
+		obj, err = service.parseMigrating(parser, signed, claims)
+	}
 	if err != nil {
-		err = errors.Wrap(err, "could not parse JWT")
+		err = wrapLazily(err, "could not parse JWT")
 		return
 	}
 
@@ -115,22 +398,191 @@ func (service JWTService) Parse(tokenString string) (token JWT, err error) {
 		return
 	}
 
-	claims, ok := obj.Claims.(*JWTClaims)
-	if !ok {
-		err = errors.New("invalid claims")
+	err = service.validateClaims(*claims)
+	if err == nil {
+		err = service.validateCustomClaims(*claims, claimsSegment(signed))
+	}
+	if err != nil {
+		err = wrapLazily(err, "could not parse JWT")
 		return
 	}
 
-	if claims == nil {
-		err = errors.New("invalid claims")
+	token = service.NewTokenFromClaims(*claims)
+	token.Value = tokenString
+	return
+}
+
+// claimsPool recycles the claims decoded by parsing. Tokens copy the claims, hence they are reset and reused once a token is made
+var claimsPool = sync.Pool{
+	New: func() interface{} {
+		return &JWTClaims{}
+	},
+}
+
+// lazyError annotates an error with a message without recording a stack trace, which keeps refused tokens cheap.
+// The message is only built when the error is formatted
+type lazyError struct {
+	cause   error
+	message string
+}
+
+func (err lazyError) Error() string {
+	return err.message + ": " + err.cause.Error()
+}
+
+// Cause returns the underlying error, see github.com/pkg/errors
+func (err lazyError) Cause() error {
+	return err.cause
+}
+
+func wrapLazily(err error, message string) error {
+	return lazyError{err, message}
+}
+
+func (service JWTService) issueWithCodec(claims JWTClaims) (token JWT, err error) {
+	str, err := service.config.codec.Encode(claims)
+	if err != nil {
+		err = errors.Wrap(err, "could not encode token")
 		return
 	}
 
-	token = service.NewTokenFromClaims(*claims)
+	token = service.NewTokenFromClaims(claims)
+	token.Value = str
+	return
+}
+
+func (service JWTService) parseWithCodec(tokenString string) (token JWT, err error) {
+	claims, err := service.config.codec.Decode(tokenString)
+	if err != nil {
+		err = errors.Wrap(err, "could not parse token")
+		return
+	}
+
+	err = service.validateClaims(claims)
+	if err == nil {
+		err = service.validateCustomClaims(claims, "")
+	}
+	if err != nil {
+		err = errors.Wrap(err, "invalid claims")
+		return
+	}
+
+	token = service.NewTokenFromClaims(claims)
 	token.Value = tokenString
 	return
 }
 
+// inspect checks a JWT string against the configured limits and refuses unsecured or unsupported JWTs before verification
+func (service JWTService) inspect(tokenString string) (err error) {
+	if service.config.maxLength > 0 && len(tokenString) > service.config.maxLength {
+		err = ErrJWTTooLarge
+		return
+	}
+
+	headerEnd := strings.IndexByte(tokenString, '.')
+	claimsEnd := headerEnd + 1 + strings.IndexByte(tokenString[headerEnd+1:], '.')
+	if headerEnd < 0 || claimsEnd <= headerEnd || strings.IndexByte(tokenString[claimsEnd+1:], '.') >= 0 {
+		err = ErrMalformedJWT
+		return
+	}
+
+	headerSegment, claimsSegment := tokenString[:headerEnd], tokenString[headerEnd+1:claimsEnd]
+	headerData, err := jwt.DecodeSegment(headerSegment)
+	if err != nil {
+		err = ErrMalformedJWT
+		return
+	}
+
+	var header struct {
+		Alg  string        `json:"alg"`
+		Typ  string        `json:"typ"`
+		Crit []interface{} `json:"crit"`
+	}
+
+	err = json.Unmarshal(headerData, &header)
+	if err != nil {
+		err = ErrMalformedJWT
+		return
+	}
+
+	if strings.EqualFold(header.Alg, "none") {
+		err = ErrAlgorithmNone
+		return
+	}
+
+	if !service.isAlgorithmAllowed(header.Alg) {
+		err = ErrAlgorithmNotAllowed
+		return
+	}
+
+	if header.Typ == WebhookType {
+		err = ErrUnexpectedJWTType
+		return
+	}
+
+	for _, name := range header.Crit {
+		if !service.isCriticalHeaderSupported(name) {
+			err = ErrUnsupportedCriticalHeader
+			return
+		}
+	}
+
+	if service.config.maxClaimsSize > 0 {
+		// the decoded size is at most 3/4 of the encoded size
+		if len(claimsSegment)/4*3 > service.config.maxClaimsSize+3 {
+			err = ErrClaimsTooLarge
+			return
+		}
+
+		claimsData, decodeErr := jwt.DecodeSegment(claimsSegment)
+		if decodeErr != nil {
+			err = ErrMalformedJWT
+			return
+		}
+
+		if len(claimsData) > service.config.maxClaimsSize {
+			err = ErrClaimsTooLarge
+			return
+		}
+	}
+
+	return
+}
+
+func (service JWTService) isAlgorithmAllowed(alg string) bool {
+	if len(service.config.allowedAlgorithms) == 0 {
+		return true
+	}
+
+	for _, allowed := range service.config.allowedAlgorithms {
+		if alg == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (service JWTService) isCriticalHeaderSupported(name interface{}) bool {
+	for _, supported := range service.config.criticalHeaders {
+		if name == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
+// signingKey returns the signing method, the signing key and the key ID, from the key provider if any
+func (service JWTService) signingKey() (method jwt.SigningMethod, key interface{}, kid string, err error) {
+	if service.config.keys != nil {
+		return service.providerSigningKey()
+	}
+
+	key, err = service.getSigningKey()
+	return service.config.method, key, "", err
+}
+
 func (service JWTService) getSigningKey() (key interface{}, err error) {
 	switch service.config.method.(type) {
 	default:
@@ -174,6 +626,10 @@ func (service JWTService) getSigningKey() (key interface{}, err error) {
 }
 
 func (service JWTService) getVerifyingKey(token *jwt.Token) (key interface{}, err error) {
+	if service.config.keys != nil {
+		return service.providerVerifyingKey(token)
+	}
+
 	switch service.config.method.(type) {
 	default:
 		err = errors.New("invalid algorithm")
@@ -198,7 +654,7 @@ func (service JWTService) getVerifyingKey(token *jwt.Token) (key interface{}, er
 			return
 		}
 
-		keyRSA, ok := service.config.verifyKey.(*rsa.PrivateKey)
+		keyRSA, ok := service.config.verifyKey.(*rsa.PublicKey)
 		if !ok {
 			err = errors.New("invalid key")
 			return
@@ -212,7 +668,7 @@ func (service JWTService) getVerifyingKey(token *jwt.Token) (key interface{}, er
 			return
 		}
 
-		keyRSA, ok := service.config.verifyKey.(*rsa.PrivateKey)
+		keyRSA, ok := service.config.verifyKey.(*rsa.PublicKey)
 		if !ok {
 			err = errors.New("invalid key")
 			return
@@ -226,7 +682,7 @@ func (service JWTService) getVerifyingKey(token *jwt.Token) (key interface{}, er
 			return
 		}
 
-		keyECDSA, ok := service.config.verifyKey.(*ecdsa.PrivateKey)
+		keyECDSA, ok := service.config.verifyKey.(*ecdsa.PublicKey)
 		if !ok {
 			err = errors.New("invalid key")
 			return
@@ -240,12 +696,10 @@ func (service JWTService) getVerifyingKey(token *jwt.Token) (key interface{}, er
 
 // NewClaims generates JWTClaims for a specific user
 func (service JWTService) NewClaims(user User) JWTClaims {
+	service = service.current()
 	return JWTClaims{
-		User: UserInfo{
-			ID:       user.GetID(),
-			Username: user.GetUsername(),
-			Roles:    user.GetRoles(),
-		},
+		Version: ClaimsVersion,
+		User:    service.config.projection.Project(user),
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: service.Now().Add(service.config.expiration).Unix(),
 			IssuedAt:  service.Now().Unix(),
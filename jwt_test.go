@@ -0,0 +1,215 @@
+package gate
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+func newTestJWTService(t *testing.T) (JWTService, JWTConfig) {
+	config, err := NewHMACJWTConfig("HS256", "secret", time.Hour, false)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	return NewJWTService(config), config
+}
+
+func segment(str string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(str))
+}
+
+func signWithHeader(t *testing.T, header map[string]interface{}, claims jwt.Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	for key, value := range header {
+		token.Header[key] = value
+	}
+
+	str, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	return str
+}
+
+func TestJWTParseHardening(t *testing.T) {
+	service, config := newTestJWTService(t)
+	user := UserInfo{ID: "id", Username: "username"}
+	claims := service.NewClaims(testUser(user))
+
+	t.Run("valid", func(t *testing.T) {
+		token, err := service.Issue(claims)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = service.Parse(token.Value)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid token: %s", err)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		inputs := []string{
+			"",
+			".",
+			"..",
+			"a.b",
+			"a.b.c.d",
+			"!!!.b.c",
+			segment("not json") + ".b.c",
+			segment(`{"alg":"HS256"`) + ".b.c",
+		}
+
+		for _, input := range inputs {
+			_, err := service.Parse(input)
+			if err == nil {
+				t.Fatalf("err should not be nil because of the malformed token: %q", input)
+			}
+		}
+	})
+
+	t.Run("alg none", func(t *testing.T) {
+		for _, alg := range []string{"none", "None", "NONE"} {
+			unsecured := segment(`{"alg":"`+alg+`","typ":"JWT"}`) + "." + segment(`{"user":{"id":"id"}}`) + "."
+			_, err := service.Parse(unsecured)
+			if err == nil || !strings.Contains(err.Error(), ErrAlgorithmNone.Error()) {
+				t.Fatalf("err should be ErrAlgorithmNone: %v", err)
+			}
+		}
+
+		_, err := NewHMACJWTConfig("none", "secret", time.Hour, false)
+		if err != ErrAlgorithmNone {
+			t.Fatalf("err should be ErrAlgorithmNone because of the unsecured configuration: %v", err)
+		}
+	})
+
+	t.Run("critical headers", func(t *testing.T) {
+		token := signWithHeader(t, map[string]interface{}{"crit": []string{"exp"}, "exp": 1}, claims)
+		_, err := service.Parse(token)
+		if err == nil {
+			t.Fatal("err should not be nil because of the unsupported critical header")
+		}
+
+		supported := config
+		supported.SetCriticalHeaders([]string{"exp"})
+		_, err = NewJWTService(supported).Parse(token)
+		if err != nil {
+			t.Fatalf("err should be nil because of the supported critical header: %s", err)
+		}
+	})
+
+	t.Run("max length", func(t *testing.T) {
+		_, err := service.Parse(strings.Repeat("a", DefaultMaxJWTLength+1))
+		if err == nil || !strings.Contains(err.Error(), ErrJWTTooLarge.Error()) || errors.Cause(err) != ErrJWTTooLarge {
+			t.Fatalf("err should be ErrJWTTooLarge: %v", err)
+		}
+	})
+
+	t.Run("max claims size", func(t *testing.T) {
+		limited := config
+		limited.SetMaxClaimsSize(256)
+		limitedService := NewJWTService(limited)
+
+		large := claims
+		large.User.Roles = make([]string, 100)
+		for i := range large.User.Roles {
+			large.User.Roles[i] = "role"
+		}
+
+		token, err := limitedService.Issue(large)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = limitedService.Parse(token.Value)
+		if err == nil || !strings.Contains(err.Error(), ErrClaimsTooLarge.Error()) {
+			t.Fatalf("err should be ErrClaimsTooLarge: %v", err)
+		}
+
+		token, err = limitedService.Issue(claims)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = limitedService.Parse(token.Value)
+		if err != nil {
+			t.Fatalf("err should be nil because of the small claims: %s", err)
+		}
+	})
+}
+
+func TestJWTAllowedAlgorithms(t *testing.T) {
+	config, err := NewHMACJWTConfig("HS512", "secret", time.Hour, false)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	user := testUser(UserInfo{ID: "id"})
+	issuer := NewJWTService(config)
+	token, err := issuer.Issue(issuer.NewClaims(user))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	verifier, _ := newTestJWTService(t)
+	_, err = verifier.Parse(token.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because algorithms of the same family are accepted by default: %s", err)
+	}
+
+	strict, err := NewHMACJWTConfig("HS256", "secret", time.Hour, false)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	strict.SetAllowedAlgorithms([]string{"HS256"})
+	_, err = NewJWTService(strict).Parse(token.Value)
+	if err == nil || !strings.Contains(err.Error(), ErrAlgorithmNotAllowed.Error()) {
+		t.Fatalf("err should be ErrAlgorithmNotAllowed because of the unlisted algorithm: %v", err)
+	}
+
+	strictService := NewJWTService(strict)
+	token, err = strictService.Issue(strictService.NewClaims(user))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	_, err = strictService.Parse(token.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because of the allowed algorithm: %s", err)
+	}
+}
+
+func BenchmarkJWTParse(b *testing.B) {
+	config, err := NewHMACJWTConfig("HS256", "secret", time.Hour, false)
+	if err != nil {
+		b.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	service := NewJWTService(config)
+	token, err := service.Issue(service.NewClaims(testUser(UserInfo{ID: "id", Username: "username", Roles: []string{"editor"}})))
+	if err != nil {
+		b.Fatalf("err should be nil: %s", err)
+	}
+
+	b.Run("valid", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			service.Parse(token.Value)
+		}
+	})
+
+	b.Run("invalid", func(b *testing.B) {
+		b.ReportAllocs()
+		invalid := token.Value + "x"
+		for i := 0; i < b.N; i++ {
+			service.Parse(invalid)
+		}
+	})
+}
@@ -0,0 +1,396 @@
+package gate
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxCachedKeys is the default maximum number of verification keys cached by a CachedKeyProvider
+const DefaultMaxCachedKeys = 64
+
+// ErrUnknownKey is thrown when the key ID of a token is not a key of the key provider
+var ErrUnknownKey = errors.New("unknown key")
+
+// KeyProvider is the contract for secret managers providing the JWT keys, e.g. HashiCorp Vault or a cloud KMS.
+// Signing keys are HMAC secrets, private keys or crypto.Signer implementations keeping the private key in the secret manager.
+// The ID of the signing key is set as the "kid" header and is given back to GetVerificationKey when tokens are parsed.
+// Key IDs are chosen by whoever made the token, hence providers only resolve their own keys and refuse other key IDs
+// with ErrUnknownKey before calling the secret manager
+type KeyProvider interface {
+	Algorithm() string
+	GetSigningKey() (kid string, key interface{}, err error)
+	GetVerificationKey(kid string) (interface{}, error)
+}
+
+// KeyRotation describes the rotation of the signing key
+type KeyRotation struct {
+	PreviousID string
+	ID         string
+	At         time.Time
+}
+
+// KeyRotationNotifier is the optional contract for key providers notifying the rotations of the signing key
+type KeyRotationNotifier interface {
+	OnRotation(func(KeyRotation))
+}
+
+// StaticKeyProvider is the KeyProvider of a single key pair, e.g. for tests or keys loaded once from a secret manager
+type StaticKeyProvider struct {
+	algorithm       string
+	id              string
+	signingKey      interface{}
+	verificationKey interface{}
+}
+
+// Algorithm returns the signing algorithm
+func (provider StaticKeyProvider) Algorithm() string {
+	return provider.algorithm
+}
+
+// GetSigningKey returns the signing key
+func (provider StaticKeyProvider) GetSigningKey() (string, interface{}, error) {
+	return provider.id, provider.signingKey, nil
+}
+
+// GetVerificationKey returns the verification key of the key ID
+func (provider StaticKeyProvider) GetVerificationKey(kid string) (interface{}, error) {
+	if kid != provider.id {
+		return nil, errors.WithMessage(ErrUnknownKey, kid)
+	}
+
+	return provider.verificationKey, nil
+}
+
+// NewStaticKeyProvider is the constructor for StaticKeyProvider. The verification key is the public key of the signing key,
+// the signing key itself for HMAC
+func NewStaticKeyProvider(algorithm, kid string, signingKey interface{}) StaticKeyProvider {
+	verificationKey := verifyingKey(signingKey)
+	if signer, ok := signingKey.(crypto.Signer); ok {
+		verificationKey = signer.Public()
+	}
+
+	return StaticKeyProvider{algorithm, kid, signingKey, verificationKey}
+}
+
+type cachedKey struct {
+	key       interface{}
+	err       error
+	expiredAt time.Time
+}
+
+type keyCache struct {
+	sync.Mutex
+	signingID string
+	signing   cachedKey
+	keys      map[string]cachedKey
+	listeners []func(KeyRotation)
+}
+
+// CachedKeyProvider caches the keys of a KeyProvider so the secret manager is not called on every issuance and parsing.
+// Unknown key IDs are cached as well, so tokens with made-up key IDs do not reach the secret manager again within the TTL.
+// A rotation is notified when the ID of the signing key changes on refresh
+type CachedKeyProvider struct {
+	provider KeyProvider
+	ttl      time.Duration
+	maxKeys  int
+	cache    *keyCache
+	Now      func() time.Time
+}
+
+// SetMaxKeys is the setter for the maximum number of cached verification keys, DefaultMaxCachedKeys by default.
+// Unknown key IDs are evicted first, then the keys expiring first. Zero disables the limit
+func (provider *CachedKeyProvider) SetMaxKeys(max int) {
+	provider.maxKeys = max
+}
+
+// Algorithm returns the signing algorithm of the provider
+func (provider CachedKeyProvider) Algorithm() string {
+	return provider.provider.Algorithm()
+}
+
+// GetSigningKey returns the cached signing key, refreshing it once the TTL is over
+func (provider CachedKeyProvider) GetSigningKey() (string, interface{}, error) {
+	cache := provider.cache
+	now := provider.Now()
+
+	cache.Lock()
+	if cache.signing.key != nil && now.Before(cache.signing.expiredAt) {
+		defer cache.Unlock()
+		return cache.signingID, cache.signing.key, nil
+	}
+	cache.Unlock()
+
+	kid, key, err := provider.provider.GetSigningKey()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "could not get the signing key")
+	}
+
+	cache.Lock()
+	previous := cache.signingID
+	cache.signingID, cache.signing = kid, cachedKey{key, nil, now.Add(provider.ttl)}
+	listeners := cache.listeners
+	cache.Unlock()
+
+	if previous != "" && previous != kid {
+		rotation := KeyRotation{previous, kid, now}
+		for _, listener := range listeners {
+			listener(rotation)
+		}
+	}
+
+	return kid, key, nil
+}
+
+// GetVerificationKey returns the cached verification key of the key ID, refreshing it once the TTL is over
+func (provider CachedKeyProvider) GetVerificationKey(kid string) (interface{}, error) {
+	cache := provider.cache
+	now := provider.Now()
+
+	cache.Lock()
+	cached, ok := cache.keys[kid]
+	cache.Unlock()
+	if ok && now.Before(cached.expiredAt) {
+		return cached.key, cached.err
+	}
+
+	key, err := provider.provider.GetVerificationKey(kid)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the verification key")
+		// only unknown keys are cached, other failures of the secret manager are retried
+		if errors.Cause(err) != ErrUnknownKey {
+			return nil, err
+		}
+	}
+
+	cache.Lock()
+	cache.evict(now, provider.maxKeys)
+	cache.keys[kid] = cachedKey{key, err, now.Add(provider.ttl)}
+	cache.Unlock()
+	return key, err
+}
+
+// evict makes room for a key: expired keys are removed, then unknown keys, then the keys expiring first
+func (cache *keyCache) evict(now time.Time, max int) {
+	if max <= 0 || len(cache.keys) < max {
+		return
+	}
+
+	for kid, cached := range cache.keys {
+		if !now.Before(cached.expiredAt) {
+			delete(cache.keys, kid)
+		}
+	}
+
+	for len(cache.keys) >= max {
+		victim, first := "", true
+		for kid, cached := range cache.keys {
+			candidate := cache.keys[victim]
+			if first || (cached.err != nil && candidate.err == nil) ||
+				((cached.err != nil) == (candidate.err != nil) && cached.expiredAt.Before(candidate.expiredAt)) {
+				victim, first = kid, false
+			}
+		}
+		delete(cache.keys, victim)
+	}
+}
+
+// OnRotation registers a listener of the rotations of the signing key. Rotations notified by the provider are forwarded
+// after the cache is invalidated
+func (provider CachedKeyProvider) OnRotation(listener func(KeyRotation)) {
+	provider.cache.Lock()
+	defer provider.cache.Unlock()
+	provider.cache.listeners = append(provider.cache.listeners, listener)
+}
+
+// Invalidate drops the cached keys, e.g. when the secret manager reports a rotation
+func (provider CachedKeyProvider) Invalidate() {
+	provider.cache.Lock()
+	defer provider.cache.Unlock()
+	provider.cache.signing = cachedKey{}
+	provider.cache.keys = map[string]cachedKey{}
+}
+
+// NewCachedKeyProvider is the constructor for CachedKeyProvider
+func NewCachedKeyProvider(provider KeyProvider, ttl time.Duration) CachedKeyProvider {
+	cached := CachedKeyProvider{
+		provider: provider,
+		ttl:      ttl,
+		maxKeys:  DefaultMaxCachedKeys,
+		cache:    &keyCache{keys: map[string]cachedKey{}},
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+	}
+
+	if notifier, ok := provider.(KeyRotationNotifier); ok {
+		notifier.OnRotation(func(rotation KeyRotation) {
+			cached.Invalidate()
+			cached.cache.Lock()
+			listeners := cached.cache.listeners
+			cached.cache.Unlock()
+			for _, listener := range listeners {
+				listener(rotation)
+			}
+		})
+	}
+
+	return cached
+}
+
+// signerMethod signs JWTs with a crypto.Signer, e.g. a remote key of a secret manager, and verifies them like the standard method
+type signerMethod struct {
+	jwt.SigningMethod
+	hash crypto.Hash
+	pss  bool
+	size int
+}
+
+// newSignerMethod returns the signing method of a crypto.Signer for an asymmetric method
+func newSignerMethod(method jwt.SigningMethod) (signerMethod, error) {
+	switch method := method.(type) {
+	case *jwt.SigningMethodRSAPSS:
+		return signerMethod{method, method.Hash, true, 0}, nil
+	case *jwt.SigningMethodRSA:
+		return signerMethod{method, method.Hash, false, 0}, nil
+	case *jwt.SigningMethodECDSA:
+		return signerMethod{method, method.Hash, false, method.KeySize}, nil
+	}
+
+	return signerMethod{}, errors.New("crypto.Signer keys require an asymmetric algorithm")
+}
+
+// Sign signs the string with the crypto.Signer. ECDSA signatures are converted from ASN.1 into the fixed-size R || S form of JWS
+func (method signerMethod) Sign(signingString string, key interface{}) (string, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	if !method.hash.Available() {
+		return "", jwt.ErrHashUnavailable
+	}
+
+	hasher := method.hash.New()
+	hasher.Write([]byte(signingString))
+	digest := hasher.Sum(nil)
+
+	var opts crypto.SignerOpts = method.hash
+	if method.pss {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: method.hash}
+	}
+
+	signature, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if method.size > 0 {
+		signature, err = rawECDSASignature(signature, method.size)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return jwt.EncodeSegment(signature), nil
+}
+
+func rawECDSASignature(der []byte, size int) ([]byte, error) {
+	var signature struct {
+		R, S *big.Int
+	}
+
+	rest, err := asn1.Unmarshal(der, &signature)
+	if err != nil || len(rest) > 0 || signature.R == nil || signature.S == nil {
+		return nil, errors.New("invalid ECDSA signature")
+	}
+
+	r, s := signature.R.Bytes(), signature.S.Bytes()
+	if len(r) > size || len(s) > size {
+		return nil, errors.New("invalid ECDSA signature")
+	}
+
+	raw := make([]byte, 2*size)
+	copy(raw[size-len(r):size], r)
+	copy(raw[2*size-len(s):], s)
+	return raw, nil
+}
+
+// providerSigningKey returns the signing method, the signing key and the key ID from the key provider
+func (service JWTService) providerSigningKey() (method jwt.SigningMethod, key interface{}, kid string, err error) {
+	method = service.config.method
+	kid, key, err = service.config.keys.GetSigningKey()
+	if err != nil {
+		err = errors.Wrap(err, "could not get the signing key")
+		return
+	}
+
+	switch typed := key.(type) {
+	case string:
+		key = []byte(typed)
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, []byte:
+	case crypto.Signer:
+		method, err = newSignerMethod(method)
+	default:
+		err = errors.New("invalid key")
+	}
+	return
+}
+
+// providerVerifyingKey returns the verification key of a token from the key provider by the "kid" header
+func (service JWTService) providerVerifyingKey(token *jwt.Token) (key interface{}, err error) {
+	if token.Method.Alg() != service.config.method.Alg() {
+		err = errors.Errorf("unexpected signing method: %v", token.Header["alg"])
+		return
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, err = service.config.keys.GetVerificationKey(kid)
+	if err != nil {
+		return
+	}
+
+	switch typed := key.(type) {
+	case string:
+		key = []byte(typed)
+	case crypto.Signer:
+		key = typed.Public()
+	}
+	return
+}
+
+// NewKeyProviderJWTConfig is the constructor for JWTConfig using the algorithm and the keys of a key provider
+func NewKeyProviderJWTConfig(provider KeyProvider, expiration time.Duration, skipClaimsValidation bool) (config JWTConfig, err error) {
+	if provider == nil {
+		err = errors.New("invalid key provider")
+		return
+	}
+
+	method := jwt.GetSigningMethod(provider.Algorithm())
+	if method == nil {
+		err = errors.New("invalid JWT algorithm")
+		return
+	}
+
+	if method == jwt.SigningMethodNone {
+		err = ErrAlgorithmNone
+		return
+	}
+
+	config = JWTConfig{
+		method:               method,
+		expiration:           expiration,
+		skipClaimsValidation: skipClaimsValidation,
+		maxLength:            DefaultMaxJWTLength,
+		keys:                 provider,
+	}
+	return
+}
@@ -0,0 +1,195 @@
+package gate
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// remoteSigner hides the private key behind crypto.Signer like the signers of secret managers
+type remoteSigner struct {
+	crypto.Signer
+}
+
+type rotatingProvider struct {
+	StaticKeyProvider
+	calls *int
+}
+
+func (provider rotatingProvider) GetSigningKey() (string, interface{}, error) {
+	*provider.calls++
+	kid, key, err := provider.StaticKeyProvider.GetSigningKey()
+	if *provider.calls > 1 {
+		kid = "rotated"
+	}
+
+	return kid, key, err
+}
+
+type countingProvider struct {
+	StaticKeyProvider
+	calls *int
+}
+
+func (provider countingProvider) GetVerificationKey(kid string) (interface{}, error) {
+	*provider.calls++
+	return provider.StaticKeyProvider.GetVerificationKey(kid)
+}
+
+func TestKeyProvider(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	providers := map[string]KeyProvider{
+		"HS256":  NewStaticKeyProvider("HS256", "hmac", "secret"),
+		"RS256":  NewStaticKeyProvider("RS256", "rsa", rsaKey),
+		"signer": NewStaticKeyProvider("RS256", "rsa", remoteSigner{rsaKey}),
+		"PS256":  NewStaticKeyProvider("PS256", "rsa", remoteSigner{rsaKey}),
+		"ES256":  NewStaticKeyProvider("ES256", "ecdsa", remoteSigner{ecdsaKey}),
+	}
+
+	for name, provider := range providers {
+		t.Run(name, func(t *testing.T) {
+			config, err := NewKeyProviderJWTConfig(provider, time.Hour, false)
+			if err != nil {
+				t.Fatalf("err should be nil: %s", err)
+			}
+
+			service := NewJWTService(config)
+			token, err := service.Issue(service.NewClaims(testUser{ID: "1"}))
+			if err != nil {
+				t.Fatalf("err should be nil because of the provided key: %s", err)
+			}
+
+			parsed, err := service.Parse(token.Value)
+			if err != nil || parsed.UserID != "1" {
+				t.Fatalf("token should be verified with the provided key: %v", err)
+			}
+
+			header, _ := jwt.DecodeSegment(strings.SplitN(token.Value, ".", 2)[0])
+			kid, _, _ := provider.GetSigningKey()
+			if !strings.Contains(string(header), `"kid":"`+kid+`"`) {
+				t.Fatalf("kid header should be set: %s", header)
+			}
+		})
+	}
+
+	t.Run("unknown key", func(t *testing.T) {
+		config, err := NewKeyProviderJWTConfig(providers["ES256"], time.Hour, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		other, err := NewKeyProviderJWTConfig(NewStaticKeyProvider("ES256", "other", ecdsaKey), time.Hour, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		token, err := NewJWTService(other).Issue(NewJWTService(other).NewClaims(testUser{ID: "1"}))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = NewJWTService(config).Parse(token.Value); err == nil {
+			t.Fatal("err should not be nil because of the unknown key ID")
+		}
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		calls := 0
+		now := time.Now()
+		cached := NewCachedKeyProvider(rotatingProvider{NewStaticKeyProvider("HS256", "hmac", "secret"), &calls}, time.Minute)
+		cached.Now = func() time.Time {
+			return now
+		}
+
+		var rotations []KeyRotation
+		cached.OnRotation(func(rotation KeyRotation) {
+			rotations = append(rotations, rotation)
+		})
+
+		for i := 0; i < 3; i++ {
+			if kid, _, err := cached.GetSigningKey(); err != nil || kid != "hmac" {
+				t.Fatalf("signing key should be cached: %s %v", kid, err)
+			}
+		}
+
+		if calls != 1 {
+			t.Fatalf("provider should be called once within the TTL: %d", calls)
+		}
+
+		now = now.Add(time.Minute)
+		if kid, _, err := cached.GetSigningKey(); err != nil || kid != "rotated" {
+			t.Fatalf("signing key should be refreshed after the TTL: %s %v", kid, err)
+		}
+
+		if len(rotations) != 1 || rotations[0].PreviousID != "hmac" || rotations[0].ID != "rotated" {
+			t.Fatalf("rotation should be notified: %+v", rotations)
+		}
+
+		cached.Invalidate()
+		if _, _, err := cached.GetSigningKey(); err != nil || calls != 3 {
+			t.Fatalf("invalidated keys should be refreshed: %d %v", calls, err)
+		}
+	})
+
+	t.Run("unknown keys", func(t *testing.T) {
+		calls := 0
+		cached := NewCachedKeyProvider(countingProvider{NewStaticKeyProvider("HS256", "hmac", "secret"), &calls}, time.Minute)
+		cached.SetMaxKeys(2)
+
+		for i := 0; i < 3; i++ {
+			if _, err := cached.GetVerificationKey("bogus"); errors.Cause(err) != ErrUnknownKey {
+				t.Fatalf("err should be ErrUnknownKey because of the unknown key ID: %v", err)
+			}
+		}
+
+		if calls != 1 {
+			t.Fatalf("unknown key IDs should be cached: %d", calls)
+		}
+
+		for _, kid := range []string{"hmac", "bogus-1", "bogus-2", "bogus-3"} {
+			cached.GetVerificationKey(kid)
+		}
+
+		if len(cached.cache.keys) != 2 {
+			t.Fatalf("the cache should be bounded: %d", len(cached.cache.keys))
+		}
+
+		calls = 0
+		if _, err := cached.GetVerificationKey("hmac"); err != nil || calls != 0 {
+			t.Fatalf("known keys should be kept over unknown ones: %d %v", calls, err)
+		}
+	})
+
+	t.Run("edge", func(t *testing.T) {
+		config, err := NewKeyProviderJWTConfig(providers["ES256"], time.Hour, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		edge, err := config.EdgeConfig()
+		if err != nil {
+			t.Fatalf("err should be nil because of the current signing key: %s", err)
+		}
+
+		if _, err = NewEdgeJWTConfig(edge, JWTConfig{}); err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+	})
+}
@@ -0,0 +1,5 @@
+// Package kms provides github.com/hiendv/gate key providers whose private keys stay in a secret manager, i.e. the transit
+// secrets engine of HashiCorp Vault and cloud KMS signing through a small client contract. Tokens are signed remotely by
+// crypto.Signer keys, hence the keys never live in the application memory. Wrap the providers with gate.NewCachedKeyProvider
+// so the public keys are not fetched on every issuance and parsing
+package kms
@@ -0,0 +1,156 @@
+package kms
+
+import (
+	"crypto"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// Client is the contract for cloud KMS clients, e.g. an adapter of the AWS KMS Sign and GetPublicKey operations
+// or the Cloud KMS AsymmetricSign and GetPublicKey operations of Google Cloud
+type Client interface {
+	// Sign signs a digest with a key. ECDSA signatures must be ASN.1-encoded, RSA-PSS is requested by *rsa.PSSOptions
+	Sign(keyID string, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+	PublicKey(keyID string) (crypto.PublicKey, error)
+}
+
+type kmsState struct {
+	sync.RWMutex
+	keyID     string
+	allowed   map[string]bool
+	listeners []func(gate.KeyRotation)
+}
+
+// KMS is the gate.KeyProvider of cloud KMS keys. Key IDs are the KMS key IDs, e.g. ARNs or resource names.
+// Only the current signing key and the allowed keys verify tokens: the key ID of a token is chosen by whoever made it,
+// so any other key, e.g. a key of another account whose policy allows GetPublicKey, is refused without calling the KMS.
+// Keys which are rotated out by Rotate are allowed until they are retired
+type KMS struct {
+	client    Client
+	algorithm string
+	state     *kmsState
+	Now       func() time.Time
+}
+
+// Algorithm returns the JWT signing algorithm
+func (kms KMS) Algorithm() string {
+	return kms.algorithm
+}
+
+// KeyID returns the ID of the current signing key
+func (kms KMS) KeyID() string {
+	kms.state.RLock()
+	defer kms.state.RUnlock()
+	return kms.state.keyID
+}
+
+// GetSigningKey returns the signer of the current signing key
+func (kms KMS) GetSigningKey() (string, interface{}, error) {
+	keyID := kms.KeyID()
+	public, err := kms.client.PublicKey(keyID)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "could not get the public key")
+	}
+
+	return keyID, Signer{kms.client, keyID, public}, nil
+}
+
+// AllowKeys allows the tokens of other KMS keys besides the current signing key, e.g. the keys rotated out by other instances
+func (kms KMS) AllowKeys(keyIDs ...string) {
+	kms.state.Lock()
+	defer kms.state.Unlock()
+	for _, keyID := range keyIDs {
+		kms.state.allowed[keyID] = true
+	}
+}
+
+// RetireKey refuses the tokens of a key which was rotated out or allowed, e.g. once its tokens are expired
+func (kms KMS) RetireKey(keyID string) {
+	kms.state.Lock()
+	defer kms.state.Unlock()
+	delete(kms.state.allowed, keyID)
+}
+
+// GetVerificationKey returns the public key of the current signing key or of an allowed key. Other keys are refused with gate.ErrUnknownKey
+func (kms KMS) GetVerificationKey(kid string) (interface{}, error) {
+	kms.state.RLock()
+	known := kid == kms.state.keyID || kms.state.allowed[kid]
+	kms.state.RUnlock()
+	if !known {
+		return nil, errors.WithMessage(gate.ErrUnknownKey, kid)
+	}
+
+	public, err := kms.client.PublicKey(kid)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the public key")
+	}
+
+	return public, nil
+}
+
+// OnRotation registers a listener of the rotations of the signing key
+func (kms KMS) OnRotation(listener func(gate.KeyRotation)) {
+	kms.state.Lock()
+	defer kms.state.Unlock()
+	kms.state.listeners = append(kms.state.listeners, listener)
+}
+
+// Rotate switches the signing key to another KMS key and notifies the listeners
+func (kms KMS) Rotate(keyID string) {
+	kms.state.Lock()
+	previous := kms.state.keyID
+	kms.state.keyID = keyID
+	if previous != keyID {
+		kms.state.allowed[previous] = true
+	}
+	listeners := kms.state.listeners
+	kms.state.Unlock()
+
+	if previous == keyID {
+		return
+	}
+
+	rotation := gate.KeyRotation{PreviousID: previous, ID: keyID, At: kms.Now()}
+	for _, listener := range listeners {
+		listener(rotation)
+	}
+}
+
+// Signer is the crypto.Signer of a KMS key. Digests are signed by the KMS, the private key never leaves it
+type Signer struct {
+	client Client
+	keyID  string
+	public crypto.PublicKey
+}
+
+// Public returns the public key
+func (signer Signer) Public() crypto.PublicKey {
+	return signer.public
+}
+
+// Sign signs a digest with the KMS key
+func (signer Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	signature, err := signer.client.Sign(signer.keyID, digest, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not sign with the KMS")
+	}
+
+	return signature, nil
+}
+
+// NewKMS is the constructor for KMS with the client, the JWT algorithm matching the key spec, e.g. "ES256" for "ECC_NIST_P256",
+// and the ID of the signing key
+func NewKMS(client Client, algorithm, keyID string) KMS {
+	return KMS{
+		client:    client,
+		algorithm: algorithm,
+		state:     &kmsState{keyID: keyID, allowed: map[string]bool{}},
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+	}
+}
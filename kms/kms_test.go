@@ -0,0 +1,324 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+type user struct {
+	id string
+}
+
+func (u user) GetID() string {
+	return u.id
+}
+
+func (u user) GetUsername() string {
+	return u.id
+}
+
+func (u user) GetRoles() []string {
+	return nil
+}
+
+func publicPEM(t *testing.T, key crypto.Signer) string {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// newVault emulates the transit secrets engine with versions of a key
+func newVault(t *testing.T, versions []crypto.Signer) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/transit/keys/jwt":
+			keys := map[string]map[string]string{}
+			for i, key := range versions {
+				keys[fmt.Sprint(i+1)] = map[string]string{"public_key": publicPEM(t, key)}
+			}
+
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"latest_version": len(versions), "keys": keys}})
+		case "/v1/transit/sign/jwt/sha2-256":
+			var request struct {
+				Input     string `json:"input"`
+				Version   int    `json:"key_version"`
+				Prehashed bool   `json:"prehashed"`
+				Algorithm string `json:"signature_algorithm"`
+			}
+			json.NewDecoder(r.Body).Decode(&request)
+			digest, _ := base64.StdEncoding.DecodeString(request.Input)
+
+			var opts crypto.SignerOpts = crypto.SHA256
+			if request.Algorithm == "pss" {
+				opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+			}
+
+			signature, err := versions[request.Version-1].Sign(rand.Reader, digest, opts)
+			if err != nil || !request.Prehashed {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+				"signature": fmt.Sprintf("vault:v%d:%s", request.Version, base64.StdEncoding.EncodeToString(signature)),
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestVaultTransit(t *testing.T) {
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	versions := []crypto.Signer{first}
+	server := newVault(t, versions)
+	defer server.Close()
+
+	vault := NewVaultTransit(server.URL, "jwt", "ES256", StaticToken("root"))
+	config, err := gate.NewKeyProviderJWTConfig(vault, time.Hour, false)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	service := gate.NewJWTService(config)
+	token, err := service.Issue(service.NewClaims(user{"1"}))
+	if err != nil {
+		t.Fatalf("err should be nil because Vault signs the token: %s", err)
+	}
+
+	if _, err = service.Parse(token.Value); err != nil {
+		t.Fatalf("err should be nil because of the Vault public key: %s", err)
+	}
+
+	t.Run("rotation", func(t *testing.T) {
+		rotated := newVault(t, append(versions, second))
+		defer rotated.Close()
+
+		vault := NewVaultTransit(rotated.URL, "jwt", "ES256", StaticToken("root"))
+		kid, _, err := vault.GetSigningKey()
+		if err != nil || kid != "jwt:v2" {
+			t.Fatalf("latest version should sign: %s %v", kid, err)
+		}
+
+		config, err := gate.NewKeyProviderJWTConfig(vault, time.Hour, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = gate.NewJWTService(config).Parse(token.Value); err != nil {
+			t.Fatalf("tokens of the previous version should be verified: %s", err)
+		}
+	})
+
+	t.Run("unknown versions", func(t *testing.T) {
+		reads := 0
+		counting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reads++
+			server.Config.Handler.ServeHTTP(w, r)
+		}))
+		defer counting.Close()
+
+		now := time.Now()
+		vault := NewVaultTransit(counting.URL, "jwt", "ES256", StaticToken("root"))
+		vault.Now = func() time.Time {
+			return now
+		}
+
+		for _, kid := range []string{"jwt:v1", "jwt:v7", "jwt:v8", "jwt:v0", "other:v1"} {
+			vault.GetVerificationKey(kid)
+		}
+
+		if reads != 1 {
+			t.Fatalf("vault should be read once within the refresh interval: %d", reads)
+		}
+
+		if _, err := vault.GetVerificationKey("jwt:v9"); errors.Cause(err) != gate.ErrUnknownKey {
+			t.Fatalf("err should be gate.ErrUnknownKey because of the unknown version: %v", err)
+		}
+
+		now = now.Add(DefaultVaultRefreshInterval)
+		vault.GetVerificationKey("jwt:v9")
+		if reads != 2 {
+			t.Fatalf("newer versions should be looked for after the refresh interval: %d", reads)
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		denied := NewVaultTransit(server.URL, "jwt", "ES256", StaticToken("guest"))
+		if _, _, err := denied.GetSigningKey(); err == nil {
+			t.Fatal("err should not be nil because of the invalid token")
+		}
+
+		if _, err := denied.GetVerificationKey("other:v1"); err == nil {
+			t.Fatal("err should not be nil because of the unknown key")
+		}
+	})
+
+	t.Run("pss", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		server := newVault(t, []crypto.Signer{key})
+		defer server.Close()
+
+		config, err := gate.NewKeyProviderJWTConfig(NewVaultTransit(server.URL, "jwt", "PS256", StaticToken("root")), time.Hour, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		service := gate.NewJWTService(config)
+		token, err := service.Issue(service.NewClaims(user{"1"}))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = service.Parse(token.Value); err != nil {
+			t.Fatalf("err should be nil because of the PSS signature: %s", err)
+		}
+	})
+}
+
+type fakeClient map[string]crypto.Signer
+
+func (client fakeClient) Sign(keyID string, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	key, ok := client[keyID]
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+
+	return key.Sign(rand.Reader, digest, opts)
+}
+
+func (client fakeClient) PublicKey(keyID string) (crypto.PublicKey, error) {
+	key, ok := client[keyID]
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+
+	return key.Public(), nil
+}
+
+func TestKMS(t *testing.T) {
+	client := fakeClient{}
+	for _, id := range []string{"alias/jwt-1", "alias/jwt-2"} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		client[id] = key
+	}
+
+	kms := NewKMS(client, "ES256", "alias/jwt-1")
+	cached := gate.NewCachedKeyProvider(kms, time.Hour)
+
+	var rotations []gate.KeyRotation
+	cached.OnRotation(func(rotation gate.KeyRotation) {
+		rotations = append(rotations, rotation)
+	})
+
+	config, err := gate.NewKeyProviderJWTConfig(cached, time.Hour, false)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	service := gate.NewJWTService(config)
+	token, err := service.Issue(service.NewClaims(user{"1"}))
+	if err != nil {
+		t.Fatalf("err should be nil because the KMS signs the token: %s", err)
+	}
+
+	kms.Rotate("alias/jwt-2")
+	if len(rotations) != 1 || rotations[0].ID != "alias/jwt-2" {
+		t.Fatalf("rotation should be forwarded by the cache: %+v", rotations)
+	}
+
+	rotated, err := service.Issue(service.NewClaims(user{"1"}))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	for _, value := range []string{token.Value, rotated.Value} {
+		if _, err = service.Parse(value); err != nil {
+			t.Fatalf("tokens of both keys should be verified: %s", err)
+		}
+	}
+
+	if kid, _, _ := cached.GetSigningKey(); kid != "alias/jwt-2" {
+		t.Fatalf("cache should be invalidated on rotation: %s", kid)
+	}
+
+	t.Run("foreign key", func(t *testing.T) {
+		foreign, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		client["arn:aws:kms:attacker"] = foreign
+		attacker := NewKMS(client, "ES256", "arn:aws:kms:attacker")
+		config, err := gate.NewKeyProviderJWTConfig(attacker, time.Hour, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		forged, err := gate.NewJWTService(config).Issue(service.NewClaims(user{"1"}))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = kms.GetVerificationKey("arn:aws:kms:attacker"); errors.Cause(err) != gate.ErrUnknownKey {
+			t.Fatalf("err should be gate.ErrUnknownKey because the key is not allowed: %v", err)
+		}
+
+		if _, err = service.Parse(forged.Value); err == nil {
+			t.Fatal("err should not be nil because of the foreign key")
+		}
+	})
+
+	t.Run("retire", func(t *testing.T) {
+		kms.RetireKey("alias/jwt-1")
+		if _, err := kms.GetVerificationKey("alias/jwt-1"); errors.Cause(err) != gate.ErrUnknownKey {
+			t.Fatalf("err should be gate.ErrUnknownKey because the key is retired: %v", err)
+		}
+
+		kms.AllowKeys("alias/jwt-1")
+		if _, err := kms.GetVerificationKey("alias/jwt-1"); err != nil {
+			t.Fatalf("err should be nil because the key is allowed: %s", err)
+		}
+	})
+}
@@ -0,0 +1,343 @@
+package kms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// TokenFunc returns the Vault token of a request, e.g. a token renewed by an auth method
+type TokenFunc func() (string, error)
+
+// StaticToken returns the TokenFunc of a static Vault token
+func StaticToken(token string) TokenFunc {
+	return func() (string, error) {
+		return token, nil
+	}
+}
+
+// DefaultVaultRefreshInterval is the minimum interval between the reads of the transit key looking for newer versions
+const DefaultVaultRefreshInterval = time.Minute
+
+// vaultVersions are the public keys of the versions of the transit key known from the last read
+type vaultVersions struct {
+	sync.Mutex
+	latest      int
+	keys        map[int]crypto.PublicKey
+	refreshedAt time.Time
+}
+
+// VaultTransit is the gate.KeyProvider of a key of the Vault transit secrets engine, e.g. "rsa-2048" or "ecdsa-p256" keys.
+// Key IDs are the key name along with the key version, e.g. "jwt:v2", so rotated keys keep verifying the tokens they signed.
+// Only the versions of the key from the minimum version are resolved, and versions newer than the latest known one
+// make Vault read at most once per refresh interval, so made-up key IDs do not reach Vault on every parsing
+type VaultTransit struct {
+	address         string
+	mount           string
+	name            string
+	algorithm       string
+	namespace       string
+	minVersion      int
+	refreshInterval time.Duration
+	token           TokenFunc
+	versions        *vaultVersions
+	Client          *http.Client
+	Now             func() time.Time
+}
+
+// SetMount is the setter for the mount path of the transit secrets engine, "transit" by default
+func (vault *VaultTransit) SetMount(mount string) {
+	vault.mount = strings.Trim(mount, "/")
+}
+
+// SetMinVersion is the setter for the minimum version verifying tokens, e.g. the min_decryption_version of the key. 1 by default
+func (vault *VaultTransit) SetMinVersion(version int) {
+	vault.minVersion = version
+}
+
+// SetRefreshInterval is the setter for the minimum interval between the reads looking for newer versions, DefaultVaultRefreshInterval by default
+func (vault *VaultTransit) SetRefreshInterval(interval time.Duration) {
+	vault.refreshInterval = interval
+}
+
+// SetNamespace is the setter for the Vault Enterprise namespace. There is no namespace by default
+func (vault *VaultTransit) SetNamespace(namespace string) {
+	vault.namespace = namespace
+}
+
+// Algorithm returns the JWT signing algorithm
+func (vault VaultTransit) Algorithm() string {
+	return vault.algorithm
+}
+
+// GetSigningKey returns the signer of the latest version of the key
+func (vault VaultTransit) GetSigningKey() (kid string, key interface{}, err error) {
+	transitKey, err := vault.readKey()
+	if err != nil {
+		return
+	}
+
+	public, err := transitKey.publicKey(transitKey.LatestVersion)
+	if err != nil {
+		return
+	}
+
+	kid = vault.keyID(transitKey.LatestVersion)
+	key = VaultSigner{vault, transitKey.LatestVersion, public}
+	return
+}
+
+// GetVerificationKey returns the public key of a version of the key. Unknown versions are refused with gate.ErrUnknownKey
+func (vault VaultTransit) GetVerificationKey(kid string) (interface{}, error) {
+	version, err := vault.version(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	now := vault.Now()
+	versions := vault.versions
+	versions.Lock()
+	public, known := versions.keys[version]
+	// older versions missing from the last read are archived or deleted, newer ones are looked for once per interval
+	stale := !known && version > versions.latest && !now.Before(versions.refreshedAt.Add(vault.refreshInterval))
+	if stale {
+		versions.refreshedAt = now
+	}
+	versions.Unlock()
+
+	if known {
+		return public, nil
+	}
+
+	if !stale {
+		return nil, errors.WithMessage(gate.ErrUnknownKey, kid)
+	}
+
+	if _, err = vault.readKey(); err != nil {
+		return nil, err
+	}
+
+	versions.Lock()
+	public, known = versions.keys[version]
+	versions.Unlock()
+	if !known {
+		return nil, errors.WithMessage(gate.ErrUnknownKey, kid)
+	}
+
+	return public, nil
+}
+
+func (vault VaultTransit) keyID(version int) string {
+	return fmt.Sprintf("%s:v%d", vault.name, version)
+}
+
+func (vault VaultTransit) version(kid string) (int, error) {
+	prefix := vault.name + ":v"
+	if !strings.HasPrefix(kid, prefix) {
+		return 0, errors.WithMessage(gate.ErrUnknownKey, kid)
+	}
+
+	version, err := strconv.Atoi(kid[len(prefix):])
+	if err != nil || version < vault.minVersion {
+		return 0, errors.WithMessage(gate.ErrUnknownKey, kid)
+	}
+
+	return version, nil
+}
+
+type transitKey struct {
+	LatestVersion int `json:"latest_version"`
+	Keys          map[string]struct {
+		PublicKey string `json:"public_key"`
+	} `json:"keys"`
+}
+
+func (key transitKey) publicKey(version int) (crypto.PublicKey, error) {
+	versioned, ok := key.Keys[strconv.Itoa(version)]
+	if !ok {
+		return nil, errors.Errorf("unknown key version: %d", version)
+	}
+
+	block, _ := pem.Decode([]byte(versioned.PublicKey))
+	if block == nil {
+		return nil, errors.New("invalid public key")
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid public key")
+	}
+
+	return public, nil
+}
+
+// readKey reads the transit key and keeps the public keys of its versions
+func (vault VaultTransit) readKey() (key transitKey, err error) {
+	err = vault.do("GET", "keys/"+escape(vault.name), nil, &key)
+	if err != nil {
+		err = errors.Wrap(err, "could not read the transit key")
+		return
+	}
+
+	keys := map[int]crypto.PublicKey{}
+	for version := vault.minVersion; version <= key.LatestVersion; version++ {
+		if public, err := key.publicKey(version); err == nil {
+			keys[version] = public
+		}
+	}
+
+	vault.versions.Lock()
+	defer vault.versions.Unlock()
+	vault.versions.latest = key.LatestVersion
+	vault.versions.keys = keys
+	return
+}
+
+// do sends a request to the transit secrets engine and decodes the data of the response
+func (vault VaultTransit) do(method, path string, body interface{}, data interface{}) error {
+	token, err := vault.token()
+	if err != nil {
+		return errors.Wrap(err, "could not get the Vault token")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(payload)
+	}
+
+	request, err := http.NewRequest(method, strings.TrimSuffix(vault.address, "/")+"/v1/"+vault.mount+"/"+path, reader)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("X-Vault-Token", token)
+	request.Header.Set("Content-Type", "application/json")
+	if vault.namespace != "" {
+		request.Header.Set("X-Vault-Namespace", vault.namespace)
+	}
+
+	client := vault.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+
+	err = json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&envelope)
+	if response.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected Vault response %d: %s", response.StatusCode, strings.Join(envelope.Errors, "; "))
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "invalid Vault response")
+	}
+
+	return json.Unmarshal(envelope.Data, data)
+}
+
+// VaultSigner is the crypto.Signer of a version of a transit key. Digests are signed by Vault, the private key never leaves it
+type VaultSigner struct {
+	vault   VaultTransit
+	version int
+	public  crypto.PublicKey
+}
+
+// Public returns the public key of the version
+func (signer VaultSigner) Public() crypto.PublicKey {
+	return signer.public
+}
+
+// Sign signs a digest with the version of the transit key. ECDSA signatures are ASN.1-encoded like ecdsa.PrivateKey signatures
+func (signer VaultSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash, ok := vaultHashes[opts.HashFunc()]
+	if !ok {
+		return nil, errors.Errorf("unsupported hash: %v", opts.HashFunc())
+	}
+
+	request := map[string]interface{}{
+		"input":       base64.StdEncoding.EncodeToString(digest),
+		"prehashed":   true,
+		"key_version": signer.version,
+	}
+
+	if _, ok := signer.public.(*rsa.PublicKey); ok {
+		request["signature_algorithm"] = "pkcs1v15"
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			request["signature_algorithm"] = "pss"
+		}
+	}
+
+	var response struct {
+		Signature string `json:"signature"`
+	}
+
+	err := signer.vault.do("POST", "sign/"+escape(signer.vault.name)+"/"+hash, request, &response)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not sign with Vault")
+	}
+
+	parts := strings.SplitN(response.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, errors.New("invalid Vault signature")
+	}
+
+	return base64.StdEncoding.DecodeString(parts[2])
+}
+
+// escape escapes a path segment, like url.PathEscape which is not available before Go 1.8
+func escape(segment string) string {
+	return strings.Replace((&url.URL{Path: segment}).EscapedPath(), "/", "%2F", -1)
+}
+
+var vaultHashes = map[crypto.Hash]string{
+	crypto.SHA256: "sha2-256",
+	crypto.SHA384: "sha2-384",
+	crypto.SHA512: "sha2-512",
+}
+
+// NewVaultTransit is the constructor for VaultTransit with the Vault address, the name of the transit key, the JWT algorithm
+// matching the key type, e.g. "RS256" for "rsa-2048" or "ES256" for "ecdsa-p256", and the token
+func NewVaultTransit(address, name, algorithm string, token TokenFunc) VaultTransit {
+	return VaultTransit{
+		address:         address,
+		mount:           "transit",
+		name:            name,
+		algorithm:       algorithm,
+		minVersion:      1,
+		refreshInterval: DefaultVaultRefreshInterval,
+		token:           token,
+		versions:        &vaultVersions{keys: map[int]crypto.PublicKey{}},
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+	}
+}
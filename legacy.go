@@ -0,0 +1,114 @@
+package gate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLegacyClaims is thrown when a token of the legacy claims layout is presented after the migration window
+var ErrLegacyClaims = errors.New("legacy JWT claims are no longer accepted")
+
+// legacyTimeClaims are the time claims which older versions of the library may have encoded as floats, e.g. 1.5e+09
+var legacyTimeClaims = []string{"exp", "iat", "nbf"}
+
+// LegacyClaimsMigrator upgrades the layouts of the claims issued before claims were versioned, e.g. by older versions of the library
+// signing dgrijalva/jwt-go map claims, to the layout of the version 1:
+//   - the user as a bare ID, e.g. "user": "1", or as top-level "username" and "roles" claims
+//   - roles as a comma-separated string
+//   - fractional, exponent or string time claims, e.g. "exp": 1.5e+09
+//   - a single audience as an array
+func LegacyClaimsMigrator(claims map[string]interface{}) error {
+	user, ok := claims["user"].(map[string]interface{})
+	if !ok {
+		user = map[string]interface{}{}
+		if id, isID := claims["user"].(string); isID {
+			user["id"] = id
+		}
+	}
+
+	for _, name := range []string{"username", "roles"} {
+		if value, found := claims[name]; found {
+			if _, set := user[name]; !set {
+				user[name] = value
+			}
+			delete(claims, name)
+		}
+	}
+
+	if roles, isString := user["roles"].(string); isString {
+		user["roles"] = legacyRoles(roles)
+	}
+	claims["user"] = user
+
+	for _, name := range legacyTimeClaims {
+		value, found := claims[name]
+		if !found {
+			continue
+		}
+
+		seconds, err := legacyTime(value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s claim", name)
+		}
+		claims[name] = seconds
+	}
+
+	if audiences, isArray := claims["aud"].([]interface{}); isArray && len(audiences) == 1 {
+		claims["aud"] = audiences[0]
+	}
+	return nil
+}
+
+func legacyRoles(roles string) []string {
+	result := []string{}
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			result = append(result, role)
+		}
+	}
+	return result
+}
+
+// legacyTime returns the seconds of a time claim, truncating fractions
+func legacyTime(value interface{}) (int64, error) {
+	var seconds float64
+	switch value := value.(type) {
+	case float64:
+		seconds = value
+	case json.Number, string:
+		parsed, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return 0, err
+		}
+		seconds = parsed
+	default:
+		return 0, errors.New("not a number")
+	}
+
+	if math.IsNaN(seconds) || math.Abs(seconds) >= math.MaxInt64 {
+		return 0, errors.New("out of range")
+	}
+	return int64(math.Floor(seconds)), nil
+}
+
+// migrateLegacy upgrades legacy claims during the migration window and refuses them with ErrLegacyClaims afterwards
+func (service JWTService) migrateLegacy(claims map[string]interface{}) error {
+	if !service.Now().Before(service.config.legacyUntil) {
+		return ErrLegacyClaims
+	}
+
+	return LegacyClaimsMigrator(claims)
+}
+
+// SetLegacyClaimsUntil is the setter for the end of the migration window of the legacy claims, i.e. of the tokens issued before claims were versioned.
+// Until then, legacy tokens are upgraded by LegacyClaimsMigrator before the claims migrations, afterwards they are refused with ErrLegacyClaims.
+// Issued tokens always have the current layout. Legacy tokens of a compatible layout are accepted as they are by default
+func (config *JWTConfig) SetLegacyClaimsUntil(until time.Time) {
+	config.legacyUntil = until
+}
@@ -0,0 +1,118 @@
+package gate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+func TestLegacyClaimsMigrator(t *testing.T) {
+	claims := map[string]interface{}{
+		"user":     "legacy-id",
+		"username": "alice",
+		"roles":    "editor, viewer,",
+		"exp":      1.5000000005e+09,
+		"iat":      "1500000000",
+		"aud":      []interface{}{"api"},
+	}
+
+	err := LegacyClaimsMigrator(claims)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	user := claims["user"].(map[string]interface{})
+	roles, _ := user["roles"].([]string)
+	if user["id"] != "legacy-id" || user["username"] != "alice" || len(roles) != 2 || roles[1] != "viewer" {
+		t.Fatalf("the user should be folded into the user claim: %v", user)
+	}
+
+	if _, ok := claims["username"]; ok {
+		t.Fatal("top-level user claims should be removed")
+	}
+
+	if claims["exp"] != int64(1500000000) || claims["iat"] != int64(1500000000) || claims["aud"] != "api" {
+		t.Fatalf("standard claims should be normalized: %v", claims)
+	}
+
+	err = LegacyClaimsMigrator(map[string]interface{}{"exp": "never"})
+	if err == nil {
+		t.Fatal("err should not be nil because of the invalid time claim")
+	}
+}
+
+func TestLegacyClaimsUntil(t *testing.T) {
+	now := time.Now()
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user": map[string]interface{}{"id": "legacy-id", "roles": "editor"},
+		"exp":  float64(now.Add(time.Hour).Unix()) + 0.5,
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	service, config := newTestJWTService(t)
+	_, err = service.Parse(legacy)
+	if err == nil {
+		t.Fatal("err should not be nil because of the legacy layout without a migration window")
+	}
+
+	config.SetLegacyClaimsUntil(now.Add(24 * time.Hour))
+	service = NewJWTService(config)
+
+	t.Run("window", func(t *testing.T) {
+		token, err := service.Parse(legacy)
+		if err != nil {
+			t.Fatalf("err should be nil because of the migration window: %s", err)
+		}
+
+		if token.UserID != "legacy-id" || len(token.User.Roles) != 1 {
+			t.Fatalf("the legacy claims should be migrated: %v", token)
+		}
+	})
+
+	t.Run("issue", func(t *testing.T) {
+		issued, err := service.Issue(service.NewClaims(ClaimsUser{ID: "id"}))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		token, err := service.Parse(issued.Value)
+		if err != nil || token.UserID != "id" {
+			t.Fatalf("issued tokens should have the current layout: %v - %v", token, err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		closed := NewJWTService(config)
+		closed.Now = func() time.Time {
+			return now.Add(48 * time.Hour)
+		}
+
+		compatible, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user": map[string]interface{}{"id": "legacy-id"},
+		}).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		for _, tokenString := range []string{legacy, compatible} {
+			_, err = closed.Parse(tokenString)
+			if errors.Cause(err) != ErrLegacyClaims {
+				t.Fatalf("err should be ErrLegacyClaims because the migration window is closed: %v", err)
+			}
+		}
+
+		issued, err := closed.Issue(closed.NewClaims(ClaimsUser{ID: "id"}))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = closed.Parse(issued.Value)
+		if err != nil {
+			t.Fatalf("current tokens should be accepted after the migration window: %s", err)
+		}
+	})
+}
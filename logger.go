@@ -0,0 +1,143 @@
+package gate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogLevel is the severity of a log entry
+type LogLevel int
+
+// Log levels
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// String returns the name of the level
+func (level LogLevel) String() string {
+	switch level {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// Logger is the contract for structured loggers. Entries are key-value pairs after the message, e.g. "user", "1", "action", "GET"
+type Logger interface {
+	Enabled(LogLevel) bool
+	Log(level LogLevel, msg string, keysAndValues ...interface{})
+}
+
+// NopLogger discards every entry. It is the default logger
+type NopLogger struct{}
+
+// Enabled reports that no level is enabled
+func (NopLogger) Enabled(LogLevel) bool {
+	return false
+}
+
+// Log discards the entry
+func (NopLogger) Log(LogLevel, string, ...interface{}) {}
+
+// ZapSugaredLogger is the part of *zap.SugaredLogger the zap adapter relies on
+type ZapSugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+type zapLogger struct {
+	logger ZapSugaredLogger
+	level  LogLevel
+}
+
+func (logger zapLogger) Enabled(level LogLevel) bool {
+	return level >= logger.level
+}
+
+func (logger zapLogger) Log(level LogLevel, msg string, keysAndValues ...interface{}) {
+	if !logger.Enabled(level) {
+		return
+	}
+
+	switch level {
+	case LogLevelDebug:
+		logger.logger.Debugw(msg, keysAndValues...)
+	case LogLevelInfo:
+		logger.logger.Infow(msg, keysAndValues...)
+	case LogLevelWarn:
+		logger.logger.Warnw(msg, keysAndValues...)
+	default:
+		logger.logger.Errorw(msg, keysAndValues...)
+	}
+}
+
+// NewZapLogger is the Logger adapter for zap, e.g. NewZapLogger(logger.Sugar(), LogLevelWarn). Entries below the given level are discarded
+func NewZapLogger(logger ZapSugaredLogger, level LogLevel) Logger {
+	return zapLogger{logger, level}
+}
+
+// LogrusLogger is the part of logrus.FieldLogger the logrus adapter relies on
+type LogrusLogger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type logrusLogger struct {
+	logger LogrusLogger
+	level  LogLevel
+}
+
+func (logger logrusLogger) Enabled(level LogLevel) bool {
+	return level >= logger.level
+}
+
+func (logger logrusLogger) Log(level LogLevel, msg string, keysAndValues ...interface{}) {
+	if !logger.Enabled(level) {
+		return
+	}
+
+	entry := formatLogEntry(msg, keysAndValues)
+	switch level {
+	case LogLevelDebug:
+		logger.logger.Debugf("%s", entry)
+	case LogLevelInfo:
+		logger.logger.Infof("%s", entry)
+	case LogLevelWarn:
+		logger.logger.Warnf("%s", entry)
+	default:
+		logger.logger.Errorf("%s", entry)
+	}
+}
+
+// NewLogrusLogger is the Logger adapter for logrus, e.g. NewLogrusLogger(logrus.StandardLogger(), LogLevelWarn).
+// Key-value pairs are appended to the message in the logfmt style. Entries below the given level are discarded
+func NewLogrusLogger(logger LogrusLogger, level LogLevel) Logger {
+	return logrusLogger{logger, level}
+}
+
+// formatLogEntry formats a message and its key-value pairs in the logfmt style
+func formatLogEntry(msg string, keysAndValues []interface{}) string {
+	parts := []string{msg}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+
+		parts = append(parts, fmt.Sprintf("%v=%q", keysAndValues[i], fmt.Sprint(value)))
+	}
+
+	return strings.Join(parts, " ")
+}
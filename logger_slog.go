@@ -0,0 +1,39 @@
+//go:build go1.21
+// +build go1.21
+
+package gate
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (logger slogLogger) level(level LogLevel) slog.Level {
+	switch level {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelInfo:
+		return slog.LevelInfo
+	case LogLevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+func (logger slogLogger) Enabled(level LogLevel) bool {
+	return logger.logger.Enabled(context.Background(), logger.level(level))
+}
+
+func (logger slogLogger) Log(level LogLevel, msg string, keysAndValues ...interface{}) {
+	logger.logger.Log(context.Background(), logger.level(level), msg, keysAndValues...)
+}
+
+// NewSlogLogger is the Logger adapter for log/slog. Levels are gated by the handler of the logger
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return slogLogger{logger}
+}
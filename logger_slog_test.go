@@ -0,0 +1,25 @@
+//go:build go1.21
+// +build go1.21
+
+package gate
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	if logger.Enabled(LogLevelDebug) || !logger.Enabled(LogLevelWarn) {
+		t.Fatal("levels should be gated by the handler")
+	}
+
+	logger.Log(LogLevelWarn, "missing service", "service", "role")
+	if !strings.Contains(buffer.String(), "level=WARN") || !strings.Contains(buffer.String(), "service=role") {
+		t.Fatalf("entry should be logged with its attributes: %s", buffer.String())
+	}
+}
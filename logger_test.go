@@ -0,0 +1,99 @@
+package gate
+
+import (
+	"fmt"
+	"testing"
+)
+
+type testLogEntry struct {
+	level string
+	msg   string
+	args  []interface{}
+}
+
+type testZapLogger struct {
+	entries []testLogEntry
+}
+
+func (logger *testZapLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	logger.entries = append(logger.entries, testLogEntry{"debug", msg, keysAndValues})
+}
+
+func (logger *testZapLogger) Infow(msg string, keysAndValues ...interface{}) {
+	logger.entries = append(logger.entries, testLogEntry{"info", msg, keysAndValues})
+}
+
+func (logger *testZapLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	logger.entries = append(logger.entries, testLogEntry{"warn", msg, keysAndValues})
+}
+
+func (logger *testZapLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	logger.entries = append(logger.entries, testLogEntry{"error", msg, keysAndValues})
+}
+
+type testLogrusLogger struct {
+	entries []testLogEntry
+}
+
+func (logger *testLogrusLogger) logf(level, format string, args ...interface{}) {
+	logger.entries = append(logger.entries, testLogEntry{level, fmt.Sprintf(format, args...), nil})
+}
+
+func (logger *testLogrusLogger) Debugf(format string, args ...interface{}) {
+	logger.logf("debug", format, args...)
+}
+
+func (logger *testLogrusLogger) Infof(format string, args ...interface{}) {
+	logger.logf("info", format, args...)
+}
+
+func (logger *testLogrusLogger) Warnf(format string, args ...interface{}) {
+	logger.logf("warn", format, args...)
+}
+
+func (logger *testLogrusLogger) Errorf(format string, args ...interface{}) {
+	logger.logf("error", format, args...)
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("nop", func(t *testing.T) {
+		if (NopLogger{}).Enabled(LogLevelError) {
+			t.Fatal("no level should be enabled")
+		}
+
+		if _, ok := (Dependencies{}).Logger().(NopLogger); !ok {
+			t.Fatal("dependencies should default to NopLogger")
+		}
+	})
+
+	t.Run("zap", func(t *testing.T) {
+		zap := &testZapLogger{}
+		logger := NewZapLogger(zap, LogLevelWarn)
+		logger.Log(LogLevelDebug, "ignored")
+		logger.Log(LogLevelWarn, "missing service", "service", "role")
+
+		if len(zap.entries) != 1 || zap.entries[0].level != "warn" || len(zap.entries[0].args) != 2 {
+			t.Fatalf("entries should be gated by level: %v", zap.entries)
+		}
+	})
+
+	t.Run("logrus", func(t *testing.T) {
+		logrus := &testLogrusLogger{}
+		logger := NewLogrusLogger(logrus, LogLevelDebug)
+		logger.Log(LogLevelDebug, "authorization denied", "user", "1", "dangling")
+
+		expected := `authorization denied user="1" dangling="(MISSING)"`
+		if len(logrus.entries) != 1 || logrus.entries[0].msg != expected {
+			t.Fatalf("key-value pairs should be formatted: %v", logrus.entries)
+		}
+	})
+
+	t.Run("levels", func(t *testing.T) {
+		names := map[LogLevel]string{LogLevelDebug: "debug", LogLevelInfo: "info", LogLevelWarn: "warn", LogLevelError: "error"}
+		for level, name := range names {
+			if level.String() != name {
+				t.Errorf("level should be named %s: %s", name, level)
+			}
+		}
+	})
+}
@@ -3,34 +3,60 @@ package gate
 import (
 	"errors"
 	"regexp"
+	"strings"
 	"sync"
 )
 
 // ErrInvalidExpression is thrown when the given expression is invalid
 var ErrInvalidExpression = errors.New("invalid expression")
 
+var asteriskExpression = regexp.MustCompile(`\*($|\/)`)
+
 // AsteriskParse translates asterisk "*" into "(.{0,})" for convenience
 func AsteriskParse(exp string) (result string) {
-	re := regexp.MustCompile(`\*($|\/)`)
-	result = re.ReplaceAllString(exp, "(.{0,})$1")
+	result = asteriskExpression.ReplaceAllString(exp, "(.{0,})$1")
 	return
 }
 
-// Matcher performs match operations for the given string and pattern with caching support
+// MatcherCacheSize is the maximum number of compiled expressions and split paths cached by a Matcher.
+// A full cache is reset, so patterns which are not matched anymore, e.g. of expired scoped tokens, do not accumulate
+const MatcherCacheSize = 4096
+
+// Normalizer transforms strings before matching or login, e.g. NFC
+type Normalizer func(string) string
+
+// Matcher performs match operations for the given string and pattern with caching support, up to MatcherCacheSize patterns
 type Matcher struct {
-	expressions map[string]*regexp.Regexp
+	expressions     map[string]*regexp.Regexp
+	paths           map[string][]string
+	objectPaths     bool
+	caseInsensitive bool
+	normalizer      Normalizer
 	*sync.RWMutex
 }
 
-func (service Matcher) getExpression(key string) (expression *regexp.Regexp, err error) {
+// getExpression returns the compiled expression of the pattern. Patterns are compiled once and cached
+func (service Matcher) getExpression(pattern string) (expression *regexp.Regexp, err error) {
+	key := pattern
+	if service.caseInsensitive {
+		key = "(?i)" + pattern
+	}
+
+	service.RLock()
 	expression, ok := service.expressions[key]
-	if !ok {
-		expression, err = regexp.Compile(AsteriskParse(key))
-		if err != nil {
-			return
-		}
+	service.RUnlock()
+	if ok {
+		return
+	}
 
-		service.expressions[key] = expression
+	source := AsteriskParse(pattern)
+	if service.caseInsensitive {
+		source = "(?i)" + source
+	}
+
+	expression, err = regexp.Compile(source)
+	if err != nil {
+		return
 	}
 
 	if expression == nil {
@@ -38,27 +64,227 @@ func (service Matcher) getExpression(key string) (expression *regexp.Regexp, err
 		return
 	}
 
+	service.Lock()
+	if len(service.expressions) >= MatcherCacheSize {
+		for cached := range service.expressions {
+			delete(service.expressions, cached)
+		}
+	}
+	service.expressions[key] = expression
+	service.Unlock()
+	return
+}
+
+// getPath returns the segments of the path pattern. Patterns are split and validated once and cached
+func (service Matcher) getPath(pattern string) (segments []string, err error) {
+	service.RLock()
+	segments, ok := service.paths[pattern]
+	service.RUnlock()
+	if ok {
+		return
+	}
+
+	segments = splitPath(pattern)
+	for _, segment := range segments {
+		if segment == ":" {
+			err = ErrInvalidExpression
+			return
+		}
+	}
+
+	service.Lock()
+	if len(service.paths) >= MatcherCacheSize {
+		for cached := range service.paths {
+			delete(service.paths, cached)
+		}
+	}
+	service.paths[pattern] = segments
+	service.Unlock()
 	return
 }
 
 // Match performs the match operation
 func (service Matcher) Match(str, pattern string) (match bool, err error) {
-	service.Lock()
-	defer service.Unlock()
+	expression, err := service.getExpression(service.normalize(pattern))
+	if err != nil {
+		return
+	}
+
+	match = expression.MatchString(service.normalize(str))
+	return
+}
+
+func (service Matcher) normalize(str string) string {
+	if service.normalizer == nil {
+		return str
+	}
+
+	return service.normalizer(str)
+}
+
+// SetCaseInsensitive is the setter for case-insensitive matching
+func (service *Matcher) SetCaseInsensitive(enabled bool) {
+	service.caseInsensitive = enabled
+}
+
+// CaseInsensitive is the getter for case-insensitive matching
+func (service Matcher) CaseInsensitive() bool {
+	return service.caseInsensitive
+}
+
+// SetNormalizer is the setter for the normalizer applied to both strings and patterns before matching, e.g. NFC.
+// Strings are matched as they are by default
+func (service *Matcher) SetNormalizer(normalizer Normalizer) {
+	service.normalizer = normalizer
+}
+
+// SetObjectPaths is the setter for the object-path mode used by MatchObject
+func (service *Matcher) SetObjectPaths(enabled bool) {
+	service.objectPaths = enabled
+}
 
-	expression, err := service.getExpression(pattern)
+// ObjectPaths is the getter for the object-path mode
+func (service Matcher) ObjectPaths() bool {
+	return service.objectPaths
+}
+
+// MatchObject performs the match operation for objects, using MatchPath in the object-path mode and Match otherwise
+func (service Matcher) MatchObject(object, pattern string) (bool, error) {
+	if service.objectPaths {
+		return service.MatchPath(object, pattern)
+	}
+
+	return service.Match(object, pattern)
+}
+
+// MatchAbility reports whether an ability grants an action on an object. Abilities with an empty action or object are ignored.
+// The ownership modifier of the ability object is not part of the pattern and template placeholders match anything, see MatchTemplate
+func (service Matcher) MatchAbility(action, object string, ability UserAbility) bool {
+	pattern := objectPattern(ability)
+	if IsTemplate(ability) {
+		pattern = service.templateWildcard(pattern)
+	}
+
+	if ability.GetAction() == "" || pattern == "" {
+		return false
+	}
+
+	actionMatch, err := service.Match(action, ability.GetAction())
+	if err != nil || !actionMatch {
+		return false
+	}
+
+	objectMatch, err := service.MatchObject(object, pattern)
+	return err == nil && objectMatch
+}
+
+// MatchPath performs the match operation for slash-separated resource paths.
+// Pattern segments may be a literal, "*" for any single segment, ":name" for any single segment captured as a parameter
+// or "**" for any number of segments, e.g. "projects/:id/issues/*"
+func (service Matcher) MatchPath(path, pattern string) (match bool, err error) {
+	_, match, err = service.MatchPathParams(path, pattern)
+	return
+}
+
+// MatchPathParams performs the match operation for slash-separated resource paths and returns the captured parameters
+func (service Matcher) MatchPathParams(path, pattern string) (params map[string]string, match bool, err error) {
+	patternSegments, err := service.getPath(service.normalize(pattern))
 	if err != nil {
 		return
 	}
 
-	match = expression.MatchString(str)
+	params = map[string]string{}
+	match = service.matchSegments(splitPath(service.normalize(path)), patternSegments, params)
+	if !match {
+		params = nil
+	}
 	return
 }
 
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+
+	return strings.Split(path, "/")
+}
+
+func (service Matcher) matchSegments(segments, patterns []string, params map[string]string) bool {
+	if len(patterns) == 0 {
+		return len(segments) == 0
+	}
+
+	pattern := patterns[0]
+	if pattern == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if service.matchSegments(segments[i:], patterns[1:], params) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	segment := segments[0]
+	switch {
+	case pattern == "*":
+		if segment == "" {
+			return false
+		}
+	case strings.HasPrefix(pattern, ":"):
+		if segment == "" {
+			return false
+		}
+
+		name := pattern[1:]
+		previous, captured := params[name]
+		if captured && !service.equal(previous, segment) {
+			return false
+		}
+
+		params[name] = segment
+		if service.matchSegments(segments[1:], patterns[1:], params) {
+			return true
+		}
+
+		if !captured {
+			delete(params, name)
+		}
+		return false
+	case !service.equal(pattern, segment):
+		return false
+	}
+
+	return service.matchSegments(segments[1:], patterns[1:], params)
+}
+
+func (service Matcher) equal(a, b string) bool {
+	if service.caseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+
+	return a == b
+}
+
+// NewMatcherWithConfig is the constructor for Matcher using the matching options of the given configuration
+func NewMatcherWithConfig(config Config) Matcher {
+	matcher := NewMatcher()
+	matcher.SetObjectPaths(config.ObjectPathMatching())
+	matcher.SetCaseInsensitive(config.CaseInsensitiveMatching())
+	matcher.SetNormalizer(config.MatchingNormalizer())
+	return matcher
+}
+
 // NewMatcher is the constructor for Matcher
 func NewMatcher() Matcher {
 	return Matcher{
 		expressions: map[string]*regexp.Regexp{},
+		paths:       map[string][]string{},
 		RWMutex:     &sync.RWMutex{},
 	}
 }
@@ -34,3 +34,20 @@ func ExampleMatcher() {
 	// true <nil>
 	// true <nil>
 }
+
+func ExampleMatcher_MatchPath() {
+	matcher := NewMatcher()
+
+	fmt.Println(matcher.MatchPath("projects/1/issues/2", "projects/:id/issues/*"))
+	fmt.Println(matcher.MatchPath("projects/1/issues/2/comments", "projects/:id/issues/*"))
+	fmt.Println(matcher.MatchPath("projects/1/issues/2/comments", "projects/:id/**"))
+
+	params, match, err := matcher.MatchPathParams("projects/1/issues/2", "projects/:project/issues/:issue")
+	fmt.Println(params["project"], params["issue"], match, err)
+
+	// Output:
+	// true <nil>
+	// false <nil>
+	// true <nil>
+	// 1 2 true <nil>
+}
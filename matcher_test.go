@@ -1,6 +1,8 @@
 package gate
 
 import (
+	"fmt"
+	"regexp"
 	"testing"
 )
 
@@ -41,4 +43,170 @@ func TestMatcher(t *testing.T) {
 			t.Fatal("incorrect assertion")
 		}
 	})
+	t.Run("cache size", func(t *testing.T) {
+		matcher := NewMatcher()
+		for i := 0; i <= MatcherCacheSize; i++ {
+			matcher.Match("foobar", fmt.Sprintf("foobar-%d*", i))
+		}
+
+		if len(matcher.expressions) > MatcherCacheSize {
+			t.Fatalf("the cache should be bounded: %d", len(matcher.expressions))
+		}
+
+		match, err := matcher.Match("foobar-1", "foobar-1*")
+		if !match || err != nil {
+			t.Fatal("patterns should still match once the cache is reset")
+		}
+	})
+}
+
+func TestMatcherPath(t *testing.T) {
+	matcher := NewMatcher()
+	cases := []struct {
+		path    string
+		pattern string
+		match   bool
+	}{
+		{"projects/1/issues/2", "projects/:id/issues/*", true},
+		{"/projects/1/issues/2/", "projects/:id/issues/*", true},
+		{"projects/1/issues", "projects/:id/issues/*", false},
+		{"projects/1/issues/2/comments", "projects/:id/issues/*", false},
+		{"projects/1/issues/2/comments", "projects/**", true},
+		{"projects", "projects/**", true},
+		{"projects/1/issues/2/comments/3", "projects/**/comments/:id", true},
+		{"users/1/issues/2", "projects/:id/issues/*", false},
+		{"projects/1/members/1", "projects/:id/members/:id", true},
+		{"projects/1/members/2", "projects/:id/members/:id", false},
+		{"projects//issues", "projects/*/issues", false},
+	}
+
+	for _, c := range cases {
+		match, err := matcher.MatchPath(c.path, c.pattern)
+		if err != nil || match != c.match {
+			t.Fatalf("incorrect assertion for %s - %s: %v %v", c.path, c.pattern, match, err)
+		}
+	}
+
+	t.Run("params", func(t *testing.T) {
+		params, match, err := matcher.MatchPathParams("projects/1/issues/2", "projects/:project/issues/:issue")
+		if err != nil || !match {
+			t.Fatal("incorrect assertion")
+		}
+
+		if params["project"] != "1" || params["issue"] != "2" {
+			t.Fatalf("incorrect params: %v", params)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := matcher.MatchPath("projects/1", "projects/:")
+		if err != ErrInvalidExpression {
+			t.Fatal("incorrect assertion")
+		}
+	})
+
+	t.Run("object mode", func(t *testing.T) {
+		matcher := NewMatcher()
+		matcher.SetObjectPaths(true)
+
+		match, err := matcher.MatchObject("projects/1", "projects/*")
+		if !match || err != nil {
+			t.Fatal("incorrect assertion")
+		}
+
+		match, err = matcher.MatchObject("projects/1/issues", "projects/*")
+		if match || err != nil {
+			t.Fatal("incorrect assertion")
+		}
+	})
+}
+
+func TestMatcherOptions(t *testing.T) {
+	t.Run("case insensitive", func(t *testing.T) {
+		matcher := NewMatcher()
+		match, err := matcher.Match("/API/Posts", "/api/posts*")
+		if match || err != nil {
+			t.Fatal("incorrect assertion")
+		}
+
+		matcher.SetCaseInsensitive(true)
+		match, err = matcher.Match("/API/Posts", "/api/posts*")
+		if !match || err != nil {
+			t.Fatal("incorrect assertion")
+		}
+
+		match, err = matcher.MatchPath("Projects/1", "projects/:id")
+		if !match || err != nil {
+			t.Fatal("incorrect assertion")
+		}
+	})
+
+	t.Run("normalizer", func(t *testing.T) {
+		matcher := NewMatcher()
+		match, err := matcher.Match("caf\u00e9", "cafe\u0301")
+		if match || err != nil {
+			t.Fatal("incorrect assertion")
+		}
+
+		matcher.SetNormalizer(NFC)
+		match, err = matcher.Match("caf\u00e9", "cafe\u0301")
+		if !match || err != nil {
+			t.Fatal("incorrect assertion")
+		}
+
+		match, err = matcher.MatchPath("menus/cafe\u0301", "menus/caf\u00e9")
+		if !match || err != nil {
+			t.Fatal("incorrect assertion")
+		}
+	})
+}
+
+func benchmarkPatterns(count int) (patterns []string) {
+	for i := 0; i < count; i++ {
+		patterns = append(patterns, fmt.Sprintf("/api/v1/resources-%d/*", i))
+	}
+	return
+}
+
+func BenchmarkMatcher(b *testing.B) {
+	for _, count := range []int{10, 1000, 5000} {
+		patterns := benchmarkPatterns(count)
+
+		b.Run(fmt.Sprintf("uncached/%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, pattern := range patterns {
+					expression, err := regexp.Compile(AsteriskParse(pattern))
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					expression.MatchString("/api/v1/posts/1")
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("cached/%d", count), func(b *testing.B) {
+			matcher := NewMatcher()
+			for i := 0; i < b.N; i++ {
+				for _, pattern := range patterns {
+					_, err := matcher.Match("/api/v1/posts/1", pattern)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("path/%d", count), func(b *testing.B) {
+			matcher := NewMatcher()
+			for i := 0; i < b.N; i++ {
+				for _, pattern := range patterns {
+					_, err := matcher.MatchPath("/api/v1/posts/1", pattern)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
 }
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+// SubjectHeader is the request and response header carrying gate.SubjectHash of the user
+const SubjectHeader = "X-Gate-Subject"
+
+// RolesHeader is the request and response header carrying gate.RolesHash of the user roles
+const RolesHeader = "X-Gate-Roles"
+
+// TokenHeader is the request and response header carrying gate.TokenHash of the token ID, which keys the shared responses
+const TokenHeader = "X-Gate-Token"
+
+// CacheScope is the scope in which authorized responses may be reused
+type CacheScope int
+
+const (
+	// CachePrivate allows authorized responses to be reused by the client only
+	CachePrivate CacheScope = iota
+	// CacheBySubject allows shared caches to reuse authorized responses for the same user, keyed by SubjectHeader and TokenHeader
+	CacheBySubject
+	// CacheByRoles allows shared caches to reuse authorized responses for users of the same roles, keyed by RolesHeader and TokenHeader
+	CacheByRoles
+)
+
+// cacheHints is the configuration of cacheability hints
+type cacheHints struct {
+	scope             CacheScope
+	maxAge            time.Duration
+	revocationLatency time.Duration
+}
+
+// SetCacheHints is the setter for the cacheability hints of authorized responses. Shared scopes only apply to requests
+// whose hint header and TokenHeader were set by an edge which verified the token and computed the same hints, e.g. with gate.EdgeConfig.
+// Since revocations are not checked by shared caches, shared responses are keyed on the token and reused for the revocation latency at most,
+// i.e. the time a revoked token may be accepted for. Shared responses are disabled without a revocation latency.
+// Other authorized responses are private, failures are not stored. Hints are disabled by default
+func (middleware *Middleware) SetCacheHints(scope CacheScope, maxAge, revocationLatency time.Duration) {
+	if maxAge <= 0 {
+		middleware.cacheHints = nil
+		return
+	}
+
+	middleware.cacheHints = &cacheHints{scope, maxAge, revocationLatency}
+}
+
+// hintCache sets the cacheability headers of an authorized response
+func (middleware Middleware) hintCache(w http.ResponseWriter, r *http.Request, user gate.User) {
+	hints := middleware.cacheHints
+	if hints == nil {
+		return
+	}
+
+	header, hint := "", ""
+	switch hints.scope {
+	case CacheBySubject:
+		header, hint = SubjectHeader, gate.SubjectHash(user)
+	case CacheByRoles:
+		header, hint = RolesHeader, gate.RolesHash(user.GetRoles())
+	}
+
+	token := ""
+	if authz, ok := AuthzContextFromContext(r.Context()); ok && authz.Token.ID != "" {
+		token = gate.TokenHash(authz.Token.ID)
+	}
+
+	if header == "" || hints.revocationLatency <= 0 || token == "" || r.Header.Get(header) != hint || r.Header.Get(TokenHeader) != token {
+		w.Header().Set("Cache-Control", "private, max-age="+seconds(hints.maxAge))
+		w.Header().Add("Vary", "Authorization")
+		return
+	}
+
+	maxAge := hints.maxAge
+	if maxAge > hints.revocationLatency {
+		maxAge = hints.revocationLatency
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age="+seconds(maxAge))
+	w.Header().Add("Vary", TokenHeader+", "+header)
+	w.Header().Set(TokenHeader, token)
+	w.Header().Set(header, hint)
+}
+
+func seconds(duration time.Duration) string {
+	return strconv.FormatInt(int64(duration/time.Second), 10)
+}
+
+// noStore prevents failures from being stored when cacheability hints are enabled
+func (middleware Middleware) noStore(w http.ResponseWriter) {
+	if middleware.cacheHints != nil {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+}
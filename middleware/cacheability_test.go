@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+func TestCacheHints(t *testing.T) {
+	var contexts, authorized int
+	hinted := New(contextAuth{auth, &contexts, &authorized})
+	hinted.SetCacheHints(CacheByRoles, time.Minute, 30*time.Second)
+	handler := hinted.Authorize(http.HandlerFunc(okHandler))
+	request := func(hints map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/posts", nil)
+		r.Header.Set("Authorization", "Bearer token")
+		for header, hint := range hints {
+			r.Header.Set(header, hint)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	t.Run("private", func(t *testing.T) {
+		recorder := serve(handler, "GET", "/posts", "token")
+		if control := recorder.Header().Get("Cache-Control"); control != "private, max-age=60" {
+			t.Fatalf("responses without an edge hint should be private: %s", control)
+		}
+
+		if vary := recorder.Header().Get("Vary"); vary != "Authorization" {
+			t.Fatalf("invalid vary: %s", vary)
+		}
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		hint, token := gate.RolesHash(nil), gate.TokenHash("token")
+		recorder := request(map[string]string{RolesHeader: hint, TokenHeader: token})
+		if control := recorder.Header().Get("Cache-Control"); control != "public, max-age=30" {
+			t.Fatalf("responses with the edge hints should be shared for the revocation latency at most: %s", control)
+		}
+
+		if recorder.Header().Get("Vary") != TokenHeader+", "+RolesHeader || recorder.Header().Get(RolesHeader) != hint || recorder.Header().Get(TokenHeader) != token {
+			t.Fatalf("invalid hint headers: %v", recorder.Header())
+		}
+
+		recorder = request(map[string]string{RolesHeader: gate.RolesHash([]string{"admin"}), TokenHeader: token})
+		if control := recorder.Header().Get("Cache-Control"); control != "private, max-age=60" {
+			t.Fatalf("responses with another hint should be private: %s", control)
+		}
+
+		recorder = request(map[string]string{RolesHeader: hint})
+		if control := recorder.Header().Get("Cache-Control"); control != "private, max-age=60" {
+			t.Fatalf("responses without the token key should be private: %s", control)
+		}
+
+		hinted.SetCacheHints(CacheByRoles, time.Minute, 0)
+		handler = hinted.Authorize(http.HandlerFunc(okHandler))
+		recorder = request(map[string]string{RolesHeader: hint, TokenHeader: token})
+		if control := recorder.Header().Get("Cache-Control"); control != "private, max-age=60" {
+			t.Fatalf("responses should be private without a revocation latency: %s", control)
+		}
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		for _, token := range []string{"invalid", ""} {
+			if control := serve(handler, "DELETE", "/posts", token).Header().Get("Cache-Control"); control != "no-store" {
+				t.Fatalf("failures should not be stored: %s", control)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		hinted.SetCacheHints(CacheBySubject, 0, time.Minute)
+		recorder := serve(hinted.Authorize(http.HandlerFunc(okHandler)), "GET", "/posts", "token")
+		if control := recorder.Header().Get("Cache-Control"); control != "" {
+			t.Fatalf("hints should be disabled: %s", control)
+		}
+	})
+}
@@ -0,0 +1,2 @@
+// Package middleware is the net/http integration for github.com/hiendv/gate
+package middleware
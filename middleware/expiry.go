@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+// ExpiresInHeader is the response header carrying the seconds left before the token of a request expires
+const ExpiresInHeader = "X-Token-Expires-In"
+
+// RefreshHeader is the response header carrying the refresh hint along with ExpiresInHeader, e.g. the refresh endpoint
+const RefreshHeader = "X-Token-Refresh"
+
+// expiryWarning is the configuration of soft expiry warnings
+type expiryWarning struct {
+	window  time.Duration
+	refresh string
+}
+
+// SetExpiryWarning is the setter for soft expiry warnings. Responses to requests authenticated with a token expiring within the window
+// carry ExpiresInHeader and RefreshHeader unless the refresh hint is empty, so clients refresh the token before it is rejected.
+// The expiration is the one of the token parsed by the authentication, i.e. the authenticator must implement ContextAuthenticator
+// or TokenParser. Warnings are disabled by default
+func (middleware *Middleware) SetExpiryWarning(window time.Duration, refresh string) {
+	if window <= 0 {
+		middleware.expiryWarning = nil
+		return
+	}
+
+	middleware.expiryWarning = &expiryWarning{window, refresh}
+}
+
+// warnExpiry sets the expiry headers if the token of an authenticated request expires within the window.
+// The token parsed by the authentication is reused
+func (middleware Middleware) warnExpiry(w http.ResponseWriter, authz *gate.AuthzContext) {
+	warning := middleware.expiryWarning
+	if warning == nil || authz == nil || authz.Token.ExpiredAt.IsZero() {
+		return
+	}
+
+	left := authz.Token.ExpiredAt.Sub(middleware.now())
+	if left > warning.window {
+		return
+	}
+
+	if left < 0 {
+		left = 0
+	}
+
+	w.Header().Set(ExpiresInHeader, strconv.FormatInt(int64(left/time.Second), 10))
+	if warning.refresh != "" {
+		w.Header().Set(RefreshHeader, warning.refresh)
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/gatetest"
+)
+
+type countingParser struct {
+	myAuth
+	parses *int
+}
+
+func (auth countingParser) ParseJWT(token string) (gate.JWT, error) {
+	*auth.parses++
+	return auth.myAuth.ParseJWT(token)
+}
+
+func TestExpiryWarning(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := gatetest.NewFrozenClock(now)
+	expiring := myAuth{
+		tokens:      map[string]gate.User{"soon": user{id: "id"}, "later": user{id: "id"}},
+		grants:      []grant{{"id", "GET", "/posts"}},
+		expirations: map[string]time.Time{"soon": now.Add(time.Minute), "later": now.Add(time.Hour)},
+	}
+
+	middleware := New(expiring)
+	middleware.SetClock(clock)
+	middleware.SetExpiryWarning(5*time.Minute, "/auth/refresh")
+
+	t.Run("within the window", func(t *testing.T) {
+		recorder := serve(middleware.Authenticate(http.HandlerFunc(okHandler)), "GET", "/posts", "soon")
+		if recorder.Code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the valid token: %d", recorder.Code)
+		}
+
+		left, err := strconv.Atoi(recorder.Header().Get(ExpiresInHeader))
+		if err != nil || left != 60 {
+			t.Fatalf("expiration should be warned: %q", recorder.Header().Get(ExpiresInHeader))
+		}
+
+		if recorder.Header().Get(RefreshHeader) != "/auth/refresh" {
+			t.Fatalf("refresh hint should be set: %q", recorder.Header().Get(RefreshHeader))
+		}
+	})
+
+	t.Run("outside the window", func(t *testing.T) {
+		recorder := serve(middleware.Authorize(http.HandlerFunc(okHandler)), "GET", "/posts", "later")
+		if recorder.Header().Get(ExpiresInHeader) != "" || recorder.Header().Get(RefreshHeader) != "" {
+			t.Fatal("expiration should not be warned because of the distant expiration")
+		}
+	})
+
+	t.Run("boundaries", func(t *testing.T) {
+		defer clock.Set(now)
+
+		clock.Set(now.Add(55*time.Minute - time.Second))
+		recorder := serve(middleware.Authenticate(http.HandlerFunc(okHandler)), "GET", "/posts", "later")
+		if recorder.Header().Get(ExpiresInHeader) != "" {
+			t.Fatal("expiration should not be warned right before the window")
+		}
+
+		clock.Set(now.Add(55 * time.Minute))
+		recorder = serve(middleware.Authenticate(http.HandlerFunc(okHandler)), "GET", "/posts", "later")
+		if recorder.Header().Get(ExpiresInHeader) != "300" {
+			t.Fatalf("expiration should be warned at the start of the window: %q", recorder.Header().Get(ExpiresInHeader))
+		}
+
+		clock.Set(now.Add(2 * time.Minute))
+		recorder = serve(middleware.Authenticate(http.HandlerFunc(okHandler)), "GET", "/posts", "soon")
+		if recorder.Header().Get(ExpiresInHeader) != "0" {
+			t.Fatalf("the time left should not be negative: %q", recorder.Header().Get(ExpiresInHeader))
+		}
+	})
+
+	t.Run("authorize", func(t *testing.T) {
+		recorder := serve(middleware.Authorize(http.HandlerFunc(okHandler)), "GET", "/posts", "soon")
+		if recorder.Header().Get(ExpiresInHeader) == "" {
+			t.Fatal("expiration should be warned by the authorization")
+		}
+	})
+
+	t.Run("parsed once", func(t *testing.T) {
+		var parses int
+		counting := New(countingParser{expiring, &parses})
+		counting.SetClock(clock)
+		counting.SetExpiryWarning(5*time.Minute, "")
+		recorder := serve(counting.Authenticate(http.HandlerFunc(okHandler)), "GET", "/posts", "soon")
+		if recorder.Header().Get(ExpiresInHeader) == "" || parses != 1 {
+			t.Fatalf("expiration should be warned with the token parsed by the authentication: %d parses", parses)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		middleware.SetExpiryWarning(0, "")
+		recorder := serve(middleware.Authenticate(http.HandlerFunc(okHandler)), "GET", "/posts", "soon")
+		if recorder.Header().Get(ExpiresInHeader) != "" {
+			t.Fatal("expiration should not be warned because warnings are disabled")
+		}
+	})
+}
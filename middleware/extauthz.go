@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Headers carrying the original request of an authorization subrequest, e.g. set by NGINX auth_request or Traefik forwardAuth
+const (
+	OriginalMethodHeader  = "X-Original-Method"
+	OriginalURIHeader     = "X-Original-URI"
+	ForwardedMethodHeader = "X-Forwarded-Method"
+	ForwardedURIHeader    = "X-Forwarded-Uri"
+)
+
+// Headers carrying the authorized user in the responses of the external authorization, to be forwarded upstream by the proxy
+const (
+	UserIDHeader    = "X-Auth-User-Id"
+	UsernameHeader  = "X-Auth-Username"
+	UserRolesHeader = "X-Auth-Roles"
+)
+
+// Proxy is the proxy sending the authorization subrequests, which determines where the original request is read from.
+// Only the headers of the configured proxy are read, since the headers of the other proxies may come from the client
+type Proxy int
+
+const (
+	// Envoy sends the original method and path as the subrequest itself, after the path prefix of the ext_authz filter
+	Envoy Proxy = iota
+	// NGINX sends the original request in OriginalMethodHeader and OriginalURIHeader, which auth_request locations
+	// must set with proxy_set_header so the headers of the client are overwritten
+	NGINX
+	// Traefik sends the original request in ForwardedMethodHeader and ForwardedURIHeader. forwardAuth must not trust
+	// the forwarded headers of the client, i.e. trustForwardHeader is false
+	Traefik
+)
+
+// ErrInvalidOriginalRequest is thrown when the original request of an authorization subrequest is missing or ambiguous,
+// e.g. a path with dot segments or encoded slashes which the upstream may resolve to another resource
+var ErrInvalidOriginalRequest = errors.New("invalid original request")
+
+// ExternalAuth is the external authorization endpoint of proxies, i.e. the HTTP service of the Envoy ext_authz filter,
+// NGINX auth_request and Traefik forwardAuth. The original request is resolved according to the proxy, then authenticated
+// and authorized by the middleware. Authorized requests get 200 along with UserIDHeader, UsernameHeader and UserRolesHeader,
+// others get the response of the responder, e.g. 401 or 403, and invalid original requests get 400.
+// Proxies must drop these headers from the client requests they forward
+type ExternalAuth struct {
+	middleware Middleware
+	proxy      Proxy
+	pathPrefix string
+}
+
+// SetProxy is the setter for the proxy sending the subrequests, Envoy by default
+func (auth *ExternalAuth) SetProxy(proxy Proxy) {
+	auth.proxy = proxy
+}
+
+// SetPathPrefix is the setter for the path prefix of the endpoint, e.g. the path_prefix of Envoy prepended to the original path.
+// There is no prefix by default
+func (auth *ExternalAuth) SetPathPrefix(prefix string) {
+	auth.pathPrefix = strings.TrimSuffix(prefix, "/")
+}
+
+// Handler returns the handler of the external authorization
+func (auth ExternalAuth) Handler() http.Handler {
+	authorized := auth.middleware.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		w.Header().Set(UserIDHeader, user.GetID())
+		w.Header().Set(UsernameHeader, user.GetUsername())
+		w.Header().Set(UserRolesHeader, strings.Join(user.GetRoles(), ","))
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		original, err := auth.original(r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		authorized.ServeHTTP(w, original)
+	})
+}
+
+// original returns a copy of the request with the method and the URL of the original request
+func (auth ExternalAuth) original(r *http.Request) (*http.Request, error) {
+	var method, uri string
+	switch auth.proxy {
+	case NGINX:
+		method, uri = r.Header.Get(OriginalMethodHeader), r.Header.Get(OriginalURIHeader)
+	case Traefik:
+		method, uri = r.Header.Get(ForwardedMethodHeader), r.Header.Get(ForwardedURIHeader)
+	default:
+		method, uri = r.Method, r.URL.RequestURI()
+		if rest := strings.TrimPrefix(uri, auth.pathPrefix); rest == "" || rest[0] == '/' || rest[0] == '?' {
+			uri = "/" + strings.TrimPrefix(rest, "/")
+		}
+	}
+
+	if method == "" || uri == "" {
+		return nil, ErrInvalidOriginalRequest
+	}
+
+	target, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return nil, errors.WithMessage(ErrInvalidOriginalRequest, err.Error())
+	}
+
+	cleaned, err := cleanPath(target)
+	if err != nil {
+		return nil, err
+	}
+
+	original := new(http.Request)
+	*original = *r
+	original.Method = strings.ToUpper(method)
+	original.URL = &url.URL{Path: cleaned, RawQuery: target.RawQuery}
+	original.RequestURI = original.URL.RequestURI()
+	return original.WithContext(r.Context()), nil
+}
+
+// cleanPath returns the cleaned decoded path of the URL, keeping the trailing slash of collections.
+// Dot segments and encoded slashes are refused rather than resolved, since the upstream may resolve them differently
+func cleanPath(target *url.URL) (string, error) {
+	escaped := strings.ToLower(target.EscapedPath())
+	if strings.Contains(escaped, "%2f") || strings.Contains(escaped, "%5c") {
+		return "", errors.WithMessage(ErrInvalidOriginalRequest, "encoded slash")
+	}
+
+	for _, segment := range strings.Split(target.Path, "/") {
+		if segment == "." || segment == ".." {
+			return "", errors.WithMessage(ErrInvalidOriginalRequest, "dot segment")
+		}
+	}
+
+	cleaned := path.Clean("/" + target.Path)
+	if strings.HasSuffix(target.Path, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
+
+// NewExternalAuth is the constructor for ExternalAuth
+func NewExternalAuth(middleware Middleware) ExternalAuth {
+	return ExternalAuth{middleware: middleware}
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExternalAuth(t *testing.T) {
+	t.Run("nginx", func(t *testing.T) {
+		external := NewExternalAuth(New(auth))
+		external.SetProxy(NGINX)
+		handler := external.Handler()
+
+		r := httptest.NewRequest("GET", "/auth", nil)
+		r.Header.Set("Authorization", "Bearer token")
+		r.Header.Set(OriginalMethodHeader, "GET")
+		r.Header.Set(OriginalURIHeader, "/posts?page=2")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+
+		if recorder.Code != http.StatusOK || recorder.Header().Get(UserIDHeader) != "id" {
+			t.Fatalf("original request should be authorized: %d %v", recorder.Code, recorder.Header())
+		}
+
+		r.Header.Set(OriginalMethodHeader, "DELETE")
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code != http.StatusForbidden || recorder.Header().Get(UserIDHeader) != "" {
+			t.Fatalf("status should be 403 because of the original method: %d", recorder.Code)
+		}
+
+		r.Header.Del(OriginalMethodHeader)
+		r.Header.Del(OriginalURIHeader)
+		r.Header.Set(ForwardedMethodHeader, "GET")
+		r.Header.Set(ForwardedURIHeader, "/posts")
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("status should be 400 because the headers of other proxies are ignored: %d", recorder.Code)
+		}
+	})
+
+	t.Run("traefik", func(t *testing.T) {
+		external := NewExternalAuth(New(auth))
+		external.SetProxy(Traefik)
+		handler := external.Handler()
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(ForwardedMethodHeader, "GET")
+		r.Header.Set(ForwardedURIHeader, "/posts")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+
+		if recorder.Code != http.StatusUnauthorized || recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("status should be 401 because of the missing token: %d", recorder.Code)
+		}
+
+		r.Header.Set("Authorization", "Bearer token")
+		r.Header.Set(ForwardedMethodHeader, "DELETE")
+		r.Header.Set(OriginalMethodHeader, "GET")
+		r.Header.Set(OriginalURIHeader, "/posts")
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code != http.StatusForbidden {
+			t.Fatalf("status should be 403 because the spoofed original headers are ignored: %d", recorder.Code)
+		}
+	})
+
+	t.Run("envoy", func(t *testing.T) {
+		external := NewExternalAuth(New(auth))
+		external.SetPathPrefix("/authz/")
+		handler := external.Handler()
+
+		if code := serve(handler, "GET", "/authz/posts", "token").Code; code != http.StatusOK {
+			t.Fatalf("status should be 200 because of the original path after the prefix: %d", code)
+		}
+
+		if code := serve(handler, "GET", "/authzposts", "token").Code; code != http.StatusForbidden {
+			t.Fatalf("status should be 403 because the prefix is not a path segment: %d", code)
+		}
+
+		if code := serve(handler, "POST", "/authz/posts", "token").Code; code != http.StatusForbidden {
+			t.Fatalf("status should be 403 because of the original method: %d", code)
+		}
+
+		r := httptest.NewRequest("GET", "/authz/posts", nil)
+		r.Header.Set("Authorization", "Bearer token")
+		r.Header.Set(OriginalMethodHeader, "DELETE")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status should be 200 because the original headers are ignored: %d", recorder.Code)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		external := NewExternalAuth(New(auth))
+		external.SetProxy(NGINX)
+		handler := external.Handler()
+
+		for _, uri := range []string{"", "posts", "/public/../admin", "/posts/./1", "/public/%2e%2e/admin", "/public%2F..%2Fadmin", "/posts%2f1"} {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", "Bearer token")
+			r.Header.Set(OriginalMethodHeader, "GET")
+			r.Header.Set(OriginalURIHeader, uri)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status should be 400 because of the ambiguous original URI %q: %d", uri, recorder.Code)
+			}
+		}
+	})
+
+	t.Run("clean", func(t *testing.T) {
+		external := NewExternalAuth(New(auth))
+		external.SetProxy(NGINX)
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(OriginalMethodHeader, "get")
+		r.Header.Set(OriginalURIHeader, "//posts//%31/?page=2")
+		original, err := external.original(r)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if original.Method != "GET" || original.URL.Path != "/posts/1/" || original.URL.RawQuery != "page=2" {
+			t.Fatalf("original request should be cleaned: %s %s", original.Method, original.URL)
+		}
+	})
+}
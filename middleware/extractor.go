@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/pem"
+	"net/http"
+	"strings"
+)
+
+// TokenExtractor extracts a token string from a request.
+// It throws ErrMissingToken when the request carries no token
+type TokenExtractor interface {
+	ExtractToken(*http.Request) (string, error)
+}
+
+// TokenExtractorFunc is the adapter to use ordinary functions as token extractors
+type TokenExtractorFunc func(*http.Request) (string, error)
+
+// ExtractToken calls f(r)
+func (f TokenExtractorFunc) ExtractToken(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// BearerExtractor extracts the token from the "Authorization: Bearer <token>" header
+func BearerExtractor() TokenExtractor {
+	return AuthorizationExtractor("Bearer")
+}
+
+// AuthorizationExtractor extracts the token from the "Authorization: <scheme> <token>" header, e.g. "Negotiate" for SPNEGO
+func AuthorizationExtractor(scheme string) TokenExtractor {
+	return TokenExtractorFunc(func(r *http.Request) (token string, err error) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			err = ErrMissingToken
+			return
+		}
+
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], scheme) || strings.TrimSpace(parts[1]) == "" {
+			err = ErrMalformedToken
+			return
+		}
+
+		token = strings.TrimSpace(parts[1])
+		return
+	})
+}
+
+// HeaderExtractor extracts the token from the raw value of a header, e.g. "X-Auth-Token"
+func HeaderExtractor(name string) TokenExtractor {
+	return TokenExtractorFunc(func(r *http.Request) (token string, err error) {
+		token = strings.TrimSpace(r.Header.Get(name))
+		if token == "" {
+			err = ErrMissingToken
+		}
+		return
+	})
+}
+
+// CookieExtractor extracts the token from a cookie
+func CookieExtractor(name string) TokenExtractor {
+	return TokenExtractorFunc(func(r *http.Request) (token string, err error) {
+		cookie, err := r.Cookie(name)
+		if err != nil || cookie.Value == "" {
+			err = ErrMissingToken
+			return
+		}
+
+		token = cookie.Value
+		return
+	})
+}
+
+// QueryExtractor extracts the token from a query parameter, e.g. for WebSocket upgrades where browsers cannot set headers
+func QueryExtractor(name string) TokenExtractor {
+	return TokenExtractorFunc(func(r *http.Request) (token string, err error) {
+		token = r.URL.Query().Get(name)
+		if token == "" {
+			err = ErrMissingToken
+		}
+		return
+	})
+}
+
+// ClientCertificateExtractor extracts the client certificate chain of the TLS connection of a request as concatenated PEM blocks,
+// leaf first, e.g. for the mtls driver. The chain is not verified by the extractor
+func ClientCertificateExtractor() TokenExtractor {
+	return TokenExtractorFunc(func(r *http.Request) (token string, err error) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			err = ErrMissingToken
+			return
+		}
+
+		var buffer bytes.Buffer
+		for _, certificate := range r.TLS.PeerCertificates {
+			err = pem.Encode(&buffer, &pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+			if err != nil {
+				return
+			}
+		}
+
+		token = buffer.String()
+		return
+	})
+}
+
+// ChainExtractors tries the extractors in order and returns the first token found.
+// Errors other than ErrMissingToken stop the chain
+func ChainExtractors(extractors ...TokenExtractor) TokenExtractor {
+	return extractorChain(extractors)
+}
+
+type extractorChain []TokenExtractor
+
+func (chain extractorChain) ExtractToken(r *http.Request) (token string, err error) {
+	for _, extractor := range chain {
+		token, err = extractor.ExtractToken(r)
+		if err != ErrMissingToken {
+			return
+		}
+	}
+
+	err = ErrMissingToken
+	return
+}
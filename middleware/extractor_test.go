@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtractors(t *testing.T) {
+	t.Run("bearer", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		_, err := BearerExtractor().ExtractToken(r)
+		if err != ErrMissingToken {
+			t.Fatalf("err should be ErrMissingToken: %v", err)
+		}
+
+		r.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+		_, err = BearerExtractor().ExtractToken(r)
+		if err != ErrMalformedToken {
+			t.Fatalf("err should be ErrMalformedToken: %v", err)
+		}
+
+		r.Header.Set("Authorization", "bearer token")
+		token, err := BearerExtractor().ExtractToken(r)
+		if err != nil || token != "token" {
+			t.Fatalf("token should be extracted: %s - %v", token, err)
+		}
+	})
+
+	t.Run("cookie", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: "session", Value: "token"})
+		token, err := CookieExtractor("session").ExtractToken(r)
+		if err != nil || token != "token" {
+			t.Fatalf("token should be extracted: %s - %v", token, err)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/ws?access_token=token", nil)
+		token, err := QueryExtractor("access_token").ExtractToken(r)
+		if err != nil || token != "token" {
+			t.Fatalf("token should be extracted: %s - %v", token, err)
+		}
+	})
+
+	t.Run("client certificate", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		_, err := ClientCertificateExtractor().ExtractToken(r)
+		if err != ErrMissingToken {
+			t.Fatalf("err should be ErrMissingToken because of the plain connection: %v", err)
+		}
+
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Raw: []byte("leaf")}, {Raw: []byte("intermediate")}}}
+		token, err := ClientCertificateExtractor().ExtractToken(r)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		block, rest := pem.Decode([]byte(token))
+		if block == nil || string(block.Bytes) != "leaf" {
+			t.Fatalf("leaf should be extracted first: %s", token)
+		}
+
+		block, _ = pem.Decode(rest)
+		if block == nil || string(block.Bytes) != "intermediate" {
+			t.Fatalf("intermediate should be extracted: %s", token)
+		}
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		chain := ChainExtractors(BearerExtractor(), HeaderExtractor("X-Auth-Token"), QueryExtractor("access_token"))
+
+		r := httptest.NewRequest("GET", "/ws?access_token=query", nil)
+		token, err := chain.ExtractToken(r)
+		if err != nil || token != "query" {
+			t.Fatalf("the query token should be extracted: %s - %v", token, err)
+		}
+
+		r.Header.Set("X-Auth-Token", "header")
+		token, err = chain.ExtractToken(r)
+		if err != nil || token != "header" {
+			t.Fatalf("the header token should take precedence: %s - %v", token, err)
+		}
+
+		r.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+		_, err = chain.ExtractToken(r)
+		if err != ErrMalformedToken {
+			t.Fatalf("err should be ErrMalformedToken because of the malformed header: %v", err)
+		}
+
+		_, err = chain.ExtractToken(httptest.NewRequest("GET", "/", nil))
+		if err != ErrMissingToken {
+			t.Fatalf("err should be ErrMissingToken: %v", err)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+// requestMemo holds the authentication result of a request
+type requestMemo struct {
+	done  bool
+	authz *gate.AuthzContext
+	err   error
+}
+
+type authenticationEntry struct {
+	user      gate.User
+	token     gate.JWT
+	expiredAt time.Time
+}
+
+// authenticationCache is the LRU cache of successful authentications by token string
+type authenticationCache struct {
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+	*sync.Mutex
+}
+
+// get returns the cached user of a token along with the parsed token, e.g. carrying its issuance time for the risk evaluator
+func (cache *authenticationCache) get(value string, now time.Time) (user gate.User, token gate.JWT, ok bool) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	element, ok := cache.entries[value]
+	if !ok {
+		return
+	}
+
+	entry := element.Value.(authenticationEntry)
+	if !now.Before(entry.expiredAt) {
+		cache.order.Remove(element)
+		delete(cache.entries, value)
+		ok = false
+		return
+	}
+
+	cache.order.MoveToFront(element)
+	user, token = entry.user, entry.token
+	return
+}
+
+// set caches the authentication of a token until the TTL elapses, never after the expiration of the token unless it is unknown
+func (cache *authenticationCache) set(user gate.User, token gate.JWT, now time.Time) {
+	expiredAt := now.Add(cache.ttl)
+	if !token.ExpiredAt.IsZero() && token.ExpiredAt.Before(expiredAt) {
+		expiredAt = token.ExpiredAt
+	}
+
+	if !now.Before(expiredAt) {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	entry := authenticationEntry{user, token, expiredAt}
+	if element, ok := cache.entries[token.Value]; ok {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+		return
+	}
+
+	cache.entries[token.Value] = cache.order.PushFront(entry)
+	for cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(authenticationEntry).token.Value)
+	}
+}
+
+// SetAuthenticationCache is the setter for the cache of successful authentications by token string, which saves signature verifications
+// of tokens presented again within the TTL. Entries never outlive the expiration of their token, which is resolved with the authenticator
+// if it is a TokenParser. Revoked tokens may be accepted until their entry expires, hence it must not be enabled along with single-use tokens.
+// The cache is disabled by default
+func (middleware *Middleware) SetAuthenticationCache(size int, ttl time.Duration) {
+	if size <= 0 || ttl <= 0 {
+		middleware.authentications = nil
+		return
+	}
+
+	middleware.authentications = &authenticationCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		Mutex:   &sync.Mutex{},
+	}
+}
+
+// Memoize is the middleware which memoizes the authentication of requests, so AuthenticateRequest authenticates a request once
+// however many times it is called, e.g. by the middleware, the handler and template functions.
+// Authenticate and Authorize memoize the authentication already
+func (middleware Middleware) Memoize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, withMemo(r))
+	})
+}
+
+func withMemo(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(memoContextKey).(*requestMemo); ok {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), memoContextKey, &requestMemo{}))
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+type countingAuth struct {
+	myAuth
+	calls *int
+}
+
+func (auth countingAuth) Authenticate(token string) (gate.User, error) {
+	*auth.calls++
+	return auth.myAuth.Authenticate(token)
+}
+
+func TestMemoization(t *testing.T) {
+	calls := 0
+	middleware := New(countingAuth{auth, &calls})
+
+	t.Run("request", func(t *testing.T) {
+		handler := middleware.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 3; i++ {
+				if _, err := middleware.AuthenticateRequest(r); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		if code := serve(handler, "GET", "/posts", "token").Code; code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the valid token: %d", code)
+		}
+
+		if calls != 1 {
+			t.Fatalf("request should be authenticated once: %d", calls)
+		}
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		calls = 0
+		cached := middleware
+		cached.SetAuthenticationCache(1, time.Minute)
+		handler := cached.Authenticate(http.HandlerFunc(okHandler))
+
+		for i := 0; i < 3; i++ {
+			serve(handler, "GET", "/posts", "token")
+		}
+
+		if calls != 1 {
+			t.Fatalf("token should be authenticated once within the TTL: %d", calls)
+		}
+
+		if code := serve(handler, "GET", "/posts", "invalid").Code; code != http.StatusUnauthorized || calls != 2 {
+			t.Fatalf("failures should not be cached: %d %d", code, calls)
+		}
+
+		cached.SetClock(gate.ClockFunc(func() time.Time {
+			return time.Now().Add(time.Minute)
+		}))
+		handler = cached.Authenticate(http.HandlerFunc(okHandler))
+
+		serve(handler, "GET", "/posts", "token")
+		if calls != 3 {
+			t.Fatalf("token should be authenticated again after the TTL: %d", calls)
+		}
+	})
+
+	t.Run("parsed", func(t *testing.T) {
+		cached := middleware
+		cached.SetAuthenticationCache(1, time.Minute)
+		handler := cached.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authz, ok := AuthzContextFromContext(r.Context())
+			if !ok || authz.Token.ID != "token" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		for i := 0; i < 2; i++ {
+			if code := serve(handler, "GET", "/posts", "token").Code; code != http.StatusNoContent {
+				t.Fatalf("the parsed token should be kept in the authorization context of cached authentications: %d", code)
+			}
+		}
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		calls = 0
+		now := time.Now()
+		expiring := countingAuth{myAuth{
+			tokens:      auth.tokens,
+			grants:      auth.grants,
+			expirations: map[string]time.Time{"token": now.Add(time.Second)},
+		}, &calls}
+
+		cached := New(expiring)
+		cached.SetAuthenticationCache(1, time.Hour)
+		cached.SetClock(gate.ClockFunc(func() time.Time {
+			return now
+		}))
+		serve(cached.Authenticate(http.HandlerFunc(okHandler)), "GET", "/posts", "token")
+
+		cached.SetClock(gate.ClockFunc(func() time.Time {
+			return now.Add(time.Second)
+		}))
+		serve(cached.Authenticate(http.HandlerFunc(okHandler)), "GET", "/posts", "token")
+		if calls != 2 {
+			t.Fatalf("token should be authenticated again once expired within the TTL: %d", calls)
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		cached := middleware
+		cached.SetAuthenticationCache(2, time.Minute)
+		cache := cached.authentications
+		now := time.Now()
+		cache.set(user{id: "a"}, gate.JWT{Value: "a"}, now)
+		cache.set(user{id: "b"}, gate.JWT{Value: "b"}, now)
+		cache.get("a", now)
+		cache.set(user{id: "c"}, gate.JWT{Value: "c"}, now)
+
+		if _, _, ok := cache.get("b", now); ok {
+			t.Fatal("least recently used token should be evicted")
+		}
+
+		if _, _, ok := cache.get("a", now); !ok {
+			t.Fatal("recently used token should be kept")
+		}
+	})
+}
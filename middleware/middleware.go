@@ -0,0 +1,335 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	memoContextKey
+	authzContextKey
+)
+
+// Authenticator is the part of gate.Auth the middleware relies on
+type Authenticator interface {
+	Authenticate(string) (gate.User, error)
+	Authorize(gate.User, string, string) error
+}
+
+// ContextAuthenticator is the optional contract for authenticators creating the authorization context of a request, e.g. with the parsed token
+type ContextAuthenticator interface {
+	NewAuthzContext(token, tenant string) (*gate.AuthzContext, error)
+}
+
+// ContextAuthorizer is the optional contract for authenticators authorizing with the authorization context of a request,
+// so the abilities are resolved once per request
+type ContextAuthorizer interface {
+	AuthorizeContext(ctx *gate.AuthzContext, action, object string) error
+}
+
+// TenantFunc resolves the tenant of a request, e.g. from a header or the host
+type TenantFunc func(*http.Request) string
+
+// AttributesFunc resolves the attributes of a request for template abilities, e.g. the projects the user is a member of.
+// Attributes must come from trusted data, i.e. the user records or the server state, never from the request input like the URL,
+// the headers or the body: a template ability only grants what the attributes say, so attributes taken from the request
+// grant whatever the client asks for
+type AttributesFunc func(*http.Request) gate.Attributes
+
+// ResourceFunc resolves the action and the object of a request for the authorization
+type ResourceFunc func(*http.Request) (action, object string)
+
+// MethodPathResource uses the request method as the action and the URL path as the object
+func MethodPathResource(r *http.Request) (action, object string) {
+	return r.Method, r.URL.Path
+}
+
+// ActionResource uses the action mapped from the request method as the action and the URL path as the object.
+// Unmapped methods are passed through as they are, so they are only granted by abilities naming them
+func ActionResource(mapping gate.ActionMapping) ResourceFunc {
+	return func(r *http.Request) (action, object string) {
+		action, ok := mapping.Action(r.Method, r.URL.Path)
+		if !ok {
+			action = r.Method
+		}
+
+		return action, r.URL.Path
+	}
+}
+
+// Middleware authenticates and authorizes HTTP requests with gate
+type Middleware struct {
+	auth               Authenticator
+	extractor          TokenExtractor
+	webSocketExtractor TokenExtractor
+	responder          Responder
+	resource           ResourceFunc
+	networkPolicy      *NetworkPolicy
+	authentications    *authenticationCache
+	expiryWarning      *expiryWarning
+	cacheHints         *cacheHints
+	tenant             TenantFunc
+	attributes         AttributesFunc
+	clock              gate.Clock
+}
+
+// SetClock is the setter for the clock of the authentication cache and the expiry warnings, gate.SystemClock by default
+func (middleware *Middleware) SetClock(clock gate.Clock) {
+	middleware.clock = clock
+}
+
+func (middleware Middleware) now() time.Time {
+	if middleware.clock == nil {
+		return gate.SystemClock.Now()
+	}
+
+	return middleware.clock.Now()
+}
+
+// SetExtractor is the setter for the token extractor, BearerExtractor by default
+func (middleware *Middleware) SetExtractor(extractor TokenExtractor) {
+	middleware.extractor = extractor
+}
+
+// SetResponder is the setter for the error responder
+func (middleware *Middleware) SetResponder(responder Responder) {
+	middleware.responder = responder
+}
+
+// SetResourceFunc is the setter for the resource resolver, MethodPathResource by default
+func (middleware *Middleware) SetResourceFunc(resource ResourceFunc) {
+	middleware.resource = resource
+}
+
+// SetNetworkPolicy is the setter for the network policy enforced before the authentication. There is no network policy by default
+func (middleware *Middleware) SetNetworkPolicy(policy NetworkPolicy) {
+	middleware.networkPolicy = &policy
+}
+
+// SetTenantFunc is the setter for the tenant resolver of the authorization contexts. There is no tenant by default
+func (middleware *Middleware) SetTenantFunc(tenant TenantFunc) {
+	middleware.tenant = tenant
+}
+
+// SetAttributesFunc is the setter for the attributes resolver of the authorization contexts.
+// The resolver must not derive the attributes from the request input, see AttributesFunc.
+// Attributes only reach authenticators which are ContextAuthorizer. There are no attributes by default
+func (middleware *Middleware) SetAttributesFunc(attributes AttributesFunc) {
+	middleware.attributes = attributes
+}
+
+// Responder returns the error responder
+func (middleware Middleware) Responder() Responder {
+	return middleware.responder
+}
+
+// AuthenticateRequest enforces the network policy, extracts the token of a request and authenticates it.
+// The result is memoized for requests passed through Memoize, Authenticate or Authorize
+func (middleware Middleware) AuthenticateRequest(r *http.Request) (user gate.User, err error) {
+	authz, err := middleware.AuthenticateRequestContext(r)
+	if err != nil {
+		return
+	}
+
+	user = authz.User
+	return
+}
+
+// AuthenticateRequestContext authenticates a request like AuthenticateRequest and returns its authorization context.
+// The context is created by the authenticator if it is a ContextAuthenticator, otherwise it carries the token parsed by the authenticator
+// if it is a TokenParser, or the token string only
+func (middleware Middleware) AuthenticateRequestContext(r *http.Request) (authz *gate.AuthzContext, err error) {
+	memo, ok := r.Context().Value(memoContextKey).(*requestMemo)
+	if ok && memo.done {
+		return memo.authz, memo.err
+	}
+
+	authz, err = middleware.authenticateRequest(r)
+	if ok {
+		*memo = requestMemo{true, authz, err}
+	}
+	return
+}
+
+func (middleware Middleware) authenticateRequest(r *http.Request) (authz *gate.AuthzContext, err error) {
+	if middleware.networkPolicy != nil {
+		err = middleware.networkPolicy.Check(r)
+		if err != nil {
+			return
+		}
+	}
+
+	token, err := middleware.extractor.ExtractToken(r)
+	if err != nil {
+		return
+	}
+
+	var tenant string
+	if middleware.tenant != nil {
+		tenant = middleware.tenant(r)
+	}
+
+	if middleware.authentications != nil {
+		if user, parsed, ok := middleware.authentications.get(token, middleware.now()); ok {
+			authz = gate.NewAuthzContext(user, parsed, tenant)
+			authz.IP = middleware.clientIP(r)
+			return
+		}
+	}
+
+	if authenticator, ok := middleware.auth.(ContextAuthenticator); ok {
+		authz, err = authenticator.NewAuthzContext(token, tenant)
+	} else {
+		var user gate.User
+		user, err = middleware.auth.Authenticate(token)
+		if err == nil {
+			authz = gate.NewAuthzContext(user, middleware.parse(token), tenant)
+		}
+	}
+
+	if err != nil {
+		return
+	}
+
+	authz.IP = middleware.clientIP(r)
+	if middleware.authentications != nil {
+		middleware.authentications.set(authz.User, authz.Token, middleware.now())
+	}
+	return
+}
+
+// parse returns an authenticated token parsed with the authenticator if it is a TokenParser, e.g. for its expiration and issuance time,
+// or the token string only otherwise
+func (middleware Middleware) parse(token string) gate.JWT {
+	parser, ok := middleware.auth.(TokenParser)
+	if !ok {
+		return gate.JWT{Value: token}
+	}
+
+	parsed, err := parser.ParseJWT(token)
+	if err != nil {
+		return gate.JWT{Value: token}
+	}
+
+	return parsed
+}
+
+// clientIP resolves the client IP of a request with the trusted proxies of the network policy, if any
+func (middleware Middleware) clientIP(r *http.Request) string {
+	var policy NetworkPolicy
+	if middleware.networkPolicy != nil {
+		policy = *middleware.networkPolicy
+	}
+
+	if ip := policy.ClientIP(r); ip != nil {
+		return ip.String()
+	}
+
+	return ""
+}
+
+// Authenticate is the middleware which authenticates requests and stores the user in the request context
+func (middleware Middleware) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withMemo(r)
+		authz, err := middleware.AuthenticateRequestContext(r)
+		if err != nil {
+			middleware.noStore(w)
+			middleware.responder.Respond(w, r, err)
+			return
+		}
+
+		middleware.warnExpiry(w, authz)
+		next.ServeHTTP(w, r.WithContext(NewAuthzContext(r.Context(), authz)))
+	})
+}
+
+// Authorize is the middleware which authorizes the user of a request to take the action on the object of the request.
+// Requests are authenticated first unless a user is already stored in the request context
+func (middleware Middleware) Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withMemo(r)
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			authz, err := middleware.AuthenticateRequestContext(r)
+			if err != nil {
+				middleware.noStore(w)
+				middleware.responder.Respond(w, r, err)
+				return
+			}
+
+			middleware.warnExpiry(w, authz)
+			r = r.WithContext(NewAuthzContext(r.Context(), authz))
+			user = authz.User
+		}
+
+		action, object := middleware.resource(r)
+		err := middleware.authorize(r, user, action, object)
+		if err != nil {
+			middleware.noStore(w)
+			middleware.responder.Respond(w, r, err)
+			return
+		}
+
+		middleware.hintCache(w, r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorize authorizes with the authorization context of the request if the authenticator is a ContextAuthorizer
+func (middleware Middleware) authorize(r *http.Request, user gate.User, action, object string) error {
+	if authorizer, ok := middleware.auth.(ContextAuthorizer); ok {
+		if authz, ok := AuthzContextFromContext(r.Context()); ok {
+			if middleware.attributes != nil {
+				authz.Attributes = middleware.attributes(r)
+			}
+
+			return authorizer.AuthorizeContext(authz, action, object)
+		}
+	}
+
+	return middleware.auth.Authorize(user, action, object)
+}
+
+// NewContext returns a copy of the context carrying the user. The authorization context of another user is dropped
+func NewContext(ctx context.Context, user gate.User) context.Context {
+	if _, ok := AuthzContextFromContext(ctx); ok {
+		ctx = context.WithValue(ctx, authzContextKey, (*gate.AuthzContext)(nil))
+	}
+
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// NewAuthzContext returns a copy of the context carrying the authorization context and its user
+func NewAuthzContext(ctx context.Context, authz *gate.AuthzContext) context.Context {
+	return context.WithValue(NewContext(ctx, authz.User), authzContextKey, authz)
+}
+
+// AuthzContextFromContext returns the authorization context stored in the context
+func AuthzContextFromContext(ctx context.Context) (authz *gate.AuthzContext, ok bool) {
+	authz, ok = ctx.Value(authzContextKey).(*gate.AuthzContext)
+	ok = ok && authz != nil
+	return
+}
+
+// UserFromContext returns the user stored in the context
+func UserFromContext(ctx context.Context) (user gate.User, ok bool) {
+	user, ok = ctx.Value(userContextKey).(gate.User)
+	return
+}
+
+// New is the constructor for Middleware
+func New(auth Authenticator) Middleware {
+	return Middleware{
+		auth:      auth,
+		extractor: BearerExtractor(),
+		responder: NewResponder(""),
+		resource:  MethodPathResource,
+	}
+}
@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hiendv/gate"
+)
+
+var auth = myAuth{
+	tokens: map[string]gate.User{"token": user{id: "id"}},
+	grants: []grant{{"id", "GET", "/posts"}},
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := UserFromContext(r.Context()); !ok {
+		http.Error(w, "missing user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func serve(handler http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	middleware := New(auth)
+
+	t.Run("authenticate", func(t *testing.T) {
+		handler := middleware.Authenticate(http.HandlerFunc(okHandler))
+
+		if code := serve(handler, "GET", "/posts", "token").Code; code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the valid token: %d", code)
+		}
+
+		if code := serve(handler, "GET", "/posts", "").Code; code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401 because of the missing token: %d", code)
+		}
+
+		if code := serve(handler, "GET", "/posts", "invalid").Code; code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401 because of the invalid token: %d", code)
+		}
+	})
+
+	t.Run("authorize", func(t *testing.T) {
+		handler := middleware.Authorize(http.HandlerFunc(okHandler))
+
+		if code := serve(handler, "GET", "/posts", "token").Code; code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the valid abilities: %d", code)
+		}
+
+		if code := serve(handler, "DELETE", "/posts", "token").Code; code != http.StatusForbidden {
+			t.Fatalf("status should be 403 because of the invalid abilities: %d", code)
+		}
+
+		chained := middleware.Authenticate(handler)
+		if code := serve(chained, "GET", "/posts", "token").Code; code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the authenticated user: %d", code)
+		}
+	})
+
+	t.Run("extractor", func(t *testing.T) {
+		custom := New(auth)
+		custom.SetExtractor(CookieExtractor("session"))
+		handler := custom.Authenticate(http.HandlerFunc(okHandler))
+
+		r := httptest.NewRequest("GET", "/posts", nil)
+		r.AddCookie(&http.Cookie{Name: "session", Value: "token"})
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+
+		if recorder.Code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the valid cookie: %d", recorder.Code)
+		}
+	})
+}
+
+type contextAuth struct {
+	myAuth
+	contexts   *int
+	authorized *int
+}
+
+func (auth contextAuth) NewAuthzContext(token, tenant string) (*gate.AuthzContext, error) {
+	*auth.contexts++
+	user, err := auth.Authenticate(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return gate.NewAuthzContext(user, gate.JWT{ID: token, Value: token, ExpiredAt: auth.expirations[token]}, tenant), nil
+}
+
+func (auth contextAuth) AuthorizeContext(ctx *gate.AuthzContext, action, object string) error {
+	*auth.authorized++
+	return auth.Authorize(ctx.User, action, object)
+}
+
+func TestAuthzContext(t *testing.T) {
+	contexts, authorized := 0, 0
+	middleware := New(contextAuth{auth, &contexts, &authorized})
+	middleware.SetTenantFunc(func(r *http.Request) string {
+		return r.Header.Get("X-Tenant")
+	})
+
+	var tenant, ip string
+	handler := middleware.Authenticate(middleware.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authz, ok := AuthzContextFromContext(r.Context())
+		if !ok {
+			http.Error(w, "missing context", http.StatusInternalServerError)
+			return
+		}
+
+		tenant, ip = authz.Tenant, authz.IP
+		okHandler(w, r)
+	})))
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	r.Header.Set("X-Tenant", "acme")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("status should be 204 because of the valid token: %d", recorder.Code)
+	}
+
+	if contexts != 1 || authorized != 1 || tenant != "acme" {
+		t.Fatalf("the context should be created once and used by the authorization: %d %d %q", contexts, authorized, tenant)
+	}
+
+	if ip != "192.0.2.1" {
+		t.Fatalf("the context should carry the client IP: %q", ip)
+	}
+
+	ctx := NewAuthzContext(r.Context(), gate.NewAuthzContext(user{id: "id"}, gate.JWT{}, ""))
+	if _, ok := AuthzContextFromContext(NewContext(ctx, user{id: "other"})); ok {
+		t.Fatal("the context of another user should be dropped")
+	}
+}
+
+func TestActionResource(t *testing.T) {
+	verbs := auth
+	verbs.grants = []grant{{"id", gate.ActionRead, "/posts"}, {"id", gate.ActionList, "/posts/"}}
+	middleware := New(verbs)
+	mapping := gate.NewActionMapping()
+	mapping.SetCollectionFunc(gate.TrailingSlashCollection)
+	middleware.SetResourceFunc(ActionResource(mapping))
+	handler := middleware.Authorize(http.HandlerFunc(okHandler))
+
+	for _, target := range []string{"/posts", "/posts/"} {
+		if code := serve(handler, "GET", target, "token").Code; code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the mapped action on %s: %d", target, code)
+		}
+	}
+
+	if code := serve(handler, "DELETE", "/posts", "token").Code; code != http.StatusForbidden {
+		t.Fatalf("status should be 403 because of the missing grant: %d", code)
+	}
+}
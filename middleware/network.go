@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNetworkDenied is thrown when a request comes from a network which is not allowed by the network policy
+var ErrNetworkDenied = errors.New("network is not allowed")
+
+// NetworkPolicy restricts requests to CIDR allow and deny lists, e.g. admin panels restricted to office networks.
+// Deny lists take precedence, an empty allow list allows every network which is not denied
+type NetworkPolicy struct {
+	allow          []*net.IPNet
+	deny           []*net.IPNet
+	trustedProxies []*net.IPNet
+}
+
+// SetTrustedProxies is the setter for the CIDRs of trusted proxies.
+// The X-Forwarded-For header is only honored for requests coming through trusted proxies
+func (policy *NetworkPolicy) SetTrustedProxies(cidrs []string) (err error) {
+	proxies, err := parseCIDRs(cidrs)
+	if err != nil {
+		return
+	}
+
+	policy.trustedProxies = proxies
+	return
+}
+
+// ClientIP resolves the IP address of the client of a request.
+// X-Forwarded-For is walked from the nearest hop and the first address which is not a trusted proxy is the client
+func (policy NetworkPolicy) ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !contains(policy.trustedProxies, ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, header := range r.Header["X-Forwarded-For"] {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			return ip
+		}
+
+		ip = hop
+		if !contains(policy.trustedProxies, hop) {
+			return hop
+		}
+	}
+
+	return ip
+}
+
+// Allows reports whether an IP address is allowed
+func (policy NetworkPolicy) Allows(ip net.IP) bool {
+	if ip == nil || contains(policy.deny, ip) {
+		return false
+	}
+
+	return len(policy.allow) == 0 || contains(policy.allow, ip)
+}
+
+// Check returns ErrNetworkDenied if the client of a request is not allowed
+func (policy NetworkPolicy) Check(r *http.Request) error {
+	if !policy.Allows(policy.ClientIP(r)) {
+		return ErrNetworkDenied
+	}
+
+	return nil
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseCIDRs parses CIDRs, single IP addresses are accepted as host networks
+func parseCIDRs(cidrs []string) (networks []*net.IPNet, err error) {
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, errors.Errorf("invalid IP address: %s", cidr)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, parseErr := net.ParseCIDR(cidr)
+		if parseErr != nil {
+			return nil, errors.Wrapf(parseErr, "invalid CIDR: %s", cidr)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return
+}
+
+// NewNetworkPolicy is the constructor for NetworkPolicy
+func NewNetworkPolicy(allow, deny []string) (policy NetworkPolicy, err error) {
+	policy.allow, err = parseCIDRs(allow)
+	if err != nil {
+		return
+	}
+
+	policy.deny, err = parseCIDRs(deny)
+	return
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newRemoteRequest(remoteAddr string, forwardedFor ...string) *http.Request {
+	r := httptest.NewRequest("GET", "/admin", nil)
+	r.RemoteAddr = remoteAddr
+	for _, header := range forwardedFor {
+		r.Header.Add("X-Forwarded-For", header)
+	}
+
+	return r
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	policy, err := NewNetworkPolicy([]string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.0.0.13"})
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid CIDRs: %s", err)
+	}
+
+	t.Run("allow and deny", func(t *testing.T) {
+		cases := map[string]bool{
+			"10.1.2.3":    true,
+			"10.0.0.13":   false,
+			"192.168.1.1": false,
+			"2001:db8::1": true,
+		}
+
+		for address, allowed := range cases {
+			if policy.Allows(net.ParseIP(address)) != allowed {
+				t.Errorf("%s should be allowed: %v", address, allowed)
+			}
+		}
+
+		if policy.Allows(nil) {
+			t.Error("unknown addresses should be denied")
+		}
+	})
+
+	t.Run("client ip", func(t *testing.T) {
+		if ip := policy.ClientIP(newRemoteRequest("192.168.1.1:1234", "10.1.2.3")); ip.String() != "192.168.1.1" {
+			t.Fatalf("X-Forwarded-For should be ignored without trusted proxies: %s", ip)
+		}
+
+		trusted := policy
+		err := trusted.SetTrustedProxies([]string{"192.168.0.0/16"})
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid CIDRs: %s", err)
+		}
+
+		if ip := trusted.ClientIP(newRemoteRequest("192.168.1.1:1234", "8.8.8.8, 10.1.2.3", "192.168.1.2")); ip.String() != "10.1.2.3" {
+			t.Fatalf("the nearest untrusted hop should be the client: %s", ip)
+		}
+
+		if ip := trusted.ClientIP(newRemoteRequest("172.16.0.1:1234", "10.1.2.3")); ip.String() != "172.16.0.1" {
+			t.Fatalf("X-Forwarded-For should be ignored from untrusted peers: %s", ip)
+		}
+
+		if trusted.Check(newRemoteRequest("192.168.1.1:1234", "10.0.0.13")) != ErrNetworkDenied {
+			t.Fatal("err should be ErrNetworkDenied because of the denied client")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewNetworkPolicy([]string{"10.0.0.0/33"}, nil)
+		if err == nil {
+			t.Fatal("err should not be nil because of the invalid CIDR")
+		}
+
+		_, err = NewNetworkPolicy(nil, []string{"invalid"})
+		if err == nil {
+			t.Fatal("err should not be nil because of the invalid address")
+		}
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		middleware := New(auth)
+		middleware.SetNetworkPolicy(policy)
+		handler := middleware.Authenticate(http.HandlerFunc(okHandler))
+
+		r := newRemoteRequest("10.1.2.3:1234")
+		r.Header.Set("Authorization", "Bearer token")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the allowed network: %d", recorder.Code)
+		}
+
+		r = newRemoteRequest("192.168.1.1:1234")
+		r.Header.Set("Authorization", "Bearer token")
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code != http.StatusForbidden {
+			t.Fatalf("status should be 403 because of the denied network: %d", recorder.Code)
+		}
+	})
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// ErrMissingToken is thrown when a request carries no token
+var ErrMissingToken = errors.New("missing token")
+
+// ErrMalformedToken is thrown when a request carries a token in an unexpected format, e.g. a non-bearer authorization header
+var ErrMalformedToken = errors.New("malformed token")
+
+// RFC 6750 error codes
+const (
+	ErrorCodeInvalidRequest    = "invalid_request"
+	ErrorCodeInvalidToken      = "invalid_token"
+	ErrorCodeInsufficientScope = "insufficient_scope"
+)
+
+// ErrorCodeInsufficientUserAuthentication is the RFC 9470 error code of step-up authentication, answered with 401
+const ErrorCodeInsufficientUserAuthentication = "insufficient_user_authentication"
+
+// Problem is the RFC 7807 problem details body
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// Responder converts gate errors into HTTP responses.
+// Authentication failures are answered with 401 and a RFC 6750 WWW-Authenticate challenge,
+// authorization failures are answered with 403 and a RFC 7807 application/problem+json body and other failures with 500
+type Responder struct {
+	realm       string
+	scheme      string
+	problemType string
+	translator  gate.Translator
+	Describe    func(error) string
+}
+
+// SetTranslator is the setter for the translator of the problem details.
+// Problems are then localized by the Accept-Language header and carry the stable gate error code. Challenges are kept in English
+func (responder *Responder) SetTranslator(translator gate.Translator) {
+	responder.translator = translator
+}
+
+// SetProblemType is the setter for the problem type URI of authorization failures, "about:blank" by default
+func (responder *Responder) SetProblemType(problemType string) {
+	responder.problemType = problemType
+}
+
+// SetScheme is the setter for the authentication scheme of the challenges, "Bearer" by default.
+// Challenges of other schemes carry no parameters, e.g. "Negotiate" for SPNEGO
+func (responder *Responder) SetScheme(scheme string) {
+	responder.scheme = scheme
+}
+
+// Status returns the HTTP status code for an error. Failures which are neither authentication nor authorization failures,
+// e.g. of the storages, are answered with 500
+func (responder Responder) Status(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Cause(err) == gate.ErrQuotaExceeded:
+		return http.StatusTooManyRequests
+	case errors.Cause(err) == gate.ErrRoleServiceUnavailable:
+		return http.StatusServiceUnavailable
+	case gate.IsAuthorizationError(err), errors.Cause(err) == ErrNetworkDenied:
+		return http.StatusForbidden
+	case errors.Cause(err) == ErrMalformedToken:
+		return http.StatusBadRequest
+	case errors.Cause(err) == ErrMissingToken, gate.IsAuthenticationError(err):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ErrorCode returns the RFC 6750 error code for an error. A missing token and failures of the services have no error code
+func (responder Responder) ErrorCode(err error) string {
+	switch {
+	case err == nil, errors.Cause(err) == ErrMissingToken, errors.Cause(err) == ErrNetworkDenied, errors.Cause(err) == gate.ErrQuotaExceeded,
+		errors.Cause(err) == gate.ErrRoleServiceUnavailable:
+		return ""
+	case gate.IsAuthorizationError(err):
+		return ErrorCodeInsufficientScope
+	case errors.Cause(err) == gate.ErrStepUpRequired:
+		return ErrorCodeInsufficientUserAuthentication
+	case errors.Cause(err) == ErrMalformedToken:
+		return ErrorCodeInvalidRequest
+	case gate.IsAuthenticationError(err):
+		return ErrorCodeInvalidToken
+	default:
+		return ""
+	}
+}
+
+// Challenge returns the WWW-Authenticate header value for an error
+func (responder Responder) Challenge(err error) string {
+	if responder.scheme != "" && !strings.EqualFold(responder.scheme, "Bearer") {
+		return responder.scheme
+	}
+
+	params := []string{fmt.Sprintf(`realm="%s"`, quote(responder.realm))}
+
+	code := responder.ErrorCode(err)
+	if code != "" {
+		params = append(params, fmt.Sprintf(`error="%s"`, code), fmt.Sprintf(`error_description="%s"`, quote(responder.describe(err))))
+	}
+
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// Respond writes the HTTP response for an error. Only 401 and 403 responses carry a challenge
+func (responder Responder) Respond(w http.ResponseWriter, r *http.Request, err error) {
+	status := responder.Status(err)
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		w.Header().Set("WWW-Authenticate", responder.Challenge(err))
+	}
+
+	if status != http.StatusForbidden {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	problemType := responder.problemType
+	if problemType == "" {
+		problemType = "about:blank"
+	}
+
+	problem := Problem{
+		Type:     problemType,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   responder.describe(err),
+		Instance: r.URL.Path,
+	}
+
+	if responder.translator != nil {
+		message := gate.Localize(responder.translator, Locale(r), err, nil)
+		problem.Code = message.Code
+		if responder.Describe == nil {
+			problem.Detail = message.Text
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// Locale returns the preferred locale of a request by the Accept-Language header, gate.DefaultLocale if none
+func Locale(r *http.Request) string {
+	locale, weight := gate.DefaultLocale, 0.0
+	for _, tag := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		parts := strings.Split(tag, ";")
+		language := strings.TrimSpace(parts[0])
+		if language == "" || language == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				parsed, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+
+		if q > weight {
+			locale, weight = language, q
+		}
+	}
+
+	return locale
+}
+
+func (responder Responder) describe(err error) string {
+	if responder.Describe != nil {
+		return responder.Describe(err)
+	}
+
+	if errors.Cause(err) == ErrNetworkDenied {
+		return "The request comes from a network which is not allowed"
+	}
+
+	switch responder.ErrorCode(err) {
+	case ErrorCodeInsufficientScope:
+		return "The request requires higher privileges than provided by the access token"
+	case ErrorCodeInvalidRequest:
+		return "The access token is malformed"
+	case ErrorCodeInsufficientUserAuthentication:
+		return "A more recent or stronger authentication is required"
+	default:
+		return "The access token is invalid"
+	}
+}
+
+func quote(str string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(str)
+}
+
+// NewResponder is the constructor for Responder
+func NewResponder(realm string) Responder {
+	return Responder{realm: realm}
+}
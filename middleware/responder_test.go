@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+func TestResponder(t *testing.T) {
+	responder := NewResponder("api")
+	request := httptest.NewRequest("GET", "/posts", nil)
+
+	t.Run("missing token", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		responder.Respond(recorder, request, ErrMissingToken)
+
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401: %d", recorder.Code)
+		}
+
+		if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != `Bearer realm="api"` {
+			t.Fatalf("challenge should not contain an error code: %s", challenge)
+		}
+	})
+
+	t.Run("scheme", func(t *testing.T) {
+		negotiate := responder
+		negotiate.SetScheme("Negotiate")
+		recorder := httptest.NewRecorder()
+		negotiate.Respond(recorder, request, ErrMissingToken)
+
+		if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != "Negotiate" {
+			t.Fatalf("challenge should carry the scheme only: %s", challenge)
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		responder.Respond(recorder, request, gate.NewAuthenticationError(errors.Wrap(errors.New("signature is invalid"), "could not parse the token")))
+
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401: %d", recorder.Code)
+		}
+
+		expected := `Bearer realm="api", error="invalid_token", error_description="The access token is invalid"`
+		if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != expected {
+			t.Fatalf("invalid challenge: %s", challenge)
+		}
+	})
+
+	t.Run("service failure", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		responder.Respond(recorder, request, errors.Wrap(errors.New("connection refused"), "could not get the abilities"))
+
+		if recorder.Code != http.StatusInternalServerError {
+			t.Fatalf("status should be 500 because the failure is neither an authentication nor an authorization failure: %d", recorder.Code)
+		}
+
+		if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != "" {
+			t.Fatalf("challenge should not be set because the failure is not an authentication failure: %s", challenge)
+		}
+	})
+
+	t.Run("malformed token", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		responder.Respond(recorder, request, ErrMalformedToken)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("status should be 400: %d", recorder.Code)
+		}
+	})
+
+	t.Run("quota exceeded", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		responder.Respond(recorder, request, gate.ErrQuotaExceeded)
+
+		if recorder.Code != http.StatusTooManyRequests {
+			t.Fatalf("status should be 429: %d", recorder.Code)
+		}
+
+		if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != "" {
+			t.Fatalf("challenge should not be set: %s", challenge)
+		}
+	})
+
+	t.Run("step-up required", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		responder.Respond(recorder, request, errors.WithMessage(gate.ErrStepUpRequired, "token is too old"))
+
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401: %d", recorder.Code)
+		}
+
+		expected := `Bearer realm="api", error="insufficient_user_authentication", error_description="A more recent or stronger authentication is required"`
+		if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != expected {
+			t.Fatalf("invalid challenge: %s", challenge)
+		}
+	})
+
+	t.Run("role service unavailable", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		responder.Respond(recorder, request, gate.ErrRoleServiceUnavailable)
+
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status should be 503: %d", recorder.Code)
+		}
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		custom := NewResponder("api")
+		custom.SetProblemType("https://example.com/problems/forbidden")
+		custom.Describe = func(err error) string {
+			return `not "allowed"`
+		}
+
+		recorder := httptest.NewRecorder()
+		custom.Respond(recorder, request, gate.ErrForbidden)
+
+		if recorder.Code != http.StatusForbidden {
+			t.Fatalf("status should be 403: %d", recorder.Code)
+		}
+
+		if contentType := recorder.Header().Get("Content-Type"); contentType != "application/problem+json" {
+			t.Fatalf("invalid content type: %s", contentType)
+		}
+
+		expected := `Bearer realm="api", error="insufficient_scope", error_description="not \"allowed\""`
+		if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != expected {
+			t.Fatalf("invalid challenge: %s", challenge)
+		}
+
+		var problem Problem
+		err := json.NewDecoder(recorder.Body).Decode(&problem)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid body: %s", err)
+		}
+
+		if problem.Type != "https://example.com/problems/forbidden" || problem.Status != 403 || problem.Detail != `not "allowed"` || problem.Instance != "/posts" {
+			t.Fatalf("invalid problem: %+v", problem)
+		}
+	})
+
+	t.Run("localized", func(t *testing.T) {
+		catalog := gate.NewCatalog("")
+		catalog.Register("fr", map[string]string{gate.CodeForbidden: "Action interdite"})
+
+		localized := NewResponder("api")
+		localized.SetTranslator(catalog)
+
+		localizedRequest := httptest.NewRequest("GET", "/posts", nil)
+		localizedRequest.Header.Set("Accept-Language", "de;q=0.5, fr-CA, en;q=0.8")
+
+		recorder := httptest.NewRecorder()
+		localized.Respond(recorder, localizedRequest, errors.WithMessage(gate.ErrForbidden, "denied"))
+
+		expected := `Bearer realm="api", error="insufficient_scope", error_description="The request requires higher privileges than provided by the access token"`
+		if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != expected {
+			t.Fatalf("challenge should not be localized: %s", challenge)
+		}
+
+		var problem Problem
+		err := json.NewDecoder(recorder.Body).Decode(&problem)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid body: %s", err)
+		}
+
+		if problem.Code != gate.CodeForbidden || problem.Detail != "Action interdite" {
+			t.Fatalf("invalid problem: %+v", problem)
+		}
+	})
+}
+
+func TestLocale(t *testing.T) {
+	cases := map[string]string{
+		"":                      gate.DefaultLocale,
+		"*":                     gate.DefaultLocale,
+		"vi":                    "vi",
+		"en;q=0.5, ja":          "ja",
+		"fr;q=0.4, de;q=0.9":    "de",
+		"es;q=invalid, pt;q=.1": "pt",
+	}
+
+	for header, expected := range cases {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept-Language", header)
+		if locale := Locale(request); locale != expected {
+			t.Fatalf("locale of %q should be %s: %s", header, expected, locale)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+var errInvalidToken = gate.NewAuthenticationError(errors.New("invalid token"))
+
+type user struct {
+	id    string
+	roles []string
+}
+
+func (u user) GetID() string {
+	return u.id
+}
+
+func (u user) GetUsername() string {
+	return u.id
+}
+
+func (u user) GetRoles() []string {
+	return u.roles
+}
+
+type grant struct {
+	userID string
+	action string
+	object string
+}
+
+type myAuth struct {
+	tokens      map[string]gate.User
+	grants      []grant
+	expirations map[string]time.Time
+}
+
+func (auth myAuth) ParseJWT(token string) (gate.JWT, error) {
+	u, ok := auth.tokens[token]
+	if !ok {
+		return gate.JWT{}, errInvalidToken
+	}
+
+	return gate.JWT{ID: token, Value: token, UserID: u.GetID(), ExpiredAt: auth.expirations[token]}, nil
+}
+
+func (auth myAuth) Authenticate(token string) (gate.User, error) {
+	u, ok := auth.tokens[token]
+	if !ok {
+		return nil, errInvalidToken
+	}
+
+	return u, nil
+}
+
+func (auth myAuth) Authorize(u gate.User, action, object string) error {
+	for _, g := range auth.grants {
+		if g.userID == u.GetID() && g.action == action && g.object == object {
+			return nil
+		}
+	}
+
+	return gate.ErrForbidden
+}
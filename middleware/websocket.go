@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// ErrNotWebSocket is thrown when a request is not a WebSocket upgrade
+var ErrNotWebSocket = errors.New("not a websocket upgrade")
+
+// ErrUserMismatch is thrown when a connection is re-authenticated with a token of another user
+var ErrUserMismatch = errors.New("user mismatch")
+
+// TokenParser is the part of gate.Auth used to resolve token expiration
+type TokenParser interface {
+	ParseJWT(string) (gate.JWT, error)
+}
+
+// IsWebSocketUpgrade reports whether a request is a WebSocket upgrade request
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func subprotocols(r *http.Request) (protocols []string) {
+	for _, value := range r.Header[http.CanonicalHeaderKey("Sec-WebSocket-Protocol")] {
+		for _, protocol := range strings.Split(value, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	return
+}
+
+// SubprotocolExtractor extracts the token from a Sec-WebSocket-Protocol entry with the given prefix, e.g. "bearer.<token>"
+func SubprotocolExtractor(prefix string) TokenExtractor {
+	return subprotocolExtractor(prefix)
+}
+
+type subprotocolExtractor string
+
+func (prefix subprotocolExtractor) ExtractToken(r *http.Request) (token string, err error) {
+	for _, protocol := range subprotocols(r) {
+		if strings.HasPrefix(protocol, string(prefix)) && len(protocol) > len(prefix) {
+			token = protocol[len(prefix):]
+			return
+		}
+	}
+
+	err = ErrMissingToken
+	return
+}
+
+// isTokenProtocol reports whether a subprotocol is the entry of the token for a subprotocol extractor of the extractor,
+// i.e. the prefix of the extractor followed by the token
+func isTokenProtocol(extractor TokenExtractor, protocol, token string) bool {
+	switch extractor := extractor.(type) {
+	case subprotocolExtractor:
+		return protocol == string(extractor)+token
+	case extractorChain:
+		for _, chained := range extractor {
+			if isTokenProtocol(chained, protocol, token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// WebSocketExtractor extracts the token from the "access_token" query parameter or a "bearer." prefixed subprotocol
+func WebSocketExtractor() TokenExtractor {
+	return ChainExtractors(QueryExtractor("access_token"), SubprotocolExtractor("bearer."))
+}
+
+// WebSocketSession ties an authenticated user to a WebSocket connection and supports re-authentication
+type WebSocketSession struct {
+	auth      Authenticator
+	user      gate.User
+	expiredAt time.Time
+	protocols []string
+	Now       func() time.Time
+	*sync.RWMutex
+}
+
+// User returns the user of the connection
+func (session *WebSocketSession) User() gate.User {
+	session.RLock()
+	defer session.RUnlock()
+
+	return session.user
+}
+
+// ExpiredAt returns the expiration of the current token or the zero time if it is unknown
+func (session *WebSocketSession) ExpiredAt() time.Time {
+	session.RLock()
+	defer session.RUnlock()
+
+	return session.expiredAt
+}
+
+// Subprotocols returns the requested subprotocols without the token entry of a SubprotocolExtractor, the server should select one of them
+func (session *WebSocketSession) Subprotocols() []string {
+	return session.protocols
+}
+
+// NeedsReauthentication reports whether the current token expires within the given window
+func (session *WebSocketSession) NeedsReauthentication(window time.Duration) bool {
+	expiredAt := session.ExpiredAt()
+	if expiredAt.IsZero() {
+		return false
+	}
+
+	return !session.Now().Add(window).Before(expiredAt)
+}
+
+// Reauthenticate replaces the token of the connection. The token must belong to the user of the connection
+func (session *WebSocketSession) Reauthenticate(tokenString string) (err error) {
+	user, expiredAt, err := authenticateWithExpiration(session.auth, tokenString)
+	if err != nil {
+		return
+	}
+
+	session.Lock()
+	defer session.Unlock()
+
+	if user.GetID() != session.user.GetID() {
+		err = ErrUserMismatch
+		return
+	}
+
+	session.user = user
+	session.expiredAt = expiredAt
+	return
+}
+
+// authenticateWithExpiration authenticates a token and returns its expiration. The token parsed by a ContextAuthenticator is reused,
+// other authenticators must implement TokenParser to resolve the expiration
+func authenticateWithExpiration(auth Authenticator, tokenString string) (user gate.User, expiredAt time.Time, err error) {
+	if authenticator, ok := auth.(ContextAuthenticator); ok {
+		var authz *gate.AuthzContext
+		authz, err = authenticator.NewAuthzContext(tokenString, "")
+		if err != nil {
+			return
+		}
+
+		user, expiredAt = authz.User, authz.Token.ExpiredAt
+		return
+	}
+
+	user, err = auth.Authenticate(tokenString)
+	if err != nil {
+		return
+	}
+
+	parser, ok := auth.(TokenParser)
+	if !ok {
+		return
+	}
+
+	token, err := parser.ParseJWT(tokenString)
+	if err != nil {
+		return
+	}
+
+	expiredAt = token.ExpiredAt
+	return
+}
+
+// SetWebSocketExtractor is the setter for the token extractor of WebSocket upgrades, WebSocketExtractor by default
+func (middleware *Middleware) SetWebSocketExtractor(extractor TokenExtractor) {
+	middleware.webSocketExtractor = extractor
+}
+
+// AuthenticateWebSocket authenticates a WebSocket upgrade request and returns the session of the connection
+func (middleware Middleware) AuthenticateWebSocket(r *http.Request) (session *WebSocketSession, err error) {
+	if !IsWebSocketUpgrade(r) {
+		err = ErrNotWebSocket
+		return
+	}
+
+	if middleware.networkPolicy != nil {
+		err = middleware.networkPolicy.Check(r)
+		if err != nil {
+			return
+		}
+	}
+
+	extractor := middleware.webSocketExtractor
+	if extractor == nil {
+		extractor = WebSocketExtractor()
+	}
+
+	tokenString, err := extractor.ExtractToken(r)
+	if err != nil {
+		return
+	}
+
+	user, expiredAt, err := authenticateWithExpiration(middleware.auth, tokenString)
+	if err != nil {
+		return
+	}
+
+	var protocols []string
+	for _, protocol := range subprotocols(r) {
+		if !isTokenProtocol(extractor, protocol, tokenString) {
+			protocols = append(protocols, protocol)
+		}
+	}
+
+	session = &WebSocketSession{
+		auth:      middleware.auth,
+		user:      user,
+		expiredAt: expiredAt,
+		protocols: protocols,
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+		RWMutex: &sync.RWMutex{},
+	}
+	return
+}
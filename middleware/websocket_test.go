@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+func upgradeRequest(target string) *http.Request {
+	r := httptest.NewRequest("GET", target, nil)
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	return r
+}
+
+func TestWebSocket(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	ws := New(myAuth{
+		tokens: map[string]gate.User{
+			"first":  user{id: "id"},
+			"second": user{id: "id"},
+			"other":  user{id: "other"},
+		},
+		expirations: map[string]time.Time{
+			"first":  now.Add(time.Minute),
+			"second": now.Add(time.Hour),
+		},
+	})
+
+	t.Run("not an upgrade", func(t *testing.T) {
+		_, err := ws.AuthenticateWebSocket(httptest.NewRequest("GET", "/ws?access_token=first", nil))
+		if err != ErrNotWebSocket {
+			t.Fatalf("err should be ErrNotWebSocket: %v", err)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		session, err := ws.AuthenticateWebSocket(upgradeRequest("/ws?access_token=first"))
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid token: %s", err)
+		}
+
+		if session.User().GetID() != "id" {
+			t.Fatalf("invalid user: %s", session.User().GetID())
+		}
+	})
+
+	t.Run("subprotocol", func(t *testing.T) {
+		r := upgradeRequest("/ws")
+		r.Header.Set("Sec-WebSocket-Protocol", "chat.v1, bearer.first, v2.first")
+
+		session, err := ws.AuthenticateWebSocket(r)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid token: %s", err)
+		}
+
+		if protocols := session.Subprotocols(); len(protocols) != 2 || protocols[0] != "chat.v1" || protocols[1] != "v2.first" {
+			t.Fatalf("the token entry should be removed from subprotocols: %v", protocols)
+		}
+	})
+
+	t.Run("reauthenticate", func(t *testing.T) {
+		session, err := ws.AuthenticateWebSocket(upgradeRequest("/ws?access_token=first"))
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid token: %s", err)
+		}
+
+		session.Now = func() time.Time {
+			return now
+		}
+
+		if !session.NeedsReauthentication(5 * time.Minute) {
+			t.Fatal("the session should need re-authentication because the token nears expiry")
+		}
+
+		err = session.Reauthenticate("other")
+		if err != ErrUserMismatch {
+			t.Fatalf("err should be ErrUserMismatch because of the other user: %v", err)
+		}
+
+		err = session.Reauthenticate("second")
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid token: %s", err)
+		}
+
+		if session.NeedsReauthentication(5 * time.Minute) {
+			t.Fatal("the session should not need re-authentication after refreshing the token")
+		}
+	})
+
+	t.Run("authorization context", func(t *testing.T) {
+		contexts, authorized := 0, 0
+		auth := ws.auth.(myAuth)
+		contextual := New(contextAuth{auth, &contexts, &authorized})
+		session, err := contextual.AuthenticateWebSocket(upgradeRequest("/ws?access_token=first"))
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid token: %s", err)
+		}
+
+		if contexts != 1 || !session.ExpiredAt().Equal(now.Add(time.Minute)) {
+			t.Fatalf("the token parsed by the authentication should be reused: %d contexts, %s", contexts, session.ExpiredAt())
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package gate
+
+import (
+	"encoding/json"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// ClaimsVersion is the version of the claims layout of issued tokens. Tokens issued before claims were versioned have the version 0
+const ClaimsVersion = 1
+
+// ClaimsMigrator upgrades raw claims of a version to the layout of the next version in place, e.g. moving a renamed user claim
+type ClaimsMigrator func(claims map[string]interface{}) error
+
+// ClaimsMigrations is the registry of claims migrators by the version they upgrade from.
+// Versions without a migrator are considered compatible with the next version
+type ClaimsMigrations map[int]ClaimsMigrator
+
+// Register registers the migrator upgrading claims of the given version
+func (migrations ClaimsMigrations) Register(from int, migrator ClaimsMigrator) {
+	migrations[from] = migrator
+}
+
+// claimsVersion returns the version of raw claims, 0 for legacy claims
+func claimsVersion(claims map[string]interface{}) int {
+	if ver, ok := claims["ver"].(float64); ok {
+		return int(ver)
+	}
+
+	return 0
+}
+
+// Migrate upgrades raw claims to ClaimsVersion. Claims of a later version are left untouched
+func (migrations ClaimsMigrations) Migrate(claims map[string]interface{}) error {
+	version := claimsVersion(claims)
+	for ; version < ClaimsVersion; version++ {
+		migrator, ok := migrations[version]
+		if !ok {
+			continue
+		}
+
+		err := migrator(claims)
+		if err != nil {
+			return errors.Wrapf(err, "could not migrate claims of version %d", version)
+		}
+	}
+
+	if version >= ClaimsVersion {
+		claims["ver"] = version
+	}
+	return nil
+}
+
+// isAccessToken reports whether a JWT is an access token, i.e. it has the JWT type, if any, and its claims identify a user.
+// Other documents signed with the keys of the service, e.g. the webhook signatures of earlier versions, are never migrated to tokens
+func isAccessToken(header map[string]interface{}, claims map[string]interface{}) bool {
+	if typ, ok := header["typ"]; ok {
+		if typ, isString := typ.(string); !isString || !strings.EqualFold(typ, "JWT") {
+			return false
+		}
+	}
+
+	if _, ok := claims["body_sha256"]; ok {
+		return false
+	}
+
+	_, user := claims["user"]
+	_, username := claims["username"]
+	return user || username
+}
+
+// outdated reports whether a JWT decoded with the given result needs to be migrated, i.e. it has an older version or an incompatible layout
+func (config JWTConfig) outdated(claims JWTClaims, err error) bool {
+	if len(config.migrations) == 0 && config.legacyUntil.IsZero() {
+		return false
+	}
+
+	if err == nil {
+		return claims.Version < ClaimsVersion
+	}
+
+	validation, ok := err.(*jwt.ValidationError)
+	return ok && validation.Errors&jwt.ValidationErrorMalformed != 0
+}
+
+// NewClaimsMigrations is the constructor for ClaimsMigrations
+func NewClaimsMigrations() ClaimsMigrations {
+	return ClaimsMigrations{}
+}
+
+// SetClaimsMigrations is the setter for the claims migrations. When set, JWTs of an older claims version are migrated after verification
+// instead of being refused with invalid claims. Tokens encoded by a token codec are not migrated
+func (config *JWTConfig) SetClaimsMigrations(migrations ClaimsMigrations) {
+	config.migrations = migrations
+}
+
+// parseMigrating verifies a JWT into raw claims, migrates them and decodes them into the given claims
+func (service JWTService) parseMigrating(parser *jwt.Parser, signed string, claims *JWTClaims) (obj *jwt.Token, err error) {
+	raw := jwt.MapClaims{}
+	obj, err = parser.ParseWithClaims(signed, raw, service.getVerifyingKey)
+	if err != nil {
+		return
+	}
+
+	if !isAccessToken(obj.Header, raw) {
+		err = ErrUnexpectedJWTType
+		return
+	}
+
+	if claimsVersion(raw) == 0 && !service.config.legacyUntil.IsZero() {
+		err = service.migrateLegacy(raw)
+		if err != nil {
+			return
+		}
+	}
+
+	err = service.config.migrations.Migrate(raw)
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return
+	}
+
+	*claims = JWTClaims{}
+	err = json.Unmarshal(data, claims)
+	if err != nil {
+		err = errors.Wrap(err, "invalid claims")
+	}
+	return
+}
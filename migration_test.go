@@ -0,0 +1,99 @@
+package gate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+func TestClaimsMigrations(t *testing.T) {
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user": "legacy-id",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	service, config := newTestJWTService(t)
+	_, err = service.Parse(legacy)
+	if err == nil {
+		t.Fatal("err should not be nil because of the incompatible layout without migrations")
+	}
+
+	migrations := NewClaimsMigrations()
+	migrations.Register(0, func(claims map[string]interface{}) error {
+		id, _ := claims["user"].(string)
+		claims["user"] = map[string]interface{}{"id": id}
+		return nil
+	})
+	config.SetClaimsMigrations(migrations)
+	service = NewJWTService(config)
+
+	t.Run("legacy", func(t *testing.T) {
+		token, err := service.Parse(legacy)
+		if err != nil {
+			t.Fatalf("err should be nil because of the migration: %s", err)
+		}
+
+		if token.UserID != "legacy-id" {
+			t.Fatalf("user should be migrated: %s", token.UserID)
+		}
+	})
+
+	t.Run("current", func(t *testing.T) {
+		issued, err := service.Issue(service.NewClaims(ClaimsUser{ID: "id"}))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		token, err := service.Parse(issued.Value)
+		if err != nil || token.UserID != "id" {
+			t.Fatalf("current tokens should be parsed without migrations: %v %s", token, err)
+		}
+	})
+
+	t.Run("access tokens", func(t *testing.T) {
+		webhook, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"body_sha256": "hash",
+			"exp":         time.Now().Add(time.Hour).Unix(),
+			"jti":         "id",
+		}).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = service.Parse(webhook); errors.Cause(err) != ErrUnexpectedJWTType {
+			t.Fatalf("err should be ErrUnexpectedJWTType because webhook signatures are not migrated: %v", err)
+		}
+
+		obj := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user": "legacy-id",
+			"exp":  time.Now().Add(time.Hour).Unix(),
+		})
+		obj.Header["typ"] = "secevent+jwt"
+		typed, err := obj.SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = service.Parse(typed); errors.Cause(err) != ErrUnexpectedJWTType {
+			t.Fatalf("err should be ErrUnexpectedJWTType because of the type: %v", err)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		failing := NewClaimsMigrations()
+		failing.Register(0, func(claims map[string]interface{}) error {
+			return ErrForbidden
+		})
+		config.SetClaimsMigrations(failing)
+
+		_, err := NewJWTService(config).Parse(legacy)
+		if err == nil {
+			t.Fatal("err should not be nil because of the failing migration")
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package mocks
+
+import (
+	"github.com/hiendv/gate"
+)
+
+// Auth is a fake gate.Auth
+type Auth struct {
+	GetConfigFunc        func() gate.Config
+	UserServiceFunc      func() (gate.UserService, error)
+	RoleServiceFunc      func() (gate.RoleService, error)
+	TokenServiceFunc     func() (gate.TokenService, error)
+	JWTServiceFunc       func() (gate.JWTService, error)
+	MatcherFunc          func() (gate.Matcher, error)
+	LoginFunc            func(map[string]string) (gate.User, error)
+	IssueJWTFunc         func(gate.User) (gate.JWT, error)
+	ParseJWTFunc         func(string) (gate.JWT, error)
+	StoreJWTFunc         func(gate.JWT) error
+	AuthenticateFunc     func(string) (gate.User, error)
+	AuthorizeFunc        func(gate.User, string, string) error
+	GetUserFromJWTFunc   func(gate.JWT) (gate.User, error)
+	GetUserAbilitiesFunc func(gate.User) ([]gate.UserAbility, error)
+	Recorder
+}
+
+// GetConfig calls GetConfigFunc
+func (auth *Auth) GetConfig() gate.Config {
+	auth.record("GetConfig")
+	if auth.GetConfigFunc == nil {
+		return gate.Config{}
+	}
+
+	return auth.GetConfigFunc()
+}
+
+// UserService calls UserServiceFunc
+func (auth *Auth) UserService() (gate.UserService, error) {
+	auth.record("UserService")
+	if auth.UserServiceFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return auth.UserServiceFunc()
+}
+
+// RoleService calls RoleServiceFunc
+func (auth *Auth) RoleService() (gate.RoleService, error) {
+	auth.record("RoleService")
+	if auth.RoleServiceFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return auth.RoleServiceFunc()
+}
+
+// TokenService calls TokenServiceFunc
+func (auth *Auth) TokenService() (gate.TokenService, error) {
+	auth.record("TokenService")
+	if auth.TokenServiceFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return auth.TokenServiceFunc()
+}
+
+// JWTService calls JWTServiceFunc
+func (auth *Auth) JWTService() (gate.JWTService, error) {
+	auth.record("JWTService")
+	if auth.JWTServiceFunc == nil {
+		return gate.JWTService{}, ErrUnexpectedCall
+	}
+
+	return auth.JWTServiceFunc()
+}
+
+// Matcher calls MatcherFunc
+func (auth *Auth) Matcher() (gate.Matcher, error) {
+	auth.record("Matcher")
+	if auth.MatcherFunc == nil {
+		return gate.Matcher{}, ErrUnexpectedCall
+	}
+
+	return auth.MatcherFunc()
+}
+
+// Login calls LoginFunc
+func (auth *Auth) Login(credentials map[string]string) (gate.User, error) {
+	auth.record("Login", credentials)
+	if auth.LoginFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return auth.LoginFunc(credentials)
+}
+
+// IssueJWT calls IssueJWTFunc
+func (auth *Auth) IssueJWT(user gate.User) (gate.JWT, error) {
+	auth.record("IssueJWT", user)
+	if auth.IssueJWTFunc == nil {
+		return gate.JWT{}, ErrUnexpectedCall
+	}
+
+	return auth.IssueJWTFunc(user)
+}
+
+// ParseJWT calls ParseJWTFunc
+func (auth *Auth) ParseJWT(tokenString string) (gate.JWT, error) {
+	auth.record("ParseJWT", tokenString)
+	if auth.ParseJWTFunc == nil {
+		return gate.JWT{}, ErrUnexpectedCall
+	}
+
+	return auth.ParseJWTFunc(tokenString)
+}
+
+// StoreJWT calls StoreJWTFunc
+func (auth *Auth) StoreJWT(token gate.JWT) error {
+	auth.record("StoreJWT", token)
+	if auth.StoreJWTFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return auth.StoreJWTFunc(token)
+}
+
+// Authenticate calls AuthenticateFunc
+func (auth *Auth) Authenticate(tokenString string) (gate.User, error) {
+	auth.record("Authenticate", tokenString)
+	if auth.AuthenticateFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return auth.AuthenticateFunc(tokenString)
+}
+
+// Authorize calls AuthorizeFunc
+func (auth *Auth) Authorize(user gate.User, action, object string) error {
+	auth.record("Authorize", user, action, object)
+	if auth.AuthorizeFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return auth.AuthorizeFunc(user, action, object)
+}
+
+// GetUserFromJWT calls GetUserFromJWTFunc
+func (auth *Auth) GetUserFromJWT(token gate.JWT) (gate.User, error) {
+	auth.record("GetUserFromJWT", token)
+	if auth.GetUserFromJWTFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return auth.GetUserFromJWTFunc(token)
+}
+
+// GetUserAbilities calls GetUserAbilitiesFunc
+func (auth *Auth) GetUserAbilities(user gate.User) ([]gate.UserAbility, error) {
+	auth.record("GetUserAbilities", user)
+	if auth.GetUserAbilitiesFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return auth.GetUserAbilitiesFunc(user)
+}
+
+var _ gate.Auth = &Auth{}
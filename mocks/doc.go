@@ -0,0 +1,3 @@
+// Package mocks provides hand-written fakes of the github.com/hiendv/gate contracts for downstream test suites.
+// Every fake calls the function field named after the method when it is set and records the call
+package mocks
@@ -0,0 +1,53 @@
+package mocks
+
+import (
+	"github.com/hiendv/gate"
+)
+
+// User is a fake gate.User
+type User struct {
+	ID       string
+	Username string
+	Roles    []string
+}
+
+// GetID returns the ID
+func (user User) GetID() string {
+	return user.ID
+}
+
+// GetUsername returns the username
+func (user User) GetUsername() string {
+	return user.Username
+}
+
+// GetRoles returns the role IDs
+func (user User) GetRoles() []string {
+	return user.Roles
+}
+
+// Ability is a fake gate.UserAbility
+type Ability struct {
+	Action string
+	Object string
+}
+
+// GetAction returns the action
+func (ability Ability) GetAction() string {
+	return ability.Action
+}
+
+// GetObject returns the object
+func (ability Ability) GetObject() string {
+	return ability.Object
+}
+
+// Role is a fake gate.Role
+type Role struct {
+	Abilities []gate.UserAbility
+}
+
+// GetAbilities returns the abilities
+func (role Role) GetAbilities() []gate.UserAbility {
+	return role.Abilities
+}
@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnexpectedCall is returned by a fake method whose function field is not set
+var ErrUnexpectedCall = errors.New("unexpected call")
+
+// Call is a recorded method call
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Recorder records method calls
+type Recorder struct {
+	calls []Call
+	mutex sync.Mutex
+}
+
+func (recorder *Recorder) record(method string, args ...interface{}) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.calls = append(recorder.calls, Call{method, args})
+}
+
+// Calls returns the recorded calls
+func (recorder *Recorder) Calls() []Call {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	calls := make([]Call, len(recorder.calls))
+	copy(calls, recorder.calls)
+	return calls
+}
+
+// CallsTo returns the recorded calls of a method
+func (recorder *Recorder) CallsTo(method string) (calls []Call) {
+	for _, call := range recorder.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return
+}
+
+// Reset removes the recorded calls
+func (recorder *Recorder) Reset() {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.calls = nil
+}
@@ -0,0 +1,64 @@
+package mocks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/password"
+)
+
+func TestAuth(t *testing.T) {
+	auth := &Auth{
+		AuthenticateFunc: func(token string) (gate.User, error) {
+			return User{ID: "id"}, nil
+		},
+	}
+
+	user, err := auth.Authenticate("token")
+	if err != nil || user.GetID() != "id" {
+		t.Fatalf("the configured function should be called: %v - %v", user, err)
+	}
+
+	err = auth.Authorize(user, "GET", "/")
+	if err != ErrUnexpectedCall {
+		t.Fatalf("err should be ErrUnexpectedCall because of the missing function: %v", err)
+	}
+
+	calls := auth.CallsTo("Authenticate")
+	if len(calls) != 1 || calls[0].Args[0] != "token" {
+		t.Fatalf("the call should be recorded: %v", calls)
+	}
+
+	auth.Reset()
+	if len(auth.Calls()) != 0 {
+		t.Fatal("the calls should be removed")
+	}
+}
+
+func TestServices(t *testing.T) {
+	users := &UserService{
+		FindOneByIDFunc: func(id string) (gate.User, error) {
+			return User{ID: id, Roles: []string{"role"}}, nil
+		},
+	}
+	roles := &RoleService{
+		FindByIDsFunc: func(ids []string) ([]gate.Role, error) {
+			return []gate.Role{Role{[]gate.UserAbility{Ability{"GET", "*"}}}}, nil
+		},
+	}
+
+	driver, err := password.New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour, false), gate.NewDependencies(users, &TokenService{}, roles), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	_, err = driver.AuthorizeUserID("id", "GET", "/")
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid abilities: %s", err)
+	}
+
+	if len(users.CallsTo("FindOneByID")) != 1 || len(roles.CallsTo("FindByIDs")) != 1 {
+		t.Fatal("the services should be called once")
+	}
+}
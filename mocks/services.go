@@ -0,0 +1,206 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/hiendv/gate"
+)
+
+// UserService is a fake gate.UserService which also implements gate.UserRoleManager
+type UserService struct {
+	FindOneByIDFunc               func(string) (gate.User, error)
+	FindOrCreateOneByUsernameFunc func(string) (gate.User, error)
+	AssignRoleFunc                func(userID, roleID string) error
+	RevokeRoleFunc                func(userID, roleID string) error
+	ListRolesFunc                 func(userID string) ([]string, error)
+	Recorder
+}
+
+// FindOneByID calls FindOneByIDFunc
+func (service *UserService) FindOneByID(id string) (gate.User, error) {
+	service.record("FindOneByID", id)
+	if service.FindOneByIDFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return service.FindOneByIDFunc(id)
+}
+
+// FindOrCreateOneByUsername calls FindOrCreateOneByUsernameFunc
+func (service *UserService) FindOrCreateOneByUsername(username string) (gate.User, error) {
+	service.record("FindOrCreateOneByUsername", username)
+	if service.FindOrCreateOneByUsernameFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return service.FindOrCreateOneByUsernameFunc(username)
+}
+
+// AssignRole calls AssignRoleFunc
+func (service *UserService) AssignRole(userID, roleID string) error {
+	service.record("AssignRole", userID, roleID)
+	if service.AssignRoleFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return service.AssignRoleFunc(userID, roleID)
+}
+
+// RevokeRole calls RevokeRoleFunc
+func (service *UserService) RevokeRole(userID, roleID string) error {
+	service.record("RevokeRole", userID, roleID)
+	if service.RevokeRoleFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return service.RevokeRoleFunc(userID, roleID)
+}
+
+// ListRoles calls ListRolesFunc
+func (service *UserService) ListRoles(userID string) ([]string, error) {
+	service.record("ListRoles", userID)
+	if service.ListRolesFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return service.ListRolesFunc(userID)
+}
+
+// RoleService is a fake gate.RoleService which also implements gate.RoleManager
+type RoleService struct {
+	FindByIDsFunc     func([]string) ([]gate.Role, error)
+	CreateRoleFunc    func(string, []gate.UserAbility) error
+	UpdateRoleFunc    func(string, []gate.UserAbility) error
+	DeleteRoleFunc    func(string) error
+	AttachAbilityFunc func(string, gate.UserAbility) error
+	DetachAbilityFunc func(string, gate.UserAbility) error
+	Recorder
+}
+
+// FindByIDs calls FindByIDsFunc
+func (service *RoleService) FindByIDs(ids []string) ([]gate.Role, error) {
+	service.record("FindByIDs", ids)
+	if service.FindByIDsFunc == nil {
+		return nil, ErrUnexpectedCall
+	}
+
+	return service.FindByIDsFunc(ids)
+}
+
+// CreateRole calls CreateRoleFunc
+func (service *RoleService) CreateRole(id string, abilities []gate.UserAbility) error {
+	service.record("CreateRole", id, abilities)
+	if service.CreateRoleFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return service.CreateRoleFunc(id, abilities)
+}
+
+// UpdateRole calls UpdateRoleFunc
+func (service *RoleService) UpdateRole(id string, abilities []gate.UserAbility) error {
+	service.record("UpdateRole", id, abilities)
+	if service.UpdateRoleFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return service.UpdateRoleFunc(id, abilities)
+}
+
+// DeleteRole calls DeleteRoleFunc
+func (service *RoleService) DeleteRole(id string) error {
+	service.record("DeleteRole", id)
+	if service.DeleteRoleFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return service.DeleteRoleFunc(id)
+}
+
+// AttachAbility calls AttachAbilityFunc
+func (service *RoleService) AttachAbility(id string, ability gate.UserAbility) error {
+	service.record("AttachAbility", id, ability)
+	if service.AttachAbilityFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return service.AttachAbilityFunc(id, ability)
+}
+
+// DetachAbility calls DetachAbilityFunc
+func (service *RoleService) DetachAbility(id string, ability gate.UserAbility) error {
+	service.record("DetachAbility", id, ability)
+	if service.DetachAbilityFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return service.DetachAbilityFunc(id, ability)
+}
+
+// TokenService is a fake gate.TokenService which also implements gate.TokenConsumer and gate.TokenPurger
+type TokenService struct {
+	FindOneByIDFunc  func(string) (gate.JWT, error)
+	StoreFunc        func(gate.JWT) error
+	ConsumeFunc      func(string) error
+	PurgeExpiredFunc func(before time.Time) (int, error)
+	CountByUserFunc  func(userID string) (int, error)
+	Recorder
+}
+
+// FindOneByID calls FindOneByIDFunc
+func (service *TokenService) FindOneByID(id string) (gate.JWT, error) {
+	service.record("FindOneByID", id)
+	if service.FindOneByIDFunc == nil {
+		return gate.JWT{}, ErrUnexpectedCall
+	}
+
+	return service.FindOneByIDFunc(id)
+}
+
+// Store calls StoreFunc
+func (service *TokenService) Store(token gate.JWT) error {
+	service.record("Store", token)
+	if service.StoreFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return service.StoreFunc(token)
+}
+
+// Consume calls ConsumeFunc
+func (service *TokenService) Consume(id string) error {
+	service.record("Consume", id)
+	if service.ConsumeFunc == nil {
+		return ErrUnexpectedCall
+	}
+
+	return service.ConsumeFunc(id)
+}
+
+// PurgeExpired calls PurgeExpiredFunc
+func (service *TokenService) PurgeExpired(before time.Time) (int, error) {
+	service.record("PurgeExpired", before)
+	if service.PurgeExpiredFunc == nil {
+		return 0, ErrUnexpectedCall
+	}
+
+	return service.PurgeExpiredFunc(before)
+}
+
+// CountByUser calls CountByUserFunc
+func (service *TokenService) CountByUser(userID string) (int, error) {
+	service.record("CountByUser", userID)
+	if service.CountByUserFunc == nil {
+		return 0, ErrUnexpectedCall
+	}
+
+	return service.CountByUserFunc(userID)
+}
+
+var _ gate.UserService = &UserService{}
+var _ gate.UserRoleManager = &UserService{}
+var _ gate.RoleService = &RoleService{}
+var _ gate.RoleManager = &RoleService{}
+var _ gate.TokenService = &TokenService{}
+var _ gate.TokenConsumer = &TokenService{}
+var _ gate.TokenPurger = &TokenService{}
@@ -0,0 +1,291 @@
+package gate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// maxMsgpackDepth is the maximum nesting of decoded msgpack values, e.g. delegation chains
+const maxMsgpackDepth = 32
+
+var errMsgpack = errors.New("invalid msgpack data")
+
+// msgpackFromJSON converts a JSON document into msgpack with the nil, bool, integer, float, string, array and map formats
+func msgpackFromJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeMsgpack(&buf, value); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// msgpackToJSON converts msgpack back into a JSON document
+func msgpackToJSON(data []byte) ([]byte, error) {
+	decoder := msgpackDecoder{data: data}
+	value, err := decoder.decode(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoder.offset != len(data) {
+		return nil, errors.WithMessage(errMsgpack, "trailing data")
+	}
+
+	return json.Marshal(value)
+}
+
+func encodeMsgpack(buf *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if value {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			encodeMsgpackInt(buf, i)
+			return nil
+		}
+
+		f, err := value.Float64()
+		if err != nil {
+			return err
+		}
+
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case string:
+		encodeMsgpackHeader(buf, len(value), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buf.WriteString(value)
+	case []interface{}:
+		encodeMsgpackHeader(buf, len(value), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range value {
+			if err := encodeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		encodeMsgpackHeader(buf, len(value), 0x80, 16, 0, 0xde, 0xdf)
+		for _, key := range keys {
+			encodeMsgpack(buf, key)
+			if err := encodeMsgpack(buf, value[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("unsupported msgpack value: %T", value)
+	}
+
+	return nil
+}
+
+func encodeMsgpackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+// encodeMsgpackHeader writes the format and the length of a string, an array or a map. A zero format is not available
+func encodeMsgpackHeader(buf *bytes.Buffer, length int, fix byte, fixLimit int, format8, format16, format32 byte) {
+	switch {
+	case length < fixLimit:
+		buf.WriteByte(fix | byte(length))
+	case format8 != 0 && length <= math.MaxUint8:
+		buf.WriteByte(format8)
+		buf.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buf.WriteByte(format16)
+		binary.Write(buf, binary.BigEndian, uint16(length))
+	default:
+		buf.WriteByte(format32)
+		binary.Write(buf, binary.BigEndian, uint32(length))
+	}
+}
+
+type msgpackDecoder struct {
+	data   []byte
+	offset int
+}
+
+func (decoder *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || len(decoder.data)-decoder.offset < n {
+		return nil, errors.WithMessage(errMsgpack, "unexpected end of data")
+	}
+
+	b := decoder.data[decoder.offset : decoder.offset+n]
+	decoder.offset += n
+	return b, nil
+}
+
+func (decoder *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := decoder.read(n)
+	if err != nil {
+		return 0, err
+	}
+
+	var value uint64
+	for _, c := range b {
+		value = value<<8 | uint64(c)
+	}
+
+	return value, nil
+}
+
+func (decoder *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxMsgpackDepth {
+		return nil, errors.WithMessage(errMsgpack, "too deep")
+	}
+
+	b, err := decoder.read(1)
+	if err != nil {
+		return nil, err
+	}
+
+	format := b[0]
+	switch {
+	case format <= 0x7f:
+		return int64(format), nil
+	case format >= 0xe0:
+		return int64(int8(format)), nil
+	case format&0xe0 == 0xa0:
+		return decoder.string(int(format & 0x1f))
+	case format&0xf0 == 0x90:
+		return decoder.array(int(format&0x0f), depth)
+	case format&0xf0 == 0x80:
+		return decoder.object(int(format&0x0f), depth)
+	}
+
+	switch format {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		bits, err := decoder.uint(4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case 0xcb:
+		bits, err := decoder.uint(8)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return decoder.uint(1 << (format - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (format - 0xd0)
+		value, err := decoder.uint(size)
+		shift := uint(64 - 8*size)
+		return int64(value<<shift) >> shift, err
+	case 0xd9, 0xda, 0xdb:
+		length, err := decoder.uint(1 << (format - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.string(int(length))
+	case 0xdc, 0xdd:
+		length, err := decoder.uint(2 << (format - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.array(int(length), depth)
+	case 0xde, 0xdf:
+		length, err := decoder.uint(2 << (format - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.object(int(length), depth)
+	}
+
+	return nil, errors.WithMessage(errMsgpack, "unsupported format")
+}
+
+func (decoder *msgpackDecoder) string(length int) (interface{}, error) {
+	b, err := decoder.read(length)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func (decoder *msgpackDecoder) array(length int, depth int) (interface{}, error) {
+	// every item takes a byte at least, hence longer arrays are truncated data
+	if length > len(decoder.data)-decoder.offset {
+		return nil, errors.WithMessage(errMsgpack, "unexpected end of data")
+	}
+
+	items := make([]interface{}, length)
+	for i := range items {
+		item, err := decoder.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		items[i] = item
+	}
+
+	return items, nil
+}
+
+func (decoder *msgpackDecoder) object(length int, depth int) (interface{}, error) {
+	if length > len(decoder.data)-decoder.offset {
+		return nil, errors.WithMessage(errMsgpack, "unexpected end of data")
+	}
+
+	object := make(map[string]interface{}, length)
+	for i := 0; i < length; i++ {
+		key, err := decoder.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		name, ok := key.(string)
+		if !ok {
+			return nil, errors.WithMessage(errMsgpack, "map keys must be strings")
+		}
+
+		object[name], err = decoder.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return object, nil
+}
@@ -0,0 +1,2 @@
+// Package mtls is the client-certificate authentication driver for github.com/hiendv/gate, e.g. for service meshes and internal tooling
+package mtls
@@ -0,0 +1,206 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/password"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCertificate is thrown when a client certificate chain cannot be parsed or verified
+var ErrInvalidCertificate = errors.New("invalid client certificate")
+
+// ErrUnknownIdentity is thrown when no user matches the identity of a client certificate
+var ErrUnknownIdentity = errors.New("unknown certificate identity")
+
+// IdentityFunc is the handler of client-certificate authentication finding the user of a verified leaf certificate
+type IdentityFunc func(*x509.Certificate) (gate.User, error)
+
+// LookupFunc finds a user by a certificate name, e.g. gate.UserService.FindOneByID
+type LookupFunc func(name string) (gate.User, error)
+
+// Names returns the identities of a certificate in order of precedence: the URI SANs, e.g. SPIFFE IDs,
+// the DNS SANs, the email SANs and the common name of the subject
+func Names(certificate *x509.Certificate) (names []string) {
+	names = alternativeNames(certificate)
+	if certificate.Subject.CommonName != "" {
+		names = append(names, certificate.Subject.CommonName)
+	}
+	return
+}
+
+func alternativeNames(certificate *x509.Certificate) (names []string) {
+	names = append(names, uriNames(certificate)...)
+	names = append(names, certificate.DNSNames...)
+	names = append(names, certificate.EmailAddresses...)
+	return
+}
+
+// SubjectIdentity finds users by the common name of the certificate subject
+func SubjectIdentity(lookup LookupFunc) IdentityFunc {
+	return func(certificate *x509.Certificate) (gate.User, error) {
+		if certificate.Subject.CommonName == "" {
+			return nil, ErrUnknownIdentity
+		}
+
+		return lookup(certificate.Subject.CommonName)
+	}
+}
+
+// SANIdentity finds users by the subject alternative names of the certificate, trying the URIs, the DNS names
+// and the email addresses in order until a user is found
+func SANIdentity(lookup LookupFunc) IdentityFunc {
+	return func(certificate *x509.Certificate) (gate.User, error) {
+		for _, name := range alternativeNames(certificate) {
+			user, err := lookup(name)
+			if err == nil {
+				return user, nil
+			}
+		}
+
+		return nil, ErrUnknownIdentity
+	}
+}
+
+// Driver is client-certificate authentication. Certificate chains are verified against the driver's roots.
+// Certificates are public, so only chains of the verified TLS connection state prove the possession of the private key,
+// i.e. chains extracted with middleware.ClientCertificateExtractor. Chains taken from request headers must never be authenticated
+type Driver struct {
+	config        gate.Config
+	authorizer    *password.Driver
+	roots         *x509.CertPool
+	intermediates []*x509.Certificate
+	handler       IdentityFunc
+	Now           func() time.Time
+}
+
+// GetConfig returns authentication configuration
+func (auth Driver) GetConfig() gate.Config {
+	return auth.config
+}
+
+// SetIntermediates is the setter for the intermediate certificates used along with the ones of the presented chains
+func (auth *Driver) SetIntermediates(intermediates []*x509.Certificate) {
+	auth.intermediates = intermediates
+}
+
+// Authenticate parses a client certificate chain of concatenated PEM blocks, leaf first, verifies it and finds its user,
+// e.g. with middleware.ClientCertificateExtractor
+func (auth Driver) Authenticate(chain string) (user gate.User, err error) {
+	certificates, err := ParseChain(chain)
+	if err != nil {
+		err = gate.NewAuthenticationError(err)
+		return
+	}
+
+	return auth.AuthenticateCertificates(certificates)
+}
+
+// AuthenticateCertificates verifies a client certificate chain, leaf first, for client authentication and finds its user
+func (auth Driver) AuthenticateCertificates(certificates []*x509.Certificate) (user gate.User, err error) {
+	if len(certificates) == 0 {
+		err = gate.NewAuthenticationError(errors.WithMessage(ErrInvalidCertificate, "empty chain"))
+		return
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	for _, certificate := range auth.intermediates {
+		intermediates.AddCert(certificate)
+	}
+
+	_, err = certificates[0].Verify(x509.VerifyOptions{
+		Roots:         auth.roots,
+		Intermediates: intermediates,
+		CurrentTime:   auth.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		err = gate.NewAuthenticationError(errors.WithMessage(ErrInvalidCertificate, err.Error()))
+		return
+	}
+
+	user, err = auth.handler(certificates[0])
+	if err != nil {
+		err = errors.Wrap(err, "could not find the user of the certificate")
+		if errors.Cause(err) == ErrUnknownIdentity {
+			err = gate.NewAuthenticationError(err)
+		}
+	}
+	return
+}
+
+// Authorize performs the authorization when a given user takes an action on an object like the password driver does
+func (auth Driver) Authorize(user gate.User, action, object string) error {
+	return auth.authorizer.Authorize(user, action, object)
+}
+
+// AuthorizeContext performs the authorization of the user of an authorization context like the password driver does
+func (auth Driver) AuthorizeContext(ctx *gate.AuthzContext, action, object string) error {
+	return auth.authorizer.AuthorizeContext(ctx, action, object)
+}
+
+// ParseChain parses concatenated PEM certificate blocks, leaf first
+func ParseChain(chain string) (certificates []*x509.Certificate, err error) {
+	rest := []byte(chain)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		var certificate *x509.Certificate
+		certificate, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			err = errors.WithMessage(ErrInvalidCertificate, err.Error())
+			return
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		err = errors.WithMessage(ErrInvalidCertificate, "no certificates")
+	}
+	return
+}
+
+// New is the constructor for Driver. Chains are verified against the given roots and their users are found by the handler.
+// The authorization requires either the authorization backend or the role service of the dependencies, see password.NewAuthorizer
+func New(config gate.Config, dependencies *gate.Dependencies, roots *x509.CertPool, handler IdentityFunc) (*Driver, error) {
+	if dependencies == nil {
+		return nil, errors.New("missing dependencies")
+	}
+
+	if roots == nil {
+		return nil, errors.New("missing roots")
+	}
+
+	if handler == nil {
+		return nil, errors.New("missing identity handler")
+	}
+
+	authorizer, err := password.NewAuthorizer(config, dependencies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Driver{
+		config:     config,
+		authorizer: authorizer,
+		roots:      roots,
+		handler:    handler,
+		Now:        dependencies.Clock().Now,
+	}, nil
+}
@@ -0,0 +1,265 @@
+package mtls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/middleware"
+	"github.com/hiendv/gate/policy"
+	"github.com/pkg/errors"
+)
+
+type authority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newCertificate(t *testing.T, template *x509.Certificate, parent *authority) *authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	parentCertificate, parentKey := template, key
+	if parent != nil {
+		parentCertificate, parentKey = parent.certificate, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCertificate, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	return &authority{certificate, key}
+}
+
+func newAuthority(t *testing.T, name string) *authority {
+	return newCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func newClient(t *testing.T, parent *authority, name string, dnsNames []string, usage x509.ExtKeyUsage) *authority {
+	return newCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}, parent)
+}
+
+func encode(certificates ...*authority) string {
+	var buffer bytes.Buffer
+	for _, certificate := range certificates {
+		pem.Encode(&buffer, &pem.Block{Type: "CERTIFICATE", Bytes: certificate.certificate.Raw})
+	}
+	return buffer.String()
+}
+
+func TestDriver(t *testing.T) {
+	ca := newAuthority(t, "root")
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+
+	document := policy.Document{
+		Roles: []policy.Role{
+			{ID: "reader", Abilities: []policy.Ability{{Action: "GET", Object: "/metrics"}}},
+			{ID: "auditor", PermissionSets: []string{"audit"}},
+		},
+		PermissionSets: []policy.PermissionSet{{Name: "audit", Abilities: []policy.Ability{{Action: "GET", Object: "/audit"}}}},
+		Users:          []policy.User{{ID: "billing.internal", Roles: []string{"reader", "auditor"}}, {ID: "billing", Roles: []string{"reader"}}},
+	}
+
+	dependencies := gate.NewDependencies(nil, nil, document)
+	dependencies.SetPermissionSetService(document)
+	driver, err := New(gate.NewConfig(nil, nil, time.Hour, false), dependencies, roots, SANIdentity(document.FindOneByID))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	client := newClient(t, ca, "billing", []string{"billing.internal"}, x509.ExtKeyUsageClientAuth)
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := New(gate.NewConfig(nil, nil, time.Hour, false), gate.NewDependencies(nil, nil, nil), roots, SANIdentity(document.FindOneByID))
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing role service")
+		}
+
+		_, err = New(gate.NewConfig(nil, nil, time.Hour, false), dependencies, nil, SANIdentity(document.FindOneByID))
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing roots")
+		}
+	})
+
+	t.Run("authenticate", func(t *testing.T) {
+		user, err := driver.Authenticate(encode(client))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if user.GetID() != "billing.internal" {
+			t.Fatalf("user should be found by the SAN: %s", user.GetID())
+		}
+
+		_, err = driver.Authenticate(url.QueryEscape(encode(client)))
+		if errors.Cause(err) != ErrInvalidCertificate {
+			t.Fatalf("err should be ErrInvalidCertificate because escaped chains of proxy headers are not authenticated: %v", err)
+		}
+
+		subject := *driver
+		subject.handler = SubjectIdentity(document.FindOneByID)
+		user, err = subject.Authenticate(encode(client))
+		if err != nil || user.GetID() != "billing" {
+			t.Fatalf("user should be found by the common name: %v", err)
+		}
+	})
+
+	t.Run("intermediates", func(t *testing.T) {
+		intermediate := newCertificate(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(3),
+			Subject:               pkix.Name{CommonName: "intermediate"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}, ca)
+		leaf := newClient(t, intermediate, "billing", []string{"billing.internal"}, x509.ExtKeyUsageClientAuth)
+
+		_, err := driver.Authenticate(encode(leaf))
+		if errors.Cause(err) != ErrInvalidCertificate {
+			t.Fatalf("err should be ErrInvalidCertificate because of the missing intermediate: %v", err)
+		}
+
+		_, err = driver.Authenticate(encode(leaf, intermediate))
+		if err != nil {
+			t.Fatalf("err should be nil because of the presented intermediate: %s", err)
+		}
+
+		configured := *driver
+		configured.SetIntermediates([]*x509.Certificate{intermediate.certificate})
+		_, err = configured.Authenticate(encode(leaf))
+		if err != nil {
+			t.Fatalf("err should be nil because of the configured intermediate: %s", err)
+		}
+	})
+
+	t.Run("rejections", func(t *testing.T) {
+		_, err := driver.Authenticate("garbage")
+		if errors.Cause(err) != ErrInvalidCertificate {
+			t.Fatalf("err should be ErrInvalidCertificate because of the garbage: %v", err)
+		}
+
+		untrusted := newClient(t, newAuthority(t, "rogue"), "billing", []string{"billing.internal"}, x509.ExtKeyUsageClientAuth)
+		_, err = driver.Authenticate(encode(untrusted))
+		if errors.Cause(err) != ErrInvalidCertificate {
+			t.Fatalf("err should be ErrInvalidCertificate because of the untrusted issuer: %v", err)
+		}
+
+		server := newClient(t, ca, "billing", []string{"billing.internal"}, x509.ExtKeyUsageServerAuth)
+		_, err = driver.Authenticate(encode(server))
+		if errors.Cause(err) != ErrInvalidCertificate {
+			t.Fatalf("err should be ErrInvalidCertificate because of the key usage: %v", err)
+		}
+
+		expired := *driver
+		expired.Now = func() time.Time {
+			return time.Now().Add(2 * time.Hour)
+		}
+		_, err = expired.Authenticate(encode(client))
+		if errors.Cause(err) != ErrInvalidCertificate {
+			t.Fatalf("err should be ErrInvalidCertificate because of the expiration: %v", err)
+		}
+
+		clocked := gate.NewDependencies(nil, nil, document)
+		clocked.SetPermissionSetService(document)
+		clocked.SetClock(gate.ClockFunc(func() time.Time {
+			return time.Now().Add(2 * time.Hour)
+		}))
+		later, err := New(gate.NewConfig(nil, nil, time.Hour, false), clocked, roots, SANIdentity(document.FindOneByID))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = later.Authenticate(encode(client))
+		if errors.Cause(err) != ErrInvalidCertificate {
+			t.Fatalf("err should be ErrInvalidCertificate because of the expiration by the clock of the dependencies: %v", err)
+		}
+
+		stranger := newClient(t, ca, "stranger", []string{"stranger.internal"}, x509.ExtKeyUsageClientAuth)
+		_, err = driver.Authenticate(encode(stranger))
+		if errors.Cause(err) != ErrUnknownIdentity {
+			t.Fatalf("err should be ErrUnknownIdentity: %v", err)
+		}
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		m := middleware.New(driver)
+		m.SetExtractor(middleware.ClientCertificateExtractor())
+		handler := m.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		serve := func(path string, certificates ...*x509.Certificate) int {
+			r := httptest.NewRequest("GET", path, nil)
+			if len(certificates) != 0 {
+				r.TLS = &tls.ConnectionState{PeerCertificates: certificates}
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+			return recorder.Code
+		}
+
+		if code := serve("/metrics", client.certificate); code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the ability: %d", code)
+		}
+
+		if code := serve("/audit", client.certificate); code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the permission set: %d", code)
+		}
+
+		if code := serve("/admin", client.certificate); code != http.StatusForbidden {
+			t.Fatalf("status should be 403 because of the missing ability: %d", code)
+		}
+
+		if code := serve("/metrics"); code != http.StatusUnauthorized {
+			t.Fatalf("status should be 401 because of the missing certificate: %d", code)
+		}
+	})
+
+	t.Run("names", func(t *testing.T) {
+		names := Names(client.certificate)
+		if strings.Join(names, ",") != "billing.internal,billing" {
+			t.Fatalf("names should be ordered by precedence: %v", names)
+		}
+	})
+}
@@ -0,0 +1,14 @@
+//go:build go1.10
+// +build go1.10
+
+package mtls
+
+import "crypto/x509"
+
+// uriNames returns the URI SANs of a certificate, e.g. SPIFFE IDs
+func uriNames(certificate *x509.Certificate) (names []string) {
+	for _, uri := range certificate.URIs {
+		names = append(names, uri.String())
+	}
+	return
+}
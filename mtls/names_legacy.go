@@ -0,0 +1,11 @@
+//go:build !go1.10
+// +build !go1.10
+
+package mtls
+
+import "crypto/x509"
+
+// uriNames returns nothing since URI SANs are not parsed before Go 1.10
+func uriNames(certificate *x509.Certificate) []string {
+	return nil
+}
@@ -0,0 +1,157 @@
+package gate
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultNegativeCacheSize is the default maximum number of entries of a negative cache
+const DefaultNegativeCacheSize = 10000
+
+type negativeEntry struct {
+	err       error
+	expiredAt time.Time
+}
+
+// NegativeCacheStats are the counters of a negative cache
+type NegativeCacheStats struct {
+	// Hits is the number of lookups answered by the cache, i.e. backend calls saved
+	Hits uint64
+	// Misses is the number of lookups not found in the cache
+	Misses uint64
+	// Entries is the number of cached failures, expired ones included until they are purged
+	Entries int
+}
+
+// NegativeCache remembers failed lookups for a short TTL, e.g. users not found by the user service or token strings failing to parse,
+// so the backends are protected from clients replaying the same invalid token. Entries are invalidated by TTL or explicitly.
+// New failures are not cached while the cache is full of unexpired entries
+type NegativeCache struct {
+	ttl     time.Duration
+	size    int
+	entries map[string]negativeEntry
+	hits    *uint64
+	misses  *uint64
+	Now     func() time.Time
+	*sync.RWMutex
+}
+
+// Enabled reports whether the cache is enabled. A cache with a non-positive TTL is disabled
+func (cache NegativeCache) Enabled() bool {
+	return cache.ttl > 0 && cache.RWMutex != nil
+}
+
+// Get returns the cached failure of a lookup
+func (cache NegativeCache) Get(key string) (err error, ok bool) {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.RLock()
+	entry, ok := cache.entries[key]
+	cache.RUnlock()
+
+	if !ok || !cache.Now().Before(entry.expiredAt) {
+		atomic.AddUint64(cache.misses, 1)
+		ok = false
+		return
+	}
+
+	atomic.AddUint64(cache.hits, 1)
+	err = entry.err
+	return
+}
+
+// Set caches the failure of a lookup
+func (cache NegativeCache) Set(key string, err error) {
+	if !cache.Enabled() || err == nil {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	now := cache.Now()
+	if _, ok := cache.entries[key]; !ok && len(cache.entries) >= cache.size {
+		for key, entry := range cache.entries {
+			if !now.Before(entry.expiredAt) {
+				delete(cache.entries, key)
+			}
+		}
+
+		if len(cache.entries) >= cache.size {
+			return
+		}
+	}
+
+	cache.entries[key] = negativeEntry{err, now.Add(cache.ttl)}
+}
+
+// Invalidate removes the cached failures of the given lookups, e.g. after the user is created
+func (cache NegativeCache) Invalidate(keys ...string) {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	for _, key := range keys {
+		delete(cache.entries, key)
+	}
+}
+
+// Stats returns the counters of the cache
+func (cache NegativeCache) Stats() (stats NegativeCacheStats) {
+	if !cache.Enabled() {
+		return
+	}
+
+	cache.RLock()
+	defer cache.RUnlock()
+
+	stats.Hits = atomic.LoadUint64(cache.hits)
+	stats.Misses = atomic.LoadUint64(cache.misses)
+	stats.Entries = len(cache.entries)
+	return
+}
+
+// NegativeUserKey is the negative cache key of a user lookup by ID
+func NegativeUserKey(userID string) string {
+	return "user\x00" + userID
+}
+
+// NegativeTokenKey is the negative cache key of a token string
+func NegativeTokenKey(token string) string {
+	return "token\x00" + token
+}
+
+// NewNegativeCache is the constructor for NegativeCache. A non-positive TTL disables the cache, a non-positive size means DefaultNegativeCacheSize
+func NewNegativeCache(ttl time.Duration, size int) NegativeCache {
+	if size <= 0 {
+		size = DefaultNegativeCacheSize
+	}
+
+	return NegativeCache{
+		ttl:     ttl,
+		size:    size,
+		entries: map[string]negativeEntry{},
+		hits:    new(uint64),
+		misses:  new(uint64),
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+		RWMutex: &sync.RWMutex{},
+	}
+}
+
+// NegativeCache is the getter for the negative cache
+func (dependencies Dependencies) NegativeCache() NegativeCache {
+	return dependencies.negativeCache
+}
+
+// SetNegativeCache is the setter for the negative cache
+func (dependencies *Dependencies) SetNegativeCache(cache NegativeCache) {
+	dependencies.negativeCache = cache
+}
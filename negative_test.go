@@ -0,0 +1,73 @@
+package gate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNegativeCache(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	cache := NewNegativeCache(time.Second, 2)
+	cache.Now = func() time.Time {
+		return now
+	}
+
+	errMissing := errors.New("missing")
+
+	t.Run("get", func(t *testing.T) {
+		if _, ok := cache.Get(NegativeUserKey("id")); ok {
+			t.Fatal("the lookup should not be cached yet")
+		}
+
+		cache.Set(NegativeUserKey("id"), errMissing)
+		err, ok := cache.Get(NegativeUserKey("id"))
+		if !ok || err != errMissing {
+			t.Fatalf("the failure should be cached: %v", err)
+		}
+
+		if _, ok := cache.Get(NegativeTokenKey("id")); ok {
+			t.Fatal("keys of tokens and users should not collide")
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		cache.Set(NegativeTokenKey("a"), errMissing)
+		cache.Set(NegativeTokenKey("b"), errMissing)
+		if _, ok := cache.Get(NegativeTokenKey("b")); ok {
+			t.Fatal("the failure should not be cached because the cache is full")
+		}
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		now = now.Add(time.Second)
+		if _, ok := cache.Get(NegativeUserKey("id")); ok {
+			t.Fatal("the failure should be expired")
+		}
+
+		cache.Set(NegativeTokenKey("b"), errMissing)
+		if _, ok := cache.Get(NegativeTokenKey("b")); !ok {
+			t.Fatal("the failure should be cached in place of the expired ones")
+		}
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		cache.Invalidate(NegativeTokenKey("b"))
+		if _, ok := cache.Get(NegativeTokenKey("b")); ok {
+			t.Fatal("the failure should be invalidated")
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		stats := cache.Stats()
+		if stats.Hits != 2 || stats.Misses != 5 || stats.Entries != 0 {
+			t.Fatalf("the lookups should be counted: %+v", stats)
+		}
+
+		disabled := NewNegativeCache(0, 0)
+		disabled.Set(NegativeUserKey("id"), errMissing)
+		if _, ok := disabled.Get(NegativeUserKey("id")); ok || disabled.Stats().Misses != 0 {
+			t.Fatal("the disabled cache should not cache")
+		}
+	})
+}
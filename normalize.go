@@ -0,0 +1,68 @@
+package gate
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// TrimSpace is the Normalizer removing the leading and trailing white space
+var TrimSpace Normalizer = strings.TrimSpace
+
+// LowercaseEmail is the Normalizer of email addresses, which are compared case-insensitively by most providers
+var LowercaseEmail Normalizer = func(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NFC is the Normalizer applying the Unicode canonical composition, e.g. "e" followed by the combining acute accent to "é",
+// so actions and objects sent by clients composing strings differently match the same abilities
+var NFC Normalizer = norm.NFC.String
+
+// NFKC is the Normalizer applying the Unicode compatibility composition, e.g. folding "ｆｏｏ" typed with East Asian input methods
+// to "foo", the ligature "ﬁ" to "fi" or the ideographic space to a space, so visually equivalent usernames are the same account
+var NFKC Normalizer = norm.NFKC.String
+
+// PhoneNumber returns the Normalizer canonicalizing phone numbers into the E.164 format, e.g. "(028) 3822-1234" to "+842838221234"
+// with the country code "84". Separators are removed, the international prefix "00" is replaced by "+" and
+// national numbers starting with the trunk prefix "0" are prefixed with the country code. Values which are not phone numbers are kept
+func PhoneNumber(countryCode string) Normalizer {
+	return func(phone string) string {
+		digits := make([]rune, 0, len(phone))
+		for i, r := range NFKC(strings.TrimSpace(phone)) {
+			switch {
+			case r >= '0' && r <= '9':
+				digits = append(digits, r)
+			case r == '+' && i == 0:
+				digits = append(digits, r)
+			case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '/':
+			default:
+				return phone
+			}
+		}
+
+		number := string(digits)
+		switch {
+		case strings.HasPrefix(number, "+"):
+			return number
+		case strings.HasPrefix(number, "00"):
+			return "+" + number[2:]
+		case strings.HasPrefix(number, "0") && countryCode != "":
+			return "+" + countryCode + number[1:]
+		}
+
+		return number
+	}
+}
+
+// ChainNormalizers returns the Normalizer applying the normalizers in order
+func ChainNormalizers(normalizers ...Normalizer) Normalizer {
+	return func(str string) string {
+		for _, normalizer := range normalizers {
+			if normalizer != nil {
+				str = normalizer(str)
+			}
+		}
+
+		return str
+	}
+}
@@ -0,0 +1,3 @@
+// Package oidc is a minimal OpenID Connect provider for github.com/hiendv/gate issuing ID tokens
+// and publishing the discovery metadata and the JWKS of the active verification keys
+package oidc
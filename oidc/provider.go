@@ -0,0 +1,272 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// DiscoveryPath is the path of the discovery metadata
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+// DefaultJWKSPath is the default path of the JWKS
+const DefaultJWKSPath = "/.well-known/jwks.json"
+
+// ErrUnknownKey is thrown when no verification key matches the "kid" and "alg" headers of a token
+var ErrUnknownKey = errors.New("unknown key")
+
+// Emailer is the optional contract for users having an email, e.g. gate.ClaimsUser
+type Emailer interface {
+	GetEmail() string
+}
+
+// IDTokenClaims are the claims of ID tokens
+type IDTokenClaims struct {
+	Nonce             string   `json:"nonce,omitempty"`
+	AuthTime          int64    `json:"auth_time,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	Roles             []string `json:"roles,omitempty"`
+	jwt.StandardClaims
+}
+
+// Metadata is the OpenID Connect discovery metadata
+type Metadata struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                    string   `json:"token_endpoint,omitempty"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+type verificationKey struct {
+	id     string
+	method jwt.SigningMethod
+	public interface{}
+}
+
+// Provider is a minimal OpenID Connect provider. It issues ID tokens signed with an RSA or ECDSA key
+// and publishes the verification keys, including the previous keys kept during a rotation
+type Provider struct {
+	issuer     string
+	signingKey interface{}
+	signing    verificationKey
+	keys       []verificationKey
+	ttl        time.Duration
+	jwksPath   string
+	metadata   Metadata
+	Now        func() time.Time
+}
+
+// SetJWKSPath is the setter for the path of the JWKS, DefaultJWKSPath by default
+func (provider *Provider) SetJWKSPath(path string) {
+	provider.jwksPath = path
+}
+
+// SetEndpoints is the setter for the authorization, token and userinfo endpoints advertised by the discovery metadata, if any
+func (provider *Provider) SetEndpoints(authorization, token, userInfo string) {
+	provider.metadata.AuthorizationEndpoint = authorization
+	provider.metadata.TokenEndpoint = token
+	provider.metadata.UserInfoEndpoint = userInfo
+}
+
+// AddVerificationKey publishes a verification key along with the signing key, e.g. the previous signing key until its tokens expire.
+// Private keys are published as their public keys
+func (provider *Provider) AddVerificationKey(kid string, key interface{}) error {
+	verification, err := newVerificationKey(kid, key)
+	if err != nil {
+		return err
+	}
+
+	provider.keys = append(provider.keys, verification)
+	return nil
+}
+
+// IssueIDToken issues an ID token of a user for a client. The nonce of the authentication request is included unless it is empty.
+// The auth time is the time the user actually authenticated, e.g. of the login, not of the issuance. It is omitted if zero
+func (provider Provider) IssueIDToken(user gate.User, audience, nonce string, authTime time.Time) (token string, err error) {
+	now := provider.Now()
+	claims := IDTokenClaims{
+		Nonce:             nonce,
+		PreferredUsername: user.GetUsername(),
+		Roles:             user.GetRoles(),
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    provider.issuer,
+			Subject:   user.GetID(),
+			Audience:  audience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(provider.ttl).Unix(),
+		},
+	}
+
+	if !authTime.IsZero() {
+		claims.AuthTime = authTime.Unix()
+	}
+
+	if emailer, ok := user.(Emailer); ok {
+		claims.Email = emailer.GetEmail()
+	}
+
+	jwtToken := jwt.NewWithClaims(provider.signing.method, claims)
+	jwtToken.Header["kid"] = provider.signing.id
+	token, err = jwtToken.SignedString(provider.signingKey)
+	if err != nil {
+		err = errors.Wrap(err, "could not sign the ID token")
+	}
+	return
+}
+
+// LookupKey returns the verification key of a token by its "kid" and "alg" headers. It is a gate.KeyLookup,
+// e.g. to authenticate the ID tokens with gate.ExternalTokenCodec
+func (provider Provider) LookupKey(kid, alg string) (interface{}, error) {
+	for _, key := range provider.keys {
+		if key.id == kid && key.method.Alg() == alg {
+			return key.public, nil
+		}
+	}
+
+	return nil, ErrUnknownKey
+}
+
+// Metadata returns the discovery metadata
+func (provider Provider) Metadata() Metadata {
+	metadata := provider.metadata
+	metadata.Issuer = provider.issuer
+	metadata.JWKSURI = provider.issuer + provider.jwksPath
+	metadata.ResponseTypesSupported = []string{"id_token"}
+	metadata.SubjectTypesSupported = []string{"public"}
+	metadata.ClaimsSupported = []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "preferred_username", "email", "roles"}
+
+	seen := map[string]bool{}
+	metadata.IDTokenSigningAlgValuesSupported = []string{}
+	for _, key := range provider.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			metadata.IDTokenSigningAlgValuesSupported = append(metadata.IDTokenSigningAlgValuesSupported, alg)
+		}
+	}
+	return metadata
+}
+
+// JWKS returns the JWKS of the active verification keys
+func (provider Provider) JWKS() (set JWKSet, err error) {
+	set.Keys = make([]JWK, 0, len(provider.keys))
+	for _, key := range provider.keys {
+		var jwk JWK
+		jwk, err = newJWK(key.id, key.method.Alg(), key.public)
+		if err != nil {
+			return
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+	return
+}
+
+// Handler returns the handler of the discovery metadata and the JWKS. Mount it at the root of the issuer
+func (provider Provider) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body interface{}
+		switch r.URL.Path {
+		case DiscoveryPath:
+			body = provider.Metadata()
+		case provider.jwksPath:
+			set, err := provider.JWKS()
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			body = set
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// newVerificationKey resolves the signing method and the public key of an RSA or ECDSA key
+func newVerificationKey(kid string, key interface{}) (verification verificationKey, err error) {
+	verification.id = kid
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		verification.method, verification.public = jwt.SigningMethodRS256, &key.PublicKey
+	case *rsa.PublicKey:
+		verification.method, verification.public = jwt.SigningMethodRS256, key
+	case *ecdsa.PrivateKey:
+		verification.method, err = ecdsaMethod(&key.PublicKey)
+		verification.public = &key.PublicKey
+	case *ecdsa.PublicKey:
+		verification.method, err = ecdsaMethod(key)
+		verification.public = key
+	default:
+		err = errors.New("unsupported key, only RSA and ECDSA keys are supported")
+	}
+	return
+}
+
+func ecdsaMethod(key *ecdsa.PublicKey) (jwt.SigningMethod, error) {
+	switch key.Curve.Params().BitSize {
+	case 256:
+		return jwt.SigningMethodES256, nil
+	case 384:
+		return jwt.SigningMethodES384, nil
+	case 521:
+		return jwt.SigningMethodES512, nil
+	}
+
+	return nil, errors.New("unsupported curve")
+}
+
+// NewProvider is the constructor for Provider. The signing key is an *rsa.PrivateKey (RS256) or an *ecdsa.PrivateKey (ES256, ES384 or ES512)
+// identified by the given key ID, and ID tokens expire after the TTL
+func NewProvider(issuer, kid string, signingKey interface{}, ttl time.Duration) (provider Provider, err error) {
+	switch signingKey.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+	default:
+		err = errors.New("the signing key must be an RSA or ECDSA private key")
+		return
+	}
+
+	if ttl <= 0 {
+		err = errors.New("invalid ID token TTL")
+		return
+	}
+
+	signing, err := newVerificationKey(kid, signingKey)
+	if err != nil {
+		return
+	}
+
+	provider = Provider{
+		issuer:     issuer,
+		signingKey: signingKey,
+		signing:    signing,
+		keys:       []verificationKey{signing},
+		ttl:        ttl,
+		jwksPath:   DefaultJWKSPath,
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+	}
+	return
+}
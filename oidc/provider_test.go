@@ -0,0 +1,196 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/hiendv/gate"
+)
+
+// idTokenClaims returns the claims of an ID token without verifying it
+func idTokenClaims(t *testing.T, token string) (claims IDTokenClaims) {
+	payload, err := jwt.DecodeSegment(strings.Split(token, ".")[1])
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+	return
+}
+
+func TestProvider(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	provider, err := NewProvider("https://id.example.com", "current", ecdsaKey, time.Hour)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	err = provider.AddVerificationKey("previous", rsaKey)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	t.Run("invalid keys", func(t *testing.T) {
+		_, err := NewProvider("https://id.example.com", "hmac", []byte("secret"), time.Hour)
+		if err == nil {
+			t.Fatal("err should not be nil because of the HMAC key")
+		}
+
+		_, err = NewProvider("https://id.example.com", "public", &rsaKey.PublicKey, time.Hour)
+		if err == nil {
+			t.Fatal("err should not be nil because of the public signing key")
+		}
+
+		_, err = NewProvider("https://id.example.com", "current", ecdsaKey, 0)
+		if err == nil {
+			t.Fatal("err should not be nil because of the TTL")
+		}
+	})
+
+	t.Run("ID tokens", func(t *testing.T) {
+		user := gate.ClaimsUser{ID: "id", Username: "foo", Email: "foo@example.com", Roles: []string{"admin"}}
+		authTime := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+		token, err := provider.IssueIDToken(user, "client", "nonce", authTime)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		issued := idTokenClaims(t, token)
+		if issued.AuthTime != authTime.Unix() || issued.IssuedAt == authTime.Unix() {
+			t.Fatalf("the auth time should be the time of the authentication instead of the issuance: %d", issued.AuthTime)
+		}
+
+		unknown, err := provider.IssueIDToken(user, "client", "", time.Time{})
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if issued = idTokenClaims(t, unknown); issued.AuthTime != 0 {
+			t.Fatalf("the auth time should be omitted without the time of the authentication: %d", issued.AuthTime)
+		}
+
+		codec, err := gate.NewExternalTokenCodec(gate.KeycloakClaimMapping, provider.LookupKey, []string{"ES256", "RS256"}, "https://id.example.com", "client")
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+		claims, err := codec.Decode(token)
+		if err != nil {
+			t.Fatalf("err should be nil because of the published key: %s", err)
+		}
+
+		if claims.User.ID != "id" || claims.User.Username != "foo" || claims.User.Email != "foo@example.com" {
+			t.Fatalf("claims should hold the user: %#v", claims.User)
+		}
+
+		codec, err = gate.NewExternalTokenCodec(gate.KeycloakClaimMapping, provider.LookupKey, []string{"ES256", "RS256"}, "https://id.example.com", "another")
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = codec.Decode(token)
+		if err == nil {
+			t.Fatal("err should not be nil because of the audience")
+		}
+
+		_, err = provider.LookupKey("current", "RS256")
+		if err != ErrUnknownKey {
+			t.Fatalf("err should be ErrUnknownKey because of the algorithm: %v", err)
+		}
+	})
+
+	t.Run("JWKS", func(t *testing.T) {
+		set, err := provider.JWKS()
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if len(set.Keys) != 2 {
+			t.Fatalf("both keys should be published: %#v", set.Keys)
+		}
+
+		current := set.Keys[0]
+		if current.Kid != "current" || current.Kty != "EC" || current.Crv != "P-256" || current.Alg != "ES256" || current.Use != "sig" {
+			t.Fatalf("signing key should be published: %#v", current)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(current.X)
+		if err != nil || len(x) != 32 || new(big.Int).SetBytes(x).Cmp(ecdsaKey.X) != 0 {
+			t.Fatalf("x should be the padded coordinate: %s", current.X)
+		}
+
+		previous := set.Keys[1]
+		n, err := base64.RawURLEncoding.DecodeString(previous.N)
+		if err != nil || previous.Kty != "RSA" || previous.Alg != "RS256" || new(big.Int).SetBytes(n).Cmp(rsaKey.N) != 0 || previous.E != "AQAB" {
+			t.Fatalf("previous key should be published: %#v", previous)
+		}
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		custom := provider
+		custom.SetJWKSPath("/keys")
+		custom.SetEndpoints("https://id.example.com/authorize", "", "")
+		handler := custom.Handler()
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", DiscoveryPath, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status should be 200: %d", recorder.Code)
+		}
+
+		var metadata Metadata
+		err := json.NewDecoder(recorder.Body).Decode(&metadata)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if metadata.Issuer != "https://id.example.com" || metadata.JWKSURI != "https://id.example.com/keys" || metadata.AuthorizationEndpoint != "https://id.example.com/authorize" {
+			t.Fatalf("metadata should be discovered: %#v", metadata)
+		}
+
+		if len(metadata.IDTokenSigningAlgValuesSupported) != 2 {
+			t.Fatalf("algorithms of the keys should be supported: %v", metadata.IDTokenSigningAlgValuesSupported)
+		}
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/keys", nil))
+		var set JWKSet
+		if err := json.NewDecoder(recorder.Body).Decode(&set); err != nil || len(set.Keys) != 2 {
+			t.Fatalf("JWKS should be served: %v %#v", err, set)
+		}
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", DefaultJWKSPath, nil))
+		if recorder.Code != http.StatusNotFound {
+			t.Fatalf("status should be 404 because of the custom path: %d", recorder.Code)
+		}
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("POST", DiscoveryPath, nil))
+		if recorder.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("status should be 405: %d", recorder.Code)
+		}
+	})
+}
@@ -0,0 +1,2 @@
+// Package opa is the Open Policy Agent authorization backend for github.com/hiendv/gate
+package opa
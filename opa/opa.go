@@ -0,0 +1,219 @@
+package opa
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// DefaultTimeout is the default timeout of policy queries
+const DefaultTimeout = 5 * time.Second
+
+// DefaultCacheSize is the default maximum number of cached decisions
+const DefaultCacheSize = gate.DefaultDecisionCacheSize
+
+// ErrUnavailable is thrown when the policy engine cannot make a decision and the authorizer fails closed
+var ErrUnavailable = errors.New("policy engine is unavailable")
+
+// Input is the input document of policy queries
+type Input struct {
+	User   gate.UserInfo `json:"user"`
+	Action string        `json:"action"`
+	Object string        `json:"object"`
+	Tenant string        `json:"tenant,omitempty"`
+}
+
+type decision struct {
+	allowed   bool
+	expiredAt time.Time
+}
+
+// Authorizer is the gate.Authorizer querying the data API of an Open Policy Agent for a boolean decision,
+// e.g. http://localhost:8181/v1/data/gate/allow. Undefined decisions are denials
+type Authorizer struct {
+	endpoint  string
+	client    *http.Client
+	failOpen  bool
+	ttl       time.Duration
+	size      int
+	decisions map[string]decision
+	Now       func() time.Time
+	*sync.RWMutex
+}
+
+// SetClient is the setter for the HTTP client
+func (authorizer *Authorizer) SetClient(client *http.Client) {
+	authorizer.client = client
+}
+
+// SetFailOpen is the setter for the failure mode. When the policy engine is unavailable,
+// the authorizer allows every action if it fails open and returns ErrUnavailable otherwise. It fails closed by default
+func (authorizer *Authorizer) SetFailOpen(failOpen bool) {
+	authorizer.failOpen = failOpen
+}
+
+// SetCacheTTL is the setter for the decision cache TTL. The cache is disabled by default
+func (authorizer *Authorizer) SetCacheTTL(ttl time.Duration) {
+	authorizer.ttl = ttl
+}
+
+// SetCacheSize is the setter for the maximum number of cached decisions, DefaultCacheSize by default.
+// Expired decisions are purged once the cache is full, new decisions are not cached while the cache is full of unexpired ones
+func (authorizer *Authorizer) SetCacheSize(size int) {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	authorizer.size = size
+}
+
+// Authorize queries the policy engine whether a user can take an action on an object
+func (authorizer Authorizer) Authorize(user gate.User, action, object string) (err error) {
+	return authorizer.AuthorizeInTenant("", user, action, object)
+}
+
+// AuthorizeInTenant queries the policy engine whether a user can take an action on an object in a tenant.
+// The input carries the tenant and the roles of the user in the tenant
+func (authorizer Authorizer) AuthorizeInTenant(tenant string, user gate.User, action, object string) (err error) {
+	input := Input{
+		User:   gate.UserInfo{ID: user.GetID(), Username: user.GetUsername(), Roles: gate.TenantRoles(user, tenant)},
+		Action: action,
+		Object: object,
+		Tenant: tenant,
+	}
+
+	key := decisionKey(input)
+	allowed, ok := authorizer.cached(key)
+	if !ok {
+		allowed, err = authorizer.query(input)
+		if err != nil {
+			if authorizer.failOpen {
+				return nil
+			}
+
+			return errors.WithMessage(ErrUnavailable, err.Error())
+		}
+
+		authorizer.store(key, allowed)
+	}
+
+	if !allowed {
+		err = gate.ErrForbidden
+	}
+	return
+}
+
+// Flush removes every cached decision, e.g. after a policy update
+func (authorizer Authorizer) Flush() {
+	authorizer.Lock()
+	defer authorizer.Unlock()
+
+	for key := range authorizer.decisions {
+		delete(authorizer.decisions, key)
+	}
+}
+
+func (authorizer Authorizer) query(input Input) (allowed bool, err error) {
+	body, err := json.Marshal(struct {
+		Input Input `json:"input"`
+	}{input})
+	if err != nil {
+		return
+	}
+
+	response, err := authorizer.client.Post(authorizer.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = errors.Errorf("unexpected status %d", response.StatusCode)
+		return
+	}
+
+	var result struct {
+		Result *bool `json:"result"`
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		err = errors.Wrap(err, "invalid decision")
+		return
+	}
+
+	allowed = result.Result != nil && *result.Result
+	return
+}
+
+func (authorizer Authorizer) cached(key string) (allowed bool, ok bool) {
+	if authorizer.ttl <= 0 {
+		return
+	}
+
+	authorizer.RLock()
+	defer authorizer.RUnlock()
+
+	entry, ok := authorizer.decisions[key]
+	if !ok || !authorizer.Now().Before(entry.expiredAt) {
+		ok = false
+		return
+	}
+
+	allowed = entry.allowed
+	return
+}
+
+func (authorizer Authorizer) store(key string, allowed bool) {
+	if authorizer.ttl <= 0 {
+		return
+	}
+
+	authorizer.Lock()
+	defer authorizer.Unlock()
+
+	now := authorizer.Now()
+	if _, ok := authorizer.decisions[key]; !ok && len(authorizer.decisions) >= authorizer.size {
+		for key, entry := range authorizer.decisions {
+			if !now.Before(entry.expiredAt) {
+				delete(authorizer.decisions, key)
+			}
+		}
+
+		if len(authorizer.decisions) >= authorizer.size {
+			return
+		}
+	}
+
+	authorizer.decisions[key] = decision{allowed, now.Add(authorizer.ttl)}
+}
+
+func decisionKey(input Input) string {
+	return strings.Join([]string{
+		input.User.ID,
+		strings.Join(input.User.Roles, "\x01"),
+		input.Action,
+		input.Object,
+		input.Tenant,
+	}, "\x00")
+}
+
+// New is the constructor for Authorizer
+func New(endpoint string) Authorizer {
+	return Authorizer{
+		endpoint:  endpoint,
+		client:    &http.Client{Timeout: DefaultTimeout},
+		size:      DefaultCacheSize,
+		decisions: map[string]decision{},
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+		RWMutex: &sync.RWMutex{},
+	}
+}
@@ -0,0 +1,158 @@
+package opa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/policy"
+	"github.com/pkg/errors"
+)
+
+func newPolicyServer(queries *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*queries++
+
+		var body struct {
+			Input Input `json:"input"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case body.Input.Action == "undefined":
+			w.Write([]byte(`{}`))
+		case body.Input.Tenant == "other":
+			w.Write([]byte(`{"result": false}`))
+		case body.Input.User.ID == "1" && body.Input.Action == "GET":
+			w.Write([]byte(`{"result": true}`))
+		default:
+			w.Write([]byte(`{"result": false}`))
+		}
+	}))
+}
+
+func TestAuthorizer(t *testing.T) {
+	var queries int
+	server := newPolicyServer(&queries)
+	defer server.Close()
+
+	user := policy.User{ID: "1", Username: "alice", Roles: []string{"editor"}}
+	authorizer := New(server.URL)
+
+	t.Run("allow", func(t *testing.T) {
+		err := authorizer.Authorize(user, "GET", "/posts")
+		if err != nil {
+			t.Fatalf("err should be nil because of the allowing decision: %s", err)
+		}
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		err := authorizer.Authorize(user, "DELETE", "/posts")
+		if err != gate.ErrForbidden {
+			t.Fatalf("err should be ErrForbidden because of the denying decision: %v", err)
+		}
+
+		err = authorizer.Authorize(user, "undefined", "/posts")
+		if err != gate.ErrForbidden {
+			t.Fatalf("err should be ErrForbidden because of the undefined decision: %v", err)
+		}
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		now := time.Now()
+		cached := New(server.URL)
+		cached.SetCacheTTL(time.Minute)
+		cached.Now = func() time.Time {
+			return now
+		}
+
+		queries = 0
+		for i := 0; i < 3; i++ {
+			err := cached.Authorize(user, "GET", "/posts")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if queries != 1 {
+			t.Fatalf("decision should be cached: %d queries", queries)
+		}
+
+		now = now.Add(time.Minute)
+		err := cached.Authorize(user, "GET", "/posts")
+		if err != nil || queries != 2 {
+			t.Fatalf("expired decision should be queried again: %d queries, %v", queries, err)
+		}
+
+		cached.Flush()
+		err = cached.Authorize(user, "GET", "/posts")
+		if err != nil || queries != 3 {
+			t.Fatalf("flushed decision should be queried again: %d queries, %v", queries, err)
+		}
+	})
+
+	t.Run("tenant", func(t *testing.T) {
+		cached := New(server.URL)
+		cached.SetCacheTTL(time.Minute)
+		if err := cached.AuthorizeInTenant("acme", user, "GET", "/posts"); err != nil {
+			t.Fatalf("err should be nil because of the allowing decision: %s", err)
+		}
+
+		if err := cached.AuthorizeInTenant("other", user, "GET", "/posts"); err != gate.ErrForbidden {
+			t.Fatalf("err should be ErrForbidden because decisions depend on the tenant: %v", err)
+		}
+	})
+
+	t.Run("cache size", func(t *testing.T) {
+		now := time.Now()
+		bounded := New(server.URL)
+		bounded.SetCacheTTL(time.Minute)
+		bounded.SetCacheSize(1)
+		bounded.Now = func() time.Time {
+			return now
+		}
+
+		queries = 0
+		bounded.Authorize(user, "GET", "/posts")
+		bounded.Authorize(user, "DELETE", "/posts")
+		bounded.Authorize(user, "DELETE", "/posts")
+		if queries != 3 || len(bounded.decisions) != 1 {
+			t.Fatalf("decisions should not be cached while the cache is full: %d queries, %d decisions", queries, len(bounded.decisions))
+		}
+
+		now = now.Add(time.Minute)
+		bounded.Authorize(user, "DELETE", "/posts")
+		bounded.Authorize(user, "DELETE", "/posts")
+		if queries != 4 {
+			t.Fatalf("expired decisions should be purged once the cache is full: %d queries", queries)
+		}
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down", http.StatusInternalServerError)
+		}))
+		defer unavailable.Close()
+
+		closed := New(unavailable.URL)
+		err := closed.Authorize(user, "GET", "/posts")
+		if errors.Cause(err) != ErrUnavailable {
+			t.Fatalf("err should be ErrUnavailable because the authorizer fails closed: %v", err)
+		}
+
+		open := New(unavailable.URL)
+		open.SetFailOpen(true)
+		err = open.Authorize(user, "GET", "/posts")
+		if err != nil {
+			t.Fatalf("err should be nil because the authorizer fails open: %s", err)
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package gate
+
+import (
+	"strings"
+)
+
+// OwnModifier is the suffix of ability objects restricted to the objects owned by the user, e.g. "posts/*:own"
+const OwnModifier = ":own"
+
+// OwnershipResolver is the contract for resolving the ownership of objects, e.g. whether a user is the author of a post
+type OwnershipResolver interface {
+	Owns(user User, object string) bool
+}
+
+// IsOwned reports whether an ability is restricted to the objects owned by the user
+func IsOwned(ability UserAbility) bool {
+	return strings.HasSuffix(ability.GetObject(), OwnModifier)
+}
+
+// IsConditional reports whether an ability only grants under a condition checked at authorization time, i.e. it is owned, limited, sensitive or a template
+func IsConditional(ability UserAbility) bool {
+	_, limited := ability.(Limited)
+	return limited || IsOwned(ability) || RequiresStepUp(ability) || IsTemplate(ability)
+}
+
+func objectPattern(ability UserAbility) string {
+	return strings.TrimSuffix(ability.GetObject(), OwnModifier)
+}
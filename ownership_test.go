@@ -0,0 +1,27 @@
+package gate
+
+import (
+	"testing"
+)
+
+func TestOwnership(t *testing.T) {
+	owned := testAbility{"update", "posts/*:own"}
+	if !IsOwned(owned) || !IsConditional(owned) || IsOwned(testAbility{"update", "posts/*"}) {
+		t.Fatal("abilities with the own modifier should be owned")
+	}
+
+	matcher := NewMatcher()
+	matcher.SetObjectPaths(true)
+	if !matcher.MatchAbility("update", "posts/1", owned) {
+		t.Fatal("the own modifier should not be part of the pattern")
+	}
+
+	index := NewAbilityIndex([]UserAbility{owned, testAbility{"update", "posts/1:own"}}, matcher)
+	if index.Allows("update", "posts/1") {
+		t.Fatal("owned abilities should not grant by themselves")
+	}
+
+	if conditional := index.Conditional("update", "posts/1"); len(conditional) != 2 {
+		t.Fatalf("matching owned abilities should be returned: %v", conditional)
+	}
+}
@@ -0,0 +1,203 @@
+//go:build go1.13
+// +build go1.13
+
+package gate
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+const pasetoV4PublicHeader = "v4.public."
+
+// ErrMalformedPASETO is thrown when a token is not a valid PASETO v4.public token
+var ErrMalformedPASETO = errors.New("malformed PASETO")
+
+type pasetoClaims struct {
+	User       UserInfo         `json:"user"`
+	SingleUse  bool             `json:"single_use,omitempty"`
+	Actor      *Actor           `json:"act,omitempty"`
+	Abilities  []AbilityClaim   `json:"abilities,omitempty"`
+	ScopeChain [][]AbilityClaim `json:"scope_chain,omitempty"`
+	Audience   string           `json:"aud,omitempty"`
+	ExpiresAt  string           `json:"exp,omitempty"`
+	ID         string           `json:"jti,omitempty"`
+	IssuedAt   string           `json:"iat,omitempty"`
+	Issuer     string           `json:"iss,omitempty"`
+	NotBefore  string           `json:"nbf,omitempty"`
+	Subject    string           `json:"sub,omitempty"`
+}
+
+// PASETOV4PublicCodec is the TokenCodec of PASETO v4.public tokens (Ed25519 signatures).
+// Registered time claims are encoded as RFC 3339 strings as required by PASETO.
+// v4.local tokens are not supported since XChaCha20 and BLAKE2b are not part of the standard library
+type PASETOV4PublicCodec struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	footer     []byte
+}
+
+// NewPASETOV4PublicCodec is the constructor for PASETOV4PublicCodec. The private key may be nil for verification-only codecs
+func NewPASETOV4PublicCodec(privateKey ed25519.PrivateKey, publicKey ed25519.PublicKey) (codec PASETOV4PublicCodec, err error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		err = errors.New("invalid PASETO public key")
+		return
+	}
+
+	if privateKey != nil && len(privateKey) != ed25519.PrivateKeySize {
+		err = errors.New("invalid PASETO private key")
+		return
+	}
+
+	codec = PASETOV4PublicCodec{privateKey: privateKey, publicKey: publicKey}
+	return
+}
+
+// SetFooter is the setter for the unencrypted, authenticated footer, e.g. a key ID
+func (codec *PASETOV4PublicCodec) SetFooter(footer []byte) {
+	codec.footer = footer
+}
+
+// Encode signs the claims into a PASETO v4.public token
+func (codec PASETOV4PublicCodec) Encode(claims JWTClaims) (token string, err error) {
+	if codec.privateKey == nil {
+		err = errors.New("missing PASETO private key")
+		return
+	}
+
+	message, err := json.Marshal(pasetoClaims{
+		User:       claims.User,
+		SingleUse:  claims.SingleUse,
+		Actor:      claims.Actor,
+		Abilities:  claims.Abilities,
+		ScopeChain: claims.ScopeChain,
+		Audience:   claims.Audience,
+		ExpiresAt:  formatPASETOTime(claims.ExpiresAt),
+		ID:         claims.Id,
+		IssuedAt:   formatPASETOTime(claims.IssuedAt),
+		Issuer:     claims.Issuer,
+		NotBefore:  formatPASETOTime(claims.NotBefore),
+		Subject:    claims.Subject,
+	})
+	if err != nil {
+		return
+	}
+
+	signature := ed25519.Sign(codec.privateKey, pae([]byte(pasetoV4PublicHeader), message, codec.footer, nil))
+	token = pasetoV4PublicHeader + base64.RawURLEncoding.EncodeToString(append(message, signature...))
+	if len(codec.footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(codec.footer)
+	}
+	return
+}
+
+// Decode verifies a PASETO v4.public token and returns its claims
+func (codec PASETOV4PublicCodec) Decode(token string) (claims JWTClaims, err error) {
+	if !strings.HasPrefix(token, pasetoV4PublicHeader) {
+		err = ErrMalformedPASETO
+		return
+	}
+
+	segments := strings.Split(token[len(pasetoV4PublicHeader):], ".")
+	if len(segments) > 2 {
+		err = ErrMalformedPASETO
+		return
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(segments[0])
+	if err != nil || len(payload) < ed25519.SignatureSize {
+		err = ErrMalformedPASETO
+		return
+	}
+
+	var footer []byte
+	if len(segments) == 2 {
+		footer, err = base64.RawURLEncoding.DecodeString(segments[1])
+		if err != nil {
+			err = ErrMalformedPASETO
+			return
+		}
+	}
+
+	if !bytes.Equal(footer, codec.footer) {
+		err = errors.New("unexpected PASETO footer")
+		return
+	}
+
+	message, signature := payload[:len(payload)-ed25519.SignatureSize], payload[len(payload)-ed25519.SignatureSize:]
+	if !ed25519.Verify(codec.publicKey, pae([]byte(pasetoV4PublicHeader), message, footer, nil), signature) {
+		err = errors.New("invalid PASETO signature")
+		return
+	}
+
+	var decoded pasetoClaims
+	err = json.Unmarshal(message, &decoded)
+	if err != nil {
+		err = errors.Wrap(err, "invalid PASETO claims")
+		return
+	}
+
+	claims = JWTClaims{User: decoded.User, SingleUse: decoded.SingleUse, Actor: decoded.Actor, Abilities: decoded.Abilities, ScopeChain: decoded.ScopeChain}
+	claims.StandardClaims = jwt.StandardClaims{Audience: decoded.Audience, Id: decoded.ID, Issuer: decoded.Issuer, Subject: decoded.Subject}
+	for _, field := range []struct {
+		value  string
+		target *int64
+	}{
+		{decoded.ExpiresAt, &claims.ExpiresAt},
+		{decoded.IssuedAt, &claims.IssuedAt},
+		{decoded.NotBefore, &claims.NotBefore},
+	} {
+		*field.target, err = parsePASETOTime(field.value)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func formatPASETOTime(unix int64) string {
+	if unix == 0 {
+		return ""
+	}
+
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
+
+func parsePASETOTime(value string) (unix int64, err error) {
+	if value == "" {
+		return
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		err = errors.Wrap(err, "invalid PASETO time claim")
+		return
+	}
+
+	unix = parsed.Unix()
+	return
+}
+
+// pae is the pre-authentication encoding of PASETO
+func pae(pieces ...[]byte) []byte {
+	var buffer bytes.Buffer
+	length := make([]byte, 8)
+
+	binary.LittleEndian.PutUint64(length, uint64(len(pieces)))
+	buffer.Write(length)
+	for _, piece := range pieces {
+		binary.LittleEndian.PutUint64(length, uint64(len(piece)))
+		buffer.Write(length)
+		buffer.Write(piece)
+	}
+
+	return buffer.Bytes()
+}
@@ -0,0 +1,145 @@
+//go:build go1.13
+// +build go1.13
+
+package gate
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPASETOV4PublicCodec(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec, err := NewPASETOV4PublicCodec(private, public)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid keys: %s", err)
+	}
+
+	config, err := NewCodecJWTConfig(codec, time.Hour, false)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid codec: %s", err)
+	}
+
+	service := NewJWTService(config)
+	user := testUser{ID: "1", Username: "alice", Roles: []string{"editor"}}
+
+	t.Run("issue and parse", func(t *testing.T) {
+		token, err := service.Issue(service.NewClaims(user))
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid claims: %s", err)
+		}
+
+		if !strings.HasPrefix(token.Value, "v4.public.") {
+			t.Fatalf("token should be a PASETO v4.public token: %s", token.Value)
+		}
+
+		parsed, err := service.Parse(token.Value)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid token: %s", err)
+		}
+
+		if parsed.ID != token.ID || parsed.UserID != "1" || !parsed.ExpiredAt.Equal(token.ExpiredAt) {
+			t.Fatalf("parsed token should match the issued token: %v %v", parsed, token)
+		}
+	})
+
+	t.Run("tampered token", func(t *testing.T) {
+		token, err := service.Issue(service.NewClaims(user))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payload := []byte(token.Value)
+		index := len("v4.public.")
+		if payload[index] == 'A' {
+			payload[index] = 'B'
+		} else {
+			payload[index] = 'A'
+		}
+
+		_, err = service.Parse(string(payload))
+		if err == nil {
+			t.Fatal("err should not be nil because of the invalid signature")
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		claims := service.NewClaims(user)
+		claims.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+		token, err := service.Issue(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = service.Parse(token.Value)
+		if err == nil {
+			t.Fatal("err should not be nil because of the expired token")
+		}
+	})
+
+	t.Run("footer", func(t *testing.T) {
+		withFooter := codec
+		withFooter.SetFooter([]byte(`{"kid":"1"}`))
+
+		str, err := withFooter.Encode(service.NewClaims(user))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = withFooter.Decode(str)
+		if err != nil {
+			t.Fatalf("err should be nil because of the matching footer: %s", err)
+		}
+
+		_, err = codec.Decode(str)
+		if err == nil {
+			t.Fatal("err should not be nil because of the unexpected footer")
+		}
+	})
+
+	t.Run("other formats", func(t *testing.T) {
+		_, err := codec.Decode("v4.local.AAAA")
+		if err != ErrMalformedPASETO {
+			t.Fatalf("err should be ErrMalformedPASETO because of the unsupported purpose: %v", err)
+		}
+	})
+
+	t.Run("config", func(t *testing.T) {
+		cfg := NewConfig("", "", time.Hour, false)
+		cfg.SetTokenCodec(codec)
+
+		jwtConfig, err := NewJWTConfigWithConfig("HS256", cfg)
+		if err != nil {
+			t.Fatalf("err should be nil because the codec replaces the signing key: %s", err)
+		}
+
+		token, err := NewJWTService(jwtConfig).Issue(service.NewClaims(user))
+		if err != nil || !strings.HasPrefix(token.Value, "v4.public.") {
+			t.Fatalf("token should be issued by the codec: %v %v", token, err)
+		}
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		_, err := NewPASETOV4PublicCodec(nil, public[:16])
+		if err == nil {
+			t.Fatal("err should not be nil because of the invalid public key")
+		}
+
+		verifier, err := NewPASETOV4PublicCodec(nil, public)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = verifier.Encode(service.NewClaims(user))
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing private key")
+		}
+	})
+}
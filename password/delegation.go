@@ -0,0 +1,165 @@
+package password
+
+import (
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// IssueScopedJWT issues and stores a JWT for a specific user which is restricted to the given abilities, e.g. for sharing links or third-party integrations.
+// The abilities must be valid scopes, see gate.ValidateScope, granted by the user's abilities and, for users of scoped or delegated tokens,
+// by the scopes of their token, which keep restricting the issued token, so tokens are never widened.
+// The token expires after the given TTL, or the configured expiration if the TTL is not positive
+func (auth Driver) IssueScopedJWT(user gate.User, scopes []gate.AbilityCheck, ttl time.Duration) (token gate.JWT, err error) {
+	abilities := make([]gate.UserAbility, 0, len(scopes))
+	for _, scope := range scopes {
+		abilities = append(abilities, scope)
+	}
+
+	var actor *gate.Actor
+	chain := scopeChain(user)
+	if delegated, ok := user.(gate.DelegatedUser); ok {
+		user = delegated.User
+		actor = delegated.Actor
+	}
+
+	claims, err := auth.newScopedClaims(user, chain, abilities, ttl)
+	if err != nil {
+		return
+	}
+
+	claims.Actor = actor
+	return auth.issueJWT(claims)
+}
+
+// ExchangeJWT exchanges a user's token for a derived token on behalf of the user, e.g. for calling another service.
+// The derived token is restricted to the given abilities, which must be valid scopes, see gate.ValidateScope, granted by the user's abilities
+// and by the scopes of the original token. The scopes of the original token keep restricting the derived token.
+// The actor is recorded in the act claim on top of the delegation chain of the original token.
+// The derived token expires after the given TTL, never later than the original token
+func (auth Driver) ExchangeJWT(tokenString, actor string, abilities []gate.UserAbility, ttl time.Duration) (token gate.JWT, err error) {
+	if actor == "" {
+		err = errors.New("invalid actor")
+		return
+	}
+
+	subject, user, err := auth.authenticate(tokenString)
+	if err != nil {
+		return
+	}
+
+	chain := scopeChain(user)
+	if delegated, ok := user.(gate.DelegatedUser); ok {
+		user = delegated.User
+	}
+
+	claims, err := auth.newScopedClaims(user, chain, abilities, ttl)
+	if err != nil {
+		return
+	}
+
+	if claims.ExpiresAt > subject.ExpiredAt.Unix() {
+		claims.ExpiresAt = subject.ExpiredAt.Unix()
+	}
+
+	claims.Actor = &gate.Actor{Subject: actor, Actor: subject.Actor}
+	return auth.issueJWT(claims)
+}
+
+// newScopedClaims generates the claims of a token restricted to the given abilities after checking them against the user's abilities
+// and the scope chain of the original token, which is kept by the claims
+func (auth Driver) newScopedClaims(user gate.User, chain [][]gate.UserAbility, abilities []gate.UserAbility, ttl time.Duration) (claims gate.JWTClaims, err error) {
+	if len(abilities) == 0 {
+		err = errors.New("missing abilities")
+		return
+	}
+
+	index, err := auth.getUserAbilityIndex(user)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the abilities")
+		return
+	}
+
+	for _, ability := range abilities {
+		err = gate.ValidateScope(ability)
+		if err != nil {
+			return
+		}
+
+		action, object := ability.GetAction(), ability.GetObject()
+		if !auth.chainAllows(chain, action, object) {
+			err = errors.Wrapf(ErrForbidden, "the original token is not allowed to %s %s", action, object)
+			return
+		}
+
+		if !index.Allows(action, object) && len(index.Conditional(action, object)) == 0 {
+			err = errors.Wrapf(ErrForbidden, "the user is not allowed to %s %s", action, object)
+			return
+		}
+	}
+
+	service, err := auth.JWTService()
+	if err != nil {
+		return
+	}
+
+	claims = service.NewClaims(user)
+	if ttl > 0 {
+		claims.ExpiresAt = service.Now().Add(ttl).Unix()
+	}
+
+	claims.Abilities = gate.NewAbilityClaims(abilities)
+	for _, scopes := range chain {
+		claims.ScopeChain = append(claims.ScopeChain, gate.NewAbilityClaims(scopes))
+	}
+	return
+}
+
+// scopeChain returns the scopes of the token of a scoped user followed by the scopes of the tokens it is derived from, if any
+func scopeChain(user gate.User) (chain [][]gate.UserAbility) {
+	scoped, ok := user.(gate.Scoped)
+	if !ok {
+		return
+	}
+
+	if scopes := scoped.GetScopes(); len(scopes) > 0 {
+		chain = append(chain, scopes)
+	}
+
+	if chained, ok := user.(gate.ScopeChained); ok {
+		chain = append(chain, chained.GetScopeChain()...)
+	}
+	return
+}
+
+// chainAllows reports whether the scopes of every token of a scope chain allow an action on an object
+func (auth Driver) chainAllows(chain [][]gate.UserAbility, action, object string) bool {
+	for _, scopes := range chain {
+		if !auth.scopesAllow(scopes, action, object) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// scopesAllow reports whether the scopes of a token allow an action on an object. Tokens without scopes are not restricted
+func (auth Driver) scopesAllow(scopes []gate.UserAbility, action, object string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+
+	matcher, err := auth.Matcher()
+	if err != nil {
+		return false
+	}
+
+	for _, scope := range scopes {
+		if matcher.MatchAbility(action, object, scope) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,44 @@
+package password
+
+import (
+	"github.com/hiendv/gate"
+)
+
+// PermittedFields returns the fields of a resource type on which a user is granted an action, see gate.AbilityIndex.PermittedFields.
+// The scopes of delegated users and of the tokens their token is derived from narrow the fields.
+// With an external authorizer, only the candidate fields are checked by the authorizer
+func (auth Driver) PermittedFields(user gate.User, action, resource string, fields ...string) (set gate.FieldSet, err error) {
+	chain := scopeChain(user)
+	if delegated, ok := user.(gate.DelegatedUser); ok {
+		user = delegated.User
+	}
+
+	matcher, err := auth.Matcher()
+	if err != nil {
+		return
+	}
+
+	if auth.dependencies != nil && auth.dependencies.Authorizer() != nil {
+		permitted := []string{}
+		for _, field := range fields {
+			if auth.dependencies.Authorizer().Authorize(user, action, resource+gate.FieldSeparator+field) == nil {
+				permitted = append(permitted, field)
+			}
+		}
+
+		set = gate.NewFieldSet(permitted...)
+	} else {
+		var index gate.AbilityIndex
+		index, err = auth.getUserAbilityIndex(user)
+		if err != nil {
+			return
+		}
+
+		set = index.PermittedFields(action, resource, fields...)
+	}
+
+	for _, scopes := range chain {
+		set = set.Intersect(gate.NewAbilityIndex(scopes, matcher).PermittedFields(action, resource, fields...))
+	}
+	return
+}
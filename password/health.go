@@ -0,0 +1,41 @@
+package password
+
+import (
+	"context"
+
+	"github.com/hiendv/gate"
+)
+
+// HealthCheck pings the user, role and token services and reports the status of each of them.
+// Missing services are unhealthy, services without a Pinger are assumed to be healthy
+func (auth Driver) HealthCheck(ctx context.Context) (report gate.HealthReport) {
+	report.Healthy = true
+
+	userService, userErr := auth.UserService()
+	roleService, roleErr := auth.RoleService()
+	tokenService, tokenErr := auth.TokenService()
+	checks := []struct {
+		name    string
+		service interface{}
+		err     error
+	}{
+		{"user", userService, userErr},
+		{"role", roleService, roleErr},
+		{"token", tokenService, tokenErr},
+	}
+
+	for _, check := range checks {
+		status := gate.DependencyStatus{Name: check.name, Err: check.err}
+		if check.err == nil {
+			status = gate.Ping(ctx, check.name, check.service)
+		}
+
+		if !status.Healthy {
+			report.Healthy = false
+			auth.log(gate.LogLevelWarn, "unhealthy service", "service", check.name, "error", status.Err)
+		}
+
+		report.Dependencies = append(report.Dependencies, status)
+	}
+	return
+}
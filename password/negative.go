@@ -0,0 +1,32 @@
+package password
+
+import (
+	"github.com/hiendv/gate"
+)
+
+// negativeCache returns the negative cache of the dependencies, a disabled one without dependencies
+func (auth Driver) negativeCache() (cache gate.NegativeCache) {
+	if auth.dependencies == nil {
+		return
+	}
+
+	return auth.dependencies.NegativeCache()
+}
+
+// parseJWTRemembered parses a token string unless its failure is remembered by the negative cache.
+// Failures of opaque tokens depend on the token service, hence they are not remembered
+func (auth Driver) parseJWTRemembered(tokenString string) (token gate.JWT, err error) {
+	cache := auth.negativeCache()
+	key := gate.NegativeTokenKey(tokenString)
+	if cached, ok := cache.Get(key); ok {
+		auth.log(gate.LogLevelDebug, "negative cache hit", "lookup", "token")
+		err = cached
+		return
+	}
+
+	token, err = auth.ParseJWT(tokenString)
+	if err != nil && !auth.config.OpaqueTokens() {
+		cache.Set(key, err)
+	}
+	return
+}
@@ -1,36 +1,158 @@
 package password
 
 import (
+	"strings"
+	"time"
+
 	"github.com/hiendv/gate"
 	"github.com/pkg/errors"
 )
 
 // ErrForbidden is thrown when an user is forbidden to take an action on an object
-var ErrForbidden = errors.New("forbidden")
+var ErrForbidden = gate.ErrForbidden
 
 // ErrNoAbilities is thrown when an user has no abilities
-var ErrNoAbilities = errors.New("there is no abilities")
+var ErrNoAbilities = gate.ErrNoAbilities
+
+// ErrTokenConsumed is thrown when a single-use token is presented again
+var ErrTokenConsumed = gate.ErrTokenConsumed
+
+// ErrTokenRevoked is thrown when a token has been revoked from the token manager
+var ErrTokenRevoked = gate.ErrTokenRevoked
+
+// ErrMFARequired is thrown when the anomaly detector demands a multi-factor step-up on login
+var ErrMFARequired = gate.ErrMFARequired
+
+// ErrQuotaExceeded is thrown when an action is only granted by limited abilities whose quotas are exhausted
+var ErrQuotaExceeded = gate.ErrQuotaExceeded
+
+// ErrRoleServiceUnavailable is thrown when the role service fails or its circuit breaker is open
+var ErrRoleServiceUnavailable = gate.ErrRoleServiceUnavailable
+
+// ErrSessionLimitExceeded is thrown when a user has reached the maximum number of active sessions and new sessions are rejected
+var ErrSessionLimitExceeded = gate.ErrSessionLimitExceeded
+
+// ErrStepUpRequired is thrown when an action is only granted by sensitive abilities and the request is risky
+var ErrStepUpRequired = gate.ErrStepUpRequired
+
+// ErrChallengeRequired is thrown when a login is risky and no challenge response is given
+var ErrChallengeRequired = gate.ErrChallengeRequired
+
+// ErrChallengeFailed is thrown when the challenge response of a risky login is rejected
+var ErrChallengeFailed = gate.ErrChallengeFailed
+
+// Requirements returns the services the driver needs with the configuration for the whole login, issuance, authentication and authorization flow,
+// i.e. the token service, the authorization backend or the role service, and the user service unless the authentication is stateless
+func Requirements(config gate.Config) []gate.Requirement {
+	requirements := []gate.Requirement{gate.RequireTokenService, gate.RequireAuthorization}
+	if !config.StatelessAuthentication() {
+		requirements = append(requirements, gate.RequireUserService)
+	}
+
+	return requirements
+}
 
 // LoginFunc is the handler of password-based authentication
 type LoginFunc func(username, password string) (gate.User, error)
 
+// CredentialsLoginFunc is the handler of password-based authentication using typed credentials, e.g. with a tenant or a remember-me flag
+type CredentialsLoginFunc func(gate.Credentials) (gate.User, error)
+
 // Driver is password-based authentication
 type Driver struct {
-	config       gate.Config
-	dependencies *gate.Dependencies
-	handler      LoginFunc
+	config             gate.Config
+	dependencies       *gate.Dependencies
+	handler            LoginFunc
+	credentialsHandler CredentialsLoginFunc
+	dryRun             bool
+	Now                func() time.Time
 }
 
-// New is the constructor for Driver
-func New(config gate.Config, dependencies *gate.Dependencies, handler LoginFunc) *Driver {
-	jwtConfig, err := gate.NewHMACJWTConfig("HS256", config.JWTSigningKey(), config.JWTExpiration(), config.JWTSkipClaimsValidation())
+// New is the constructor for Driver. It validates the configuration and the dependencies, against Requirements, up front
+func New(config gate.Config, dependencies *gate.Dependencies, handler LoginFunc) (*Driver, error) {
+	if dependencies == nil {
+		return nil, errors.New("invalid dependencies")
+	}
+
+	if err := dependencies.Validate(Requirements(config)...); err != nil {
+		return nil, err
+	}
+
+	if config.JWTExpiration() < 0 {
+		return nil, errors.New("invalid JWT expiration")
+	}
+
+	if config.StatelessAuthentication() && config.OpaqueTokens() {
+		return nil, errors.New("stateless authentication requires self-contained tokens")
+	}
+
+	if max, _ := config.MaxSessions(); max > 0 {
+		if _, ok := dependencies.TokenService().(gate.SessionStore); !ok {
+			return nil, errors.New("session limits require a session store")
+		}
+	}
+
+	jwtConfig, err := gate.NewJWTConfigWithConfig("HS256", config)
 	if err != nil {
-		return nil
+		return nil, errors.Wrap(err, "invalid JWT configuration")
 	}
 
+	jwtConfig.SetIDGenerator(dependencies.IDGenerator())
 	dependencies.SetJWTService(gate.NewJWTService(jwtConfig))
-	dependencies.SetMatcher(gate.NewMatcher())
-	return &Driver{config, dependencies, handler}
+	return newDriver(config, dependencies, handler)
+}
+
+// newDriver sets the authorization services of the dependencies up and starts their background workers
+func newDriver(config gate.Config, dependencies *gate.Dependencies, handler LoginFunc) (*Driver, error) {
+	dependencies.SetMatcher(gate.NewMatcherWithConfig(config))
+	dependencies.SetAbilityCache(gate.NewAbilityCache(config.AbilityCacheTTL(), 0))
+	dependencies.SetDecisionCache(gate.NewDecisionCache(config.DecisionCacheTTL(), 0))
+	dependencies.SetNegativeCache(gate.NewNegativeCache(config.NegativeCacheTTL(), 0))
+	dependencies.SetRoleCircuitBreaker(gate.NewCircuitBreaker(config.RoleCircuitBreaker()))
+	dependencies.ApplyClock()
+	startTokenWriteBehind(config, dependencies)
+	startTokenJanitor(config, dependencies)
+	if err := startInvalidationListener(dependencies); err != nil {
+		return nil, err
+	}
+
+	return &Driver{config, dependencies, handler, nil, false, dependencies.Clock().Now}, nil
+}
+
+// NewAuthorizer is the constructor for a Driver used for the authorization only, e.g. by the drivers authenticating users otherwise,
+// like client certificates or Kerberos, so their users are authorized with the validity windows, the schedules, the permission sets,
+// the conditional abilities, the scopes and the caches alike. It requires either the authorization backend or the role service of the dependencies.
+// Neither logins nor tokens are supported by the driver
+func NewAuthorizer(config gate.Config, dependencies *gate.Dependencies) (*Driver, error) {
+	if dependencies == nil {
+		return nil, errors.New("invalid dependencies")
+	}
+
+	if err := dependencies.Validate(gate.RequireAuthorization); err != nil {
+		return nil, err
+	}
+
+	return newDriver(config, dependencies, nil)
+}
+
+// Close stops the background workers of the dependencies, e.g. on shutdown. The tokens queued by the write-behind queue are stored,
+// the ones stored afterwards are stored synchronously. Closing a closed driver has no effect
+func (auth Driver) Close() {
+	auth.dependencies.TokenWriteBehind().Close()
+	auth.dependencies.TokenJanitor().Stop()
+	auth.dependencies.InvalidationListener().Stop()
+}
+
+// log writes an entry with the logger of the dependencies
+func (auth Driver) log(level gate.LogLevel, msg string, keysAndValues ...interface{}) {
+	if auth.dependencies == nil {
+		return
+	}
+
+	logger := auth.dependencies.Logger()
+	if logger.Enabled(level) {
+		logger.Log(level, msg, keysAndValues...)
+	}
 }
 
 // GetConfig returns authentication configuration
@@ -45,6 +167,7 @@ func (auth Driver) UserService() (gate.UserService, error) {
 	}
 
 	if auth.dependencies.UserService() == nil {
+		auth.log(gate.LogLevelWarn, "missing service", "service", "user")
 		return nil, errors.New("invalid user service")
 	}
 
@@ -58,6 +181,7 @@ func (auth Driver) RoleService() (gate.RoleService, error) {
 	}
 
 	if auth.dependencies.RoleService() == nil {
+		auth.log(gate.LogLevelWarn, "missing service", "service", "role")
 		return nil, errors.New("invalid role service")
 	}
 
@@ -71,6 +195,7 @@ func (auth Driver) TokenService() (gate.TokenService, error) {
 	}
 
 	if auth.dependencies.TokenService() == nil {
+		auth.log(gate.LogLevelWarn, "missing service", "service", "token")
 		return nil, errors.New("invalid token service")
 	}
 
@@ -95,23 +220,126 @@ func (auth Driver) Matcher() (gate.Matcher, error) {
 	return auth.dependencies.Matcher(), nil
 }
 
-// Login resolves password-based authentication with the given handler and credentials
-func (auth Driver) Login(credentials map[string]string) (user gate.User, err error) {
-	username, ok := credentials["username"]
-	if !ok {
-		err = errors.New("missing username")
+// AbilityCache returns AbilityCache instance from the dependencies or throws an error if the instance is invalid
+func (auth Driver) AbilityCache() (gate.AbilityCache, error) {
+	if auth.dependencies == nil {
+		return gate.AbilityCache{}, errors.New("invalid dependencies")
+	}
+
+	return auth.dependencies.AbilityCache(), nil
+}
+
+// DecisionCache returns DecisionCache instance from the dependencies or throws an error if the instance is invalid
+func (auth Driver) DecisionCache() (gate.DecisionCache, error) {
+	if auth.dependencies == nil {
+		return gate.DecisionCache{}, errors.New("invalid dependencies")
+	}
+
+	return auth.dependencies.DecisionCache(), nil
+}
+
+// Login resolves password-based authentication with the given handler and credentials, which are parsed with the credential spec.
+// Credentials other than the username, the password and secret fields are the source metadata of the attempt, e.g. "ip".
+// Risky logins are challenged before the credentials are checked when a challenge verifier is set.
+// When the anomaly detector demands MFA, the user is returned along with ErrMFARequired so a step-up can be started
+func (auth Driver) Login(values map[string]string) (user gate.User, err error) {
+	defer auth.redact(&err, gate.ErrLoginFailed)
+
+	startedAt := time.Now()
+	spec := auth.config.CredentialSpec()
+	source := spec.Source(values)
+	delete(source, auth.config.ChallengeField())
+	attempt := gate.LoginAttempt{
+		UsernameHash: gate.HashUsername(spec.Username(values)),
+		Source:       source,
+		At:           auth.Now(),
+	}
+
+	credentials, err := spec.Parse(values)
+	if err != nil {
+		err = gate.NewAuthenticationError(err)
+	} else {
+		err = auth.challenge(attempt, values[auth.config.ChallengeField()])
+	}
+
+	if err == nil {
+		user, err = auth.login(credentials)
+	}
+
+	if auth.dependencies == nil {
 		return
 	}
 
-	password, ok := credentials["password"]
-	if !ok {
-		err = errors.New("missing password")
+	attempt.Succeeded = err == nil
+	attempt.Err = err
+	attempt.Latency = time.Since(startedAt)
+
+	if detector := auth.dependencies.AnomalyDetector(); detector != nil {
+		detected := detector.Detect(attempt)
+		if attempt.Succeeded && detected != nil {
+			err = detected
+			attempt.Succeeded = false
+			attempt.Err = detected
+			if errors.Cause(detected) != ErrMFARequired {
+				user = nil
+			}
+		}
+	}
+
+	for _, hook := range auth.dependencies.LoginHooks() {
+		hook(attempt)
+	}
+	return
+}
+
+// challenge verifies the challenge response of an attempt when a challenge trigger reports a risk
+func (auth Driver) challenge(attempt gate.LoginAttempt, response string) (err error) {
+	if auth.dependencies == nil || auth.dependencies.ChallengeVerifier() == nil {
+		return
+	}
+
+	risky := false
+	for _, trigger := range auth.dependencies.ChallengeTriggers() {
+		if trigger.RequiresChallenge(attempt) {
+			risky = true
+			break
+		}
+	}
+
+	if !risky {
+		return
+	}
+
+	if response == "" {
+		err = ErrChallengeRequired
+		return
+	}
+
+	err = auth.dependencies.ChallengeVerifier().Verify(response, attempt)
+	if err != nil {
+		err = errors.WithMessage(ErrChallengeFailed, err.Error())
+	}
+	return
+}
+
+// SetCredentialsHandler is the setter for the handler of typed credentials. When set, it is used in place of the username-password handler
+func (auth *Driver) SetCredentialsHandler(handler CredentialsLoginFunc) {
+	auth.credentialsHandler = handler
+}
+
+func (auth Driver) login(credentials gate.Credentials) (user gate.User, err error) {
+	switch {
+	case auth.credentialsHandler != nil:
+		user, err = auth.credentialsHandler(credentials)
+	case auth.handler != nil:
+		user, err = auth.handler(credentials.Username, credentials.Password)
+	default:
+		err = errors.New("invalid login handler")
 		return
 	}
 
-	user, err = auth.handler(username, password)
 	if err != nil {
-		err = errors.Wrap(err, "could not login")
+		err = gate.NewAuthenticationError(errors.Wrap(err, "could not login"))
 	}
 	return
 }
@@ -123,28 +351,71 @@ func (auth Driver) IssueJWT(user gate.User) (token gate.JWT, err error) {
 		return
 	}
 
-	claims := service.NewClaims(user)
-	token, err = service.Issue(claims)
+	return auth.issueJWT(service.NewClaims(user))
+}
+
+// IssueSingleUseJWT issues and stores a JWT for a specific user which is consumed by the first successful authentication.
+// The token service must implement gate.TokenConsumer
+func (auth Driver) IssueSingleUseJWT(user gate.User) (token gate.JWT, err error) {
+	service, err := auth.JWTService()
 	if err != nil {
-		err = errors.Wrap(err, "could not issue JWT")
 		return
 	}
 
-	err = auth.StoreJWT(token)
+	_, err = auth.tokenConsumer()
 	if err != nil {
-		err = errors.Wrap(err, "could not store JWT")
+		return
+	}
+
+	claims := service.NewClaims(user)
+	claims.SingleUse = true
+	return auth.issueJWT(claims)
+}
+
+func (auth Driver) issueJWT(claims gate.JWTClaims) (token gate.JWT, err error) {
+	service, err := auth.JWTService()
+	if err != nil {
+		return
+	}
+
+	if auth.config.OpaqueTokens() {
+		claims.Id = opaqueTokenGenerator()
+		token = service.NewTokenFromClaims(claims)
+		token.Value = claims.Id
+	} else {
+		token, err = service.Issue(claims)
+		if err != nil {
+			err = errors.Wrap(err, "could not issue JWT")
+			return
+		}
 	}
+
+	if max, policy := auth.config.MaxSessions(); max > 0 && isSession(claims) {
+		err = auth.storeSession(token, max, policy)
+		if err != nil {
+			return
+		}
+	} else {
+		err = auth.StoreJWT(token)
+		if err != nil {
+			err = errors.Wrap(err, "could not store JWT")
+			return
+		}
+	}
+
+	auth.negativeCache().Invalidate(gate.NegativeUserKey(token.UserID))
 	return
 }
 
-// StoreJWT stores a JWT using the given token service
+// StoreJWT stores a JWT using the given token service. Storage failures are handled according to the token storage policy,
+// i.e. the issuance fails, succeeds anyway, retries or queues the token to be stored asynchronously
 func (auth Driver) StoreJWT(token gate.JWT) (err error) {
 	service, err := auth.TokenService()
 	if err != nil {
 		return
 	}
 
-	return service.Store(token)
+	return auth.storeJWT(service, token)
 }
 
 // ParseJWT parses a JWT string to a JWT
@@ -154,66 +425,634 @@ func (auth Driver) ParseJWT(tokenString string) (token gate.JWT, err error) {
 		return
 	}
 
-	token, err = service.Parse(tokenString)
+	if auth.config.OpaqueTokens() {
+		token, err = auth.resolveOpaqueToken(service, tokenString)
+	} else {
+		token, err = service.Parse(tokenString)
+	}
+
 	if err != nil {
+		auth.log(gate.LogLevelDebug, "could not parse the token", "reason", errors.Cause(err).Error())
 		err = errors.Wrap(err, "could not parse token")
 	}
 
 	return
 }
 
-// Authenticate performs the authentication using JWT
+// opaqueTokenGenerator generates opaque tokens with 256 bits of entropy regardless of the claims ID generator
+var opaqueTokenGenerator = gate.HexGenerator(32)
+
+// resolveOpaqueToken looks an opaque token up in the token service and checks its expiration
+func (auth Driver) resolveOpaqueToken(service gate.JWTService, tokenString string) (token gate.JWT, err error) {
+	tokenService, err := auth.TokenService()
+	if err != nil {
+		return
+	}
+
+	maxLength := auth.config.JWTMaxLength()
+	if tokenString == "" || (maxLength > 0 && len(tokenString) > maxLength) {
+		err = errors.New("malformed opaque token")
+		return
+	}
+
+	token, err = tokenService.FindOneByID(tokenString)
+	if err != nil {
+		err = errors.Wrap(err, "could not find the opaque token")
+		return
+	}
+
+	if token.ID != tokenString {
+		err = errors.New("could not find the opaque token")
+		return
+	}
+
+	if !auth.config.JWTSkipClaimsValidation() && !service.Now().Before(token.ExpiredAt) {
+		err = errors.New("token is expired")
+		return
+	}
+
+	token.Value = tokenString
+	return
+}
+
+// Authenticate performs the authentication using JWT.
+// Users are found by the ID claim with the user service, hence information omitted by the claims projection is looked up,
+// unless the authentication is stateless and users are built from the claims.
+// Users of delegated or down-scoped tokens are returned as gate.DelegatedUser
 func (auth Driver) Authenticate(tokenString string) (user gate.User, err error) {
-	token, err := auth.ParseJWT(tokenString)
+	defer auth.redact(&err, gate.ErrAuthenticationFailed)
+
+	_, user, err = auth.authenticate(tokenString)
+	return
+}
+
+func (auth Driver) authenticate(tokenString string) (token gate.JWT, user gate.User, err error) {
+	token, err = auth.parseJWTRemembered(tokenString)
+	if err != nil {
+		err = gate.NewAuthenticationError(errors.Wrap(err, "could not parse the token"))
+		return
+	}
+
+	err = auth.checkRevocation(token)
+	if err != nil {
+		return
+	}
+
+	if token.SingleUse {
+		err = auth.consumeJWT(token)
+		if err != nil {
+			return
+		}
+	}
+
+	if auth.config.StatelessAuthentication() {
+		user = gate.ClaimsUser(token.User)
+	} else {
+		user, err = auth.GetUserFromJWT(token)
+		if err != nil {
+			err = errors.Wrap(err, "could not get the user")
+			return
+		}
+	}
+
+	if token.Actor != nil || len(token.Abilities) > 0 {
+		user = gate.DelegatedUser{User: user, Actor: token.Actor, Abilities: token.Abilities, ScopeChain: token.ScopeChain}
+	}
+	return
+}
+
+func (auth Driver) tokenConsumer() (consumer gate.TokenConsumer, err error) {
+	service, err := auth.TokenService()
+	if err != nil {
+		return
+	}
+
+	consumer, ok := service.(gate.TokenConsumer)
+	if !ok {
+		err = errors.New("token service does not support single-use tokens")
+	}
+	return
+}
+
+func (auth Driver) consumeJWT(token gate.JWT) (err error) {
+	consumer, err := auth.tokenConsumer()
 	if err != nil {
-		err = errors.Wrap(err, "could not parse the token")
 		return
 	}
 
-	user, err = auth.GetUserFromJWT(token)
+	err = consumer.Consume(token.ID)
+	if errors.Cause(err) == gate.ErrTokenNotFound {
+		err = ErrTokenConsumed
+		return
+	}
+
 	if err != nil {
-		err = errors.Wrap(err, "could not get the user")
+		err = errors.Wrap(err, "could not consume the token")
 	}
 	return
 }
 
-// Authorize performs the authorization when a given user takes an action on an object using RBAC
+// Authorize performs the authorization when a given user takes an action on an object using RBAC,
+// or delegates it to the authorization backend of the dependencies if any. Decisions are memoized by the decision cache.
+// The shadow authorizer of the dependencies, if any, evaluates the authorization asynchronously without affecting the decision
+// when audit hooks are registered, dropping the evaluation when too many are running already
 func (auth Driver) Authorize(user gate.User, action, object string) (err error) {
-	abilities, err := auth.GetUserAbilities(user)
+	return auth.authorizeIn(nil, user, action, object)
+}
+
+// AuthorizeWithAttributes performs the authorization like Authorize, resolving the placeholders of template abilities with the attributes,
+// e.g. {"project_id": "42"} for the ability object "projects:{project_id}"
+func (auth Driver) AuthorizeWithAttributes(user gate.User, action, object string, attributes gate.Attributes) (err error) {
+	ctx := gate.NewAuthzContext(user, gate.JWT{}, "")
+	ctx.Attributes = attributes
+	return auth.authorizeIn(ctx, user, action, object)
+}
+
+// NewAuthzContext authenticates a JWT string and returns the authorization context of a request
+func (auth Driver) NewAuthzContext(tokenString, tenant string) (ctx *gate.AuthzContext, err error) {
+	defer auth.redact(&err, gate.ErrAuthenticationFailed)
+
+	token, user, err := auth.authenticate(tokenString)
+	if err != nil {
+		return
+	}
+
+	ctx = gate.NewAuthzContext(user, token, tenant)
+	return
+}
+
+// AuthorizeContext performs the authorization of the user of an authorization context like Authorize.
+// The abilities are resolved once and kept by the context for the following authorizations of the request
+func (auth Driver) AuthorizeContext(ctx *gate.AuthzContext, action, object string) error {
+	return auth.authorizeIn(ctx, ctx.User, action, object)
+}
+
+// SimulateAuthorize makes the authorization decision of Authorize without its side effects, e.g. for admin tools.
+// Decisions are neither read from nor written to the decision cache, the shadow authorizer is not evaluated and quotas are not consumed,
+// i.e. they are checked with the counter store if it is a gate.CounterReader, or assumed available otherwise
+func (auth Driver) SimulateAuthorize(user gate.User, action, object string) error {
+	auth.dryRun = true
+	return auth.authorizeIn(nil, user, action, object)
+}
+
+func (auth Driver) authorizeIn(ctx *gate.AuthzContext, user gate.User, action, object string) (err error) {
+	defer auth.redact(&err, gate.ErrAuthorizationFailed)
+
+	if auth.dependencies != nil && auth.dependencies.ShadowAuthorizer() != nil && len(auth.dependencies.AuditHooks()) > 0 && !auth.dryRun {
+		shadow := auth.dependencies.ShadowAuthorizer()
+		defer func() {
+			decision := err
+			auth.dependencies.EvaluateShadow(func() {
+				auth.evaluateShadow(shadow, user, action, object, decision)
+			})
+		}()
+	}
+
+	cache, err := auth.DecisionCache()
+	if err != nil {
+		return
+	}
+
+	if auth.dryRun {
+		cache = gate.DecisionCache{}
+	}
+
+	var tenant string
+	if ctx != nil {
+		tenant = ctx.Tenant
+	}
+
+	if decision, ok := cache.GetInTenant(tenant, user, action, object); ok {
+		return decision
+	}
+
+	conditional, until, err := auth.authorize(ctx, user, action, object)
+	if errors.Cause(err) == ErrRoleServiceUnavailable && auth.fallbackAllows(action) {
+		auth.log(gate.LogLevelWarn, "authorization degraded", "user", user.GetID(), "action", action, "object", object)
+		conditional, err = true, nil
+	}
+
+	if !conditional {
+		cache.SetInTenantUntil(tenant, user, action, object, err, until)
+	}
+
+	switch {
+	case err == nil:
+	case gate.IsAuthorizationError(err), errors.Cause(err) == ErrQuotaExceeded, errors.Cause(err) == ErrStepUpRequired:
+		auth.log(gate.LogLevelDebug, "authorization denied", "user", user.GetID(), "action", action, "object", object, "cause", errors.Cause(err).Error())
+	default:
+		auth.log(gate.LogLevelWarn, "authorization failed", "user", user.GetID(), "action", action, "object", object, "error", err.Error())
+	}
+	return
+}
+
+// authorize makes the authorization decision and reports whether it depends on conditional abilities, i.e. ownership, quota or risk,
+// along with the time the decision may change, i.e. the next transition of a validity window or a schedule.
+// The abilities are taken from the authorization context, if any, or resolved and kept by it
+func (auth Driver) authorize(ctx *gate.AuthzContext, user gate.User, action, object string) (conditional bool, until time.Time, err error) {
+	if _, ok := user.(gate.Scoped); ok {
+		if !auth.chainAllows(scopeChain(user), action, object) {
+			err = ErrForbidden
+			return
+		}
+
+		if delegated, ok := user.(gate.DelegatedUser); ok {
+			user = delegated.User
+		}
+	}
+
+	if auth.dependencies != nil && auth.dependencies.Authorizer() != nil {
+		authorizer := auth.dependencies.Authorizer()
+		if tenantAuthorizer, ok := authorizer.(gate.TenantAuthorizer); ok && ctx != nil && ctx.Tenant != "" {
+			err = tenantAuthorizer.AuthorizeInTenant(ctx.Tenant, user, action, object)
+			return
+		}
+
+		err = authorizer.Authorize(user, action, object)
+		return
+	}
+
+	if iterator, ok := auth.abilityIterator(); ok && ctx == nil {
+		return auth.authorizeLazily(iterator, user, action, object)
+	}
+
+	index, err := auth.contextAbilityIndex(ctx, user)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the abilities")
 		return
 	}
 
-	if len(abilities) == 0 {
+	until = index.Until()
+	if index.Len() == 0 {
 		err = ErrNoAbilities
 		return
 	}
 
-	if !auth.authorizationCheck(action, object, abilities) {
+	if index.Allows(action, object) {
+		return
+	}
+
+	if abilities := index.Conditional(action, object); len(abilities) > 0 {
+		conditional = true
+		err = auth.authorizeConditionally(ctx, user, action, object, abilities)
+		return
+	}
+
+	err = ErrForbidden
+	return
+}
+
+// contextAbilityIndex returns the abilities kept by the authorization context or resolves them
+func (auth Driver) contextAbilityIndex(ctx *gate.AuthzContext, user gate.User) (index gate.AbilityIndex, err error) {
+	if ctx == nil {
+		return auth.getUserAbilityIndex(user)
+	}
+
+	index, ok := ctx.Abilities()
+	if ok {
+		return
+	}
+
+	index, err = auth.getTenantAbilityIndex(ctx.Tenant, user)
+	if err == nil {
+		ctx.SetAbilities(index)
+	}
+	return
+}
+
+// authorizeConditionally checks the conditions of the matching conditional abilities.
+// Templates require the object to match with the attributes of the authorization context, owned abilities require the user to own the object, sensitive abilities require the request not to be risky,
+// then limited abilities consume their quota. ErrStepUpRequired is thrown when only a step-up would grant the action
+func (auth Driver) authorizeConditionally(ctx *gate.AuthzContext, user gate.User, action, object string, abilities []gate.UserAbility) (err error) {
+	var owns, risky *bool
+	var stepUp bool
+	var limited []gate.UserAbility
+	var matcher gate.Matcher
+	var attributes gate.Attributes
+	for _, ability := range abilities {
+		if gate.IsTemplate(ability) {
+			if attributes == nil {
+				if matcher, err = auth.Matcher(); err != nil {
+					return
+				}
+
+				attributes = templateAttributes(ctx, user)
+			}
+
+			if !matcher.MatchTemplate(action, object, ability, attributes) {
+				continue
+			}
+		}
+
+		if gate.IsOwned(ability) {
+			if owns == nil {
+				owned := auth.owns(user, object)
+				owns = &owned
+			}
+
+			if !*owns {
+				continue
+			}
+		}
+
+		if gate.RequiresStepUp(ability) {
+			if risky == nil {
+				evaluated := auth.risky(ctx, user, action, object)
+				risky = &evaluated
+			}
+
+			if *risky {
+				stepUp = true
+				continue
+			}
+		}
+
+		if _, ok := ability.(gate.Limited); ok {
+			limited = append(limited, ability)
+			continue
+		}
+
+		return
+	}
+
+	if len(limited) > 0 {
+		return auth.consumeQuota(user, limited)
+	}
+
+	if stepUp {
+		err = ErrStepUpRequired
+		return
+	}
+
+	err = ErrForbidden
+	return
+}
+
+// templateAttributes returns the attributes of the authorization context, if any, with the ID of the user
+func templateAttributes(ctx *gate.AuthzContext, user gate.User) gate.Attributes {
+	var attributes gate.Attributes
+	if ctx != nil {
+		attributes = ctx.Attributes
+	}
+
+	return attributes.With(gate.UserIDAttribute, user.GetID())
+}
+
+// owns reports whether a user owns an object using the ownership resolver. Nothing is owned without a resolver
+func (auth Driver) owns(user gate.User, object string) bool {
+	resolver := auth.dependencies.OwnershipResolver()
+	return resolver != nil && resolver.Owns(user, object)
+}
+
+// consumeQuota consumes the quota of the first limited ability which is not exhausted
+func (auth Driver) consumeQuota(user gate.User, abilities []gate.UserAbility) (err error) {
+	store := auth.dependencies.CounterStore()
+	if store == nil {
+		err = errors.New("missing counter store")
+		return
+	}
+
+	for _, ability := range abilities {
+		quota := ability.(gate.Limited).GetQuota()
+		key := strings.Join([]string{user.GetID(), ability.GetAction(), ability.GetObject()}, "\x00")
+		if auth.dryRun {
+			if reader, ok := store.(gate.CounterReader); ok {
+				count, countErr := reader.Count(key)
+				if countErr != nil {
+					err = errors.Wrap(countErr, "could not check the quota")
+					return
+				}
+
+				if count >= quota.Limit {
+					continue
+				}
+			}
+			return
+		}
+
+		count, incrementErr := store.Increment(key, quota.Period)
+		if incrementErr != nil {
+			err = errors.Wrap(incrementErr, "could not consume the quota")
+			return
+		}
+
+		if count <= quota.Limit {
+			return
+		}
+	}
+
+	err = ErrQuotaExceeded
+	return
+}
+
+// AuthorizeToken authenticates a JWT string and authorizes the resulting user to take an action on an object
+func (auth Driver) AuthorizeToken(tokenString, action, object string) (user gate.User, err error) {
+	user, err = auth.Authenticate(tokenString)
+	if err != nil {
+		return
+	}
+
+	err = auth.Authorize(user, action, object)
+	return
+}
+
+// AuthorizeUserID finds a user by ID and authorizes the user to take an action on an object
+func (auth Driver) AuthorizeUserID(id, action, object string) (user gate.User, err error) {
+	defer auth.redact(&err, gate.ErrAuthorizationFailed)
+
+	service, err := auth.UserService()
+	if err != nil {
+		return
+	}
+
+	user, err = service.FindOneByID(id)
+	if err != nil {
+		err = errors.Wrap(err, "could not find the user with the given id")
+		return
+	}
+
+	err = auth.Authorize(user, action, object)
+	return
+}
+
+// abilityIterator returns the role service as an ability iterator when abilities are not cached.
+// Streamed abilities do not resolve permission sets, hence roles are fetched when there is a permission set service
+func (auth Driver) abilityIterator() (iterator gate.AbilityIterator, ok bool) {
+	cache, err := auth.AbilityCache()
+	if err != nil || cache.Enabled() || auth.dependencies.PermissionSetService() != nil {
+		return
+	}
+
+	service, err := auth.RoleService()
+	if err != nil {
+		return
+	}
+
+	iterator, ok = service.(gate.AbilityIterator)
+	return
+}
+
+// authorizeLazily streams the abilities of a user's roles and stops at the first matching ability.
+// Roles and abilities outside of their validity window or their schedule are skipped. It returns the time the decision may change like authorize
+func (auth Driver) authorizeLazily(iterator gate.AbilityIterator, user gate.User, action, object string) (conditional bool, until time.Time, err error) {
+	matcher, err := auth.Matcher()
+	if err != nil {
+		return
+	}
+
+	var conditionalAbilities []gate.UserAbility
+	now := auth.Now()
+	location := auth.config.ScheduleLocation()
+	granted := grantedAbilities(user)
+	for _, ability := range granted {
+		until = earliest(until, gate.NextAvailabilityChange(ability, now, location))
+	}
+
+	grants := auth.availableAbilities(granted, now)
+	for _, ability := range grants {
+		if !matcher.MatchAbility(action, object, ability) {
+			continue
+		}
+
+		if !gate.IsConditional(ability) {
+			return
+		}
+
+		conditionalAbilities = append(conditionalAbilities, ability)
+	}
+
+	count := len(grants)
+	var found bool
+	if roleIDs := user.GetRoles(); len(roleIDs) > 0 {
+		err = auth.forEachRoleAbility(iterator, roleIDs, func(role gate.Role, ability gate.UserAbility) bool {
+			until = earliest(until, gate.NextAvailabilityChange(role, now, location))
+			until = earliest(until, gate.NextAvailabilityChange(ability, now, location))
+			if !gate.IsAvailable(role, now, location) || !gate.IsAvailable(ability, now, location) {
+				return true
+			}
+
+			count++
+			if !matcher.MatchAbility(action, object, ability) {
+				return true
+			}
+
+			if gate.IsConditional(ability) {
+				conditionalAbilities = append(conditionalAbilities, ability)
+				return true
+			}
+
+			found = true
+			return false
+		})
+		if err != nil {
+			err = errors.Wrap(err, "could not get the abilities")
+			return
+		}
+	}
+
+	switch {
+	case found:
+	case count == 0:
+		err = ErrNoAbilities
+	case len(conditionalAbilities) > 0:
+		conditional = true
+		err = auth.authorizeConditionally(nil, user, action, object, conditionalAbilities)
+	default:
 		err = ErrForbidden
 	}
 	return
 }
 
-// GetUserFromJWT returns a user from a given JWT
+// GetUserFromJWT returns a user from a given JWT. Missing users, i.e. lookups failing with gate.ErrUserNotFound, are remembered by the negative cache,
+// storage failures are not
 func (auth Driver) GetUserFromJWT(token gate.JWT) (user gate.User, err error) {
 	service, err := auth.UserService()
 	if err != nil {
 		return
 	}
 
+	cache := auth.negativeCache()
+	key := gate.NegativeUserKey(token.UserID)
+	if cached, ok := cache.Get(key); ok {
+		auth.log(gate.LogLevelDebug, "negative cache hit", "lookup", "user", "user", token.UserID)
+		err = cached
+		return
+	}
+
 	user, err = service.FindOneByID(token.UserID)
 	if err != nil {
 		err = errors.Wrap(err, "could not find the user with the given id")
+		if errors.Cause(err) == gate.ErrUserNotFound {
+			cache.Set(key, err)
+		}
 	}
 	return
 }
 
-// GetUserAbilities returns a user's abilities
+// GetUserAbilities returns a user's abilities which are active and allowed by their schedule
 func (auth Driver) GetUserAbilities(user gate.User) (abilities []gate.UserAbility, err error) {
-	roleIDs := user.GetRoles()
+	index, err := auth.getUserAbilityIndex(user)
+	if err != nil {
+		return
+	}
+
+	abilities = index.Abilities()
+	return
+}
+
+// getUserAbilityIndex returns the indexed available abilities of a user, i.e. the ones of the user's role set from the cache or the role service
+// and the ones granted to the user directly
+func (auth Driver) getUserAbilityIndex(user gate.User) (index gate.AbilityIndex, err error) {
+	return auth.getTenantAbilityIndex("", user)
+}
+
+// getTenantAbilityIndex returns the ability index of a user with the roles of the user in the tenant, see gate.TenantRoles
+func (auth Driver) getTenantAbilityIndex(tenant string, user gate.User) (index gate.AbilityIndex, err error) {
+	matcher, err := auth.Matcher()
+	if err != nil {
+		return
+	}
+
+	now := auth.Now()
+	index, err = auth.getRoleSetAbilityIndex(gate.TenantRoles(user, tenant), matcher, now)
+	if err != nil {
+		return
+	}
+
+	granted := grantedAbilities(user)
+	grants := auth.availableAbilities(granted, now)
+	until := index.Until()
+	for _, ability := range granted {
+		until = earliest(until, gate.NextAvailabilityChange(ability, now, auth.config.ScheduleLocation()))
+	}
+
+	if len(grants) == 0 {
+		index.SetUntil(until)
+		return
+	}
+
+	abilities := make([]gate.UserAbility, 0, index.Len()+len(grants))
+	abilities = append(abilities, index.Abilities()...)
+	index = gate.NewAbilityIndex(append(abilities, grants...), matcher)
+	index.SetUntil(until)
+	return
+}
+
+// getRoleSetAbilityIndex returns the indexed available abilities of a role set from the cache or the role service.
+// Indexes are cached no longer than the next transition of a validity window or a schedule
+func (auth Driver) getRoleSetAbilityIndex(roleIDs []string, matcher gate.Matcher, now time.Time) (index gate.AbilityIndex, err error) {
 	if len(roleIDs) == 0 {
+		index = gate.NewAbilityIndex(nil, matcher)
+		return
+	}
+
+	cache, err := auth.AbilityCache()
+	if err != nil {
+		return
+	}
+
+	index, ok := cache.Get(roleIDs)
+	if ok {
 		return
 	}
 
@@ -222,46 +1061,174 @@ func (auth Driver) GetUserAbilities(user gate.User) (abilities []gate.UserAbilit
 		return
 	}
 
-	roles, err := service.FindByIDs(roleIDs)
+	roles, err := auth.findRoles(service, roleIDs)
 	if err != nil {
-		err = errors.Wrap(err, "could not fetch roles")
+		if stale, ok := cache.GetStale(roleIDs); ok && auth.config.RoleFallbackPolicy() == gate.FallbackAllowCached {
+			auth.log(gate.LogLevelWarn, "using stale abilities", "roles", strings.Join(roleIDs, ","), "error", err.Error())
+			index, err = stale, nil
+		}
 		return
 	}
 
-	for _, role := range roles {
-		abilities = append(abilities, role.GetAbilities()...)
+	index, until, err := auth.indexRoles(roles, matcher, now)
+	if err != nil {
+		return
 	}
+
+	cache.SetUntil(roleIDs, index, until)
 	return
 }
 
-func (auth Driver) authorizationCheck(action, object string, abilities []gate.UserAbility) (found bool) {
-	matcher, err := auth.Matcher()
+// indexRoles indexes the available abilities of roles, including the ones of their permission sets,
+// and returns the next transition of a validity window or a schedule
+func (auth Driver) indexRoles(roles []gate.Role, matcher gate.Matcher, now time.Time) (index gate.AbilityIndex, until time.Time, err error) {
+	sets, err := gate.ResolvePermissionSets(auth.dependencies.PermissionSetService(), roles)
 	if err != nil {
 		return
 	}
 
-	for _, ability := range abilities {
-		if ability.GetAction() == "" {
+	var abilities []gate.UserAbility
+	location := auth.config.ScheduleLocation()
+	for _, role := range roles {
+		until = earliest(until, gate.NextAvailabilityChange(role, now, location))
+		if !gate.IsAvailable(role, now, location) {
 			continue
 		}
 
-		if ability.GetObject() == "" {
-			continue
+		for _, ability := range roleAbilities(role, sets) {
+			until = earliest(until, gate.NextAvailabilityChange(ability, now, location))
+			if gate.IsAvailable(ability, now, location) {
+				abilities = append(abilities, ability)
+			}
 		}
+	}
 
-		actionMatch, err := matcher.Match(action, ability.GetAction())
-		if err != nil || !actionMatch {
-			continue
+	index = gate.NewAbilityIndex(abilities, matcher)
+	index.SetUntil(until)
+	return
+}
+
+// roleAbilities returns the abilities of a role followed by the ones of its permission sets
+func roleAbilities(role gate.Role, sets map[string][]gate.UserAbility) []gate.UserAbility {
+	referrer, ok := role.(gate.PermissionSetReferrer)
+	if !ok {
+		return role.GetAbilities()
+	}
+
+	own := role.GetAbilities()
+	abilities := make([]gate.UserAbility, len(own))
+	copy(abilities, own)
+	for _, name := range referrer.GetPermissionSets() {
+		abilities = append(abilities, sets[name]...)
+	}
+	return abilities
+}
+
+// callRoleService calls the role service through its circuit breaker. Failures are reported as ErrRoleServiceUnavailable
+func (auth Driver) callRoleService(call func() error) (err error) {
+	err = auth.dependencies.RoleCircuitBreaker().Call(call)
+	if err != nil {
+		err = errors.WithMessage(ErrRoleServiceUnavailable, "could not fetch roles: "+err.Error())
+	}
+	return
+}
+
+// findRoles fetches roles by their deduplicated IDs in batches of the configured size and merges the results
+func (auth Driver) findRoles(service gate.RoleService, roleIDs []string) (roles []gate.Role, err error) {
+	for _, batch := range auth.roleBatches(roleIDs) {
+		var found []gate.Role
+		err = auth.callRoleService(func() (findErr error) {
+			found, findErr = service.FindByIDs(batch)
+			return
+		})
+		if err != nil {
+			return
 		}
 
-		objectMatch, err := matcher.Match(object, ability.GetObject())
-		if err != nil || !objectMatch {
-			continue
+		roles = append(roles, found...)
+	}
+	return
+}
+
+// forEachRoleAbility streams the abilities of roles by their deduplicated IDs in batches of the configured size
+func (auth Driver) forEachRoleAbility(iterator gate.AbilityIterator, roleIDs []string, fn func(gate.Role, gate.UserAbility) bool) (err error) {
+	stopped := false
+	for _, batch := range auth.roleBatches(roleIDs) {
+		err = auth.callRoleService(func() error {
+			return iterator.ForEachAbility(batch, func(role gate.Role, ability gate.UserAbility) bool {
+				stopped = !fn(role, ability)
+				return !stopped
+			})
+		})
+		if err != nil || stopped {
+			return
+		}
+	}
+	return
+}
+
+// roleBatches deduplicates role IDs and splits them into batches of the configured size
+func (auth Driver) roleBatches(roleIDs []string) (batches [][]string) {
+	unique := make([]string, 0, len(roleIDs))
+	seen := make(map[string]bool, len(roleIDs))
+	for _, id := range roleIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
 		}
+	}
+
+	size := auth.config.RoleBatchSize()
+	if size <= 0 {
+		size = len(unique)
+	}
+
+	for len(unique) > size {
+		batches = append(batches, unique[:size:size])
+		unique = unique[size:]
+	}
+
+	return append(batches, unique)
+}
+
+// fallbackAllows reports whether an action is allowed by the fallback policy while the role service is unavailable
+func (auth Driver) fallbackAllows(action string) bool {
+	if auth.config.RoleFallbackPolicy() != gate.FallbackAllowListed {
+		return false
+	}
 
-		found = true
-		break
+	for _, allowed := range auth.config.RoleFallbackActions() {
+		if allowed == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+func grantedAbilities(user gate.User) []gate.UserAbility {
+	grantee, ok := user.(gate.AbilityGrantee)
+	if !ok {
+		return nil
+	}
+
+	return grantee.GetGrantedAbilities()
+}
+
+func (auth Driver) availableAbilities(abilities []gate.UserAbility, now time.Time) (available []gate.UserAbility) {
+	for _, ability := range abilities {
+		if gate.IsAvailable(ability, now, auth.config.ScheduleLocation()) {
+			available = append(available, ability)
+		}
 	}
 
 	return
 }
+
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+
+	return a
+}
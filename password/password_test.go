@@ -1,12 +1,19 @@
 package password
 
 import (
-	"errors"
+	"context"
+	"encoding/base64"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/policy"
+	"github.com/pkg/errors"
 )
 
 var auth gate.Auth
@@ -56,7 +63,8 @@ func TestMain(m *testing.M) {
 	roleService = myRoleService{roles}
 
 	// prepare for mocking
-	driver = New(
+	var err error
+	driver, err = New(
 		gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false),
 		gate.NewDependencies(&userService, &tokenService, &roleService),
 		func(username, password string) (gate.User, error) {
@@ -69,11 +77,95 @@ func TestMain(m *testing.M) {
 			return nil, errors.New("invalid credentials")
 		},
 	)
+	if err != nil {
+		panic(err)
+	}
+
 	auth = driver
 
 	os.Exit(m.Run())
 }
 
+func TestNew(t *testing.T) {
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	t.Run("valid", func(t *testing.T) {
+		_, err := New(config, gate.NewDependencies(&userService, &tokenService, &roleService), nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+	})
+
+	t.Run("requirements", func(t *testing.T) {
+		_, err := New(config, gate.NewDependencies(&userService, &tokenService, nil), nil)
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing role service")
+		}
+
+		_, err = New(config, gate.NewDependencies(nil, &tokenService, &roleService), nil)
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing user service")
+		}
+
+		stateless := config
+		stateless.SetStatelessAuthentication(true)
+		_, err = New(stateless, gate.NewDependencies(nil, &tokenService, &roleService), nil)
+		if err != nil {
+			t.Fatalf("err should be nil because stateless authentication does not require the user service: %s", err)
+		}
+
+		dependencies := gate.NewDependencies(&userService, &tokenService, nil)
+		dependencies.SetAuthorizer(authorizerFunc(func(gate.User, string, string) error {
+			return nil
+		}))
+		_, err = New(config, dependencies, nil)
+		if err != nil {
+			t.Fatalf("err should be nil because the authorization backend replaces the role service: %s", err)
+		}
+	})
+
+	t.Run("builder", func(t *testing.T) {
+		_, err := gate.NewDependenciesBuilder().WithUserService(&userService).WithTokenService(&tokenService).Dependencies(Requirements(config)...)
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing role service")
+		}
+
+		dependencies, err := gate.NewDependenciesBuilder().
+			WithUserService(&userService).
+			WithRoleService(&roleService).
+			WithTokenService(&tokenService).
+			Dependencies(Requirements(config)...)
+		if err != nil {
+			t.Fatalf("err should be nil because of the satisfied requirements: %s", err)
+		}
+
+		_, err = New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid dependencies: %s", err)
+		}
+	})
+
+	t.Run("invalid dependencies", func(t *testing.T) {
+		_, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), nil, nil)
+		if err == nil {
+			t.Fatal("err should not be nil because of the invalid dependencies")
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := New(gate.Config{}, gate.NewDependencies(&userService, &tokenService, &roleService), nil)
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing signing key")
+		}
+	})
+
+	t.Run("invalid expiration", func(t *testing.T) {
+		_, err := New(gate.NewConfig("jwt-secret", "jwt-secret", -time.Hour, false), gate.NewDependencies(&userService, &tokenService, &roleService), nil)
+		if err == nil {
+			t.Fatal("err should not be nil because of the negative expiration")
+		}
+	})
+}
+
 func TestLogin(t *testing.T) {
 	t.Run("login func", func(t *testing.T) {
 		handler := driver.handler
@@ -252,11 +344,2891 @@ func testJWTValidateAuthorize(t *testing.T) {
 	}
 }
 
+func testJWTSingleUse(t *testing.T) {
+	user, err := userService.findOneByUsername("foo")
+	if err != nil {
+		t.Fatalf("err should not be nil because of the existing user: %s", err)
+	}
+
+	token, err := driver.IssueSingleUseJWT(user)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	if !token.SingleUse {
+		t.Fatal("token should be single-use")
+	}
+
+	_, err = auth.Authenticate(token.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because of the first use: %s", err)
+	}
+
+	_, err = auth.Authenticate(token.Value)
+	if err != ErrTokenConsumed {
+		t.Fatalf("err should be ErrTokenConsumed because of the replay: %v", err)
+	}
+
+	failing, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, unconsumableTokenService{&myTokenService{}}, &roleService), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	token, err = failing.IssueSingleUseJWT(user)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	_, err = failing.Authenticate(token.Value)
+	if err == nil || err == ErrTokenConsumed {
+		t.Fatalf("err should be the storage failure instead of ErrTokenConsumed: %v", err)
+	}
+}
+
+type unconsumableTokenService struct {
+	*myTokenService
+}
+
+func (service unconsumableTokenService) Consume(id string) error {
+	return errors.New("connection refused")
+}
+
+func testJWTValidateAuthorizeToken(t *testing.T) {
+	user, err := userService.findOneByUsername("foo")
+	if err != nil {
+		t.Fatalf("err should not be nil because of the existing user: %s", err)
+	}
+
+	token, err := auth.IssueJWT(user)
+	if err != nil {
+		t.Fatalf("err should not be nil: %s", err)
+	}
+
+	authorized, err := driver.AuthorizeToken(token.Value, "GET", "/api/v1/users")
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid abilities: %s", err)
+	}
+
+	if authorized.GetID() != user.GetID() {
+		t.Fatalf("id mismatch: %s - %s", authorized.GetID(), user.GetID())
+	}
+
+	_, err = driver.AuthorizeToken(token.Value, "POST", "/api/v1/posts")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because of the invalid abilities: %v", err)
+	}
+
+	_, err = driver.AuthorizeToken("invalid", "GET", "/api/v1/users")
+	if err == nil {
+		t.Fatal("err should not be nil because of the invalid token")
+	}
+}
+
+func testJWTValidateAuthorizeUserID(t *testing.T) {
+	user, err := userService.findOneByUsername("foo")
+	if err != nil {
+		t.Fatalf("err should not be nil because of the existing user: %s", err)
+	}
+
+	_, err = driver.AuthorizeUserID(user.GetID(), "GET", "/api/v1/users")
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid abilities: %s", err)
+	}
+
+	_, err = driver.AuthorizeUserID(user.GetID(), "POST", "/api/v1/posts")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because of the invalid abilities: %v", err)
+	}
+
+	_, err = driver.AuthorizeUserID("missing", "GET", "/api/v1/users")
+	if err == nil {
+		t.Fatal("err should not be nil because of the missing user")
+	}
+}
+
 func TestJWT(t *testing.T) {
 	t.Run("issue", testJWTIssue)
+	t.Run("single use", testJWTSingleUse)
 	t.Run("validate", func(t *testing.T) {
 		t.Run("parse and fetch user", testJWTValidateParseAndFetchUser)
 		t.Run("authenticate", testJWTValidateAuthenticate)
 		t.Run("authorize", testJWTValidateAuthorize)
+		t.Run("authorize token", testJWTValidateAuthorizeToken)
+		t.Run("authorize user id", testJWTValidateAuthorizeUserID)
 	})
 }
+
+func TestClaimsProjection(t *testing.T) {
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetClaimsProjection(gate.ClaimsProjectionIDOnly)
+	private, err := New(config, gate.NewDependencies(&userService, &tokenService, &roleService), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	expected := userService.records[0]
+	token, err := private.IssueJWT(expected)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(token.Value, ".")[1])
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid token: %s", err)
+	}
+
+	if strings.Contains(string(payload), "username") || strings.Contains(string(payload), "roles") {
+		t.Fatalf("claims should only contain the user ID: %s", payload)
+	}
+
+	found, err := private.Authenticate(token.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid token: %s", err)
+	}
+
+	if found.GetUsername() != expected.GetUsername() || len(found.GetRoles()) != len(expected.GetRoles()) {
+		t.Fatalf("omitted information should be looked up: %v", found)
+	}
+}
+
+func TestStatelessAuthentication(t *testing.T) {
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetStatelessAuthentication(true)
+	stateless, err := New(config, gate.NewDependencies(nil, &tokenService, &roleService), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	expected := user{id: "stateless", username: "stateless", roles: []string{roleService.records[0].id}}
+	token, err := stateless.IssueJWT(expected)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	found, err := stateless.Authenticate(token.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because the user service is not needed: %s", err)
+	}
+
+	claimsUser, ok := found.(gate.ClaimsUser)
+	if !ok || claimsUser.GetID() != "stateless" || claimsUser.GetUsername() != "stateless" || len(claimsUser.GetRoles()) != 1 {
+		t.Fatalf("user should be built from the claims: %v", found)
+	}
+
+	err = stateless.Authorize(found, "GET", "/api/v1/posts")
+	if err != nil {
+		t.Fatalf("err should be nil because of the roles of the claims: %s", err)
+	}
+
+	config.SetOpaqueTokens(true)
+	_, err = New(config, gate.NewDependencies(nil, &tokenService, &roleService), nil)
+	if err == nil {
+		t.Fatal("err should not be nil because opaque tokens do not carry claims")
+	}
+}
+
+type managedTokenService struct {
+	*myTokenService
+}
+
+func (service managedTokenService) ListTokens(userID string) (tokens []gate.JWT, err error) {
+	for _, record := range service.records {
+		if record.userID == userID {
+			token, _ := service.FindOneByID(record.id)
+			tokens = append(tokens, token)
+		}
+	}
+	return
+}
+
+func (service managedTokenService) RevokeToken(id string) error {
+	for i, record := range service.records {
+		if record.id == id {
+			service.records = append(service.records[:i], service.records[i+1:]...)
+			return nil
+		}
+	}
+	return errTokenNotFound
+}
+
+type unavailableTokenService struct {
+	managedTokenService
+}
+
+func (service unavailableTokenService) FindOneByID(id string) (gate.JWT, error) {
+	return gate.JWT{}, errors.New("token service unavailable")
+}
+
+type sessionTokenService struct {
+	managedTokenService
+	sessions map[string]bool
+	*sync.Mutex
+}
+
+func newSessionTokenService() sessionTokenService {
+	return sessionTokenService{managedTokenService{&myTokenService{}}, map[string]bool{}, &sync.Mutex{}}
+}
+
+func (service sessionTokenService) StoreSession(jwt gate.JWT, max int, policy gate.SessionLimitPolicy) (evicted []gate.JWT, err error) {
+	service.Lock()
+	defer service.Unlock()
+
+	sessions, err := service.listSessions(jwt.UserID)
+	if err != nil {
+		return
+	}
+
+	evicted, err = gate.EvictSessions(sessions, jwt.IssuedAt, max, policy)
+	if err != nil {
+		return
+	}
+
+	for _, session := range evicted {
+		delete(service.sessions, session.ID)
+		err = service.RevokeToken(session.ID)
+		if err != nil {
+			return
+		}
+	}
+
+	service.sessions[jwt.ID] = true
+	err = service.Store(jwt)
+	return
+}
+
+func (service sessionTokenService) ListSessions(userID string) (sessions []gate.JWT, err error) {
+	service.Lock()
+	defer service.Unlock()
+
+	return service.listSessions(userID)
+}
+
+func (service sessionTokenService) listSessions(userID string) (sessions []gate.JWT, err error) {
+	tokens, err := service.ListTokens(userID)
+	for _, token := range tokens {
+		if service.sessions[token.ID] {
+			sessions = append(sessions, token)
+		}
+	}
+	return
+}
+
+func TestClock(t *testing.T) {
+	now := time.Now()
+	dependencies := gate.NewDependencies(&userService, &tokenService, &roleService)
+	dependencies.SetClock(gate.ClockFunc(func() time.Time {
+		return now
+	}))
+
+	clocked, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	user, err := userService.findOneByUsername("foo")
+	if err != nil {
+		t.Fatalf("err should be nil because of the existing user: %s", err)
+	}
+
+	token, err := clocked.IssueJWT(user)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	if token.ExpiredAt.Unix() != now.Add(time.Hour).Unix() {
+		t.Fatalf("token should expire an hour after the clock: %s", token.ExpiredAt)
+	}
+
+	_, err = clocked.Authenticate(token.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because the token is not expired yet: %s", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	_, err = clocked.Authenticate(token.Value)
+	if err == nil {
+		t.Fatal("err should not be nil because the clock is past the expiration")
+	}
+
+	_, err = driver.ParseJWT(token.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because the system clock is not past the expiration: %s", err)
+	}
+}
+
+func TestExternalTokens(t *testing.T) {
+	codec, err := gate.NewExternalTokenCodec(gate.KeycloakClaimMapping, func(kid, alg string) (interface{}, error) {
+		return []byte("idp-secret"), nil
+	}, []string{"HS256"}, "https://idp.example.com", "api")
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetTokenCodec(codec)
+	config.SetStatelessAuthentication(true)
+	external, err := New(config, gate.NewDependencies(nil, &tokenService, &roleService), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":                "external",
+		"iss":                "https://idp.example.com",
+		"aud":                "api",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "external",
+		"realm_access":       map[string]interface{}{"roles": []string{roleService.records[0].id}},
+	}).SignedString([]byte("idp-secret"))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	user, err := external.Authenticate(token)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid external token: %s", err)
+	}
+
+	if user.GetID() != "external" || len(user.GetRoles()) != 1 {
+		t.Fatalf("user should be mapped from the external claims: %v", user)
+	}
+
+	err = external.Authorize(user, "GET", "/api/v1/posts")
+	if err != nil {
+		t.Fatalf("err should be nil because of the mapped roles: %s", err)
+	}
+
+	_, err = external.IssueJWT(user)
+	if err == nil {
+		t.Fatal("err should not be nil because external tokens are not issued")
+	}
+}
+
+func TestTokenManagement(t *testing.T) {
+	managed, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, managedTokenService{&myTokenService{}}, &roleService), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	expected := userService.records[0]
+	token, err := managed.IssueJWT(expected)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	tokens, err := managed.ListJWTs(expected.GetID())
+	if err != nil || len(tokens) != 1 || tokens[0].ID != token.ID {
+		t.Fatalf("tokens of the user should be listed: %v %v", tokens, err)
+	}
+
+	_, err = managed.Authenticate(token.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because of the stored token: %s", err)
+	}
+
+	unavailable, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, unavailableTokenService{managedTokenService{&myTokenService{}}}, &roleService), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	_, err = unavailable.Authenticate(token.Value)
+	if err == nil || err == ErrTokenRevoked {
+		t.Fatalf("err should be the storage failure rather than ErrTokenRevoked: %v", err)
+	}
+
+	err = managed.RevokeJWT(token.ID)
+	if err != nil {
+		t.Fatalf("err should be nil because of the stored token: %s", err)
+	}
+
+	_, err = managed.Authenticate(token.Value)
+	if err != ErrTokenRevoked {
+		t.Fatalf("err should be ErrTokenRevoked because of the revocation: %v", err)
+	}
+
+	_, err = driver.ListJWTs(expected.GetID())
+	if err == nil {
+		t.Fatal("err should not be nil because the token service does not support the management of tokens")
+	}
+}
+
+func TestRoleManagement(t *testing.T) {
+	roles := myRoleService{}
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetAbilityCacheTTL(time.Hour)
+
+	managed, err := New(config, gate.NewDependencies(&userService, &tokenService, &roles), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	u := user{id: "managed", username: "managed", roles: []string{"editor"}}
+
+	err = managed.CreateRole("editor", []gate.UserAbility{ability{"GET", "/posts*"}})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	err = managed.Authorize(u, "GET", "/posts/1")
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid abilities: %s", err)
+	}
+
+	err = managed.AttachAbility("editor", ability{"POST", "/posts*"})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	err = managed.Authorize(u, "POST", "/posts")
+	if err != nil {
+		t.Fatalf("err should be nil because the attached ability should take effect immediately: %s", err)
+	}
+
+	err = managed.DetachAbility("editor", ability{"GET", "/posts*"})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	err = managed.Authorize(u, "GET", "/posts/1")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the detached ability should take effect immediately: %v", err)
+	}
+
+	err = managed.DeleteRole("editor")
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	err = managed.Authorize(u, "POST", "/posts")
+	if err != ErrNoAbilities {
+		t.Fatalf("err should be ErrNoAbilities because of the deleted role: %v", err)
+	}
+
+	err = managed.UpdateRole("editor", nil)
+	if err == nil {
+		t.Fatal("err should not be nil because of the deleted role")
+	}
+}
+
+func TestUserRoleManagement(t *testing.T) {
+	users := myUserService{[]user{{id: "member", username: "member"}}}
+	dependencies := gate.NewDependencies(&users, &tokenService, &roleService)
+
+	var changes []gate.RoleChange
+	dependencies.AddRoleChangeHook(func(change gate.RoleChange) {
+		changes = append(changes, change)
+	})
+
+	managed, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	member := users.records[0]
+
+	err = managed.AssignRole(member, roleService.records[1].id)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	roles, err := managed.ListRoles(member)
+	if err != nil || len(roles) != 1 {
+		t.Fatalf("the assigned role should be listed: %v - %v", roles, err)
+	}
+
+	updated, err := users.FindOneByID(member.id)
+	if err != nil {
+		t.Fatalf("err should be nil because of the existing user: %s", err)
+	}
+
+	err = managed.Authorize(updated, "GET", "/anything")
+	if err != nil {
+		t.Fatalf("err should be nil because of the assigned role: %s", err)
+	}
+
+	err = managed.RevokeRole(member, roleService.records[1].id)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	roles, err = managed.ListRoles(member)
+	if err != nil || len(roles) != 0 {
+		t.Fatalf("the revoked role should not be listed: %v - %v", roles, err)
+	}
+
+	if len(changes) != 2 || !changes[0].Assigned || changes[1].Assigned {
+		t.Fatalf("hooks should be notified of every change: %v", changes)
+	}
+
+	err = managed.AssignRole(user{id: "missing"}, "role")
+	if err == nil {
+		t.Fatal("err should not be nil because of the missing user")
+	}
+}
+
+func TestObjectPathMatching(t *testing.T) {
+	roles := myRoleService{[]role{{"project-member", []ability{{"GET", "projects/:id/**"}}}}}
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetObjectPathMatching(true)
+
+	paths, err := New(config, gate.NewDependencies(&userService, &tokenService, &roles), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	u := user{id: "member", roles: []string{"project-member"}}
+
+	err = paths.Authorize(u, "GET", "projects/1/issues/2")
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid abilities: %s", err)
+	}
+
+	err = paths.Authorize(u, "GET", "users/1")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because of the invalid abilities: %v", err)
+	}
+}
+
+type authorizerFunc func(gate.User, string, string) error
+
+func (fn authorizerFunc) Authorize(user gate.User, action, object string) error {
+	return fn(user, action, object)
+}
+
+func TestLoginCredentials(t *testing.T) {
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetCredentialSpec(gate.CredentialSpec{
+		Fields: []gate.CredentialField{{Name: "tenant", Required: true}, {Name: "captcha", Secret: true}},
+	})
+
+	dependencies := gate.NewDependencies(&userService, &tokenService, &roleService)
+	var attempts []gate.LoginAttempt
+	dependencies.AddLoginHook(func(attempt gate.LoginAttempt) {
+		attempts = append(attempts, attempt)
+	})
+
+	typed, err := New(config, dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	typed.SetCredentialsHandler(func(credentials gate.Credentials) (gate.User, error) {
+		if credentials.Get("tenant") != "acme" || credentials.Password != "bar" {
+			return nil, errors.New("invalid credentials")
+		}
+
+		return userService.FindOrCreateOneByUsername(credentials.Username)
+	})
+
+	_, err = typed.Login(map[string]string{"username": "foo", "password": "bar"})
+	if err == nil || !strings.Contains(err.Error(), "missing tenant") {
+		t.Fatalf("err should be missing tenant: %v", err)
+	}
+
+	found, err := typed.Login(map[string]string{"username": "foo", "password": "bar", "tenant": "acme", "captcha": "token", "ip": "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid credentials: %s", err)
+	}
+
+	if found.GetUsername() != "foo" {
+		t.Fatalf("user should be found by the handler: %v", found)
+	}
+
+	source := attempts[len(attempts)-1].Source
+	if source["ip"] != "127.0.0.1" || source["tenant"] != "acme" || len(source) != 2 {
+		t.Fatalf("source should exclude secret credentials: %v", source)
+	}
+}
+
+type challengeVerifierFunc func(string, gate.LoginAttempt) error
+
+func (fn challengeVerifierFunc) Verify(response string, attempt gate.LoginAttempt) error {
+	return fn(response, attempt)
+}
+
+func TestLoginChallenge(t *testing.T) {
+	dependencies := gate.NewDependencies(&userService, &tokenService, &roleService)
+	history := gate.NewSourceHistory("ip")
+	dependencies.AddLoginHook(history.Observe)
+	dependencies.AddChallengeTrigger(history)
+
+	verified := 0
+	dependencies.SetChallengeVerifier(challengeVerifierFunc(func(response string, attempt gate.LoginAttempt) error {
+		verified++
+		if _, ok := attempt.Source["challenge"]; ok {
+			return errors.New("challenge response should not be part of the source")
+		}
+
+		if response != "solved" {
+			return errors.New("unsolved")
+		}
+
+		return nil
+	}))
+
+	challenged, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, driver.handler)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	_, err = challenged.Login(map[string]string{"username": "foo", "password": "fooo", "ip": "10.0.0.1"})
+	if err != nil || verified != 0 {
+		t.Fatalf("err should be nil because the first login is not risky: %v", err)
+	}
+
+	_, err = challenged.Login(map[string]string{"username": "foo", "password": "fooo", "ip": "10.0.0.2"})
+	if err == nil || !strings.Contains(err.Error(), ErrChallengeRequired.Error()) {
+		t.Fatalf("err should be ErrChallengeRequired because of the new source: %v", err)
+	}
+
+	_, err = challenged.Login(map[string]string{"username": "foo", "password": "fooo", "ip": "10.0.0.2", "challenge": "robot"})
+	if err == nil || !strings.Contains(err.Error(), ErrChallengeFailed.Error()) {
+		t.Fatalf("err should be ErrChallengeFailed because of the unsolved challenge: %v", err)
+	}
+
+	_, err = challenged.Login(map[string]string{"username": "foo", "password": "fooo", "ip": "10.0.0.2", "challenge": "solved"})
+	if err != nil || verified != 2 {
+		t.Fatalf("err should be nil because of the solved challenge: %v", err)
+	}
+}
+
+func TestLoginTelemetry(t *testing.T) {
+	var attempts []gate.LoginAttempt
+	dependencies := gate.NewDependencies(&userService, &tokenService, &roleService)
+	dependencies.AddLoginHook(func(attempt gate.LoginAttempt) {
+		attempts = append(attempts, attempt)
+	})
+	dependencies.SetAnomalyDetector(gate.NewVelocityDetector("ip", 2, time.Minute))
+
+	observed, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, func(username, password string) (gate.User, error) {
+		if password != "secret" {
+			return nil, errors.New("invalid credentials")
+		}
+
+		return user{id: username, username: username}, nil
+	})
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	_, err = observed.Login(map[string]string{"username": "alice", "password": "secret", "ip": "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid credentials: %s", err)
+	}
+
+	if len(attempts) != 1 || !attempts[0].Succeeded || attempts[0].Source["ip"] != "10.0.0.1" || attempts[0].UsernameHash != gate.HashUsername("alice") {
+		t.Fatalf("attempt should be observed: %+v", attempts)
+	}
+
+	if _, ok := attempts[0].Source["password"]; ok {
+		t.Fatal("password should not be part of the source metadata")
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = observed.Login(map[string]string{"username": "alice", "password": "guess", "ip": "10.0.0.1"})
+		if err == nil {
+			t.Fatal("err should not be nil because of the invalid credentials")
+		}
+	}
+
+	u, err := observed.Login(map[string]string{"username": "alice", "password": "secret", "ip": "10.0.0.1"})
+	if err != ErrMFARequired {
+		t.Fatalf("err should be ErrMFARequired because of the failure velocity: %v", err)
+	}
+
+	if u == nil || u.GetID() != "alice" {
+		t.Fatal("user should be returned along with ErrMFARequired")
+	}
+
+	if len(attempts) != 4 || attempts[3].Succeeded || attempts[3].Err != ErrMFARequired {
+		t.Fatalf("attempt should be observed as failed: %+v", attempts)
+	}
+}
+
+type window struct {
+	notBefore time.Time
+	expiresAt time.Time
+}
+
+func (w window) GetNotBefore() time.Time {
+	return w.notBefore
+}
+
+func (w window) GetExpiresAt() time.Time {
+	return w.expiresAt
+}
+
+type boundedAbility struct {
+	ability
+	window
+}
+
+type boundedRole struct {
+	abilities []gate.UserAbility
+	window
+}
+
+func (r boundedRole) GetAbilities() []gate.UserAbility {
+	return r.abilities
+}
+
+type boundedRoleService map[string]boundedRole
+
+func (service boundedRoleService) FindByIDs(ids []string) (roles []gate.Role, err error) {
+	for _, id := range ids {
+		if role, ok := service[id]; ok {
+			roles = append(roles, role)
+		}
+	}
+	return
+}
+
+type grantee struct {
+	user
+	grants []gate.UserAbility
+}
+
+func (g grantee) GetGrantedAbilities() []gate.UserAbility {
+	return g.grants
+}
+
+func TestTimeBoundedGrants(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	roles := boundedRoleService{
+		"oncall": {[]gate.UserAbility{ability{"GET", "/incidents"}}, window{expiresAt: now.Add(time.Hour)}},
+		"editor": {[]gate.UserAbility{
+			ability{"GET", "/posts"},
+			boundedAbility{ability{"DELETE", "/posts"}, window{notBefore: now.Add(time.Minute)}},
+		}, window{}},
+	}
+
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetAbilityCacheTTL(time.Hour * 24)
+	bounded, err := New(config, gate.NewDependencies(&userService, &tokenService, roles), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	bounded.Now = func() time.Time {
+		return now
+	}
+
+	u := grantee{
+		user{id: "temporary", roles: []string{"oncall", "editor"}},
+		[]gate.UserAbility{boundedAbility{ability{"POST", "/deployments"}, window{expiresAt: now.Add(time.Minute * 30)}}},
+	}
+
+	abilities, err := bounded.GetUserAbilities(u)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	if len(abilities) != 3 {
+		t.Fatalf("only active abilities should be returned: %v", abilities)
+	}
+
+	err = bounded.Authorize(u, "DELETE", "/posts")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the ability is not active yet: %v", err)
+	}
+
+	err = bounded.Authorize(u, "POST", "/deployments")
+	if err != nil {
+		t.Fatalf("err should be nil because of the active grant: %s", err)
+	}
+
+	now = now.Add(time.Minute)
+	err = bounded.Authorize(u, "DELETE", "/posts")
+	if err != nil {
+		t.Fatalf("err should be nil because the cached abilities expire with the window: %s", err)
+	}
+
+	now = now.Add(time.Hour)
+	err = bounded.Authorize(u, "GET", "/incidents")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the role has expired: %v", err)
+	}
+
+	err = bounded.Authorize(u, "POST", "/deployments")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the grant has expired: %v", err)
+	}
+}
+
+func TestTimeBoundedDecisions(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	roles := boundedRoleService{
+		"oncall": {[]gate.UserAbility{ability{"GET", "/incidents"}}, window{expiresAt: now.Add(time.Minute)}},
+		"editor": {[]gate.UserAbility{ability{"GET", "/posts"}}, window{notBefore: now.Add(time.Minute)}},
+	}
+
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetDecisionCacheTTL(time.Hour * 24)
+	dependencies := gate.NewDependencies(&userService, &tokenService, roles)
+	dependencies.SetClock(gate.ClockFunc(func() time.Time {
+		return now
+	}))
+
+	bounded, err := New(config, dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	u := user{id: "temporary", roles: []string{"oncall", "editor"}}
+	err = bounded.Authorize(u, "GET", "/incidents")
+	if err != nil {
+		t.Fatalf("err should be nil because the role is active: %s", err)
+	}
+
+	err = bounded.Authorize(u, "GET", "/posts")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the role is not active yet: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	err = bounded.Authorize(u, "GET", "/incidents")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the cached decision expires with the role: %v", err)
+	}
+
+	err = bounded.Authorize(u, "GET", "/posts")
+	if err != nil {
+		t.Fatalf("err should be nil because the cached decision expires once the role is active: %s", err)
+	}
+}
+
+type scheduledAbility struct {
+	ability
+	schedule gate.Schedule
+}
+
+func (a scheduledAbility) GetSchedule() gate.Schedule {
+	return a.schedule
+}
+
+func TestScheduledAbilities(t *testing.T) {
+	// 2020-11-10 is a Tuesday
+	now := time.Date(2020, time.November, 10, 12, 0, 0, 0, time.UTC)
+	roles := boundedRoleService{
+		"deployer": {[]gate.UserAbility{
+			scheduledAbility{ability{"POST", "/deployments"}, gate.Schedule{From: 9 * time.Hour, To: 17 * time.Hour}},
+		}, window{}},
+	}
+
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetAbilityCacheTTL(time.Hour * 24)
+	config.SetScheduleLocation(time.FixedZone("ICT", 7*60*60))
+	scheduled, err := New(config, gate.NewDependencies(&userService, &tokenService, roles), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	scheduled.Now = func() time.Time {
+		return now
+	}
+
+	u := user{id: "deployer", roles: []string{"deployer"}}
+
+	// 12:00 UTC is 19:00 in the configured location
+	err = scheduled.Authorize(u, "POST", "/deployments")
+	if err != ErrNoAbilities {
+		t.Fatalf("err should be ErrNoAbilities because no ability is allowed by its schedule: %v", err)
+	}
+
+	now = time.Date(2020, time.November, 11, 3, 0, 0, 0, time.UTC)
+	err = scheduled.Authorize(u, "POST", "/deployments")
+	if err != nil {
+		t.Fatalf("err should be nil because the cached abilities expire with the schedule: %s", err)
+	}
+}
+
+type limitedAbility struct {
+	ability
+	quota gate.Quota
+}
+
+func (a limitedAbility) GetQuota() gate.Quota {
+	return a.quota
+}
+
+func TestQuotaAbilities(t *testing.T) {
+	roles := myRoleService{}
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetDecisionCacheTTL(time.Hour)
+
+	dependencies := gate.NewDependencies(&userService, &tokenService, &roles)
+	limited, err := New(config, dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	u := grantee{
+		user{id: "exporter"},
+		[]gate.UserAbility{limitedAbility{ability{"export", "report"}, gate.Quota{Limit: 2, Period: time.Hour * 24}}},
+	}
+
+	err = limited.Authorize(u, "export", "report")
+	if err == nil {
+		t.Fatal("err should not be nil because of the missing counter store")
+	}
+
+	dependencies.SetCounterStore(gate.NewMemoryCounterStore())
+	for i := 0; i < 3; i++ {
+		err = limited.SimulateAuthorize(u, "export", "report")
+		if err != nil {
+			t.Fatalf("err should be nil because simulations do not consume the quota: %s", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		err = limited.Authorize(u, "export", "report")
+		if err != nil {
+			t.Fatalf("err should be nil because of the remaining quota: %s", err)
+		}
+	}
+
+	err = limited.Authorize(u, "export", "report")
+	if err != ErrQuotaExceeded {
+		t.Fatalf("err should be ErrQuotaExceeded because of the exhausted quota: %v", err)
+	}
+
+	err = limited.SimulateAuthorize(u, "export", "report")
+	if err != ErrQuotaExceeded {
+		t.Fatalf("err should be ErrQuotaExceeded because simulations check the quota: %v", err)
+	}
+
+	err = limited.Authorize(u, "import", "report")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because of the invalid abilities: %v", err)
+	}
+}
+
+type authorResolver map[string]string
+
+func (authors authorResolver) Owns(user gate.User, object string) bool {
+	return authors[object] == user.GetID()
+}
+
+func TestOwnedAbilities(t *testing.T) {
+	roles := myRoleService{}
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetDecisionCacheTTL(time.Hour)
+
+	dependencies := gate.NewDependencies(&userService, &tokenService, &roles)
+	owned, err := New(config, dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	err = owned.CreateRole("author", []gate.UserAbility{ability{"GET", "posts*"}, ability{"update", "posts*:own"}})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	u := user{id: "author", roles: []string{"author"}}
+	err = owned.Authorize(u, "update", "posts:1")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because of the missing ownership resolver: %v", err)
+	}
+
+	authors := authorResolver{"posts:1": "author", "posts:2": "someone"}
+	dependencies.SetOwnershipResolver(authors)
+
+	err = owned.Authorize(u, "update", "posts:1")
+	if err != nil {
+		t.Fatalf("err should be nil because the user owns the post: %s", err)
+	}
+
+	err = owned.Authorize(u, "update", "posts:2")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the user does not own the post: %v", err)
+	}
+
+	authors["posts:2"] = "author"
+	err = owned.Authorize(u, "update", "posts:2")
+	if err != nil {
+		t.Fatalf("err should be nil because ownership decisions are not cached: %s", err)
+	}
+
+	err = owned.Authorize(u, "GET", "posts:2")
+	if err != nil {
+		t.Fatalf("err should be nil because of the unconditional ability: %s", err)
+	}
+}
+
+func TestExchangeJWT(t *testing.T) {
+	u, err := userService.findOneByUsername("foo")
+	if err != nil {
+		t.Fatalf("err should be nil because of the existing user: %s", err)
+	}
+
+	token, err := driver.IssueJWT(u)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	delegated, err := driver.ExchangeJWT(token.Value, "gateway", []gate.UserAbility{ability{"GET", "/api/v1/users"}}, time.Minute)
+	if err != nil {
+		t.Fatalf("err should be nil because of the granted abilities: %s", err)
+	}
+
+	if delegated.Actor == nil || delegated.Actor.Subject != "gateway" || delegated.ExpiredAt.After(token.ExpiredAt) {
+		t.Fatalf("the delegated token should record the actor: %v", delegated)
+	}
+
+	authenticated, err := driver.Authenticate(delegated.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid token: %s", err)
+	}
+
+	if authenticated.GetID() != u.GetID() {
+		t.Fatalf("id mismatch: %s - %s", authenticated.GetID(), u.GetID())
+	}
+
+	err = driver.Authorize(authenticated, "GET", "/api/v1/users")
+	if err != nil {
+		t.Fatalf("err should be nil because of the delegated abilities: %s", err)
+	}
+
+	err = driver.Authorize(authenticated, "GET", "/api/v1/posts")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the ability is not delegated: %v", err)
+	}
+
+	chained, err := driver.ExchangeJWT(delegated.Value, "billing", []gate.UserAbility{ability{"GET", "/api/v1/users"}}, 0)
+	if err != nil {
+		t.Fatalf("err should be nil because of the delegated abilities: %s", err)
+	}
+
+	if chain := chained.Actor.Chain(); len(chain) != 2 || chain[0] != "billing" || chain[1] != "gateway" {
+		t.Fatalf("the delegation chain should be recorded: %v", chain)
+	}
+
+	if len(chained.ScopeChain) != 1 || chained.ScopeChain[0][0] != (gate.AbilityClaim{Action: "GET", Object: "/api/v1/users"}) {
+		t.Fatalf("the scopes of the original token should be kept: %v", chained.ScopeChain)
+	}
+
+	_, err = driver.ExchangeJWT(delegated.Value, "billing", []gate.UserAbility{ability{"GET", "/api/v1/users|/api/v1/posts"}}, 0)
+	if errors.Cause(err) != gate.ErrInvalidScope {
+		t.Fatalf("err should be ErrInvalidScope because an alternation would widen the token: %v", err)
+	}
+
+	service, err := driver.JWTService()
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	claims := service.NewClaims(u)
+	claims.Abilities = []gate.AbilityClaim{{Action: "GET", Object: "*"}}
+	claims.ScopeChain = [][]gate.AbilityClaim{{{Action: "GET", Object: "/api/v1/users"}}}
+	narrowed, err := driver.issueJWT(claims)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	authenticated, err = driver.Authenticate(narrowed.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid token: %s", err)
+	}
+
+	err = driver.Authorize(authenticated, "GET", "/api/v1/posts")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the scope chain does not allow the ability: %v", err)
+	}
+
+	_, err = driver.ExchangeJWT(delegated.Value, "billing", []gate.UserAbility{ability{"GET", "/api/v1/posts"}}, 0)
+	if !gate.IsAuthorizationError(err) {
+		t.Fatalf("err should be ErrForbidden because the abilities cannot be widened: %v", err)
+	}
+
+	_, err = driver.ExchangeJWT(token.Value, "gateway", []gate.UserAbility{ability{"POST", "/api/v1/posts"}}, 0)
+	if !gate.IsAuthorizationError(err) {
+		t.Fatalf("err should be ErrForbidden because of the invalid abilities: %v", err)
+	}
+
+	_, err = driver.ExchangeJWT(token.Value, "", []gate.UserAbility{ability{"GET", "/api/v1/users"}}, 0)
+	if err == nil {
+		t.Fatal("err should not be nil because of the missing actor")
+	}
+}
+
+func TestIssueScopedJWT(t *testing.T) {
+	u, err := userService.findOneByUsername("foo")
+	if err != nil {
+		t.Fatalf("err should be nil because of the existing user: %s", err)
+	}
+
+	token, err := driver.IssueScopedJWT(u, []gate.AbilityCheck{{Action: "GET", Object: "/api/v1/posts"}}, time.Minute)
+	if err != nil {
+		t.Fatalf("err should be nil because of the granted abilities: %s", err)
+	}
+
+	if token.Actor != nil || len(token.Abilities) != 1 || token.ExpiredAt.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("the token should be scoped: %v", token)
+	}
+
+	authenticated, err := driver.Authenticate(token.Value)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid token: %s", err)
+	}
+
+	err = driver.Authorize(authenticated, "GET", "/api/v1/posts")
+	if err != nil {
+		t.Fatalf("err should be nil because of the scoped abilities: %s", err)
+	}
+
+	err = driver.Authorize(authenticated, "GET", "/api/v1/users")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the ability is out of the scopes: %v", err)
+	}
+
+	_, err = driver.IssueScopedJWT(u, []gate.AbilityCheck{{Action: "DELETE", Object: "/api/v1/posts"}}, time.Minute)
+	if !gate.IsAuthorizationError(err) {
+		t.Fatalf("err should be ErrForbidden because the scopes exceed the abilities: %v", err)
+	}
+
+	_, err = driver.IssueScopedJWT(authenticated, []gate.AbilityCheck{{Action: "GET", Object: "/api/v1/users"}}, time.Minute)
+	if !gate.IsAuthorizationError(err) {
+		t.Fatalf("err should be ErrForbidden because the scopes exceed the scopes of the token: %v", err)
+	}
+
+	narrowed, err := driver.IssueScopedJWT(authenticated, []gate.AbilityCheck{{Action: "GET", Object: "/api/v1/posts"}}, time.Minute)
+	if err != nil || len(narrowed.Abilities) != 1 || len(narrowed.ScopeChain) != 1 {
+		t.Fatalf("err should be nil because the scopes are within the scopes of the token: %v", err)
+	}
+
+	_, err = driver.IssueScopedJWT(authenticated, []gate.AbilityCheck{{Action: "GET", Object: "/api/v1/posts|/admin"}}, time.Minute)
+	if errors.Cause(err) != gate.ErrInvalidScope {
+		t.Fatalf("err should be ErrInvalidScope because an alternation would widen the token: %v", err)
+	}
+
+	err = driver.Authorize(authenticated, "GET", "/admin/users")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the ability is out of the scopes: %v", err)
+	}
+
+	_, err = driver.IssueScopedJWT(u, nil, time.Minute)
+	if err == nil {
+		t.Fatal("err should not be nil because of the missing scopes")
+	}
+}
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (logger *recordingLogger) Enabled(level gate.LogLevel) bool {
+	return true
+}
+
+func (logger *recordingLogger) Log(level gate.LogLevel, msg string, keysAndValues ...interface{}) {
+	logger.messages = append(logger.messages, fmt.Sprint(level, " ", msg, keysAndValues))
+}
+
+func TestLogging(t *testing.T) {
+	logger := &recordingLogger{}
+	down, calls := true, 0
+	dependencies := gate.NewDependencies(nil, &tokenService, flakyRoleService{&roleService, &down, &calls})
+	dependencies.SetLogger(logger)
+
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetStatelessAuthentication(true)
+	logged, err := New(config, dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	_, err = logged.Authenticate("invalid")
+	if err == nil {
+		t.Fatal("err should not be nil because of the invalid token")
+	}
+
+	_, err = logged.AuthorizeUserID("logged", "GET", "/posts")
+	if err == nil {
+		t.Fatal("err should not be nil because of the missing user service")
+	}
+
+	err = logged.Authorize(user{id: "logged", roles: []string{"editor"}}, "GET", "/posts")
+	if err == nil {
+		t.Fatal("err should not be nil because of the unavailable role service")
+	}
+
+	for _, prefix := range []string{"debug could not parse the token", "warn missing service", "warn authorization failed"} {
+		found := false
+		for _, message := range logger.messages {
+			if strings.HasPrefix(message, prefix) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Fatalf("decision point %q should be logged: %v", prefix, logger.messages)
+		}
+	}
+}
+
+type pingingTokenService struct {
+	*myTokenService
+	err error
+}
+
+func (service pingingTokenService) Ping(ctx context.Context) error {
+	return service.err
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Run("healthy", func(t *testing.T) {
+		dependencies := gate.NewDependencies(&userService, pingingTokenService{&tokenService, nil}, &roleService)
+		driver, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+
+		report := driver.HealthCheck(context.Background())
+		if !report.Healthy || len(report.Dependencies) != 3 {
+			t.Fatalf("report should be healthy: %v", report)
+		}
+
+		status, ok := report.Status("token")
+		if !ok || !status.Checked {
+			t.Fatal("token service should be pinged")
+		}
+
+		status, ok = report.Status("user")
+		if !ok || status.Checked || !status.Healthy {
+			t.Fatal("user service should be assumed healthy without a Pinger")
+		}
+	})
+
+	t.Run("unhealthy", func(t *testing.T) {
+		dependencies := gate.NewDependencies(&userService, pingingTokenService{&tokenService, errors.New("connection refused")}, nil)
+		dependencies.SetAuthorizer(authorizerFunc(func(gate.User, string, string) error {
+			return nil
+		}))
+		driver, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+
+		report := driver.HealthCheck(context.Background())
+		if report.Healthy {
+			t.Fatal("report should not be healthy because of the failing dependencies")
+		}
+
+		if status, _ := report.Status("role"); status.Healthy || status.Err == nil {
+			t.Fatal("role service should be unhealthy because it is missing")
+		}
+
+		if status, _ := report.Status("token"); status.Healthy || !status.Checked {
+			t.Fatal("token service should be unhealthy because of the failed ping")
+		}
+	})
+}
+
+type flakyRoleService struct {
+	*myRoleService
+	down  *bool
+	calls *int
+}
+
+func (service flakyRoleService) FindByIDs(ids []string) ([]gate.Role, error) {
+	*service.calls++
+	if *service.down {
+		return nil, errors.New("connection refused")
+	}
+
+	return service.myRoleService.FindByIDs(ids)
+}
+
+func (service flakyRoleService) ForEachAbility(ids []string, fn func(gate.Role, gate.UserAbility) bool) error {
+	*service.calls++
+	if *service.down {
+		return errors.New("connection refused")
+	}
+
+	return lazyRoleService{service.myRoleService}.ForEachAbility(ids, fn)
+}
+
+func TestRoleServiceFallback(t *testing.T) {
+	down, calls := false, 0
+	editor := user{id: "fallback", roles: []string{roleService.records[0].id}}
+	newDriver := func(configure func(*gate.Config)) *Driver {
+		config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+		configure(&config)
+		dependencies := gate.NewDependencies(&userService, &tokenService, flakyRoleService{&roleService, &down, &calls})
+		driver, err := New(config, dependencies, nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+
+		return driver
+	}
+
+	t.Run("deny all", func(t *testing.T) {
+		down = true
+		driver := newDriver(func(config *gate.Config) {})
+		err := driver.Authorize(editor, "GET", "/api/v1/posts")
+		if err == nil || !strings.Contains(err.Error(), ErrRoleServiceUnavailable.Error()) {
+			t.Fatalf("err should be ErrRoleServiceUnavailable: %v", err)
+		}
+	})
+
+	t.Run("allow cached", func(t *testing.T) {
+		down = false
+		now := time.Now()
+		driver := newDriver(func(config *gate.Config) {
+			config.SetAbilityCacheTTL(time.Minute)
+			config.SetRoleFallbackPolicy(gate.FallbackAllowCached)
+		})
+
+		cache, _ := driver.AbilityCache()
+		cache.Now = func() time.Time {
+			return now
+		}
+		driver.dependencies.SetAbilityCache(cache)
+
+		err := driver.Authorize(editor, "GET", "/api/v1/posts")
+		if err != nil {
+			t.Fatalf("err should be nil because of the available role service: %s", err)
+		}
+
+		down = true
+		now = now.Add(time.Hour)
+		err = driver.Authorize(editor, "GET", "/api/v1/posts")
+		if err != nil {
+			t.Fatalf("err should be nil because of the stale abilities: %s", err)
+		}
+
+		err = driver.Authorize(editor, "DELETE", "/api/v1/posts")
+		if !gate.IsAuthorizationError(err) {
+			t.Fatalf("err should be an authorization error because of the stale abilities: %v", err)
+		}
+	})
+
+	t.Run("allow listed", func(t *testing.T) {
+		down = true
+		driver := newDriver(func(config *gate.Config) {
+			config.SetRoleFallbackPolicy(gate.FallbackAllowListed)
+			config.SetRoleFallbackActions([]string{"GET"})
+		})
+
+		err := driver.Authorize(editor, "GET", "/api/v1/posts")
+		if err != nil {
+			t.Fatalf("err should be nil because of the listed action: %s", err)
+		}
+
+		err = driver.Authorize(editor, "POST", "/api/v1/users")
+		if err == nil || !strings.Contains(err.Error(), ErrRoleServiceUnavailable.Error()) {
+			t.Fatalf("err should be ErrRoleServiceUnavailable because of the unlisted action: %v", err)
+		}
+	})
+
+	t.Run("circuit breaker", func(t *testing.T) {
+		down, calls = true, 0
+		driver := newDriver(func(config *gate.Config) {
+			config.SetRoleCircuitBreaker(2, time.Hour)
+		})
+
+		for i := 0; i < 4; i++ {
+			driver.Authorize(editor, "GET", "/api/v1/posts")
+		}
+
+		if calls != 2 {
+			t.Fatalf("role service should not be called while the circuit is open: %d", calls)
+		}
+
+		if !driver.dependencies.RoleCircuitBreaker().Open() {
+			t.Fatal("circuit should be open because of the consecutive failures")
+		}
+	})
+}
+
+func TestPreloadAbilities(t *testing.T) {
+	down, calls := false, 0
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetAbilityCacheTTL(time.Minute)
+	dependencies := gate.NewDependencies(&userService, &tokenService, flakyRoleService{&roleService, &down, &calls})
+	driver, err := New(config, dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	records := roleService.records
+	users := []gate.User{
+		user{id: "1", roles: []string{records[0].id}},
+		user{id: "2", roles: []string{records[1].id, records[2].id}},
+		user{id: "3", roles: []string{records[2].id, records[1].id}},
+		user{id: "4"},
+	}
+
+	err = driver.PreloadAbilities(users)
+	if err != nil {
+		t.Fatalf("err should be nil because of the available role service: %s", err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("roles should be fetched in a single call: %d", calls)
+	}
+
+	err = driver.Authorize(users[1], "POST", "/api/v1/posts")
+	if err != nil {
+		t.Fatalf("err should be nil because of the preloaded abilities: %s", err)
+	}
+
+	err = driver.Authorize(users[0], "POST", "/api/v1/posts")
+	if !gate.IsAuthorizationError(err) {
+		t.Fatalf("err should be an authorization error because of the preloaded abilities: %v", err)
+	}
+
+	err = driver.PreloadAbilities(users)
+	if err != nil || calls != 1 {
+		t.Fatalf("cached role sets should not be fetched again: %v %d", err, calls)
+	}
+
+	uncached, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, &tokenService, &roleService), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	if uncached.PreloadAbilities(users) == nil {
+		t.Fatal("err should not be nil because of the disabled ability cache")
+	}
+}
+
+type batchingRoleService struct {
+	*myRoleService
+	batches *[][]string
+}
+
+func (service batchingRoleService) FindByIDs(ids []string) ([]gate.Role, error) {
+	*service.batches = append(*service.batches, ids)
+	return service.myRoleService.FindByIDs(ids)
+}
+
+func (service batchingRoleService) ForEachAbility(ids []string, fn func(gate.Role, gate.UserAbility) bool) error {
+	*service.batches = append(*service.batches, ids)
+	return lazyRoleService{service.myRoleService}.ForEachAbility(ids, fn)
+}
+
+func TestRoleBatches(t *testing.T) {
+	records := roleService.records
+	heavy := user{id: "heavy", roles: []string{records[0].id, records[0].id, records[1].id, records[2].id, records[1].id}}
+
+	for _, cached := range []bool{true, false} {
+		var batches [][]string
+		config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+		config.SetRoleBatchSize(2)
+		if cached {
+			config.SetAbilityCacheTTL(time.Minute)
+		}
+
+		dependencies := gate.NewDependencies(&userService, &tokenService, batchingRoleService{&roleService, &batches})
+		driver, err := New(config, dependencies, nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+
+		err = driver.Authorize(heavy, "POST", "/api/v1/posts")
+		if err != nil {
+			t.Fatalf("err should be nil because of the merged batches: %s", err)
+		}
+
+		if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 || batches[1][0] != records[2].id {
+			t.Fatalf("role IDs should be deduplicated and batched: %v", batches)
+		}
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	dependencies := gate.NewDependencies(&userService, &tokenService, &roleService)
+	dependencies.SetAuthorizer(authorizerFunc(func(user gate.User, action, object string) error {
+		if action == "GET" {
+			return nil
+		}
+
+		return ErrForbidden
+	}))
+
+	remote, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	u := user{id: "remote", roles: nil}
+
+	err = remote.Authorize(u, "GET", "/anything")
+	if err != nil {
+		t.Fatalf("err should be nil because the authorizer allows the action: %s", err)
+	}
+
+	err = remote.Authorize(u, "POST", "/anything")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the authorizer denies the action: %v", err)
+	}
+}
+
+func TestDecisionCache(t *testing.T) {
+	roles := myRoleService{}
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetDecisionCacheTTL(time.Hour)
+
+	var calls int
+	dependencies := gate.NewDependencies(&userService, &tokenService, &roles)
+	cached, err := New(config, dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	err = cached.CreateRole("editor", []gate.UserAbility{ability{"GET", "/posts*"}})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	u := user{id: "cached", roles: []string{"editor"}}
+	dependencies.SetAuthorizer(authorizerFunc(func(user gate.User, action, object string) error {
+		calls++
+		return ErrForbidden
+	}))
+
+	for i := 0; i < 3; i++ {
+		err = cached.Authorize(u, "POST", "/posts")
+		if err != ErrForbidden {
+			t.Fatalf("err should be ErrForbidden because of the denying authorizer: %v", err)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("decision should be memoized: %d calls", calls)
+	}
+
+	_ = cached.SimulateAuthorize(u, "POST", "/posts")
+	if calls != 2 {
+		t.Fatalf("simulations should bypass the decision cache: %d calls", calls)
+	}
+	calls = 1
+
+	err = cached.AttachAbility("editor", ability{"POST", "/posts*"})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	_ = cached.Authorize(u, "POST", "/posts")
+	if calls != 2 {
+		t.Fatalf("decisions of the changed role should be invalidated: %d calls", calls)
+	}
+}
+
+func TestOpaqueTokens(t *testing.T) {
+	tokens := myTokenService{}
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetOpaqueTokens(true)
+
+	opaque, err := New(config, gate.NewDependencies(&userService, &tokens, &roleService), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	u, err := userService.findOneByUsername("foo")
+	if err != nil {
+		t.Fatalf("err should be nil because of the existing user: %s", err)
+	}
+
+	t.Run("authenticate", func(t *testing.T) {
+		token, err := opaque.IssueJWT(u)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if token.Value != token.ID || strings.Count(token.Value, ".") != 0 {
+			t.Fatalf("token should be an opaque reference: %s", token.Value)
+		}
+
+		authenticated, err := opaque.Authenticate(token.Value)
+		if err != nil {
+			t.Fatalf("err should be nil because of the stored token: %s", err)
+		}
+
+		if authenticated.GetID() != u.GetID() {
+			t.Fatalf("id mismatch: %s - %s", authenticated.GetID(), u.GetID())
+		}
+	})
+
+	t.Run("single use", func(t *testing.T) {
+		token, err := opaque.IssueSingleUseJWT(u)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = opaque.Authenticate(token.Value)
+		if err != nil {
+			t.Fatalf("err should be nil because of the first use: %s", err)
+		}
+
+		_, err = opaque.Authenticate(token.Value)
+		if err != ErrTokenConsumed {
+			t.Fatalf("err should be ErrTokenConsumed because of the replay: %v", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		err := tokens.Store(gate.JWT{ID: "expired", UserID: u.GetID(), ExpiredAt: time.Now().Add(-time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = opaque.Authenticate("expired")
+		if err == nil {
+			t.Fatal("err should not be nil because of the expired token")
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		token, err := opaque.IssueJWT(u)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		tokens.records = nil
+		_, err = opaque.Authenticate(token.Value)
+		if err == nil {
+			t.Fatal("err should not be nil because of the revoked token")
+		}
+	})
+}
+
+type countingRoleService struct {
+	myRoleService
+	visited int
+}
+
+func (service *countingRoleService) ForEachAbility(ids []string, fn func(gate.Role, gate.UserAbility) bool) error {
+	return lazyRoleService{&service.myRoleService}.ForEachAbility(ids, func(role gate.Role, ability gate.UserAbility) bool {
+		service.visited++
+		return fn(role, ability)
+	})
+}
+
+func TestLazyAuthorization(t *testing.T) {
+	roles := &countingRoleService{myRoleService: myRoleService{[]role{{"lazy", []ability{
+		{"GET", "/api/*"},
+		{"POST", "/api/*"},
+		{"DELETE", "/api/*"},
+	}}}}}
+
+	lazy, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, &tokenService, roles), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	u := user{id: "lazy", roles: []string{"lazy"}}
+
+	err = lazy.Authorize(u, "GET", "/api/posts")
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid abilities: %s", err)
+	}
+
+	if roles.visited != 1 {
+		t.Fatalf("the iteration should stop at the first match: %d", roles.visited)
+	}
+
+	err = lazy.Authorize(u, "PATCH", "/api/posts")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because of the invalid abilities: %v", err)
+	}
+
+	err = lazy.Authorize(user{id: "lazy", roles: []string{"missing"}}, "GET", "/api/posts")
+	if err != ErrNoAbilities {
+		t.Fatalf("err should be ErrNoAbilities because of the missing role: %v", err)
+	}
+
+	t.Run("role service", func(t *testing.T) {
+		streamed, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, &tokenService, lazyRoleService{&roleService}), nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+
+		u, err := userService.findOneByUsername("foo")
+		if err != nil {
+			t.Fatalf("err should be nil because of the existing user: %s", err)
+		}
+
+		for _, object := range []string{"/api", "/api/v1/users", "/api/v1/posts"} {
+			err = streamed.Authorize(u, "GET", object)
+			if err != nil {
+				t.Fatalf("err should be nil because of the valid abilities: %s", err)
+			}
+		}
+
+		err = streamed.Authorize(u, "POST", "/api/v1/posts")
+		if err != ErrForbidden {
+			t.Fatalf("err should be ErrForbidden because of the invalid abilities: %v", err)
+		}
+	})
+}
+
+type lazyBoundedRoleService struct {
+	boundedRoleService
+}
+
+func (service lazyBoundedRoleService) ForEachAbility(ids []string, fn func(gate.Role, gate.UserAbility) bool) error {
+	for _, id := range ids {
+		role, ok := service.boundedRoleService[id]
+		if !ok {
+			continue
+		}
+
+		for _, ability := range role.abilities {
+			if !fn(role, ability) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func TestLazyTimeBoundedAuthorization(t *testing.T) {
+	// 2020-11-10 is a Tuesday
+	now := time.Date(2020, time.November, 10, 16, 59, 0, 0, time.UTC)
+	roles := lazyBoundedRoleService{boundedRoleService{
+		"oncall": {[]gate.UserAbility{ability{"GET", "/incidents"}}, window{expiresAt: now.Add(time.Minute)}},
+		"editor": {[]gate.UserAbility{ability{"GET", "/posts"}}, window{notBefore: now.Add(time.Minute)}},
+		"deployer": {[]gate.UserAbility{
+			scheduledAbility{ability{"POST", "/deployments"}, gate.Schedule{From: 9 * time.Hour, To: 17 * time.Hour}},
+		}, window{}},
+	}}
+
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetDecisionCacheTTL(time.Hour * 24)
+	config.SetScheduleLocation(time.UTC)
+	dependencies := gate.NewDependencies(&userService, &tokenService, roles)
+	dependencies.SetClock(gate.ClockFunc(func() time.Time {
+		return now
+	}))
+
+	lazy, err := New(config, dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	u := user{id: "temporary", roles: []string{"oncall", "editor", "deployer"}}
+	for _, check := range []struct {
+		action, object string
+		expected       error
+	}{
+		{"GET", "/incidents", nil},
+		{"GET", "/posts", ErrForbidden},
+		{"POST", "/deployments", nil},
+	} {
+		err = lazy.Authorize(u, check.action, check.object)
+		if err != check.expected {
+			t.Fatalf("err should be %v because of the validity windows and the schedules: %v", check.expected, err)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	for _, check := range []struct {
+		action, object string
+		expected       error
+	}{
+		{"GET", "/incidents", ErrForbidden},
+		{"GET", "/posts", nil},
+		{"POST", "/deployments", ErrForbidden},
+	} {
+		err = lazy.Authorize(u, check.action, check.object)
+		if err != check.expected {
+			t.Fatalf("err should be %v because the cached decisions expire with the windows and the schedules: %v", check.expected, err)
+		}
+	}
+}
+
+func BenchmarkAuthorize(b *testing.B) {
+	for _, count := range []int{10, 1000, 5000} {
+		abilities := make([]ability, count)
+		for i := range abilities {
+			abilities[i] = ability{"GET", fmt.Sprintf("/api/v1/resources-%d/*", i)}
+		}
+
+		roles := myRoleService{[]role{{"benchmark", abilities}}}
+		benchmarked, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, &tokenService, &roles), nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		u := user{id: "benchmark", roles: []string{"benchmark"}}
+		b.Run(fmt.Sprintf("abilities/%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				benchmarked.Authorize(u, "GET", fmt.Sprintf("/api/v1/resources-%d/1", count-1))
+			}
+		})
+	}
+}
+
+func BenchmarkAuthorizeIndex(b *testing.B) {
+	for _, count := range []int{10, 1000, 5000} {
+		abilities := make([]ability, count)
+		for i := range abilities {
+			abilities[i] = ability{"GET", fmt.Sprintf("/api/v1/resources-%d", i)}
+		}
+
+		roles := myRoleService{[]role{{"benchmark", abilities}}}
+		config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+		config.SetAbilityCacheTTL(time.Hour)
+
+		benchmarked, err := New(config, gate.NewDependencies(&userService, &tokenService, &roles), nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		u := user{id: "benchmark", roles: []string{"benchmark"}}
+		object := fmt.Sprintf("/api/v1/resources-%d", count-1)
+
+		b.Run(fmt.Sprintf("exact/%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				benchmarked.Authorize(u, "GET", object)
+			}
+		})
+
+		b.Run(fmt.Sprintf("forbidden/%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				benchmarked.Authorize(u, "DELETE", object)
+			}
+		})
+	}
+}
+
+func TestShadowAuthorization(t *testing.T) {
+	user := userService.records[0]
+	shadowRoles := myRoleService{[]role{
+		{user.roles[0], []ability{{"GET", "/api/v1/*"}}},
+		{user.roles[1], []ability{{"DELETE", "/api/v1/posts*"}}},
+	}}
+
+	events := make(chan gate.AuditEvent, 4)
+	dependencies := gate.NewDependencies(&userService, &tokenService, &roleService)
+	dependencies.SetShadowAuthorizer(gate.NewRoleAuthorizer(&shadowRoles, gate.NewMatcher()))
+	dependencies.AddAuditHook(func(event gate.AuditEvent) {
+		events <- event
+	})
+
+	shadowed, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	err = shadowed.Authorize(user, "GET", "/api/v2/posts")
+	if err != nil {
+		t.Fatalf("err should be nil because the shadow policy does not affect the decision: %s", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != gate.AuditShadowDivergence || !event.Allowed() || event.ShadowAllowed() || event.Object != "/api/v2/posts" {
+			t.Fatalf("the divergence should be reported: %v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the divergence should be reported")
+	}
+
+	err = shadowed.Authorize(user, "DELETE", "/api/v1/posts")
+	if err == nil {
+		t.Fatal("err should not be nil because the shadow policy does not affect the decision")
+	}
+
+	select {
+	case event := <-events:
+		if event.Allowed() || !event.ShadowAllowed() {
+			t.Fatalf("the divergence should be reported: %v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the divergence should be reported")
+	}
+
+	err = shadowed.Authorize(user, "GET", "/api/v1/posts")
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("agreeing decisions should not be reported: %v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPermissionSets(t *testing.T) {
+	document := policy.Document{
+		Roles: []policy.Role{
+			{ID: "writer", Abilities: []policy.Ability{{Action: "GET", Object: "/profile"}}, PermissionSets: []string{"content-editor"}},
+			{ID: "broken", PermissionSets: []string{"missing"}},
+		},
+		PermissionSets: []policy.PermissionSet{
+			{Name: "content-editor", Abilities: []policy.Ability{{Action: "GET", Object: "/posts*"}, {Action: "POST", Object: "/posts*"}}},
+		},
+	}
+
+	dependencies := gate.NewDependencies(&userService, &tokenService, document)
+	dependencies.SetPermissionSetService(document)
+	bundled, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	writer := user{id: "writer", username: "writer", roles: []string{"writer"}}
+	abilities, err := bundled.GetUserAbilities(writer)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	if len(abilities) != 3 {
+		t.Fatalf("the abilities of the permission set should be resolved: %v", abilities)
+	}
+
+	err = bundled.Authorize(writer, "POST", "/posts/1")
+	if err != nil {
+		t.Fatalf("err should be nil because of the permission set: %s", err)
+	}
+
+	_, err = bundled.GetUserAbilities(user{id: "broken", username: "broken", roles: []string{"broken"}})
+	if err == nil || !strings.Contains(err.Error(), gate.ErrPermissionSetNotFound.Error()) {
+		t.Fatalf("err should be ErrPermissionSetNotFound because of the missing permission set: %v", err)
+	}
+}
+
+type countingUserService struct {
+	myUserService
+	lookups int
+	err     error
+}
+
+func (service *countingUserService) FindOneByID(id string) (gate.User, error) {
+	service.lookups++
+	if service.err != nil {
+		return nil, service.err
+	}
+	return service.myUserService.FindOneByID(id)
+}
+
+func TestNegativeCache(t *testing.T) {
+	users := &countingUserService{myUserService: userService}
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetNegativeCacheTTL(time.Minute)
+	cached, err := New(config, gate.NewDependencies(users, &tokenService, &roleService), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	deleted := user{id: "deleted", username: "deleted"}
+	token, err := cached.IssueJWT(deleted)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = cached.Authenticate(token.Value)
+		if err == nil {
+			t.Fatal("err should not be nil because of the deleted user")
+		}
+	}
+
+	if users.lookups != 1 {
+		t.Fatalf("the missing user should be looked up once: %d", users.lookups)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = cached.Authenticate("invalid-token")
+		if err == nil {
+			t.Fatal("err should not be nil because of the invalid token")
+		}
+	}
+
+	stats := cached.dependencies.NegativeCache().Stats()
+	if stats.Hits != 4 || stats.Entries != 2 {
+		t.Fatalf("the failures should be remembered: %+v", stats)
+	}
+
+	_, err = cached.IssueJWT(deleted)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	_, err = cached.Authenticate(token.Value)
+	if err == nil || users.lookups != 2 {
+		t.Fatalf("the user should be looked up again once a token is issued: %d", users.lookups)
+	}
+
+	t.Run("storage failures", func(t *testing.T) {
+		alice, err := cached.IssueJWT(userService.records[0])
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		users.err, users.lookups = errors.New("connection refused"), 0
+		for i := 0; i < 2; i++ {
+			_, err = cached.Authenticate(alice.Value)
+			if err == nil {
+				t.Fatal("err should not be nil because of the storage failure")
+			}
+		}
+
+		if users.lookups != 2 {
+			t.Fatalf("storage failures should not be remembered: %d", users.lookups)
+		}
+
+		users.err = nil
+		_, err = cached.Authenticate(alice.Value)
+		if err != nil {
+			t.Fatalf("err should be nil because the user service is available again: %s", err)
+		}
+	})
+}
+
+func TestErrorRedaction(t *testing.T) {
+	logger := &recordingLogger{}
+	dependencies := gate.NewDependencies(&userService, &tokenService, &roleService)
+	dependencies.SetLogger(logger)
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetErrorRedactor(gate.RedactErrors)
+	redacted, err := New(config, dependencies, driver.handler)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	token, err := redacted.IssueJWT(user{id: "deleted", username: "deleted"})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	_, err = redacted.Authenticate(token.Value)
+	if err == nil || err.Error() != gate.ErrAuthenticationFailed.Error() {
+		t.Fatalf("err should be redacted: %v", err)
+	}
+
+	if !strings.Contains(gate.Internal(err).Error(), "could not find the user with the given id") {
+		t.Fatalf("the internal error should be kept: %v", gate.Internal(err))
+	}
+
+	users := &countingUserService{myUserService: userService, err: errors.New("connection refused")}
+	outage := gate.NewDependencies(users, &tokenService, &roleService)
+	unavailable, err := New(config, outage, driver.handler)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	alice, err := unavailable.IssueJWT(userService.records[0])
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	_, err = unavailable.Authenticate(alice.Value)
+	if errors.Cause(err) != gate.ErrAuthenticationUnavailable || gate.IsAuthenticationError(err) {
+		t.Fatalf("err should be ErrAuthenticationUnavailable because the storage failure is not an authentication failure: %v", err)
+	}
+
+	_, err = redacted.Login(map[string]string{"username": "foo", "password": "wrong"})
+	if err == nil || err.Error() != gate.ErrLoginFailed.Error() {
+		t.Fatalf("err should be redacted: %v", err)
+	}
+
+	err = redacted.Authorize(userService.records[0], "DELETE", "/api/v1/posts")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden as is: %v", err)
+	}
+
+	found := false
+	for _, message := range logger.messages {
+		if strings.Contains(message, "error redacted") && strings.Contains(message, "could not find the user") {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("the redaction should be logged with the internal error")
+	}
+}
+
+type fetchCountingRoleService struct {
+	myRoleService
+	fetches int
+}
+
+func (service *fetchCountingRoleService) FindByIDs(ids []string) ([]gate.Role, error) {
+	service.fetches++
+	return service.myRoleService.FindByIDs(ids)
+}
+
+func TestAuthzContext(t *testing.T) {
+	roles := &fetchCountingRoleService{myRoleService: roleService}
+	scoped, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, &tokenService, roles), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	token, err := scoped.IssueJWT(userService.records[0])
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	ctx, err := scoped.NewAuthzContext(token.Value, "acme")
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid token: %s", err)
+	}
+
+	if ctx.User.GetID() != userService.records[0].id || ctx.Token.ID != token.ID || ctx.Tenant != "acme" {
+		t.Fatalf("the context should carry the user, the token and the tenant: %v", ctx)
+	}
+
+	for _, object := range []string{"/api/v1/posts", "/api/v1/users", "/api/v2/posts"} {
+		err = scoped.AuthorizeContext(ctx, "GET", object)
+		if err != nil {
+			t.Fatalf("err should be nil because of the abilities: %s", err)
+		}
+	}
+
+	err = scoped.AuthorizeContext(ctx, "DELETE", "/api/v1/posts")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden: %v", err)
+	}
+
+	if roles.fetches != 1 {
+		t.Fatalf("roles should be fetched once within the context: %d", roles.fetches)
+	}
+
+	if _, ok := ctx.Abilities(); !ok {
+		t.Fatal("the abilities should be kept by the context")
+	}
+
+	_, err = scoped.NewAuthzContext("invalid", "")
+	if err == nil {
+		t.Fatal("err should not be nil because of the invalid token")
+	}
+
+	t.Run("tenants", func(t *testing.T) {
+		config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+		config.SetDecisionCacheTTL(time.Minute)
+		tenanted, err := NewAuthorizer(config, gate.NewDependencies(&userService, &tokenService, &roleService))
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+
+		member := tenantMember{
+			user{id: "member", roles: []string{roleService.records[2].id}},
+			map[string][]string{"acme": {roleService.records[0].id}, "other": {roleService.records[2].id}},
+		}
+
+		err = tenanted.AuthorizeContext(gate.NewAuthzContext(member, gate.JWT{}, "acme"), "GET", "/api/v1/posts")
+		if err != nil {
+			t.Fatalf("err should be nil because of the roles of the user in the tenant: %s", err)
+		}
+
+		err = tenanted.AuthorizeContext(gate.NewAuthzContext(member, gate.JWT{}, "other"), "GET", "/api/v1/posts")
+		if err != ErrForbidden {
+			t.Fatalf("err should be ErrForbidden because the decision of another tenant is not reused: %v", err)
+		}
+
+		err = tenanted.AuthorizeContext(gate.NewAuthzContext(member, gate.JWT{}, ""), "POST", "/api/v1/posts")
+		if err != nil {
+			t.Fatalf("err should be nil because of the roles of the user without a tenant: %s", err)
+		}
+	})
+}
+
+type tenantMember struct {
+	user
+	tenants map[string][]string
+}
+
+func (member tenantMember) GetTenantRoles(tenant string) []string {
+	return member.tenants[tenant]
+}
+
+type flakyTokenService struct {
+	managedTokenService
+	failures int
+	release  chan struct{}
+	*sync.Mutex
+}
+
+func (service *flakyTokenService) Store(jwt gate.JWT) error {
+	if service.release != nil {
+		<-service.release
+	}
+
+	service.Lock()
+	defer service.Unlock()
+
+	if service.failures > 0 {
+		service.failures--
+		return errors.New("storage is unavailable")
+	}
+
+	return service.managedTokenService.Store(jwt)
+}
+
+func (service *flakyTokenService) FindOneByID(id string) (gate.JWT, error) {
+	service.Lock()
+	defer service.Unlock()
+
+	return service.managedTokenService.FindOneByID(id)
+}
+
+func TestTokenStoragePolicies(t *testing.T) {
+	user, err := userService.findOneByUsername("foo")
+	if err != nil {
+		t.Fatalf("err should be nil because of the existing user: %s", err)
+	}
+
+	newDriver := func(policy gate.StoragePolicy, service *flakyTokenService) (*Driver, *recordingLogger) {
+		logger := &recordingLogger{}
+		dependencies := gate.NewDependencies(&userService, service, &roleService)
+		dependencies.SetLogger(logger)
+		config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+		config.SetTokenStoragePolicy(policy)
+		config.SetTokenStorageRetry(2, time.Millisecond)
+		stored, err := New(config, dependencies, nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+		return stored, logger
+	}
+
+	newService := func(failures int) *flakyTokenService {
+		return &flakyTokenService{managedTokenService{&myTokenService{}}, failures, nil, &sync.Mutex{}}
+	}
+
+	t.Run("fail closed", func(t *testing.T) {
+		stored, _ := newDriver(gate.StorageFailClosed, newService(1))
+		_, err := stored.IssueJWT(user)
+		if err == nil {
+			t.Fatal("err should not be nil because the token could not be stored")
+		}
+	})
+
+	t.Run("fail open", func(t *testing.T) {
+		stored, logger := newDriver(gate.StorageFailOpen, newService(1))
+		token, err := stored.IssueJWT(user)
+		if err != nil {
+			t.Fatalf("err should be nil because the policy fails open: %s", err)
+		}
+
+		if token.Value == "" || len(logger.messages) != 1 || !strings.Contains(logger.messages[0], "token issued without being stored") {
+			t.Fatalf("the failure should be logged: %v", logger.messages)
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		stored, _ := newDriver(gate.StorageRetry, newService(1))
+		_, err := stored.IssueJWT(user)
+		if err != nil {
+			t.Fatalf("err should be nil because the second attempt succeeds: %s", err)
+		}
+
+		stored, _ = newDriver(gate.StorageRetry, newService(2))
+		_, err = stored.IssueJWT(user)
+		if err == nil {
+			t.Fatal("err should not be nil because every attempt failed")
+		}
+	})
+
+	t.Run("write-behind", func(t *testing.T) {
+		service := newService(0)
+		service.release = make(chan struct{})
+		stored, _ := newDriver(gate.StorageWriteBehind, service)
+		writer := stored.dependencies.TokenWriteBehind()
+		if !writer.Enabled() {
+			t.Fatal("the write-behind queue should be started")
+		}
+
+		token, err := stored.IssueJWT(user)
+		if err != nil {
+			t.Fatalf("err should be nil because the token is queued: %s", err)
+		}
+
+		_, err = stored.Authenticate(token.Value)
+		if err != nil {
+			t.Fatalf("err should be nil because the queued token is not revoked: %s", err)
+		}
+
+		close(service.release)
+		stored.Close()
+
+		if _, err := service.FindOneByID(token.ID); err != nil {
+			t.Fatalf("the token should be stored asynchronously: %s", err)
+		}
+
+		_, err = stored.Authenticate(token.Value)
+		if err != nil {
+			t.Fatalf("err should be nil because the token is stored: %s", err)
+		}
+
+		stored.Close()
+		token, err = stored.IssueJWT(user)
+		if err != nil {
+			t.Fatalf("err should be nil because the token is stored synchronously after the driver is closed: %s", err)
+		}
+
+		if _, err := service.FindOneByID(token.ID); err != nil {
+			t.Fatalf("the token should be stored synchronously: %s", err)
+		}
+	})
+
+	t.Run("write-behind failures", func(t *testing.T) {
+		stored, logger := newDriver(gate.StorageWriteBehind, newService(2))
+		_, err := stored.IssueJWT(user)
+		if err != nil {
+			t.Fatalf("err should be nil because the token is queued: %s", err)
+		}
+
+		stored.dependencies.TokenWriteBehind().Close()
+		if len(logger.messages) != 1 || !strings.Contains(logger.messages[0], "could not store the token") {
+			t.Fatalf("the failure should be logged: %v", logger.messages)
+		}
+	})
+}
+
+type purgingTokenService struct {
+	managedTokenService
+	*sync.Mutex
+}
+
+func (service purgingTokenService) Store(jwt gate.JWT) error {
+	service.Lock()
+	defer service.Unlock()
+
+	return service.managedTokenService.Store(jwt)
+}
+
+func (service purgingTokenService) PurgeExpired(before time.Time) (purged int, err error) {
+	service.Lock()
+	defer service.Unlock()
+
+	records := service.records[:0]
+	for _, record := range service.records {
+		if record.expiredAt.Before(before) {
+			purged++
+			continue
+		}
+
+		records = append(records, record)
+	}
+	service.records = records
+	return
+}
+
+func (service purgingTokenService) CountByUser(userID string) (count int, err error) {
+	service.Lock()
+	defer service.Unlock()
+
+	for _, record := range service.records {
+		if record.userID == userID {
+			count++
+		}
+	}
+	return
+}
+
+func TestTokenMaintenance(t *testing.T) {
+	user, err := userService.findOneByUsername("foo")
+	if err != nil {
+		t.Fatalf("err should be nil because of the existing user: %s", err)
+	}
+
+	service := purgingTokenService{managedTokenService{&myTokenService{}}, &sync.Mutex{}}
+	logger := &recordingLogger{}
+	dependencies := gate.NewDependencies(&userService, service, &roleService)
+	dependencies.SetLogger(logger)
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	maintained, err := New(config, dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := driver.PurgeExpiredJWTs(time.Now())
+		if err == nil {
+			t.Fatal("err should not be nil because the token service does not support the maintenance of tokens")
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			_, err := maintained.IssueJWT(user)
+			if err != nil {
+				t.Fatalf("err should be nil: %s", err)
+			}
+		}
+
+		count, err := maintained.CountJWTs(user.GetID())
+		if err != nil || count != 2 {
+			t.Fatalf("tokens should be counted: %d %v", count, err)
+		}
+
+		purged, err := maintained.PurgeExpiredJWTs(time.Now())
+		if err != nil || purged != 0 {
+			t.Fatalf("tokens should not be purged before they expire: %d %v", purged, err)
+		}
+
+		purged, err = maintained.PurgeExpiredJWTs(time.Now().Add(2 * time.Hour))
+		if err != nil || purged != 2 {
+			t.Fatalf("expired tokens should be purged: %d %v", purged, err)
+		}
+	})
+
+	t.Run("janitor", func(t *testing.T) {
+		if dependencies.TokenJanitor().Enabled() {
+			t.Fatal("the janitor should be disabled by default")
+		}
+
+		janitorDependencies := gate.NewDependencies(&userService, service, &roleService)
+		janitorDependencies.SetClock(gate.ClockFunc(func() time.Time {
+			return time.Now().Add(2 * time.Hour)
+		}))
+		config.SetTokenPurge(time.Millisecond, 0)
+		janitored, err := New(config, janitorDependencies, nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+
+		janitor := janitorDependencies.TokenJanitor()
+		if !janitor.Enabled() {
+			t.Fatal("the janitor should be started")
+		}
+
+		token := gate.JWT{ID: "expired", UserID: user.GetID(), ExpiredAt: time.Now()}
+		if err := janitored.StoreJWT(token); err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			count, _ := janitored.CountJWTs(user.GetID())
+			if count == 0 {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatal("the expired token should be purged by the janitor")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		janitored.Close()
+		janitored.Close()
+	})
+}
+
+func TestSessionLimits(t *testing.T) {
+	user, err := userService.findOneByUsername("foo")
+	if err != nil {
+		t.Fatalf("err should be nil because of the existing user: %s", err)
+	}
+
+	newDriver := func(policy gate.SessionLimitPolicy) *Driver {
+		config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+		config.SetMaxSessions(2, policy)
+		limited, err := New(config, gate.NewDependencies(&userService, newSessionTokenService(), &roleService), nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+		return limited
+	}
+
+	t.Run("session store", func(t *testing.T) {
+		config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+		config.SetMaxSessions(2, gate.SessionRejectNew)
+		_, err := New(config, gate.NewDependencies(&userService, managedTokenService{&myTokenService{}}, &roleService), nil)
+		if err == nil {
+			t.Fatal("err should not be nil because the token service is not a session store")
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		limited := newDriver(gate.SessionRejectNew)
+		for i := 0; i < 2; i++ {
+			_, err := limited.IssueJWT(user)
+			if err != nil {
+				t.Fatalf("err should be nil because of the limit: %s", err)
+			}
+		}
+
+		_, err := limited.IssueJWT(user)
+		if err != ErrSessionLimitExceeded {
+			t.Fatalf("err should be ErrSessionLimitExceeded: %v", err)
+		}
+
+		_, err = limited.IssueSingleUseJWT(user)
+		if err != nil {
+			t.Fatalf("err should be nil because single-use tokens are not sessions: %s", err)
+		}
+
+		other, err := userService.findOneByUsername("bar")
+		if err != nil {
+			t.Fatalf("err should be nil because of the existing user: %s", err)
+		}
+
+		_, err = limited.IssueJWT(other)
+		if err != nil {
+			t.Fatalf("err should be nil because sessions are limited per user: %s", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		limited := newDriver(gate.SessionRejectNew)
+		for i := 0; i < 2; i++ {
+			_, err := limited.IssueJWT(user)
+			if err != nil {
+				t.Fatalf("err should be nil because of the limit: %s", err)
+			}
+		}
+
+		limited.Now = func() time.Time {
+			return time.Now().Add(2 * time.Hour)
+		}
+
+		sessions, err := limited.Sessions(user.GetID())
+		if err != nil || len(sessions) != 0 {
+			t.Fatalf("expired tokens should not be active sessions: %d %v", len(sessions), err)
+		}
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		limited := newDriver(gate.SessionEvictOldest)
+		var tokens []gate.JWT
+		for i := 0; i < 3; i++ {
+			token, err := limited.IssueJWT(user)
+			if err != nil {
+				t.Fatalf("err should be nil because the oldest session is evicted: %s", err)
+			}
+			tokens = append(tokens, token)
+			time.Sleep(time.Millisecond)
+		}
+
+		sessions, err := limited.Sessions(user.GetID())
+		if err != nil || len(sessions) != 2 {
+			t.Fatalf("sessions should be limited: %d %v", len(sessions), err)
+		}
+
+		_, err = limited.Authenticate(tokens[0].Value)
+		if err == nil {
+			t.Fatal("err should not be nil because the oldest session is evicted")
+		}
+
+		_, err = limited.Authenticate(tokens[2].Value)
+		if err != nil {
+			t.Fatalf("err should be nil because of the new session: %s", err)
+		}
+	})
+
+	t.Run("derived tokens", func(t *testing.T) {
+		limited := newDriver(gate.SessionEvictOldest)
+		login, err := limited.IssueJWT(user)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		var derived []gate.JWT
+		for i := 0; i < 2; i++ {
+			token, err := limited.ExchangeJWT(login.Value, "gateway", []gate.UserAbility{ability{"GET", "/api/v1/users"}}, time.Minute)
+			if err != nil {
+				t.Fatalf("err should be nil because exchanged tokens are not sessions: %s", err)
+			}
+			derived = append(derived, token)
+		}
+
+		scoped, err := limited.IssueScopedJWT(user, []gate.AbilityCheck{{Action: "GET", Object: "/api/v1/users"}}, time.Minute)
+		if err != nil {
+			t.Fatalf("err should be nil because scoped tokens are not sessions: %s", err)
+		}
+
+		sessions, err := limited.Sessions(user.GetID())
+		if err != nil || len(sessions) != 1 {
+			t.Fatalf("derived tokens should not be sessions: %d %v", len(sessions), err)
+		}
+
+		_, err = limited.IssueJWT(user)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		for _, token := range append(derived, scoped, login) {
+			_, err = limited.Authenticate(token.Value)
+			if err != nil {
+				t.Fatalf("err should be nil because the main login is not evicted by derived tokens: %s", err)
+			}
+		}
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		limited := newDriver(gate.SessionRejectNew)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				limited.IssueJWT(user)
+			}()
+		}
+		wg.Wait()
+
+		sessions, err := limited.Sessions(user.GetID())
+		if err != nil || len(sessions) != 2 {
+			t.Fatalf("concurrent logins should not exceed the limit: %d %v", len(sessions), err)
+		}
+	})
+}
+
+func TestStepUp(t *testing.T) {
+	document := policy.Document{
+		Roles: []policy.Role{{ID: "owner", Abilities: []policy.Ability{
+			{Action: "GET", Object: "/accounts/*"},
+			{Action: "DELETE", Object: "/accounts/*", StepUp: true},
+		}}},
+	}
+
+	dependencies := gate.NewDependencies(&userService, &tokenService, document)
+	dependencies.SetRiskEvaluator(gate.MaxTokenAge(time.Minute))
+	guarded, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	owner := user{id: "owner", username: "owner", roles: []string{"owner"}}
+
+	t.Run("without context", func(t *testing.T) {
+		err := guarded.Authorize(owner, "GET", "/accounts/1")
+		if err != nil {
+			t.Fatalf("err should be nil because the ability is not sensitive: %s", err)
+		}
+
+		err = guarded.Authorize(owner, "DELETE", "/accounts/1")
+		if err != nil {
+			t.Fatalf("err should be nil because the token age is not judged without a token: %s", err)
+		}
+
+		err = guarded.Authorize(owner, "PUT", "/accounts/1")
+		if err != ErrForbidden {
+			t.Fatalf("err should be ErrForbidden because no ability matches: %v", err)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx := gate.NewAuthzContext(owner, gate.JWT{IssuedAt: time.Now()}, "")
+		err := guarded.AuthorizeContext(ctx, "DELETE", "/accounts/1")
+		if err != nil {
+			t.Fatalf("err should be nil because the token is recent: %s", err)
+		}
+
+		ctx = gate.NewAuthzContext(owner, gate.JWT{IssuedAt: time.Now().Add(-time.Hour)}, "")
+		err = guarded.AuthorizeContext(ctx, "DELETE", "/accounts/1")
+		if err != ErrStepUpRequired {
+			t.Fatalf("err should be ErrStepUpRequired because the token is old: %v", err)
+		}
+
+		ctx = gate.NewAuthzContext(owner, gate.JWT{Value: "token"}, "")
+		err = guarded.AuthorizeContext(ctx, "DELETE", "/accounts/1")
+		if err != ErrStepUpRequired {
+			t.Fatalf("err should be ErrStepUpRequired because the issuance time of the token is unknown: %v", err)
+		}
+	})
+
+	t.Run("without evaluator", func(t *testing.T) {
+		unguarded, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, &tokenService, document), nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+
+		err = unguarded.Authorize(owner, "DELETE", "/accounts/1")
+		if err != nil {
+			t.Fatalf("err should be nil because there is no risk evaluator: %s", err)
+		}
+	})
+}
+
+func TestPermittedFields(t *testing.T) {
+	document := policy.Document{
+		Roles: []policy.Role{{ID: "editor", Abilities: []policy.Ability{
+			{Action: "read", Object: "posts.title"},
+			{Action: "read", Object: "posts.body"},
+			{Action: "read", Object: "comments"},
+		}}},
+	}
+
+	auth, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, &tokenService, document), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	editor := user{id: "editor", username: "editor", roles: []string{"editor"}}
+
+	t.Run("user", func(t *testing.T) {
+		set, err := auth.PermittedFields(editor, "read", "posts")
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if !set.Has("title") || !set.Has("body") || set.Has("author") {
+			t.Fatalf("invalid fields: %v", set.Fields())
+		}
+
+		set, err = auth.PermittedFields(editor, "read", "comments")
+		if err != nil || !set.All() {
+			t.Fatalf("every field should be permitted: %v", err)
+		}
+	})
+
+	t.Run("delegated", func(t *testing.T) {
+		delegated := gate.DelegatedUser{User: editor, Abilities: []gate.AbilityClaim{{Action: "read", Object: "posts.title"}}}
+		set, err := auth.PermittedFields(delegated, "read", "posts")
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if !set.Has("title") || set.Has("body") {
+			t.Fatalf("scopes should narrow the fields: %v", set.Fields())
+		}
+	})
+
+	t.Run("authorizer", func(t *testing.T) {
+		dependencies := gate.NewDependencies(&userService, &tokenService, document)
+		dependencies.SetAuthorizer(authorizerFunc(func(user gate.User, action, object string) error {
+			if object == "posts.title" {
+				return nil
+			}
+
+			return ErrForbidden
+		}))
+
+		external, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), dependencies, nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+
+		set, err := external.PermittedFields(editor, "read", "posts", "title", "body")
+		if err != nil || set.Has("body") || !set.Has("title") {
+			t.Fatalf("candidates should be checked by the authorizer: %v %v", err, set.Fields())
+		}
+	})
+}
+
+func TestReloadJWTConfig(t *testing.T) {
+	reloaded, err := New(gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false), gate.NewDependencies(&userService, &tokenService, &roleService), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	u := user{id: "foo", username: "foo"}
+	old, err := reloaded.IssueJWT(u)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	err = reloaded.ReloadJWTConfig(gate.NewConfig("rotated-secret", "rotated-secret", time.Minute, false), time.Hour)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	token, err := reloaded.IssueJWT(u)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	if token.ExpiredAt.Sub(token.IssuedAt) != time.Minute {
+		t.Fatalf("tokens should use the new expiration: %s", token.ExpiredAt.Sub(token.IssuedAt))
+	}
+
+	for _, value := range []string{old.Value, token.Value} {
+		if _, err = reloaded.ParseJWT(value); err != nil {
+			t.Fatalf("tokens of both keys should be accepted within the overlap: %s", err)
+		}
+	}
+
+	err = reloaded.ReloadJWTConfig(gate.NewConfig("", "", time.Minute, false), 0)
+	if err == nil {
+		t.Fatal("err should not be nil because of the missing key")
+	}
+}
+
+func TestTemplateAbilities(t *testing.T) {
+	roles := myRoleService{}
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetDecisionCacheTTL(time.Hour)
+
+	templated, err := New(config, gate.NewDependencies(&userService, &tokenService, &roles), nil)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	err = templated.CreateRole("member", []gate.UserAbility{ability{"read", "projects:{project_id}"}, ability{"update", "users:{user.id}"}})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	u := user{id: "member", roles: []string{"member"}}
+	err = templated.AuthorizeWithAttributes(u, "read", "projects:42", gate.Attributes{"project_id": "42"})
+	if err != nil {
+		t.Fatalf("err should be nil because of the matching attributes: %s", err)
+	}
+
+	err = templated.AuthorizeWithAttributes(u, "read", "projects:42", gate.Attributes{"project_id": "43"})
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because of the attributes of another project: %v", err)
+	}
+
+	err = templated.Authorize(u, "read", "projects:42")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because of the missing attributes: %v", err)
+	}
+
+	err = templated.Authorize(u, "update", "users:member")
+	if err != nil {
+		t.Fatalf("err should be nil because the user ID is always an attribute: %s", err)
+	}
+
+	err = templated.Authorize(u, "update", "users:someone")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because of another user: %v", err)
+	}
+}
+
+func TestInvalidationBus(t *testing.T) {
+	roles := myRoleService{}
+	bus := gate.NewMemoryInvalidationBus()
+	config := gate.NewConfig("jwt-secret", "jwt-secret", time.Hour*1, false)
+	config.SetAbilityCacheTTL(time.Hour)
+	config.SetDecisionCacheTTL(time.Hour)
+
+	instances := make([]*Driver, 2)
+	for i := range instances {
+		dependencies := gate.NewDependencies(&userService, &tokenService, gate.NewCachedRoleService(&roles, time.Hour))
+		dependencies.SetInvalidationBus(bus)
+
+		instance, err := New(config, dependencies, nil)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid configuration: %s", err)
+		}
+
+		defer dependencies.InvalidationListener().Stop()
+		instances[i] = instance
+	}
+
+	err := instances[0].CreateRole("fleet", []gate.UserAbility{ability{"GET", "/posts*"}})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	u := user{id: "fleet", roles: []string{"fleet"}}
+	for _, instance := range instances {
+		if err = instance.Authorize(u, "GET", "/posts/1"); err != nil {
+			t.Fatalf("err should be nil because of the valid abilities: %s", err)
+		}
+	}
+
+	err = instances[0].UpdateRole("fleet", []gate.UserAbility{ability{"POST", "/posts*"}})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	err = instances[1].Authorize(u, "GET", "/posts/1")
+	if err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden because the change should be broadcast to every instance: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package password
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// PreloadAbilities fetches the roles of many users at once and caches the abilities of their role sets,
+// e.g. before authorizing every row of a report. Role sets which are already cached are skipped.
+// Roles must implement gate.IdentifiedRole to be fetched at once, otherwise every role set is fetched separately
+func (auth Driver) PreloadAbilities(users []gate.User) (err error) {
+	cache, err := auth.AbilityCache()
+	if err != nil {
+		return
+	}
+
+	if !cache.Enabled() {
+		err = errors.New("ability cache is disabled")
+		return
+	}
+
+	matcher, err := auth.Matcher()
+	if err != nil {
+		return
+	}
+
+	var roleSets [][]string
+	var roleIDs []string
+	seenSets := map[string]bool{}
+	seenRoles := map[string]bool{}
+	for _, user := range users {
+		set := user.GetRoles()
+		if len(set) == 0 {
+			continue
+		}
+
+		if _, ok := cache.Get(set); ok {
+			continue
+		}
+
+		sorted := make([]string, len(set))
+		copy(sorted, set)
+		sort.Strings(sorted)
+		key := strings.Join(sorted, "\x00")
+		if seenSets[key] {
+			continue
+		}
+
+		seenSets[key] = true
+		roleSets = append(roleSets, set)
+		for _, id := range set {
+			if !seenRoles[id] {
+				seenRoles[id] = true
+				roleIDs = append(roleIDs, id)
+			}
+		}
+	}
+
+	if len(roleSets) == 0 {
+		return
+	}
+
+	service, err := auth.RoleService()
+	if err != nil {
+		return
+	}
+
+	roles, err := auth.findRoles(service, roleIDs)
+	if err != nil {
+		return
+	}
+
+	now := auth.Now()
+	byID := make(map[string]gate.Role, len(roles))
+	for _, role := range roles {
+		identified, ok := role.(gate.IdentifiedRole)
+		if !ok {
+			return auth.preloadSeparately(roleSets, matcher)
+		}
+
+		byID[identified.GetID()] = role
+	}
+
+	for _, set := range roleSets {
+		var setRoles []gate.Role
+		for _, id := range set {
+			if role, ok := byID[id]; ok {
+				setRoles = append(setRoles, role)
+			}
+		}
+
+		index, until, err := auth.indexRoles(setRoles, matcher, now)
+		if err != nil {
+			return err
+		}
+
+		cache.SetUntil(set, index, until)
+	}
+	return
+}
+
+// preloadSeparately fetches and caches the abilities of role sets one by one
+func (auth Driver) preloadSeparately(roleSets [][]string, matcher gate.Matcher) (err error) {
+	now := auth.Now()
+	for _, set := range roleSets {
+		_, err = auth.getRoleSetAbilityIndex(set, matcher, now)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,24 @@
+package password
+
+import (
+	"github.com/hiendv/gate"
+)
+
+// redact replaces an internal error with its public error when the configuration has an error redactor. The internal error is logged
+func (auth Driver) redact(err *error, fallback error) {
+	if *err == nil {
+		return
+	}
+
+	if _, ok := (*err).(gate.RedactedError); ok {
+		return
+	}
+
+	redacted, ok := gate.Redact(auth.config.ErrorRedactor(), *err, fallback).(gate.RedactedError)
+	if !ok {
+		return
+	}
+
+	auth.log(gate.LogLevelDebug, "error redacted", "public", redacted.Error(), "error", redacted.Internal().Error())
+	*err = redacted
+}
@@ -0,0 +1,33 @@
+package password
+
+import (
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// ReloadJWTConfig swaps the JWT options of the running driver, e.g. a new signing key or a new expiration, with gate.JWTService.Reload.
+// Tokens of the previous options keep being accepted within the overlap window. Options other than the JWT ones are not reloaded
+func (auth Driver) ReloadJWTConfig(config gate.Config, overlap time.Duration) error {
+	if config.JWTExpiration() < 0 {
+		return errors.New("invalid JWT expiration")
+	}
+
+	service, err := auth.JWTService()
+	if err != nil {
+		return err
+	}
+
+	jwtConfig, err := gate.NewJWTConfigWithConfig("HS256", config)
+	if err != nil {
+		return errors.Wrap(err, "invalid JWT configuration")
+	}
+
+	jwtConfig.SetIDGenerator(auth.dependencies.IDGenerator())
+	err = service.Reload(jwtConfig, overlap)
+	if err == nil {
+		auth.log(gate.LogLevelInfo, "JWT configuration reloaded", "overlap", overlap.String())
+	}
+	return err
+}
@@ -0,0 +1,26 @@
+package password
+
+import (
+	"github.com/hiendv/gate"
+)
+
+// risky asks the risk evaluator whether an authorization granted by sensitive abilities demands a step-up.
+// The token and the client IP are taken from the authorization context, if any
+func (auth Driver) risky(ctx *gate.AuthzContext, user gate.User, action, object string) bool {
+	if auth.dependencies == nil || auth.dependencies.RiskEvaluator() == nil {
+		return false
+	}
+
+	risk := gate.RiskContext{User: user, Action: action, Object: object, Now: auth.Now()}
+	if ctx != nil {
+		risk.Token = ctx.Token
+		risk.IP = ctx.IP
+	}
+
+	if auth.dependencies.RiskEvaluator().RequiresStepUp(risk) {
+		auth.log(gate.LogLevelDebug, "step-up required", "user", user.GetID(), "action", action, "object", object)
+		return true
+	}
+
+	return false
+}
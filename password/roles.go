@@ -0,0 +1,209 @@
+package password
+
+import (
+	"strings"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// RoleManager returns the role service as a role manager or throws an error if the service does not support changes
+func (auth Driver) RoleManager() (manager gate.RoleManager, err error) {
+	service, err := auth.RoleService()
+	if err != nil {
+		return
+	}
+
+	manager, ok := service.(gate.RoleManager)
+	if !ok {
+		err = errors.New("role service does not support changes")
+	}
+	return
+}
+
+// CreateRole creates a role with the given abilities
+func (auth Driver) CreateRole(id string, abilities []gate.UserAbility) error {
+	return auth.manageRole(id, "could not create the role", func(manager gate.RoleManager) error {
+		return manager.CreateRole(id, abilities)
+	})
+}
+
+// UpdateRole replaces the abilities of a role
+func (auth Driver) UpdateRole(id string, abilities []gate.UserAbility) error {
+	return auth.manageRole(id, "could not update the role", func(manager gate.RoleManager) error {
+		return manager.UpdateRole(id, abilities)
+	})
+}
+
+// DeleteRole deletes a role
+func (auth Driver) DeleteRole(id string) error {
+	return auth.manageRole(id, "could not delete the role", func(manager gate.RoleManager) error {
+		return manager.DeleteRole(id)
+	})
+}
+
+// AttachAbility grants an ability to a role
+func (auth Driver) AttachAbility(id string, ability gate.UserAbility) error {
+	return auth.manageRole(id, "could not attach the ability", func(manager gate.RoleManager) error {
+		return manager.AttachAbility(id, ability)
+	})
+}
+
+// DetachAbility revokes an ability from a role
+func (auth Driver) DetachAbility(id string, ability gate.UserAbility) error {
+	return auth.manageRole(id, "could not detach the ability", func(manager gate.RoleManager) error {
+		return manager.DetachAbility(id, ability)
+	})
+}
+
+// manageRole applies a change using the role manager and invalidates the cached abilities and decisions of the role
+func (auth Driver) manageRole(id, message string, change func(gate.RoleManager) error) (err error) {
+	manager, err := auth.RoleManager()
+	if err != nil {
+		return
+	}
+
+	err = change(manager)
+	if err != nil {
+		err = errors.Wrap(err, message)
+		return
+	}
+
+	cache, err := auth.AbilityCache()
+	if err != nil {
+		return
+	}
+
+	cache.Invalidate(id)
+
+	decisions, err := auth.DecisionCache()
+	if err != nil {
+		return
+	}
+
+	decisions.InvalidateRoles(id)
+	auth.publishInvalidation(id)
+	return
+}
+
+// publishInvalidation broadcasts a role change with the invalidation bus, if any, so the other instances invalidate their caches.
+// Failures are logged only since the change is already applied and the caches expire eventually
+func (auth Driver) publishInvalidation(roleIDs ...string) {
+	bus := auth.dependencies.InvalidationBus()
+	if bus == nil {
+		return
+	}
+
+	if err := bus.Publish(roleIDs); err != nil {
+		auth.log(gate.LogLevelWarn, "could not publish the invalidation", "roles", strings.Join(roleIDs, ","), "reason", err.Error())
+	}
+}
+
+// startInvalidationListener subscribes the dependencies to the invalidation bus, if any, once.
+// Broadcast role changes invalidate the cached roles, abilities and decisions of the instance
+func startInvalidationListener(dependencies *gate.Dependencies) error {
+	bus := dependencies.InvalidationBus()
+	if bus == nil || dependencies.InvalidationListener().Enabled() {
+		return nil
+	}
+
+	listener, err := gate.NewInvalidationListener(bus, func(roleIDs []string) {
+		invalidateRoles(dependencies, roleIDs)
+	})
+	if err != nil {
+		return err
+	}
+
+	dependencies.SetInvalidationListener(listener)
+	return nil
+}
+
+// invalidateRoles invalidates the cached roles, abilities and decisions of the roles. An empty set invalidates everything
+func invalidateRoles(dependencies *gate.Dependencies, roleIDs []string) {
+	invalidator, _ := dependencies.RoleService().(gate.RoleInvalidator)
+	if len(roleIDs) == 0 {
+		if invalidator != nil {
+			invalidator.Flush()
+		}
+
+		dependencies.AbilityCache().Flush()
+		dependencies.DecisionCache().Flush()
+		return
+	}
+
+	if invalidator != nil {
+		invalidator.Invalidate(roleIDs...)
+	}
+
+	dependencies.AbilityCache().Invalidate(roleIDs...)
+	dependencies.DecisionCache().InvalidateRoles(roleIDs...)
+}
+
+// UserRoleManager returns the user service as a user-role manager or throws an error if the service does not support changes
+func (auth Driver) UserRoleManager() (manager gate.UserRoleManager, err error) {
+	service, err := auth.UserService()
+	if err != nil {
+		return
+	}
+
+	manager, ok := service.(gate.UserRoleManager)
+	if !ok {
+		err = errors.New("user service does not support role assignment")
+	}
+	return
+}
+
+// AssignRole assigns a role to a user
+func (auth Driver) AssignRole(user gate.User, roleID string) (err error) {
+	manager, err := auth.UserRoleManager()
+	if err != nil {
+		return
+	}
+
+	err = manager.AssignRole(user.GetID(), roleID)
+	if err != nil {
+		err = errors.Wrap(err, "could not assign the role")
+		return
+	}
+
+	auth.notifyRoleChange(gate.RoleChange{UserID: user.GetID(), RoleID: roleID, Assigned: true})
+	return
+}
+
+// RevokeRole revokes a role from a user
+func (auth Driver) RevokeRole(user gate.User, roleID string) (err error) {
+	manager, err := auth.UserRoleManager()
+	if err != nil {
+		return
+	}
+
+	err = manager.RevokeRole(user.GetID(), roleID)
+	if err != nil {
+		err = errors.Wrap(err, "could not revoke the role")
+		return
+	}
+
+	auth.notifyRoleChange(gate.RoleChange{UserID: user.GetID(), RoleID: roleID, Assigned: false})
+	return
+}
+
+// ListRoles returns the current role IDs of a user from the user-role manager
+func (auth Driver) ListRoles(user gate.User) (roleIDs []string, err error) {
+	manager, err := auth.UserRoleManager()
+	if err != nil {
+		return
+	}
+
+	roleIDs, err = manager.ListRoles(user.GetID())
+	if err != nil {
+		err = errors.Wrap(err, "could not list the roles")
+	}
+	return
+}
+
+func (auth Driver) notifyRoleChange(change gate.RoleChange) {
+	auth.dependencies.DecisionCache().InvalidateUser(change.UserID)
+	for _, hook := range auth.dependencies.RoleChangeHooks() {
+		hook(change)
+	}
+}
@@ -0,0 +1,67 @@
+package password
+
+import (
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// SessionStore returns the token service as a session store or throws an error if the service does not support session limits
+func (auth Driver) SessionStore() (store gate.SessionStore, err error) {
+	service, err := auth.TokenService()
+	if err != nil {
+		return
+	}
+
+	store, ok := service.(gate.SessionStore)
+	if !ok {
+		err = errors.New("token service does not support session limits")
+	}
+	return
+}
+
+// Sessions returns the active sessions of a user, i.e. the stored tokens of the primary logins which are not expired, from the oldest to the newest
+func (auth Driver) Sessions(userID string) (sessions []gate.JWT, err error) {
+	store, err := auth.SessionStore()
+	if err != nil {
+		return
+	}
+
+	sessions, err = store.ListSessions(userID)
+	if err != nil {
+		err = errors.Wrap(err, "could not list the sessions")
+		return
+	}
+
+	sessions = gate.ActiveSessions(sessions, auth.Now())
+	return
+}
+
+// isSession reports whether the claims are of a primary login, i.e. neither single-use, scoped nor exchanged
+func isSession(claims gate.JWTClaims) bool {
+	return !claims.SingleUse && claims.Actor == nil && len(claims.Abilities) == 0
+}
+
+// storeSession stores the token of a primary login within the session limit. Sessions are stored synchronously, bypassing the token storage policy,
+// so pending tokens of the write-behind queue never escape the limit
+func (auth Driver) storeSession(token gate.JWT, max int, policy gate.SessionLimitPolicy) (err error) {
+	store, err := auth.SessionStore()
+	if err != nil {
+		return
+	}
+
+	evicted, err := store.StoreSession(token, max, policy)
+	if errors.Cause(err) == gate.ErrSessionLimitExceeded {
+		err = ErrSessionLimitExceeded
+		return
+	}
+
+	if err != nil {
+		err = errors.Wrap(err, "could not store the session")
+		return
+	}
+
+	for _, session := range evicted {
+		auth.log(gate.LogLevelDebug, "session evicted", "user_id", token.UserID, "token_id", session.ID)
+	}
+	return
+}
@@ -0,0 +1,27 @@
+package password
+
+import (
+	"github.com/hiendv/gate"
+)
+
+// evaluateShadow evaluates an authorization with the shadow authorizer and reports a divergence from the active decision to the audit hooks
+func (auth Driver) evaluateShadow(shadow gate.Authorizer, user gate.User, action, object string, decision error) {
+	shadowDecision := shadow.Authorize(user, action, object)
+	if !gate.Diverges(decision, shadowDecision) {
+		return
+	}
+
+	auth.log(gate.LogLevelInfo, "shadow authorization diverged", "user", user.GetID(), "action", action, "object", object, "allowed", decision == nil)
+
+	event := gate.AuditEvent{
+		Type:           gate.AuditShadowDivergence,
+		UserID:         user.GetID(),
+		Action:         action,
+		Object:         object,
+		Decision:       decision,
+		ShadowDecision: shadowDecision,
+	}
+	for _, hook := range auth.dependencies.AuditHooks() {
+		hook(event)
+	}
+}
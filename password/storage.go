@@ -0,0 +1,44 @@
+package password
+
+import (
+	"github.com/hiendv/gate"
+)
+
+// startTokenWriteBehind starts the token write-behind queue of the dependencies for the StorageWriteBehind policy unless it is started already.
+// Tokens failing every attempt are logged
+func startTokenWriteBehind(config gate.Config, dependencies *gate.Dependencies) {
+	if config.TokenStoragePolicy() != gate.StorageWriteBehind || dependencies.TokenWriteBehind().Enabled() || dependencies.TokenService() == nil {
+		return
+	}
+
+	auth := Driver{dependencies: dependencies}
+	attempts, backoff := config.TokenStorageRetry()
+	dependencies.SetTokenWriteBehind(gate.NewTokenWriteBehind(dependencies.TokenService(), config.TokenWriteBehindSize(), attempts, backoff, func(token gate.JWT, err error) {
+		auth.log(gate.LogLevelWarn, "could not store the token", "token_id", token.ID, "user_id", token.UserID, "reason", err.Error())
+	}))
+}
+
+// storeJWT stores a JWT according to the token storage policy
+func (auth Driver) storeJWT(service gate.TokenService, token gate.JWT) (err error) {
+	attempts, backoff := auth.config.TokenStorageRetry()
+
+	switch auth.config.TokenStoragePolicy() {
+	case gate.StorageFailOpen:
+		err = service.Store(token)
+		if err != nil {
+			auth.log(gate.LogLevelWarn, "token issued without being stored", "token_id", token.ID, "user_id", token.UserID, "reason", err.Error())
+			err = nil
+		}
+	case gate.StorageRetry:
+		err = gate.StoreWithRetry(service, token, attempts, backoff)
+	case gate.StorageWriteBehind:
+		if writer := auth.dependencies.TokenWriteBehind(); writer.Enabled() {
+			return writer.Store(token)
+		}
+
+		err = gate.StoreWithRetry(service, token, attempts, backoff)
+	default:
+		err = service.Store(token)
+	}
+	return
+}
@@ -1,6 +1,8 @@
 package password
 
 import (
+	"errors"
+
 	"github.com/hiendv/gate"
 )
 
@@ -22,6 +24,10 @@ type role struct {
 	abilities []ability
 }
 
+func (r role) GetID() string {
+	return r.id
+}
+
 func (r role) GetAbilities() (abilities []gate.UserAbility) {
 	abilities = make([]gate.UserAbility, len(r.abilities))
 
@@ -47,3 +53,100 @@ func (service myRoleService) FindByIDs(ids []string) (roles []gate.Role, err err
 	}
 	return
 }
+
+// lazyRoleService is the role service streaming the abilities of roles, i.e. a gate.AbilityIterator
+type lazyRoleService struct {
+	*myRoleService
+}
+
+func (service lazyRoleService) ForEachAbility(ids []string, fn func(gate.Role, gate.UserAbility) bool) error {
+	roles, err := service.FindByIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		for _, ability := range role.GetAbilities() {
+			if !fn(role, ability) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+var errRoleNotFound = errors.New("role not found")
+var errRoleExists = errors.New("role exists")
+
+func toAbilities(abilities []gate.UserAbility) (result []ability) {
+	for _, a := range abilities {
+		result = append(result, ability{a.GetAction(), a.GetObject()})
+	}
+	return
+}
+
+func (service myRoleService) find(id string) (int, error) {
+	for i, record := range service.records {
+		if record.id == id {
+			return i, nil
+		}
+	}
+	return -1, errRoleNotFound
+}
+
+func (service *myRoleService) CreateRole(id string, abilities []gate.UserAbility) error {
+	if _, err := service.find(id); err == nil {
+		return errRoleExists
+	}
+
+	service.records = append(service.records, role{id, toAbilities(abilities)})
+	return nil
+}
+
+func (service *myRoleService) UpdateRole(id string, abilities []gate.UserAbility) error {
+	i, err := service.find(id)
+	if err != nil {
+		return err
+	}
+
+	service.records[i].abilities = toAbilities(abilities)
+	return nil
+}
+
+func (service *myRoleService) DeleteRole(id string) error {
+	i, err := service.find(id)
+	if err != nil {
+		return err
+	}
+
+	service.records = append(service.records[:i], service.records[i+1:]...)
+	return nil
+}
+
+func (service *myRoleService) AttachAbility(id string, a gate.UserAbility) error {
+	i, err := service.find(id)
+	if err != nil {
+		return err
+	}
+
+	service.records[i].abilities = append(service.records[i].abilities, ability{a.GetAction(), a.GetObject()})
+	return nil
+}
+
+func (service *myRoleService) DetachAbility(id string, a gate.UserAbility) error {
+	i, err := service.find(id)
+	if err != nil {
+		return err
+	}
+
+	var abilities []ability
+	for _, record := range service.records[i].abilities {
+		if record.action == a.GetAction() && record.object == a.GetObject() {
+			continue
+		}
+
+		abilities = append(abilities, record)
+	}
+	service.records[i].abilities = abilities
+	return nil
+}
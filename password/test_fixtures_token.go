@@ -1,13 +1,14 @@
 package password
 
 import (
-	"errors"
 	"time"
 
 	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
 )
 
-var errTokenNotFound = errors.New("token not found")
+var errTokenNotFound = gate.ErrTokenNotFound
+var errTokenConsumed = errors.WithMessage(gate.ErrTokenNotFound, "token consumed")
 
 type token struct {
 	id        string
@@ -15,6 +16,8 @@ type token struct {
 	userID    string
 	expiredAt time.Time
 	issuedAt  time.Time
+	singleUse bool
+	consumed  bool
 }
 
 type myTokenService struct {
@@ -28,6 +31,8 @@ func (service *myTokenService) Store(jwt gate.JWT) error {
 		jwt.UserID,
 		jwt.ExpiredAt,
 		jwt.IssuedAt,
+		jwt.SingleUse,
+		false,
 	})
 	return nil
 }
@@ -41,6 +46,7 @@ func (service myTokenService) FindOneByID(id string) (jwt gate.JWT, err error) {
 				UserID:    record.userID,
 				ExpiredAt: record.expiredAt,
 				IssuedAt:  record.issuedAt,
+				SingleUse: record.singleUse,
 			}
 			err = nil
 			return
@@ -49,3 +55,17 @@ func (service myTokenService) FindOneByID(id string) (jwt gate.JWT, err error) {
 	err = errTokenNotFound
 	return
 }
+
+func (service *myTokenService) Consume(id string) error {
+	for i, record := range service.records {
+		if record.id == id {
+			if record.consumed {
+				return errTokenConsumed
+			}
+
+			service.records[i].consumed = true
+			return nil
+		}
+	}
+	return errTokenNotFound
+}
@@ -6,7 +6,7 @@ import (
 	"github.com/hiendv/gate"
 )
 
-var errUserNotFound = errors.New("user not found")
+var errUserNotFound = gate.ErrUserNotFound
 
 type userActual struct {
 	id       string
@@ -89,3 +89,54 @@ func (service *myUserService) FindOrCreateOneByUsername(username string) (u gate
 	u = record
 	return
 }
+
+func (service myUserService) find(id string) (int, error) {
+	for i, record := range service.records {
+		if record.id == id {
+			return i, nil
+		}
+	}
+	return -1, errUserNotFound
+}
+
+func (service *myUserService) AssignRole(userID, roleID string) error {
+	i, err := service.find(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range service.records[i].roles {
+		if id == roleID {
+			return nil
+		}
+	}
+
+	service.records[i].roles = append(service.records[i].roles, roleID)
+	return nil
+}
+
+func (service *myUserService) RevokeRole(userID, roleID string) error {
+	i, err := service.find(userID)
+	if err != nil {
+		return err
+	}
+
+	var roles []string
+	for _, id := range service.records[i].roles {
+		if id != roleID {
+			roles = append(roles, id)
+		}
+	}
+
+	service.records[i].roles = roles
+	return nil
+}
+
+func (service myUserService) ListRoles(userID string) ([]string, error) {
+	i, err := service.find(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.records[i].roles, nil
+}
@@ -0,0 +1,148 @@
+package password
+
+import (
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// TokenManager returns the token service as a token manager or throws an error if the service does not support the management of tokens
+func (auth Driver) TokenManager() (manager gate.TokenManager, err error) {
+	service, err := auth.TokenService()
+	if err != nil {
+		return
+	}
+
+	manager, ok := service.(gate.TokenManager)
+	if !ok {
+		err = errors.New("token service does not support the management of tokens")
+	}
+	return
+}
+
+// ListJWTs returns the stored tokens of a user
+func (auth Driver) ListJWTs(userID string) (tokens []gate.JWT, err error) {
+	manager, err := auth.TokenManager()
+	if err != nil {
+		return
+	}
+
+	tokens, err = manager.ListTokens(userID)
+	if err != nil {
+		err = errors.Wrap(err, "could not list the tokens")
+	}
+	return
+}
+
+// RevokeJWT revokes a stored token by its ID so it is refused by the authentication
+func (auth Driver) RevokeJWT(id string) (err error) {
+	manager, err := auth.TokenManager()
+	if err != nil {
+		return
+	}
+
+	err = manager.RevokeToken(id)
+	if err != nil {
+		err = errors.Wrap(err, "could not revoke the token")
+	}
+	return
+}
+
+// TokenPurger returns the token service as a token purger or throws an error if the service does not support the maintenance of tokens
+func (auth Driver) TokenPurger() (purger gate.TokenPurger, err error) {
+	service, err := auth.TokenService()
+	if err != nil {
+		return
+	}
+
+	purger, ok := service.(gate.TokenPurger)
+	if !ok {
+		err = errors.New("token service does not support the maintenance of tokens")
+	}
+	return
+}
+
+// PurgeExpiredJWTs purges the stored tokens expired before the given time and returns their number
+func (auth Driver) PurgeExpiredJWTs(before time.Time) (purged int, err error) {
+	purger, err := auth.TokenPurger()
+	if err != nil {
+		return
+	}
+
+	purged, err = purger.PurgeExpired(before)
+	if err != nil {
+		err = errors.Wrap(err, "could not purge the tokens")
+	}
+	return
+}
+
+// CountJWTs returns the number of stored tokens of a user
+func (auth Driver) CountJWTs(userID string) (count int, err error) {
+	purger, err := auth.TokenPurger()
+	if err != nil {
+		return
+	}
+
+	count, err = purger.CountByUser(userID)
+	if err != nil {
+		err = errors.Wrap(err, "could not count the tokens")
+	}
+	return
+}
+
+// startTokenJanitor starts the token janitor of the dependencies when it is configured and the token service is a token purger,
+// unless it is started already. Purges are logged
+func startTokenJanitor(config gate.Config, dependencies *gate.Dependencies) {
+	interval, retention := config.TokenPurge()
+	if interval <= 0 || dependencies.TokenJanitor().Enabled() {
+		return
+	}
+
+	purger, ok := dependencies.TokenService().(gate.TokenPurger)
+	if !ok {
+		return
+	}
+
+	auth := Driver{dependencies: dependencies}
+	dependencies.SetTokenJanitor(gate.NewTokenJanitor(purger, dependencies.Clock(), interval, retention, func(purged int, err error) {
+		if err != nil {
+			auth.log(gate.LogLevelWarn, "could not purge the tokens", "reason", err.Error())
+			return
+		}
+
+		auth.log(gate.LogLevelDebug, "tokens purged", "count", purged)
+	}))
+}
+
+// checkRevocation looks up a self-contained token with the token manager, if any, and refuses it once it has been revoked, i.e. not found.
+// Storage failures are returned as they are. Opaque tokens are already looked up on parsing
+func (auth Driver) checkRevocation(token gate.JWT) (err error) {
+	if auth.config.OpaqueTokens() {
+		return
+	}
+
+	if auth.dependencies == nil {
+		return
+	}
+
+	service := auth.dependencies.TokenService()
+	if _, ok := service.(gate.TokenManager); !ok {
+		return
+	}
+
+	if _, ok := auth.dependencies.TokenWriteBehind().Pending(token.ID); ok {
+		return
+	}
+
+	_, err = service.FindOneByID(token.ID)
+	if errors.Cause(err) == gate.ErrTokenNotFound {
+		err = ErrTokenRevoked
+		return
+	}
+
+	if err != nil {
+		err = errors.Wrap(err, "could not check the revocation of the token")
+	}
+	return
+}
@@ -0,0 +1,129 @@
+package gate
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPermissionSetNotFound is thrown when a role references a permission set which is not registered
+var ErrPermissionSetNotFound = errors.New("permission set not found")
+
+// PermissionSet is a named bundle of abilities referenced by roles, e.g. "content-editor", so shared abilities are defined once
+type PermissionSet struct {
+	Name      string
+	Abilities []UserAbility
+}
+
+// PermissionSetReferrer is the optional contract for roles referencing permission sets by name in addition to their own abilities
+type PermissionSetReferrer interface {
+	GetPermissionSets() []string
+}
+
+// PermissionSetService is the contract which offers queries on permission sets. Missing permission sets are left out of the result
+type PermissionSetService interface {
+	FindPermissionSets([]string) ([]PermissionSet, error)
+}
+
+// PermissionSetRegistry is the in-memory PermissionSetService
+type PermissionSetRegistry struct {
+	sets map[string]PermissionSet
+	*sync.RWMutex
+}
+
+// Register adds or replaces a permission set
+func (registry PermissionSetRegistry) Register(set PermissionSet) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.sets[set.Name] = set
+}
+
+// Remove removes a permission set
+func (registry PermissionSetRegistry) Remove(name string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	delete(registry.sets, name)
+}
+
+// FindPermissionSets returns the registered permission sets with the given names
+func (registry PermissionSetRegistry) FindPermissionSets(names []string) (sets []PermissionSet, err error) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, name := range names {
+		if set, ok := registry.sets[name]; ok {
+			sets = append(sets, set)
+		}
+	}
+	return
+}
+
+// NewPermissionSetRegistry is the constructor for PermissionSetRegistry
+func NewPermissionSetRegistry(sets ...PermissionSet) PermissionSetRegistry {
+	registry := PermissionSetRegistry{map[string]PermissionSet{}, &sync.RWMutex{}}
+	for _, set := range sets {
+		registry.sets[set.Name] = set
+	}
+	return registry
+}
+
+// ResolvePermissionSets returns the abilities of the permission sets referenced by roles by set name.
+// It fails with ErrPermissionSetNotFound if a referenced set is missing
+func ResolvePermissionSets(service PermissionSetService, roles []Role) (abilities map[string][]UserAbility, err error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, role := range roles {
+		referrer, ok := role.(PermissionSetReferrer)
+		if !ok {
+			continue
+		}
+
+		for _, name := range referrer.GetPermissionSets() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return
+	}
+
+	if service == nil {
+		err = errors.WithMessage(ErrPermissionSetNotFound, "missing permission set service")
+		return
+	}
+
+	sets, err := service.FindPermissionSets(names)
+	if err != nil {
+		err = errors.Wrap(err, "could not fetch permission sets")
+		return
+	}
+
+	abilities = make(map[string][]UserAbility, len(sets))
+	for _, set := range sets {
+		abilities[set.Name] = set.Abilities
+	}
+
+	for _, name := range names {
+		if _, ok := abilities[name]; !ok {
+			err = errors.WithMessage(ErrPermissionSetNotFound, name)
+			return
+		}
+	}
+	return
+}
+
+// PermissionSetService is the getter for the permission set service
+func (dependencies Dependencies) PermissionSetService() PermissionSetService {
+	return dependencies.permissionSets
+}
+
+// SetPermissionSetService is the setter for the permission set service resolving the permission sets referenced by roles.
+// Cached abilities are not invalidated by changes on permission sets, the ability cache must be flushed instead
+func (dependencies *Dependencies) SetPermissionSetService(service PermissionSetService) {
+	dependencies.permissionSets = service
+}
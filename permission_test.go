@@ -0,0 +1,61 @@
+package gate
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testBundledRole struct {
+	testRole
+	sets []string
+}
+
+func (role testBundledRole) GetPermissionSets() []string {
+	return role.sets
+}
+
+func TestPermissionSets(t *testing.T) {
+	registry := NewPermissionSetRegistry(PermissionSet{"content-editor", []UserAbility{testAbility{"POST", "/posts*"}}})
+	roles := []Role{
+		testBundledRole{testRole{[]UserAbility{testAbility{"GET", "*"}}}, []string{"content-editor"}},
+		testRole{[]UserAbility{testAbility{"GET", "/users"}}},
+	}
+
+	t.Run("resolve", func(t *testing.T) {
+		abilities, err := ResolvePermissionSets(registry, roles)
+		if err != nil {
+			t.Fatalf("err should be nil because of the registered set: %s", err)
+		}
+
+		if len(abilities) != 1 || len(abilities["content-editor"]) != 1 {
+			t.Fatalf("the abilities of the set should be resolved: %v", abilities)
+		}
+
+		abilities, err = ResolvePermissionSets(nil, roles[1:])
+		if err != nil || abilities != nil {
+			t.Fatalf("roles without sets should not be resolved: %v - %v", abilities, err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		registry.Remove("content-editor")
+		_, err := ResolvePermissionSets(registry, roles)
+		if errors.Cause(err) != ErrPermissionSetNotFound {
+			t.Fatalf("err should be ErrPermissionSetNotFound because of the removed set: %v", err)
+		}
+
+		_, err = ResolvePermissionSets(nil, roles)
+		if errors.Cause(err) != ErrPermissionSetNotFound {
+			t.Fatalf("err should be ErrPermissionSetNotFound because of the missing service: %v", err)
+		}
+	})
+
+	t.Run("register", func(t *testing.T) {
+		registry.Register(PermissionSet{"content-editor", []UserAbility{testAbility{"PUT", "/posts*"}}})
+		abilities, err := ResolvePermissionSets(registry, roles)
+		if err != nil || abilities["content-editor"][0].GetAction() != "PUT" {
+			t.Fatalf("the registered set should be resolved: %v - %v", abilities, err)
+		}
+	})
+}
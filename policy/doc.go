@@ -0,0 +1,2 @@
+// Package policy is the declarative policy document for github.com/hiendv/gate, e.g. roles, abilities and user assignments in JSON
+package policy
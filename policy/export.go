@@ -0,0 +1,230 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// ErrChecksumMismatch is thrown when an imported document or role does not match its checksum, e.g. after a manual edit
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+const checksumPrefix = "sha256:"
+
+type abilitiesByActionObject []Ability
+
+func (abilities abilitiesByActionObject) Len() int {
+	return len(abilities)
+}
+
+func (abilities abilitiesByActionObject) Swap(i, j int) {
+	abilities[i], abilities[j] = abilities[j], abilities[i]
+}
+
+func (abilities abilitiesByActionObject) Less(i, j int) bool {
+	if abilities[i].Action != abilities[j].Action {
+		return abilities[i].Action < abilities[j].Action
+	}
+
+	if abilities[i].Object != abilities[j].Object {
+		return abilities[i].Object < abilities[j].Object
+	}
+
+	return !abilities[i].StepUp && abilities[j].StepUp
+}
+
+type rolesByID []Role
+
+func (roles rolesByID) Len() int {
+	return len(roles)
+}
+
+func (roles rolesByID) Swap(i, j int) {
+	roles[i], roles[j] = roles[j], roles[i]
+}
+
+func (roles rolesByID) Less(i, j int) bool {
+	return roles[i].ID < roles[j].ID
+}
+
+type permissionSetsByName []PermissionSet
+
+func (sets permissionSetsByName) Len() int {
+	return len(sets)
+}
+
+func (sets permissionSetsByName) Swap(i, j int) {
+	sets[i], sets[j] = sets[j], sets[i]
+}
+
+func (sets permissionSetsByName) Less(i, j int) bool {
+	return sets[i].Name < sets[j].Name
+}
+
+type usersByID []User
+
+func (users usersByID) Len() int {
+	return len(users)
+}
+
+func (users usersByID) Swap(i, j int) {
+	users[i], users[j] = users[j], users[i]
+}
+
+func (users usersByID) Less(i, j int) bool {
+	return users[i].ID < users[j].ID
+}
+
+func checksum(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return checksumPrefix + hex.EncodeToString(sum[:])
+}
+
+// canonicalAbilities returns sorted and deduplicated abilities
+func canonicalAbilities(abilities []Ability) []Ability {
+	sorted := make([]Ability, len(abilities))
+	copy(sorted, abilities)
+	sort.Sort(abilitiesByActionObject(sorted))
+
+	canonical := []Ability{}
+	for i, ability := range sorted {
+		if i > 0 && ability == sorted[i-1] {
+			continue
+		}
+
+		canonical = append(canonical, ability)
+	}
+	return canonical
+}
+
+// Canonical returns a copy of the role with sorted and deduplicated abilities and its checksum
+func (role Role) Canonical() Role {
+	canonical := Role{ID: role.ID, Abilities: canonicalAbilities(role.Abilities)}
+	if len(role.PermissionSets) > 0 {
+		canonical.PermissionSets = make([]string, len(role.PermissionSets))
+		copy(canonical.PermissionSets, role.PermissionSets)
+		sort.Strings(canonical.PermissionSets)
+	}
+
+	canonical.Checksum = checksum(canonical)
+	return canonical
+}
+
+// Canonical returns a copy of the document with sorted and deduplicated entries and the checksums of the roles and the document.
+// Canonical documents of the same policy are identical, so they are diffed and reviewed line by line
+func (document Document) Canonical() Document {
+	canonical := Document{Roles: make([]Role, len(document.Roles))}
+	for i, role := range document.Roles {
+		canonical.Roles[i] = role.Canonical()
+	}
+	sort.Sort(rolesByID(canonical.Roles))
+
+	if len(document.PermissionSets) > 0 {
+		canonical.PermissionSets = make([]PermissionSet, len(document.PermissionSets))
+		for i, set := range document.PermissionSets {
+			canonical.PermissionSets[i] = PermissionSet{Name: set.Name, Abilities: canonicalAbilities(set.Abilities)}
+		}
+		sort.Sort(permissionSetsByName(canonical.PermissionSets))
+	}
+
+	if len(document.Users) > 0 {
+		canonical.Users = make([]User, len(document.Users))
+		for i, user := range document.Users {
+			roles := make([]string, len(user.Roles))
+			copy(roles, user.Roles)
+			sort.Strings(roles)
+			canonical.Users[i] = User{ID: user.ID, Username: user.Username, Roles: roles}
+		}
+		sort.Sort(usersByID(canonical.Users))
+	}
+
+	canonical.Checksum = checksum(canonical)
+	return canonical
+}
+
+// Verify checks the checksums of the document and its roles. Missing checksums are not checked, e.g. in hand-written documents
+func (document Document) Verify() error {
+	for _, role := range document.Roles {
+		if role.Checksum == "" {
+			continue
+		}
+
+		if role.Checksum != role.Canonical().Checksum {
+			return errors.WithMessage(ErrChecksumMismatch, "role "+role.ID)
+		}
+	}
+
+	if document.Checksum != "" && document.Checksum != document.Canonical().Checksum {
+		return errors.WithMessage(ErrChecksumMismatch, "document")
+	}
+
+	return nil
+}
+
+// Export writes the canonical JSON document, e.g. to promote the policy of an environment to another one
+func (document Document) Export(writer io.Writer) error {
+	data, err := json.MarshalIndent(document.Canonical(), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not encode the policy document")
+	}
+
+	_, err = writer.Write(append(data, '\n'))
+	return err
+}
+
+// Import decodes a JSON policy document, verifies its checksums and returns the canonical document
+func Import(reader io.Reader) (document Document, err error) {
+	document, err = Load(reader)
+	if err != nil {
+		return
+	}
+
+	err = document.Verify()
+	if err != nil {
+		return
+	}
+
+	document = document.Canonical()
+	return
+}
+
+// Snapshot builds a document of the roles with the given IDs from a role service, e.g. to export the policy of a live environment.
+// Roles missing from the role service are skipped
+func Snapshot(service gate.RoleService, roleIDs []string) (document Document, err error) {
+	for _, id := range roleIDs {
+		var roles []gate.Role
+		roles, err = service.FindByIDs([]string{id})
+		if err != nil {
+			err = errors.Wrap(err, "could not fetch the role "+id)
+			return
+		}
+
+		if len(roles) == 0 {
+			continue
+		}
+
+		role := Role{ID: id, Abilities: []Ability{}}
+		if referrer, ok := roles[0].(gate.PermissionSetReferrer); ok {
+			role.PermissionSets = referrer.GetPermissionSets()
+		}
+
+		for _, ability := range roles[0].GetAbilities() {
+			role.Abilities = append(role.Abilities, Ability{ability.GetAction(), ability.GetObject(), gate.RequiresStepUp(ability)})
+		}
+
+		document.Roles = append(document.Roles, role)
+	}
+
+	document = document.Canonical()
+	return
+}
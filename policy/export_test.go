@@ -0,0 +1,75 @@
+package policy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestExportImport(t *testing.T) {
+	document, err := Load(strings.NewReader(fixture))
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid document: %s", err)
+	}
+
+	var exported bytes.Buffer
+	err = document.Export(&exported)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	t.Run("canonical", func(t *testing.T) {
+		shuffled := Document{
+			Roles: []Role{
+				{ID: "viewer", Abilities: []Ability{{Action: "GET", Object: "*"}, {Action: "GET", Object: "*"}}},
+				{ID: "editor", Abilities: []Ability{{Action: "POST", Object: "/posts*"}, {Action: "GET", Object: "/posts*"}}},
+			},
+			Users: document.Users,
+		}
+
+		var buffer bytes.Buffer
+		err := shuffled.Export(&buffer)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if buffer.String() != exported.String() {
+			t.Fatalf("exports of the same policy should be identical:\n%s\n%s", buffer.String(), exported.String())
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		imported, err := Import(bytes.NewReader(exported.Bytes()))
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid checksums: %s", err)
+		}
+
+		if imported.Checksum == "" || imported.Checksum != document.Canonical().Checksum || len(imported.Roles) != 2 {
+			t.Fatalf("the document should be imported: %v", imported)
+		}
+
+		tampered := strings.Replace(exported.String(), `"/posts*"`, `"*"`, 1)
+		_, err = Import(strings.NewReader(tampered))
+		if errors.Cause(err) != ErrChecksumMismatch {
+			t.Fatalf("err should be ErrChecksumMismatch because of the tampered role: %v", err)
+		}
+
+		_, err = Import(strings.NewReader(fixture))
+		if err != nil {
+			t.Fatalf("err should be nil because documents without checksums are not checked: %s", err)
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		snapshot, err := Snapshot(document, []string{"viewer", "editor", "missing"})
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if len(snapshot.Roles) != 2 || snapshot.Roles[0].ID != "editor" || snapshot.Roles[0].Checksum != document.Canonical().Roles[0].Checksum {
+			t.Fatalf("the roles should be exported from the role service: %v", snapshot.Roles)
+		}
+	})
+}
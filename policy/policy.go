@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// ErrUserNotFound is thrown when a user is not defined in the document. It is gate.ErrUserNotFound, so missing users are negatively cached
+var ErrUserNotFound = gate.ErrUserNotFound
+
+// Ability is the ability entity of a policy document
+type Ability struct {
+	Action string `json:"action"`
+	Object string `json:"object"`
+	StepUp bool   `json:"step_up,omitempty"`
+}
+
+// GetAction returns the action
+func (ability Ability) GetAction() string {
+	return ability.Action
+}
+
+// GetObject returns the object
+func (ability Ability) GetObject() string {
+	return ability.Object
+}
+
+// GetTags returns gate.StepUpTag for sensitive abilities
+func (ability Ability) GetTags() []string {
+	if ability.StepUp {
+		return []string{gate.StepUpTag}
+	}
+
+	return nil
+}
+
+// Role is the role entity of a policy document
+type Role struct {
+	ID             string    `json:"id"`
+	Abilities      []Ability `json:"abilities"`
+	PermissionSets []string  `json:"permission_sets,omitempty"`
+	Checksum       string    `json:"checksum,omitempty"`
+}
+
+// GetAbilities returns the abilities
+func (role Role) GetAbilities() (abilities []gate.UserAbility) {
+	abilities = make([]gate.UserAbility, len(role.Abilities))
+	for i, ability := range role.Abilities {
+		abilities[i] = ability
+	}
+	return
+}
+
+// GetPermissionSets returns the names of the referenced permission sets
+func (role Role) GetPermissionSets() []string {
+	return role.PermissionSets
+}
+
+// PermissionSet is the named bundle of abilities of a policy document
+type PermissionSet struct {
+	Name      string    `json:"name"`
+	Abilities []Ability `json:"abilities"`
+}
+
+// User is the user entity of a policy document
+type User struct {
+	ID       string   `json:"id"`
+	Username string   `json:"username,omitempty"`
+	Roles    []string `json:"roles"`
+}
+
+// GetID returns the ID
+func (user User) GetID() string {
+	return user.ID
+}
+
+// GetUsername returns the username
+func (user User) GetUsername() string {
+	return user.Username
+}
+
+// GetRoles returns the role IDs
+func (user User) GetRoles() []string {
+	return user.Roles
+}
+
+// Document is the policy document
+type Document struct {
+	Roles          []Role          `json:"roles"`
+	PermissionSets []PermissionSet `json:"permission_sets,omitempty"`
+	Users          []User          `json:"users,omitempty"`
+	Checksum       string          `json:"checksum,omitempty"`
+}
+
+// FindByIDs returns the roles with the given IDs. Document is a read-only gate.RoleService
+func (document Document) FindByIDs(ids []string) (roles []gate.Role, err error) {
+	for _, role := range document.Roles {
+		for _, id := range ids {
+			if role.ID == id {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+	return
+}
+
+// FindPermissionSets returns the permission sets with the given names. Document is a read-only gate.PermissionSetService
+func (document Document) FindPermissionSets(names []string) (sets []gate.PermissionSet, err error) {
+	for _, set := range document.PermissionSets {
+		for _, name := range names {
+			if set.Name == name {
+				abilities := make([]gate.UserAbility, len(set.Abilities))
+				for i, ability := range set.Abilities {
+					abilities[i] = ability
+				}
+
+				sets = append(sets, gate.PermissionSet{Name: set.Name, Abilities: abilities})
+				break
+			}
+		}
+	}
+	return
+}
+
+// FindOneByID returns the user with the given ID
+func (document Document) FindOneByID(id string) (gate.User, error) {
+	for _, user := range document.Users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+
+	return nil, ErrUserNotFound
+}
+
+// FindOrCreateOneByUsername returns the user with the given username. Users are never created in a document
+func (document Document) FindOrCreateOneByUsername(username string) (gate.User, error) {
+	for _, user := range document.Users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+
+	return nil, ErrUserNotFound
+}
+
+// Load decodes a JSON policy document
+func Load(reader io.Reader) (document Document, err error) {
+	err = json.NewDecoder(reader).Decode(&document)
+	if err != nil {
+		err = errors.Wrap(err, "could not decode the policy document")
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+const fixture = `{
+	"roles": [
+		{"id": "editor", "abilities": [{"action": "GET", "object": "/posts*"}, {"action": "POST", "object": "/posts*"}]},
+		{"id": "viewer", "abilities": [{"action": "GET", "object": "*"}]}
+	],
+	"users": [
+		{"id": "1", "username": "alice", "roles": ["editor"]}
+	]
+}`
+
+func TestLoad(t *testing.T) {
+	document, err := Load(strings.NewReader(fixture))
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid document: %s", err)
+	}
+
+	roles, err := document.FindByIDs([]string{"editor", "missing"})
+	if err != nil || len(roles) != 1 || len(roles[0].GetAbilities()) != 2 {
+		t.Fatalf("the existing role should be found: %v - %v", roles, err)
+	}
+
+	user, err := document.FindOneByID("1")
+	if err != nil || user.GetUsername() != "alice" {
+		t.Fatalf("the existing user should be found: %v - %v", user, err)
+	}
+
+	_, err = document.FindOrCreateOneByUsername("bob")
+	if err != ErrUserNotFound {
+		t.Fatalf("err should be ErrUserNotFound: %v", err)
+	}
+
+	_, err = Load(strings.NewReader("{"))
+	if err == nil {
+		t.Fatal("err should not be nil because of the invalid document")
+	}
+}
+
+func TestPermissionSets(t *testing.T) {
+	document, err := Load(strings.NewReader(`{
+		"roles": [{"id": "writer", "abilities": [], "permission_sets": ["content-editor"]}],
+		"permission_sets": [{"name": "content-editor", "abilities": [{"action": "POST", "object": "/posts*"}]}]
+	}`))
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid document: %s", err)
+	}
+
+	sets, err := document.FindPermissionSets([]string{"content-editor", "missing"})
+	if err != nil || len(sets) != 1 || len(sets[0].Abilities) != 1 {
+		t.Fatalf("the existing permission set should be found: %v - %v", sets, err)
+	}
+
+	if names := document.Roles[0].GetPermissionSets(); len(names) != 1 || names[0] != "content-editor" {
+		t.Fatalf("the role should reference the permission set: %v", names)
+	}
+}
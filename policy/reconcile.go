@@ -0,0 +1,327 @@
+package policy
+
+import (
+	"sort"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// ChangeKind is the kind of a change of a plan
+type ChangeKind string
+
+// Kinds of changes, applied in this order so roles exist before they are assigned and are revoked before they are deleted
+const (
+	CreateRole ChangeKind = "create_role"
+	UpdateRole ChangeKind = "update_role"
+	AssignRole ChangeKind = "assign_role"
+	RevokeRole ChangeKind = "revoke_role"
+	DeleteRole ChangeKind = "delete_role"
+)
+
+var changeOrder = map[ChangeKind]int{CreateRole: 0, UpdateRole: 1, AssignRole: 2, RevokeRole: 3, DeleteRole: 4}
+
+// Change is a change of a plan. Abilities are the desired abilities of created and updated roles
+type Change struct {
+	Kind      ChangeKind `json:"kind"`
+	RoleID    string     `json:"role_id"`
+	UserID    string     `json:"user_id,omitempty"`
+	Abilities []Ability  `json:"abilities,omitempty"`
+}
+
+type changesByOrder []Change
+
+func (changes changesByOrder) Len() int {
+	return len(changes)
+}
+
+func (changes changesByOrder) Swap(i, j int) {
+	changes[i], changes[j] = changes[j], changes[i]
+}
+
+func (changes changesByOrder) Less(i, j int) bool {
+	if changes[i].Kind != changes[j].Kind {
+		return changeOrder[changes[i].Kind] < changeOrder[changes[j].Kind]
+	}
+
+	if changes[i].UserID != changes[j].UserID {
+		return changes[i].UserID < changes[j].UserID
+	}
+	return changes[i].RoleID < changes[j].RoleID
+}
+
+// Plan is the ordered list of changes reconciling the current policy with the desired one, e.g. reviewed before being applied.
+// Plans are JSON-encoded for infrastructure-as-code tools
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+// Empty reports whether the current policy is already the desired one
+func (plan Plan) Empty() bool {
+	return len(plan.Changes) == 0
+}
+
+// expandAbilities returns the canonical abilities of a role along with the abilities of its permission sets,
+// since role managers store abilities only
+func (document Document) expandAbilities(role Role) ([]Ability, error) {
+	abilities := append([]Ability{}, role.Abilities...)
+	for _, name := range role.PermissionSets {
+		found := false
+		for _, set := range document.PermissionSets {
+			if set.Name == name {
+				abilities = append(abilities, set.Abilities...)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, errors.WithMessage(gate.ErrPermissionSetNotFound, name)
+		}
+	}
+
+	return canonicalAbilities(abilities), nil
+}
+
+func sameAbilities(a, b []Ability) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff computes the plan turning the current policy into the desired one. Roles and users of the current policy
+// missing from the desired one are deleted and have their roles revoked. Permission sets of the desired roles are expanded
+// into their abilities. It fails with gate.ErrPermissionSetNotFound if a referenced set is missing
+func Diff(desired, current Document) (plan Plan, err error) {
+	plan.Changes = []Change{}
+	currentRoles := map[string]Role{}
+	for _, role := range current.Roles {
+		currentRoles[role.ID] = role
+	}
+
+	desiredRoles := map[string]bool{}
+	for _, role := range desired.Roles {
+		desiredRoles[role.ID] = true
+
+		var abilities []Ability
+		abilities, err = desired.expandAbilities(role)
+		if err != nil {
+			plan.Changes = nil
+			return
+		}
+
+		existing, ok := currentRoles[role.ID]
+		if !ok {
+			plan.Changes = append(plan.Changes, Change{Kind: CreateRole, RoleID: role.ID, Abilities: abilities})
+			continue
+		}
+
+		// permission sets missing from the current policy are left out, e.g. in snapshots
+		existingAbilities, expandErr := current.expandAbilities(existing)
+		if expandErr != nil {
+			existingAbilities = canonicalAbilities(existing.Abilities)
+		}
+
+		if !sameAbilities(abilities, existingAbilities) {
+			plan.Changes = append(plan.Changes, Change{Kind: UpdateRole, RoleID: role.ID, Abilities: abilities})
+		}
+	}
+
+	for _, role := range current.Roles {
+		if !desiredRoles[role.ID] {
+			plan.Changes = append(plan.Changes, Change{Kind: DeleteRole, RoleID: role.ID})
+		}
+	}
+
+	currentUsers := map[string]User{}
+	for _, user := range current.Users {
+		currentUsers[user.ID] = user
+	}
+
+	desiredUsers := map[string]bool{}
+	for _, user := range desired.Users {
+		desiredUsers[user.ID] = true
+		plan.Changes = append(plan.Changes, diffAssignments(user.ID, user.Roles, currentUsers[user.ID].Roles)...)
+	}
+
+	for _, user := range current.Users {
+		if !desiredUsers[user.ID] {
+			plan.Changes = append(plan.Changes, diffAssignments(user.ID, nil, user.Roles)...)
+		}
+	}
+
+	sort.Stable(changesByOrder(plan.Changes))
+	return
+}
+
+// diffAssignments returns the assignments and revocations turning the current roles of a user into the desired ones
+func diffAssignments(userID string, desired, current []string) (changes []Change) {
+	assigned := map[string]bool{}
+	for _, id := range current {
+		assigned[id] = true
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range desired {
+		if !wanted[id] && !assigned[id] {
+			changes = append(changes, Change{Kind: AssignRole, RoleID: id, UserID: userID})
+		}
+		wanted[id] = true
+	}
+
+	for _, id := range current {
+		if !wanted[id] {
+			changes = append(changes, Change{Kind: RevokeRole, RoleID: id, UserID: userID})
+		}
+		wanted[id] = true
+	}
+	return
+}
+
+// Reconciler reconciles the roles and the assignments of the role managers with policy documents,
+// e.g. from an infrastructure-as-code tool. Only the managed roles and users are ever changed, i.e. those of the documents
+// and those set with SetManaged, e.g. the ones of the previously applied document, so they are deleted once removed from the document
+type Reconciler struct {
+	roles        gate.RoleService
+	roleManager  gate.RoleManager
+	userRoles    gate.UserRoleManager
+	managedRoles []string
+	managedUsers []string
+}
+
+// SetManaged is the setter for the roles and the users managed besides the ones of the documents
+func (reconciler *Reconciler) SetManaged(roleIDs, userIDs []string) {
+	reconciler.managedRoles = roleIDs
+	reconciler.managedUsers = userIDs
+}
+
+// Current builds the current policy of the managed roles and users along with the ones of the document
+func (reconciler Reconciler) Current(document Document) (current Document, err error) {
+	roleIDs := append([]string{}, reconciler.managedRoles...)
+	for _, role := range document.Roles {
+		roleIDs = append(roleIDs, role.ID)
+	}
+
+	current, err = Snapshot(reconciler.roles, unique(roleIDs))
+	if err != nil {
+		return
+	}
+
+	userIDs := append([]string{}, reconciler.managedUsers...)
+	for _, user := range document.Users {
+		userIDs = append(userIDs, user.ID)
+	}
+
+	userIDs = unique(userIDs)
+	if len(userIDs) == 0 {
+		return
+	}
+
+	if reconciler.userRoles == nil {
+		err = errors.New("user service does not support role assignment")
+		return
+	}
+
+	for _, id := range userIDs {
+		var roles []string
+		roles, err = reconciler.userRoles.ListRoles(id)
+		if err != nil {
+			err = errors.Wrap(err, "could not list the roles of the user "+id)
+			return
+		}
+
+		current.Users = append(current.Users, User{ID: id, Roles: roles})
+	}
+
+	current = current.Canonical()
+	return
+}
+
+// Plan computes the plan reconciling the current policy with the document
+func (reconciler Reconciler) Plan(document Document) (plan Plan, err error) {
+	current, err := reconciler.Current(document)
+	if err != nil {
+		return
+	}
+
+	return Diff(document, current)
+}
+
+// Apply applies the changes of a plan in order and returns the applied ones. It stops at the first failure,
+// so the plan of the document is computed again before retrying
+func (reconciler Reconciler) Apply(plan Plan) (applied Plan, err error) {
+	applied.Changes = []Change{}
+	for _, change := range plan.Changes {
+		err = reconciler.apply(change)
+		if err != nil {
+			err = errors.Wrapf(err, "could not apply the change %s of the role %s", change.Kind, change.RoleID)
+			return
+		}
+
+		applied.Changes = append(applied.Changes, change)
+	}
+	return
+}
+
+func (reconciler Reconciler) apply(change Change) error {
+	abilities := make([]gate.UserAbility, len(change.Abilities))
+	for i, ability := range change.Abilities {
+		abilities[i] = ability
+	}
+
+	switch change.Kind {
+	case CreateRole:
+		return reconciler.roleManager.CreateRole(change.RoleID, abilities)
+	case UpdateRole:
+		return reconciler.roleManager.UpdateRole(change.RoleID, abilities)
+	case DeleteRole:
+		return reconciler.roleManager.DeleteRole(change.RoleID)
+	}
+
+	if reconciler.userRoles == nil {
+		return errors.New("user service does not support role assignment")
+	}
+
+	switch change.Kind {
+	case AssignRole:
+		return reconciler.userRoles.AssignRole(change.UserID, change.RoleID)
+	case RevokeRole:
+		return reconciler.userRoles.RevokeRole(change.UserID, change.RoleID)
+	}
+
+	return errors.Errorf("unknown change %q", change.Kind)
+}
+
+// Reconcile computes and applies the plan of the document, returning the applied changes
+func (reconciler Reconciler) Reconcile(document Document) (applied Plan, err error) {
+	plan, err := reconciler.Plan(document)
+	if err != nil {
+		return
+	}
+
+	return reconciler.Apply(plan)
+}
+
+func unique(values []string) (result []string) {
+	seen := map[string]bool{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return
+}
+
+// NewReconciler is the constructor for Reconciler. The role service is usually the role manager itself, e.g. a gate.CachedRoleService
+// or the role service of a password.Driver along with the driver. The user-role manager is only required by documents with users
+func NewReconciler(roles gate.RoleService, roleManager gate.RoleManager, userRoles gate.UserRoleManager) Reconciler {
+	return Reconciler{roles: roles, roleManager: roleManager, userRoles: userRoles}
+}
@@ -0,0 +1,234 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hiendv/gate"
+	"github.com/pkg/errors"
+)
+
+// testStore is the in-memory role and user-role manager of the reconciliation
+type testStore struct {
+	roles   map[string]Role
+	users   map[string][]string
+	failOn  ChangeKind
+	applied []ChangeKind
+}
+
+func (store *testStore) FindByIDs(ids []string) (roles []gate.Role, err error) {
+	for _, id := range ids {
+		if role, ok := store.roles[id]; ok {
+			roles = append(roles, role)
+		}
+	}
+	return
+}
+
+func (store *testStore) change(kind ChangeKind) error {
+	if kind == store.failOn {
+		return errors.New("failed")
+	}
+
+	store.applied = append(store.applied, kind)
+	return nil
+}
+
+func (store *testStore) setRole(id string, abilities []gate.UserAbility) {
+	role := Role{ID: id}
+	for _, ability := range abilities {
+		role.Abilities = append(role.Abilities, ability.(Ability))
+	}
+	store.roles[id] = role
+}
+
+func (store *testStore) CreateRole(id string, abilities []gate.UserAbility) error {
+	store.setRole(id, abilities)
+	return store.change(CreateRole)
+}
+
+func (store *testStore) UpdateRole(id string, abilities []gate.UserAbility) error {
+	store.setRole(id, abilities)
+	return store.change(UpdateRole)
+}
+
+func (store *testStore) DeleteRole(id string) error {
+	delete(store.roles, id)
+	return store.change(DeleteRole)
+}
+
+func (store *testStore) AttachAbility(id string, ability gate.UserAbility) error {
+	return errors.New("not supported")
+}
+
+func (store *testStore) DetachAbility(id string, ability gate.UserAbility) error {
+	return errors.New("not supported")
+}
+
+func (store *testStore) AssignRole(userID, roleID string) error {
+	store.users[userID] = append(store.users[userID], roleID)
+	return store.change(AssignRole)
+}
+
+func (store *testStore) RevokeRole(userID, roleID string) error {
+	roles := []string{}
+	for _, id := range store.users[userID] {
+		if id != roleID {
+			roles = append(roles, id)
+		}
+	}
+	store.users[userID] = roles
+	return store.change(RevokeRole)
+}
+
+func (store *testStore) ListRoles(userID string) ([]string, error) {
+	return store.users[userID], nil
+}
+
+func newTestStore() *testStore {
+	return &testStore{
+		roles: map[string]Role{
+			"viewer": {ID: "viewer", Abilities: []Ability{{Action: "GET", Object: "/posts*"}}},
+			"legacy": {ID: "legacy", Abilities: []Ability{{Action: "GET", Object: "*"}}},
+		},
+		users: map[string][]string{
+			"1": {"viewer"},
+			"2": {"legacy"},
+		},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	desired := Document{
+		Roles: []Role{
+			{ID: "viewer", Abilities: []Ability{{Action: "GET", Object: "*"}}},
+			{ID: "editor", PermissionSets: []string{"writer"}},
+			{ID: "admin", Abilities: []Ability{{Action: "*", Object: "*"}}},
+		},
+		PermissionSets: []PermissionSet{{Name: "writer", Abilities: []Ability{{Action: "POST", Object: "/posts*"}}}},
+		Users:          []User{{ID: "1", Roles: []string{"editor", "viewer"}}},
+	}
+	current := Document{
+		Roles: []Role{
+			{ID: "viewer", Abilities: []Ability{{Action: "GET", Object: "/posts*"}}},
+			{ID: "admin", Abilities: []Ability{{Action: "*", Object: "*"}, {Action: "*", Object: "*"}}},
+			{ID: "legacy"},
+		},
+		Users: []User{{ID: "1", Roles: []string{"viewer", "legacy"}}, {ID: "2", Roles: []string{"legacy"}}},
+	}
+
+	plan, err := Diff(desired, current)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	expected := []Change{
+		{Kind: CreateRole, RoleID: "editor", Abilities: []Ability{{Action: "POST", Object: "/posts*"}}},
+		{Kind: UpdateRole, RoleID: "viewer", Abilities: []Ability{{Action: "GET", Object: "*"}}},
+		{Kind: AssignRole, RoleID: "editor", UserID: "1"},
+		{Kind: RevokeRole, RoleID: "legacy", UserID: "1"},
+		{Kind: RevokeRole, RoleID: "legacy", UserID: "2"},
+		{Kind: DeleteRole, RoleID: "legacy"},
+	}
+
+	got, _ := json.Marshal(plan.Changes)
+	want, _ := json.Marshal(expected)
+	if string(got) != string(want) {
+		t.Fatalf("the plan should create, update, assign, revoke then delete:\n%s\n%s", got, want)
+	}
+
+	t.Run("in sync", func(t *testing.T) {
+		plan, err := Diff(desired, desired)
+		if err != nil || !plan.Empty() {
+			t.Fatalf("the plan of the same policy should be empty: %v - %v", plan, err)
+		}
+	})
+
+	t.Run("missing permission set", func(t *testing.T) {
+		_, err := Diff(Document{Roles: []Role{{ID: "editor", PermissionSets: []string{"missing"}}}}, current)
+		if errors.Cause(err) != gate.ErrPermissionSetNotFound {
+			t.Fatalf("err should be gate.ErrPermissionSetNotFound because of the missing permission set: %v", err)
+		}
+	})
+}
+
+func TestReconciler(t *testing.T) {
+	document := Document{
+		Roles: []Role{{ID: "viewer", Abilities: []Ability{{Action: "GET", Object: "*", StepUp: true}}}},
+		Users: []User{{ID: "1", Roles: []string{"viewer"}}},
+	}
+
+	t.Run("reconcile", func(t *testing.T) {
+		store := newTestStore()
+		reconciler := NewReconciler(store, store, store)
+		reconciler.SetManaged([]string{"legacy"}, []string{"2"})
+
+		plan, err := reconciler.Plan(document)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if len(plan.Changes) != 3 || plan.Changes[0].Kind != UpdateRole || plan.Changes[2].Kind != DeleteRole {
+			t.Fatalf("the plan should update the viewer, revoke and delete the legacy role: %v", plan.Changes)
+		}
+
+		if len(store.applied) != 0 {
+			t.Fatalf("planning should not change anything: %v", store.applied)
+		}
+
+		applied, err := reconciler.Apply(plan)
+		if err != nil || len(applied.Changes) != 3 {
+			t.Fatalf("the plan should be applied: %v - %v", applied, err)
+		}
+
+		if _, ok := store.roles["legacy"]; ok || !gate.RequiresStepUp(store.roles["viewer"].Abilities[0]) {
+			t.Fatalf("the roles should be reconciled: %v", store.roles)
+		}
+
+		plan, err = reconciler.Plan(document)
+		if err != nil || !plan.Empty() {
+			t.Fatalf("the reconciled policy should have an empty plan: %v - %v", plan, err)
+		}
+	})
+
+	t.Run("unmanaged", func(t *testing.T) {
+		store := newTestStore()
+		applied, err := NewReconciler(store, store, store).Reconcile(document)
+		if err != nil || len(applied.Changes) != 1 {
+			t.Fatalf("only the viewer role should be updated: %v - %v", applied, err)
+		}
+
+		if _, ok := store.roles["legacy"]; !ok || len(store.users["2"]) != 1 {
+			t.Fatal("unmanaged roles and users should be left untouched")
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		store := newTestStore()
+		store.failOn = RevokeRole
+		reconciler := NewReconciler(store, store, store)
+		reconciler.SetManaged([]string{"legacy"}, []string{"2"})
+
+		applied, err := reconciler.Reconcile(document)
+		if err == nil {
+			t.Fatal("err should not be nil because of the failed revocation")
+		}
+
+		if len(applied.Changes) != 1 || applied.Changes[0].Kind != UpdateRole {
+			t.Fatalf("the changes applied before the failure should be returned: %v", applied.Changes)
+		}
+	})
+
+	t.Run("without user-role manager", func(t *testing.T) {
+		store := newTestStore()
+		_, err := NewReconciler(store, store, nil).Plan(document)
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing user-role manager")
+		}
+
+		plan, err := NewReconciler(store, store, nil).Plan(Document{Roles: document.Roles})
+		if err != nil || len(plan.Changes) != 1 {
+			t.Fatalf("roles should be reconciled without a user-role manager: %v - %v", plan, err)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package gate
+
+// ClaimsProjection controls which user information is embedded in the claims of issued tokens.
+// The zero value embeds the ID, the username and the roles
+type ClaimsProjection struct {
+	// OmitUsername leaves the username out of the claims
+	OmitUsername bool
+	// HashUsername embeds the hex-encoded SHA-256 of the username instead of the username
+	HashUsername bool
+	// OmitRoles leaves the roles out of the claims
+	OmitRoles bool
+}
+
+// ClaimsProjectionIDOnly embeds the user ID only
+var ClaimsProjectionIDOnly = ClaimsProjection{OmitUsername: true, OmitRoles: true}
+
+// Project returns the user information of a user allowed by the projection
+func (projection ClaimsProjection) Project(user User) (info UserInfo) {
+	info.ID = user.GetID()
+	switch {
+	case projection.OmitUsername:
+	case projection.HashUsername:
+		info.Username = HashUsername(user.GetUsername())
+	default:
+		info.Username = user.GetUsername()
+	}
+
+	if !projection.OmitRoles {
+		info.Roles = user.GetRoles()
+	}
+	return
+}
+
+// ClaimsUser is the User built from the user information of claims, e.g. for stateless authentication
+type ClaimsUser UserInfo
+
+// GetID returns the user ID of the claims
+func (user ClaimsUser) GetID() string {
+	return user.ID
+}
+
+// GetUsername returns the username of the claims, which may be hashed or omitted by the claims projection
+func (user ClaimsUser) GetUsername() string {
+	return user.Username
+}
+
+// GetRoles returns the roles of the claims, which may be omitted by the claims projection
+func (user ClaimsUser) GetRoles() []string {
+	return user.Roles
+}
+
+// GetEmail returns the email of the claims, which is only mapped from externally issued tokens
+func (user ClaimsUser) GetEmail() string {
+	return user.Email
+}
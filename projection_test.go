@@ -0,0 +1,46 @@
+package gate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestClaimsProjection(t *testing.T) {
+	user := testUser{ID: "id", Username: "alice", Roles: []string{"editor"}}
+
+	full := ClaimsProjection{}.Project(user)
+	if full.Username != "alice" || len(full.Roles) != 1 {
+		t.Fatalf("every information should be projected by default: %v", full)
+	}
+
+	hashed := ClaimsProjection{HashUsername: true}.Project(user)
+	if hashed.Username != HashUsername("alice") {
+		t.Fatalf("username should be hashed: %v", hashed)
+	}
+
+	idOnly := ClaimsProjectionIDOnly.Project(user)
+	if idOnly.ID != "id" || idOnly.Username != "" || idOnly.Roles != nil {
+		t.Fatalf("only the ID should be projected: %v", idOnly)
+	}
+
+	data, err := json.Marshal(idOnly)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	if strings.Contains(string(data), "username") || strings.Contains(string(data), "roles") {
+		t.Fatalf("omitted information should not be encoded: %s", data)
+	}
+
+	config, err := NewHMACJWTConfig("HS256", "secret", 0, false)
+	if err != nil {
+		t.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	config.SetClaimsProjection(ClaimsProjectionIDOnly)
+	claims := NewJWTService(config).NewClaims(user)
+	if claims.User.Username != "" || claims.User.Roles != nil {
+		t.Fatalf("claims should be projected: %v", claims.User)
+	}
+}
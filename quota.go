@@ -0,0 +1,114 @@
+package gate
+
+import (
+	"sync"
+	"time"
+)
+
+// Quota is the usage limit of an ability within a fixed period, e.g. 10 per day
+type Quota struct {
+	Limit  int64
+	Period time.Duration
+}
+
+// Limited is the optional contract for abilities with a usage quota. Every authorization granted by a limited ability consumes the quota
+type Limited interface {
+	GetQuota() Quota
+}
+
+// CounterStore is the contract for the storage of quota counters.
+// Increment must atomically increment the counter of the key within the current period of the given length and return the new count
+type CounterStore interface {
+	Increment(key string, period time.Duration) (int64, error)
+}
+
+// CounterReader is the optional contract for counter stores reading the count of the current period without incrementing it,
+// e.g. for simulated authorizations
+type CounterReader interface {
+	Count(key string) (int64, error)
+}
+
+// CounterSweepInterval is the interval at which MemoryCounterStore purges the counters of past periods
+const CounterSweepInterval = time.Minute
+
+type counter struct {
+	count   int64
+	resetAt time.Time
+}
+
+type counters struct {
+	entries map[string]counter
+	sweptAt time.Time
+}
+
+// MemoryCounterStore is the in-memory CounterStore with fixed periods starting at the first increment.
+// Counters of past periods are purged by the increments at most every CounterSweepInterval
+type MemoryCounterStore struct {
+	counters *counters
+	Now      func() time.Time
+	*sync.Mutex
+}
+
+// Increment increments the counter of the key within the current period
+func (store MemoryCounterStore) Increment(key string, period time.Duration) (int64, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	now := store.Now()
+	store.sweep(now)
+
+	entry, ok := store.counters.entries[key]
+	if !ok || !now.Before(entry.resetAt) {
+		entry = counter{0, now.Add(period)}
+	}
+
+	entry.count++
+	store.counters.entries[key] = entry
+	return entry.count, nil
+}
+
+// Count returns the count of the key within the current period
+func (store MemoryCounterStore) Count(key string) (int64, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	entry, ok := store.counters.entries[key]
+	if !ok || !store.Now().Before(entry.resetAt) {
+		return 0, nil
+	}
+
+	return entry.count, nil
+}
+
+// Len returns the number of counters, those of past periods included until they are purged
+func (store MemoryCounterStore) Len() int {
+	store.Lock()
+	defer store.Unlock()
+
+	return len(store.counters.entries)
+}
+
+// sweep purges the counters of past periods unless they were purged within CounterSweepInterval
+func (store MemoryCounterStore) sweep(now time.Time) {
+	if now.Sub(store.counters.sweptAt) < CounterSweepInterval {
+		return
+	}
+
+	for key, entry := range store.counters.entries {
+		if !now.Before(entry.resetAt) {
+			delete(store.counters.entries, key)
+		}
+	}
+	store.counters.sweptAt = now
+}
+
+// NewMemoryCounterStore is the constructor for MemoryCounterStore
+func NewMemoryCounterStore() MemoryCounterStore {
+	return MemoryCounterStore{
+		counters: &counters{entries: map[string]counter{}},
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+		Mutex: &sync.Mutex{},
+	}
+}
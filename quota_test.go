@@ -0,0 +1,69 @@
+package gate
+
+import (
+	"testing"
+	"time"
+)
+
+type testLimitedAbility struct {
+	testAbility
+	quota Quota
+}
+
+func (a testLimitedAbility) GetQuota() Quota {
+	return a.quota
+}
+
+func TestMemoryCounterStore(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	store := NewMemoryCounterStore()
+	store.Now = func() time.Time {
+		return now
+	}
+
+	for i := int64(1); i <= 3; i++ {
+		count, err := store.Increment("a", time.Hour)
+		if err != nil || count != i {
+			t.Fatalf("count should be incremented: %d %v", count, err)
+		}
+	}
+
+	if count, _ := store.Increment("b", time.Hour); count != 1 {
+		t.Fatalf("counters should be independent: %d", count)
+	}
+
+	now = now.Add(time.Hour)
+	if count, _ := store.Increment("a", time.Hour); count != 1 {
+		t.Fatalf("counters should be reset with the period: %d", count)
+	}
+
+	if store.Len() != 1 {
+		t.Fatalf("counters of past periods should be purged: %d", store.Len())
+	}
+
+	store.Increment("c", time.Minute)
+	now = now.Add(time.Minute)
+	store.Increment("d", time.Hour)
+	if store.Len() != 2 {
+		t.Fatalf("counters of past periods should be purged once the sweep interval elapses: %d", store.Len())
+	}
+}
+
+func TestAbilityIndexLimited(t *testing.T) {
+	index := NewAbilityIndex([]UserAbility{
+		testAbility{"GET", "reports"},
+		testLimitedAbility{testAbility{"export", "reports"}, Quota{10, time.Hour * 24}},
+	}, NewMatcher())
+
+	if index.Allows("export", "reports") {
+		t.Fatal("limited abilities should not grant by themselves")
+	}
+
+	if limited := index.Conditional("export", "reports"); len(limited) != 1 {
+		t.Fatalf("matching limited abilities should be returned: %v", limited)
+	}
+
+	if limited := index.Conditional("GET", "reports"); len(limited) != 0 {
+		t.Fatalf("unlimited abilities should not be returned: %v", limited)
+	}
+}
@@ -0,0 +1,113 @@
+package gate
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrAuthenticationFailed is the public error of redacted authentication failures
+var ErrAuthenticationFailed = errors.New("authentication failed")
+
+// ErrAuthenticationUnavailable is the public error of redacted authentication or login failures which are not authentication failures,
+// e.g. a user store outage, so clients do not drop their valid tokens or credentials
+var ErrAuthenticationUnavailable = errors.New("authentication is unavailable")
+
+// ErrLoginFailed is the public error of redacted login failures
+var ErrLoginFailed = errors.New("invalid credentials")
+
+// ErrAuthorizationFailed is the public error of redacted authorization failures which are not denials, e.g. a missing role service
+var ErrAuthorizationFailed = errors.New("authorization failed")
+
+// Redactor maps an internal error to the public error returned to callers. The fallback is the public error of the failed operation
+type Redactor func(err, fallback error) error
+
+// RedactedError is a public error keeping the internal error for logs.
+// Its cause is the public error, so callers and responders relying on errors.Cause keep working
+type RedactedError struct {
+	public   error
+	internal error
+}
+
+// Error returns the message of the public error
+func (err RedactedError) Error() string {
+	return err.public.Error()
+}
+
+// Cause returns the public error, see github.com/pkg/errors
+func (err RedactedError) Cause() error {
+	return err.public
+}
+
+// Internal returns the internal error with its full chain
+func (err RedactedError) Internal() error {
+	return err.internal
+}
+
+// NewRedactedError is the constructor for RedactedError
+func NewRedactedError(public, internal error) RedactedError {
+	return RedactedError{public, internal}
+}
+
+// Internal returns the internal error of a redacted error or the error itself
+func Internal(err error) error {
+	if redacted, ok := err.(RedactedError); ok {
+		return redacted.Internal()
+	}
+
+	return err
+}
+
+// publicErrors are the errors safe to be returned to callers as is since they only describe the outcome
+var publicErrors = []error{
+	ErrForbidden,
+	ErrNoAbilities,
+	ErrTokenConsumed,
+	ErrTokenRevoked,
+	ErrMFARequired,
+	ErrQuotaExceeded,
+	ErrSessionLimitExceeded,
+	ErrStepUpRequired,
+	ErrRoleServiceUnavailable,
+	ErrChallengeRequired,
+	ErrChallengeFailed,
+	ErrAuthenticationFailed,
+	ErrAuthenticationUnavailable,
+	ErrLoginFailed,
+	ErrAuthorizationFailed,
+}
+
+// RedactErrors is the Redactor keeping the outcome of the failures defined by gate, e.g. ErrForbidden without its message,
+// and replacing any other failure with the fallback
+func RedactErrors(err, fallback error) error {
+	cause := errors.Cause(err)
+	for _, public := range publicErrors {
+		if cause == public {
+			return public
+		}
+	}
+
+	return fallback
+}
+
+// Redact returns the public error of an internal error with the redactor. Errors already public or redacted are returned as is.
+// The fallbacks of authentication failures, ErrAuthenticationFailed and ErrLoginFailed, are replaced with ErrAuthenticationUnavailable
+// for the errors which are not authentication failures, see IsAuthenticationError
+func Redact(redactor Redactor, err, fallback error) error {
+	if err == nil || redactor == nil {
+		return err
+	}
+
+	if _, ok := err.(RedactedError); ok {
+		return err
+	}
+
+	if (fallback == ErrAuthenticationFailed || fallback == ErrLoginFailed) && !IsAuthenticationError(err) {
+		fallback = ErrAuthenticationUnavailable
+	}
+
+	public := redactor(err, fallback)
+	if public == err {
+		return err
+	}
+
+	return RedactedError{public, err}
+}
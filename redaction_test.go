@@ -0,0 +1,60 @@
+package gate
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestRedact(t *testing.T) {
+	internal := errors.Wrap(errors.New("sql: no rows in result set"), "could not find the user with the given id")
+
+	t.Run("internal", func(t *testing.T) {
+		err := Redact(RedactErrors, internal, ErrAuthorizationFailed)
+		if err.Error() != ErrAuthorizationFailed.Error() || errors.Cause(err) != ErrAuthorizationFailed {
+			t.Fatalf("the internal error should be redacted: %v", err)
+		}
+
+		if Internal(err) != internal {
+			t.Fatalf("the internal error should be kept: %v", Internal(err))
+		}
+
+		if Redact(RedactErrors, err, ErrAuthorizationFailed) != err {
+			t.Fatal("redacted errors should not be redacted again")
+		}
+	})
+
+	t.Run("authentication", func(t *testing.T) {
+		err := Redact(RedactErrors, internal, ErrAuthenticationFailed)
+		if errors.Cause(err) != ErrAuthenticationUnavailable || IsAuthenticationError(err) {
+			t.Fatalf("failures which are not authentication failures should not be redacted as such: %v", err)
+		}
+
+		err = Redact(RedactErrors, errors.Wrap(ErrUserNotFound, "could not find the user with the given id"), ErrAuthenticationFailed)
+		if errors.Cause(err) != ErrAuthenticationFailed {
+			t.Fatalf("authentication failures should be redacted with the fallback: %v", err)
+		}
+
+		err = Redact(RedactErrors, NewAuthenticationError(errors.New("invalid credentials")), ErrLoginFailed)
+		if errors.Cause(err) != ErrLoginFailed {
+			t.Fatalf("login failures should be redacted with the fallback: %v", err)
+		}
+	})
+
+	t.Run("public", func(t *testing.T) {
+		err := Redact(RedactErrors, errors.WithMessage(ErrTokenRevoked, "token abc"), ErrAuthenticationFailed)
+		if err.Error() != ErrTokenRevoked.Error() || errors.Cause(err) != ErrTokenRevoked {
+			t.Fatalf("the outcome should be kept without the message: %v", err)
+		}
+
+		if Redact(RedactErrors, ErrForbidden, ErrAuthorizationFailed) != ErrForbidden {
+			t.Fatal("public errors should be returned as is")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		if Redact(nil, internal, ErrAuthenticationFailed) != internal || Redact(RedactErrors, nil, ErrAuthenticationFailed) != nil {
+			t.Fatal("errors should not be redacted without a redactor")
+		}
+	})
+}
@@ -0,0 +1,287 @@
+package redis
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultChannel is the channel of the invalidations
+const DefaultChannel = "gate:invalidations"
+
+// DefaultTimeout is the timeout of dialing and of the commands
+const DefaultTimeout = 5 * time.Second
+
+// DefaultReconnectDelay is the delay between the attempts to resubscribe after the connection is lost
+const DefaultReconnectDelay = time.Second
+
+// DialFunc connects to the Redis server, e.g. net.Dial or a TLS dialer
+type DialFunc func(network, address string) (net.Conn, error)
+
+// conn is a connection with its buffered reader and writer
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (c conn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(timeout))
+	if err := writeCommand(c.w, args...); err != nil {
+		return nil, err
+	}
+
+	return readReply(c.r)
+}
+
+// publisher keeps the connection of the publications
+type publisher struct {
+	conn *conn
+	sync.Mutex
+}
+
+// Bus is the gate.InvalidationBus of Redis pub/sub. Role IDs are published on the channel as a JSON array.
+// Subscriptions reconnect when the connection is lost and invalidate every role once resubscribed, since messages may have been missed
+type Bus struct {
+	address        string
+	channel        string
+	password       string
+	timeout        time.Duration
+	reconnectDelay time.Duration
+	publisher      *publisher
+	Dial           DialFunc
+}
+
+// SetChannel is the setter for the channel, DefaultChannel by default
+func (bus *Bus) SetChannel(channel string) {
+	bus.channel = channel
+}
+
+// SetPassword is the setter for the password of the AUTH command. There is no authentication by default
+func (bus *Bus) SetPassword(password string) {
+	bus.password = password
+}
+
+// SetTimeout is the setter for the timeout of dialing and of the commands, DefaultTimeout by default
+func (bus *Bus) SetTimeout(timeout time.Duration) {
+	bus.timeout = timeout
+}
+
+// SetReconnectDelay is the setter for the delay between the attempts to resubscribe, DefaultReconnectDelay by default
+func (bus *Bus) SetReconnectDelay(delay time.Duration) {
+	bus.reconnectDelay = delay
+}
+
+// dial connects and authenticates
+func (bus Bus) dial() (c *conn, err error) {
+	netConn, err := bus.Dial("tcp", bus.address)
+	if err != nil {
+		err = errors.Wrap(err, "could not connect to redis")
+		return
+	}
+
+	c = &conn{netConn, bufio.NewReader(netConn), bufio.NewWriter(netConn)}
+	if bus.password == "" {
+		return
+	}
+
+	if _, err = c.do(bus.timeout, "AUTH", bus.password); err != nil {
+		c.Close()
+		c = nil
+		err = errors.Wrap(err, "could not authenticate to redis")
+	}
+	return
+}
+
+// Publish publishes the role IDs on the channel. The connection is kept for the next publications and redialed once on failures
+func (bus Bus) Publish(roleIDs []string) error {
+	payload, err := json.Marshal(roleIDs)
+	if err != nil {
+		return err
+	}
+
+	bus.publisher.Lock()
+	defer bus.publisher.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		err = bus.publish(string(payload))
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := errors.Cause(err).(Error); ok || attempt > 0 {
+			return errors.Wrap(err, "could not publish the invalidation")
+		}
+	}
+}
+
+func (bus Bus) publish(payload string) (err error) {
+	if bus.publisher.conn == nil {
+		if bus.publisher.conn, err = bus.dial(); err != nil {
+			return
+		}
+	}
+
+	_, err = bus.publisher.conn.do(bus.timeout, "PUBLISH", bus.channel, payload)
+	if _, ok := err.(Error); err != nil && !ok {
+		bus.publisher.conn.Close()
+		bus.publisher.conn = nil
+	}
+	return
+}
+
+// subscription is a running subscription of a handler
+type subscription struct {
+	bus     Bus
+	handler func([]string)
+	conn    *conn
+	stop    chan struct{}
+	done    chan struct{}
+	sync.Mutex
+}
+
+// Subscribe subscribes the handler to the channel. The first connection is made synchronously so misconfigurations fail early
+func (bus Bus) Subscribe(handler func(roleIDs []string)) (cancel func(), err error) {
+	s := &subscription{bus: bus, handler: handler, stop: make(chan struct{}), done: make(chan struct{})}
+	c, err := s.subscribe()
+	if err != nil {
+		return
+	}
+
+	s.conn = c
+	go s.run()
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(s.cancel)
+	}
+	return
+}
+
+// subscribe connects and subscribes to the channel
+func (s *subscription) subscribe() (c *conn, err error) {
+	c, err = s.bus.dial()
+	if err != nil {
+		return
+	}
+
+	reply, err := c.do(s.bus.timeout, "SUBSCRIBE", s.bus.channel)
+	if err == nil && !isKind(reply, "subscribe") {
+		err = errors.New("invalid subscribe reply")
+	}
+
+	if err != nil {
+		c.Close()
+		c = nil
+		err = errors.Wrap(err, "could not subscribe to redis")
+		return
+	}
+
+	c.SetDeadline(time.Time{})
+	return
+}
+
+func (s *subscription) run() {
+	defer close(s.done)
+
+	for {
+		s.Lock()
+		c := s.conn
+		s.Unlock()
+
+		s.receive(c)
+		c.Close()
+		if !s.reconnect() {
+			return
+		}
+
+		// messages may have been missed while reconnecting
+		s.handler(nil)
+	}
+}
+
+// receive handles the messages until the connection fails or is closed
+func (s *subscription) receive(c *conn) {
+	for {
+		reply, err := readReply(c.r)
+		if err != nil {
+			return
+		}
+
+		if !isKind(reply, "message") {
+			continue
+		}
+
+		payload, _ := reply.([]interface{})[2].(string)
+		var roleIDs []string
+		if err = json.Unmarshal([]byte(payload), &roleIDs); err != nil {
+			roleIDs = nil
+		}
+
+		s.handler(roleIDs)
+	}
+}
+
+// reconnect resubscribes until it succeeds or the subscription is cancelled
+func (s *subscription) reconnect() bool {
+	for {
+		select {
+		case <-s.stop:
+			return false
+		case <-time.After(s.bus.reconnectDelay):
+		}
+
+		c, err := s.subscribe()
+		if err != nil {
+			continue
+		}
+
+		s.Lock()
+		select {
+		case <-s.stop:
+			c.Close()
+			c = nil
+		default:
+			s.conn = c
+		}
+		s.Unlock()
+		return c != nil
+	}
+}
+
+func (s *subscription) cancel() {
+	s.Lock()
+	close(s.stop)
+	s.conn.Close()
+	s.Unlock()
+
+	<-s.done
+}
+
+// isKind reports whether a reply is a pub/sub reply of the kind, e.g. ["message", channel, payload]
+func isKind(reply interface{}, kind string) bool {
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 3 {
+		return false
+	}
+
+	value, ok := items[0].(string)
+	return ok && value == kind
+}
+
+// NewBus is the constructor for Bus
+func NewBus(address string) Bus {
+	dialer := &net.Dialer{Timeout: DefaultTimeout}
+	return Bus{
+		address:        address,
+		channel:        DefaultChannel,
+		timeout:        DefaultTimeout,
+		reconnectDelay: DefaultReconnectDelay,
+		publisher:      &publisher{},
+		Dial:           dialer.Dial,
+	}
+}
@@ -0,0 +1,168 @@
+package redis
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// server is a minimal Redis server supporting AUTH, PUBLISH and SUBSCRIBE
+type server struct {
+	listener    net.Listener
+	password    string
+	subscribers map[net.Conn]*bufio.Writer
+	sync.Mutex
+}
+
+func newServer(t *testing.T, password string) *server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("could not listen: %s", err)
+	}
+
+	s := &server{listener: listener, password: password, subscribers: map[net.Conn]*bufio.Writer{}}
+	go s.serve()
+	return s
+}
+
+func (s *server) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(c)
+	}
+}
+
+func (s *server) handle(c net.Conn) {
+	defer c.Close()
+
+	r, w := bufio.NewReader(c), bufio.NewWriter(c)
+	authenticated := s.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			s.Lock()
+			delete(s.subscribers, c)
+			s.Unlock()
+			return
+		}
+
+		var args []string
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, arg.(string))
+		}
+
+		s.Lock()
+		switch {
+		case args[0] == "AUTH":
+			authenticated = args[1] == s.password
+			if authenticated {
+				w.WriteString("+OK\r\n")
+			} else {
+				w.WriteString("-WRONGPASS invalid password\r\n")
+			}
+		case !authenticated:
+			w.WriteString("-NOAUTH Authentication required.\r\n")
+		case args[0] == "SUBSCRIBE":
+			s.subscribers[c] = w
+			w.WriteString("*3\r\n$9\r\nsubscribe\r\n$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n:1\r\n")
+			w.Flush()
+			s.Unlock()
+			continue
+		case args[0] == "PUBLISH":
+			for _, subscriber := range s.subscribers {
+				writeCommand(subscriber, "message", args[1], args[2])
+			}
+			w.WriteString(":" + strconv.Itoa(len(s.subscribers)) + "\r\n")
+		}
+		w.Flush()
+		s.Unlock()
+	}
+}
+
+// drop closes the connections of the subscribers
+func (s *server) drop() {
+	s.Lock()
+	defer s.Unlock()
+
+	for c := range s.subscribers {
+		c.Close()
+		delete(s.subscribers, c)
+	}
+}
+
+func receive(t *testing.T, messages chan []string) []string {
+	select {
+	case roleIDs := <-messages:
+		return roleIDs
+	case <-time.After(time.Second * 5):
+		t.Fatal("invalidation should be received")
+		return nil
+	}
+}
+
+func TestBus(t *testing.T) {
+	s := newServer(t, "secret")
+	defer s.listener.Close()
+
+	bus := NewBus(s.listener.Addr().String())
+	bus.SetReconnectDelay(time.Millisecond * 10)
+	if _, err := bus.Subscribe(func([]string) {}); err == nil {
+		t.Fatal("err should not be nil because of the missing password")
+	}
+
+	bus.SetPassword("secret")
+	messages := make(chan []string, 10)
+	cancel, err := bus.Subscribe(func(roleIDs []string) {
+		messages <- roleIDs
+	})
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+	defer cancel()
+
+	t.Run("publish", func(t *testing.T) {
+		if err := bus.Publish([]string{"admin", "editor"}); err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if roleIDs := receive(t, messages); len(roleIDs) != 2 || roleIDs[1] != "editor" {
+			t.Fatalf("roles should be received: %v", roleIDs)
+		}
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		s.drop()
+		if roleIDs := receive(t, messages); roleIDs != nil {
+			t.Fatalf("every role should be invalidated after reconnecting: %v", roleIDs)
+		}
+
+		if err := bus.Publish([]string{"admin"}); err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if roleIDs := receive(t, messages); len(roleIDs) != 1 || roleIDs[0] != "admin" {
+			t.Fatalf("roles should be received after reconnecting: %v", roleIDs)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		cancel()
+		cancel()
+		if err := bus.Publish([]string{"admin"}); err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		select {
+		case roleIDs := <-messages:
+			t.Fatalf("cancelled subscriptions should not receive: %v", roleIDs)
+		case <-time.After(time.Millisecond * 50):
+		}
+	})
+}
@@ -0,0 +1,4 @@
+// Package redis provides the github.com/hiendv/gate invalidation bus of Redis pub/sub, so role and ability changes on one
+// instance invalidate the cached roles, abilities and decisions of the whole fleet within milliseconds.
+// It speaks the Redis protocol directly and has no dependency on a Redis client
+package redis
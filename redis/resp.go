@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// maxBulkLength limits the bulk strings read from the server, role invalidations are small
+const maxBulkLength = 1 << 20
+
+// Error is a Redis error reply
+type Error string
+
+func (err Error) Error() string {
+	return string(err)
+}
+
+// writeCommand writes a command as an array of bulk strings
+func writeCommand(w *bufio.Writer, args ...string) error {
+	w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		w.WriteString(arg)
+		w.WriteString("\r\n")
+	}
+
+	return w.Flush()
+}
+
+// readReply reads a reply. Simple strings and bulk strings are strings, integers are int64, arrays are []interface{},
+// null replies are nil and error replies are returned as Error
+func readReply(r *bufio.Reader) (reply interface{}, err error) {
+	line, err := readLine(r)
+	if err != nil {
+		return
+	}
+
+	if len(line) == 0 {
+		err = errors.New("invalid reply")
+		return
+	}
+
+	switch line[0] {
+	case '+':
+		reply = line[1:]
+	case '-':
+		err = Error(line[1:])
+	case ':':
+		reply, err = strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		reply, err = readBulk(r, line[1:])
+	case '*':
+		reply, err = readArray(r, line[1:])
+	default:
+		err = errors.Errorf("invalid reply type %q", line[0])
+	}
+	return
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("invalid reply line")
+	}
+
+	return line[:len(line)-2], nil
+}
+
+func readBulk(r *bufio.Reader, size string) (interface{}, error) {
+	length, err := strconv.Atoi(size)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid bulk length")
+	}
+
+	if length < 0 {
+		return nil, nil
+	}
+
+	if length > maxBulkLength {
+		return nil, errors.New("bulk string too long")
+	}
+
+	buf := make([]byte, length+2)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	return string(buf[:length]), nil
+}
+
+func readArray(r *bufio.Reader, size string) (interface{}, error) {
+	length, err := strconv.Atoi(size)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid array length")
+	}
+
+	if length < 0 {
+		return nil, nil
+	}
+
+	items := make([]interface{}, 0, length)
+	for i := 0; i < length; i++ {
+		item, err := readReply(r)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
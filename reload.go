@@ -0,0 +1,109 @@
+package gate
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// jwtReload is the configuration state shared by the copies of a JWTService
+type jwtReload struct {
+	sync.RWMutex
+	config         *JWTConfig
+	parser         *jwt.Parser
+	previous       *JWTConfig
+	previousParser *jwt.Parser
+	until          time.Time
+}
+
+// Reload swaps the configuration of the service and all its copies while they are running, e.g. a new key or a new expiration.
+// Tokens are issued with the new configuration at once, tokens verified by the previous configuration keep being accepted
+// within the overlap window so that the rotation does not drop sessions. The claims ID generator of the service is kept
+func (service JWTService) Reload(config JWTConfig, overlap time.Duration) error {
+	if service.reload == nil {
+		return errors.New("JWT service is not reloadable, it should be constructed by NewJWTService")
+	}
+
+	state := service.reload
+	state.Lock()
+	defer state.Unlock()
+
+	previous, previousParser := service.config, service.parser
+	if state.config != nil {
+		previous, previousParser = *state.config, state.parser
+	}
+
+	if overlap > 0 {
+		state.previous, state.previousParser, state.until = &previous, previousParser, service.Now().Add(overlap)
+	} else {
+		state.previous, state.previousParser = nil, nil
+	}
+
+	next := service
+	next.config = config
+	state.config, state.parser = &config, next.newParser()
+	return nil
+}
+
+// Overlapping reports whether tokens of the previous configuration are still accepted
+func (service JWTService) Overlapping() bool {
+	_, ok := service.previous()
+	return ok
+}
+
+// current returns the copy of the service with the current configuration
+func (service JWTService) current() JWTService {
+	if service.reload == nil {
+		return service
+	}
+
+	service.reload.RLock()
+	defer service.reload.RUnlock()
+	if service.reload.config != nil {
+		service.config, service.parser = *service.reload.config, service.reload.parser
+	}
+
+	return service
+}
+
+// previous returns the copy of the service with the previous configuration within the overlap window
+func (service JWTService) previous() (JWTService, bool) {
+	if service.reload == nil {
+		return service, false
+	}
+
+	service.reload.RLock()
+	defer service.reload.RUnlock()
+	if service.reload.previous == nil || !service.Now().Before(service.reload.until) {
+		return service, false
+	}
+
+	service.config, service.parser = *service.reload.previous, service.reload.previousParser
+	return service, true
+}
+
+// parseOverlapping parses a token with the current configuration, then with the previous one within the overlap window.
+// The service must have the current configuration
+func (service JWTService) parseOverlapping(parser *jwt.Parser, tokenString string) (token JWT, err error) {
+	token, err = service.parse(parser, tokenString)
+	if err == nil {
+		return
+	}
+
+	previous, ok := service.previous()
+	if !ok {
+		return
+	}
+
+	previousParser := previous.parser
+	if previousParser == nil {
+		previousParser = previous.newParser()
+	}
+
+	if previousToken, previousErr := previous.parse(previousParser, tokenString); previousErr == nil {
+		return previousToken, nil
+	}
+	return
+}
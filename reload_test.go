@@ -0,0 +1,112 @@
+package gate
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	service, _ := newTestJWTService(t)
+	now := time.Now()
+	service.Now = func() time.Time {
+		return now
+	}
+
+	copied := service
+	old, err := service.Issue(service.NewClaims(testUser{ID: "1"}))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	config, err := NewHMACJWTConfig("HS256", "rotated", time.Minute, false)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	if err = service.Reload(config, time.Hour); err != nil {
+		t.Fatalf("err should be nil because the service is reloadable: %s", err)
+	}
+
+	t.Run("copies", func(t *testing.T) {
+		claims := copied.NewClaims(testUser{ID: "1"})
+		if claims.ExpiresAt-claims.IssuedAt != 60 {
+			t.Fatalf("copies should use the new expiration: %d", claims.ExpiresAt-claims.IssuedAt)
+		}
+
+		token, err := copied.Issue(claims)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		verifier, _ := NewHMACJWTConfig("HS256", "rotated", time.Minute, false)
+		if _, err = NewJWTService(verifier).Parse(token.Value); err != nil {
+			t.Fatalf("tokens should be signed with the new key: %s", err)
+		}
+	})
+
+	t.Run("overlap", func(t *testing.T) {
+		if !copied.Overlapping() {
+			t.Fatal("service should be overlapping")
+		}
+
+		if _, err := copied.Parse(old.Value); err != nil {
+			t.Fatalf("tokens of the previous key should be accepted within the overlap: %s", err)
+		}
+
+		later := copied
+		later.Now = func() time.Time {
+			return now.Add(time.Hour)
+		}
+
+		if _, err := later.Parse(old.Value); err == nil {
+			t.Fatal("err should not be nil because the overlap is over")
+		}
+	})
+
+	t.Run("pool", func(t *testing.T) {
+		pool := NewVerificationPool(copied, 2)
+		defer pool.Close()
+
+		if _, err := pool.Parse(old.Value); err != nil {
+			t.Fatalf("pool should accept the previous key within the overlap: %s", err)
+		}
+
+		if err := service.Reload(config, 0); err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err := pool.Parse(old.Value); err == nil {
+			t.Fatal("err should not be nil because the overlap is disabled")
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				service.Reload(config, time.Minute)
+			}()
+
+			go func() {
+				defer wg.Done()
+				token, err := copied.Issue(copied.NewClaims(testUser{ID: "1"}))
+				if err == nil {
+					_, err = copied.Parse(token.Value)
+				}
+
+				if err != nil {
+					t.Errorf("err should be nil: %s", err)
+				}
+			}()
+		}
+
+		wg.Wait()
+	})
+
+	if err = (JWTService{}).Reload(config, 0); err == nil {
+		t.Fatal("err should not be nil because the service is not constructed by NewJWTService")
+	}
+}
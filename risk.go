@@ -0,0 +1,129 @@
+package gate
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StepUpTag is the tag of sensitive abilities which only grant when the risk evaluator does not demand a step-up, e.g. "DELETE /accounts/*"
+const StepUpTag = "step-up"
+
+// ErrStepUpRequired is thrown when an action is only granted by sensitive abilities and the request is risky,
+// hence the user has to authenticate again or pass MFA before retrying
+var ErrStepUpRequired = errors.New("step-up authentication is required")
+
+// Tagged is the optional contract for abilities carrying tags, e.g. StepUpTag
+type Tagged interface {
+	GetTags() []string
+}
+
+// HasTag reports whether an ability carries a tag
+func HasTag(ability UserAbility, tag string) bool {
+	tagged, ok := ability.(Tagged)
+	if !ok {
+		return false
+	}
+
+	for _, t := range tagged.GetTags() {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequiresStepUp reports whether an ability is sensitive, i.e. tagged with StepUpTag
+func RequiresStepUp(ability UserAbility) bool {
+	return HasTag(ability, StepUpTag)
+}
+
+// RiskContext is the context of an authorization granted by sensitive abilities
+type RiskContext struct {
+	User   User
+	Action string
+	Object string
+	// Token is the token of the request, which is empty without an authorization context
+	Token JWT
+	// IP is the client IP of the request, which is empty without an authorization context
+	IP  string
+	Now time.Time
+}
+
+// TokenAge returns the time elapsed since the token was issued. It is negative when the issuance time is unknown
+func (ctx RiskContext) TokenAge() time.Duration {
+	if ctx.Token.IssuedAt.IsZero() {
+		return -1
+	}
+
+	return ctx.Now.Sub(ctx.Token.IssuedAt)
+}
+
+// RiskEvaluator is the contract for evaluating the risk of authorizations granted by sensitive abilities.
+// It reports whether the user has to step up, e.g. re-authenticate or pass MFA, before being granted
+type RiskEvaluator interface {
+	RequiresStepUp(RiskContext) bool
+}
+
+// RiskEvaluatorFunc is the adapter to use ordinary functions as risk evaluators
+type RiskEvaluatorFunc func(RiskContext) bool
+
+// RequiresStepUp calls f(ctx)
+func (f RiskEvaluatorFunc) RequiresStepUp(ctx RiskContext) bool {
+	return f(ctx)
+}
+
+// MaxTokenAge demands a step-up when the token was issued longer than the given age ago or its issuance time is unknown.
+// Authorizations without a token, i.e. without an authorization context, e.g. of background jobs, are not judged by the token age
+func MaxTokenAge(age time.Duration) RiskEvaluator {
+	return RiskEvaluatorFunc(func(ctx RiskContext) bool {
+		if ctx.Token.Value == "" && ctx.Token.IssuedAt.IsZero() {
+			return false
+		}
+
+		elapsed := ctx.TokenAge()
+		return elapsed < 0 || elapsed > age
+	})
+}
+
+// KnownIPs demands a step-up when the client IP is unknown or is not one of the known IPs of the user, e.g. the IPs of the previous logins
+func KnownIPs(known func(User) []string) RiskEvaluator {
+	return RiskEvaluatorFunc(func(ctx RiskContext) bool {
+		if ctx.IP == "" {
+			return true
+		}
+
+		for _, ip := range known(ctx.User) {
+			if ip == ctx.IP {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// AnyRisk demands a step-up when any of the evaluators does
+func AnyRisk(evaluators ...RiskEvaluator) RiskEvaluator {
+	return RiskEvaluatorFunc(func(ctx RiskContext) bool {
+		for _, evaluator := range evaluators {
+			if evaluator.RequiresStepUp(ctx) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// RiskEvaluator is the getter for the risk evaluator
+func (dependencies Dependencies) RiskEvaluator() RiskEvaluator {
+	return dependencies.riskEvaluator
+}
+
+// SetRiskEvaluator is the setter for the risk evaluator consulted by the authorization granted by sensitive abilities.
+// Without a risk evaluator, sensitive abilities grant like the others
+func (dependencies *Dependencies) SetRiskEvaluator(evaluator RiskEvaluator) {
+	dependencies.riskEvaluator = evaluator
+}
@@ -0,0 +1,88 @@
+package gate
+
+import (
+	"testing"
+	"time"
+)
+
+type testSensitiveAbility struct {
+	testAbility
+}
+
+func (a testSensitiveAbility) GetTags() []string {
+	return []string{"audited", StepUpTag}
+}
+
+func TestRisk(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	sensitive := testSensitiveAbility{testAbility{"DELETE", "/accounts/*"}}
+
+	t.Run("tags", func(t *testing.T) {
+		if !RequiresStepUp(sensitive) || !HasTag(sensitive, "audited") {
+			t.Fatal("tags should be found")
+		}
+
+		if RequiresStepUp(testAbility{"DELETE", "/accounts/*"}) {
+			t.Fatal("abilities without tags should not require a step-up")
+		}
+
+		if !IsConditional(sensitive) {
+			t.Fatal("sensitive abilities should be conditional")
+		}
+	})
+
+	t.Run("token age", func(t *testing.T) {
+		evaluator := MaxTokenAge(time.Minute)
+		ctx := RiskContext{Now: now, Token: JWT{IssuedAt: now.Add(-time.Second)}}
+		if evaluator.RequiresStepUp(ctx) {
+			t.Fatal("recent tokens should not require a step-up")
+		}
+
+		ctx.Token.IssuedAt = now.Add(-time.Hour)
+		if !evaluator.RequiresStepUp(ctx) {
+			t.Fatal("old tokens should require a step-up")
+		}
+
+		if !evaluator.RequiresStepUp(RiskContext{Now: now, Token: JWT{Value: "token"}}) {
+			t.Fatal("tokens of unknown issuance time should require a step-up")
+		}
+
+		if evaluator.RequiresStepUp(RiskContext{Now: now}) {
+			t.Fatal("authorizations without a token should not be judged by the token age")
+		}
+	})
+
+	t.Run("known IPs", func(t *testing.T) {
+		evaluator := KnownIPs(func(user User) []string {
+			return []string{"10.0.0.1"}
+		})
+
+		if evaluator.RequiresStepUp(RiskContext{User: testUser{ID: "id"}, IP: "10.0.0.1"}) {
+			t.Fatal("known IPs should not require a step-up")
+		}
+
+		if !evaluator.RequiresStepUp(RiskContext{User: testUser{ID: "id"}, IP: "192.0.2.1"}) {
+			t.Fatal("IP changes should require a step-up")
+		}
+
+		if !evaluator.RequiresStepUp(RiskContext{User: testUser{ID: "id"}}) {
+			t.Fatal("unknown IPs should require a step-up")
+		}
+	})
+
+	t.Run("any", func(t *testing.T) {
+		evaluator := AnyRisk(MaxTokenAge(time.Minute), KnownIPs(func(user User) []string {
+			return []string{"10.0.0.1"}
+		}))
+
+		ctx := RiskContext{User: testUser{ID: "id"}, IP: "10.0.0.1", Now: now, Token: JWT{IssuedAt: now}}
+		if evaluator.RequiresStepUp(ctx) {
+			t.Fatal("the request should not be risky")
+		}
+
+		ctx.IP = "192.0.2.1"
+		if !evaluator.RequiresStepUp(ctx) {
+			t.Fatal("the request should be risky because of one evaluator")
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package gate
+
+import (
+	"time"
+)
+
+// Schedule is a recurring time-of-day and day-of-week constraint, e.g. business hours
+type Schedule struct {
+	// Days are the days of the week the schedule applies to. Every day by default
+	Days []time.Weekday
+	// From and To are the offsets since midnight delimiting the allowed period of a day.
+	// Equal offsets allow the whole day and a From later than To wraps around midnight
+	From time.Duration
+	To   time.Duration
+	// Location is the timezone of the schedule. The configured schedule location is used by default
+	Location *time.Location
+}
+
+// Scheduled is the optional contract for abilities restricted by a schedule
+type Scheduled interface {
+	GetSchedule() Schedule
+}
+
+func (schedule Schedule) location(fallback *time.Location) *time.Location {
+	if schedule.Location != nil {
+		return schedule.Location
+	}
+
+	if fallback != nil {
+		return fallback
+	}
+
+	return time.UTC
+}
+
+// Allows reports whether the schedule allows the given time. The fallback location applies to schedules without a location
+func (schedule Schedule) Allows(t time.Time, fallback *time.Location) bool {
+	t = t.In(schedule.location(fallback))
+	if len(schedule.Days) > 0 {
+		var found bool
+		for _, day := range schedule.Days {
+			found = found || day == t.Weekday()
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if schedule.From == schedule.To {
+		return true
+	}
+
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	if schedule.From < schedule.To {
+		return offset >= schedule.From && offset < schedule.To
+	}
+
+	return offset >= schedule.From || offset < schedule.To
+}
+
+// NextTransition returns a time after the given time no later than the next change of the schedule decision
+func (schedule Schedule) NextTransition(t time.Time, fallback *time.Location) (next time.Time) {
+	t = t.In(schedule.location(fallback))
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	tomorrow := midnight.AddDate(0, 0, 1)
+
+	for _, candidate := range []time.Time{
+		midnight.Add(schedule.From),
+		midnight.Add(schedule.To),
+		tomorrow,
+		tomorrow.Add(schedule.From),
+		tomorrow.Add(schedule.To),
+	} {
+		if candidate.After(t) && (next.IsZero() || candidate.Before(next)) {
+			next = candidate
+		}
+	}
+
+	return
+}
+
+// IsAvailable reports whether an entity is within its validity window and its schedule at the given time
+func IsAvailable(entity interface{}, now time.Time, location *time.Location) bool {
+	if !IsActive(entity, now) {
+		return false
+	}
+
+	scheduled, ok := entity.(Scheduled)
+	return !ok || scheduled.GetSchedule().Allows(now, location)
+}
+
+// NextAvailabilityChange returns a time after the given time no later than the next change of IsAvailable,
+// or the zero time if it never changes
+func NextAvailabilityChange(entity interface{}, now time.Time, location *time.Location) time.Time {
+	next := NextTransition(entity, now)
+	scheduled, ok := entity.(Scheduled)
+	if !ok {
+		return next
+	}
+
+	at := scheduled.GetSchedule().NextTransition(now, location)
+	if next.IsZero() || at.Before(next) {
+		return at
+	}
+
+	return next
+}
@@ -0,0 +1,98 @@
+package gate
+
+import (
+	"testing"
+	"time"
+)
+
+type testScheduledAbility struct {
+	testAbility
+	schedule Schedule
+}
+
+func (a testScheduledAbility) GetSchedule() Schedule {
+	return a.schedule
+}
+
+func TestSchedule(t *testing.T) {
+	businessHours := Schedule{
+		Days: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		From: 9 * time.Hour,
+		To:   17 * time.Hour,
+	}
+
+	// 2020-11-10 is a Tuesday
+	tuesday := func(hour, minute int) time.Time {
+		return time.Date(2020, time.November, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	t.Run("allows", func(t *testing.T) {
+		cases := []struct {
+			at      time.Time
+			allowed bool
+		}{
+			{tuesday(9, 0), true},
+			{tuesday(16, 59), true},
+			{tuesday(17, 0), false},
+			{tuesday(8, 59), false},
+			{tuesday(12, 0).AddDate(0, 0, 4), false},
+		}
+
+		for i, c := range cases {
+			if businessHours.Allows(c.at, nil) != c.allowed {
+				t.Errorf("case %d should be allowed: %v", i, c.allowed)
+			}
+		}
+	})
+
+	t.Run("wrap around midnight", func(t *testing.T) {
+		night := Schedule{From: 22 * time.Hour, To: 6 * time.Hour}
+		if !night.Allows(tuesday(23, 0), nil) || !night.Allows(tuesday(5, 0), nil) || night.Allows(tuesday(12, 0), nil) {
+			t.Fatal("overnight schedules should wrap around midnight")
+		}
+
+		if !(Schedule{}).Allows(tuesday(12, 0), nil) {
+			t.Fatal("empty schedules should allow the whole day")
+		}
+	})
+
+	t.Run("location", func(t *testing.T) {
+		tokyo := time.FixedZone("JST", 9*60*60)
+
+		// 03:00 UTC is 12:00 in Tokyo
+		if businessHours.Allows(tuesday(3, 0), nil) || !businessHours.Allows(tuesday(3, 0), tokyo) {
+			t.Fatal("schedules should be evaluated in the fallback location")
+		}
+
+		local := businessHours
+		local.Location = tokyo
+		if !local.Allows(tuesday(3, 0), time.UTC) {
+			t.Fatal("schedules should be evaluated in their own location first")
+		}
+	})
+
+	t.Run("next transition", func(t *testing.T) {
+		if next := businessHours.NextTransition(tuesday(12, 0), nil); !next.Equal(tuesday(17, 0)) {
+			t.Fatalf("the next transition should be the end of the period: %s", next)
+		}
+
+		if next := businessHours.NextTransition(tuesday(18, 0), nil); !next.Equal(tuesday(0, 0).AddDate(0, 0, 1)) {
+			t.Fatalf("the next transition should be the next day: %s", next)
+		}
+	})
+
+	t.Run("availability", func(t *testing.T) {
+		ability := testScheduledAbility{testAbility{"POST", "deployments"}, businessHours}
+		if !IsAvailable(ability, tuesday(12, 0), nil) || IsAvailable(ability, tuesday(20, 0), nil) {
+			t.Fatal("scheduled abilities should be available within their schedule only")
+		}
+
+		if !IsAvailable(testAbility{"GET", "*"}, tuesday(20, 0), nil) {
+			t.Fatal("abilities without a schedule should always be available")
+		}
+
+		if next := NextAvailabilityChange(ability, tuesday(12, 0), nil); !next.Equal(tuesday(17, 0)) {
+			t.Fatalf("the next change should be the end of the period: %s", next)
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package gate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TokenSerializer serializes verified tokens for cross-service transport, e.g. a gateway passing the token metadata to upstream services.
+// Serialized tokens are not signed, so upstream services only trust them over authenticated channels, e.g. mutual TLS,
+// and parse the token string again otherwise
+type TokenSerializer interface {
+	Serialize(JWT) ([]byte, error)
+	Deserialize([]byte) (JWT, error)
+}
+
+// JSONTokenSerializer is the TokenSerializer of JSON documents of TransportToken, i.e. with the claim names, e.g. "sub" and "exp"
+type JSONTokenSerializer struct{}
+
+// Serialize encodes a token into JSON
+func (JSONTokenSerializer) Serialize(token JWT) ([]byte, error) {
+	return json.Marshal(NewTransportToken(token))
+}
+
+// Deserialize decodes a token from JSON
+func (JSONTokenSerializer) Deserialize(data []byte) (token JWT, err error) {
+	var transport TransportToken
+	err = json.Unmarshal(data, &transport)
+	if err != nil {
+		return
+	}
+
+	token = transport.JWT()
+	return
+}
+
+// MsgpackTokenSerializer is the compact TokenSerializer of MessagePack maps with the same keys as JSONTokenSerializer
+type MsgpackTokenSerializer struct{}
+
+// Serialize encodes a token into MessagePack
+func (MsgpackTokenSerializer) Serialize(token JWT) ([]byte, error) {
+	data, err := JSONTokenSerializer{}.Serialize(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return msgpackFromJSON(data)
+}
+
+// Deserialize decodes a token from MessagePack
+func (MsgpackTokenSerializer) Deserialize(data []byte) (token JWT, err error) {
+	document, err := msgpackToJSON(data)
+	if err != nil {
+		return
+	}
+
+	return JSONTokenSerializer{}.Deserialize(document)
+}
+
+// EncodeToken serializes a token into an unpadded base64url string which fits in HTTP headers
+func EncodeToken(serializer TokenSerializer, token JWT) (string, error) {
+	data, err := serializer.Serialize(token)
+	if err != nil {
+		return "", errors.Wrap(err, "could not serialize the token")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeToken deserializes a token from an unpadded base64url string
+func DecodeToken(serializer TokenSerializer, value string) (token JWT, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		err = errors.Wrap(err, "malformed serialized token")
+		return
+	}
+
+	token, err = serializer.Deserialize(data)
+	if err != nil {
+		err = errors.Wrap(err, "could not deserialize the token")
+	}
+	return
+}
+
+// TransportToken is the transport form of JWT with the claim names. Times are in Unix seconds like the claims.
+// The token string is included unless it is cleared
+type TransportToken struct {
+	ID         string           `json:"jti,omitempty"`
+	Value      string           `json:"token,omitempty"`
+	UserID     string           `json:"sub,omitempty"`
+	User       UserInfo         `json:"user"`
+	ExpiredAt  int64            `json:"exp,omitempty"`
+	IssuedAt   int64            `json:"iat,omitempty"`
+	SingleUse  bool             `json:"single_use,omitempty"`
+	Actor      *Actor           `json:"act,omitempty"`
+	Abilities  []AbilityClaim   `json:"abilities,omitempty"`
+	ScopeChain [][]AbilityClaim `json:"scope_chain,omitempty"`
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+func fromUnix(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(seconds, 0)
+}
+
+// NewTransportToken is the constructor for TransportToken of a token
+func NewTransportToken(token JWT) TransportToken {
+	return TransportToken{
+		token.ID,
+		token.Value,
+		token.UserID,
+		token.User,
+		unix(token.ExpiredAt),
+		unix(token.IssuedAt),
+		token.SingleUse,
+		token.Actor,
+		token.Abilities,
+		token.ScopeChain,
+	}
+}
+
+// JWT returns the token of the transport form
+func (transport TransportToken) JWT() JWT {
+	return JWT{
+		transport.ID,
+		transport.Value,
+		transport.UserID,
+		transport.User,
+		fromUnix(transport.ExpiredAt),
+		fromUnix(transport.IssuedAt),
+		transport.SingleUse,
+		transport.Actor,
+		transport.Abilities,
+		transport.ScopeChain,
+	}
+}
+
+// MarshalBinary encodes the claims into MessagePack with the same keys as their JSON encoding
+func (claims JWTClaims) MarshalBinary() ([]byte, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return msgpackFromJSON(data)
+}
+
+// UnmarshalBinary decodes the claims from MessagePack
+func (claims *JWTClaims) UnmarshalBinary(data []byte) error {
+	document, err := msgpackToJSON(data)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(document, claims)
+}
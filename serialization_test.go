@@ -0,0 +1,120 @@
+package gate
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenSerialization(t *testing.T) {
+	token := JWT{
+		ID:        "id",
+		Value:     "header.payload.signature",
+		UserID:    "1",
+		User:      UserInfo{ID: "1", Username: "foo", Roles: []string{"admin"}, Email: "foo@example.com"},
+		ExpiredAt: time.Unix(1605049200, 0),
+		IssuedAt:  time.Unix(1605045600, 0),
+		SingleUse: true,
+		Actor:     &Actor{Subject: "gateway", Actor: &Actor{Subject: "admin"}},
+		Abilities: []AbilityClaim{{"read", "/posts/" + strings.Repeat("x", 300)}},
+	}
+
+	for name, serializer := range map[string]TokenSerializer{"json": JSONTokenSerializer{}, "msgpack": MsgpackTokenSerializer{}} {
+		t.Run(name, func(t *testing.T) {
+			value, err := EncodeToken(serializer, token)
+			if err != nil {
+				t.Fatalf("err should be nil: %s", err)
+			}
+
+			decoded, err := DecodeToken(serializer, value)
+			if err != nil {
+				t.Fatalf("err should be nil because of the valid value: %s", err)
+			}
+
+			if !reflect.DeepEqual(decoded, token) {
+				t.Fatalf("token should survive the transport: %+v", decoded)
+			}
+
+			if _, err = DecodeToken(serializer, value[:len(value)/2]); err == nil {
+				t.Fatal("err should not be nil because of the truncated value")
+			}
+		})
+	}
+
+	t.Run("compact", func(t *testing.T) {
+		document, err := JSONTokenSerializer{}.Serialize(token)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if !bytes.Contains(document, []byte(`"sub":"1"`)) || !bytes.Contains(document, []byte(`"exp":1605049200`)) {
+			t.Fatalf("JSON should use the claim names: %s", document)
+		}
+
+		packed, err := MsgpackTokenSerializer{}.Serialize(token)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if len(packed) >= len(document) {
+			t.Fatalf("msgpack should be more compact than JSON: %d %d", len(packed), len(document))
+		}
+	})
+
+	t.Run("zero", func(t *testing.T) {
+		data, err := MsgpackTokenSerializer{}.Serialize(JWT{})
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		decoded, err := MsgpackTokenSerializer{}.Deserialize(data)
+		if err != nil || !decoded.ExpiredAt.IsZero() {
+			t.Fatalf("zero times should be kept: %v %s", err, decoded.ExpiredAt)
+		}
+	})
+
+	t.Run("encoding", func(t *testing.T) {
+		document, err := json.Marshal(token)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if !bytes.Contains(document, []byte(`"UserID":"1"`)) {
+			t.Fatalf("the JSON encoding of the token should be left as is: %s", document)
+		}
+	})
+}
+
+func TestClaimsSerialization(t *testing.T) {
+	claims := JWTClaims{
+		Version:   ClaimsVersion,
+		User:      UserInfo{ID: "1", Username: "foo"},
+		Abilities: []AbilityClaim{{"read", "*"}},
+	}
+	claims.ExpiresAt = -1 << 40
+	claims.IssuedAt = 1 << 40
+	claims.Audience = "api"
+
+	data, err := claims.MarshalBinary()
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	var decoded JWTClaims
+	if err = decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("err should be nil because of the valid data: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, claims) {
+		t.Fatalf("claims should survive the transport: %+v", decoded)
+	}
+
+	for _, invalid := range [][]byte{{}, {0xc1}, {0x81, 0x01, 0x01}, {0xdd, 0xff, 0xff, 0xff, 0xff}, append(data, 0xc0)} {
+		if err = decoded.UnmarshalBinary(invalid); err == nil {
+			t.Fatalf("err should not be nil because of the invalid data: %x", invalid)
+		}
+	}
+}
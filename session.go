@@ -0,0 +1,73 @@
+package gate
+
+import (
+	"sort"
+	"time"
+)
+
+// SessionLimitPolicy is the policy applied on issuance when a user has reached the maximum number of active sessions
+type SessionLimitPolicy int
+
+// Session limit policies
+const (
+	// SessionRejectNew fails the issuance with ErrSessionLimitExceeded
+	SessionRejectNew SessionLimitPolicy = iota
+	// SessionEvictOldest revokes the oldest sessions to make room for the new one
+	SessionEvictOldest
+)
+
+// SessionStore is the optional contract for token services enforcing session limits, i.e. limiting the tokens of the primary logins
+// of users, as opposed to single-use, scoped and exchanged tokens. StoreSession stores the token of a session unless its user has reached
+// the maximum number of active sessions, revoking the evicted ones, atomically, e.g. within a transaction or a lock, so concurrent logins
+// never exceed the limit. ListSessions returns the stored sessions of a user, e.g. including the expired ones. See EvictSessions
+type SessionStore interface {
+	StoreSession(token JWT, max int, policy SessionLimitPolicy) (evicted []JWT, err error)
+	ListSessions(userID string) ([]JWT, error)
+}
+
+// byIssuedAt sorts tokens from the oldest to the newest. Tokens issued within the same second keep their order
+type byIssuedAt []JWT
+
+func (tokens byIssuedAt) Len() int {
+	return len(tokens)
+}
+
+func (tokens byIssuedAt) Less(i, j int) bool {
+	return tokens[i].IssuedAt.Before(tokens[j].IssuedAt)
+}
+
+func (tokens byIssuedAt) Swap(i, j int) {
+	tokens[i], tokens[j] = tokens[j], tokens[i]
+}
+
+// ActiveSessions returns the sessions which are not expired at the given time, from the oldest to the newest
+func ActiveSessions(sessions []JWT, now time.Time) (active []JWT) {
+	for _, session := range sessions {
+		if !session.ExpiredAt.IsZero() && !session.ExpiredAt.After(now) {
+			continue
+		}
+
+		active = append(active, session)
+	}
+
+	sort.Stable(byIssuedAt(active))
+	return
+}
+
+// EvictSessions returns the oldest active sessions of a user to revoke so a new session fits in the limit, e.g. for SessionStore implementations.
+// It fails with ErrSessionLimitExceeded when the limit is reached and the policy is SessionRejectNew
+func EvictSessions(sessions []JWT, now time.Time, max int, policy SessionLimitPolicy) (evicted []JWT, err error) {
+	active := ActiveSessions(sessions, now)
+	excess := len(active) - max + 1
+	if max <= 0 || excess <= 0 {
+		return
+	}
+
+	if policy != SessionEvictOldest {
+		err = ErrSessionLimitExceeded
+		return
+	}
+
+	evicted = active[:excess]
+	return
+}
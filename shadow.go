@@ -0,0 +1,130 @@
+package gate
+
+// DefaultShadowConcurrency is the default maximum of concurrent shadow evaluations
+const DefaultShadowConcurrency = 64
+
+// AuditShadowDivergence is the type of audit events reporting a shadow decision diverging from the active one
+const AuditShadowDivergence = "shadow_divergence"
+
+// AuditEvent is an authorization event reported to audit hooks
+type AuditEvent struct {
+	Type   string
+	UserID string
+	Action string
+	Object string
+	// Decision is the decision of the active policy, nil when the action is allowed
+	Decision error
+	// ShadowDecision is the decision of the shadow policy, nil when the action is allowed
+	ShadowDecision error
+}
+
+// Allowed reports whether the active policy allows the action
+func (event AuditEvent) Allowed() bool {
+	return event.Decision == nil
+}
+
+// ShadowAllowed reports whether the shadow policy allows the action
+func (event AuditEvent) ShadowAllowed() bool {
+	return event.ShadowDecision == nil
+}
+
+// AuditHook is invoked with audit events, e.g. to record divergences of a shadow policy
+type AuditHook func(AuditEvent)
+
+// Diverges reports whether two decisions disagree on allowing an action
+func Diverges(decision, shadowDecision error) bool {
+	return (decision == nil) != (shadowDecision == nil)
+}
+
+// RoleAuthorizer is the Authorizer evaluating the abilities of the user roles found by a role service, e.g. a new policy document shadowing the active roles
+type RoleAuthorizer struct {
+	roles   RoleService
+	matcher Matcher
+}
+
+// Authorize authorizes the user to take the action on the object with the abilities of the roles
+func (authorizer RoleAuthorizer) Authorize(user User, action, object string) error {
+	roles, err := authorizer.roles.FindByIDs(user.GetRoles())
+	if err != nil {
+		return err
+	}
+
+	var abilities []UserAbility
+	for _, role := range roles {
+		abilities = append(abilities, role.GetAbilities()...)
+	}
+
+	if len(abilities) == 0 {
+		return ErrNoAbilities
+	}
+
+	if !NewAbilityIndex(abilities, authorizer.matcher).Allows(action, object) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// NewRoleAuthorizer is the constructor for RoleAuthorizer
+func NewRoleAuthorizer(roles RoleService, matcher Matcher) RoleAuthorizer {
+	return RoleAuthorizer{roles, matcher}
+}
+
+// ShadowAuthorizer is the getter for the shadow authorizer
+func (dependencies Dependencies) ShadowAuthorizer() Authorizer {
+	return dependencies.shadow
+}
+
+// SetShadowAuthorizer is the setter for the shadow authorizer. Every authorization is evaluated by the shadow authorizer as well
+// without affecting the decision, and divergences are reported to the audit hooks, so a policy change is validated before it is enforced.
+// At most DefaultShadowConcurrency evaluations run at once unless SetShadowConcurrency says otherwise.
+// There is no shadow authorizer by default
+func (dependencies *Dependencies) SetShadowAuthorizer(authorizer Authorizer) {
+	dependencies.shadow = authorizer
+	if dependencies.shadowSlots == nil {
+		dependencies.shadowSlots = make(chan struct{}, DefaultShadowConcurrency)
+	}
+}
+
+// SetShadowConcurrency is the setter for the maximum of concurrent shadow evaluations, DefaultShadowConcurrency by default
+func (dependencies *Dependencies) SetShadowConcurrency(max int) {
+	if max < 1 {
+		max = 1
+	}
+	dependencies.shadowSlots = make(chan struct{}, max)
+}
+
+// EvaluateShadow runs a shadow evaluation in the background unless the maximum of concurrent evaluations is reached,
+// in which case the evaluation is dropped and false is returned. Shadow evaluations never block nor crash the authorizations,
+// i.e. a panic of the evaluation is recovered
+func (dependencies Dependencies) EvaluateShadow(evaluate func()) bool {
+	slots := dependencies.shadowSlots
+	if slots == nil {
+		return false
+	}
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		return false
+	}
+
+	go func() {
+		defer func() {
+			recover()
+			<-slots
+		}()
+		evaluate()
+	}()
+	return true
+}
+
+// AuditHooks is the getter for audit hooks
+func (dependencies Dependencies) AuditHooks() []AuditHook {
+	return dependencies.auditHooks
+}
+
+// AddAuditHook registers a hook invoked with audit events
+func (dependencies *Dependencies) AddAuditHook(hook AuditHook) {
+	dependencies.auditHooks = append(dependencies.auditHooks, hook)
+}
@@ -0,0 +1,86 @@
+package gate
+
+import (
+	"testing"
+	"time"
+)
+
+type testRole struct {
+	abilities []UserAbility
+}
+
+func (role testRole) GetAbilities() []UserAbility {
+	return role.abilities
+}
+
+type testRoleService map[string]testRole
+
+func (service testRoleService) FindByIDs(ids []string) (roles []Role, err error) {
+	for _, id := range ids {
+		if role, ok := service[id]; ok {
+			roles = append(roles, role)
+		}
+	}
+	return
+}
+
+func TestRoleAuthorizer(t *testing.T) {
+	authorizer := NewRoleAuthorizer(testRoleService{"editor": {[]UserAbility{testAbility{"GET", "/posts*"}}}}, NewMatcher())
+
+	if err := authorizer.Authorize(testUser{ID: "id", Roles: []string{"editor"}}, "GET", "/posts/1"); err != nil {
+		t.Fatalf("err should be nil because of the abilities of the role: %s", err)
+	}
+
+	if err := authorizer.Authorize(testUser{ID: "id", Roles: []string{"editor"}}, "DELETE", "/posts/1"); err != ErrForbidden {
+		t.Fatalf("err should be ErrForbidden: %v", err)
+	}
+
+	if err := authorizer.Authorize(testUser{ID: "id", Roles: []string{"missing"}}, "GET", "/posts/1"); err != ErrNoAbilities {
+		t.Fatalf("err should be ErrNoAbilities: %v", err)
+	}
+}
+
+func TestDiverges(t *testing.T) {
+	if Diverges(nil, nil) || Diverges(ErrForbidden, ErrNoAbilities) {
+		t.Fatal("decisions agreeing on the allowance should not diverge")
+	}
+
+	if !Diverges(nil, ErrForbidden) || !Diverges(ErrForbidden, nil) {
+		t.Fatal("decisions disagreeing on the allowance should diverge")
+	}
+}
+
+func TestEvaluateShadow(t *testing.T) {
+	dependencies := Dependencies{}
+	if dependencies.EvaluateShadow(func() {}) {
+		t.Fatal("evaluations should be dropped because there is no shadow authorizer")
+	}
+
+	dependencies.SetShadowAuthorizer(NewRoleAuthorizer(testRoleService{}, NewMatcher()))
+	dependencies.SetShadowConcurrency(1)
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	if !dependencies.EvaluateShadow(func() {
+		<-release
+		panic("shadow")
+	}) {
+		t.Fatal("the evaluation should run")
+	}
+
+	if dependencies.EvaluateShadow(func() {}) {
+		t.Fatal("the evaluation should be dropped because of the concurrency limit")
+	}
+
+	close(release)
+	for i := 0; ; i++ {
+		if dependencies.EvaluateShadow(func() { close(done) }) {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the slot should be released after the panic")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-done
+}
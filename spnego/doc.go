@@ -0,0 +1,3 @@
+// Package spnego is the Kerberos/SPNEGO authentication driver for github.com/hiendv/gate handling "Negotiate" authorization headers,
+// e.g. for transparent single sign-on in intranet Windows environments
+package spnego
@@ -0,0 +1,160 @@
+package spnego
+
+import (
+	"encoding/asn1"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxClockSkew is the maximum clock skew between the clients and the service, as recommended by RFC 4120
+const DefaultMaxClockSkew = 5 * time.Minute
+
+// ErrReplay is thrown when the authenticator of a Kerberos token is presented again
+var ErrReplay = errors.New("replayed Kerberos authenticator")
+
+// krb5TokenID is the token ID of the KRB_AP_REQ inner tokens of RFC 1964
+var krb5TokenID = []byte{0x01, 0x00}
+
+// replayCache remembers the authenticators presented within the clock skew, see RFC 4120 section 3.2.3
+type replayCache struct {
+	entries map[string]time.Time
+	*sync.Mutex
+}
+
+// seen records an authenticator until it expires and reports whether it was recorded already. Expired authenticators are swept on access
+func (cache replayCache) seen(key string, expiredAt, now time.Time) bool {
+	cache.Lock()
+	defer cache.Unlock()
+
+	for k, at := range cache.entries {
+		if !now.Before(at) {
+			delete(cache.entries, k)
+		}
+	}
+
+	if _, ok := cache.entries[key]; ok {
+		return true
+	}
+
+	cache.entries[key] = expiredAt
+	return false
+}
+
+// KeytabAcceptor is the Acceptor of the Kerberos tokens of a service keytab. It decrypts the service ticket with the keys of the keytab,
+// verifies the authenticator against the session key, the validity of the ticket and the clock skew, and refuses replayed authenticators.
+// Tickets bound to client addresses are refused since the addresses of the clients are not known by the acceptor
+type KeytabAcceptor struct {
+	keytab    *keytab.Keytab
+	principal *types.PrincipalName
+	maxSkew   time.Duration
+	replays   replayCache
+	Now       func() time.Time
+}
+
+// SetServicePrincipal is the setter for the service principal whose keys decrypt the tickets, e.g. "HTTP/intranet.example.com".
+// The principal of the tickets is used by default
+func (acceptor *KeytabAcceptor) SetServicePrincipal(name string) {
+	principal := types.NewPrincipalName(0, name)
+	acceptor.principal = &principal
+}
+
+// SetMaxClockSkew is the setter for the maximum clock skew between the clients and the service, DefaultMaxClockSkew by default
+func (acceptor *KeytabAcceptor) SetMaxClockSkew(skew time.Duration) {
+	acceptor.maxSkew = skew
+}
+
+// Accept verifies a Kerberos GSS-API token of RFC 1964 and returns its client principal
+func (acceptor KeytabAcceptor) Accept(token []byte) (principal Principal, err error) {
+	request, err := unwrapAPReq(token)
+	if err != nil {
+		return
+	}
+
+	ok, err := request.Verify(acceptor.keytab, acceptor.maxSkew, types.HostAddress{}, acceptor.principal)
+	if err != nil || !ok {
+		err = errors.WithMessage(ErrInvalidToken, errorMessage(err, "invalid AP-REQ"))
+		return
+	}
+
+	authenticator, ticket := request.Authenticator, request.Ticket.DecryptedEncPart
+	if authenticator.CRealm != ticket.CRealm {
+		err = errors.WithMessage(ErrInvalidToken, "the realm of the authenticator does not match the ticket")
+		return
+	}
+
+	principal = Principal{Name: authenticator.CName.PrincipalNameString(), Realm: authenticator.CRealm}
+	ctime := authenticator.CTime.Add(time.Duration(authenticator.Cusec) * time.Microsecond)
+	now := acceptor.Now()
+	key := principal.String() + "\x00" + request.Ticket.SName.PrincipalNameString() + "\x00" + ctime.UTC().Format(time.RFC3339Nano)
+	if acceptor.replays.seen(key, ctime.Add(acceptor.maxSkew), now) {
+		err = ErrReplay
+	}
+	return
+}
+
+func errorMessage(err error, fallback string) string {
+	if err == nil {
+		return fallback
+	}
+
+	return err.Error()
+}
+
+// unwrapAPReq parses the KRB_AP_REQ of a Kerberos GSS-API token
+func unwrapAPReq(token []byte) (request messages.APReq, err error) {
+	var outer asn1.RawValue
+	_, err = asn1.Unmarshal(token, &outer)
+	if err != nil || outer.Class != asn1.ClassApplication || outer.Tag != 0 {
+		err = errors.WithMessage(ErrInvalidToken, "not a GSS-API token")
+		return
+	}
+
+	var mech asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(outer.Bytes, &mech)
+	if err != nil || !isKerberos(mech) {
+		err = errors.WithMessage(ErrInvalidToken, "not a Kerberos token")
+		return
+	}
+
+	if len(rest) < len(krb5TokenID) || rest[0] != krb5TokenID[0] || rest[1] != krb5TokenID[1] {
+		err = errors.WithMessage(ErrInvalidToken, "not a KRB_AP_REQ")
+		return
+	}
+
+	err = request.Unmarshal(rest[len(krb5TokenID):])
+	if err != nil {
+		err = errors.WithMessage(ErrInvalidToken, err.Error())
+	}
+	return
+}
+
+// NewKeytabAcceptor is the constructor for KeytabAcceptor of a parsed keytab
+func NewKeytabAcceptor(kt *keytab.Keytab) (KeytabAcceptor, error) {
+	if kt == nil || len(kt.Entries) == 0 {
+		return KeytabAcceptor{}, errors.New("missing keytab entries")
+	}
+
+	return KeytabAcceptor{
+		keytab:  kt,
+		maxSkew: DefaultMaxClockSkew,
+		replays: replayCache{map[string]time.Time{}, &sync.Mutex{}},
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+	}, nil
+}
+
+// LoadKeytab is the constructor for KeytabAcceptor of a keytab file, e.g. exported by ktpass or kadmin
+func LoadKeytab(path string) (KeytabAcceptor, error) {
+	kt, err := keytab.Load(path)
+	if err != nil {
+		return KeytabAcceptor{}, errors.Wrap(err, "could not load the keytab")
+	}
+
+	return NewKeytabAcceptor(kt)
+}
@@ -0,0 +1,154 @@
+package spnego
+
+import (
+	"encoding/asn1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/pkg/errors"
+)
+
+const servicePrincipal = "HTTP/intranet.example.com"
+
+func serviceKeytab(t *testing.T, password string) *keytab.Keytab {
+	kt := keytab.New()
+	err := kt.AddEntry(servicePrincipal, "CORP.EXAMPLE.COM", password, time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+	return kt
+}
+
+// apReqToken is a GSS-API Kerberos token of an AP-REQ for the service, issued by the KDC of the keytab
+func apReqToken(t *testing.T, kt *keytab.Keytab, client, ticketRealm, authenticatorRealm string, ctime time.Time) []byte {
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, client)
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, servicePrincipal)
+	now := time.Now().UTC()
+	ticket, sessionKey, err := messages.NewTicket(cname, ticketRealm, sname, "CORP.EXAMPLE.COM", types.NewKrbFlags(), kt, etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	authenticator, err := types.NewAuthenticator(authenticatorRealm, cname)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+	authenticator.CTime, authenticator.Cusec = ctime.UTC().Truncate(time.Second), ctime.Nanosecond()/int(time.Microsecond)
+
+	request, err := messages.NewAPReq(ticket, sessionKey, authenticator)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	data, err := request.Marshal()
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	body := append(marshal(t, kerberosOID), krb5TokenID...)
+	return marshal(t, asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: append(body, data...)})
+}
+
+func TestKeytabAcceptor(t *testing.T) {
+	kt := serviceKeytab(t, "service-secret")
+	acceptor, err := NewKeytabAcceptor(kt)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewKeytabAcceptor(keytab.New())
+		if err == nil {
+			t.Fatal("err should not be nil because of the empty keytab")
+		}
+
+		_, err = LoadKeytab(filepath.Join(os.TempDir(), "missing.keytab"))
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing keytab")
+		}
+	})
+
+	t.Run("accept", func(t *testing.T) {
+		principal, err := acceptor.Accept(apReqToken(t, kt, "alice", "CORP.EXAMPLE.COM", "CORP.EXAMPLE.COM", time.Now()))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if principal.String() != "alice@CORP.EXAMPLE.COM" {
+			t.Fatalf("principal should be the client of the ticket: %s", principal)
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		token := apReqToken(t, kt, "bob", "CORP.EXAMPLE.COM", "CORP.EXAMPLE.COM", time.Now())
+		_, err := acceptor.Accept(token)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		_, err = acceptor.Accept(token)
+		if errors.Cause(err) != ErrReplay {
+			t.Fatalf("err should be ErrReplay because the authenticator was presented already: %v", err)
+		}
+	})
+
+	t.Run("rejections", func(t *testing.T) {
+		_, err := acceptor.Accept(kerberosToken(t, "alice@CORP.EXAMPLE.COM"))
+		if errors.Cause(err) != ErrInvalidToken {
+			t.Fatalf("err should be ErrInvalidToken because of the forged AP-REQ: %v", err)
+		}
+
+		_, err = acceptor.Accept(apReqToken(t, serviceKeytab(t, "other-secret"), "alice", "CORP.EXAMPLE.COM", "CORP.EXAMPLE.COM", time.Now()))
+		if errors.Cause(err) != ErrInvalidToken {
+			t.Fatalf("err should be ErrInvalidToken because of the key of another service: %v", err)
+		}
+
+		_, err = acceptor.Accept(apReqToken(t, kt, "alice", "CORP.EXAMPLE.COM", "CORP.EXAMPLE.COM", time.Now().Add(-time.Hour)))
+		if errors.Cause(err) != ErrInvalidToken {
+			t.Fatalf("err should be ErrInvalidToken because of the clock skew: %v", err)
+		}
+
+		_, err = acceptor.Accept(apReqToken(t, kt, "alice", "OTHER.EXAMPLE.COM", "CORP.EXAMPLE.COM", time.Now()))
+		if errors.Cause(err) != ErrInvalidToken {
+			t.Fatalf("err should be ErrInvalidToken because of the realm of the authenticator: %v", err)
+		}
+	})
+
+	t.Run("load", func(t *testing.T) {
+		data, err := kt.Marshal()
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		dir, err := ioutil.TempDir("", "spnego")
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "http.keytab")
+		err = ioutil.WriteFile(path, data, 0600)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		loaded, err := LoadKeytab(path)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+		loaded.SetServicePrincipal(servicePrincipal)
+
+		principal, err := loaded.Accept(apReqToken(t, kt, "carol", "CORP.EXAMPLE.COM", "CORP.EXAMPLE.COM", time.Now()))
+		if err != nil || principal.Name != "carol" {
+			t.Fatalf("tokens should be accepted with the loaded keytab: %v - %v", principal, err)
+		}
+	})
+}
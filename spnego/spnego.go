@@ -0,0 +1,167 @@
+package spnego
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/password"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidToken is thrown when a negotiation token is malformed or carries no Kerberos token
+var ErrInvalidToken = errors.New("invalid negotiation token")
+
+// ErrNTLMUnsupported is thrown when a client falls back to NTLM, e.g. outside of the domain or without a service principal
+var ErrNTLMUnsupported = errors.New("NTLM is not supported")
+
+// ErrUnknownPrincipal is thrown when no user matches a principal
+var ErrUnknownPrincipal = errors.New("unknown principal")
+
+// Principal is a Kerberos principal, e.g. "alice@CORP.EXAMPLE.COM"
+type Principal struct {
+	Name  string
+	Realm string
+}
+
+// String returns the principal as "name@REALM"
+func (principal Principal) String() string {
+	if principal.Realm == "" {
+		return principal.Name
+	}
+
+	return principal.Name + "@" + principal.Realm
+}
+
+// ParsePrincipal parses a principal of the form "name@REALM", where the name may have components, e.g. "HTTP/intranet.example.com@CORP.EXAMPLE.COM"
+func ParsePrincipal(str string) Principal {
+	i := strings.LastIndex(str, "@")
+	if i < 0 {
+		return Principal{Name: str}
+	}
+
+	return Principal{Name: str[:i], Realm: str[i+1:]}
+}
+
+// Acceptor accepts the Kerberos GSS-API tokens of the service, i.e. it decrypts the AP-REQ with the service keytab,
+// verifies the authenticator and returns the client principal, e.g. a KeytabAcceptor
+type Acceptor interface {
+	Accept(token []byte) (Principal, error)
+}
+
+// AcceptorFunc is the adapter to use ordinary functions as acceptors
+type AcceptorFunc func(token []byte) (Principal, error)
+
+// Accept calls f(token)
+func (f AcceptorFunc) Accept(token []byte) (Principal, error) {
+	return f(token)
+}
+
+// MappingFunc maps an authenticated principal to its user
+type MappingFunc func(Principal) (gate.User, error)
+
+// RealmMapping strips the realm of principals and finds users by the remaining name, e.g. with gate.UserService.FindOrCreateOneByUsername.
+// Principals of other realms than the given ones are refused, realms are compared case-insensitively. Every principal is refused without realms,
+// since names of different realms, e.g. of trusted forests, may belong to different users
+func RealmMapping(lookup func(name string) (gate.User, error), realms ...string) MappingFunc {
+	return func(principal Principal) (gate.User, error) {
+		if !containsFold(realms, principal.Realm) {
+			return nil, errors.WithMessage(ErrUnknownPrincipal, "realm "+principal.Realm+" is not allowed")
+		}
+
+		return lookup(principal.Name)
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Driver is Kerberos/SPNEGO authentication. Tokens are the base64-encoded negotiation tokens of "Authorization: Negotiate <token>" headers,
+// e.g. extracted with middleware.AuthorizationExtractor("Negotiate") and challenged with a "Negotiate" responder.
+// Mutual authentication is not performed, i.e. no response token is sent back to the client
+type Driver struct {
+	config     gate.Config
+	authorizer *password.Driver
+	acceptor   Acceptor
+	mapping    MappingFunc
+}
+
+// GetConfig returns authentication configuration
+func (auth Driver) GetConfig() gate.Config {
+	return auth.config
+}
+
+// Authenticate accepts a base64-encoded negotiation token and maps its client principal to a user
+func (auth Driver) Authenticate(token string) (user gate.User, err error) {
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		err = gate.NewAuthenticationError(errors.WithMessage(ErrInvalidToken, err.Error()))
+		return
+	}
+
+	mechToken, err := unwrap(raw)
+	if err != nil {
+		err = gate.NewAuthenticationError(err)
+		return
+	}
+
+	principal, err := auth.acceptor.Accept(mechToken)
+	if err != nil {
+		err = gate.NewAuthenticationError(errors.Wrap(err, "could not accept the Kerberos token"))
+		return
+	}
+
+	user, err = auth.mapping(principal)
+	if err != nil {
+		err = errors.Wrap(err, "could not find the user of the principal "+principal.String())
+		if errors.Cause(err) == ErrUnknownPrincipal {
+			err = gate.NewAuthenticationError(err)
+		}
+	}
+	return
+}
+
+// Authorize performs the authorization when a given user takes an action on an object, see password.Driver.Authorize
+func (auth Driver) Authorize(user gate.User, action, object string) error {
+	return auth.authorizer.Authorize(user, action, object)
+}
+
+// AuthorizeContext performs the authorization of a request context, see password.Driver.AuthorizeContext
+func (auth Driver) AuthorizeContext(ctx *gate.AuthzContext, action, object string) error {
+	return auth.authorizer.AuthorizeContext(ctx, action, object)
+}
+
+// New is the constructor for Driver. Kerberos tokens are accepted by the acceptor and their principals are mapped to users by the mapping.
+// The authorization requires either the authorization backend or the role service of the dependencies, see password.NewAuthorizer
+func New(config gate.Config, dependencies *gate.Dependencies, acceptor Acceptor, mapping MappingFunc) (*Driver, error) {
+	if dependencies == nil {
+		return nil, errors.New("missing dependencies")
+	}
+
+	if acceptor == nil {
+		return nil, errors.New("missing acceptor")
+	}
+
+	if mapping == nil {
+		return nil, errors.New("missing principal mapping")
+	}
+
+	authorizer, err := password.NewAuthorizer(config, dependencies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Driver{
+		config:     config,
+		authorizer: authorizer,
+		acceptor:   acceptor,
+		mapping:    mapping,
+	}, nil
+}
@@ -0,0 +1,173 @@
+package spnego
+
+import (
+	"encoding/asn1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hiendv/gate"
+	"github.com/hiendv/gate/middleware"
+	"github.com/hiendv/gate/policy"
+	"github.com/pkg/errors"
+)
+
+func marshal(t *testing.T, value interface{}) []byte {
+	data, err := asn1.Marshal(value)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+	return data
+}
+
+// kerberosToken is a GSS-API Kerberos token carrying the principal in place of the AP-REQ
+func kerberosToken(t *testing.T, principal string) []byte {
+	body := append(marshal(t, kerberosOID), 0x01, 0x00)
+	body = append(body, principal...)
+	return marshal(t, asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: body})
+}
+
+func negotiationToken(t *testing.T, mechTypes []asn1.ObjectIdentifier, mechToken []byte) string {
+	init := marshal(t, negTokenInit{MechTypes: mechTypes, MechToken: mechToken})
+	choice := marshal(t, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: init})
+	body := append(marshal(t, spnegoOID), choice...)
+	return base64.StdEncoding.EncodeToString(marshal(t, asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: body}))
+}
+
+var acceptor = AcceptorFunc(func(token []byte) (principal Principal, err error) {
+	var outer asn1.RawValue
+	_, err = asn1.Unmarshal(token, &outer)
+	if err != nil {
+		return
+	}
+
+	var mech asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(outer.Bytes, &mech)
+	if err != nil || !mech.Equal(kerberosOID) || len(rest) < 2 {
+		err = errors.New("invalid AP-REQ")
+		return
+	}
+
+	principal = ParsePrincipal(string(rest[2:]))
+	return
+})
+
+func TestDriver(t *testing.T) {
+	document := policy.Document{
+		Roles: []policy.Role{
+			{ID: "staff", Abilities: []policy.Ability{{Action: "GET", Object: "/intranet"}}},
+			{ID: "auditor", PermissionSets: []string{"audit"}},
+		},
+		PermissionSets: []policy.PermissionSet{{Name: "audit", Abilities: []policy.Ability{{Action: "GET", Object: "/audit"}}}},
+		Users:          []policy.User{{ID: "alice", Roles: []string{"staff", "auditor"}}},
+	}
+
+	config := gate.NewConfig(nil, nil, time.Hour, false)
+	dependencies := gate.NewDependencies(nil, nil, document)
+	dependencies.SetPermissionSetService(document)
+	driver, err := New(config, dependencies, acceptor, RealmMapping(document.FindOneByID, "CORP.EXAMPLE.COM"))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := New(config, gate.NewDependencies(nil, nil, nil), acceptor, RealmMapping(document.FindOneByID))
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing role service")
+		}
+
+		_, err = New(config, gate.NewDependencies(nil, nil, document), nil, RealmMapping(document.FindOneByID))
+		if err == nil {
+			t.Fatal("err should not be nil because of the missing acceptor")
+		}
+	})
+
+	t.Run("principal", func(t *testing.T) {
+		principal := ParsePrincipal("HTTP/intranet.example.com@CORP.EXAMPLE.COM")
+		if principal.Name != "HTTP/intranet.example.com" || principal.Realm != "CORP.EXAMPLE.COM" {
+			t.Fatalf("principal should be parsed: %#v", principal)
+		}
+
+		if principal.String() != "HTTP/intranet.example.com@CORP.EXAMPLE.COM" || ParsePrincipal("alice").String() != "alice" {
+			t.Fatalf("principal should be formatted: %s", principal)
+		}
+	})
+
+	t.Run("authenticate", func(t *testing.T) {
+		user, err := driver.Authenticate(negotiationToken(t, []asn1.ObjectIdentifier{msKerberosOID, kerberosOID}, kerberosToken(t, "alice@corp.example.com")))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if user.GetID() != "alice" {
+			t.Fatalf("user should be mapped from the principal: %s", user.GetID())
+		}
+
+		user, err = driver.Authenticate(base64.StdEncoding.EncodeToString(kerberosToken(t, "alice@CORP.EXAMPLE.COM")))
+		if err != nil || user.GetID() != "alice" {
+			t.Fatalf("raw Kerberos tokens should be accepted: %v", err)
+		}
+	})
+
+	t.Run("rejections", func(t *testing.T) {
+		_, err := driver.Authenticate("%%%")
+		if errors.Cause(err) != ErrInvalidToken {
+			t.Fatalf("err should be ErrInvalidToken because of the encoding: %v", err)
+		}
+
+		_, err = driver.Authenticate(base64.StdEncoding.EncodeToString([]byte("NTLMSSP\x00\x01\x00\x00\x00")))
+		if errors.Cause(err) != ErrNTLMUnsupported {
+			t.Fatalf("err should be ErrNTLMUnsupported: %v", err)
+		}
+
+		_, err = driver.Authenticate(negotiationToken(t, []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}}, []byte("NTLMSSP")))
+		if errors.Cause(err) != ErrInvalidToken {
+			t.Fatalf("err should be ErrInvalidToken because of the preferred mechanism: %v", err)
+		}
+
+		_, err = driver.Authenticate(negotiationToken(t, []asn1.ObjectIdentifier{kerberosOID}, kerberosToken(t, "alice@OTHER.EXAMPLE.COM")))
+		if errors.Cause(err) != ErrUnknownPrincipal {
+			t.Fatalf("err should be ErrUnknownPrincipal because of the realm: %v", err)
+		}
+
+		_, err = RealmMapping(document.FindOneByID)(Principal{Name: "alice", Realm: "CORP.EXAMPLE.COM"})
+		if errors.Cause(err) != ErrUnknownPrincipal {
+			t.Fatalf("err should be ErrUnknownPrincipal because no realm is allowed: %v", err)
+		}
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		m := middleware.New(driver)
+		m.SetExtractor(middleware.AuthorizationExtractor("Negotiate"))
+		responder := middleware.NewResponder("")
+		responder.SetScheme("Negotiate")
+		m.SetResponder(responder)
+		handler := m.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/intranet", nil))
+		if recorder.Code != http.StatusUnauthorized || recorder.Header().Get("WWW-Authenticate") != "Negotiate" {
+			t.Fatalf("request should be challenged: %d %s", recorder.Code, recorder.Header().Get("WWW-Authenticate"))
+		}
+
+		r := httptest.NewRequest("GET", "/intranet", nil)
+		r.Header.Set("Authorization", "Negotiate "+negotiationToken(t, []asn1.ObjectIdentifier{kerberosOID}, kerberosToken(t, "alice@CORP.EXAMPLE.COM")))
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the ability: %d", recorder.Code)
+		}
+
+		r = httptest.NewRequest("GET", "/audit", nil)
+		r.Header.Set("Authorization", "Negotiate "+negotiationToken(t, []asn1.ObjectIdentifier{kerberosOID}, kerberosToken(t, "alice@CORP.EXAMPLE.COM")))
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code != http.StatusNoContent {
+			t.Fatalf("status should be 204 because of the permission set: %d", recorder.Code)
+		}
+	})
+}
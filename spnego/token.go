@@ -0,0 +1,81 @@
+package spnego
+
+import (
+	"bytes"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	spnegoOID     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	kerberosOID   = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+	msKerberosOID = asn1.ObjectIdentifier{1, 2, 840, 48018, 1, 2, 2}
+)
+
+// negTokenInit is the initial SPNEGO token of RFC 4178
+type negTokenInit struct {
+	MechTypes   []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+	ReqFlags    asn1.BitString          `asn1:"explicit,optional,tag:1"`
+	MechToken   []byte                  `asn1:"explicit,optional,tag:2"`
+	MechListMIC []byte                  `asn1:"explicit,optional,tag:3"`
+}
+
+func isKerberos(oid asn1.ObjectIdentifier) bool {
+	return oid.Equal(kerberosOID) || oid.Equal(msKerberosOID)
+}
+
+// unwrap returns the Kerberos GSS-API token of a negotiation token, either wrapped by a SPNEGO NegTokenInit or sent as is.
+// NTLM tokens, which clients fall back to when Kerberos is unavailable, are refused
+func unwrap(token []byte) (mechToken []byte, err error) {
+	if bytes.HasPrefix(token, []byte("NTLMSSP\x00")) {
+		err = ErrNTLMUnsupported
+		return
+	}
+
+	var outer asn1.RawValue
+	_, err = asn1.Unmarshal(token, &outer)
+	if err != nil || outer.Class != asn1.ClassApplication || outer.Tag != 0 {
+		err = errors.WithMessage(ErrInvalidToken, "not a GSS-API token")
+		return
+	}
+
+	var mech asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(outer.Bytes, &mech)
+	if err != nil {
+		err = errors.WithMessage(ErrInvalidToken, err.Error())
+		return
+	}
+
+	if isKerberos(mech) {
+		mechToken = token
+		return
+	}
+
+	if !mech.Equal(spnegoOID) {
+		err = errors.WithMessage(ErrInvalidToken, "unsupported mechanism "+mech.String())
+		return
+	}
+
+	var choice asn1.RawValue
+	_, err = asn1.Unmarshal(rest, &choice)
+	if err != nil || choice.Class != asn1.ClassContextSpecific || choice.Tag != 0 {
+		err = errors.WithMessage(ErrInvalidToken, "not a NegTokenInit")
+		return
+	}
+
+	var init negTokenInit
+	_, err = asn1.Unmarshal(choice.Bytes, &init)
+	if err != nil {
+		err = errors.WithMessage(ErrInvalidToken, err.Error())
+		return
+	}
+
+	if len(init.MechTypes) == 0 || !isKerberos(init.MechTypes[0]) || len(init.MechToken) == 0 {
+		err = errors.WithMessage(ErrInvalidToken, "no optimistic Kerberos token")
+		return
+	}
+
+	mechToken = init.MechToken
+	return
+}
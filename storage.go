@@ -0,0 +1,177 @@
+package gate
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StoragePolicy is the policy applied when tokens cannot be stored on issuance
+type StoragePolicy int
+
+// Storage policies
+const (
+	// StorageFailClosed fails the issuance, hence the login
+	StorageFailClosed StoragePolicy = iota
+	// StorageFailOpen issues the token anyway and logs a warning. Tokens of a TokenManager which are not stored are refused as revoked
+	StorageFailOpen
+	// StorageRetry retries the storage with exponential backoff before failing the issuance
+	StorageRetry
+	// StorageWriteBehind queues the token and stores it asynchronously with retries
+	StorageWriteBehind
+)
+
+// DefaultTokenStorageAttempts is the default maximum number of attempts to store a token
+const DefaultTokenStorageAttempts = 3
+
+// DefaultTokenStorageBackoff is the default backoff before the second attempt to store a token
+const DefaultTokenStorageBackoff = 50 * time.Millisecond
+
+// DefaultTokenWriteBehindSize is the default buffer size of the token write-behind queue
+const DefaultTokenWriteBehindSize = 1000
+
+// StoreWithRetry stores a token with the token service and retries failures up to the given number of attempts.
+// The backoff doubles after every failed attempt. The last error is returned
+func StoreWithRetry(service TokenService, token JWT, attempts int, backoff time.Duration) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = service.Store(token)
+		if err == nil || attempt >= attempts {
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// TokenWriteBehind stores tokens asynchronously with a bounded buffer. Tokens are stored synchronously when the buffer is full
+// or once the queue is closed. Queued tokens are reported as pending until they are stored, e.g. so that they are not refused as revoked
+// in the meantime. The zero value is a disabled queue which stores nothing, queues are made by NewTokenWriteBehind
+type TokenWriteBehind struct {
+	service  TokenService
+	attempts int
+	backoff  time.Duration
+	queue    chan JWT
+	done     chan struct{}
+	closed   *bool
+	pending  map[string]JWT
+	onError  func(JWT, error)
+	*sync.RWMutex
+}
+
+// Enabled reports whether the write-behind queue is enabled
+func (writer TokenWriteBehind) Enabled() bool {
+	return writer.queue != nil
+}
+
+// Store queues a token, or stores it synchronously with retries when the buffer is full or the queue is closed
+func (writer TokenWriteBehind) Store(token JWT) error {
+	if !writer.Enabled() {
+		return errors.New("token write-behind queue is not started")
+	}
+
+	writer.Lock()
+	if *writer.closed {
+		writer.Unlock()
+		return StoreWithRetry(writer.service, token, writer.attempts, writer.backoff)
+	}
+
+	select {
+	case writer.queue <- token:
+		writer.pending[token.ID] = token
+		writer.Unlock()
+		return nil
+	default:
+		writer.Unlock()
+	}
+
+	return StoreWithRetry(writer.service, token, writer.attempts, writer.backoff)
+}
+
+// Pending returns a queued token which is not stored yet
+func (writer TokenWriteBehind) Pending(id string) (token JWT, ok bool) {
+	if !writer.Enabled() {
+		return
+	}
+
+	writer.RLock()
+	defer writer.RUnlock()
+
+	token, ok = writer.pending[id]
+	return
+}
+
+// Len returns the number of queued tokens
+func (writer TokenWriteBehind) Len() int {
+	if !writer.Enabled() {
+		return 0
+	}
+
+	writer.RLock()
+	defer writer.RUnlock()
+
+	return len(writer.pending)
+}
+
+// Close stops queueing tokens and waits until the queued ones are stored, e.g. on shutdown. Tokens are stored synchronously afterwards.
+// Closing a closed queue only waits for the queued tokens
+func (writer TokenWriteBehind) Close() {
+	if !writer.Enabled() {
+		return
+	}
+
+	writer.Lock()
+	if !*writer.closed {
+		*writer.closed = true
+		close(writer.queue)
+	}
+	writer.Unlock()
+
+	<-writer.done
+}
+
+func (writer TokenWriteBehind) run() {
+	defer close(writer.done)
+
+	for token := range writer.queue {
+		err := StoreWithRetry(writer.service, token, writer.attempts, writer.backoff)
+
+		writer.Lock()
+		delete(writer.pending, token.ID)
+		writer.Unlock()
+
+		if err != nil && writer.onError != nil {
+			writer.onError(token, err)
+		}
+	}
+}
+
+// NewTokenWriteBehind is the constructor for TokenWriteBehind. It starts storing the queued tokens with the token service
+// and retries failures like StoreWithRetry. Tokens failing every attempt are reported to the error handler, if any
+func NewTokenWriteBehind(service TokenService, size, attempts int, backoff time.Duration, onError func(JWT, error)) TokenWriteBehind {
+	writer := TokenWriteBehind{
+		service:  service,
+		attempts: attempts,
+		backoff:  backoff,
+		queue:    make(chan JWT, size),
+		done:     make(chan struct{}),
+		closed:   new(bool),
+		pending:  map[string]JWT{},
+		onError:  onError,
+		RWMutex:  &sync.RWMutex{},
+	}
+
+	go writer.run()
+	return writer
+}
+
+// TokenWriteBehind is the getter for the token write-behind queue
+func (dependencies Dependencies) TokenWriteBehind() TokenWriteBehind {
+	return dependencies.tokenWriter
+}
+
+// SetTokenWriteBehind is the setter for the token write-behind queue used by the StorageWriteBehind policy
+func (dependencies *Dependencies) SetTokenWriteBehind(writer TokenWriteBehind) {
+	dependencies.tokenWriter = writer
+}
@@ -0,0 +1,165 @@
+package gate
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type flakyTokenService struct {
+	failures int
+	calls    int
+	stored   map[string]JWT
+	release  chan struct{}
+	*sync.Mutex
+}
+
+func (service *flakyTokenService) Store(token JWT) error {
+	if service.release != nil {
+		<-service.release
+	}
+
+	service.Lock()
+	defer service.Unlock()
+
+	service.calls++
+	if service.failures > 0 {
+		service.failures--
+		return errors.New("storage is unavailable")
+	}
+
+	service.stored[token.ID] = token
+	return nil
+}
+
+func (service *flakyTokenService) FindOneByID(id string) (JWT, error) {
+	service.Lock()
+	defer service.Unlock()
+
+	token, ok := service.stored[id]
+	if !ok {
+		return token, errors.New("token not found")
+	}
+	return token, nil
+}
+
+func newFlakyTokenService(failures int) *flakyTokenService {
+	return &flakyTokenService{failures: failures, stored: map[string]JWT{}, Mutex: &sync.Mutex{}}
+}
+
+func TestStoreWithRetry(t *testing.T) {
+	service := newFlakyTokenService(2)
+	err := StoreWithRetry(service, JWT{ID: "a"}, 3, time.Millisecond)
+	if err != nil || service.calls != 3 {
+		t.Fatalf("the token should be stored by the third attempt: %v %d", err, service.calls)
+	}
+
+	service = newFlakyTokenService(3)
+	err = StoreWithRetry(service, JWT{ID: "a"}, 3, time.Millisecond)
+	if err == nil || service.calls != 3 {
+		t.Fatalf("err should not be nil because every attempt failed: %v %d", err, service.calls)
+	}
+
+	service = newFlakyTokenService(1)
+	err = StoreWithRetry(service, JWT{ID: "a"}, 0, time.Millisecond)
+	if err == nil || service.calls != 1 {
+		t.Fatalf("the token should be stored once without attempts: %v %d", err, service.calls)
+	}
+}
+
+func TestTokenWriteBehind(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		if (TokenWriteBehind{}).Enabled() {
+			t.Fatal("the zero value should be disabled")
+		}
+
+		if _, ok := (TokenWriteBehind{}).Pending("a"); ok || (TokenWriteBehind{}).Len() != 0 {
+			t.Fatal("nothing should be pending")
+		}
+
+		if err := (TokenWriteBehind{}).Store(JWT{ID: "a"}); err == nil {
+			t.Fatal("err should not be nil because the queue is not started")
+		}
+		TokenWriteBehind{}.Close()
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		service := newFlakyTokenService(0)
+		writer := NewTokenWriteBehind(service, 1, 1, time.Millisecond, nil)
+		writer.Close()
+		writer.Close()
+
+		err := writer.Store(JWT{ID: "a"})
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err := service.FindOneByID("a"); err != nil {
+			t.Fatal("the token should be stored synchronously because the queue is closed")
+		}
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		service := newFlakyTokenService(0)
+		service.release = make(chan struct{})
+		writer := NewTokenWriteBehind(service, 1, 1, time.Millisecond, nil)
+
+		err := writer.Store(JWT{ID: "a"})
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, ok := writer.Pending("a"); !ok {
+			t.Fatal("the token should be pending")
+		}
+
+		close(service.release)
+		writer.Close()
+
+		if _, ok := writer.Pending("a"); ok || writer.Len() != 0 {
+			t.Fatal("the token should not be pending after the queue is drained")
+		}
+
+		if _, err := service.FindOneByID("a"); err != nil {
+			t.Fatalf("the token should be stored: %s", err)
+		}
+	})
+
+	t.Run("full", func(t *testing.T) {
+		service := newFlakyTokenService(0)
+		service.release = make(chan struct{}, 3)
+		writer := NewTokenWriteBehind(service, 0, 1, time.Millisecond, nil)
+
+		service.release <- struct{}{}
+		err := writer.Store(JWT{ID: "a"})
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err := service.FindOneByID("a"); err != nil {
+			t.Fatal("the token should be stored synchronously because the buffer is full")
+		}
+		writer.Close()
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		service := newFlakyTokenService(2)
+		var failed []string
+		writer := NewTokenWriteBehind(service, 2, 2, time.Millisecond, func(token JWT, err error) {
+			failed = append(failed, token.ID)
+		})
+
+		writer.Store(JWT{ID: "a"})
+		writer.Store(JWT{ID: "b"})
+		writer.Close()
+
+		if len(failed) != 1 || failed[0] != "a" {
+			t.Fatalf("the token failing every attempt should be reported: %v", failed)
+		}
+
+		if _, err := service.FindOneByID("b"); err != nil {
+			t.Fatal("the following token should be stored")
+		}
+	})
+}
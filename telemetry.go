@@ -0,0 +1,133 @@
+package gate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// LoginAttempt is the structured telemetry of a login attempt
+type LoginAttempt struct {
+	// UsernameHash is the hex-encoded SHA-256 of the username so attempts can be correlated without logging usernames
+	UsernameHash string
+	// Source is the metadata of the attempt, e.g. "ip" or "user_agent"
+	Source    map[string]string
+	Succeeded bool
+	Err       error
+	Latency   time.Duration
+	At        time.Time
+}
+
+// LoginHook is invoked after every login attempt
+type LoginHook func(LoginAttempt)
+
+// AnomalyDetector is the contract for detectors of suspicious login attempts, e.g. impossible travel or credential stuffing.
+// Every attempt is observed, the returned error fails otherwise successful logins. Return ErrMFARequired to demand a step-up
+type AnomalyDetector interface {
+	Detect(LoginAttempt) error
+}
+
+// HashUsername returns the hex-encoded SHA-256 of a username
+func HashUsername(username string) string {
+	sum := sha256.Sum256([]byte(username))
+	return hex.EncodeToString(sum[:])
+}
+
+type loginFailures struct {
+	sources map[string][]time.Time
+	sweptAt time.Time
+}
+
+// VelocityDetector is the AnomalyDetector of credential stuffing.
+// It demands MFA on successful logins from a source with too many failed attempts within the window.
+// The failures of every source out of the window are purged by the attempts at most once per window
+type VelocityDetector struct {
+	key       string
+	threshold int
+	window    time.Duration
+	failures  *loginFailures
+	Now       func() time.Time
+	*sync.Mutex
+}
+
+// Detect records failed attempts and returns ErrMFARequired for successful attempts of a suspicious source
+func (detector VelocityDetector) Detect(attempt LoginAttempt) error {
+	source, ok := attempt.Source[detector.key]
+	if !ok {
+		return nil
+	}
+
+	detector.Lock()
+	defer detector.Unlock()
+
+	now := detector.Now()
+	detector.sweep(now)
+
+	recent := detector.recent(source, now)
+	if !attempt.Succeeded {
+		recent = append(recent, now)
+	}
+
+	if len(recent) == 0 {
+		delete(detector.failures.sources, source)
+	} else {
+		detector.failures.sources[source] = recent
+	}
+
+	if attempt.Succeeded && len(recent) >= detector.threshold {
+		return ErrMFARequired
+	}
+
+	return nil
+}
+
+// Len returns the number of sources with failed attempts, those out of the window included until they are purged
+func (detector VelocityDetector) Len() int {
+	detector.Lock()
+	defer detector.Unlock()
+
+	return len(detector.failures.sources)
+}
+
+// recent returns the failed attempts of a source within the window
+func (detector VelocityDetector) recent(source string, now time.Time) (recent []time.Time) {
+	for _, at := range detector.failures.sources[source] {
+		if now.Sub(at) < detector.window {
+			recent = append(recent, at)
+		}
+	}
+
+	return
+}
+
+// sweep purges the failures of every source out of the window unless they were purged within the window
+func (detector VelocityDetector) sweep(now time.Time) {
+	if now.Sub(detector.failures.sweptAt) < detector.window {
+		return
+	}
+
+	for source := range detector.failures.sources {
+		recent := detector.recent(source, now)
+		if len(recent) == 0 {
+			delete(detector.failures.sources, source)
+		} else {
+			detector.failures.sources[source] = recent
+		}
+	}
+	detector.failures.sweptAt = now
+}
+
+// NewVelocityDetector is the constructor for VelocityDetector. The key is the source metadata identifying the origin of attempts, e.g. "ip"
+func NewVelocityDetector(key string, threshold int, window time.Duration) VelocityDetector {
+	return VelocityDetector{
+		key:       key,
+		threshold: threshold,
+		window:    window,
+		failures:  &loginFailures{sources: map[string][]time.Time{}},
+		Now: func() time.Time {
+			return time.Now().Local()
+		},
+		Mutex: &sync.Mutex{},
+	}
+}
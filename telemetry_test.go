@@ -0,0 +1,72 @@
+package gate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHashUsername(t *testing.T) {
+	if HashUsername("alice") != HashUsername("alice") {
+		t.Fatal("hashes should be deterministic")
+	}
+
+	if HashUsername("alice") == HashUsername("bob") || len(HashUsername("alice")) != 64 {
+		t.Fatal("hashes should be distinct hex-encoded SHA-256 sums")
+	}
+}
+
+func TestVelocityDetector(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+	detector := NewVelocityDetector("ip", 3, time.Minute)
+	detector.Now = func() time.Time {
+		return now
+	}
+
+	failed := LoginAttempt{Source: map[string]string{"ip": "10.0.0.1"}}
+	succeeded := LoginAttempt{Source: map[string]string{"ip": "10.0.0.1"}, Succeeded: true}
+
+	for i := 0; i < 2; i++ {
+		if err := detector.Detect(failed); err != nil {
+			t.Fatalf("err should be nil because failed attempts are only recorded: %s", err)
+		}
+	}
+
+	if err := detector.Detect(succeeded); err != nil {
+		t.Fatalf("err should be nil because of the threshold: %s", err)
+	}
+
+	detector.Detect(failed)
+	if err := detector.Detect(succeeded); err != ErrMFARequired {
+		t.Fatalf("err should be ErrMFARequired because of the failure velocity: %v", err)
+	}
+
+	other := LoginAttempt{Source: map[string]string{"ip": "10.0.0.2"}, Succeeded: true}
+	if err := detector.Detect(other); err != nil {
+		t.Fatalf("err should be nil because of the other source: %s", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := detector.Detect(succeeded); err != nil {
+		t.Fatalf("err should be nil because the failures are out of the window: %s", err)
+	}
+
+	if err := detector.Detect(LoginAttempt{Succeeded: true}); err != nil {
+		t.Fatalf("err should be nil because of the unknown source: %s", err)
+	}
+
+	t.Run("sweep", func(t *testing.T) {
+		for _, ip := range []string{"10.0.1.1", "10.0.1.2", "10.0.1.3"} {
+			detector.Detect(LoginAttempt{Source: map[string]string{"ip": ip}})
+		}
+
+		if detector.Len() != 3 {
+			t.Fatalf("failures within the window should be kept: %d", detector.Len())
+		}
+
+		now = now.Add(time.Minute)
+		detector.Detect(other)
+		if detector.Len() != 0 {
+			t.Fatalf("failures of the sources which never come back should be purged once the window elapses: %d", detector.Len())
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package gate
+
+import (
+	"regexp"
+	"strings"
+)
+
+// UserIDAttribute is the template attribute always resolved to the ID of the authorized user, e.g. "users/{user.id}"
+const UserIDAttribute = "user.id"
+
+var placeholderExpression = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_.]*)\}`)
+
+// Attributes are the values of the template placeholders of ability objects given at authorization time, e.g. {"project_id": "42"}.
+// They must come from trusted data like the user records, never from the request input
+type Attributes map[string]string
+
+// With returns a copy of the attributes with the given attribute
+func (attributes Attributes) With(name, value string) Attributes {
+	result := make(Attributes, len(attributes)+1)
+	for k, v := range attributes {
+		result[k] = v
+	}
+	result[name] = value
+	return result
+}
+
+// IsTemplate reports whether the object of an ability has placeholders, e.g. "projects:{project_id}".
+// Templates only grant when every placeholder is resolved by the attributes of the authorization.
+// With object paths, placeholders must be whole segments, e.g. "projects/{project_id}/issues"
+func IsTemplate(ability UserAbility) bool {
+	return placeholderExpression.MatchString(ability.GetObject())
+}
+
+// Placeholders returns the names of the placeholders of a pattern in order
+func Placeholders(pattern string) (names []string) {
+	for _, match := range placeholderExpression.FindAllStringSubmatch(pattern, -1) {
+		names = append(names, match[1])
+	}
+	return
+}
+
+// templateAbility is an ability with the expanded object of a template
+type templateAbility struct {
+	UserAbility
+	object string
+}
+
+func (ability templateAbility) GetObject() string {
+	return ability.object
+}
+
+// ExpandTemplate substitutes the placeholders of a pattern with the attributes.
+// Values are escaped so they match literally, and ok is false when an attribute is missing or cannot be matched literally
+func (service Matcher) ExpandTemplate(pattern string, attributes Attributes) (result string, ok bool) {
+	ok = true
+	result = placeholderExpression.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		value, found := attributes[placeholder[1:len(placeholder)-1]]
+		if !found || !service.literal(value) {
+			ok = false
+			return placeholder
+		}
+
+		if service.objectPaths {
+			return value
+		}
+
+		return regexp.QuoteMeta(value)
+	})
+
+	if !ok {
+		result = ""
+	}
+	return
+}
+
+// MatchTemplate reports whether a template ability grants an action on an object with the attributes.
+// Abilities without placeholders are matched as they are
+func (service Matcher) MatchTemplate(action, object string, ability UserAbility, attributes Attributes) bool {
+	if !IsTemplate(ability) {
+		return service.MatchAbility(action, object, ability)
+	}
+
+	expanded, ok := service.ExpandTemplate(ability.GetObject(), attributes)
+	if !ok {
+		return false
+	}
+
+	return service.MatchAbility(action, object, templateAbility{ability, expanded})
+}
+
+// literal reports whether a value can be substituted without being interpreted as a pattern or a placeholder.
+// Path values must be a single segment which is not a parameter
+func (service Matcher) literal(value string) bool {
+	if value == "" || strings.ContainsAny(value, "*{}") {
+		return false
+	}
+
+	if !service.objectPaths {
+		return true
+	}
+
+	return !strings.HasPrefix(value, ":") && !strings.Contains(value, "/")
+}
+
+// templateWildcard replaces the placeholders of a pattern with wildcards, so templates are found regardless of the attributes
+func (service Matcher) templateWildcard(pattern string) string {
+	if service.objectPaths {
+		return placeholderExpression.ReplaceAllString(pattern, "*")
+	}
+
+	return placeholderExpression.ReplaceAllString(pattern, "(.{0,})")
+}
@@ -0,0 +1,70 @@
+package gate
+
+import (
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	matcher := NewMatcher()
+	template := testAbility{"read", "projects:{project_id}:issues"}
+	if !IsTemplate(template) || !IsConditional(template) || IsTemplate(testAbility{"read", "projects:[0-9]{2}"}) {
+		t.Fatal("only abilities with placeholders should be templates")
+	}
+
+	if names := Placeholders("orgs:{org}:projects:{project_id}"); len(names) != 2 || names[1] != "project_id" {
+		t.Fatalf("placeholders should be in order: %v", names)
+	}
+
+	t.Run("match", func(t *testing.T) {
+		attributes := Attributes{"project_id": "42"}
+		if !matcher.MatchTemplate("read", "projects:42:issues", template, attributes) {
+			t.Fatal("template should match the object with the attributes")
+		}
+
+		if matcher.MatchTemplate("read", "projects:43:issues", template, attributes) {
+			t.Fatal("template should not match the object of another project")
+		}
+
+		if matcher.MatchTemplate("read", "projects:42:issues", template, nil) {
+			t.Fatal("template should not match without the attributes")
+		}
+
+		if matcher.MatchTemplate("read", "projects:42:issues", template, Attributes{"project_id": "4."}) {
+			t.Fatal("attributes should be matched literally")
+		}
+
+		if matcher.MatchTemplate("read", "projects:42:issues", template, Attributes{"project_id": "*"}) {
+			t.Fatal("wildcard attributes should not be substituted")
+		}
+
+		if !matcher.MatchAbility("read", "projects:42:issues", template) {
+			t.Fatal("placeholders should match anything without the attributes")
+		}
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		paths := NewMatcher()
+		paths.SetObjectPaths(true)
+		template := testAbility{"read", "projects/{project_id}/issues/*"}
+		if !paths.MatchTemplate("read", "projects/42/issues/1", template, Attributes{"project_id": "42"}) {
+			t.Fatal("template should match the path with the attributes")
+		}
+
+		for _, value := range []string{"**", ":id", "42/issues"} {
+			if paths.MatchTemplate("read", "projects/42/issues/1", template, Attributes{"project_id": value}) {
+				t.Fatalf("%q should not be substituted in a path", value)
+			}
+		}
+	})
+
+	t.Run("index", func(t *testing.T) {
+		index := NewAbilityIndex([]UserAbility{template}, matcher)
+		if index.Allows("read", "projects:42:issues") {
+			t.Fatal("templates should not grant by themselves")
+		}
+
+		if conditional := index.Conditional("read", "projects:42:issues"); len(conditional) != 1 {
+			t.Fatalf("templates should be conditional: %v", conditional)
+		}
+	})
+}
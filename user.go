@@ -12,6 +12,11 @@ type Role interface {
 	GetAbilities() []UserAbility
 }
 
+// IdentifiedRole is the optional contract for roles exposing their ID, which allows roles of many role sets to be fetched at once
+type IdentifiedRole interface {
+	GetID() string
+}
+
 // UserAbility is the contract for the ability entity
 type UserAbility interface {
 	GetAction() string
@@ -21,6 +26,7 @@ type UserAbility interface {
 // UserInfo is the user information entity
 type UserInfo struct {
 	ID       string   `json:"id"`
-	Username string   `json:"username"`
-	Roles    []string `json:"roles"`
+	Username string   `json:"username,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	Email    string   `json:"email,omitempty"`
 }
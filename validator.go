@@ -0,0 +1,158 @@
+package gate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidClaims is thrown when the claims of a token are refused by a claims validator
+var ErrInvalidClaims = errors.New("invalid claims")
+
+// ClaimsContext is the context of a claims validation
+type ClaimsContext struct {
+	Claims JWTClaims
+	Now    time.Time
+
+	segment string
+}
+
+// Raw decodes the claims as encoded in the token, including the custom claims unknown to JWTClaims.
+// The claims of tokens decoded by a token codec are encoded from JWTClaims, hence they have no custom claims
+func (ctx ClaimsContext) Raw() (raw map[string]interface{}, err error) {
+	var data []byte
+	if ctx.segment != "" {
+		data, err = jwt.DecodeSegment(ctx.segment)
+	} else {
+		data, err = json.Marshal(ctx.Claims)
+	}
+	if err != nil {
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&raw)
+	return
+}
+
+// ClaimsValidator is the contract for organization-specific token policies enforced on parsing, e.g. required custom claims.
+// It returns ErrInvalidClaims, or an error caused by it, when the claims are refused
+type ClaimsValidator interface {
+	ValidateClaims(ClaimsContext) error
+}
+
+// ClaimsValidatorFunc is the adapter to use ordinary functions as claims validators
+type ClaimsValidatorFunc func(ClaimsContext) error
+
+// ValidateClaims calls f(ctx)
+func (f ClaimsValidatorFunc) ValidateClaims(ctx ClaimsContext) error {
+	return f(ctx)
+}
+
+// RequireClaims refuses the claims missing one of the given claims, e.g. "tenant"
+func RequireClaims(names ...string) ClaimsValidator {
+	return ClaimsValidatorFunc(func(ctx ClaimsContext) error {
+		raw, err := ctx.Raw()
+		if err != nil {
+			return errors.WithMessage(ErrInvalidClaims, err.Error())
+		}
+
+		for _, name := range names {
+			if value, ok := raw[name]; !ok || value == nil || value == "" {
+				return errors.WithMessage(ErrInvalidClaims, fmt.Sprintf("missing claim %q", name))
+			}
+		}
+
+		return nil
+	})
+}
+
+// AllowClaimValues refuses the claims whose claim is not one of the allowed values, e.g. a tenant allow-list.
+// Array claims are refused when one of their values is not allowed. Missing claims are refused
+func AllowClaimValues(name string, values ...string) ClaimsValidator {
+	allowed := map[string]bool{}
+	for _, value := range values {
+		allowed[value] = true
+	}
+
+	return ClaimsValidatorFunc(func(ctx ClaimsContext) error {
+		raw, err := ctx.Raw()
+		if err != nil {
+			return errors.WithMessage(ErrInvalidClaims, err.Error())
+		}
+
+		var claimed []interface{}
+		switch value := raw[name].(type) {
+		case []interface{}:
+			claimed = value
+		case nil:
+		default:
+			claimed = []interface{}{value}
+		}
+
+		if len(claimed) == 0 {
+			return errors.WithMessage(ErrInvalidClaims, fmt.Sprintf("missing claim %q", name))
+		}
+
+		for _, value := range claimed {
+			if !allowed[fmt.Sprint(value)] {
+				return errors.WithMessage(ErrInvalidClaims, fmt.Sprintf("claim %q has a value which is not allowed", name))
+			}
+		}
+
+		return nil
+	})
+}
+
+// MaxClaimsAge refuses the claims issued longer than the given age ago, regardless of their expiration. Claims without "iat" are refused
+func MaxClaimsAge(age time.Duration) ClaimsValidator {
+	return ClaimsValidatorFunc(func(ctx ClaimsContext) error {
+		if ctx.Claims.IssuedAt == 0 {
+			return errors.WithMessage(ErrInvalidClaims, `missing claim "iat"`)
+		}
+
+		if ctx.Now.Sub(time.Unix(ctx.Claims.IssuedAt, 0)) > age {
+			return errors.WithMessage(ErrInvalidClaims, "token is too old")
+		}
+
+		return nil
+	})
+}
+
+// SetClaimsValidators is the setter for the claims validators. Every parsed token is checked by the validators in order,
+// after the signature and regardless of the time-based claims validation being skipped
+func (config *JWTConfig) SetClaimsValidators(validators ...ClaimsValidator) {
+	config.validators = validators
+}
+
+// validateCustomClaims checks the claims with the claims validators. The segment is the encoded claims of the token, if any
+func (service JWTService) validateCustomClaims(claims JWTClaims, segment string) error {
+	if len(service.config.validators) == 0 {
+		return nil
+	}
+
+	ctx := ClaimsContext{Claims: claims, Now: service.Now(), segment: segment}
+	for _, validator := range service.config.validators {
+		if err := validator.ValidateClaims(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// claimsSegment returns the encoded claims of a compact JWS
+func claimsSegment(tokenString string) string {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	return parts[1]
+}
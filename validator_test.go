@@ -0,0 +1,82 @@
+package gate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+func TestClaimsValidators(t *testing.T) {
+	sign := func(claims jwt.MapClaims) string {
+		str, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+		return str
+	}
+
+	now := time.Now()
+	service, config := newTestJWTService(t)
+	config.SetClaimsValidators(RequireClaims("tenant"), AllowClaimValues("tenant", "acme", "globex"), MaxClaimsAge(time.Hour))
+	service = NewJWTService(config)
+
+	t.Run("valid", func(t *testing.T) {
+		_, err := service.Parse(sign(jwt.MapClaims{"user": map[string]interface{}{"id": "id"}, "tenant": "acme", "iat": now.Unix()}))
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid claims: %s", err)
+		}
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		cases := map[string]jwt.MapClaims{
+			"missing claim":   {"user": map[string]interface{}{"id": "id"}, "iat": now.Unix()},
+			"empty claim":     {"user": map[string]interface{}{"id": "id"}, "tenant": "", "iat": now.Unix()},
+			"tenant":          {"user": map[string]interface{}{"id": "id"}, "tenant": "initech", "iat": now.Unix()},
+			"tenant array":    {"user": map[string]interface{}{"id": "id"}, "tenant": []string{"acme", "initech"}, "iat": now.Unix()},
+			"age":             {"user": map[string]interface{}{"id": "id"}, "tenant": "acme", "iat": now.Add(-2 * time.Hour).Unix()},
+			"missing iat age": {"user": map[string]interface{}{"id": "id"}, "tenant": "acme"},
+		}
+
+		for name, claims := range cases {
+			_, err := service.Parse(sign(claims))
+			if errors.Cause(err) != ErrInvalidClaims {
+				t.Fatalf("err should be ErrInvalidClaims because of the %s: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		config := config
+		config.SetClaimsValidators(ClaimsValidatorFunc(func(ctx ClaimsContext) error {
+			if ctx.Claims.User.ID != "admin" {
+				return ErrInvalidClaims
+			}
+			return nil
+		}))
+		custom := NewJWTService(config)
+
+		_, err := custom.Parse(sign(jwt.MapClaims{"user": map[string]interface{}{"id": "id"}}))
+		if errors.Cause(err) != ErrInvalidClaims {
+			t.Fatalf("err should be ErrInvalidClaims: %v", err)
+		}
+
+		_, err = custom.Parse(sign(jwt.MapClaims{"user": map[string]interface{}{"id": "admin"}}))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		raw, err := (ClaimsContext{Claims: JWTClaims{User: UserInfo{ID: "id"}}}).Raw()
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		user, ok := raw["user"].(map[string]interface{})
+		if !ok || user["id"] != "id" {
+			t.Fatalf("claims without a segment should be encoded: %v", raw)
+		}
+	})
+}
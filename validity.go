@@ -0,0 +1,48 @@
+package gate
+
+import (
+	"time"
+)
+
+// TimeBounded is the optional contract for roles and abilities with a validity window, e.g. temporary elevated access.
+// A zero time leaves the corresponding side of the window open
+type TimeBounded interface {
+	GetNotBefore() time.Time
+	GetExpiresAt() time.Time
+}
+
+// AbilityGrantee is the optional contract for users holding abilities granted directly, besides the abilities of their roles
+type AbilityGrantee interface {
+	GetGrantedAbilities() []UserAbility
+}
+
+// IsActive reports whether an entity is within its validity window at the given time. Entities without a window are always active
+func IsActive(entity interface{}, now time.Time) bool {
+	bounded, ok := entity.(TimeBounded)
+	if !ok {
+		return true
+	}
+
+	notBefore, expiresAt := bounded.GetNotBefore(), bounded.GetExpiresAt()
+	if !notBefore.IsZero() && now.Before(notBefore) {
+		return false
+	}
+
+	return expiresAt.IsZero() || now.Before(expiresAt)
+}
+
+// NextTransition returns the next time an entity becomes active or inactive after the given time, or the zero time if it never does
+func NextTransition(entity interface{}, now time.Time) (next time.Time) {
+	bounded, ok := entity.(TimeBounded)
+	if !ok {
+		return
+	}
+
+	for _, at := range []time.Time{bounded.GetNotBefore(), bounded.GetExpiresAt()} {
+		if at.After(now) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+
+	return
+}
@@ -0,0 +1,59 @@
+package gate
+
+import (
+	"testing"
+	"time"
+)
+
+type testWindow struct {
+	notBefore time.Time
+	expiresAt time.Time
+}
+
+func (w testWindow) GetNotBefore() time.Time {
+	return w.notBefore
+}
+
+func (w testWindow) GetExpiresAt() time.Time {
+	return w.expiresAt
+}
+
+func TestValidity(t *testing.T) {
+	now := time.Date(2020, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	t.Run("is active", func(t *testing.T) {
+		cases := []struct {
+			entity interface{}
+			active bool
+		}{
+			{testAbility{"GET", "*"}, true},
+			{testWindow{}, true},
+			{testWindow{notBefore: now}, true},
+			{testWindow{notBefore: now.Add(time.Second)}, false},
+			{testWindow{expiresAt: now}, false},
+			{testWindow{expiresAt: now.Add(time.Second)}, true},
+		}
+
+		for i, c := range cases {
+			if IsActive(c.entity, now) != c.active {
+				t.Errorf("case %d should be active: %v", i, c.active)
+			}
+		}
+	})
+
+	t.Run("next transition", func(t *testing.T) {
+		if !NextTransition(testAbility{"GET", "*"}, now).IsZero() {
+			t.Fatal("entities without a window never transition")
+		}
+
+		next := NextTransition(testWindow{now.Add(time.Minute), now.Add(time.Hour)}, now)
+		if !next.Equal(now.Add(time.Minute)) {
+			t.Fatalf("the next transition should be the start of the window: %s", next)
+		}
+
+		next = NextTransition(testWindow{now.Add(-time.Minute), now.Add(time.Hour)}, now)
+		if !next.Equal(now.Add(time.Hour)) {
+			t.Fatalf("the next transition should be the end of the window: %s", next)
+		}
+	})
+}
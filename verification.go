@@ -0,0 +1,109 @@
+package gate
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPoolClosed is thrown when a token is parsed with a closed verification pool
+var ErrPoolClosed = errors.New("verification pool is closed")
+
+type verificationResult struct {
+	token JWT
+	err   error
+}
+
+type verificationRequest struct {
+	tokenString string
+	result      chan verificationResult
+}
+
+// VerificationPool verifies JWTs with a fixed number of workers, each of them reusing its parser.
+// It bounds the CPU spent on expensive signatures, e.g. RSA, at high request rates
+type VerificationPool struct {
+	service  JWTService
+	requests chan verificationRequest
+	results  sync.Pool
+	closed   chan struct{}
+	once     *sync.Once
+	workers  *sync.WaitGroup
+}
+
+// Parse resolves a token string to a JWT with one of the workers
+func (pool *VerificationPool) Parse(tokenString string) (token JWT, err error) {
+	result, _ := pool.results.Get().(chan verificationResult)
+	if result == nil {
+		result = make(chan verificationResult, 1)
+	}
+
+	select {
+	case <-pool.closed:
+		err = ErrPoolClosed
+		return
+	case pool.requests <- verificationRequest{tokenString, result}:
+	}
+
+	verified := <-result
+	pool.results.Put(result)
+	return verified.token, verified.err
+}
+
+// Close stops the workers once the pending verifications are done
+func (pool *VerificationPool) Close() {
+	pool.once.Do(func() {
+		close(pool.closed)
+	})
+
+	pool.workers.Wait()
+}
+
+func (pool *VerificationPool) work() {
+	defer pool.workers.Done()
+
+	parser := pool.service.newParser()
+	for {
+		select {
+		case <-pool.closed:
+			return
+		case request := <-pool.requests:
+			service := pool.service.current()
+			current := parser
+			if service.parser != pool.service.parser {
+				current = service.parser
+			}
+
+			token, err := service.parseOverlapping(current, request.tokenString)
+			request.result <- verificationResult{token, err}
+		}
+	}
+}
+
+// NewVerificationPool is the constructor for VerificationPool. A non-positive number of workers uses one worker per CPU
+func NewVerificationPool(service JWTService, workers int) *VerificationPool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	service.pool = nil
+	pool := &VerificationPool{
+		service:  service,
+		requests: make(chan verificationRequest),
+		closed:   make(chan struct{}),
+		once:     &sync.Once{},
+		workers:  &sync.WaitGroup{},
+	}
+
+	pool.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go pool.work()
+	}
+
+	return pool
+}
+
+// SetVerificationPool is the setter for the verification pool. When set, Parse delegates the verification to the pool
+func (service *JWTService) SetVerificationPool(pool *VerificationPool) {
+	service.pool = pool
+}
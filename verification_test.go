@@ -0,0 +1,110 @@
+package gate
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRSATestService(tb testing.TB) JWTService {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatalf("err should be nil: %s", err)
+	}
+
+	config, err := NewHMACJWTConfig("RS256", key, time.Hour, false)
+	if err != nil {
+		tb.Fatalf("err should be nil because of the valid configuration: %s", err)
+	}
+
+	return NewJWTService(config)
+}
+
+func TestVerificationPool(t *testing.T) {
+	service := newRSATestService(t)
+	token, err := service.Issue(service.NewClaims(testUser{ID: "id"}))
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	t.Run("public key", func(t *testing.T) {
+		parsed, err := service.Parse(token.Value)
+		if err != nil || parsed.UserID != "id" {
+			t.Fatalf("err should be nil because of the derived public key: %v", err)
+		}
+	})
+
+	t.Run("workers", func(t *testing.T) {
+		pool := NewVerificationPool(service, 2)
+		defer pool.Close()
+
+		pooled := service
+		pooled.SetVerificationPool(pool)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := pooled.Parse(token.Value)
+				errs <- err
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("err should be nil because of the valid token: %s", err)
+			}
+		}
+
+		_, err := pooled.Parse(token.Value + "x")
+		if err == nil {
+			t.Fatal("err should not be nil because of the invalid signature")
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		pool := NewVerificationPool(service, 0)
+		pool.Close()
+		pool.Close()
+
+		_, err := pool.Parse(token.Value)
+		if err != ErrPoolClosed {
+			t.Fatalf("err should be ErrPoolClosed: %v", err)
+		}
+	})
+}
+
+func BenchmarkJWTParseRSA(b *testing.B) {
+	service := newRSATestService(b)
+	token, err := service.Issue(service.NewClaims(testUser{ID: "id"}))
+	if err != nil {
+		b.Fatalf("err should be nil: %s", err)
+	}
+
+	b.Run("direct", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				service.Parse(token.Value)
+			}
+		})
+	})
+
+	b.Run("pool", func(b *testing.B) {
+		pool := NewVerificationPool(service, 0)
+		defer pool.Close()
+
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				pool.Parse(token.Value)
+			}
+		})
+	})
+}
@@ -0,0 +1,186 @@
+package gate
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// WebhookSignatureHeader is the request header carrying the signature of a webhook
+const WebhookSignatureHeader = "X-Gate-Signature"
+
+// WebhookType is the "typ" header of webhook signatures. JWTs of this type are refused by the JWT service,
+// so a signature never stands for an access token even with the body attached
+const WebhookType = "gate-webhook+jws"
+
+// DefaultWebhookTolerance is the default tolerance of webhook timestamps
+const DefaultWebhookTolerance = 5 * time.Minute
+
+// ErrInvalidWebhookSignature is thrown when the signature of a webhook is invalid, expired or does not match the body
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// ErrWebhookReplayed is thrown when the signature of a webhook has already been verified
+var ErrWebhookReplayed = errors.New("webhook has been replayed")
+
+// WebhookHeader is the protected header of webhook signatures. The timestamp and the ID are signed along with the body
+type WebhookHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid,omitempty"`
+	Type      string `json:"typ"`
+	IssuedAt  int64  `json:"iat"`
+	ID        string `json:"jti"`
+}
+
+// Webhooks signs outbound webhook payloads and verifies inbound ones with the keys of a JWT service.
+// Signatures are JWS in the compact serialization with a detached payload (RFC 7515, appendix F), i.e. "header..signature",
+// the payload being the webhook body. The header carries the timestamp and an ID which is checked against replays
+type Webhooks struct {
+	service   JWTService
+	tolerance time.Duration
+	replays   CounterStore
+}
+
+// Sign returns the signature of a webhook body, to be sent in WebhookSignatureHeader
+func (webhooks Webhooks) Sign(body []byte) (string, error) {
+	service := webhooks.service.current()
+	if service.config.codec != nil || service.config.method == nil {
+		return "", errors.New("webhooks require JWS signing")
+	}
+
+	method, key, kid, err := service.signingKey()
+	if err != nil {
+		return "", errors.Wrap(err, "could not sign webhook")
+	}
+
+	header, err := json.Marshal(WebhookHeader{
+		Algorithm: method.Alg(),
+		KeyID:     kid,
+		Type:      WebhookType,
+		IssuedAt:  service.Now().Unix(),
+		ID:        service.GenerateClaimsID(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "could not sign webhook")
+	}
+
+	headerSegment := jwt.EncodeSegment(header)
+	signature, err := method.Sign(headerSegment+"."+jwt.EncodeSegment(body), key)
+	if err != nil {
+		return "", errors.Wrap(err, "could not sign webhook")
+	}
+
+	return headerSegment + ".." + signature, nil
+}
+
+// Verify verifies the signature of a webhook body. Signatures are valid within the tolerance of their timestamp and only once
+// when a replay counter store is set. Signatures of the previous keys are accepted within the overlap window of a key rotation
+func (webhooks Webhooks) Verify(signature string, body []byte) (header WebhookHeader, err error) {
+	service := webhooks.service.current()
+	if service.config.codec != nil || service.config.method == nil {
+		err = errors.New("webhooks require JWS signing")
+		return
+	}
+
+	header, err = service.verifyDetached(signature, body)
+	if err != nil {
+		previous, ok := service.previous()
+		if !ok {
+			err = errors.WithMessage(ErrInvalidWebhookSignature, err.Error())
+			return
+		}
+
+		header, err = previous.verifyDetached(signature, body)
+		if err != nil {
+			err = errors.WithMessage(ErrInvalidWebhookSignature, err.Error())
+			return
+		}
+	}
+
+	now := service.Now()
+	issuedAt := time.Unix(header.IssuedAt, 0)
+	switch {
+	case header.IssuedAt == 0 || header.ID == "":
+		err = errors.WithMessage(ErrInvalidWebhookSignature, "missing timestamp or ID")
+	case issuedAt.Before(now.Add(-webhooks.tolerance)) || issuedAt.After(now.Add(webhooks.tolerance)):
+		err = errors.WithMessage(ErrInvalidWebhookSignature, "timestamp out of tolerance")
+	}
+	if err != nil || webhooks.replays == nil {
+		return
+	}
+
+	count, err := webhooks.replays.Increment("webhook:"+header.ID, 2*webhooks.tolerance)
+	if err != nil {
+		err = errors.Wrap(err, "could not check webhook replay")
+		return
+	}
+
+	if count > 1 {
+		err = ErrWebhookReplayed
+	}
+	return
+}
+
+// verifyDetached verifies a detached JWS of a webhook body with the keys of the service configuration
+func (service JWTService) verifyDetached(signature string, body []byte) (header WebhookHeader, err error) {
+	segments := strings.Split(signature, ".")
+	if len(segments) != 3 || segments[1] != "" {
+		err = errors.New("malformed detached JWS")
+		return
+	}
+
+	data, err := jwt.DecodeSegment(segments[0])
+	if err != nil {
+		err = errors.New("malformed detached JWS")
+		return
+	}
+
+	raw := map[string]interface{}{}
+	if err = json.Unmarshal(data, &raw); err != nil || json.Unmarshal(data, &header) != nil {
+		err = errors.New("malformed detached JWS")
+		return
+	}
+
+	if header.Type != WebhookType {
+		err = errors.New("unexpected type")
+		return
+	}
+
+	if _, ok := raw["crit"]; ok {
+		err = ErrUnsupportedCriticalHeader
+		return
+	}
+
+	method := jwt.GetSigningMethod(header.Algorithm)
+	switch {
+	case method == nil:
+		err = errors.New("invalid algorithm")
+	case method == jwt.SigningMethodNone:
+		err = ErrAlgorithmNone
+	case !service.isAlgorithmAllowed(header.Algorithm):
+		err = ErrAlgorithmNotAllowed
+	}
+	if err != nil {
+		return
+	}
+
+	key, err := service.getVerifyingKey(&jwt.Token{Header: raw, Method: method})
+	if err != nil {
+		return
+	}
+
+	err = method.Verify(segments[0]+"."+jwt.EncodeSegment(body), segments[2], key)
+	return
+}
+
+// NewWebhooks is the constructor for Webhooks with the JWT service, the tolerance of timestamps, DefaultWebhookTolerance if not positive,
+// and the counter store used against replays, e.g. MemoryCounterStore. Replays are not checked without a counter store
+func NewWebhooks(service JWTService, tolerance time.Duration, replays CounterStore) Webhooks {
+	if tolerance <= 0 {
+		tolerance = DefaultWebhookTolerance
+	}
+
+	return Webhooks{service, tolerance, replays}
+}
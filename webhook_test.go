@@ -0,0 +1,151 @@
+package gate
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type stubCodec struct{}
+
+func (stubCodec) Encode(JWTClaims) (string, error) {
+	return "", nil
+}
+
+func (stubCodec) Decode(string) (JWTClaims, error) {
+	return JWTClaims{}, nil
+}
+
+func TestWebhooks(t *testing.T) {
+	service, _ := newTestJWTService(t)
+	now := time.Now()
+	service.Now = func() time.Time {
+		return now
+	}
+
+	replays := NewMemoryCounterStore()
+	webhooks := NewWebhooks(service, time.Minute, replays)
+	body := []byte(`{"event":"user.created"}`)
+
+	signature, err := webhooks.Sign(body)
+	if err != nil {
+		t.Fatalf("err should be nil: %s", err)
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		header, err := webhooks.Verify(signature, body)
+		if err != nil {
+			t.Fatalf("err should be nil because of the valid signature: %s", err)
+		}
+
+		if header.ID == "" || header.IssuedAt != now.Unix() || header.Type != WebhookType {
+			t.Fatalf("invalid header: %+v", header)
+		}
+
+		if segments := strings.Split(signature, "."); len(segments) != 3 || segments[1] != "" {
+			t.Fatalf("the payload should be detached: %s", signature)
+		}
+
+		if _, err = webhooks.Verify(signature, body); errors.Cause(err) != ErrWebhookReplayed {
+			t.Fatalf("err should be ErrWebhookReplayed: %v", err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		signature, err := webhooks.Sign(body)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = webhooks.Verify(signature, []byte(`{"event":"user.deleted"}`)); errors.Cause(err) != ErrInvalidWebhookSignature {
+			t.Fatalf("err should be ErrInvalidWebhookSignature because of the body: %v", err)
+		}
+
+		if _, err = webhooks.Verify(signature[:len(signature)-2], body); errors.Cause(err) != ErrInvalidWebhookSignature {
+			t.Fatalf("err should be ErrInvalidWebhookSignature because of the signature: %v", err)
+		}
+	})
+
+	t.Run("tolerance", func(t *testing.T) {
+		signature, err := webhooks.Sign(body)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		late := webhooks
+		late.service.Now = func() time.Time {
+			return now.Add(2 * time.Minute)
+		}
+
+		if _, err = late.Verify(signature, body); errors.Cause(err) != ErrInvalidWebhookSignature {
+			t.Fatalf("err should be ErrInvalidWebhookSignature because of the timestamp: %v", err)
+		}
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		signature, err := webhooks.Sign([]byte(`{"user":{"id":"1"},"exp":` + strconv.FormatInt(now.Add(time.Hour).Unix(), 10) + `}`))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		segments := strings.Split(signature, ".")
+		attached := segments[0] + "." + segment(`{"user":{"id":"1"},"exp":`+strconv.FormatInt(now.Add(time.Hour).Unix(), 10)+`}`) + "." + segments[2]
+		if _, err = service.Parse(attached); errors.Cause(err) != ErrUnexpectedJWTType {
+			t.Fatalf("err should be ErrUnexpectedJWTType because webhook signatures are not tokens: %v", err)
+		}
+
+		token, err := service.Issue(service.NewClaims(testUser{ID: "1"}))
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = webhooks.Verify(token.Value, body); errors.Cause(err) != ErrInvalidWebhookSignature {
+			t.Fatalf("err should be ErrInvalidWebhookSignature because tokens are not webhook signatures: %v", err)
+		}
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		rotated, _ := newTestJWTService(t)
+		rotated.Now = service.Now
+		rotating := NewWebhooks(rotated, time.Minute, nil)
+		signature, err := rotating.Sign(body)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		config, err := NewHMACJWTConfig("HS256", "rotated", time.Hour, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if err = rotated.Reload(config, time.Hour); err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = rotating.Verify(signature, body); err != nil {
+			t.Fatalf("err should be nil because of the overlap window: %s", err)
+		}
+
+		if err = rotated.Reload(config, 0); err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = rotating.Verify(signature, body); errors.Cause(err) != ErrInvalidWebhookSignature {
+			t.Fatalf("err should be ErrInvalidWebhookSignature because the previous key is no longer accepted: %v", err)
+		}
+	})
+
+	t.Run("codec", func(t *testing.T) {
+		config, err := NewCodecJWTConfig(stubCodec{}, time.Hour, false)
+		if err != nil {
+			t.Fatalf("err should be nil: %s", err)
+		}
+
+		if _, err = NewWebhooks(NewJWTService(config), 0, nil).Sign(body); err == nil {
+			t.Fatal("err should not be nil because of the token codec")
+		}
+	})
+}